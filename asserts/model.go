@@ -358,6 +358,26 @@ const (
 
 var validStorageSafeties = []string{string(StorageSafetyEncrypted), string(StorageSafetyPreferEncrypted), string(StorageSafetyPreferUnencrypted)}
 
+// StorageProtection characterizes the additional authentication
+// factor, if any, required by the model to unlock the encrypted
+// storage on boot.
+type StorageProtection string
+
+const (
+	StorageProtectionUnset StorageProtection = "unset"
+	// StorageProtectionNone implies the encrypted storage is
+	// unlocked with the sealed keys alone.
+	StorageProtectionNone StorageProtection = "none"
+	// StorageProtectionTPMPIN implies the keys are sealed to the
+	// TPM with a PIN policy, the PIN is asked for on boot.
+	StorageProtectionTPMPIN StorageProtection = "tpm+pin"
+	// StorageProtectionPassphrase implies the encrypted storage
+	// is unlocked with a passphrase asked for on boot.
+	StorageProtectionPassphrase StorageProtection = "passphrase"
+)
+
+var validStorageProtections = []string{string(StorageProtectionNone), string(StorageProtectionTPMPIN), string(StorageProtectionPassphrase)}
+
 var validModelGrades = []string{string(ModelSecured), string(ModelSigned), string(ModelDangerous)}
 
 // gradeToCode encodes grades into 32 bits, trying to be slightly future-proof:
@@ -393,7 +413,8 @@ type Model struct {
 
 	grade ModelGrade
 
-	storageSafety StorageSafety
+	storageSafety     StorageSafety
+	storageProtection StorageProtection
 
 	allSnaps []*ModelSnap
 	// consumers of this info should care only about snap identity =>
@@ -453,6 +474,13 @@ func (mod *Model) StorageSafety() StorageSafety {
 	return mod.storageSafety
 }
 
+// StorageProtection returns the additional authentication required to
+// unlock the encrypted storage of the model. Will be
+// StorageProtectionUnset for Core 16/18 models.
+func (mod *Model) StorageProtection() StorageProtection {
+	return mod.storageProtection
+}
+
 // GadgetSnap returns the details of the gadget snap the model uses.
 func (mod *Model) GadgetSnap() *ModelSnap {
 	return mod.gadgetSnap
@@ -673,6 +701,9 @@ func assembleModel(assert assertionBase) (Assertion, error) {
 		if _, ok := assert.headers["storage-safety"]; ok {
 			return nil, fmt.Errorf("cannot specify storage-safety for model without the extended snaps header")
 		}
+		if _, ok := assert.headers["storage-protection"]; ok {
+			return nil, fmt.Errorf("cannot specify storage-protection for model without the extended snaps header")
+		}
 	}
 
 	if classic {
@@ -725,6 +756,7 @@ func assembleModel(assert assertionBase) (Assertion, error) {
 	var modSnaps *modelSnaps
 	grade := ModelGradeUnset
 	storageSafety := StorageSafetyUnset
+	storageProtection := StorageProtectionUnset
 	if extended {
 		gradeStr, err := checkOptionalString(assert.headers, "grade")
 		if err != nil {
@@ -759,6 +791,21 @@ func assembleModel(assert assertionBase) (Assertion, error) {
 			return nil, fmt.Errorf(`secured grade model must not have storage-safety overridden, only "encrypted" is valid`)
 		}
 
+		storageProtectionStr, err := checkOptionalString(assert.headers, "storage-protection")
+		if err != nil {
+			return nil, err
+		}
+		if storageProtectionStr != "" && !strutil.ListContains(validStorageProtections, storageProtectionStr) {
+			return nil, fmt.Errorf("storage-protection for model must be %s, not %q", strings.Join(validStorageProtections, "|"), storageProtectionStr)
+		}
+		storageProtection = StorageProtectionNone
+		if storageProtectionStr != "" {
+			storageProtection = StorageProtection(storageProtectionStr)
+		}
+		if storageProtection != StorageProtectionNone && storageSafety != StorageSafetyEncrypted {
+			return nil, fmt.Errorf(`storage-protection %q for model requires storage-safety to be "encrypted"`, storageProtection)
+		}
+
 		modSnaps, err = checkExtendedSnaps(extendedSnaps, base, grade)
 		if err != nil {
 			return nil, err
@@ -847,6 +894,7 @@ func assembleModel(assert assertionBase) (Assertion, error) {
 		kernelSnap:                 modSnaps.kernel,
 		grade:                      grade,
 		storageSafety:              storageSafety,
+		storageProtection:          storageProtection,
 		allSnaps:                   allSnaps,
 		requiredWithEssentialSnaps: requiredWithEssentialSnaps,
 		numEssentialSnaps:          numEssentialSnaps,
@@ -180,6 +180,7 @@ func (mods *modelSuite) TestDecodeOK(c *C) {
 	c.Check(model.Store(), Equals, "brand-store")
 	c.Check(model.Grade(), Equals, asserts.ModelGradeUnset)
 	c.Check(model.StorageSafety(), Equals, asserts.StorageSafetyUnset)
+	c.Check(model.StorageProtection(), Equals, asserts.StorageProtectionUnset)
 	essentialSnaps := model.EssentialSnaps()
 	c.Check(essentialSnaps, DeepEquals, []*asserts.ModelSnap{
 		model.KernelSnap(),
@@ -481,6 +482,7 @@ func (mods *modelSuite) TestDecodeInvalid(c *C) {
 		{sysUserAuths, "system-user-authority:\n  a: 1\n", `"system-user-authority" header must be '\*' or a list of account ids`},
 		{sysUserAuths, "system-user-authority:\n  - 5_6\n", `"system-user-authority" header must be '\*' or a list of account ids`},
 		{reqSnaps, "grade: dangerous\n", `cannot specify a grade for model without the extended snaps header`},
+		{reqSnaps, "storage-protection: passphrase\n", `cannot specify storage-protection for model without the extended snaps header`},
 	}
 
 	for _, test := range invalidTests {
@@ -668,6 +670,7 @@ func (mods *modelSuite) TestCore20DecodeOK(c *C) {
 	c.Check(model.Store(), Equals, "brand-store")
 	c.Check(model.Grade(), Equals, asserts.ModelSecured)
 	c.Check(model.StorageSafety(), Equals, asserts.StorageSafetyEncrypted)
+	c.Check(model.StorageProtection(), Equals, asserts.StorageProtectionNone)
 	essentialSnaps := model.EssentialSnaps()
 	c.Check(essentialSnaps, DeepEquals, []*asserts.ModelSnap{
 		model.KernelSnap(),
@@ -892,6 +895,27 @@ func (mods *modelSuite) TestCore20DefaultStorageSafetySignedDangerous(c *C) {
 	}
 }
 
+func (mods *modelSuite) TestCore20ValidStorageProtection(c *C) {
+	encoded := strings.Replace(core20ModelExample, "TSLINE", mods.tsLine, 1)
+	encoded = strings.Replace(encoded, "OTHER", "", 1)
+
+	for _, tc := range []struct {
+		sp  asserts.StorageProtection
+		sps string
+	}{
+		{asserts.StorageProtectionNone, "none"},
+		{asserts.StorageProtectionTPMPIN, "tpm+pin"},
+		{asserts.StorageProtectionPassphrase, "passphrase"},
+	} {
+		ex := strings.Replace(encoded, "storage-safety: encrypted\n", fmt.Sprintf("storage-safety: encrypted\nstorage-protection: %s\n", tc.sps), 1)
+		a, err := asserts.Decode([]byte(ex))
+		c.Assert(err, IsNil)
+		c.Check(a.Type(), Equals, asserts.ModelType)
+		model := a.(*asserts.Model)
+		c.Check(model.StorageProtection(), Equals, tc.sp)
+	}
+}
+
 func (mods *modelSuite) TestCore20DecodeInvalid(c *C) {
 	encoded := strings.Replace(core20ModelExample, "TSLINE", mods.tsLine, 1)
 
@@ -932,6 +956,8 @@ func (mods *modelSuite) TestCore20DecodeInvalid(c *C) {
 		{"grade: secured\n", "grade: foo\n", `grade for model must be secured|signed|dangerous`},
 		{"storage-safety: encrypted\n", "storage-safety: foo\n", `storage-safety for model must be encrypted\|prefer-encrypted\|prefer-unencrypted, not "foo"`},
 		{"storage-safety: encrypted\n", "storage-safety: prefer-unencrypted\n", `secured grade model must not have storage-safety overridden, only "encrypted" is valid`},
+		{"storage-safety: encrypted\n", "storage-safety: encrypted\nstorage-protection: foo\n", `storage-protection for model must be none\|tpm\+pin\|passphrase, not "foo"`},
+		{"grade: secured\nstorage-safety: encrypted\n", "grade: signed\nstorage-safety: prefer-encrypted\nstorage-protection: tpm+pin\n", `storage-protection "tpm\+pin" for model requires storage-safety to be "encrypted"`},
 	}
 	for _, test := range invalidTests {
 		invalid := strings.Replace(encoded, test.original, test.invalid, 1)
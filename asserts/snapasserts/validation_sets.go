@@ -27,6 +27,7 @@ import (
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
 )
 
 // ValidationSetsConflictError describes an error where multiple
@@ -281,3 +282,263 @@ func (v *ValidationSets) Conflict() error {
 	}
 	return nil
 }
+
+// InstalledSnap holds the minimal details about an installed snap required to
+// check it against validation sets.
+type InstalledSnap struct {
+	naming.SnapRef
+	Revision snap.Revision
+}
+
+// NewInstalledSnap creates InstalledSnap.
+func NewInstalledSnap(name, snapID string, revision snap.Revision) *InstalledSnap {
+	return &InstalledSnap{
+		SnapRef:  naming.NewSnapRef(name, snapID),
+		Revision: revision,
+	}
+}
+
+// ValidationSetsValidationError describes an error arising
+// from validation of snaps against ValidationSets.
+type ValidationSetsValidationError struct {
+	// MissingSnaps maps missing snap names to the validation sets requiring them.
+	MissingSnaps map[string][]string
+	// InvalidSnaps maps snap names to the validation sets declaring them invalid.
+	InvalidSnaps map[string][]string
+	// WrongRevisionSnaps maps snap names to the expected revisions and
+	// respective validation sets that require them.
+	WrongRevisionSnaps map[string]map[snap.Revision][]string
+	// Sets maps validation set keys referenced by above maps to actual
+	// validation sets.
+	Sets map[string]*asserts.ValidationSet
+}
+
+func (e *ValidationSetsValidationError) Error() string {
+	buf := bytes.NewBufferString("validation sets assertions are not met:")
+	printDetails := func(header string, details map[string][]string,
+		printSnap func(snapName string, keys []string) string) {
+		if len(details) == 0 {
+			return
+		}
+		fmt.Fprintf(buf, "\n- %s:", header)
+		for _, snapName := range sortedKeys(details) {
+			fmt.Fprintf(buf, "\n  - %s", printSnap(snapName, details[snapName]))
+		}
+	}
+
+	printDetails("missing required snaps", e.MissingSnaps, func(snapName string, validationSetKeys []string) string {
+		return fmt.Sprintf("%s (required by sets %s)", snapName, strings.Join(validationSetKeys, ","))
+	})
+	printDetails("invalid snaps", e.InvalidSnaps, func(snapName string, validationSetKeys []string) string {
+		return fmt.Sprintf("%s (invalid for sets %s)", snapName, strings.Join(validationSetKeys, ","))
+	})
+
+	if len(e.WrongRevisionSnaps) > 0 {
+		fmt.Fprint(buf, "\n- snaps at wrong revisions:")
+		snapNames := make([]string, 0, len(e.WrongRevisionSnaps))
+		for snapName := range e.WrongRevisionSnaps {
+			snapNames = append(snapNames, snapName)
+		}
+		sort.Strings(snapNames)
+		for _, snapName := range snapNames {
+			revs := e.WrongRevisionSnaps[snapName]
+			for _, rev := range sortedRevisions(revs) {
+				fmt.Fprintf(buf, "\n  - %s (required at revision %s by sets %s)", snapName, rev, strings.Join(revs[rev], ","))
+			}
+		}
+	}
+	return buf.String()
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedRevisions(m map[snap.Revision][]string) []snap.Revision {
+	revs := make([]snap.Revision, 0, len(m))
+	for r := range m {
+		revs = append(revs, r)
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i].N < revs[j].N })
+	return revs
+}
+
+// setKeys returns the sorted keys of the validation sets of the given
+// constraints, restricted to the given presence if not empty.
+func setKeys(rcs []*revConstraint, presence asserts.Presence) []string {
+	keys := make([]string, 0, len(rcs))
+	for _, rc := range rcs {
+		if presence != "" && rc.Presence != presence {
+			continue
+		}
+		keys = append(keys, rc.validationSetKey)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// allSetKeys returns the sorted keys of all the validation sets constraining
+// the snap, restricted to the given presence if not empty.
+func (c *snapContraints) allSetKeys(presence asserts.Presence) []string {
+	var keys []string
+	for _, rcs := range c.revisions {
+		keys = append(keys, setKeys(rcs, presence)...)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// requiredRevision returns the specific revision of the snap the validation
+// sets agree on, or the unset revision if there is none.
+func (c *snapContraints) requiredRevision() snap.Revision {
+	for rev := range c.revisions {
+		if rev.N >= 1 {
+			return rev
+		}
+	}
+	return snap.Revision{}
+}
+
+// constraintsFor returns the constraints for the given snap, looking it up by
+// snap-id if possible, by name otherwise.
+func (v *ValidationSets) constraintsFor(snapRef naming.SnapRef) *snapContraints {
+	if id := snapRef.ID(); id != "" {
+		if cs := v.snaps[id]; cs != nil {
+			return cs
+		}
+		return nil
+	}
+	for _, cs := range v.snaps {
+		if cs.name == snapRef.SnapName() {
+			return cs
+		}
+	}
+	return nil
+}
+
+// CheckInstalledSnaps checks installed snaps against the validation sets.
+// It returns a *ValidationSetsValidationError if some snaps are missing,
+// invalid or at the wrong revision.
+func (v *ValidationSets) CheckInstalledSnaps(snaps []*InstalledSnap) error {
+	installedByID := make(map[string]*InstalledSnap, len(snaps))
+	installedByName := make(map[string]*InstalledSnap, len(snaps))
+	for _, sn := range snaps {
+		if id := sn.ID(); id != "" {
+			installedByID[id] = sn
+		}
+		installedByName[sn.SnapName()] = sn
+	}
+
+	missing := make(map[string][]string)
+	invalid := make(map[string][]string)
+	wrongRevision := make(map[string]map[snap.Revision][]string)
+	sets := make(map[string]*asserts.ValidationSet)
+	addSets := func(keys []string) {
+		for _, key := range keys {
+			sets[key] = v.sets[key]
+		}
+	}
+
+	for snapID, cs := range v.snaps {
+		if cs.presence == presConflict {
+			// conflicts are reported by Conflict
+			continue
+		}
+		installed := installedByID[snapID]
+		if installed == nil {
+			// the snap may have been installed locally
+			installed = installedByName[cs.name]
+		}
+
+		switch cs.presence {
+		case asserts.PresenceInvalid:
+			if installed == nil {
+				continue
+			}
+			if rcs, ok := cs.revisions[invalidPresRevision]; ok {
+				invalid[cs.name] = setKeys(rcs, asserts.PresenceInvalid)
+			} else {
+				// optional at different revisions
+				invalid[cs.name] = cs.allSetKeys("")
+			}
+			addSets(invalid[cs.name])
+			continue
+		case asserts.PresenceRequired:
+			if installed == nil {
+				missing[cs.name] = cs.allSetKeys(asserts.PresenceRequired)
+				addSets(missing[cs.name])
+				continue
+			}
+		}
+
+		if installed == nil {
+			// optional and not installed
+			continue
+		}
+		rev := cs.requiredRevision()
+		if !rev.Unset() && installed.Revision != rev {
+			keys := setKeys(cs.revisions[rev], "")
+			wrongRevision[cs.name] = map[snap.Revision][]string{rev: keys}
+			addSets(keys)
+		}
+	}
+
+	if len(missing) > 0 || len(invalid) > 0 || len(wrongRevision) > 0 {
+		verr := &ValidationSetsValidationError{Sets: sets}
+		if len(missing) > 0 {
+			verr.MissingSnaps = missing
+		}
+		if len(invalid) > 0 {
+			verr.InvalidSnaps = invalid
+		}
+		if len(wrongRevision) > 0 {
+			verr.WrongRevisionSnaps = wrongRevision
+		}
+		return verr
+	}
+	return nil
+}
+
+// CheckPresenceRequired returns the keys of all the validation sets that
+// require the given snap, together with the revision they require or the
+// unset revision if no specific revision is required. It returns an error
+// if the snap is declared invalid by the validation sets.
+func (v *ValidationSets) CheckPresenceRequired(snapRef naming.SnapRef) ([]string, snap.Revision, error) {
+	cs := v.constraintsFor(snapRef)
+	if cs == nil {
+		return nil, snap.Revision{}, nil
+	}
+	switch cs.presence {
+	case asserts.PresenceInvalid:
+		return nil, snap.Revision{}, fmt.Errorf("unexpected invalid presence of snap %q", cs.name)
+	case presConflict:
+		return nil, snap.Revision{}, cs.conflict()
+	case asserts.PresenceRequired:
+		return cs.allSetKeys(asserts.PresenceRequired), cs.requiredRevision(), nil
+	}
+	return nil, cs.requiredRevision(), nil
+}
+
+// CheckPresenceInvalid returns the keys of all the validation sets that
+// declare the given snap as invalid.
+func (v *ValidationSets) CheckPresenceInvalid(snapRef naming.SnapRef) ([]string, error) {
+	cs := v.constraintsFor(snapRef)
+	if cs == nil {
+		return nil, nil
+	}
+	switch cs.presence {
+	case presConflict:
+		return nil, cs.conflict()
+	case asserts.PresenceInvalid:
+		if rcs, ok := cs.revisions[invalidPresRevision]; ok {
+			return setKeys(rcs, asserts.PresenceInvalid), nil
+		}
+		return cs.allSetKeys(""), nil
+	}
+	return nil, nil
+}
@@ -27,6 +27,8 @@ import (
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/assertstest"
 	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
 )
 
 type validationSetsSuite struct{}
@@ -263,3 +265,195 @@ func (s *validationSetsSuite) TestIntersections(c *C) {
 		}
 	}
 }
+
+func (s *validationSetsSuite) TestCheckInstalledSnaps(c *C) {
+	valset1 := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "acme",
+		"series":       "16",
+		"account-id":   "acme",
+		"name":         "one",
+		"sequence":     "1",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "snap-a",
+				"id":       "mysnapaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				"presence": "required",
+				"revision": "3",
+			},
+			map[string]interface{}{
+				"name":     "snap-b",
+				"id":       "mysnapbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				"presence": "invalid",
+			},
+			map[string]interface{}{
+				"name":     "snap-c",
+				"id":       "mysnapcccccccccccccccccccccccccc",
+				"presence": "optional",
+				"revision": "5",
+			},
+		},
+	}).(*asserts.ValidationSet)
+
+	valset2 := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "acme",
+		"series":       "16",
+		"account-id":   "acme",
+		"name":         "two",
+		"sequence":     "2",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "snap-d",
+				"id":       "mysnapdddddddddddddddddddddddddd",
+				"presence": "required",
+			},
+		},
+	}).(*asserts.ValidationSet)
+
+	valsets := snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(valset1), IsNil)
+	c.Assert(valsets.Add(valset2), IsNil)
+	c.Assert(valsets.Conflict(), IsNil)
+
+	snapA := snapasserts.NewInstalledSnap("snap-a", "mysnapaaaaaaaaaaaaaaaaaaaaaaaaaa", snap.R(3))
+	snapAat1 := snapasserts.NewInstalledSnap("snap-a", "mysnapaaaaaaaaaaaaaaaaaaaaaaaaaa", snap.R(1))
+	snapB := snapasserts.NewInstalledSnap("snap-b", "mysnapbbbbbbbbbbbbbbbbbbbbbbbbbb", snap.R(1))
+	snapC := snapasserts.NewInstalledSnap("snap-c", "mysnapcccccccccccccccccccccccccc", snap.R(5))
+	snapCat1 := snapasserts.NewInstalledSnap("snap-c", "mysnapcccccccccccccccccccccccccc", snap.R(1))
+	// installed locally, without a snap-id
+	snapD := snapasserts.NewInstalledSnap("snap-d", "", snap.R(-1))
+
+	tests := []struct {
+		snaps         []*snapasserts.InstalledSnap
+		missing       map[string][]string
+		invalid       map[string][]string
+		wrongRevision map[string]map[snap.Revision][]string
+		sets          []string
+	}{
+		{
+			snaps: []*snapasserts.InstalledSnap{snapA, snapD},
+		}, {
+			snaps: []*snapasserts.InstalledSnap{snapA, snapC, snapD},
+		}, {
+			snaps:   []*snapasserts.InstalledSnap{snapA},
+			missing: map[string][]string{"snap-d": {"acme/two"}},
+			sets:    []string{"acme/two"},
+		}, {
+			snaps:   []*snapasserts.InstalledSnap{snapA, snapB, snapD},
+			invalid: map[string][]string{"snap-b": {"acme/one"}},
+			sets:    []string{"acme/one"},
+		}, {
+			snaps: []*snapasserts.InstalledSnap{snapAat1, snapCat1},
+			wrongRevision: map[string]map[snap.Revision][]string{
+				"snap-a": {snap.R(3): {"acme/one"}},
+				"snap-c": {snap.R(5): {"acme/one"}},
+			},
+			missing: map[string][]string{"snap-d": {"acme/two"}},
+			sets:    []string{"acme/one", "acme/two"},
+		},
+	}
+
+	for i, t := range tests {
+		err := valsets.CheckInstalledSnaps(t.snaps)
+		if t.missing == nil && t.invalid == nil && t.wrongRevision == nil {
+			c.Check(err, IsNil, Commentf("#%d", i))
+			continue
+		}
+		verr, ok := err.(*snapasserts.ValidationSetsValidationError)
+		c.Assert(ok, Equals, true, Commentf("#%d", i))
+		c.Check(verr.MissingSnaps, DeepEquals, t.missing, Commentf("#%d", i))
+		c.Check(verr.InvalidSnaps, DeepEquals, t.invalid, Commentf("#%d", i))
+		c.Check(verr.WrongRevisionSnaps, DeepEquals, t.wrongRevision, Commentf("#%d", i))
+		c.Check(verr.Sets, HasLen, len(t.sets), Commentf("#%d", i))
+		for _, key := range t.sets {
+			c.Check(verr.Sets[key], NotNil, Commentf("#%d", i))
+		}
+	}
+}
+
+func (s *validationSetsSuite) TestValidationSetsValidationErrorString(c *C) {
+	err := &snapasserts.ValidationSetsValidationError{
+		MissingSnaps: map[string][]string{"snap-d": {"acme/two"}},
+		InvalidSnaps: map[string][]string{"snap-b": {"acme/one", "acme/two"}},
+		WrongRevisionSnaps: map[string]map[snap.Revision][]string{
+			"snap-a": {snap.R(3): {"acme/one"}},
+		},
+	}
+	c.Check(err.Error(), Equals, `validation sets assertions are not met:
+- missing required snaps:
+  - snap-d (required by sets acme/two)
+- invalid snaps:
+  - snap-b (invalid for sets acme/one,acme/two)
+- snaps at wrong revisions:
+  - snap-a (required at revision 3 by sets acme/one)`)
+}
+
+func (s *validationSetsSuite) TestCheckPresence(c *C) {
+	valset1 := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "acme",
+		"series":       "16",
+		"account-id":   "acme",
+		"name":         "one",
+		"sequence":     "1",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "snap-a",
+				"id":       "mysnapaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				"presence": "required",
+				"revision": "3",
+			},
+			map[string]interface{}{
+				"name":     "snap-b",
+				"id":       "mysnapbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				"presence": "invalid",
+			},
+		},
+	}).(*asserts.ValidationSet)
+	valset2 := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "acme",
+		"series":       "16",
+		"account-id":   "acme",
+		"name":         "two",
+		"sequence":     "1",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "snap-a",
+				"id":       "mysnapaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				"presence": "required",
+			},
+		},
+	}).(*asserts.ValidationSet)
+
+	valsets := snapasserts.NewValidationSets()
+	c.Assert(valsets.Add(valset1), IsNil)
+	c.Assert(valsets.Add(valset2), IsNil)
+
+	keys, rev, err := valsets.CheckPresenceRequired(naming.Snap("snap-a"))
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []string{"acme/one", "acme/two"})
+	c.Check(rev, Equals, snap.R(3))
+
+	keys, rev, err = valsets.CheckPresenceRequired(naming.NewSnapRef("snap-a", "mysnapaaaaaaaaaaaaaaaaaaaaaaaaaa"))
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []string{"acme/one", "acme/two"})
+	c.Check(rev, Equals, snap.R(3))
+
+	keys, rev, err = valsets.CheckPresenceRequired(naming.Snap("other-snap"))
+	c.Assert(err, IsNil)
+	c.Check(keys, HasLen, 0)
+	c.Check(rev.Unset(), Equals, true)
+
+	_, _, err = valsets.CheckPresenceRequired(naming.Snap("snap-b"))
+	c.Check(err, ErrorMatches, `unexpected invalid presence of snap "snap-b"`)
+
+	keys, err = valsets.CheckPresenceInvalid(naming.Snap("snap-b"))
+	c.Assert(err, IsNil)
+	c.Check(keys, DeepEquals, []string{"acme/one"})
+
+	keys, err = valsets.CheckPresenceInvalid(naming.Snap("snap-a"))
+	c.Assert(err, IsNil)
+	c.Check(keys, HasLen, 0)
+}
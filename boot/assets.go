@@ -265,6 +265,7 @@ type TrustedAssetsInstallObserver struct {
 
 	dataEncryptionKey secboot.EncryptionKey
 	saveEncryptionKey secboot.EncryptionKey
+	pin               string
 }
 
 // Observe observes the operation related to the content of a given gadget
@@ -344,6 +345,12 @@ func (o *TrustedAssetsInstallObserver) ChosenEncryptionKeys(key, saveKey secboot
 	o.saveEncryptionKey = saveKey
 }
 
+// ChosenPIN sets the PIN required in addition to the TPM policy to unseal
+// the encryption keys.
+func (o *TrustedAssetsInstallObserver) ChosenPIN(pin string) {
+	o.pin = pin
+}
+
 // TrustedAssetsUpdateObserverForModel returns a new trusted assets observer for
 // tracking changes to the trusted boot assets and preserving managed assets,
 // provided the device model indicates this might be needed. Otherwise, nil and
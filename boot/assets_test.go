@@ -479,6 +479,9 @@ func (s *assetsSuite) TestInstallObserverNonTrustedBootloader(c *C) {
 	obs.ChosenEncryptionKeys(secboot.EncryptionKey{1, 2, 3, 4}, secboot.EncryptionKey{5, 6, 7, 8})
 	c.Check(obs.CurrentDataEncryptionKey(), DeepEquals, secboot.EncryptionKey{1, 2, 3, 4})
 	c.Check(obs.CurrentSaveEncryptionKey(), DeepEquals, secboot.EncryptionKey{5, 6, 7, 8})
+	c.Check(obs.CurrentPIN(), Equals, "")
+	obs.ChosenPIN("1234")
+	c.Check(obs.CurrentPIN(), Equals, "1234")
 }
 
 func (s *assetsSuite) TestInstallObserverTrustedButNoAssets(c *C) {
@@ -22,9 +22,12 @@ package boot
 import (
 	"errors"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/strutil"
@@ -39,10 +42,14 @@ const (
 	// ModeRecover is a mode in which the device boots into the recovery
 	// system.
 	ModeRecover = "recover"
+	// ModeFactoryReset is a mode in which the device performs a factory
+	// reset, recreating ubuntu-data from the recovery system while
+	// keeping ubuntu-save.
+	ModeFactoryReset = "factory-reset"
 )
 
 var (
-	validModes = []string{ModeInstall, ModeRecover, ModeRun}
+	validModes = []string{ModeInstall, ModeRecover, ModeFactoryReset, ModeRun}
 )
 
 // ModeAndRecoverySystemFromKernelCommandLine returns the current system mode
@@ -74,6 +81,8 @@ func ModeAndRecoverySystemFromKernelCommandLine() (mode, sysLabel string, err er
 		return "", "", fmt.Errorf("cannot specify system label without a mode")
 	case mode == ModeInstall && sysLabel == "":
 		return "", "", fmt.Errorf("cannot specify install mode without system label")
+	case mode == ModeFactoryReset && sysLabel == "":
+		return "", "", fmt.Errorf("cannot specify factory-reset mode without system label")
 	case mode == ModeRun && sysLabel != "":
 		// XXX: should we silently ignore the label? at least log for now
 		logger.Noticef(`ignoring recovery system label %q in "run" mode`, sysLabel)
@@ -102,12 +111,16 @@ const (
 	candidateEdition
 )
 
-func composeCommandLine(model *asserts.Model, currentOrCandidate int, mode, system string) (string, error) {
-	if model.Grade() == asserts.ModelGradeUnset {
-		return "", nil
-	}
+// extraCmdlineArgsVar is the run mode bootloader environment variable
+// carrying the arguments appended to the kernel command line.
+const extraCmdlineArgsVar = "snapd_extra_cmdline_args"
+
+// commandLineBootloader returns the bootloader managing the boot config used
+// when booting in the given mode, along with the mode and system arguments of
+// the command line. The bootloader is nil if the boot config is not managed.
+func commandLineBootloader(mode, system string) (mbl bootloader.TrustedAssetsBootloader, modeArg, systemArg string, err error) {
 	if mode != ModeRun && mode != ModeRecover {
-		return "", fmt.Errorf("internal error: unsupported command line mode %q", mode)
+		return nil, "", "", fmt.Errorf("internal error: unsupported command line mode %q", mode)
 	}
 	// get the run mode bootloader under the native run partition layout
 	opts := &bootloader.Options{
@@ -115,11 +128,10 @@ func composeCommandLine(model *asserts.Model, currentOrCandidate int, mode, syst
 		NoSlashBoot: true,
 	}
 	bootloaderRootDir := InitramfsUbuntuBootDir
-	modeArg := "snapd_recovery_mode=run"
-	systemArg := ""
+	modeArg = "snapd_recovery_mode=run"
 	if mode == ModeRecover {
 		if system == "" {
-			return "", fmt.Errorf("internal error: system is unset")
+			return nil, "", "", fmt.Errorf("internal error: system is unset")
 		}
 		// dealing with recovery system bootloader
 		opts.Role = bootloader.RoleRecovery
@@ -128,15 +140,35 @@ func composeCommandLine(model *asserts.Model, currentOrCandidate int, mode, syst
 		modeArg = "snapd_recovery_mode=recover"
 		systemArg = fmt.Sprintf("snapd_recovery_system=%v", system)
 	}
-	mbl, err := getBootloaderManagingItsAssets(bootloaderRootDir, opts)
+	mbl, err = getBootloaderManagingItsAssets(bootloaderRootDir, opts)
 	if err != nil {
 		if err == errBootConfigNotManaged {
+			return nil, "", "", nil
+		}
+		return nil, "", "", err
+	}
+	return mbl, modeArg, systemArg, nil
+}
+
+// extraCommandLineArgs returns the extra arguments currently appended to the
+// kernel command line of the given mode. Only the run mode command line can
+// carry extra arguments.
+func extraCommandLineArgs(mbl bootloader.Bootloader, mode string) (string, error) {
+	if mode != ModeRun {
+		return "", nil
+	}
+	vars, err := mbl.GetBootVars(extraCmdlineArgsVar)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// no bootloader environment yet
 			return "", nil
 		}
 		return "", err
 	}
-	// TODO:UC20: fetch extra args from gadget
-	extraArgs := ""
+	return vars[extraCmdlineArgsVar], nil
+}
+
+func commandLineForEdition(mbl bootloader.TrustedAssetsBootloader, currentOrCandidate int, modeArg, systemArg, extraArgs string) (string, error) {
 	if currentOrCandidate == currentEdition {
 		return mbl.CommandLine(modeArg, systemArg, extraArgs)
 	} else {
@@ -144,6 +176,21 @@ func composeCommandLine(model *asserts.Model, currentOrCandidate int, mode, syst
 	}
 }
 
+func composeCommandLine(model *asserts.Model, currentOrCandidate int, mode, system string) (string, error) {
+	if model.Grade() == asserts.ModelGradeUnset {
+		return "", nil
+	}
+	mbl, modeArg, systemArg, err := commandLineBootloader(mode, system)
+	if err != nil || mbl == nil {
+		return "", err
+	}
+	extraArgs, err := extraCommandLineArgs(mbl, mode)
+	if err != nil {
+		return "", err
+	}
+	return commandLineForEdition(mbl, currentOrCandidate, modeArg, systemArg, extraArgs)
+}
+
 // ComposeRecoveryCommandLine composes the kernel command line used when booting
 // a given system in recover mode.
 func ComposeRecoveryCommandLine(model *asserts.Model, system string) (string, error) {
@@ -170,6 +217,81 @@ func ComposeCandidateRecoveryCommandLine(model *asserts.Model, system string) (s
 	return composeCommandLine(model, candidateEdition, ModeRecover, system)
 }
 
+// ValidateExtraKernelCommandLine checks that the given arguments can be
+// appended to the kernel command line.
+func ValidateExtraKernelCommandLine(extraArgs string) error {
+	args, err := osutil.KernelCommandLineSplit(extraArgs)
+	if err != nil {
+		return fmt.Errorf("cannot parse kernel command line arguments: %v", err)
+	}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "snapd_") {
+			return fmt.Errorf("cannot append snapd specific kernel command line argument %q", arg)
+		}
+	}
+	return nil
+}
+
+// SetExtraKernelCommandLine sets the arguments appended to the run mode kernel
+// command line of a device with managed boot config. The new command line is
+// tracked in the modeenv next to the current one, and the keys are resealed
+// for both, so that the system can boot with either until the next successful
+// boot. Returns whether a reboot is needed for the change to take effect.
+func SetExtraKernelCommandLine(dev Device, extraArgs string) (needsReboot bool, err error) {
+	if !dev.HasModeenv() {
+		return false, fmt.Errorf("cannot set kernel command line arguments on a system without modeenv")
+	}
+	if err := ValidateExtraKernelCommandLine(extraArgs); err != nil {
+		return false, err
+	}
+	if dev.Model().Grade() == asserts.ModelGradeUnset {
+		return false, fmt.Errorf("internal error: model grade is unset")
+	}
+
+	mbl, modeArg, systemArg, err := commandLineBootloader(ModeRun, "")
+	if err != nil {
+		return false, err
+	}
+	if mbl == nil {
+		return false, fmt.Errorf("cannot set kernel command line arguments: boot config is not managed by snapd")
+	}
+	currentExtraArgs, err := extraCommandLineArgs(mbl, ModeRun)
+	if err != nil {
+		return false, err
+	}
+	if currentExtraArgs == extraArgs {
+		return false, nil
+	}
+
+	m, err := loadModeenv()
+	if err != nil {
+		return false, err
+	}
+	if len(m.CurrentKernelCommandLines) > 1 {
+		return false, fmt.Errorf("cannot set kernel command line arguments while a kernel command line update is pending")
+	}
+	current, err := commandLineForEdition(mbl, currentEdition, modeArg, systemArg, currentExtraArgs)
+	if err != nil {
+		return false, err
+	}
+	candidate, err := commandLineForEdition(mbl, currentEdition, modeArg, systemArg, extraArgs)
+	if err != nil {
+		return false, err
+	}
+	m.CurrentKernelCommandLines = bootCommandLines{current, candidate}
+	if err := m.Write(); err != nil {
+		return false, err
+	}
+	// the new command line is part of the boot chains now
+	if err := resealKeyToModeenv(dirs.GlobalRootDir, dev.Model(), m, true); err != nil {
+		return false, err
+	}
+	if err := mbl.SetBootVars(map[string]string{extraCmdlineArgsVar: extraArgs}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // observeSuccessfulCommandLine observes a successful boot with a command line
 // and takes an action based on the contents of the modeenv. The current kernel
 // command lines in the modeenv can have up to 2 entries when the managed
@@ -26,10 +26,12 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/boot/boottest"
 	"github.com/snapcore/snapd/bootloader"
 	"github.com/snapcore/snapd/bootloader/bootloadertest"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/testutil"
 )
@@ -85,6 +87,13 @@ func (s *kernelCommandLineSuite) TestModeAndLabel(c *C) {
 		// no recovery system label
 		cmd: "snapd_recovery_mode=install foo=bar",
 		err: `cannot specify install mode without system label`,
+	}, {
+		cmd:   "snapd_recovery_mode=factory-reset snapd_recovery_system=1234",
+		mode:  boot.ModeFactoryReset,
+		label: "1234",
+	}, {
+		cmd: "snapd_recovery_mode=factory-reset",
+		err: `cannot specify factory-reset mode without system label`,
 	}, {
 		cmd: "snapd_recovery_system=1234",
 		err: `cannot specify system label without a mode`,
@@ -213,3 +222,125 @@ func (s *kernelCommandLineSuite) TestComposeCandidateRecoveryCommandLineManagedH
 	c.Assert(err, ErrorMatches, "internal error: system is unset")
 	c.Check(cmdline, Equals, "")
 }
+
+func (s *kernelCommandLineSuite) TestComposeCommandLineWithExtraArgs(c *C) {
+	model := boottest.MakeMockUC20Model()
+
+	tbl := bootloadertest.Mock("btloader", c.MkDir()).WithTrustedAssets()
+	bootloader.Force(tbl)
+	defer bootloader.Force(nil)
+
+	tbl.StaticCommandLine = "panic=-1"
+	tbl.BootVars = map[string]string{"snapd_extra_cmdline_args": "quiet foo=bar"}
+
+	cmdline, err := boot.ComposeCommandLine(model)
+	c.Assert(err, IsNil)
+	c.Check(cmdline, Equals, "snapd_recovery_mode=run panic=-1 quiet foo=bar")
+
+	// extra arguments are only applied to the run mode command line
+	cmdline, err = boot.ComposeRecoveryCommandLine(model, "20200314")
+	c.Assert(err, IsNil)
+	c.Check(cmdline, Equals, "snapd_recovery_mode=recover snapd_recovery_system=20200314 panic=-1")
+}
+
+func (s *kernelCommandLineSuite) TestValidateExtraKernelCommandLine(c *C) {
+	for _, tc := range []struct {
+		args string
+		err  string
+	}{
+		{"", ""},
+		{"quiet", ""},
+		{`foo=bar baz="a b"`, ""},
+		{`foo="bar`, "cannot parse kernel command line arguments: .*"},
+		{"snapd_recovery_mode=recover", `cannot append snapd specific kernel command line argument "snapd_recovery_mode=recover"`},
+	} {
+		err := boot.ValidateExtraKernelCommandLine(tc.args)
+		if tc.err == "" {
+			c.Check(err, IsNil, Commentf("%q", tc.args))
+		} else {
+			c.Check(err, ErrorMatches, tc.err, Commentf("%q", tc.args))
+		}
+	}
+}
+
+func (s *kernelCommandLineSuite) TestSetExtraKernelCommandLineHappy(c *C) {
+	dirs.SetRootDir(s.rootDir)
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	tbl := bootloadertest.Mock("btloader", c.MkDir()).WithTrustedAssets()
+	bootloader.Force(tbl)
+	defer bootloader.Force(nil)
+	tbl.StaticCommandLine = "panic=-1"
+
+	m := &boot.Modeenv{
+		Mode:                      "run",
+		CurrentKernelCommandLines: []string{"snapd_recovery_mode=run panic=-1"},
+	}
+	c.Assert(m.WriteTo(""), IsNil)
+
+	// pretend the keys are sealed using the fde-setup hook
+	stamp := filepath.Join(dirs.SnapFDEDir, "sealed-keys")
+	c.Assert(os.MkdirAll(filepath.Dir(stamp), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(stamp, []byte("fde-setup-hook"), 0644), IsNil)
+	var resealed [][]string
+	s.AddCleanup(boot.MockResealKeyToModeenvUsingFDESetupHook(func(rootdir string, model *asserts.Model, m *boot.Modeenv, expectReseal bool) error {
+		c.Check(expectReseal, Equals, true)
+		resealed = append(resealed, m.CurrentKernelCommandLines)
+		return nil
+	}))
+
+	dev := boottest.MockUC20Device("", nil)
+	needsReboot, err := boot.SetExtraKernelCommandLine(dev, "quiet foo=bar")
+	c.Assert(err, IsNil)
+	c.Check(needsReboot, Equals, true)
+
+	c.Check(tbl.BootVars, DeepEquals, map[string]string{
+		"snapd_extra_cmdline_args": "quiet foo=bar",
+	})
+	expectedCmdlines := []string{
+		"snapd_recovery_mode=run panic=-1",
+		"snapd_recovery_mode=run panic=-1 quiet foo=bar",
+	}
+	c.Check(resealed, DeepEquals, [][]string{expectedCmdlines})
+	m, err = boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check([]string(m.CurrentKernelCommandLines), DeepEquals, expectedCmdlines)
+
+	// setting the same arguments again is a no-op
+	needsReboot, err = boot.SetExtraKernelCommandLine(dev, "quiet foo=bar")
+	c.Assert(err, IsNil)
+	c.Check(needsReboot, Equals, false)
+	c.Check(resealed, HasLen, 1)
+}
+
+func (s *kernelCommandLineSuite) TestSetExtraKernelCommandLineErrors(c *C) {
+	dirs.SetRootDir(s.rootDir)
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	bl := bootloadertest.Mock("btloader", c.MkDir())
+	bootloader.Force(bl)
+	defer bootloader.Force(nil)
+
+	m := &boot.Modeenv{
+		Mode: "run",
+		CurrentKernelCommandLines: []string{
+			"snapd_recovery_mode=run panic=-1",
+			"snapd_recovery_mode=run panic=-1 quiet",
+		},
+	}
+	c.Assert(m.WriteTo(""), IsNil)
+
+	_, err := boot.SetExtraKernelCommandLine(boottest.MockDevice("pc-kernel"), "quiet")
+	c.Check(err, ErrorMatches, "cannot set kernel command line arguments on a system without modeenv")
+
+	dev := boottest.MockUC20Device("", nil)
+	_, err = boot.SetExtraKernelCommandLine(dev, "snapd_recovery_mode=install")
+	c.Check(err, ErrorMatches, `cannot append snapd specific kernel command line argument "snapd_recovery_mode=install"`)
+
+	_, err = boot.SetExtraKernelCommandLine(dev, "quiet")
+	c.Check(err, ErrorMatches, "cannot set kernel command line arguments: boot config is not managed by snapd")
+
+	bootloader.Force(bl.WithTrustedAssets())
+	_, err = boot.SetExtraKernelCommandLine(dev, "debug")
+	c.Check(err, ErrorMatches, "cannot set kernel command line arguments while a kernel command line update is pending")
+}
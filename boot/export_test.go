@@ -97,6 +97,10 @@ func (o *TrustedAssetsInstallObserver) CurrentSaveEncryptionKey() secboot.Encryp
 	return o.saveEncryptionKey
 }
 
+func (o *TrustedAssetsInstallObserver) CurrentPIN() string {
+	return o.pin
+}
+
 func MockSecbootSealKeys(f func(keys []secboot.SealKeyRequest, params *secboot.SealKeysParams) error) (restore func()) {
 	old := secbootSealKeys
 	secbootSealKeys = f
@@ -105,6 +109,24 @@ func MockSecbootSealKeys(f func(keys []secboot.SealKeyRequest, params *secboot.S
 	}
 }
 
+type SealKeyToModeenvFlags = sealKeyToModeenvFlags
+
+func MockSecbootPCRHandleOfSealedKey(f func(p string) (uint32, error)) (restore func()) {
+	old := secbootPCRHandleOfSealedKey
+	secbootPCRHandleOfSealedKey = f
+	return func() {
+		secbootPCRHandleOfSealedKey = old
+	}
+}
+
+func MockSecbootReleasePCRResourceHandles(f func(handles ...uint32) error) (restore func()) {
+	old := secbootReleasePCRResourceHandles
+	secbootReleasePCRResourceHandles = f
+	return func() {
+		secbootReleasePCRResourceHandles = old
+	}
+}
+
 func MockSecbootResealKeys(f func(params *secboot.ResealKeysParams) error) (restore func()) {
 	old := secbootResealKeys
 	secbootResealKeys = f
@@ -60,11 +60,25 @@ func MakeBootable(model *asserts.Model, rootdir string, bootWith *BootableSet, s
 	}
 
 	if !bootWith.Recovery {
-		return makeBootable20RunMode(model, rootdir, bootWith, sealer)
+		return makeBootable20RunMode(model, rootdir, bootWith, sealer, sealKeyToModeenvFlags{})
 	}
 	return makeBootable20(model, rootdir, bootWith)
 }
 
+// MakeBootableAfterDataReset sets up the given bootable set and the
+// recreated ubuntu-boot and ubuntu-data partitions such that the run
+// system can be booted after a factory reset. The keys are sealed
+// without provisioning the TPM again.
+func MakeBootableAfterDataReset(model *asserts.Model, rootdir string, bootWith *BootableSet, sealer *TrustedAssetsInstallObserver) error {
+	if model.Grade() == asserts.ModelGradeUnset {
+		return fmt.Errorf("internal error: cannot perform factory reset of a pre-UC20 system")
+	}
+	if bootWith.Recovery {
+		return fmt.Errorf("internal error: cannot perform factory reset of the recovery partition")
+	}
+	return makeBootable20RunMode(model, rootdir, bootWith, sealer, sealKeyToModeenvFlags{FactoryReset: true})
+}
+
 // makeBootable16 setups the image filesystem for boot with UC16
 // and UC18 models. This entails:
 //  - installing the bootloader configuration from the gadget
@@ -227,7 +241,7 @@ func makeBootable20(model *asserts.Model, rootdir string, bootWith *BootableSet)
 	return nil
 }
 
-func makeBootable20RunMode(model *asserts.Model, rootdir string, bootWith *BootableSet, sealer *TrustedAssetsInstallObserver) error {
+func makeBootable20RunMode(model *asserts.Model, rootdir string, bootWith *BootableSet, sealer *TrustedAssetsInstallObserver, sealFlags sealKeyToModeenvFlags) error {
 	// TODO:UC20:
 	// - figure out what to do for uboot gadgets, currently we require them to
 	//   install the boot.sel onto ubuntu-boot directly, but the file should be
@@ -372,7 +386,7 @@ func makeBootable20RunMode(model *asserts.Model, rootdir string, bootWith *Boota
 
 	if sealer != nil {
 		// seal the encryption key to the parameters specified in modeenv
-		if err := sealKeyToModeenv(sealer.dataEncryptionKey, sealer.saveEncryptionKey, model, modeenv); err != nil {
+		if err := sealKeyToModeenv(sealer.dataEncryptionKey, sealer.saveEncryptionKey, sealer.pin, model, modeenv, sealFlags); err != nil {
 			return err
 		}
 	}
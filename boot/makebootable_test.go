@@ -283,6 +283,14 @@ func (s *makeBootable20Suite) TestMakeBootable20MultipleRecoverySystemsError(c *
 	c.Assert(err, ErrorMatches, "cannot make multiple recovery systems bootable yet")
 }
 
+func (s *makeBootable20Suite) TestMakeBootableAfterDataResetErrors(c *C) {
+	err := boot.MakeBootableAfterDataReset(boottest.MakeMockModel(), s.rootdir, &boot.BootableSet{}, nil)
+	c.Assert(err, ErrorMatches, "internal error: cannot perform factory reset of a pre-UC20 system")
+
+	err = boot.MakeBootableAfterDataReset(boottest.MakeMockUC20Model(), s.rootdir, &boot.BootableSet{Recovery: true}, nil)
+	c.Assert(err, ErrorMatches, "internal error: cannot perform factory reset of the recovery partition")
+}
+
 func (s *makeBootable20Suite) TestMakeBootable20RunMode(c *C) {
 	bootloader.Force(nil)
 
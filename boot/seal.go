@@ -43,8 +43,10 @@ import (
 )
 
 var (
-	secbootSealKeys   = secboot.SealKeys
-	secbootResealKeys = secboot.ResealKeys
+	secbootSealKeys                  = secboot.SealKeys
+	secbootResealKeys                = secboot.ResealKeys
+	secbootPCRHandleOfSealedKey      = secboot.PCRHandleOfSealedKey
+	secbootReleasePCRResourceHandles = secboot.ReleasePCRResourceHandles
 
 	seedReadSystemEssential = seed.ReadSystemEssential
 )
@@ -88,10 +90,19 @@ func recoveryBootChainsFileUnder(rootdir string) string {
 	return filepath.Join(dirs.SnapFDEDirUnder(rootdir), "recovery-boot-chains")
 }
 
+// sealKeyToModeenvFlags carries the flags for sealKeyToModeenv.
+type sealKeyToModeenvFlags struct {
+	// FactoryReset indicates that the sealing happens during factory
+	// reset, the TPM has already been provisioned and the keys sealed
+	// by the previous installation are still in place.
+	FactoryReset bool
+}
+
 // sealKeyToModeenv seals the supplied keys to the parameters specified
-// in modeenv.
-// It assumes to be invoked in install mode.
-func sealKeyToModeenv(key, saveKey secboot.EncryptionKey, model *asserts.Model, modeenv *Modeenv) error {
+// in modeenv. If pin is not empty, it is required in addition to the
+// TPM policy to unseal the keys.
+// It assumes to be invoked in install or factory-reset mode.
+func sealKeyToModeenv(key, saveKey secboot.EncryptionKey, pin string, model *asserts.Model, modeenv *Modeenv, flags sealKeyToModeenvFlags) error {
 	// make sure relevant locations exist
 	for _, p := range []string{
 		InitramfsSeedEncryptionKeyDir,
@@ -110,10 +121,13 @@ func sealKeyToModeenv(key, saveKey secboot.EncryptionKey, model *asserts.Model,
 		return fmt.Errorf("cannot check for fde-setup hook %v", err)
 	}
 	if hasHook {
+		if pin != "" {
+			return fmt.Errorf("cannot seal keys with a PIN using the fde-setup hook")
+		}
 		return sealKeyToModeenvUsingFDESetupHook(key, saveKey, model, modeenv)
 	}
 
-	return sealKeyToModeenvUsingSecboot(key, saveKey, model, modeenv)
+	return sealKeyToModeenvUsingSecboot(key, saveKey, pin, model, modeenv, flags)
 }
 
 func runKeySealRequests(key secboot.EncryptionKey) []secboot.SealKeyRequest {
@@ -164,7 +178,7 @@ func sealKeyToModeenvUsingFDESetupHook(key, saveKey secboot.EncryptionKey, model
 	return nil
 }
 
-func sealKeyToModeenvUsingSecboot(key, saveKey secboot.EncryptionKey, model *asserts.Model, modeenv *Modeenv) error {
+func sealKeyToModeenvUsingSecboot(key, saveKey secboot.EncryptionKey, pin string, model *asserts.Model, modeenv *Modeenv, flags sealKeyToModeenvFlags) error {
 	// build the recovery mode boot chain
 	rbl, err := bootloader.Find(InitramfsUbuntuSeedDir, &bootloader.Options{
 		Role: bootloader.RoleRecovery,
@@ -213,14 +227,36 @@ func sealKeyToModeenvUsingSecboot(key, saveKey secboot.EncryptionKey, model *ass
 		return fmt.Errorf("cannot generate key for signing dynamic authorization policies: %v", err)
 	}
 
-	if err := sealRunObjectKeys(key, pbc, authKey, roleToBlName); err != nil {
+	runHandle := uint32(secboot.RunObjectPCRPolicyCounterHandle)
+	fallbackHandle := uint32(secboot.FallbackObjectPCRPolicyCounterHandle)
+	var oldHandles []uint32
+	if flags.FactoryReset {
+		// the keys sealed by the previous installation keep their
+		// handles until the new keys are sealed, so that the factory
+		// reset can be attempted again should it fail midway
+		runHandle, fallbackHandle, oldHandles, err = factoryResetPCRHandles()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := sealRunObjectKeys(key, pbc, authKey, pin, roleToBlName, runHandle, !flags.FactoryReset); err != nil {
 		return err
 	}
 
-	if err := sealFallbackObjectKeys(key, saveKey, rpbc, authKey, roleToBlName); err != nil {
+	if err := sealFallbackObjectKeys(key, saveKey, rpbc, authKey, pin, roleToBlName, fallbackHandle); err != nil {
 		return err
 	}
 
+	if len(oldHandles) > 0 {
+		// the previous keys are gone now, failing to release their
+		// handles is not fatal as they are released again before
+		// being reused
+		if err := secbootReleasePCRResourceHandles(oldHandles...); err != nil {
+			logger.Noticef("cannot release the PCR policy counters of the previous installation: %v", err)
+		}
+	}
+
 	if err := stampSealedKeys(InstallHostWritableDir, sealingMethodTPM); err != nil {
 		return err
 	}
@@ -238,7 +274,34 @@ func sealKeyToModeenvUsingSecboot(key, saveKey secboot.EncryptionKey, model *ass
 	return nil
 }
 
-func sealRunObjectKeys(key secboot.EncryptionKey, pbc predictableBootChains, authKey *ecdsa.PrivateKey, roleToBlName map[bootloader.Role]string) error {
+// factoryResetPCRHandles returns the PCR policy counter handles to use for
+// the run and fallback objects sealed during factory reset, which are the
+// ones not used by the keys of the previous installation, along with the
+// handles that are in use by those keys.
+func factoryResetPCRHandles() (runHandle, fallbackHandle uint32, oldHandles []uint32, err error) {
+	saveFallbackKey := filepath.Join(InitramfsSeedEncryptionKeyDir, "ubuntu-save.recovery.sealed-key")
+	oldFallbackHandle, err := secbootPCRHandleOfSealedKey(saveFallbackKey)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("cannot determine the PCR policy counter of the existing fallback key: %v", err)
+	}
+	if oldFallbackHandle == secboot.AltFallbackObjectPCRPolicyCounterHandle {
+		runHandle = secboot.RunObjectPCRPolicyCounterHandle
+		fallbackHandle = secboot.FallbackObjectPCRPolicyCounterHandle
+		oldHandles = []uint32{secboot.AltRunObjectPCRPolicyCounterHandle, secboot.AltFallbackObjectPCRPolicyCounterHandle}
+	} else {
+		runHandle = secboot.AltRunObjectPCRPolicyCounterHandle
+		fallbackHandle = secboot.AltFallbackObjectPCRPolicyCounterHandle
+		oldHandles = []uint32{secboot.RunObjectPCRPolicyCounterHandle, secboot.FallbackObjectPCRPolicyCounterHandle}
+	}
+	// leftovers of an earlier factory reset attempt may still hold the
+	// handles that are about to be used
+	if err := secbootReleasePCRResourceHandles(runHandle, fallbackHandle); err != nil {
+		return 0, 0, nil, err
+	}
+	return runHandle, fallbackHandle, oldHandles, nil
+}
+
+func sealRunObjectKeys(key secboot.EncryptionKey, pbc predictableBootChains, authKey *ecdsa.PrivateKey, pin string, roleToBlName map[bootloader.Role]string, pcrHandle uint32, provision bool) error {
 	modelParams, err := sealKeyModelParams(pbc, roleToBlName)
 	if err != nil {
 		return fmt.Errorf("cannot prepare for key sealing: %v", err)
@@ -249,8 +312,14 @@ func sealRunObjectKeys(key secboot.EncryptionKey, pbc predictableBootChains, aut
 		TPMPolicyAuthKey:       authKey,
 		TPMPolicyAuthKeyFile:   filepath.Join(InstallHostFDESaveDir, "tpm-policy-auth-key"),
 		TPMLockoutAuthFile:     filepath.Join(InstallHostFDESaveDir, "tpm-lockout-auth"),
-		TPMProvision:           true,
-		PCRPolicyCounterHandle: secboot.RunObjectPCRPolicyCounterHandle,
+		TPMProvision:           provision,
+		PCRPolicyCounterHandle: pcrHandle,
+		PIN:                    pin,
+	}
+	if !provision {
+		// the TPM has been provisioned and the lockout authorization
+		// file written by the previous installation
+		sealKeyParams.TPMLockoutAuthFile = ""
 	}
 	// The run object contains only the ubuntu-data key; the ubuntu-save key
 	// is then stored inside the encrypted data partition, so that the normal run
@@ -264,7 +333,7 @@ func sealRunObjectKeys(key secboot.EncryptionKey, pbc predictableBootChains, aut
 	return nil
 }
 
-func sealFallbackObjectKeys(key, saveKey secboot.EncryptionKey, pbc predictableBootChains, authKey *ecdsa.PrivateKey, roleToBlName map[bootloader.Role]string) error {
+func sealFallbackObjectKeys(key, saveKey secboot.EncryptionKey, pbc predictableBootChains, authKey *ecdsa.PrivateKey, pin string, roleToBlName map[bootloader.Role]string, pcrHandle uint32) error {
 	// also seal the keys to the recovery bootchains as a fallback
 	modelParams, err := sealKeyModelParams(pbc, roleToBlName)
 	if err != nil {
@@ -273,7 +342,8 @@ func sealFallbackObjectKeys(key, saveKey secboot.EncryptionKey, pbc predictableB
 	sealKeyParams := &secboot.SealKeysParams{
 		ModelParams:            modelParams,
 		TPMPolicyAuthKey:       authKey,
-		PCRPolicyCounterHandle: secboot.FallbackObjectPCRPolicyCounterHandle,
+		PCRPolicyCounterHandle: pcrHandle,
+		PIN:                    pin,
 	}
 	// The fallback object contains the ubuntu-data and ubuntu-save keys. The
 	// key files are stored on ubuntu-seed, separate from ubuntu-data so they
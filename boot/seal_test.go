@@ -58,11 +58,65 @@ func (s *sealSuite) SetUpTest(c *C) {
 
 func (s *sealSuite) TestSealKeyToModeenv(c *C) {
 	for _, tc := range []struct {
-		sealErr error
-		err     string
+		sealErr        error
+		pin            string
+		factoryReset   bool
+		pcrHandleOfKey uint32
+		pcrHandleErr   error
+		releaseErr     error
+		expRunHandle   uint32
+		expFbHandle    uint32
+		expReleased    [][]uint32
+		err            string
 	}{
-		{sealErr: nil, err: ""},
-		{sealErr: errors.New("seal error"), err: "cannot seal the encryption keys: seal error"},
+		{
+			sealErr:      nil,
+			expRunHandle: secboot.RunObjectPCRPolicyCounterHandle,
+			expFbHandle:  secboot.FallbackObjectPCRPolicyCounterHandle,
+			err:          "",
+		}, {
+			sealErr:      nil,
+			pin:          "1234",
+			expRunHandle: secboot.RunObjectPCRPolicyCounterHandle,
+			expFbHandle:  secboot.FallbackObjectPCRPolicyCounterHandle,
+			err:          "",
+		}, {
+			sealErr:      errors.New("seal error"),
+			expRunHandle: secboot.RunObjectPCRPolicyCounterHandle,
+			err:          "cannot seal the encryption keys: seal error",
+		}, {
+			// factory reset of a system installed with the main handles
+			factoryReset:   true,
+			pcrHandleOfKey: secboot.FallbackObjectPCRPolicyCounterHandle,
+			expRunHandle:   secboot.AltRunObjectPCRPolicyCounterHandle,
+			expFbHandle:    secboot.AltFallbackObjectPCRPolicyCounterHandle,
+			expReleased: [][]uint32{
+				{secboot.AltRunObjectPCRPolicyCounterHandle, secboot.AltFallbackObjectPCRPolicyCounterHandle},
+				{secboot.RunObjectPCRPolicyCounterHandle, secboot.FallbackObjectPCRPolicyCounterHandle},
+			},
+		}, {
+			// factory reset of a system which was factory reset before
+			factoryReset:   true,
+			pcrHandleOfKey: secboot.AltFallbackObjectPCRPolicyCounterHandle,
+			expRunHandle:   secboot.RunObjectPCRPolicyCounterHandle,
+			expFbHandle:    secboot.FallbackObjectPCRPolicyCounterHandle,
+			expReleased: [][]uint32{
+				{secboot.RunObjectPCRPolicyCounterHandle, secboot.FallbackObjectPCRPolicyCounterHandle},
+				{secboot.AltRunObjectPCRPolicyCounterHandle, secboot.AltFallbackObjectPCRPolicyCounterHandle},
+			},
+		}, {
+			factoryReset: true,
+			pcrHandleErr: errors.New("handle error"),
+			err:          "cannot determine the PCR policy counter of the existing fallback key: handle error",
+		}, {
+			factoryReset:   true,
+			pcrHandleOfKey: secboot.FallbackObjectPCRPolicyCounterHandle,
+			releaseErr:     errors.New("release error"),
+			expReleased: [][]uint32{
+				{secboot.AltRunObjectPCRPolicyCounterHandle, secboot.AltFallbackObjectPCRPolicyCounterHandle},
+			},
+			err: "release error",
+		},
 	} {
 		rootdir := c.MkDir()
 		dirs.SetRootDir(rootdir)
@@ -128,6 +182,21 @@ func (s *sealSuite) TestSealKeyToModeenv(c *C) {
 		})
 		defer restore()
 
+		restore = boot.MockSecbootPCRHandleOfSealedKey(func(p string) (uint32, error) {
+			c.Check(tc.factoryReset, Equals, true)
+			c.Check(p, Equals, filepath.Join(rootdir, "/run/mnt/ubuntu-seed/device/fde/ubuntu-save.recovery.sealed-key"))
+			return tc.pcrHandleOfKey, tc.pcrHandleErr
+		})
+		defer restore()
+
+		var released [][]uint32
+		restore = boot.MockSecbootReleasePCRResourceHandles(func(handles ...uint32) error {
+			c.Check(tc.factoryReset, Equals, true)
+			released = append(released, handles)
+			return tc.releaseErr
+		})
+		defer restore()
+
 		// set mock key sealing
 		sealKeysCalls := 0
 		restore = boot.MockSecbootSealKeys(func(keys []secboot.SealKeyRequest, params *secboot.SealKeysParams) error {
@@ -136,7 +205,15 @@ func (s *sealSuite) TestSealKeyToModeenv(c *C) {
 			case 1:
 				// the run object seals only the ubuntu-data key
 				c.Check(params.TPMPolicyAuthKeyFile, Equals, filepath.Join(boot.InstallHostFDESaveDir, "tpm-policy-auth-key"))
-				c.Check(params.TPMLockoutAuthFile, Equals, filepath.Join(boot.InstallHostFDESaveDir, "tpm-lockout-auth"))
+				if tc.factoryReset {
+					// the TPM is already provisioned
+					c.Check(params.TPMProvision, Equals, false)
+					c.Check(params.TPMLockoutAuthFile, Equals, "")
+				} else {
+					c.Check(params.TPMProvision, Equals, true)
+					c.Check(params.TPMLockoutAuthFile, Equals, filepath.Join(boot.InstallHostFDESaveDir, "tpm-lockout-auth"))
+				}
+				c.Check(params.PCRPolicyCounterHandle, Equals, tc.expRunHandle)
 
 				dataKeyFile := filepath.Join(rootdir, "/run/mnt/ubuntu-boot/device/fde/ubuntu-data.sealed-key")
 				c.Check(keys, DeepEquals, []secboot.SealKeyRequest{{Key: myKey, KeyFile: dataKeyFile}})
@@ -144,6 +221,8 @@ func (s *sealSuite) TestSealKeyToModeenv(c *C) {
 				// the fallback object seals the ubuntu-data and the ubuntu-save keys
 				c.Check(params.TPMPolicyAuthKeyFile, Equals, "")
 				c.Check(params.TPMLockoutAuthFile, Equals, "")
+				c.Check(params.TPMProvision, Equals, false)
+				c.Check(params.PCRPolicyCounterHandle, Equals, tc.expFbHandle)
 
 				dataKeyFile := filepath.Join(rootdir, "/run/mnt/ubuntu-seed/device/fde/ubuntu-data.recovery.sealed-key")
 				saveKeyFile := filepath.Join(rootdir, "/run/mnt/ubuntu-seed/device/fde/ubuntu-save.recovery.sealed-key")
@@ -151,6 +230,7 @@ func (s *sealSuite) TestSealKeyToModeenv(c *C) {
 			default:
 				c.Errorf("unexpected additional call to secboot.SealKeys (call # %d)", sealKeysCalls)
 			}
+			c.Check(params.PIN, Equals, tc.pin)
 			c.Assert(params.ModelParams, HasLen, 1)
 			for _, d := range []string{boot.InitramfsSeedEncryptionKeyDir, boot.InstallHostFDEDataDir} {
 				ex, isdir, _ := osutil.DirExists(d)
@@ -196,12 +276,17 @@ func (s *sealSuite) TestSealKeyToModeenv(c *C) {
 		})
 		defer restore()
 
-		err = boot.SealKeyToModeenv(myKey, myKey2, model, modeenv)
-		if tc.sealErr != nil {
+		flags := boot.SealKeyToModeenvFlags{FactoryReset: tc.factoryReset}
+		err = boot.SealKeyToModeenv(myKey, myKey2, tc.pin, model, modeenv, flags)
+		switch {
+		case tc.pcrHandleErr != nil || tc.releaseErr != nil:
+			c.Assert(sealKeysCalls, Equals, 0)
+		case tc.sealErr != nil:
 			c.Assert(sealKeysCalls, Equals, 1)
-		} else {
+		default:
 			c.Assert(sealKeysCalls, Equals, 2)
 		}
+		c.Check(released, DeepEquals, tc.expReleased)
 		if tc.err == "" {
 			c.Assert(err, IsNil)
 		} else {
@@ -933,7 +1018,7 @@ func (s *sealSuite) TestSealToModeenvWithFdeHookHappy(c *C) {
 	saveKey := secboot.EncryptionKey{5, 6, 7, 8}
 
 	model := boottest.MakeMockUC20Model()
-	err := boot.SealKeyToModeenv(key, saveKey, model, modeenv)
+	err := boot.SealKeyToModeenv(key, saveKey, "", model, modeenv, boot.SealKeyToModeenvFlags{})
 	c.Assert(err, IsNil)
 	// check that runFDESetupHook was called the expected way
 	c.Check(runFDESetupHookParams, DeepEquals, []*boot.FDESetupHookParams{
@@ -975,12 +1060,41 @@ func (s *sealSuite) TestSealToModeenvWithFdeHookSad(c *C) {
 	saveKey := secboot.EncryptionKey{5, 6, 7, 8}
 
 	model := boottest.MakeMockUC20Model()
-	err := boot.SealKeyToModeenv(key, saveKey, model, modeenv)
+	err := boot.SealKeyToModeenv(key, saveKey, "", model, modeenv, boot.SealKeyToModeenvFlags{})
 	c.Assert(err, ErrorMatches, "hook failed")
 	marker := filepath.Join(dirs.SnapFDEDirUnder(boot.InstallHostWritableDir), "sealed-keys")
 	c.Check(marker, testutil.FileAbsent)
 }
 
+func (s *sealSuite) TestSealToModeenvWithFdeHookAndPIN(c *C) {
+	rootdir := c.MkDir()
+	dirs.SetRootDir(rootdir)
+	defer dirs.SetRootDir("")
+
+	restore := boot.MockHasFDESetupHook(func() (bool, error) {
+		return true, nil
+	})
+	defer restore()
+
+	restore = boot.MockRunFDESetupHook(func(op string, params *boot.FDESetupHookParams) ([]byte, error) {
+		c.Fatalf("unexpected call")
+		return nil, nil
+	})
+	defer restore()
+
+	modeenv := &boot.Modeenv{
+		RecoverySystem: "20200825",
+	}
+	key := secboot.EncryptionKey{1, 2, 3, 4}
+	saveKey := secboot.EncryptionKey{5, 6, 7, 8}
+
+	model := boottest.MakeMockUC20Model()
+	err := boot.SealKeyToModeenv(key, saveKey, "1234", model, modeenv, boot.SealKeyToModeenvFlags{})
+	c.Assert(err, ErrorMatches, "cannot seal keys with a PIN using the fde-setup hook")
+	marker := filepath.Join(dirs.SnapFDEDirUnder(boot.InstallHostWritableDir), "sealed-keys")
+	c.Check(marker, testutil.FileAbsent)
+}
+
 func (s *sealSuite) TestResealKeyToModeenvWithFdeHookCalled(c *C) {
 	rootdir := c.MkDir()
 	dirs.SetRootDir(rootdir)
@@ -0,0 +1,203 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/bootloader"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// TryRecoverySystemOutcome is the outcome of trying out a candidate recovery
+// system.
+type TryRecoverySystemOutcome int
+
+const (
+	// TryRecoverySystemOutcomeNoneTried indicates that no recovery system
+	// is being tried.
+	TryRecoverySystemOutcomeNoneTried TryRecoverySystemOutcome = iota
+	// TryRecoverySystemOutcomeSuccess indicates that the candidate system
+	// was booted successfully.
+	TryRecoverySystemOutcomeSuccess
+	// TryRecoverySystemOutcomeFailure indicates that the candidate system
+	// could not be booted, or that the outcome is unknown.
+	TryRecoverySystemOutcomeFailure
+)
+
+const (
+	tryRecoverySystemStatusTry   = "try"
+	tryRecoverySystemStatusTried = "tried"
+)
+
+func findRecoveryBootloader() (bootloader.Bootloader, error) {
+	return bootloader.Find(InitramfsUbuntuSeedDir, &bootloader.Options{
+		Role: bootloader.RoleRecovery,
+	})
+}
+
+// SetTryRecoverySystem sets up the boot environment for trying out the
+// recovery system with given label. The system is added to the list of
+// current recovery systems in the modeenv and the keys are resealed
+// accordingly. The caller is responsible for requesting the reboot.
+func SetTryRecoverySystem(dev Device, systemLabel string) error {
+	if !dev.HasModeenv() {
+		// only UC20 devices are supported
+		return fmt.Errorf("internal error: recovery systems can only be created on UC20")
+	}
+	if systemLabel == "" {
+		return fmt.Errorf("internal error: system label is unset")
+	}
+
+	m, err := loadModeenv()
+	if err != nil {
+		return err
+	}
+	if !strutil.ListContains(m.CurrentRecoverySystems, systemLabel) {
+		m.CurrentRecoverySystems = append(m.CurrentRecoverySystems, systemLabel)
+		if err := m.Write(); err != nil {
+			return err
+		}
+		// the candidate system is part of the boot chains now
+		if err := resealKeyToModeenv(dirs.GlobalRootDir, dev.Model(), m, true); err != nil {
+			return err
+		}
+	}
+
+	bl, err := findRecoveryBootloader()
+	if err != nil {
+		return err
+	}
+	return bl.SetBootVars(map[string]string{
+		"try_recovery_system":    systemLabel,
+		"recovery_system_status": tryRecoverySystemStatusTry,
+		"snapd_recovery_system":  systemLabel,
+		"snapd_recovery_mode":    "recover",
+	})
+}
+
+// InspectTryRecoverySystemOutcome returns the outcome of trying out a
+// recovery system, together with the label of the system that was tried.
+func InspectTryRecoverySystemOutcome(dev Device) (outcome TryRecoverySystemOutcome, systemLabel string, err error) {
+	if !dev.HasModeenv() {
+		return TryRecoverySystemOutcomeNoneTried, "", nil
+	}
+	bl, err := findRecoveryBootloader()
+	if err != nil {
+		return TryRecoverySystemOutcomeFailure, "", err
+	}
+	vars, err := bl.GetBootVars("try_recovery_system", "recovery_system_status")
+	if err != nil {
+		return TryRecoverySystemOutcomeFailure, "", err
+	}
+	systemLabel = vars["try_recovery_system"]
+	switch status := vars["recovery_system_status"]; status {
+	case "":
+		return TryRecoverySystemOutcomeNoneTried, systemLabel, nil
+	case tryRecoverySystemStatusTried:
+		return TryRecoverySystemOutcomeSuccess, systemLabel, nil
+	case tryRecoverySystemStatusTry:
+		// the system was not booted or did not get far enough to
+		// report back
+		return TryRecoverySystemOutcomeFailure, systemLabel, nil
+	default:
+		return TryRecoverySystemOutcomeFailure, systemLabel, fmt.Errorf("unexpected recovery system status %q", status)
+	}
+}
+
+// ClearTryRecoverySystem clears the boot environment state of trying out
+// a recovery system and points the recovery bootloader back at the system
+// the device was installed from. If dropSystem is true, the system with
+// given label is also removed from the list of current recovery systems in
+// the modeenv and the keys are resealed accordingly.
+func ClearTryRecoverySystem(dev Device, systemLabel string, dropSystem bool) error {
+	if !dev.HasModeenv() {
+		return fmt.Errorf("internal error: recovery systems can only be created on UC20")
+	}
+
+	m, err := loadModeenv()
+	if err != nil {
+		return err
+	}
+	if dropSystem && strutil.ListContains(m.CurrentRecoverySystems, systemLabel) {
+		systems := make([]string, 0, len(m.CurrentRecoverySystems))
+		for _, sys := range m.CurrentRecoverySystems {
+			if sys != systemLabel {
+				systems = append(systems, sys)
+			}
+		}
+		m.CurrentRecoverySystems = systems
+		if err := m.Write(); err != nil {
+			return err
+		}
+		if err := resealKeyToModeenv(dirs.GlobalRootDir, dev.Model(), m, true); err != nil {
+			return err
+		}
+	}
+
+	bl, err := findRecoveryBootloader()
+	if err != nil {
+		return err
+	}
+	return bl.SetBootVars(map[string]string{
+		"try_recovery_system":    "",
+		"recovery_system_status": "",
+		"snapd_recovery_system":  m.RecoverySystem,
+	})
+}
+
+// InitramfsIsTryingRecoverySystem returns true if the recovery system with
+// the given label is being tried out. It is meant to be called from the
+// initramfs.
+func InitramfsIsTryingRecoverySystem(systemLabel string) (bool, error) {
+	bl, err := findRecoveryBootloader()
+	if err != nil {
+		return false, err
+	}
+	vars, err := bl.GetBootVars("try_recovery_system", "recovery_system_status")
+	if err != nil {
+		return false, err
+	}
+	return vars["recovery_system_status"] == tryRecoverySystemStatusTry && vars["try_recovery_system"] == systemLabel, nil
+}
+
+// EnsureNextBootToRunModeWithTryRecoverySystemOutcome sets up the boot
+// environment such that the next boot is into run mode, recording the
+// outcome of trying out the current recovery system. It is meant to be
+// called from the initramfs.
+func EnsureNextBootToRunModeWithTryRecoverySystemOutcome(outcome TryRecoverySystemOutcome) error {
+	bl, err := findRecoveryBootloader()
+	if err != nil {
+		return err
+	}
+	vars := map[string]string{
+		"snapd_recovery_mode": "run",
+	}
+	if outcome == TryRecoverySystemOutcomeSuccess {
+		vars["recovery_system_status"] = tryRecoverySystemStatusTried
+	}
+	return bl.SetBootVars(vars)
+}
+
+// InitramfsReboot triggers a reboot from the initramfs immediately.
+func InitramfsReboot() error {
+	return initramfsReboot()
+}
@@ -0,0 +1,209 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package boot_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/boot/boottest"
+	"github.com/snapcore/snapd/bootloader/bootloadertest"
+	"github.com/snapcore/snapd/dirs"
+)
+
+type systemsSuite struct {
+	baseBootenvSuite
+
+	bootloader *bootloadertest.MockBootloader
+
+	dev boot.Device
+}
+
+var _ = Suite(&systemsSuite{})
+
+func (s *systemsSuite) SetUpTest(c *C) {
+	s.baseBootenvSuite.SetUpTest(c)
+
+	s.bootloader = bootloadertest.Mock("mock", c.MkDir())
+	s.forceBootloader(s.bootloader)
+
+	s.dev = boottest.MockUC20Device("", nil)
+
+	m := &boot.Modeenv{
+		Mode:                   "run",
+		RecoverySystem:         "20200825",
+		CurrentRecoverySystems: []string{"20200825"},
+	}
+	c.Assert(m.WriteTo(""), IsNil)
+}
+
+func (s *systemsSuite) mockSealedKeysWithFDEHook(c *C) *[][]string {
+	// pretend the keys are sealed using the fde-setup hook
+	stamp := filepath.Join(dirs.SnapFDEDir, "sealed-keys")
+	c.Assert(os.MkdirAll(filepath.Dir(stamp), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(stamp, []byte("fde-setup-hook"), 0644), IsNil)
+
+	var resealed [][]string
+	s.AddCleanup(boot.MockResealKeyToModeenvUsingFDESetupHook(func(rootdir string, model *asserts.Model, m *boot.Modeenv, expectReseal bool) error {
+		c.Check(expectReseal, Equals, true)
+		resealed = append(resealed, m.CurrentRecoverySystems)
+		return nil
+	}))
+	return &resealed
+}
+
+func (s *systemsSuite) TestSetTryRecoverySystemHappy(c *C) {
+	resealed := s.mockSealedKeysWithFDEHook(c)
+
+	err := boot.SetTryRecoverySystem(s.dev, "1234")
+	c.Assert(err, IsNil)
+
+	c.Check(s.bootloader.BootVars, DeepEquals, map[string]string{
+		"try_recovery_system":    "1234",
+		"recovery_system_status": "try",
+		"snapd_recovery_system":  "1234",
+		"snapd_recovery_mode":    "recover",
+	})
+
+	m, err := boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(m.CurrentRecoverySystems, DeepEquals, []string{"20200825", "1234"})
+	c.Check(*resealed, DeepEquals, [][]string{{"20200825", "1234"}})
+}
+
+func (s *systemsSuite) TestSetTryRecoverySystemNonUC20(c *C) {
+	err := boot.SetTryRecoverySystem(boottest.MockDevice("some-snap"), "1234")
+	c.Assert(err, ErrorMatches, "internal error: recovery systems can only be created on UC20")
+}
+
+func (s *systemsSuite) TestInspectTryRecoverySystemOutcome(c *C) {
+	for _, tc := range []struct {
+		status  string
+		outcome boot.TryRecoverySystemOutcome
+		err     string
+	}{
+		{"", boot.TryRecoverySystemOutcomeNoneTried, ""},
+		{"try", boot.TryRecoverySystemOutcomeFailure, ""},
+		{"tried", boot.TryRecoverySystemOutcomeSuccess, ""},
+		{"foo", boot.TryRecoverySystemOutcomeFailure, `unexpected recovery system status "foo"`},
+	} {
+		s.bootloader.BootVars = map[string]string{
+			"try_recovery_system":    "1234",
+			"recovery_system_status": tc.status,
+		}
+		outcome, label, err := boot.InspectTryRecoverySystemOutcome(s.dev)
+		if tc.err != "" {
+			c.Check(err, ErrorMatches, tc.err)
+		} else {
+			c.Check(err, IsNil)
+		}
+		c.Check(outcome, Equals, tc.outcome, Commentf("status %q", tc.status))
+		c.Check(label, Equals, "1234")
+	}
+}
+
+func (s *systemsSuite) TestClearTryRecoverySystemKeep(c *C) {
+	resealed := s.mockSealedKeysWithFDEHook(c)
+
+	c.Assert(boot.SetTryRecoverySystem(s.dev, "1234"), IsNil)
+	err := boot.ClearTryRecoverySystem(s.dev, "1234", false)
+	c.Assert(err, IsNil)
+
+	c.Check(s.bootloader.BootVars, DeepEquals, map[string]string{
+		"try_recovery_system":    "",
+		"recovery_system_status": "",
+		"snapd_recovery_system":  "20200825",
+		"snapd_recovery_mode":    "recover",
+	})
+	m, err := boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(m.CurrentRecoverySystems, DeepEquals, []string{"20200825", "1234"})
+	c.Check(*resealed, HasLen, 1)
+}
+
+func (s *systemsSuite) TestClearTryRecoverySystemDrop(c *C) {
+	resealed := s.mockSealedKeysWithFDEHook(c)
+
+	c.Assert(boot.SetTryRecoverySystem(s.dev, "1234"), IsNil)
+	err := boot.ClearTryRecoverySystem(s.dev, "1234", true)
+	c.Assert(err, IsNil)
+
+	c.Check(s.bootloader.BootVars["try_recovery_system"], Equals, "")
+	c.Check(s.bootloader.BootVars["recovery_system_status"], Equals, "")
+	m, err := boot.ReadModeenv("")
+	c.Assert(err, IsNil)
+	c.Check(m.CurrentRecoverySystems, DeepEquals, []string{"20200825"})
+	c.Check(*resealed, DeepEquals, [][]string{
+		{"20200825", "1234"},
+		{"20200825"},
+	})
+}
+
+func (s *systemsSuite) TestInitramfsTryRecoverySystem(c *C) {
+	s.bootloader.BootVars = map[string]string{
+		"try_recovery_system":    "1234",
+		"recovery_system_status": "try",
+		"snapd_recovery_system":  "1234",
+		"snapd_recovery_mode":    "recover",
+	}
+
+	trying, err := boot.InitramfsIsTryingRecoverySystem("1234")
+	c.Assert(err, IsNil)
+	c.Check(trying, Equals, true)
+	trying, err = boot.InitramfsIsTryingRecoverySystem("20200825")
+	c.Assert(err, IsNil)
+	c.Check(trying, Equals, false)
+
+	err = boot.EnsureNextBootToRunModeWithTryRecoverySystemOutcome(boot.TryRecoverySystemOutcomeSuccess)
+	c.Assert(err, IsNil)
+	c.Check(s.bootloader.BootVars, DeepEquals, map[string]string{
+		"try_recovery_system":    "1234",
+		"recovery_system_status": "tried",
+		"snapd_recovery_system":  "1234",
+		"snapd_recovery_mode":    "run",
+	})
+
+	trying, err = boot.InitramfsIsTryingRecoverySystem("1234")
+	c.Assert(err, IsNil)
+	c.Check(trying, Equals, false)
+}
+
+func (s *systemsSuite) TestInitramfsTryRecoverySystemFailure(c *C) {
+	s.bootloader.BootVars = map[string]string{
+		"try_recovery_system":    "1234",
+		"recovery_system_status": "try",
+		"snapd_recovery_system":  "1234",
+		"snapd_recovery_mode":    "recover",
+	}
+
+	err := boot.EnsureNextBootToRunModeWithTryRecoverySystemOutcome(boot.TryRecoverySystemOutcomeFailure)
+	c.Assert(err, IsNil)
+	c.Check(s.bootloader.BootVars["recovery_system_status"], Equals, "try")
+	c.Check(s.bootloader.BootVars["snapd_recovery_mode"], Equals, "run")
+
+	outcome, _, err := boot.InspectTryRecoverySystemOutcome(s.dev)
+	c.Assert(err, IsNil)
+	c.Check(outcome, Equals, boot.TryRecoverySystemOutcomeFailure)
+}
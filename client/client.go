@@ -739,11 +739,46 @@ func (client *Client) DebugGet(aspect string, result interface{}, params map[str
 }
 
 type SystemRecoveryKeysResponse struct {
-	RecoveryKey  string `json:"recovery-key"`
+	RecoveryKey  string `json:"recovery-key,omitempty"`
 	ReinstallKey string `json:"reinstall-key"`
+	// LastChange is set once the recovery key was changed after install.
+	LastChange *RecoveryKeyChange `json:"last-change,omitempty"`
+}
+
+// RecoveryKeyChange records when and how the recovery key was last changed.
+type RecoveryKeyChange struct {
+	// Action is either "rotate" or "remove".
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
 }
 
 func (client *Client) SystemRecoveryKeys(result interface{}) error {
 	_, err := client.doSync("GET", "/v2/system-recovery-keys", nil, nil, nil, &result)
 	return err
 }
+
+// RotateRecoveryKey issues a request to replace the recovery key of the
+// encrypted partitions with a newly generated one.
+func (client *Client) RotateRecoveryKey() (changeID string, err error) {
+	return client.changeRecoveryKeys("rotate")
+}
+
+// RemoveRecoveryKeys issues a request to remove the recovery key from the
+// encrypted partitions.
+func (client *Client) RemoveRecoveryKeys() (changeID string, err error) {
+	return client.changeRecoveryKeys("remove")
+}
+
+func (client *Client) changeRecoveryKeys(action string) (changeID string, err error) {
+	req := struct {
+		Action string `json:"action"`
+	}{
+		Action: action,
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(&req); err != nil {
+		return "", err
+	}
+	return client.doAsync("POST", "/v2/system-recovery-keys", nil, nil, &body)
+}
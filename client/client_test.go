@@ -641,3 +641,33 @@ func (cs *clientSuite) TestClientSystemRecoveryKeys(c *C) {
 	c.Check(cs.reqs[0].URL.Path, Equals, "/v2/system-recovery-keys")
 	c.Check(key.RecoveryKey, Equals, "42")
 }
+
+func (cs *clientSuite) TestClientRotateRecoveryKey(c *C) {
+	cs.status = 202
+	cs.rsp = `{"type":"async", "status-code": 202, "change": "42"}`
+
+	chgID, err := cs.cli.RotateRecoveryKey()
+	c.Assert(err, IsNil)
+	c.Check(chgID, Equals, "42")
+	c.Check(cs.reqs, HasLen, 1)
+	c.Check(cs.reqs[0].Method, Equals, "POST")
+	c.Check(cs.reqs[0].URL.Path, Equals, "/v2/system-recovery-keys")
+	var req map[string]interface{}
+	c.Assert(json.NewDecoder(cs.reqs[0].Body).Decode(&req), IsNil)
+	c.Check(req, DeepEquals, map[string]interface{}{"action": "rotate"})
+}
+
+func (cs *clientSuite) TestClientRemoveRecoveryKeys(c *C) {
+	cs.status = 202
+	cs.rsp = `{"type":"async", "status-code": 202, "change": "42"}`
+
+	chgID, err := cs.cli.RemoveRecoveryKeys()
+	c.Assert(err, IsNil)
+	c.Check(chgID, Equals, "42")
+	c.Check(cs.reqs, HasLen, 1)
+	c.Check(cs.reqs[0].Method, Equals, "POST")
+	c.Check(cs.reqs[0].URL.Path, Equals, "/v2/system-recovery-keys")
+	var req map[string]interface{}
+	c.Assert(json.NewDecoder(cs.reqs[0].Body).Decode(&req), IsNil)
+	c.Check(req, DeepEquals, map[string]interface{}{"action": "remove"})
+}
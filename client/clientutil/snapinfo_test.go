@@ -112,6 +112,9 @@ func (*cmdSuite) TestClientSnapFromSnapInfo(c *C) {
 		"TryMode",
 		"JailMode",
 		"MountedFrom",
+		"Compression",
+		"Hold",
+		"Downloaded",
 	}
 	var checker func(string, reflect.Value)
 	checker = func(pfx string, x reflect.Value) {
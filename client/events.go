@@ -0,0 +1,138 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Types of the events streamed by the daemon.
+const (
+	// EventChangeUpdate is sent when the status of a change changes.
+	EventChangeUpdate = "change-update"
+	// EventTaskUpdate is sent when the status of a task changes.
+	EventTaskUpdate = "task-update"
+	// EventTaskProgress is sent when the progress of a task is updated.
+	EventTaskProgress = "task-progress"
+	// EventWarning is sent when a new warning is added.
+	EventWarning = "warning"
+	// EventSnapInstalled is sent when a change installing snaps
+	// completes successfully.
+	EventSnapInstalled = "snap-installed"
+	// EventSnapRemoved is sent when a change removing snaps
+	// completes successfully.
+	EventSnapRemoved = "snap-removed"
+)
+
+// An Event holds a single notification from the daemon.
+type Event struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// ChangeID, Kind, Summary and Status describe the change or task
+	// the event is about, if any.
+	ChangeID string `json:"change-id,omitempty"`
+	TaskID   string `json:"task-id,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Ready    bool   `json:"ready,omitempty"`
+
+	Progress *TaskProgress `json:"progress,omitempty"`
+
+	// Message is the message of a warning.
+	Message string `json:"message,omitempty"`
+
+	// SnapNames are the snaps affected by the change, or installed
+	// or removed.
+	SnapNames []string `json:"snap-names,omitempty"`
+}
+
+// EventFilter restricts the events returned by Events.
+type EventFilter struct {
+	// Types of the events to return, all of them if empty.
+	Types []string
+	// ChangeID if set only returns the events about the given change
+	// and its tasks.
+	ChangeID string
+}
+
+// Events streams the notifications from the daemon matching the
+// filter. The returned channel is closed when the context is
+// cancelled or the daemon ends the stream.
+func (client *Client) Events(ctx context.Context, filter *EventFilter) (<-chan Event, error) {
+	query := url.Values{}
+	if filter != nil {
+		if len(filter.Types) > 0 {
+			query.Set("types", strings.Join(filter.Types, ","))
+		}
+		if filter.ChangeID != "" {
+			query.Set("change-id", filter.ChangeID)
+		}
+	}
+
+	rsp, err := client.raw(ctx, "GET", "/v2/events", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != 200 {
+		var r response
+		defer rsp.Body.Close()
+		if err := decodeInto(rsp.Body, &r); err != nil {
+			return nil, err
+		}
+		return nil, r.err(client, rsp.StatusCode)
+	}
+
+	ch := make(chan Event, 20)
+	go func() {
+		defer rsp.Body.Close()
+		defer close(ch)
+		// events come in application/json-seq, see RFC7464 and Logs
+		scanner := bufio.NewScanner(rsp.Body)
+		for scanner.Scan() {
+			buf := scanner.Bytes()
+			idx := bytes.IndexByte(buf, 0x1E)
+			if idx < 0 {
+				// no RS? skip
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal(buf[idx+1:], &ev); err != nil {
+				// truncated/corrupted record? skip
+				continue
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
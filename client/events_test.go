@@ -0,0 +1,76 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+)
+
+func (cs *clientSuite) TestClientEventsHappy(c *check.C) {
+	cs.rsp = "\x1e{\"type\":\"change-update\",\"change-id\":\"42\",\"status\":\"Doing\"}\n" +
+		"junk without RS\n" +
+		"\x1e{\"type\":\"task-progress\",\"change-id\":\"42\",\"task-id\":\"7\",\"progress\":{\"label\":\"foo\",\"done\":1,\"total\":2}}\n" +
+		"\x1e{truncated\n"
+
+	ch, err := cs.cli.Events(context.Background(), &client.EventFilter{
+		Types:    []string{client.EventChangeUpdate, client.EventTaskProgress},
+		ChangeID: "42",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/events")
+	c.Check(cs.req.URL.Query().Get("types"), check.Equals, "change-update,task-progress")
+	c.Check(cs.req.URL.Query().Get("change-id"), check.Equals, "42")
+
+	var events []client.Event
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	c.Check(events, check.DeepEquals, []client.Event{
+		{Type: "change-update", ChangeID: "42", Status: "Doing"},
+		{Type: "task-progress", ChangeID: "42", TaskID: "7", Progress: &client.TaskProgress{Label: "foo", Done: 1, Total: 2}},
+	})
+}
+
+func (cs *clientSuite) TestClientEventsNoFilter(c *check.C) {
+	cs.rsp = ""
+	ch, err := cs.cli.Events(context.Background(), nil)
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.RawQuery, check.Equals, "")
+	for range ch {
+		c.Fatal("unexpected event")
+	}
+}
+
+func (cs *clientSuite) TestClientEventsError(c *check.C) {
+	cs.status = 404
+	cs.rsp = `{"type": "error", "status-code": 404, "result": {"message": "not found"}}`
+	_, err := cs.cli.Events(context.Background(), nil)
+	c.Assert(err, check.ErrorMatches, "not found")
+
+	cs.err = fmt.Errorf("xyzzy")
+	_, err = cs.cli.Events(context.Background(), nil)
+	c.Assert(err, check.ErrorMatches, ".* xyzzy")
+}
@@ -66,6 +66,7 @@ type Snap struct {
 	License          string        `json:"license,omitempty"`
 	CommonIDs        []string      `json:"common-ids,omitempty"`
 	MountedFrom      string        `json:"mounted-from,omitempty"`
+	Compression      string        `json:"compression,omitempty"`
 	CohortKey        string        `json:"cohort-key,omitempty"`
 	Website          string        `json:"website,omitempty"`
 
@@ -80,6 +81,14 @@ type Snap struct {
 	Tracks []string `json:"tracks,omitempty"`
 
 	Health *SnapHealth `json:"health,omitempty"`
+
+	// Hold is the time until which the refresh of the snap is held by
+	// other snaps or by the user, if any.
+	Hold *time.Time `json:"hold,omitempty"`
+
+	// Downloaded is set for updates that were already fetched ahead
+	// of their refresh.
+	Downloaded bool `json:"downloaded,omitempty"`
 }
 
 type SnapHealth struct {
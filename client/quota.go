@@ -0,0 +1,132 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/snapd/gadget/quantity"
+)
+
+// QuotaValues holds the resource limits of a quota group.
+type QuotaValues struct {
+	Memory quantity.Size `json:"memory,omitempty"`
+	// CPU is the percentage of a single CPU
+	CPU   int `json:"cpu,omitempty"`
+	Tasks int `json:"tasks,omitempty"`
+}
+
+// QuotaGroupResult holds information about a single quota group.
+type QuotaGroupResult struct {
+	GroupName   string       `json:"group-name"`
+	Parent      string       `json:"parent,omitempty"`
+	Subgroups   []string     `json:"subgroups,omitempty"`
+	Snaps       []string     `json:"snaps,omitempty"`
+	Constraints *QuotaValues `json:"constraints,omitempty"`
+}
+
+type postQuotaData struct {
+	Action      string       `json:"action"`
+	GroupName   string       `json:"group-name"`
+	Parent      string       `json:"parent,omitempty"`
+	Snaps       []string     `json:"snaps,omitempty"`
+	Constraints *QuotaValues `json:"constraints,omitempty"`
+}
+
+// EnsureQuota creates a quota group or updates an existing group with the
+// given snaps and limits. When the group exists only the limits which are set
+// are changed and the snaps are added to the group.
+func (client *Client) EnsureQuota(groupName string, parent string, snaps []string, limits *QuotaValues) (changeID string, err error) {
+	if groupName == "" {
+		return "", xerrors.Errorf("cannot create or update quota group without a name")
+	}
+
+	data := &postQuotaData{
+		Action:      "ensure",
+		GroupName:   groupName,
+		Parent:      parent,
+		Snaps:       snaps,
+		Constraints: limits,
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return "", err
+	}
+	chgID, err := client.doAsync("POST", "/v2/quotas", nil, nil, &body)
+	if err != nil {
+		fmt := "cannot create or update quota group: %w"
+		return "", xerrors.Errorf(fmt, err)
+	}
+	return chgID, nil
+}
+
+// RemoveQuotaGroup removes the given quota group, the services of the snaps
+// in the group are no longer limited.
+func (client *Client) RemoveQuotaGroup(groupName string) (changeID string, err error) {
+	if groupName == "" {
+		return "", xerrors.Errorf("cannot remove quota group without a name")
+	}
+
+	data := &postQuotaData{
+		Action:    "remove",
+		GroupName: groupName,
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(data); err != nil {
+		return "", err
+	}
+	chgID, err := client.doAsync("POST", "/v2/quotas", nil, nil, &body)
+	if err != nil {
+		fmt := "cannot remove quota group: %w"
+		return "", xerrors.Errorf(fmt, err)
+	}
+	return chgID, nil
+}
+
+// GetQuotaGroup queries the given quota group.
+func (client *Client) GetQuotaGroup(groupName string) (*QuotaGroupResult, error) {
+	if groupName == "" {
+		return nil, xerrors.Errorf("cannot get quota group without a name")
+	}
+
+	var res *QuotaGroupResult
+	path := fmt.Sprintf("/v2/quotas/%s", groupName)
+	if _, err := client.doSync("GET", path, nil, nil, nil, &res); err != nil {
+		fmt := "cannot get quota group: %w"
+		return nil, xerrors.Errorf(fmt, err)
+	}
+	return res, nil
+}
+
+// Quotas queries all quota groups.
+func (client *Client) Quotas() ([]*QuotaGroupResult, error) {
+	var res []*QuotaGroupResult
+	if _, err := client.doSync("GET", "/v2/quotas", nil, nil, nil, &res); err != nil {
+		fmt := "cannot list quota groups: %w"
+		return nil, xerrors.Errorf(fmt, err)
+	}
+	return res, nil
+}
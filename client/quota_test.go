@@ -0,0 +1,176 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/gadget/quantity"
+)
+
+func (cs *clientSuite) TestEnsureQuotaGroupInvalidName(c *check.C) {
+	_, err := cs.cli.EnsureQuota("", "", nil, nil)
+	c.Check(err, check.ErrorMatches, `cannot create or update quota group without a name`)
+}
+
+func (cs *clientSuite) TestEnsureQuotaGroup(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"change": "42"
+	}`
+
+	chgID, err := cs.cli.EnsureQuota("foo", "bar", []string{"snap-a", "snap-b"}, &client.QuotaValues{
+		Memory: quantity.SizeMiB,
+		Tasks:  32,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(chgID, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Assert(req, check.DeepEquals, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "foo",
+		"parent":     "bar",
+		"snaps":      []interface{}{"snap-a", "snap-b"},
+		"constraints": map[string]interface{}{
+			"memory": float64(1048576),
+			"tasks":  float64(32),
+		},
+	})
+}
+
+func (cs *clientSuite) TestEnsureQuotaGroupError(c *check.C) {
+	cs.status = 500
+	cs.rsp = errorResponseJSON
+
+	_, err := cs.cli.EnsureQuota("foo", "", nil, nil)
+	c.Check(err, check.ErrorMatches, `cannot create or update quota group: failed`)
+}
+
+func (cs *clientSuite) TestRemoveQuotaGroup(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+		"type": "async",
+		"status-code": 202,
+		"change": "42"
+	}`
+
+	chgID, err := cs.cli.RemoveQuotaGroup("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(chgID, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Assert(req, check.DeepEquals, map[string]interface{}{
+		"action":     "remove",
+		"group-name": "foo",
+	})
+
+	_, err = cs.cli.RemoveQuotaGroup("")
+	c.Check(err, check.ErrorMatches, `cannot remove quota group without a name`)
+}
+
+func (cs *clientSuite) TestRemoveQuotaGroupError(c *check.C) {
+	cs.status = 500
+	cs.rsp = errorResponseJSON
+
+	_, err := cs.cli.RemoveQuotaGroup("foo")
+	c.Check(err, check.ErrorMatches, `cannot remove quota group: failed`)
+}
+
+func (cs *clientSuite) TestGetQuotaGroup(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {
+			"group-name": "foo",
+			"parent": "bar",
+			"subgroups": ["foo-subgrp"],
+			"snaps": ["snap-a"],
+			"constraints": {"memory": 1048576, "cpu": 50}
+		}
+	}`
+
+	grp, err := cs.cli.GetQuotaGroup("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas/foo")
+	c.Check(grp, check.DeepEquals, &client.QuotaGroupResult{
+		GroupName:   "foo",
+		Parent:      "bar",
+		Subgroups:   []string{"foo-subgrp"},
+		Snaps:       []string{"snap-a"},
+		Constraints: &client.QuotaValues{Memory: quantity.SizeMiB, CPU: 50},
+	})
+
+	_, err = cs.cli.GetQuotaGroup("")
+	c.Check(err, check.ErrorMatches, `cannot get quota group without a name`)
+}
+
+func (cs *clientSuite) TestGetQuotaGroupError(c *check.C) {
+	cs.status = 500
+	cs.rsp = errorResponseJSON
+
+	_, err := cs.cli.GetQuotaGroup("foo")
+	c.Check(err, check.ErrorMatches, `cannot get quota group: failed`)
+}
+
+func (cs *clientSuite) TestQuotas(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"group-name": "bar", "constraints": {"tasks": 32}},
+			{"group-name": "foo", "snaps": ["snap-a"], "constraints": {"memory": 1048576}}
+		]
+	}`
+
+	grps, err := cs.cli.Quotas()
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/quotas")
+	c.Check(grps, check.DeepEquals, []*client.QuotaGroupResult{
+		{GroupName: "bar", Constraints: &client.QuotaValues{Tasks: 32}},
+		{GroupName: "foo", Snaps: []string{"snap-a"}, Constraints: &client.QuotaValues{Memory: quantity.SizeMiB}},
+	})
+}
+
+func (cs *clientSuite) TestQuotasError(c *check.C) {
+	cs.status = 500
+	cs.rsp = errorResponseJSON
+
+	_, err := cs.cli.Quotas()
+	c.Check(err, check.ErrorMatches, `cannot list quota groups: failed`)
+}
@@ -0,0 +1,70 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Actions on a pending refresh, as chosen by the user on the desktop
+// notification about it.
+const (
+	PendingRefreshActionRefreshNow = "refresh-now"
+	PendingRefreshActionPostpone   = "postpone"
+)
+
+// PendingRefreshAction holds the choice of the user about the pending
+// refresh of a snap.
+type PendingRefreshAction struct {
+	InstanceName string `json:"instance-name"`
+	Action       string `json:"action"`
+}
+
+func (client *Client) pendingRefreshActionData(instanceName, action string) ([]byte, error) {
+	data, err := json.Marshal(&PendingRefreshAction{InstanceName: instanceName, Action: action})
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal pending refresh action: %v", err)
+	}
+	return data, nil
+}
+
+// RefreshNow asks for the pending refresh of the given snap, inhibited
+// by its running apps, to be attempted again right away. It returns the
+// ID of the change refreshing the snap.
+func (client *Client) RefreshNow(instanceName string) (changeID string, err error) {
+	data, err := client.pendingRefreshActionData(instanceName, PendingRefreshActionRefreshNow)
+	if err != nil {
+		return "", err
+	}
+	return client.doAsync("POST", "/v2/notifications/pending-refresh", nil, nil, bytes.NewReader(data))
+}
+
+// PostponeRefresh asks not to be notified again for a while about the
+// pending refresh of the given snap.
+func (client *Client) PostponeRefresh(instanceName string) error {
+	data, err := client.pendingRefreshActionData(instanceName, PendingRefreshActionPostpone)
+	if err != nil {
+		return err
+	}
+	_, err = client.doSync("POST", "/v2/notifications/pending-refresh", nil, nil, bytes.NewReader(data), nil)
+	return err
+}
@@ -46,6 +46,10 @@ type SnapOptions struct {
 	Amend            bool   `json:"amend,omitempty"`
 
 	Users []string `json:"users,omitempty"`
+	// SnapshotKey is the key the snapshots are encrypted with
+	SnapshotKey []byte `json:"snapshot-key,omitempty"`
+	// Hold is how long refreshes are held for, a duration or "forever"
+	Hold string `json:"hold,omitempty"`
 }
 
 func writeFieldBool(mw *multipart.Writer, key string, val bool) error {
@@ -89,9 +93,11 @@ type actionData struct {
 }
 
 type multiActionData struct {
-	Action string   `json:"action"`
-	Snaps  []string `json:"snaps,omitempty"`
-	Users  []string `json:"users,omitempty"`
+	Action      string   `json:"action"`
+	Snaps       []string `json:"snaps,omitempty"`
+	Users       []string `json:"users,omitempty"`
+	SnapshotKey []byte   `json:"snapshot-key,omitempty"`
+	Hold        string   `json:"hold,omitempty"`
 }
 
 // Install adds the snap with the given name from the given channel (or
@@ -141,9 +147,24 @@ func (client *Client) Switch(name string, options *SnapOptions) (changeID string
 	return client.doSnapAction("switch", name, options)
 }
 
+// HoldRefreshes holds the refreshes of the given snaps for the given
+// duration, as understood by time.ParseDuration, or "forever", which
+// requires administrator privileges.
+func (client *Client) HoldRefreshes(names []string, hold string) (changeID string, err error) {
+	_, changeID, err = client.doMultiSnapActionFull("hold", names, &SnapOptions{Hold: hold})
+	return changeID, err
+}
+
+// UnholdRefreshes releases the refresh holds of the given snaps, or of all
+// snaps if none is given.
+func (client *Client) UnholdRefreshes(names []string) (changeID string, err error) {
+	return client.doMultiSnapAction("unhold", names, nil)
+}
+
 // SnapshotMany snapshots many snaps (all, if names empty) for many users (all, if users is empty).
-func (client *Client) SnapshotMany(names []string, users []string) (setID uint64, changeID string, err error) {
-	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, &SnapOptions{Users: users})
+// The snapshots are encrypted with the key, if given.
+func (client *Client) SnapshotMany(names []string, users []string, key []byte) (setID uint64, changeID string, err error) {
+	result, changeID, err := client.doMultiSnapActionFull("snapshot", names, &SnapOptions{Users: users, SnapshotKey: key})
 	if err != nil {
 		return 0, "", err
 	}
@@ -198,6 +219,8 @@ func (client *Client) doMultiSnapActionFull(actionName string, snaps []string, o
 	}
 	if options != nil {
 		action.Users = options.Users
+		action.SnapshotKey = options.SnapshotKey
+		action.Hold = options.Hold
 	}
 	data, err := json.Marshal(&action)
 	if err != nil {
@@ -22,6 +22,7 @@ package client
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -37,6 +38,10 @@ import (
 // SnapshotExportMediaType is the media type used to identify snapshot exports in the API.
 const SnapshotExportMediaType = "application/x.snapd.snapshot"
 
+// SnapshotKeyHeader is the header carrying the base64 encoded key of
+// encrypted snapshots being imported.
+const SnapshotKeyHeader = "X-Snapshot-Key"
+
 var (
 	ErrSnapshotSetNotFound   = errors.New("no snapshot set with the given ID")
 	ErrSnapshotSnapsNotFound = errors.New("no snapshot for the requested snaps found in the set with the given ID")
@@ -48,6 +53,7 @@ type snapshotAction struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
 	Users  []string `json:"users,omitempty"`
+	Key    []byte   `json:"key,omitempty"`
 }
 
 // A Snapshot is a collection of archives with a simple metadata json file
@@ -78,6 +84,15 @@ type Snapshot struct {
 	// if the snapshot failed to open this will be the reason why
 	Broken string `json:"broken,omitempty"`
 
+	// set if the archives of the snapshot are encrypted
+	Encryption *SnapshotEncryption `json:"encryption,omitempty"`
+	// set if the archives of the snapshot are stored as chunks in
+	// the shared chunk store
+	Chunked bool `json:"chunked,omitempty"`
+	// the snapshot options of the snap, set if some of its data was
+	// excluded from the snapshot
+	Options *snap.SnapshotOptions `json:"options,omitempty"`
+
 	// set if the snapshot was created automatically on snap removal;
 	// note, this is only set inside actual snapshot file for old snapshots;
 	// newer snapd just updates this flag on the fly for snapshots
@@ -85,6 +100,19 @@ type Snapshot struct {
 	Auto bool `json:"auto,omitempty"`
 }
 
+// SnapshotEncryption describes how the archives of a snapshot are
+// encrypted, and how the key is derived from the passphrase or key file
+// the snapshot was saved with.
+type SnapshotEncryption struct {
+	Cipher string `json:"cipher"`
+	KDF    string `json:"kdf"`
+	Salt   []byte `json:"salt"`
+	// Count is the number of bytes hashed to derive the key
+	Count int `json:"count"`
+	// KeyCheck allows telling a wrong key from corrupted archives
+	KeyCheck string `json:"key-check"`
+}
+
 // IsValid checks whether the snapshot is missing information that
 // should be there for a snapshot that's just been opened.
 func (sh *Snapshot) IsValid() bool {
@@ -149,26 +177,30 @@ func (client *Client) ForgetSnapshots(setID uint64, snaps []string) (changeID st
 // CheckSnapshots verifies the archive checksums in the given snapshot set.
 //
 // If snaps or users are non-empty, limit to checking only those
-// archives of the snapshot.
-func (client *Client) CheckSnapshots(setID uint64, snaps []string, users []string) (changeID string, err error) {
+// archives of the snapshot. The key is needed to check encrypted
+// snapshots, unless the system has one configured.
+func (client *Client) CheckSnapshots(setID uint64, snaps []string, users []string, key []byte) (changeID string, err error) {
 	return client.snapshotAction(&snapshotAction{
 		SetID:  setID,
 		Action: "check",
 		Snaps:  snaps,
 		Users:  users,
+		Key:    key,
 	})
 }
 
 // RestoreSnapshots extracts the given snapshot set.
 //
 // If snaps or users are non-empty, limit to checking only those
-// archives of the snapshot.
-func (client *Client) RestoreSnapshots(setID uint64, snaps []string, users []string) (changeID string, err error) {
+// archives of the snapshot. The key is needed to restore encrypted
+// snapshots, unless the system has one configured.
+func (client *Client) RestoreSnapshots(setID uint64, snaps []string, users []string, key []byte) (changeID string, err error) {
 	return client.snapshotAction(&snapshotAction{
 		SetID:  setID,
 		Action: "restore",
 		Snaps:  snaps,
 		Users:  users,
+		Key:    key,
 	})
 }
 
@@ -217,12 +249,16 @@ type SnapshotImportSet struct {
 	Snaps []string `json:"snaps"`
 }
 
-// SnapshotImport imports an exported snapshot set.
-func (client *Client) SnapshotImport(exportStream io.Reader, size int64) (SnapshotImportSet, error) {
+// SnapshotImport imports an exported snapshot set. The key is needed to
+// verify encrypted snapshots, unless the system has one configured.
+func (client *Client) SnapshotImport(exportStream io.Reader, size int64, key []byte) (SnapshotImportSet, error) {
 	headers := map[string]string{
 		"Content-Type":   SnapshotExportMediaType,
 		"Content-Length": strconv.FormatInt(size, 10),
 	}
+	if key != nil {
+		headers[SnapshotKeyHeader] = base64.StdEncoding.EncodeToString(key)
+	}
 
 	var importSet SnapshotImportSet
 	if _, err := client.doSync("POST", "/v2/snapshots", nil, headers, exportStream, &importSet); err != nil {
@@ -98,6 +98,10 @@ func (cs *clientSuite) TestClientSnapshotSets(c *check.C) {
 }
 
 func (cs *clientSuite) testClientSnapshotActionFull(c *check.C, action string, users []string, f func() (string, error)) {
+	cs.testClientSnapshotActionFullWithKey(c, action, users, nil, f)
+}
+
+func (cs *clientSuite) testClientSnapshotActionFullWithKey(c *check.C, action string, users []string, key []byte, f func() (string, error)) {
 	cs.status = 202
 	cs.rsp = `{
 		"status-code": 202,
@@ -116,6 +120,7 @@ func (cs *clientSuite) testClientSnapshotActionFull(c *check.C, action string, u
 	c.Check(act.Action, check.Equals, action)
 	c.Check(act.Snaps, check.DeepEquals, []string{"asnap", "bsnap"})
 	c.Check(act.Users, check.DeepEquals, users)
+	c.Check(act.Key, check.DeepEquals, key)
 
 	c.Check(cs.req.Method, check.Equals, "POST")
 	c.Check(cs.req.URL.Path, check.Equals, "/v2/snapshots")
@@ -128,9 +133,12 @@ func (cs *clientSuite) TestClientForgetSnapshot(c *check.C) {
 	})
 }
 
-func (cs *clientSuite) testClientSnapshotAction(c *check.C, action string, f func(uint64, []string, []string) (string, error)) {
+func (cs *clientSuite) testClientSnapshotAction(c *check.C, action string, f func(uint64, []string, []string, []byte) (string, error)) {
 	cs.testClientSnapshotActionFull(c, action, []string{"auser", "buser"}, func() (string, error) {
-		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"})
+		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"}, nil)
+	})
+	cs.testClientSnapshotActionFullWithKey(c, action, []string{"auser", "buser"}, []byte("key"), func() (string, error) {
+		return f(42, []string{"asnap", "bsnap"}, []string{"auser", "buser"}, []byte("key"))
 	})
 }
 
@@ -201,7 +209,7 @@ func (cs *clientSuite) TestClientSnapshotImport(c *check.C) {
 
 		fakeSnapshotData := "fake"
 		r := strings.NewReader(fakeSnapshotData)
-		importSet, err := cs.cli.SnapshotImport(r, int64(len(fakeSnapshotData)))
+		importSet, err := cs.cli.SnapshotImport(r, int64(len(fakeSnapshotData)), nil)
 		if t.error != "" {
 			c.Assert(err, check.NotNil, comm)
 			c.Check(err.Error(), check.Equals, t.error, comm)
@@ -215,5 +223,16 @@ func (cs *clientSuite) TestClientSnapshotImport(c *check.C) {
 		d, err := ioutil.ReadAll(cs.req.Body)
 		c.Assert(err, check.IsNil)
 		c.Check(string(d), check.Equals, fakeSnapshotData)
+		c.Check(cs.req.Header.Get(client.SnapshotKeyHeader), check.Equals, "")
 	}
 }
+
+func (cs *clientSuite) TestClientSnapshotImportWithKey(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {"set-id": 42, "snaps": ["foo"]}}`
+
+	fakeSnapshotData := "fake"
+	r := strings.NewReader(fakeSnapshotData)
+	_, err := cs.cli.SnapshotImport(r, int64(len(fakeSnapshotData)), []byte("key"))
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Header.Get(client.SnapshotKeyHeader), check.Equals, "a2V5")
+}
@@ -113,8 +113,8 @@ func (client *Client) DoSystemAction(systemLabel string, action *SystemAction) e
 // When called without a systemLabel but with a mode it will use
 // the current system to enter the given mode.
 //
-// Note that "recover" and "run" modes are only available for the
-// current system.
+// Note that "recover", "factory-reset" and "run" modes are only
+// available for the current system.
 func (client *Client) RebootToSystem(systemLabel, mode string) error {
 	// verification is done by the backend
 
@@ -138,3 +138,30 @@ func (client *Client) RebootToSystem(systemLabel, mode string) error {
 	}
 	return nil
 }
+
+// CreateRecoverySystem issues a request to create a new recovery system
+// with the given label from the snaps and assertions of the running
+// system.
+func (client *Client) CreateRecoverySystem(systemLabel string) (changeID string, err error) {
+	if systemLabel == "" {
+		return "", fmt.Errorf("cannot create a recovery system without a label")
+	}
+
+	req := struct {
+		Action string `json:"action"`
+		Label  string `json:"label"`
+	}{
+		Action: "create",
+		Label:  systemLabel,
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(&req); err != nil {
+		return "", err
+	}
+	changeID, err = client.doAsync("POST", "/v2/systems", nil, nil, &body)
+	if err != nil {
+		return "", xerrors.Errorf("cannot create recovery system %q: %v", systemLabel, err)
+	}
+	return changeID, nil
+}
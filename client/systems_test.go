@@ -215,3 +215,41 @@ func (cs *clientSuite) TestRequestSystemRebootErrorWithSystem(c *check.C) {
 	c.Check(cs.req.Method, check.Equals, "POST")
 	c.Check(cs.req.URL.Path, check.Equals, "/v2/systems/1234")
 }
+
+func (cs *clientSuite) TestCreateRecoverySystemHappy(c *check.C) {
+	cs.status = 202
+	cs.rsp = `{
+	    "type": "async",
+	    "status-code": 202,
+	    "result": {},
+	    "change": "42"
+	}`
+	id, err := cs.cli.CreateRecoverySystem("20210101")
+	c.Assert(err, check.IsNil)
+	c.Check(id, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/systems")
+
+	body, err := ioutil.ReadAll(cs.req.Body)
+	c.Assert(err, check.IsNil)
+	var req map[string]interface{}
+	err = json.Unmarshal(body, &req)
+	c.Assert(err, check.IsNil)
+	c.Assert(req, check.DeepEquals, map[string]interface{}{
+		"action": "create",
+		"label":  "20210101",
+	})
+}
+
+func (cs *clientSuite) TestCreateRecoverySystemError(c *check.C) {
+	cs.rsp = `{
+	    "type": "error",
+	    "status-code": 400,
+	    "result": {"message": "failed"}
+	}`
+	_, err := cs.cli.CreateRecoverySystem("20210101")
+	c.Assert(err, check.ErrorMatches, `cannot create recovery system "20210101": failed`)
+
+	_, err = cs.cli.CreateRecoverySystem("")
+	c.Assert(err, check.ErrorMatches, `cannot create a recovery system without a label`)
+}
@@ -0,0 +1,44 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"github.com/snapcore/snapd/snap"
+)
+
+// SnapVerification holds the result of checking the file of an
+// installed snap revision against its snap-revision assertion.
+type SnapVerification struct {
+	Snap     string        `json:"snap"`
+	Revision snap.Revision `json:"revision"`
+	// SHA3_384 is the expected digest of the snap file.
+	SHA3_384 string `json:"sha3-384"`
+	Verified bool   `json:"verified"`
+}
+
+// VerifySnap asks for the file of the current revision of the given snap
+// to be checked against its snap-revision assertion.
+func (client *Client) VerifySnap(snapName string) (*SnapVerification, error) {
+	var verification SnapVerification
+	if _, err := client.doSync("GET", "/v2/snaps/"+snapName+"/verify", nil, nil, nil, &verification); err != nil {
+		return nil, err
+	}
+	return &verification, nil
+}
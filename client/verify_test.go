@@ -0,0 +1,56 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client_test
+
+import (
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/snap"
+)
+
+func (cs *clientSuite) TestClientVerifySnap(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"snap": "foo", "revision": "7", "sha3-384": "digest", "verified": true}
+	}`
+	verification, err := cs.cli.VerifySnap("foo")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v2/snaps/foo/verify")
+	c.Check(verification, check.DeepEquals, &client.SnapVerification{
+		Snap:     "foo",
+		Revision: snap.R(7),
+		SHA3_384: "digest",
+		Verified: true,
+	})
+}
+
+func (cs *clientSuite) TestClientVerifySnapError(c *check.C) {
+	cs.status = 400
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "cannot verify snap \"foo\": snap has no snap-revision assertion"}
+	}`
+	_, err := cs.cli.VerifySnap("foo")
+	c.Check(err, check.ErrorMatches, `cannot verify snap "foo": snap has no snap-revision assertion`)
+}
@@ -81,6 +81,7 @@ var (
 	secbootMeasureSnapModelWhenPossible          func(findModel func() (*asserts.Model, error)) error
 	secbootUnlockVolumeUsingSealedKeyIfEncrypted func(disk disks.Disk, name string, encryptionKeyFile string, opts *secboot.UnlockVolumeUsingSealedKeyOptions) (secboot.UnlockResult, error)
 	secbootUnlockEncryptedVolumeUsingKey         func(disk disks.Disk, name string, key []byte) (secboot.UnlockResult, error)
+	secbootUnlockEncryptedVolumeUsingPassphrase  func(disk disks.Disk, name string, opts *secboot.UnlockVolumeUsingPassphraseOptions) (secboot.UnlockResult, error)
 
 	secbootLockSealedKeys func() error
 
@@ -139,6 +140,8 @@ func generateInitramfsMounts() (err error) {
 		return generateMountsModeRecover(mst)
 	case "install":
 		return generateMountsModeInstall(mst)
+	case "factory-reset":
+		return generateMountsModeFactoryReset(mst)
 	case "run":
 		return generateMountsModeRun(mst)
 	}
@@ -169,6 +172,64 @@ func generateMountsModeInstall(mst *initramfsMountsState) error {
 	return nil
 }
 
+func generateMountsModeFactoryReset(mst *initramfsMountsState) error {
+	// steps 1 and 2 are shared with install mode
+	model, err := generateMountsCommonInstallRecover(mst)
+	if err != nil {
+		return err
+	}
+
+	// get the disk that we mounted the ubuntu-seed partition from as a
+	// reference point for future mounts
+	disk, err := disks.DiskFromMountPoint(boot.InitramfsUbuntuSeedDir, nil)
+	if err != nil {
+		return err
+	}
+
+	// 3. unlock ubuntu-save with the fallback key on ubuntu-seed and mount
+	//    it, ubuntu-boot and ubuntu-data are recreated by snapd so they are
+	//    left alone
+	unlockOpts := &secboot.UnlockVolumeUsingSealedKeyOptions{
+		// the reinstall key is the last chance to keep ubuntu-save
+		AllowRecoveryKey: true,
+	}
+	if model.StorageProtection() == asserts.StorageProtectionTPMPIN {
+		unlockOpts.PINTries = userAuthTries
+	}
+	saveFallbackKey := filepath.Join(boot.InitramfsSeedEncryptionKeyDir, "ubuntu-save.recovery.sealed-key")
+	unlockRes, err := secbootUnlockVolumeUsingSealedKeyIfEncrypted(disk, "ubuntu-save", saveFallbackKey, unlockOpts)
+	switch {
+	case err == nil:
+		// TODO: should we fsck ubuntu-save ?
+		if err := doSystemdMount(unlockRes.FsDevice, boot.InitramfsUbuntuSaveDir, nil); err != nil {
+			return err
+		}
+	case unlockRes.IsEncrypted:
+		return fmt.Errorf("cannot unlock ubuntu-save: %v", err)
+	default:
+		// systems installed without ubuntu-save can be reset too, as
+		// long as they are not encrypted
+		_, findErr := disk.FindMatchingPartitionUUIDWithFsLabel("ubuntu-save")
+		if _, ok := findErr.(disks.PartitionNotFoundError); !ok {
+			return fmt.Errorf("cannot find ubuntu-save: %v", err)
+		}
+		logger.Noticef("no ubuntu-save partition on disk %s", disk.Dev())
+	}
+
+	// 4. final step: write modeenv to tmpfs data dir
+	modeEnv := &boot.Modeenv{
+		Mode:           "factory-reset",
+		RecoverySystem: mst.recoverySystem,
+	}
+	if err := modeEnv.WriteTo(boot.InitramfsWritableDir); err != nil {
+		return err
+	}
+
+	// done, no output, no error indicates to initramfs we are done with
+	// mounting stuff
+	return nil
+}
+
 // copyNetworkConfig copies the network configuration to the target
 // directory. This is used to copy the network configuration
 // data from a real uc20 ubuntu-data partition into a ephemeral one.
@@ -315,11 +376,16 @@ const (
 	partitionUnlocked     = "unlocked"
 	partitionErrUnlocking = "error-unlocking"
 	// keys used to unlock for UnlockKey
-	keyRun      = "run"
-	keyFallback = "fallback"
-	keyRecovery = "recovery"
+	keyRun        = "run"
+	keyFallback   = "fallback"
+	keyRecovery   = "recovery"
+	keyPassphrase = "passphrase"
 )
 
+// number of times the user is asked for the PIN or the passphrase
+// before falling back to the recovery key
+const userAuthTries = 3
+
 // partitionState is the state of a partition after recover mode has completed
 // for degraded mode.
 type partitionState struct {
@@ -338,7 +404,7 @@ type partitionState struct {
 	// UnlockState was whether the partition was unlocked successfully or not.
 	UnlockState string `json:"unlock-state,omitempty"`
 	// UnlockKey was what key the partition was unlocked with, either "run",
-	// "fallback" or "recovery".
+	// "fallback", "recovery" or "passphrase".
 	UnlockKey string `json:"unlock-key,omitempty"`
 
 	// unexported internal fields for tracking the device, these are used during
@@ -426,12 +492,13 @@ func (m *recoverModeStateMachine) degraded() bool {
 			return true
 		}
 
-		// we also should have all the unlock keys as run keys
-		if r.UbuntuData.UnlockKey != keyRun {
+		// we also should have all the unlock keys as run keys, or the
+		// passphrase which replaces them
+		if r.UbuntuData.UnlockKey != keyRun && r.UbuntuData.UnlockKey != keyPassphrase {
 			return true
 		}
 
-		if r.UbuntuSave.UnlockKey != keyRun {
+		if r.UbuntuSave.UnlockKey != keyRun && r.UbuntuSave.UnlockKey != keyPassphrase {
 			return true
 		}
 	} else {
@@ -462,6 +529,24 @@ func (m *recoverModeStateMachine) degraded() bool {
 	return false
 }
 
+// usePassphrase returns whether the model requires the encrypted
+// partitions to be unlocked with a passphrase instead of sealed keys.
+func (m *recoverModeStateMachine) usePassphrase() bool {
+	return m.model.StorageProtection() == asserts.StorageProtectionPassphrase
+}
+
+// sealedKeyOptions returns the options for unlocking with sealed keys, taking
+// into account whether the model requires a PIN.
+func (m *recoverModeStateMachine) sealedKeyOptions(allowRecoveryKey bool) *secboot.UnlockVolumeUsingSealedKeyOptions {
+	opts := &secboot.UnlockVolumeUsingSealedKeyOptions{
+		AllowRecoveryKey: allowRecoveryKey,
+	}
+	if m.model.StorageProtection() == asserts.StorageProtectionTPMPIN {
+		opts.PINTries = userAuthTries
+	}
+	return opts
+}
+
 func (m *recoverModeStateMachine) diskOpts() *disks.Options {
 	if m.isEncryptedDev {
 		return &disks.Options{
@@ -541,7 +626,11 @@ func (m *recoverModeStateMachine) setUnlockStateWithRunKey(partName string, unlo
 		if unlockRes.IsEncrypted {
 			// if we know the device is decrypted we must also always know at
 			// least the partDevice (which is the encrypted block device)
-			m.degradedState.LogErrorf("cannot unlock encrypted %s (device %s) with sealed run key: %v", partName, part.partDevice, err)
+			what := "sealed run key"
+			if m.usePassphrase() {
+				what = "passphrase"
+			}
+			m.degradedState.LogErrorf("cannot unlock encrypted %s (device %s) with %s: %v", partName, part.partDevice, what, err)
 			part.UnlockState = partitionErrUnlocking
 		} else {
 			// TODO: we don't know if this is a plain not found or  a different error
@@ -555,6 +644,9 @@ func (m *recoverModeStateMachine) setUnlockStateWithRunKey(partName string, unlo
 		// unlocked successfully
 		part.UnlockState = partitionUnlocked
 		part.UnlockKey = keyRun
+		if unlockRes.UnlockMethod == secboot.UnlockedWithPassphrase {
+			part.UnlockKey = keyPassphrase
+		}
 	}
 
 	return nil
@@ -652,6 +744,8 @@ func (m *recoverModeStateMachine) setUnlockStateWithFallbackKey(partName string,
 			part.UnlockKey = keyFallback
 		case secboot.UnlockedWithRecoveryKey:
 			part.UnlockKey = keyRecovery
+		case secboot.UnlockedWithPassphrase:
+			part.UnlockKey = keyPassphrase
 
 			// TODO: should we fail with internal error for default case here?
 		}
@@ -793,13 +887,23 @@ func (m *recoverModeStateMachine) mountBoot() (stateFunc, error) {
 // - failed to find data at all -> try to unlock save
 // - unlocked data with run key -> mount data
 func (m *recoverModeStateMachine) unlockDataRunKey() (stateFunc, error) {
-	runModeKey := filepath.Join(boot.InitramfsBootEncryptionKeyDir, "ubuntu-data.sealed-key")
-	unlockOpts := &secboot.UnlockVolumeUsingSealedKeyOptions{
+	var unlockRes secboot.UnlockResult
+	var unlockErr error
+	if m.usePassphrase() {
+		// there is no sealed run key, ask for the passphrase instead
+		unlockOpts := &secboot.UnlockVolumeUsingPassphraseOptions{
+			Tries: userAuthTries,
+			// the recovery key is asked for in the fallback state
+			AllowRecoveryKey: false,
+		}
+		unlockRes, unlockErr = secbootUnlockEncryptedVolumeUsingPassphrase(m.disk, "ubuntu-data", unlockOpts)
+	} else {
+		runModeKey := filepath.Join(boot.InitramfsBootEncryptionKeyDir, "ubuntu-data.sealed-key")
 		// don't allow using the recovery key to unlock, we only try using the
 		// recovery key after we first try the fallback object
-		AllowRecoveryKey: false,
+		unlockOpts := m.sealedKeyOptions(false)
+		unlockRes, unlockErr = secbootUnlockVolumeUsingSealedKeyIfEncrypted(m.disk, "ubuntu-data", runModeKey, unlockOpts)
 	}
-	unlockRes, unlockErr := secbootUnlockVolumeUsingSealedKeyIfEncrypted(m.disk, "ubuntu-data", runModeKey, unlockOpts)
 	if err := m.setUnlockStateWithRunKey("ubuntu-data", unlockRes, unlockErr); err != nil {
 		return nil, err
 	}
@@ -828,12 +932,11 @@ func (m *recoverModeStateMachine) unlockDataRunKey() (stateFunc, error) {
 func (m *recoverModeStateMachine) unlockDataFallbackKey() (stateFunc, error) {
 	// try to unlock data with the fallback key on ubuntu-seed, which must have
 	// been mounted at this point
-	unlockOpts := &secboot.UnlockVolumeUsingSealedKeyOptions{
-		// we want to allow using the recovery key if the fallback key fails as
-		// using the fallback object is the last chance before we give up trying
-		// to unlock data
-		AllowRecoveryKey: true,
-	}
+	// we want to allow using the recovery key if the fallback key fails as
+	// using the fallback object is the last chance before we give up trying
+	// to unlock data, with a passphrase there is no fallback key and the
+	// recovery key is asked for directly
+	unlockOpts := m.sealedKeyOptions(true)
 	// TODO: this prompts for a recovery key
 	// TODO: we should somehow customize the prompt to mention what key we need
 	// the user to enter, and what we are unlocking (as currently the prompt
@@ -908,21 +1011,31 @@ func (m *recoverModeStateMachine) unlockSaveFallbackKey() (stateFunc, error) {
 	// save
 	assumeEncrypted := m.isEncryptedDev
 
-	// try to unlock save with the fallback key on ubuntu-seed, which must have
-	// been mounted at this point
-	unlockOpts := &secboot.UnlockVolumeUsingSealedKeyOptions{
-		// we want to allow using the recovery key if the fallback key fails as
-		// using the fallback object is the last chance before we give up trying
-		// to unlock save
-		AllowRecoveryKey: true,
+	var unlockRes secboot.UnlockResult
+	var unlockErr error
+	if m.usePassphrase() {
+		// ubuntu-save has the passphrase too, with the recovery key
+		// as the last chance
+		unlockOpts := &secboot.UnlockVolumeUsingPassphraseOptions{
+			Tries:            userAuthTries,
+			AllowRecoveryKey: true,
+		}
+		unlockRes, unlockErr = secbootUnlockEncryptedVolumeUsingPassphrase(m.disk, "ubuntu-save", unlockOpts)
+	} else {
+		// try to unlock save with the fallback key on ubuntu-seed, which
+		// must have been mounted at this point
+		// we want to allow using the recovery key if the fallback key fails
+		// as using the fallback object is the last chance before we give up
+		// trying to unlock save
+		unlockOpts := m.sealedKeyOptions(true)
+		saveFallbackKey := filepath.Join(boot.InitramfsSeedEncryptionKeyDir, "ubuntu-save.recovery.sealed-key")
+		// TODO: this prompts again for a recover key, but really this is the
+		// reinstall key we will prompt for
+		// TODO: we should somehow customize the prompt to mention what key we need
+		// the user to enter, and what we are unlocking (as currently the prompt
+		// says "recovery key" and the partition UUID for what is being unlocked)
+		unlockRes, unlockErr = secbootUnlockVolumeUsingSealedKeyIfEncrypted(m.disk, "ubuntu-save", saveFallbackKey, unlockOpts)
 	}
-	saveFallbackKey := filepath.Join(boot.InitramfsSeedEncryptionKeyDir, "ubuntu-save.recovery.sealed-key")
-	// TODO: this prompts again for a recover key, but really this is the
-	// reinstall key we will prompt for
-	// TODO: we should somehow customize the prompt to mention what key we need
-	// the user to enter, and what we are unlocking (as currently the prompt
-	// says "recovery key" and the partition UUID for what is being unlocked)
-	unlockRes, unlockErr := secbootUnlockVolumeUsingSealedKeyIfEncrypted(m.disk, "ubuntu-save", saveFallbackKey, unlockOpts)
 	const partitionOptionalIfUnencrypted = true
 	if err := m.setUnlockStateWithFallbackKey("ubuntu-save", unlockRes, unlockErr, partitionOptionalIfUnencrypted); err != nil {
 		return nil, err
@@ -958,6 +1071,11 @@ func (m *recoverModeStateMachine) mountSave() (stateFunc, error) {
 func generateMountsModeRecover(mst *initramfsMountsState) error {
 	// steps 1 and 2 are shared with install mode
 	model, err := generateMountsCommonInstallRecover(mst)
+	// a candidate recovery system is being tried, the seed partition is
+	// mounted at this point unless things went really wrong
+	if trying, tryErr := boot.InitramfsIsTryingRecoverySystem(mst.recoverySystem); tryErr == nil && trying {
+		return finishTryRecoverySystem(mst.recoverySystem, err)
+	}
 	if err != nil {
 		return err
 	}
@@ -1066,6 +1184,21 @@ func generateMountsModeRecover(mst *initramfsMountsState) error {
 	return nil
 }
 
+// finishTryRecoverySystem records the outcome of trying out the recovery
+// system based on whether its seed could be loaded and the essential snaps
+// mounted, and reboots back to run mode where snapd picks up the outcome.
+func finishTryRecoverySystem(recoverySystem string, mountErr error) error {
+	outcome := boot.TryRecoverySystemOutcomeSuccess
+	if mountErr != nil {
+		logger.Noticef("cannot boot into candidate recovery system %q: %v", recoverySystem, mountErr)
+		outcome = boot.TryRecoverySystemOutcomeFailure
+	}
+	if err := boot.EnsureNextBootToRunModeWithTryRecoverySystemOutcome(outcome); err != nil {
+		return err
+	}
+	return boot.InitramfsReboot()
+}
+
 // checkDataAndSavaPairing make sure that ubuntu-data and ubuntu-save
 // come from the same install by comparing secret markers in them
 func checkDataAndSavaPairing(rootdir string) (bool, error) {
@@ -1291,11 +1424,32 @@ func generateMountsModeRun(mst *initramfsMountsState) error {
 	// and we continue booting only for expected models
 
 	// 3.2. mount Data
-	runModeKey := filepath.Join(boot.InitramfsBootEncryptionKeyDir, "ubuntu-data.sealed-key")
-	opts := &secboot.UnlockVolumeUsingSealedKeyOptions{
-		AllowRecoveryKey: true,
+	// the unverified model is only used to decide how to ask the user
+	// for the PIN or passphrase, the sealed keys and the keyslots of the
+	// encrypted partitions enforce them
+	protection := asserts.StorageProtectionNone
+	if model, err := mst.UnverifiedBootModel(); err == nil {
+		protection = model.StorageProtection()
+	} else {
+		logger.Noticef("cannot read the boot model, assuming no storage protection: %v", err)
+	}
+	var unlockRes secboot.UnlockResult
+	if protection == asserts.StorageProtectionPassphrase {
+		opts := &secboot.UnlockVolumeUsingPassphraseOptions{
+			Tries:            userAuthTries,
+			AllowRecoveryKey: true,
+		}
+		unlockRes, err = secbootUnlockEncryptedVolumeUsingPassphrase(disk, "ubuntu-data", opts)
+	} else {
+		runModeKey := filepath.Join(boot.InitramfsBootEncryptionKeyDir, "ubuntu-data.sealed-key")
+		opts := &secboot.UnlockVolumeUsingSealedKeyOptions{
+			AllowRecoveryKey: true,
+		}
+		if protection == asserts.StorageProtectionTPMPIN {
+			opts.PINTries = userAuthTries
+		}
+		unlockRes, err = secbootUnlockVolumeUsingSealedKeyIfEncrypted(disk, "ubuntu-data", runModeKey, opts)
 	}
-	unlockRes, err := secbootUnlockVolumeUsingSealedKeyIfEncrypted(disk, "ubuntu-data", runModeKey, opts)
 	if err != nil {
 		return err
 	}
@@ -45,6 +45,9 @@ func init() {
 	secbootUnlockEncryptedVolumeUsingKey = func(disk disks.Disk, name string, key []byte) (secboot.UnlockResult, error) {
 		return secboot.UnlockResult{}, errNotImplemented
 	}
+	secbootUnlockEncryptedVolumeUsingPassphrase = func(disk disks.Disk, name string, opts *secboot.UnlockVolumeUsingPassphraseOptions) (secboot.UnlockResult, error) {
+		return secboot.UnlockResult{}, errNotImplemented
+	}
 
 	secbootLockSealedKeys = func() error {
 		return errNotImplemented
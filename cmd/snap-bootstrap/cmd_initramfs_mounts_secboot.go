@@ -29,5 +29,6 @@ func init() {
 	secbootMeasureSnapModelWhenPossible = secboot.MeasureSnapModelWhenPossible
 	secbootUnlockVolumeUsingSealedKeyIfEncrypted = secboot.UnlockVolumeUsingSealedKeyIfEncrypted
 	secbootUnlockEncryptedVolumeUsingKey = secboot.UnlockEncryptedVolumeUsingKey
+	secbootUnlockEncryptedVolumeUsingPassphrase = secboot.UnlockEncryptedVolumeUsingPassphrase
 	secbootLockSealedKeys = secboot.LockSealedKeys
 }
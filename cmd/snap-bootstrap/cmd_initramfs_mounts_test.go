@@ -63,6 +63,7 @@ type initramfsMountsSuite struct {
 	seedDir  string
 	sysLabel string
 	model    *asserts.Model
+	brands   *assertstest.SigningAccounts
 	tmpDir   string
 
 	kernel   snap.PlaceInfo
@@ -149,6 +150,8 @@ func (s *initramfsMountsSuite) setupSeed(c *C, gadgetSnapFiles [][]string) {
 	seed20.MakeAssertedSnap(c, "name: pc-kernel\nversion: 1\ntype: kernel", nil, snap.R(1), "canonical", seed20.StoreSigning.Database)
 	seed20.MakeAssertedSnap(c, "name: core20\nversion: 1\ntype: base", nil, snap.R(1), "canonical", seed20.StoreSigning.Database)
 
+	s.brands = seed20.Brands
+
 	s.sysLabel = "20191118"
 	s.model = seed20.MakeSeed(c, s.sysLabel, "my-brand", "my-model", map[string]interface{}{
 		"display-name": "my model",
@@ -459,6 +462,101 @@ recovery_system=20191118
 	c.Check(sealedKeysLocked, Equals, true)
 }
 
+func (s *initramfsMountsSuite) testInitramfsMountsFactoryResetMode(c *C, disk *disks.MockDiskMapping, unlockRes secboot.UnlockResult, unlockErr error, extraMounts ...systemdMount) error {
+	s.mockProcCmdlineContent(c, "snapd_recovery_mode=factory-reset snapd_recovery_system="+s.sysLabel)
+
+	restore := disks.MockMountPointDisksToPartitionMapping(
+		map[disks.Mountpoint]*disks.MockDiskMapping{
+			{Mountpoint: boot.InitramfsUbuntuSeedDir}: disk,
+		},
+	)
+	defer restore()
+
+	saveUnlocked := 0
+	restore = main.MockSecbootUnlockVolumeUsingSealedKeyIfEncrypted(func(disk disks.Disk, name string, sealedEncryptionKeyFile string, opts *secboot.UnlockVolumeUsingSealedKeyOptions) (secboot.UnlockResult, error) {
+		c.Check(name, Equals, "ubuntu-save")
+		c.Check(sealedEncryptionKeyFile, Equals, filepath.Join(s.tmpDir, "run/mnt/ubuntu-seed/device/fde/ubuntu-save.recovery.sealed-key"))
+		c.Check(opts, DeepEquals, &secboot.UnlockVolumeUsingSealedKeyOptions{
+			AllowRecoveryKey: true,
+		})
+		saveUnlocked++
+		return unlockRes, unlockErr
+	})
+	defer restore()
+
+	restore = s.mockSystemdMountSequence(c, append([]systemdMount{
+		ubuntuLabelMount("ubuntu-seed", "factory-reset"),
+		s.makeSeedSnapSystemdMount(snap.TypeSnapd),
+		s.makeSeedSnapSystemdMount(snap.TypeKernel),
+		s.makeSeedSnapSystemdMount(snap.TypeBase),
+		{
+			"tmpfs",
+			boot.InitramfsDataDir,
+			tmpfsMountOpts,
+		},
+	}, extraMounts...), nil)
+	defer restore()
+
+	_, err := main.Parser().ParseArgs([]string{"initramfs-mounts"})
+	c.Check(saveUnlocked, Equals, 1)
+	return err
+}
+
+func (s *initramfsMountsSuite) TestInitramfsMountsFactoryResetModeHappyEncrypted(c *C) {
+	err := s.testInitramfsMountsFactoryResetMode(c, defaultEncBootDisk,
+		happyUnlocked("ubuntu-save", secboot.UnlockedWithSealedKey), nil,
+		systemdMount{
+			"/dev/mapper/ubuntu-save-random",
+			boot.InitramfsUbuntuSaveDir,
+			nil,
+		})
+	c.Assert(err, IsNil)
+
+	modeEnv := dirs.SnapModeenvFileUnder(boot.InitramfsWritableDir)
+	c.Check(modeEnv, testutil.FileEquals, `mode=factory-reset
+recovery_system=20191118
+`)
+}
+
+func (s *initramfsMountsSuite) TestInitramfsMountsFactoryResetModeHappyUnencrypted(c *C) {
+	err := s.testInitramfsMountsFactoryResetMode(c, defaultBootWithSaveDisk,
+		secboot.UnlockResult{
+			PartDevice: "/dev/disk/by-partuuid/ubuntu-save-partuuid",
+			FsDevice:   "/dev/disk/by-partuuid/ubuntu-save-partuuid",
+		}, nil,
+		systemdMount{
+			"/dev/disk/by-partuuid/ubuntu-save-partuuid",
+			boot.InitramfsUbuntuSaveDir,
+			nil,
+		})
+	c.Assert(err, IsNil)
+
+	modeEnv := dirs.SnapModeenvFileUnder(boot.InitramfsWritableDir)
+	c.Check(modeEnv, testutil.FileEquals, `mode=factory-reset
+recovery_system=20191118
+`)
+}
+
+func (s *initramfsMountsSuite) TestInitramfsMountsFactoryResetModeUnencryptedNoSave(c *C) {
+	err := s.testInitramfsMountsFactoryResetMode(c, defaultBootDisk,
+		secboot.UnlockResult{}, fmt.Errorf(`error enumerating partitions for disk to find unencrypted device "ubuntu-save": filesystem label "ubuntu-save" not found`))
+	c.Assert(err, IsNil)
+
+	modeEnv := dirs.SnapModeenvFileUnder(boot.InitramfsWritableDir)
+	c.Check(modeEnv, testutil.FileEquals, `mode=factory-reset
+recovery_system=20191118
+`)
+}
+
+func (s *initramfsMountsSuite) TestInitramfsMountsFactoryResetModeEncryptedSaveUnlockError(c *C) {
+	err := s.testInitramfsMountsFactoryResetMode(c, defaultEncBootDisk,
+		foundEncrypted("ubuntu-save"), fmt.Errorf("failed to unlock ubuntu-save with fallback object"))
+	c.Assert(err, ErrorMatches, "cannot unlock ubuntu-save: failed to unlock ubuntu-save with fallback object")
+
+	modeEnv := dirs.SnapModeenvFileUnder(boot.InitramfsWritableDir)
+	c.Check(modeEnv, testutil.FileAbsent)
+}
+
 func (s *initramfsMountsSuite) TestInitramfsMountsInstallModeGadgetDefaultsHappy(c *C) {
 	// setup a seed with default gadget yaml
 	const gadgetYamlDefaults = `
@@ -1675,6 +1773,145 @@ func (s *initramfsMountsSuite) TestInitramfsMountsRunModeEncryptedDataHappy(c *C
 	c.Assert(filepath.Join(dirs.SnapBootstrapRunDir, "run-model-measured"), testutil.FilePresent)
 }
 
+func (s *initramfsMountsSuite) testInitramfsMountsRunModeEncryptedStorageProtection(c *C, protection string) {
+	s.mockProcCmdlineContent(c, "snapd_recovery_mode=run")
+
+	restore := disks.MockMountPointDisksToPartitionMapping(
+		map[disks.Mountpoint]*disks.MockDiskMapping{
+			{Mountpoint: boot.InitramfsUbuntuBootDir}:                          defaultEncBootDisk,
+			{Mountpoint: boot.InitramfsDataDir, IsDecryptedDevice: true}:       defaultEncBootDisk,
+			{Mountpoint: boot.InitramfsUbuntuSaveDir, IsDecryptedDevice: true}: defaultEncBootDisk,
+		},
+	)
+	defer restore()
+
+	restore = s.mockSystemdMountSequence(c, []systemdMount{
+		ubuntuLabelMount("ubuntu-boot", "run"),
+		ubuntuPartUUIDMount("ubuntu-seed-partuuid", "run"),
+		{
+			"/dev/mapper/ubuntu-data-random",
+			boot.InitramfsDataDir,
+			needsFsckDiskMountOpts,
+		},
+		{
+			"/dev/mapper/ubuntu-save-random",
+			boot.InitramfsUbuntuSaveDir,
+			needsFsckDiskMountOpts,
+		},
+		s.makeRunSnapSystemdMount(snap.TypeBase, s.core20),
+		s.makeRunSnapSystemdMount(snap.TypeKernel, s.kernel),
+	}, nil)
+	defer restore()
+
+	// write the installed model like makebootable does it
+	model := s.brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name":       "my model",
+		"architecture":       "amd64",
+		"base":               "core20",
+		"storage-safety":     "encrypted",
+		"storage-protection": protection,
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              s.model.EssentialSnaps()[0].SnapID,
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc",
+				"id":              s.model.EssentialSnaps()[1].SnapID,
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+	})
+	err := os.MkdirAll(filepath.Join(boot.InitramfsUbuntuBootDir, "device"), 0755)
+	c.Assert(err, IsNil)
+	mf, err := os.Create(filepath.Join(boot.InitramfsUbuntuBootDir, "device/model"))
+	c.Assert(err, IsNil)
+	defer mf.Close()
+	err = asserts.NewEncoder(mf).Encode(model)
+	c.Assert(err, IsNil)
+
+	dataActivated := false
+	restore = main.MockSecbootUnlockVolumeUsingSealedKeyIfEncrypted(func(disk disks.Disk, name string, sealedEncryptionKeyFile string, opts *secboot.UnlockVolumeUsingSealedKeyOptions) (secboot.UnlockResult, error) {
+		c.Assert(protection, Equals, "tpm+pin")
+		c.Assert(name, Equals, "ubuntu-data")
+		c.Assert(sealedEncryptionKeyFile, Equals, filepath.Join(s.tmpDir, "run/mnt/ubuntu-boot/device/fde/ubuntu-data.sealed-key"))
+		c.Assert(opts, DeepEquals, &secboot.UnlockVolumeUsingSealedKeyOptions{
+			AllowRecoveryKey: true,
+			PINTries:         3,
+		})
+
+		dataActivated = true
+		return happyUnlocked("ubuntu-data", secboot.UnlockedWithSealedKey), nil
+	})
+	defer restore()
+
+	restore = main.MockSecbootUnlockEncryptedVolumeUsingPassphrase(func(disk disks.Disk, name string, opts *secboot.UnlockVolumeUsingPassphraseOptions) (secboot.UnlockResult, error) {
+		c.Assert(protection, Equals, "passphrase")
+		c.Assert(name, Equals, "ubuntu-data")
+		c.Assert(opts, DeepEquals, &secboot.UnlockVolumeUsingPassphraseOptions{
+			Tries:            3,
+			AllowRecoveryKey: true,
+		})
+
+		dataActivated = true
+		return happyUnlocked("ubuntu-data", secboot.UnlockedWithPassphrase), nil
+	})
+	defer restore()
+
+	s.mockUbuntuSaveKeyAndMarker(c, boot.InitramfsWritableDir, "foo", "marker")
+	s.mockUbuntuSaveMarker(c, boot.InitramfsUbuntuSaveDir, "marker")
+
+	saveActivated := false
+	restore = main.MockSecbootUnlockEncryptedVolumeUsingKey(func(disk disks.Disk, name string, key []byte) (secboot.UnlockResult, error) {
+		c.Check(dataActivated, Equals, true, Commentf("ubuntu-data not activated yet"))
+		saveActivated = true
+		c.Assert(name, Equals, "ubuntu-save")
+		c.Assert(key, DeepEquals, []byte("foo"))
+		return happyUnlocked("ubuntu-save", secboot.UnlockedWithKey), nil
+	})
+	defer restore()
+
+	restore = main.MockSecbootMeasureSnapSystemEpochWhenPossible(func() error { return nil })
+	defer restore()
+	restore = main.MockSecbootMeasureSnapModelWhenPossible(func(findModel func() (*asserts.Model, error)) error { return nil })
+	defer restore()
+
+	// mock a bootloader
+	bloader := boottest.MockUC20RunBootenv(bootloadertest.Mock("mock", c.MkDir()))
+	bootloader.Force(bloader)
+	defer bootloader.Force(nil)
+
+	// set the current kernel
+	restore = bloader.SetEnabledKernel(s.kernel)
+	defer restore()
+
+	makeSnapFilesOnEarlyBootUbuntuData(c, s.kernel, s.core20)
+
+	// write modeenv
+	modeEnv := boot.Modeenv{
+		Mode:           "run",
+		Base:           s.core20.Filename(),
+		CurrentKernels: []string{s.kernel.Filename()},
+	}
+	err = modeEnv.WriteTo(boot.InitramfsWritableDir)
+	c.Assert(err, IsNil)
+
+	_, err = main.Parser().ParseArgs([]string{"initramfs-mounts"})
+	c.Assert(err, IsNil)
+	c.Check(dataActivated, Equals, true)
+	c.Check(saveActivated, Equals, true)
+}
+
+func (s *initramfsMountsSuite) TestInitramfsMountsRunModeEncryptedDataPassphrase(c *C) {
+	s.testInitramfsMountsRunModeEncryptedStorageProtection(c, "passphrase")
+}
+
+func (s *initramfsMountsSuite) TestInitramfsMountsRunModeEncryptedDataTPMAndPIN(c *C) {
+	s.testInitramfsMountsRunModeEncryptedStorageProtection(c, "tpm+pin")
+}
+
 func (s *initramfsMountsSuite) TestInitramfsMountsRunModeEncryptedDataUnhappyNoSave(c *C) {
 	s.mockProcCmdlineContent(c, "snapd_recovery_mode=run")
 
@@ -2401,6 +2638,93 @@ func (s *initramfsMountsSuite) TestInitramfsMountsRecoverModeHappy(c *C) {
 	c.Assert(filepath.Join(dirs.SnapBootstrapRunDir, "degraded.json"), testutil.FileAbsent)
 }
 
+func (s *initramfsMountsSuite) TestInitramfsMountsTryRecoverySystemHappy(c *C) {
+	s.mockProcCmdlineContent(c, "snapd_recovery_mode=recover snapd_recovery_system="+s.sysLabel)
+
+	bloader := bootloadertest.Mock("mock", c.MkDir())
+	bootloader.Force(bloader)
+	defer bootloader.Force(nil)
+	bloader.BootVars = map[string]string{
+		"try_recovery_system":    s.sysLabel,
+		"recovery_system_status": "try",
+		"snapd_recovery_system":  s.sysLabel,
+		"snapd_recovery_mode":    "recover",
+	}
+
+	rebootCalls := 0
+	restore := boot.MockInitramfsReboot(func() error {
+		rebootCalls++
+		return nil
+	})
+	defer restore()
+
+	// the host ubuntu-data is not mounted when trying out the system
+	restore = s.mockSystemdMountSequence(c, []systemdMount{
+		ubuntuLabelMount("ubuntu-seed", "recover"),
+		s.makeSeedSnapSystemdMount(snap.TypeSnapd),
+		s.makeSeedSnapSystemdMount(snap.TypeKernel),
+		s.makeSeedSnapSystemdMount(snap.TypeBase),
+		{
+			"tmpfs",
+			boot.InitramfsDataDir,
+			tmpfsMountOpts,
+		},
+	}, nil)
+	defer restore()
+
+	_, err := main.Parser().ParseArgs([]string{"initramfs-mounts"})
+	c.Assert(err, IsNil)
+
+	c.Check(rebootCalls, Equals, 1)
+	c.Check(bloader.BootVars, DeepEquals, map[string]string{
+		"try_recovery_system":    s.sysLabel,
+		"recovery_system_status": "tried",
+		"snapd_recovery_system":  s.sysLabel,
+		"snapd_recovery_mode":    "run",
+	})
+	// recover mode was not set up
+	c.Check(filepath.Join(boot.InitramfsWritableDir, "var/lib/snapd/modeenv"), testutil.FileAbsent)
+}
+
+func (s *initramfsMountsSuite) TestInitramfsMountsTryRecoverySystemBroken(c *C) {
+	// the candidate system cannot be loaded
+	s.mockProcCmdlineContent(c, "snapd_recovery_mode=recover snapd_recovery_system=1234")
+
+	bloader := bootloadertest.Mock("mock", c.MkDir())
+	bootloader.Force(bloader)
+	defer bootloader.Force(nil)
+	bloader.BootVars = map[string]string{
+		"try_recovery_system":    "1234",
+		"recovery_system_status": "try",
+		"snapd_recovery_system":  "1234",
+		"snapd_recovery_mode":    "recover",
+	}
+
+	rebootCalls := 0
+	restore := boot.MockInitramfsReboot(func() error {
+		rebootCalls++
+		return nil
+	})
+	defer restore()
+
+	restore = s.mockSystemdMountSequence(c, []systemdMount{
+		ubuntuLabelMount("ubuntu-seed", "recover"),
+	}, nil)
+	defer restore()
+
+	_, err := main.Parser().ParseArgs([]string{"initramfs-mounts"})
+	c.Assert(err, IsNil)
+
+	c.Check(rebootCalls, Equals, 1)
+	// the outcome is left as a failure for snapd to pick up
+	c.Check(bloader.BootVars, DeepEquals, map[string]string{
+		"try_recovery_system":    "1234",
+		"recovery_system_status": "try",
+		"snapd_recovery_system":  "1234",
+		"snapd_recovery_mode":    "run",
+	})
+}
+
 func (s *initramfsMountsSuite) TestInitramfsMountsRecoverModeGadgetDefaultsHappy(c *C) {
 	// setup a seed with default gadget yaml
 	const gadgetYamlDefaults = `
@@ -106,6 +106,14 @@ func MockSecbootUnlockEncryptedVolumeUsingKey(f func(disk disks.Disk, name strin
 	}
 }
 
+func MockSecbootUnlockEncryptedVolumeUsingPassphrase(f func(disk disks.Disk, name string, opts *secboot.UnlockVolumeUsingPassphraseOptions) (secboot.UnlockResult, error)) (restore func()) {
+	old := secbootUnlockEncryptedVolumeUsingPassphrase
+	secbootUnlockEncryptedVolumeUsingPassphrase = f
+	return func() {
+		secbootUnlockEncryptedVolumeUsingPassphrase = old
+	}
+}
+
 func MockSecbootMeasureSnapSystemEpochWhenPossible(f func() error) (restore func()) {
 	old := secbootMeasureSnapSystemEpochWhenPossible
 	secbootMeasureSnapSystemEpochWhenPossible = f
@@ -57,10 +57,11 @@ func (mst *initramfsMountsState) ReadEssential(recoverySystem string, essentialT
 }
 
 // UnverifiedBootModel returns the unverified model from the
-// boot partition for run mode. The current and only use case
-// is measuring the model for run mode. Otherwise no decisions
-// should be based on an unverified model. Note that the model
-// is verified at the time the key auth policy is computed.
+// boot partition for run mode. The use cases are measuring the
+// model for run mode and choosing how to prompt for the PIN or
+// passphrase protecting the encrypted storage. Otherwise no
+// decisions should be based on an unverified model. Note that the
+// model is verified at the time the key auth policy is computed.
 func (mst *initramfsMountsState) UnverifiedBootModel() (*asserts.Model, error) {
 	if mst.mode != "run" {
 		return nil, fmt.Errorf("internal error: unverified boot model access is for limited run mode use")
@@ -20,12 +20,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"sort"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/strutil"
 
 	"github.com/jessevdk/go-flags"
 )
@@ -34,6 +36,9 @@ var shortChangesHelp = i18n.G("List system changes")
 var shortTasksHelp = i18n.G("List a change's tasks")
 var longChangesHelp = i18n.G(`
 The changes command displays a summary of system changes performed recently.
+
+With --follow, the changes command keeps displaying the updates to the status
+of changes as they happen.
 `)
 var longTasksHelp = i18n.G(`
 The tasks command displays a summary of tasks associated with an individual
@@ -43,6 +48,7 @@ change.
 type cmdChanges struct {
 	clientMixin
 	timeMixin
+	Follow     bool `long:"follow"`
 	Positional struct {
 		Snap string `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -55,7 +61,10 @@ type cmdTasks struct {
 
 func init() {
 	addCommand("changes", shortChangesHelp, longChangesHelp,
-		func() flags.Commander { return &cmdChanges{} }, timeDescs, nil)
+		func() flags.Commander { return &cmdChanges{} }, timeDescs.also(map[string]string{
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"follow": i18n.G("Wait for and display updates to the status of changes"),
+		}), nil)
 	addCommand("tasks", shortTasksHelp, longTasksHelp,
 		func() flags.Commander { return &cmdTasks{} },
 		changeIDMixinOptDesc.also(timeDescs),
@@ -106,7 +115,7 @@ func (c *cmdChanges) Execute(args []string) error {
 		return err
 	}
 
-	if len(changes) == 0 {
+	if len(changes) == 0 && !c.Follow {
 		return fmt.Errorf(i18n.G("no changes found"))
 	}
 
@@ -125,11 +134,36 @@ func (c *cmdChanges) Execute(args []string) error {
 	}
 
 	w.Flush()
+	if c.Follow {
+		return c.followChanges()
+	}
 	fmt.Fprintln(Stdout)
 
 	return nil
 }
 
+// followChanges displays the updates to the status of changes streamed
+// by the daemon, until the stream ends.
+func (c *cmdChanges) followChanges() error {
+	events, err := c.client.Events(context.Background(), &client.EventFilter{
+		Types: []string{client.EventChangeUpdate},
+	})
+	if err != nil {
+		return fmt.Errorf(i18n.G("cannot follow changes: %v"), err)
+	}
+	for ev := range events {
+		if c.Positional.Snap != "" && !strutil.ListContains(ev.SnapNames, c.Positional.Snap) {
+			continue
+		}
+		readyTime := "-"
+		if ev.Ready {
+			readyTime = c.fmtTime(ev.Timestamp)
+		}
+		fmt.Fprintf(Stdout, "%s\t%s\t%s\t%s\n", ev.ChangeID, ev.Status, readyTime, ev.Summary)
+	}
+	return nil
+}
+
 func (c *cmdTasks) Execute([]string) error {
 	chid, err := c.GetChangeID()
 	if err != nil {
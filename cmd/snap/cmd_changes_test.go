@@ -231,3 +231,56 @@ Doing +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +some summary \(50.00%\)
 `)
 	c.Check(s.Stderr(), check.Equals, "")
 }
+
+func (s *SnapSuite) TestChangesFollow(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/changes")
+			c.Check(r.URL.Query().Get("for"), check.Equals, "foo")
+			fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+		case 1:
+			c.Check(r.URL.Path, check.Equals, "/v2/events")
+			c.Check(r.URL.Query().Get("types"), check.Equals, "change-update")
+			w.Header().Set("Content-Type", "application/json-seq")
+			fmt.Fprintln(w, "\x1e"+`{"type": "change-update", "change-id": "1", "status": "Doing", "summary": "Install foo", "snap-names": ["foo"]}`)
+			fmt.Fprintln(w, "\x1e"+`{"type": "change-update", "change-id": "2", "status": "Doing", "summary": "Install bar", "snap-names": ["bar"]}`)
+			fmt.Fprintln(w, "\x1e"+`{"type": "change-update", "timestamp": "2021-03-04T05:06:07Z", "change-id": "1", "status": "Done", "ready": true, "summary": "Install foo", "snap-names": ["foo"]}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--abs-time", "--follow", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(n, check.Equals, 2)
+	c.Check(s.Stdout(), check.Equals, `ID   Status  Spawn  Ready  Summary
+1	Doing	-	Install foo
+1	Done	2021-03-04T05:06:07Z	Install foo
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapSuite) TestChangesFollowNoEvents(c *check.C) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/changes")
+			fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+		case 1:
+			c.Check(r.URL.Path, check.Equals, "/v2/events")
+			w.WriteHeader(404)
+			fmt.Fprintln(w, `{"type": "error", "status-code": 404, "result": {"message": "not found"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"changes", "--follow"})
+	c.Assert(err, check.ErrorMatches, "cannot follow changes: not found")
+}
@@ -0,0 +1,74 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/snap/squashfs"
+)
+
+type cmdDebugCompression struct {
+	clientMixin
+
+	Positional struct {
+		Snap string `positional-arg-name:"<snap>|<file>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func init() {
+	cmd := addDebugCommand("compression",
+		i18n.G("Show the compression of a snap"),
+		i18n.G("Show the compression of an installed snap, or of a snap file if a path is given."),
+		func() flags.Commander {
+			return &cmdDebugCompression{}
+		}, nil, nil)
+	cmd.hidden = true
+}
+
+func (x *cmdDebugCompression) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var compression string
+	if name := x.Positional.Snap; osutil.FileExists(name) {
+		var err error
+		compression, err = squashfs.Compression(name)
+		if err != nil {
+			return err
+		}
+	} else {
+		snap, _, err := x.client.Snap(name)
+		if err != nil {
+			return err
+		}
+		if snap.Compression == "" {
+			return fmt.Errorf(i18n.G("cannot determine the compression of snap %q"), name)
+		}
+		compression = snap.Compression
+	}
+	fmt.Fprintf(Stdout, "%s\n", compression)
+	return nil
+}
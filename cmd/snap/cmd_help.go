@@ -235,7 +235,7 @@ var helpCategories = []helpCategory{
 		Label:       i18n.G("Assertions"),
 		Other:       true,
 		Description: i18n.G("manage assertions"),
-		Commands:    []string{"known", "ack"},
+		Commands:    []string{"known", "ack", "verify"},
 	}, {
 		Label:           i18n.G("Introspection"),
 		Other:           true,
@@ -358,6 +358,13 @@ func (iw *infoWriter) maybePrintInstallDate() {
 	fmt.Fprintf(iw, "refresh-date:\t%s\n", iw.fmtTime(iw.localSnap.InstallDate))
 }
 
+func (iw *infoWriter) maybePrintHold() {
+	if iw.localSnap == nil || iw.localSnap.Hold == nil {
+		return
+	}
+	fmt.Fprintf(iw, "hold:\t%s\n", fmtHold(*iw.localSnap.Hold, iw.fmtTime))
+}
+
 func (iw *infoWriter) maybePrintChinfo() {
 	if iw.diskSnap != nil {
 		return
@@ -453,6 +460,26 @@ func (iw *infoWriter) maybePrintBuildDate() {
 	fmt.Fprintf(iw, "build-date:\t%s\n", iw.fmtTime(buildDate))
 }
 
+func (iw *infoWriter) maybePrintCompression() {
+	if !iw.verbose {
+		return
+	}
+	var compression string
+	switch {
+	case iw.diskSnap != nil:
+		if osutil.IsDirectory(iw.path) {
+			return
+		}
+		compression, _ = squashfs.Compression(iw.path)
+	case iw.localSnap != nil:
+		compression = iw.localSnap.Compression
+	}
+	if compression == "" {
+		return
+	}
+	fmt.Fprintf(iw, "compression:\t%s\n", compression)
+}
+
 func (iw *infoWriter) maybePrintContact() error {
 	contact := strings.TrimPrefix(iw.theSnap.Contact, "mailto:")
 	if contact == "" {
@@ -746,10 +773,12 @@ func (x *infoCmd) Execute([]string) error {
 		iw.maybePrintType()
 		iw.maybePrintBase()
 		iw.maybePrintSum()
+		iw.maybePrintCompression()
 		iw.maybePrintID()
 		iw.maybePrintCohortKey()
 		iw.maybePrintTrackingChannel()
 		iw.maybePrintInstallDate()
+		iw.maybePrintHold()
 		iw.maybePrintChinfo()
 	}
 	w.Flush()
@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"path/filepath"
 	"time"
@@ -332,6 +333,72 @@ func (s *infoSuite) TestMaybePrintSum(c *check.C) {
 	c.Check(buf.String(), check.Equals, "")
 }
 
+func (s *infoSuite) TestMaybePrintCompression(c *check.C) {
+	var buf flushBuffer
+	// a squashfs superblock using zstd
+	superblock := make([]byte, 96)
+	copy(superblock, "hsqs")
+	superblock[20] = 6
+	dir := c.MkDir()
+	filename := filepath.Join(c.MkDir(), "foo.snap")
+	c.Assert(ioutil.WriteFile(filename, superblock, 0644), check.IsNil)
+	iw := snap.NewInfoWriter(&buf)
+	snap.SetVerbose(iw, true)
+
+	// no snap -> no compression
+	snap.MaybePrintCompression(iw)
+	c.Check(buf.String(), check.Equals, "")
+
+	// path is directory -> no compression
+	buf.Reset()
+	snap.SetupDiskSnap(iw, dir, &client.Snap{})
+	snap.MaybePrintCompression(iw)
+	c.Check(buf.String(), check.Equals, "")
+
+	// disk snap -> read from the superblock
+	buf.Reset()
+	snap.SetupDiskSnap(iw, filename, &client.Snap{})
+	snap.MaybePrintCompression(iw)
+	c.Check(buf.String(), check.Equals, "compression:\tzstd\n")
+
+	// local snap -> as reported by snapd
+	buf.Reset()
+	snap.SetupSnap(iw, &client.Snap{Compression: "lz4"}, nil, nil)
+	snap.MaybePrintCompression(iw)
+	c.Check(buf.String(), check.Equals, "compression:\tlz4\n")
+
+	// not verbose -> no compression
+	buf.Reset()
+	snap.SetVerbose(iw, false)
+	snap.MaybePrintCompression(iw)
+	c.Check(buf.String(), check.Equals, "")
+}
+
+func (s *infoSuite) TestMaybePrintHold(c *check.C) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	defer snap.MockTimeNow(func() time.Time { return now })()
+
+	var buf flushBuffer
+	iw := snap.NewInfoWriter(&buf)
+
+	// no hold
+	snap.SetupSnap(iw, &client.Snap{}, nil, nil)
+	snap.MaybePrintHold(iw)
+	c.Check(buf.String(), check.Equals, "")
+
+	buf.Reset()
+	until := now.Add(3 * time.Hour)
+	snap.SetupSnap(iw, &client.Snap{Hold: &until}, nil, nil)
+	snap.MaybePrintHold(iw)
+	c.Check(buf.String(), check.Equals, "hold:\t1:00PM\n")
+
+	buf.Reset()
+	forever := now.Add(time.Duration(math.MaxInt64))
+	snap.SetupSnap(iw, &client.Snap{Hold: &forever}, nil, nil)
+	snap.MaybePrintHold(iw)
+	c.Check(buf.String(), check.Equals, "hold:\tforever\n")
+}
+
 func (s *infoSuite) TestMaybePrintContact(c *check.C) {
 	var buf flushBuffer
 	iw := snap.NewInfoWriter(&buf)
@@ -36,10 +36,11 @@ import (
 )
 
 type packCmd struct {
-	CheckSkeleton bool   `long:"check-skeleton"`
-	Filename      string `long:"filename"`
-	Compression   string `long:"compression" hidden:"yes"`
-	Positional    struct {
+	CheckSkeleton    bool   `long:"check-skeleton"`
+	Filename         string `long:"filename"`
+	Compression      string `long:"compression"`
+	CompressionLevel int    `long:"compression-level"`
+	Positional       struct {
 		SnapDir   string `positional-arg-name:"<snap-dir>"`
 		TargetDir string `positional-arg-name:"<target-dir>"`
 	} `positional-args:"yes"`
@@ -76,7 +77,9 @@ func init() {
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"filename": i18n.G("Output to this filename"),
 			// TRANSLATORS: This should not start with a lowercase letter.
-			"compression": i18n.G("Compression to use (e.g. xz)"),
+			"compression": i18n.G("Compression to use (xz, lzo, zstd or lz4)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"compression-level": i18n.G("Level of compression to use, for the compressions that support it"),
 		}, nil)
 	cmd.extra = func(cmd *flags.Command) {
 		// TRANSLATORS: this describes the default filename for a snap, e.g. core_16-2.35.2_amd64.snap
@@ -109,9 +112,10 @@ func (x *packCmd) Execute([]string) error {
 	}
 
 	snapPath, err := pack.Snap(x.Positional.SnapDir, &pack.Options{
-		TargetDir:   x.Positional.TargetDir,
-		SnapName:    x.Filename,
-		Compression: x.Compression,
+		TargetDir:        x.Positional.TargetDir,
+		SnapName:         x.Filename,
+		Compression:      x.Compression,
+		CompressionLevel: x.CompressionLevel,
 	})
 	if err != nil {
 		// TRANSLATORS: the %q is the snap-dir (the first positional
@@ -120,7 +120,7 @@ printf "hello world"
 func (s *SnapSuite) TestPackPacksASnapWithCompressionHappy(c *check.C) {
 	snapDir := makeSnapDirForPack(c, "name: hello\nversion: 1.0")
 
-	for _, comp := range []string{"xz", "lzo"} {
+	for _, comp := range []string{"xz", "lzo", "zstd", "lz4"} {
 		_, err := snaprun.Parser(snaprun.Client()).ParseArgs([]string{"pack", "--compression", comp, snapDir, snapDir})
 		c.Assert(err, check.IsNil)
 
@@ -135,8 +135,21 @@ func (s *SnapSuite) TestPackPacksASnapWithCompressionHappy(c *check.C) {
 func (s *SnapSuite) TestPackPacksASnapWithCompressionUnhappy(c *check.C) {
 	snapDir := makeSnapDirForPack(c, "name: hello\nversion: 1.0")
 
-	for _, comp := range []string{"gzip", "zstd", "silly"} {
+	for _, comp := range []string{"gzip", "lzma", "silly"} {
 		_, err := snaprun.Parser(snaprun.Client()).ParseArgs([]string{"pack", "--compression", comp, snapDir, snapDir})
 		c.Assert(err, check.ErrorMatches, fmt.Sprintf(`cannot pack "/.*": cannot use compression %q`, comp))
 	}
 }
+
+func (s *SnapSuite) TestPackPacksASnapWithCompressionLevel(c *check.C) {
+	snapDir := makeSnapDirForPack(c, "name: hello\nversion: 1.0")
+
+	_, err := snaprun.Parser(snaprun.Client()).ParseArgs([]string{"pack", "--compression", "zstd", "--compression-level", "15", snapDir, snapDir})
+	c.Assert(err, check.IsNil)
+	matches, err := filepath.Glob(snapDir + "/hello*.snap")
+	c.Assert(err, check.IsNil)
+	c.Assert(matches, check.HasLen, 1)
+
+	_, err = snaprun.Parser(snaprun.Client()).ParseArgs([]string{"pack", "--compression", "zstd", "--compression-level", "30", snapDir, snapDir})
+	c.Assert(err, check.ErrorMatches, `cannot pack "/.*": cannot use compression level 30 with compression "zstd", expected a level between 1 and 22`)
+}
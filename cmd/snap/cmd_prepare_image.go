@@ -42,6 +42,9 @@ type cmdPrepareImage struct {
 	// TODO: introduce SnapWithChannel?
 	Snaps      []string `long:"snap" value-name:"<snap>[=<channel>]"`
 	ExtraSnaps []string `long:"extra-snaps" hidden:"yes"` // DEPRECATED
+
+	ValidationSets []string `long:"validation-set" value-name:"<account-id>/<name>=<sequence>"`
+	SnapsDir       string   `long:"snaps-dir"`
 }
 
 func init() {
@@ -67,6 +70,10 @@ For preparing classic images it supports a --classic mode`),
 			"extra-snaps": i18n.G("Extra snaps to be installed (DEPRECATED)"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"channel": i18n.G("The channel to use"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"validation-set": i18n.G("Seed snaps at the revisions required by the given validation set"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"snaps-dir": i18n.G("Use the pre-fetched snaps and assertions in the given directory before the store"),
 		}, []argDesc{
 			{
 				// TRANSLATORS: This needs to begin with < and end with >
@@ -116,6 +123,8 @@ func (x *cmdPrepareImage) Execute(args []string) error {
 
 	opts.PrepareDir = x.Positional.TargetDir
 	opts.Classic = x.Classic
+	opts.ValidationSets = x.ValidationSets
+	opts.SnapsDir = x.SnapsDir
 
 	return imagePrepare(opts)
 }
@@ -139,3 +139,24 @@ func (s *SnapPrepareImageSuite) TestPrepareImageExtraSnaps(c *C) {
 		SnapChannels: map[string]string{"bar": "t/edge"},
 	})
 }
+
+func (s *SnapPrepareImageSuite) TestPrepareImageValidationSetsAndSnapsDir(c *C) {
+	var opts *image.Options
+	prep := func(o *image.Options) error {
+		opts = o
+		return nil
+	}
+	r := snap.MockImagePrepare(prep)
+	defer r()
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"prepare-image", "model", "prepare-dir", "--validation-set", "acme/base-set=3", "--validation-set", "acme/apps=1", "--snaps-dir", "pre-fetched"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+
+	c.Check(opts, DeepEquals, &image.Options{
+		ModelFile:      "model",
+		PrepareDir:     "prepare-dir",
+		ValidationSets: []string{"acme/base-set=3", "acme/apps=1"},
+		SnapsDir:       "pre-fetched",
+	})
+}
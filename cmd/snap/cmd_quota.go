@@ -0,0 +1,313 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var shortSetQuotaHelp = i18n.G("Create or update a quota group.")
+var longSetQuotaHelp = i18n.G(`
+The set-quota command updates or creates a quota group with the specified set of
+snaps.
+
+A quota group sets resource limits (currently the maximum memory, the share of
+CPU and the number of tasks) on the set of snaps that belong to it. Snaps can
+be at most in one quota group. Quota groups can be nested, the limits of a
+sub-group must fit within the limits of its parent group.
+
+All snaps provided are appended to the group; to remove a snap from a quota
+group the entire group must be removed with remove-quota and recreated without
+the snap.
+
+When the group already exists only the specified limits are changed, the
+parent of an existing group cannot be changed.
+`)
+
+var shortQuotaHelp = i18n.G("Show quota group for a set of snaps")
+var longQuotaHelp = i18n.G(`
+The quota command shows information about a quota group, including the set of
+snaps and any sub-groups it contains, as well as its resource constraints.
+`)
+
+var shortQuotasHelp = i18n.G("Show quota groups")
+var longQuotasHelp = i18n.G(`
+The quotas command shows all quota groups.
+`)
+
+var shortRemoveQuotaHelp = i18n.G("Remove quota group")
+var longRemoveQuotaHelp = i18n.G(`
+The remove-quota command removes the given quota group.
+
+Currently, only quota groups with no sub-groups can be removed. In order to
+remove a quota group with sub-groups, the sub-groups must first be removed until
+there are no sub-groups for the group, then the group itself can be removed.
+`)
+
+func init() {
+	cmd := addCommand("set-quota", shortSetQuotaHelp, longSetQuotaHelp, func() flags.Commander { return &cmdSetQuota{} }, waitDescs.also(map[string]string{
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"memory": i18n.G("Memory quota, e.g. 500MB"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"cpu": i18n.G("Percentage of a single CPU the group can use, e.g. 50%"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"tasks": i18n.G("Maximum number of tasks (processes and threads) in the group"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		"parent": i18n.G("Parent quota group"),
+	}), nil)
+	// XXX: unhide when the feature is no longer experimental
+	cmd.hidden = true
+
+	cmd = addCommand("quota", shortQuotaHelp, longQuotaHelp, func() flags.Commander { return &cmdQuota{} }, nil, nil)
+	cmd.hidden = true
+
+	cmd = addCommand("quotas", shortQuotasHelp, longQuotasHelp, func() flags.Commander { return &cmdQuotas{} }, nil, nil)
+	cmd.hidden = true
+
+	cmd = addCommand("remove-quota", shortRemoveQuotaHelp, longRemoveQuotaHelp, func() flags.Commander { return &cmdRemoveQuota{} }, waitDescs, nil)
+	cmd.hidden = true
+}
+
+type cmdSetQuota struct {
+	waitMixin
+
+	MemoryMax  string `long:"memory" optional:"true"`
+	CPUMax     string `long:"cpu" optional:"true"`
+	TasksMax   string `long:"tasks" optional:"true"`
+	Parent     string `long:"parent" optional:"true"`
+	Positional struct {
+		GroupName string              `positional-arg-name:"<group-name>" required:"true"`
+		Snaps     []installedSnapName `positional-arg-name:"<snap>" optional:"true"`
+	} `positional-args:"yes"`
+}
+
+// parseCPUQuota parses a percentage of a single CPU, the percent sign is
+// optional.
+func parseCPUQuota(cpu string) (int, error) {
+	v, err := strconv.Atoi(strings.TrimSuffix(cpu, "%"))
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf(i18n.G("cannot parse cpu quota %q: expected a positive percentage"), cpu)
+	}
+	return v, nil
+}
+
+func (x *cmdSetQuota) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return ErrExtraArgs
+	}
+
+	limits := &client.QuotaValues{}
+	if x.MemoryMax != "" {
+		value, err := strutil.ParseByteSize(x.MemoryMax)
+		if err != nil {
+			return err
+		}
+		limits.Memory = quantity.Size(value)
+	}
+	if x.CPUMax != "" {
+		limits.CPU, err = parseCPUQuota(x.CPUMax)
+		if err != nil {
+			return err
+		}
+	}
+	if x.TasksMax != "" {
+		limits.Tasks, err = strconv.Atoi(x.TasksMax)
+		if err != nil || limits.Tasks <= 0 {
+			return fmt.Errorf(i18n.G("cannot parse tasks quota %q: expected a positive number"), x.TasksMax)
+		}
+	}
+
+	names := installedSnapNames(x.Positional.Snaps)
+	chgID, err := x.client.EnsureQuota(x.Positional.GroupName, x.Parent, names, limits)
+	if err != nil {
+		return err
+	}
+
+	if _, err := x.wait(chgID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+type cmdQuota struct {
+	clientMixin
+
+	Positional struct {
+		GroupName string `positional-arg-name:"<group-name>" required:"true"`
+	} `positional-args:"yes"`
+}
+
+func (x *cmdQuota) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return ErrExtraArgs
+	}
+
+	group, err := x.client.GetQuotaGroup(x.Positional.GroupName)
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintf(w, "name:\t%s\n", group.GroupName)
+	if group.Parent != "" {
+		fmt.Fprintf(w, "parent:\t%s\n", group.Parent)
+	}
+
+	fmt.Fprintf(w, "constraints:\n")
+	for _, c := range quotaConstraints(group.Constraints) {
+		fmt.Fprintf(w, "  %s:\t%s\n", c.name, c.value)
+	}
+
+	if len(group.Subgroups) > 0 {
+		fmt.Fprint(w, "subgroups:\n")
+		for _, name := range group.Subgroups {
+			fmt.Fprintf(w, "  - %s\n", name)
+		}
+	}
+	if len(group.Snaps) > 0 {
+		fmt.Fprint(w, "snaps:\n")
+		for _, snapName := range group.Snaps {
+			fmt.Fprintf(w, "  - %s\n", snapName)
+		}
+	}
+
+	return nil
+}
+
+type quotaConstraint struct {
+	name  string
+	value string
+}
+
+func quotaConstraints(values *client.QuotaValues) []quotaConstraint {
+	if values == nil {
+		return nil
+	}
+	var constraints []quotaConstraint
+	if values.Memory != 0 {
+		constraints = append(constraints, quotaConstraint{"memory", strutil.SizeToStr(int64(values.Memory))})
+	}
+	if values.CPU != 0 {
+		constraints = append(constraints, quotaConstraint{"cpu", fmt.Sprintf("%d%%", values.CPU)})
+	}
+	if values.Tasks != 0 {
+		constraints = append(constraints, quotaConstraint{"tasks", strconv.Itoa(values.Tasks)})
+	}
+	return constraints
+}
+
+type cmdRemoveQuota struct {
+	waitMixin
+
+	Positional struct {
+		GroupName string `positional-arg-name:"<group-name>" required:"true"`
+	} `positional-args:"yes"`
+}
+
+func (x *cmdRemoveQuota) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return ErrExtraArgs
+	}
+
+	chgID, err := x.client.RemoveQuotaGroup(x.Positional.GroupName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := x.wait(chgID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+type cmdQuotas struct {
+	clientMixin
+}
+
+func (x *cmdQuotas) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return ErrExtraArgs
+	}
+
+	res, err := x.client.Quotas()
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		fmt.Fprintln(Stderr, i18n.G("No quota groups defined."))
+		return nil
+	}
+
+	w := tabWriter()
+	fmt.Fprintf(w, i18n.G("Quota\tParent\tConstraints\n"))
+
+	// list the groups as a tree, with the sub-groups following their
+	// parents
+	byName := make(map[string]*client.QuotaGroupResult, len(res))
+	var roots []string
+	for _, q := range res {
+		byName[q.GroupName] = q
+		if q.Parent == "" {
+			roots = append(roots, q.GroupName)
+		}
+	}
+	var printGroup func(name string)
+	printGroup = func(name string) {
+		q := byName[name]
+		if q == nil {
+			return
+		}
+		var constraints []string
+		for _, c := range quotaConstraints(q.Constraints) {
+			constraints = append(constraints, c.name+"="+c.value)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", q.GroupName, q.Parent, strings.Join(constraints, ","))
+		subs := append([]string(nil), q.Subgroups...)
+		sort.Strings(subs)
+		for _, sub := range subs {
+			printGroup(sub)
+		}
+	}
+	sort.Strings(roots)
+	for _, name := range roots {
+		printGroup(name)
+	}
+	w.Flush()
+
+	return nil
+}
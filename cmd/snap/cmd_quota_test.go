@@ -0,0 +1,226 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/cmd/snap"
+)
+
+type quotaSuite struct {
+	BaseSnapSuite
+}
+
+var _ = check.Suite(&quotaSuite{})
+
+func makeFakeGetQuotaGroupHandler(c *check.C, body string) func(w http.ResponseWriter, r *http.Request) {
+	var called bool
+	return func(w http.ResponseWriter, r *http.Request) {
+		if called {
+			c.Fatalf("expected a single request")
+		}
+		called = true
+		c.Check(r.URL.Path, check.Equals, "/v2/quotas/foo")
+		c.Check(r.Method, check.Equals, "GET")
+		w.WriteHeader(200)
+		fmt.Fprintln(w, body)
+	}
+}
+
+func makeFakeGetQuotaGroupsHandler(c *check.C, body string) func(w http.ResponseWriter, r *http.Request) {
+	var called bool
+	return func(w http.ResponseWriter, r *http.Request) {
+		if called {
+			c.Fatalf("expected a single request")
+		}
+		called = true
+		c.Check(r.URL.Path, check.Equals, "/v2/quotas")
+		c.Check(r.Method, check.Equals, "GET")
+		w.WriteHeader(200)
+		fmt.Fprintln(w, body)
+	}
+}
+
+func makeFakeQuotaPostHandler(c *check.C, expectedBody map[string]interface{}) func(w http.ResponseWriter, r *http.Request) {
+	n := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.URL.Path, check.Equals, "/v2/quotas")
+			c.Check(r.Method, check.Equals, "POST")
+
+			buf, err := ioutil.ReadAll(r.Body)
+			c.Assert(err, check.IsNil)
+			var body map[string]interface{}
+			c.Assert(json.Unmarshal(buf, &body), check.IsNil)
+			c.Check(body, check.DeepEquals, expectedBody)
+
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+		n++
+	}
+}
+
+func (s *quotaSuite) TestSetQuotaInvalidArgs(c *check.C) {
+	for _, args := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"set-quota"}, "the required argument `<group-name>` was not provided"},
+		{[]string{"set-quota", "--memory=99", "foo"}, `cannot parse "99": need a number with a unit as input`},
+		{[]string{"set-quota", "--memory=888X", "foo"}, `cannot parse "888X\": try 'kB' or 'MB'`},
+		{[]string{"set-quota", "--cpu=-1", "foo"}, `cannot parse cpu quota "-1": expected a positive percentage`},
+		{[]string{"set-quota", "--tasks=many", "foo"}, `cannot parse tasks quota "many": expected a positive number`},
+		{[]string{"quota"}, "the required argument `<group-name>` was not provided"},
+		{[]string{"remove-quota"}, "the required argument `<group-name>` was not provided"},
+	} {
+		s.stdout.Reset()
+		s.stderr.Reset()
+
+		_, err := main.Parser(main.Client()).ParseArgs(args.args)
+		c.Assert(err, check.ErrorMatches, args.err)
+	}
+}
+
+func (s *quotaSuite) TestSetQuota(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeQuotaPostHandler(c, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "foo",
+		"parent":     "bar",
+		"snaps":      []interface{}{"snap-a", "snap-b"},
+		"constraints": map[string]interface{}{
+			"memory": float64(2000000000),
+			"cpu":    float64(50),
+			"tasks":  float64(32),
+		},
+	}))
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"set-quota", "--memory=2GB", "--cpu=50%", "--tasks=32", "--parent=bar", "foo", "snap-a", "snap-b"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *quotaSuite) TestSetQuotaNoWait(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeQuotaPostHandler(c, map[string]interface{}{
+		"action":      "ensure",
+		"group-name":  "foo",
+		"constraints": map[string]interface{}{"memory": float64(1000)},
+	}))
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"set-quota", "--memory=1kB", "--no-wait", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "42\n")
+}
+
+func (s *quotaSuite) TestRemoveQuota(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeQuotaPostHandler(c, map[string]interface{}{
+		"action":     "remove",
+		"group-name": "foo",
+	}))
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"remove-quota", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *quotaSuite) TestGetQuota(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeGetQuotaGroupHandler(c, `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {
+			"group-name": "foo",
+			"parent": "bar",
+			"subgroups": ["subgrp1"],
+			"snaps": ["snap-a", "snap-b"],
+			"constraints": {"memory": 1000, "cpu": 50, "tasks": 32}
+		}
+	}`))
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"quota", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+name:    foo
+parent:  bar
+constraints:
+  memory:  1kB
+  cpu:     50%
+  tasks:   32
+subgroups:
+  - subgrp1
+snaps:
+  - snap-a
+  - snap-b
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *quotaSuite) TestGetQuotaGroups(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeGetQuotaGroupsHandler(c, `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"group-name": "aaa", "subgroups": ["ccc", "bbb"], "constraints": {"memory": 1000}},
+			{"group-name": "bbb", "parent": "aaa", "constraints": {"memory": 400}},
+			{"group-name": "ccc", "parent": "aaa", "constraints": {"memory": 400, "tasks": 10}},
+			{"group-name": "aab", "constraints": {"cpu": 50}}
+		]
+	}`))
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"quotas"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+Quota  Parent  Constraints
+aaa            memory=1kB
+bbb    aaa     memory=400B
+ccc    aaa     memory=400B,tasks=10
+aab            cpu=50%
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *quotaSuite) TestGetQuotaGroupsNone(c *check.C) {
+	s.RedirectClientToTestServer(makeFakeGetQuotaGroupsHandler(c, `{"type": "sync", "status-code": 200, "result": []}`))
+
+	rest, err := main.Parser(main.Client()).ParseArgs([]string{"quotas"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No quota groups defined.\n")
+}
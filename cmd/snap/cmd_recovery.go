@@ -33,10 +33,16 @@ import (
 )
 
 type cmdRecovery struct {
-	clientMixin
+	waitMixin
 	colorMixin
 
-	ShowKeys bool `long:"show-keys"`
+	ShowKeys  bool `long:"show-keys"`
+	Create    bool `long:"create"`
+	RotateKey bool `long:"rotate-key"`
+
+	Positional struct {
+		Label string `positional-arg-name:"<label>"`
+	} `positional-args:"yes"`
 }
 
 var shortRecoveryHelp = i18n.G("List available recovery systems")
@@ -44,17 +50,30 @@ var longRecoveryHelp = i18n.G(`
 The recovery command lists the available recovery systems.
 
 With --show-keys it displays recovery keys that can be used to unlock the encrypted partitions if the device-specific automatic unlocking does not work.
+
+With --create it creates a new recovery system with the given label from the snaps and assertions of the running system. The system is rebooted into the new recovery system to test it before it is made available.
+
+With --rotate-key it replaces the recovery key of the encrypted partitions with a newly generated one, the previous recovery key can no longer be used afterwards.
 `)
 
 func init() {
 	addCommand("recovery", shortRecoveryHelp, longRecoveryHelp, func() flags.Commander {
 		// XXX: if we want more/nicer details we can add `snap recovery <system>` later
 		return &cmdRecovery{}
-	}, colorDescs.also(
+	}, colorDescs.also(waitDescs).also(
 		map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"show-keys": i18n.G("Show recovery keys (if available) to unlock encrypted partitions."),
-		}), nil)
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"create": i18n.G("Create a new recovery system with the given label."),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"rotate-key": i18n.G("Replace the recovery key of the encrypted partitions with a new one."),
+		}), []argDesc{{
+		// TRANSLATORS: This needs to begin with < and end with >
+		name: i18n.G("<label>"),
+		// TRANSLATORS: This should not start with a lowercase letter.
+		desc: i18n.G("Label of the recovery system to create"),
+	}})
 }
 
 func notesForSystem(sys *client.System) string {
@@ -73,15 +92,75 @@ func (x *cmdRecovery) showKeys(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	fmt.Fprintf(w, "recovery:\t%s\n", srk.RecoveryKey)
+	rkey := srk.RecoveryKey
+	if rkey == "" {
+		// the recovery key was removed
+		rkey = "-"
+	}
+	fmt.Fprintf(w, "recovery:\t%s\n", rkey)
 	fmt.Fprintf(w, "reinstall:\t%s\n", srk.ReinstallKey)
 	return nil
 }
 
+func (x *cmdRecovery) createSystem() error {
+	if release.OnClassic {
+		return errors.New(`command "create" is not available on classic systems`)
+	}
+	label := x.Positional.Label
+	if label == "" {
+		return errors.New(i18n.G("cannot create a recovery system without a label"))
+	}
+	changeID, err := x.client.CreateRecoverySystem(label)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	fmt.Fprintf(Stdout, i18n.G("Recovery system %q created.\n"), label)
+	return nil
+}
+
+func (x *cmdRecovery) rotateKey() error {
+	if release.OnClassic {
+		return errors.New(`command "rotate-key" is not available on classic systems`)
+	}
+	changeID, err := x.client.RotateRecoveryKey()
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	fmt.Fprintf(Stdout, i18n.G("Recovery key rotated, use 'snap recovery --show-keys' to display the new key.\n"))
+	return nil
+}
+
 func (x *cmdRecovery) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
 	}
+	if x.ShowKeys && x.Create {
+		return errors.New(i18n.G("cannot use --show-keys and --create together"))
+	}
+	if x.RotateKey && (x.ShowKeys || x.Create) {
+		return errors.New(i18n.G("cannot use --rotate-key with --show-keys or --create"))
+	}
+	if x.Create {
+		return x.createSystem()
+	}
+	if x.Positional.Label != "" {
+		return ErrExtraArgs
+	}
+	if x.RotateKey {
+		return x.rotateKey()
+	}
 
 	esc := x.getEscapes()
 	w := tabWriter()
@@ -31,20 +31,37 @@ import (
 
 func (s *SnapSuite) TestRecoveryHelp(c *C) {
 	msg := `Usage:
-  snap.test recovery [recovery-OPTIONS]
+  snap.test recovery [recovery-OPTIONS] [<label>]
 
 The recovery command lists the available recovery systems.
 
 With --show-keys it displays recovery keys that can be used to unlock the
 encrypted partitions if the device-specific automatic unlocking does not work.
 
+With --create it creates a new recovery system with the given label from the
+snaps and assertions of the running system. The system is rebooted into the new
+recovery system to test it before it is made available.
+
+With --rotate-key it replaces the recovery key of the encrypted partitions with
+a newly generated one, the previous recovery key can no longer be used
+afterwards.
+
 [recovery command options]
+      --no-wait                       Do not wait for the operation to finish
+                                      but just print the change id.
       --color=[auto|never|always]     Use a little bit of color to highlight
                                       some things. (default: auto)
       --unicode=[auto|never|always]   Use a little bit of Unicode to improve
                                       legibility. (default: auto)
       --show-keys                     Show recovery keys (if available) to
                                       unlock encrypted partitions.
+      --create                        Create a new recovery system with the
+                                      given label.
+      --rotate-key                    Replace the recovery key of the encrypted
+                                      partitions with a new one.
+
+[recovery command arguments]
+  <label>:                            Label of the recovery system to create
 `
 	s.testSubCommandHelp(c, "recovery", msg)
 }
@@ -192,3 +209,127 @@ reinstall:  1234
 	c.Check(s.Stderr(), Equals, "")
 	c.Check(n, Equals, 1)
 }
+
+func (s *SnapSuite) TestRecoveryShowRecoveryKeyRemoved(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/system-recovery-keys")
+		fmt.Fprintln(w, `{"type": "sync", "result": {"reinstall-key":"1234", "last-change": {"action": "remove", "time": "2021-06-01T12:00:00Z"}}}`)
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--show-keys"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, `recovery:   -
+reinstall:  1234
+`)
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *SnapSuite) TestRecoveryRotateKeyHappy(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, Equals, "POST")
+			c.Check(r.URL.Path, Equals, "/v2/system-recovery-keys")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action": "rotate",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		case 1:
+			c.Check(r.Method, Equals, "GET")
+			c.Check(r.URL.Path, Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--rotate-key"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, "Recovery key rotated, use 'snap recovery --show-keys' to display the new key.\n")
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(n, Equals, 2)
+}
+
+func (s *SnapSuite) TestRecoveryRotateKeyErrors(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected server call")
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--rotate-key", "--show-keys"})
+	c.Assert(err, ErrorMatches, "cannot use --rotate-key with --show-keys or --create")
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--rotate-key", "20210101"})
+	c.Assert(err, ErrorMatches, "too many arguments for command")
+
+	restore = release.MockOnClassic(true)
+	defer restore()
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--rotate-key"})
+	c.Assert(err, ErrorMatches, `command "rotate-key" is not available on classic systems`)
+}
+
+func (s *SnapSuite) TestRecoveryCreateHappy(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, Equals, "POST")
+			c.Check(r.URL.Path, Equals, "/v2/systems")
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action": "create",
+				"label":  "20210101",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		case 1:
+			c.Check(r.Method, Equals, "GET")
+			c.Check(r.URL.Path, Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("expected to get 2 requests, now on %d", n+1)
+		}
+
+		n++
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--create", "20210101"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, DeepEquals, []string{})
+	c.Check(s.Stdout(), Equals, "Recovery system \"20210101\" created.\n")
+	c.Check(s.Stderr(), Equals, "")
+	c.Check(n, Equals, 2)
+}
+
+func (s *SnapSuite) TestRecoveryCreateErrors(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected server call")
+	})
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--create"})
+	c.Assert(err, ErrorMatches, "cannot create a recovery system without a label")
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--create", "--show-keys", "20210101"})
+	c.Assert(err, ErrorMatches, "cannot use --show-keys and --create together")
+
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "20210101"})
+	c.Assert(err, ErrorMatches, "too many arguments for command")
+
+	restore = release.MockOnClassic(true)
+	defer restore()
+	_, err = snap.Parser(snap.Client()).ParseArgs([]string{"recovery", "--create", "20210101"})
+	c.Assert(err, ErrorMatches, `command "create" is not available on classic systems`)
+}
@@ -92,6 +92,13 @@ have developer access to the snap, either directly or through the
 store's collaboration feature, and to be logged in (see 'snap help login').
 
 Note a later refresh will typically undo a revision override.
+
+The --hold option holds the refreshes of the specified snaps, either for the
+given duration (e.g. --hold=72h, up to 60 days) or forever, which requires
+administrator privileges. Held snaps are neither auto-refreshed nor refreshed
+by 'snap refresh' without arguments, but can still be refreshed explicitly.
+The --unhold option releases the holds of the specified snaps, or of all snaps
+if none are specified.
 `)
 
 var longTryHelp = i18n.G(`
@@ -640,6 +647,8 @@ type cmdRefresh struct {
 	Time             bool   `long:"time"`
 	IgnoreValidation bool   `long:"ignore-validation"`
 	IgnoreRunning    bool   `long:"ignore-running" hidden:"yes"`
+	Hold             string `long:"hold" optional:"true" optional-value:"forever"`
+	Unhold           bool   `long:"unhold"`
 	Positional       struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -771,6 +780,61 @@ func (x *cmdRefresh) listRefresh() error {
 	return nil
 }
 
+func (x *cmdRefresh) holdRefreshes(names []string) error {
+	if len(names) == 0 {
+		return errors.New(i18n.G("--hold needs the snaps whose refreshes to hold"))
+	}
+	until := time.Time{}
+	if x.Hold != "forever" {
+		duration, err := time.ParseDuration(x.Hold)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf(i18n.G("invalid hold duration %q, use a duration like 72h or \"forever\""), x.Hold)
+		}
+		until = timeNow().Add(duration)
+	}
+
+	changeID, err := x.client.HoldRefreshes(names, x.Hold)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	if until.IsZero() {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.G("Refreshes of %s are held forever.\n"), strutil.Quoted(names))
+	} else {
+		// TRANSLATORS: the first %s is a comma-separated list of quoted snap names, the second is a time
+		fmt.Fprintf(Stdout, i18n.G("Refreshes of %s are held until %s.\n"), strutil.Quoted(names), x.fmtTime(until))
+	}
+	return nil
+}
+
+func (x *cmdRefresh) unholdRefreshes(names []string) error {
+	changeID, err := x.client.UnholdRefreshes(names)
+	if err != nil {
+		return err
+	}
+	if _, err := x.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+
+	if len(names) == 0 {
+		fmt.Fprintln(Stdout, i18n.G("Refreshes of all snaps are no longer held."))
+	} else {
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		fmt.Fprintf(Stdout, i18n.G("Refreshes of %s are no longer held.\n"), strutil.Quoted(names))
+	}
+	return nil
+}
+
 func (x *cmdRefresh) Execute([]string) error {
 	if err := x.setChannelFromCommandline(); err != nil {
 		return err
@@ -779,6 +843,20 @@ func (x *cmdRefresh) Execute([]string) error {
 		return err
 	}
 
+	if x.Hold != "" || x.Unhold {
+		if x.Hold != "" && x.Unhold {
+			return errors.New(i18n.G("cannot use --hold and --unhold together"))
+		}
+		if x.asksForMode() || x.asksForChannel() || x.Amend || x.Revision != "" || x.Cohort != "" || x.LeaveCohort || x.List || x.Time || x.IgnoreValidation || x.IgnoreRunning {
+			return errors.New(i18n.G("--hold and --unhold do not accept other refresh options"))
+		}
+		names := installedSnapNames(x.Positional.Snaps)
+		if x.Unhold {
+			return x.unholdRefreshes(names)
+		}
+		return x.holdRefreshes(names)
+	}
+
 	if x.Time {
 		if x.asksForMode() || x.asksForChannel() {
 			return errors.New(i18n.G("--time does not take mode or channel flags"))
@@ -1127,6 +1205,10 @@ func init() {
 			"cohort": i18n.G("Refresh the snap into the given cohort"),
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"leave-cohort": i18n.G("Refresh the snap out of its cohort"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"hold": i18n.G("Hold refreshes of the snaps for the given duration, or forever by default"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"unhold": i18n.G("Release the refresh holds of the snaps, or of all snaps if none are given"),
 		}), nil)
 	addCommand("try", shortTryHelp, longTryHelp, func() flags.Commander { return &cmdTry{} }, waitDescs.also(modeDescs), nil)
 	addCommand("enable", shortEnableHelp, longEnableHelp, func() flags.Commander { return &cmdEnable{} }, waitDescs, nil)
@@ -1090,6 +1090,20 @@ foo +4.2update1 +17 +bar +-.*
 	c.Check(n, check.Equals, 1)
 }
 
+func (s *SnapSuite) TestRefreshListDownloaded(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v2/find")
+		fmt.Fprintln(w, `{"type": "sync", "result": [{"name": "foo", "status": "active", "version": "4.2update1", "publisher": {"id": "bar-id", "username": "bar", "display-name": "Bar", "validation": "unproven"}, "revision":17,"summary":"some summary","downloaded":true}]}`)
+	})
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"refresh", "--list"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `Name +Version +Rev +Publisher +Notes
+foo +4.2update1 +17 +bar +downloaded
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
 func (s *SnapSuite) TestRefreshLegacyTime(c *check.C) {
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
@@ -1402,6 +1416,91 @@ func (s *SnapOpSuite) TestRefreshOneAmend(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *SnapOpSuite) testRefreshHoldOp(c *check.C, args []string, body map[string]interface{}) {
+	total := 2
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch n {
+		case 0:
+			c.Check(r.Method, check.Equals, "POST")
+			c.Check(r.URL.Path, check.Equals, "/v2/snaps")
+			c.Check(DecodedRequestBody(c, r), check.DeepEquals, body)
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "change": "42", "status-code": 202}`)
+		case 1:
+			c.Check(r.Method, check.Equals, "GET")
+			c.Check(r.URL.Path, check.Equals, "/v2/changes/42")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done"}}`)
+		default:
+			c.Fatalf("expected to get %d requests, now on %d", total, n+1)
+		}
+		n++
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs(args)
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(n, check.Equals, total)
+}
+
+func (s *SnapOpSuite) TestRefreshHoldForever(c *check.C) {
+	s.testRefreshHoldOp(c, []string{"refresh", "--hold", "one", "two"}, map[string]interface{}{
+		"action": "hold",
+		"snaps":  []interface{}{"one", "two"},
+		"hold":   "forever",
+	})
+	c.Check(s.Stdout(), check.Equals, "Refreshes of \"one\", \"two\" are held forever.\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapOpSuite) TestRefreshHoldDuration(c *check.C) {
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	defer snap.MockTimeNow(func() time.Time { return now })()
+
+	s.testRefreshHoldOp(c, []string{"refresh", "--abs-time", "--hold=72h", "one"}, map[string]interface{}{
+		"action": "hold",
+		"snaps":  []interface{}{"one"},
+		"hold":   "72h",
+	})
+	c.Check(s.Stdout(), check.Equals, "Refreshes of \"one\" are held until 2021-03-04T10:00:00Z.\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapOpSuite) TestRefreshUnhold(c *check.C) {
+	s.testRefreshHoldOp(c, []string{"refresh", "--unhold", "one"}, map[string]interface{}{
+		"action": "unhold",
+		"snaps":  []interface{}{"one"},
+	})
+	c.Check(s.Stdout(), check.Equals, "Refreshes of \"one\" are no longer held.\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapOpSuite) TestRefreshUnholdAll(c *check.C) {
+	s.testRefreshHoldOp(c, []string{"refresh", "--unhold"}, map[string]interface{}{
+		"action": "unhold",
+	})
+	c.Check(s.Stdout(), check.Equals, "Refreshes of all snaps are no longer held.\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *SnapOpSuite) TestRefreshHoldErrors(c *check.C) {
+	s.RedirectClientToTestServer(nil)
+	for _, t := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"refresh", "--hold"}, `--hold needs the snaps whose refreshes to hold`},
+		{[]string{"refresh", "--hold=potato", "one"}, `invalid hold duration "potato", use a duration like 72h or "forever"`},
+		{[]string{"refresh", "--hold=-1h", "one"}, `invalid hold duration "-1h", use a duration like 72h or "forever"`},
+		{[]string{"refresh", "--hold", "--unhold", "one"}, `cannot use --hold and --unhold together`},
+		{[]string{"refresh", "--hold", "--beta", "one"}, `--hold and --unhold do not accept other refresh options`},
+		{[]string{"refresh", "--unhold", "--list"}, `--hold and --unhold do not accept other refresh options`},
+	} {
+		_, err := snap.Parser(snap.Client()).ParseArgs(t.args)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%v", t.args))
+	}
+}
+
 func (s *SnapOpSuite) runTryTest(c *check.C, opts *client.SnapOptions) {
 	// pass relative path to cmd
 	tryDir := "some-dir"
@@ -20,8 +20,10 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -62,6 +64,12 @@ for which users, or a combination of these.
 If a snap is included in a save operation, excluding its system and
 configuration data from the snapshot is not currently possible. This
 restriction may be lifted in the future.
+
+With --encrypt, the snapshot is encrypted with a key derived from a
+passphrase that is asked for, or from the content of the file given
+with --key-file. The same passphrase or key file is then needed to
+check, restore or import the snapshot. Snapshots are also encrypted
+when the snapshots.encryption core option is set to a key file.
 `)
 var longForgetHelp = i18n.G(`
 The forget command deletes a snapshot. This operation can not be
@@ -160,6 +168,9 @@ func (x *savedCmd) Execute([]string) error {
 			if sh.Auto {
 				notes = append(notes, "auto")
 			}
+			if sh.Encryption != nil {
+				notes = append(notes, "encrypted")
+			}
 			if sh.Broken != "" {
 				notes = append(notes, "broken: "+sh.Broken)
 			}
@@ -175,10 +186,75 @@ func (x *savedCmd) Execute([]string) error {
 	return nil
 }
 
+// snapshotKeyMixin gets the key of encrypted snapshots.
+type snapshotKeyMixin struct {
+	KeyFile    string `long:"key-file"`
+	Passphrase bool   `long:"passphrase"`
+}
+
+var snapshotKeyDescs = mixinDescs{
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"key-file": i18n.G("Use the content of the given file as the key of encrypted snapshots"),
+	// TRANSLATORS: This should not start with a lowercase letter.
+	"passphrase": i18n.G("Ask for the passphrase of encrypted snapshots"),
+}
+
+// key returns the key given with the options, if any. When asking for a
+// new passphrase it is asked twice to catch typos.
+func (x snapshotKeyMixin) key(newPassphrase bool) ([]byte, error) {
+	if x.KeyFile != "" {
+		if x.Passphrase {
+			return nil, fmt.Errorf(i18n.G("cannot use --key-file and --passphrase together"))
+		}
+		key, err := ioutil.ReadFile(x.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf(i18n.G("cannot read key file: %v"), err)
+		}
+		if len(key) == 0 {
+			return nil, fmt.Errorf(i18n.G("cannot use empty key file %q"), x.KeyFile)
+		}
+		return key, nil
+	}
+	if !x.Passphrase {
+		return nil, nil
+	}
+
+	passphrase, err := readPassphrase(i18n.G("Passphrase: "))
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf(i18n.G("cannot use an empty passphrase"))
+	}
+	if newPassphrase {
+		again, err := readPassphrase(i18n.G("Repeat passphrase: "))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(passphrase, again) {
+			return nil, fmt.Errorf(i18n.G("passphrases do not match"))
+		}
+	}
+	return passphrase, nil
+}
+
+func readPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(Stdout, prompt)
+	passphrase, err := ReadPassword(0)
+	fmt.Fprint(Stdout, "\n")
+	if err != nil {
+		return nil, err
+	}
+	// trimming needed because we get \r from the pty in the tests
+	return bytes.TrimSpace(passphrase), nil
+}
+
 type saveCmd struct {
 	waitMixin
 	durationMixin
 	Users      string `long:"users"`
+	Encrypt    bool   `long:"encrypt"`
+	KeyFile    string `long:"key-file"`
 	Positional struct {
 		Snaps []installedSnapName `positional-arg-name:"<snap>"`
 	} `positional-args:"yes"`
@@ -187,7 +263,15 @@ type saveCmd struct {
 func (x *saveCmd) Execute([]string) error {
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	setID, changeID, err := x.client.SnapshotMany(snaps, users)
+	var key []byte
+	if x.Encrypt || x.KeyFile != "" {
+		var err error
+		key, err = snapshotKeyMixin{KeyFile: x.KeyFile, Passphrase: x.KeyFile == ""}.key(true)
+		if err != nil {
+			return err
+		}
+	}
+	setID, changeID, err := x.client.SnapshotMany(snaps, users, key)
 	if err != nil {
 		return err
 	}
@@ -243,6 +327,7 @@ func (x *forgetCmd) Execute([]string) error {
 
 type checkSnapshotCmd struct {
 	waitMixin
+	snapshotKeyMixin
 	Users      string `long:"users"`
 	Positional struct {
 		ID    snapshotID          `positional-arg-name:"<id>"`
@@ -257,7 +342,11 @@ func (x *checkSnapshotCmd) Execute([]string) error {
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	changeID, err := x.client.CheckSnapshots(setID, snaps, users)
+	key, err := x.key(false)
+	if err != nil {
+		return err
+	}
+	changeID, err := x.client.CheckSnapshots(setID, snaps, users, key)
 	if err != nil {
 		return err
 	}
@@ -282,6 +371,7 @@ func (x *checkSnapshotCmd) Execute([]string) error {
 
 type restoreCmd struct {
 	waitMixin
+	snapshotKeyMixin
 	Users      string `long:"users"`
 	Positional struct {
 		ID    snapshotID          `positional-arg-name:"<id>"`
@@ -296,7 +386,11 @@ func (x *restoreCmd) Execute([]string) error {
 	}
 	snaps := installedSnapNames(x.Positional.Snaps)
 	users := strutil.CommaSeparatedList(x.Users)
-	changeID, err := x.client.RestoreSnapshots(setID, snaps, users)
+	key, err := x.key(false)
+	if err != nil {
+		return err
+	}
+	changeID, err := x.client.RestoreSnapshots(setID, snaps, users, key)
 	if err != nil {
 		return err
 	}
@@ -340,6 +434,10 @@ func init() {
 		}, durationDescs.also(waitDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Snapshot data of only specific users (comma-separated) (default: all users)"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"encrypt": i18n.G("Encrypt the snapshot with a passphrase that is asked for"),
+			// TRANSLATORS: This should not start with a lowercase letter.
+			"key-file": i18n.G("Encrypt the snapshot with the content of the given file as the key"),
 		}), nil)
 
 	addCommand("restore",
@@ -347,7 +445,7 @@ func init() {
 		longRestoreHelp,
 		func() flags.Commander {
 			return &restoreCmd{}
-		}, waitDescs.also(map[string]string{
+		}, waitDescs.also(snapshotKeyDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Restore data of only specific users (comma-separated) (default: all users)"),
 		}), []argDesc{
@@ -384,7 +482,7 @@ func init() {
 		longCheckHelp,
 		func() flags.Commander {
 			return &checkSnapshotCmd{}
-		}, waitDescs.also(map[string]string{
+		}, waitDescs.also(snapshotKeyDescs).also(map[string]string{
 			// TRANSLATORS: This should not start with a lowercase letter.
 			"users": i18n.G("Check data of only specific users (comma-separated) (default: all users)"),
 		}), []argDesc{
@@ -423,7 +521,7 @@ func init() {
 		longImportSnapshotHelp,
 		func() flags.Commander {
 			return &importSnapshotCmd{}
-		}, nil, []argDesc{
+		}, durationDescs.also(snapshotKeyDescs), []argDesc{
 			{
 				name: "<filename>",
 				// TRANSLATORS: This should not start with a lowercase letter.
@@ -488,12 +586,17 @@ func (x *exportSnapshotCmd) Execute([]string) (err error) {
 type importSnapshotCmd struct {
 	clientMixin
 	durationMixin
+	snapshotKeyMixin
 	Positional struct {
 		Filename string `long:"filename"`
 	} `positional-args:"yes" required:"yes"`
 }
 
 func (x *importSnapshotCmd) Execute([]string) error {
+	key, err := x.key(false)
+	if err != nil {
+		return err
+	}
 	filename := x.Positional.Filename
 	f, err := os.Open(filename)
 	if err != nil {
@@ -505,7 +608,7 @@ func (x *importSnapshotCmd) Execute([]string) error {
 		return fmt.Errorf("cannot stat file: %v", err)
 	}
 
-	importSet, err := x.client.SnapshotImport(f, st.Size())
+	importSet, err := x.client.SnapshotImport(f, st.Size(), key)
 	if err != nil {
 		return err
 	}
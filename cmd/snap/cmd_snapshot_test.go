@@ -20,6 +20,7 @@
 package main_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -167,3 +168,112 @@ Set  Snap  Age    Version  Rev   Size    Notes
 1    htop  %-6s 2        1168      1B  -
 `, ageStr))
 }
+
+func (s *SnapSuite) TestSnapshotSavedEncrypted(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/v2/snapshots")
+		snapshotTime := time.Now().AddDate(0, -1, 0).Format(time.RFC3339)
+		fmt.Fprintf(w, `{"type":"sync","status-code":200,"status":"OK","result":[{"id":5,"snapshots":[{"set":5,"time":%q,"snap":"htop","revision":"1168","snap-id":"Z","auto":true,"epoch":{"read":[0],"write":[0]},"summary":"","version":"2","sha3-384":{"archive.tgz":""},"size":1,"encryption":{"cipher":"aes-256-gcm","kdf":"openpgp-s2k-iterated-sha256","salt":"c2FsdA==","count":1024,"key-check":"abc"}}]}]}`, snapshotTime)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"saved"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), testutil.MatchesWrapped, "Set  Snap  Age    Version  Rev   Size    Notes\n5    htop  .*  2        1168      1B  auto, encrypted\n")
+}
+
+func (s *SnapSuite) TestSnapshotSaveEncrypt(c *C) {
+	s.password = "sekrit"
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		switch r.URL.Path {
+		case "/v2/snaps":
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action": "snapshot",
+				"snaps":  []interface{}{"htop"},
+				// "sekrit" in base64
+				"snapshot-key": "c2Vrcml0",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9", "result": {"set-id": 5}}`)
+		case "/v2/changes/9":
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		case "/v2/snapshots":
+			fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[]}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--encrypt", "htop"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "Passphrase: \nRepeat passphrase: \nNo snapshots found.\n")
+	c.Check(n, Equals, 3)
+}
+
+func (s *SnapSuite) TestSnapshotSaveEncryptEmptyPassphrase(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Errorf("unexpected request %q", r.URL.Path)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"save", "--encrypt", "htop"})
+	c.Assert(err, ErrorMatches, "cannot use an empty passphrase")
+}
+
+func (s *SnapSuite) TestSnapshotRestoreKeyFile(c *C) {
+	keyFile := filepath.Join(c.MkDir(), "key")
+	c.Assert(ioutil.WriteFile(keyFile, []byte("sekrit"), 0600), IsNil)
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/snapshots":
+			c.Check(DecodedRequestBody(c, r), DeepEquals, map[string]interface{}{
+				"action": "restore",
+				"set":    json.Number("1"),
+				"key":    "c2Vrcml0",
+			})
+			w.WriteHeader(202)
+			fmt.Fprintln(w, `{"type":"async", "status-code": 202, "change": "9"}`)
+		case "/v2/changes/9":
+			fmt.Fprintln(w, `{"type": "sync", "result": {"ready": true, "status": "Done", "data": {}}}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"restore", "--key-file", keyFile, "1"})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "Restored snapshot #1.\n")
+}
+
+func (s *SnapSuite) TestSnapshotCheckKeyFileAndPassphrase(c *C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Errorf("unexpected request %q", r.URL.Path)
+	})
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"check-snapshot", "--key-file", "/some/key", "--passphrase", "1"})
+	c.Assert(err, ErrorMatches, "cannot use --key-file and --passphrase together")
+}
+
+func (s *SnapSuite) TestSnapshotImportPassphrase(c *C) {
+	s.password = "sekrit"
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/snapshots":
+			if r.Method == "POST" {
+				c.Check(r.Header.Get(client.SnapshotKeyHeader), Equals, "c2Vrcml0")
+				fmt.Fprintln(w, `{"type": "sync", "result": {"set-id": 42, "snaps": ["htop"]}}`)
+				return
+			}
+			fmt.Fprintln(w, `{"type":"sync","status-code":200,"status":"OK","result":[]}`)
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	exportedSnapshotPath := filepath.Join(c.MkDir(), "mocked-snapshot.snapshot")
+	c.Assert(ioutil.WriteFile(exportedSnapshotPath, []byte("this is really snapshot zip file data"), 0644), IsNil)
+
+	_, err := main.Parser(main.Client()).ParseArgs([]string{"import-snapshot", "--passphrase", exportedSnapshotPath})
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Equals, "Passphrase: \nImported snapshot as #42\nNo snapshots found.\n")
+}
@@ -0,0 +1,68 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/snapcore/snapd/i18n"
+)
+
+type cmdVerify struct {
+	clientMixin
+	Positionals struct {
+		Snap installedSnapName `required:"yes"`
+	} `positional-args:"true"`
+}
+
+var shortVerifyHelp = i18n.G("Verify the file of an installed snap")
+var longVerifyHelp = i18n.G(`
+The verify command checks that the file of the current revision of the
+given snap still matches the digest of its snap-revision assertion.
+
+Snaps installed without assertions, e.g. with --dangerous, cannot be
+verified.
+`)
+
+func init() {
+	addCommand("verify", shortVerifyHelp, longVerifyHelp, func() flags.Commander {
+		return &cmdVerify{}
+	}, nil, []argDesc{
+		{name: "<snap>"},
+	})
+}
+
+func (x *cmdVerify) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	verification, err := x.client.VerifySnap(string(x.Positionals.Snap))
+	if err != nil {
+		return err
+	}
+	if !verification.Verified {
+		return fmt.Errorf(i18n.G("snap %q revision %s does not match its snap-revision assertion"), verification.Snap, verification.Revision)
+	}
+	fmt.Fprintf(Stdout, i18n.G("snap %q revision %s verified\n"), verification.Snap, verification.Revision)
+	return nil
+}
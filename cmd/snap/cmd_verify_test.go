@@ -0,0 +1,74 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	snap "github.com/snapcore/snapd/cmd/snap"
+)
+
+type verifySuite struct {
+	BaseSnapSuite
+}
+
+var _ = check.Suite(&verifySuite{})
+
+func (s *verifySuite) mockVerify(c *check.C, verified bool) {
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Check(n, check.Equals, 1)
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v2/snaps/foo/verify")
+		fmt.Fprintf(w, `{"type": "sync", "result": {"snap": "foo", "revision": "7", "sha3-384": "digest", "verified": %v}}`, verified)
+	})
+}
+
+func (s *verifySuite) TestVerify(c *check.C) {
+	s.mockVerify(c, true)
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"verify", "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "snap \"foo\" revision 7 verified\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *verifySuite) TestVerifyMismatch(c *check.C) {
+	s.mockVerify(c, false)
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"verify", "foo"})
+	c.Assert(err, check.ErrorMatches, `snap "foo" revision 7 does not match its snap-revision assertion`)
+	c.Check(s.Stdout(), check.Equals, "")
+}
+
+func (s *verifySuite) TestVerifyError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+		fmt.Fprintln(w, `{"type": "error", "result": {"message": "cannot verify snap \"foo\": snap has no snap-revision assertion"}, "status-code": 400}`)
+	})
+
+	_, err := snap.Parser(snap.Client()).ParseArgs([]string{"verify", "foo"})
+	c.Assert(err, check.ErrorMatches, `cannot verify snap "foo": snap has no snap-revision assertion`)
+}
@@ -48,6 +48,12 @@ func (s *SnapSuite) TestCmdWatch(c *C) {
 
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/events" {
+			// no events stream, the change is polled
+			w.WriteHeader(404)
+			fmt.Fprintln(w, `{"type": "error", "status-code": 404, "result": {"message": "not found"}}`)
+			return
+		}
 		n++
 		switch n {
 		case 1:
@@ -76,6 +82,43 @@ func (s *SnapSuite) TestCmdWatch(c *C) {
 	c.Check(s.Stderr(), Equals, "")
 }
 
+func (s *SnapSuite) TestCmdWatchEvents(c *C) {
+	meter := &progresstest.Meter{}
+	defer progress.MockMeter(meter)()
+	defer snap.MockMaxGoneTime(time.Millisecond)()
+	// only events wake up the watching
+	defer snap.MockEventsPollTime(time.Hour)()
+
+	n := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/events" {
+			c.Check(r.URL.Query().Get("change-id"), Equals, "two")
+			w.Header().Set("Content-Type", "application/json-seq")
+			fmt.Fprintf(w, "\x1e{\"type\": \"task-progress\", \"change-id\": \"two\"}\n")
+			fmt.Fprintf(w, "\x1e{\"type\": \"change-update\", \"change-id\": \"two\", \"status\": \"Done\"}\n")
+			return
+		}
+		n++
+		switch n {
+		case 1:
+			c.Check(r.URL.Path, Equals, "/v2/changes/two")
+			fmt.Fprintf(w, fmtWatchChangeJSON, 50*1024, 100*1024)
+		case 2:
+			c.Check(r.URL.Path, Equals, "/v2/changes/two")
+			fmt.Fprintln(w, `{"type": "sync", "result": {"id": "two", "ready": true, "status": "Done"}}`)
+		default:
+			c.Errorf("expected 2 queries, currently on %d", n)
+		}
+	})
+
+	rest, err := snap.Parser(snap.Client()).ParseArgs([]string{"watch", "two"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(n, Equals, 2)
+	c.Check(s.Stdout(), Equals, "")
+	c.Check(s.Stderr(), Equals, "")
+}
+
 func (s *SnapSuite) TestWatchLast(c *C) {
 	meter := &progresstest.Meter{}
 	defer progress.MockMeter(meter)()
@@ -84,6 +127,11 @@ func (s *SnapSuite) TestWatchLast(c *C) {
 
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/events" {
+			w.WriteHeader(404)
+			fmt.Fprintln(w, `{"type": "error", "status-code": 404, "result": {"message": "not found"}}`)
+			return
+		}
 		n++
 		switch n {
 		case 1:
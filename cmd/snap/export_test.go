@@ -132,8 +132,10 @@ var (
 	MaybePrintBase              = (*infoWriter).maybePrintBase
 	MaybePrintPath              = (*infoWriter).maybePrintPath
 	MaybePrintSum               = (*infoWriter).maybePrintSum
+	MaybePrintCompression       = (*infoWriter).maybePrintCompression
 	MaybePrintCohortKey         = (*infoWriter).maybePrintCohortKey
 	MaybePrintHealth            = (*infoWriter).maybePrintHealth
+	MaybePrintHold              = (*infoWriter).maybePrintHold
 )
 
 func MockPollTime(d time.Duration) (restore func()) {
@@ -144,6 +146,14 @@ func MockPollTime(d time.Duration) (restore func()) {
 	}
 }
 
+func MockEventsPollTime(d time.Duration) (restore func()) {
+	d0 := eventsPollTime
+	eventsPollTime = d
+	return func() {
+		eventsPollTime = d0
+	}
+}
+
 func MockMaxGoneTime(d time.Duration) (restore func()) {
 	d0 := maxGoneTime
 	maxGoneTime = d
@@ -63,6 +63,8 @@ type Notes struct {
 	InCohort         bool
 	Health           string
 	Price            string
+	Held             bool
+	Downloaded       bool
 }
 
 func NotesFromChannelSnapInfo(ref *snap.ChannelSnapInfo) *Notes {
@@ -74,10 +76,12 @@ func NotesFromChannelSnapInfo(ref *snap.ChannelSnapInfo) *Notes {
 
 func NotesFromRemote(snp *client.Snap, resInfo *client.ResultInfo) *Notes {
 	notes := &Notes{
-		Private:  snp.Private,
-		DevMode:  snp.Confinement == client.DevModeConfinement,
-		Classic:  snp.Confinement == client.ClassicConfinement,
-		SnapType: snap.Type(snp.Type),
+		Private:    snp.Private,
+		DevMode:    snp.Confinement == client.DevModeConfinement,
+		Classic:    snp.Confinement == client.ClassicConfinement,
+		SnapType:   snap.Type(snp.Type),
+		Held:       snp.Hold != nil,
+		Downloaded: snp.Downloaded,
 	}
 	if resInfo != nil {
 		notes.Price = getPriceString(snp.Prices, resInfo.SuggestedCurrency, snp.Status)
@@ -103,6 +107,7 @@ func NotesFromLocal(snp *client.Snap) *Notes {
 		IgnoreValidation: snp.IgnoreValidation,
 		InCohort:         snp.CohortKey != "",
 		Health:           health,
+		Held:             snp.Hold != nil,
 	}
 }
 
@@ -166,6 +171,16 @@ func (n *Notes) String() string {
 		ns = append(ns, n.Health)
 	}
 
+	if n.Held {
+		// TRANSLATORS: if possible, a single short word
+		ns = append(ns, i18n.G("held"))
+	}
+
+	if n.Downloaded {
+		// TRANSLATORS: if possible, a single short word
+		ns = append(ns, i18n.G("downloaded"))
+	}
+
 	if len(ns) == 0 {
 		return "-"
 	}
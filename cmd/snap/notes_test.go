@@ -20,6 +20,8 @@
 package main_test
 
 import (
+	"time"
+
 	"gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/client"
@@ -94,6 +96,18 @@ func (notesSuite) TestNotesInCohort(c *check.C) {
 	}).String(), check.Equals, "in-cohort")
 }
 
+func (notesSuite) TestNotesHeld(c *check.C) {
+	c.Check((&snap.Notes{
+		Held: true,
+	}).String(), check.Equals, "held")
+}
+
+func (notesSuite) TestNotesDownloaded(c *check.C) {
+	c.Check((&snap.Notes{
+		Downloaded: true,
+	}).String(), check.Equals, "downloaded")
+}
+
 func (notesSuite) TestNotesNothing(c *check.C) {
 	c.Check((&snap.Notes{}).String(), check.Equals, "-")
 }
@@ -114,4 +128,18 @@ func (notesSuite) TestNotesFromLocal(c *check.C) {
 	c.Check(snap.NotesFromLocal(&client.Snap{CohortKey: ""}).InCohort, check.Equals, false)
 	c.Check(snap.NotesFromLocal(&client.Snap{CohortKey: "123"}).InCohort, check.Equals, true)
 	c.Check(snap.NotesFromLocal(&client.Snap{Health: &client.SnapHealth{Status: "blocked"}}).Health, check.Equals, "blocked")
+	hold := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	c.Check(snap.NotesFromLocal(&client.Snap{}).Held, check.Equals, false)
+	c.Check(snap.NotesFromLocal(&client.Snap{Hold: &hold}).Held, check.Equals, true)
+}
+
+func (notesSuite) TestNotesFromRemoteHeld(c *check.C) {
+	hold := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	c.Check(snap.NotesFromRemote(&client.Snap{}, nil).Held, check.Equals, false)
+	c.Check(snap.NotesFromRemote(&client.Snap{Hold: &hold}, nil).Held, check.Equals, true)
+}
+
+func (notesSuite) TestNotesFromRemoteDownloaded(c *check.C) {
+	c.Check(snap.NotesFromRemote(&client.Snap{}, nil).Downloaded, check.Equals, false)
+	c.Check(snap.NotesFromRemote(&client.Snap{Downloaded: true}, nil).Downloaded, check.Equals, true)
 }
@@ -46,6 +46,19 @@ func (mx timeMixin) fmtTime(t time.Time) string {
 	return timeutilHuman(t)
 }
 
+// holdForeverThreshold is how far in the future a refresh hold needs to end
+// to be shown as held forever.
+const holdForeverThreshold = 100 * 365 * 24 * time.Hour
+
+// fmtHold formats the end of a refresh hold with fmtTime, unless it is
+// held forever.
+func fmtHold(t time.Time, fmtTime func(time.Time) string) string {
+	if t.Sub(timeNow()) > holdForeverThreshold {
+		return i18n.G("forever")
+	}
+	return fmtTime(t)
+}
+
 type durationMixin struct {
 	AbsTime bool `long:"abs-time"`
 }
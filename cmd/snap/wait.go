@@ -20,6 +20,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -34,12 +35,19 @@ import (
 var (
 	maxGoneTime = 5 * time.Second
 	pollTime    = 100 * time.Millisecond
+	// eventsPollTime is the longest time to wait for an event about
+	// the change before checking on it anyway
+	eventsPollTime = 500 * time.Millisecond
 )
 
 type waitMixin struct {
 	clientMixin
 	NoWait    bool `long:"no-wait"`
 	skipAbort bool
+	// useEvents makes wait follow the change through the events
+	// stream of the daemon, when it is available, instead of
+	// polling it continuously
+	useEvents bool
 }
 
 var waitDescs = mixinDescs{
@@ -79,6 +87,14 @@ func (wmx waitMixin) wait(id string) (*client.Change, error) {
 		close(c)
 	}()
 
+	var events <-chan client.Event
+	if wmx.useEvents {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// older daemons do not stream events, just poll then
+		events, _ = cli.Events(ctx, &client.EventFilter{ChangeID: id})
+	}
+
 	tMax := time.Time{}
 
 	var lastID string
@@ -154,7 +170,35 @@ func (wmx waitMixin) wait(id string) (*client.Change, error) {
 		// note this very purposely is not a ticker; we want
 		// to sleep 100ms between calls, not call once every
 		// 100ms.
+		events = sleepOrNextEvent(events)
+	}
+}
+
+// sleepOrNextEvent waits for the next events about the change, or
+// sleeps for pollTime if there is no events stream. It returns the
+// stream to keep using, nil once it is gone.
+func sleepOrNextEvent(events <-chan client.Event) <-chan client.Event {
+	if events == nil {
 		time.Sleep(pollTime)
+		return nil
+	}
+	select {
+	case _, ok := <-events:
+		if !ok {
+			return nil
+		}
+	case <-time.After(eventsPollTime):
+	}
+	// the change is queried fully anyway, coalesce the queued events
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return nil
+			}
+		default:
+			return events
+		}
 	}
 }
 
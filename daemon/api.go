@@ -55,6 +55,7 @@ var api = []*Command{
 	snapsCmd,
 	snapCmd,
 	snapFileCmd,
+	snapVerifyCmd,
 	snapDownloadCmd,
 	snapConfCmd,
 	interfacesCmd,
@@ -86,6 +87,11 @@ var api = []*Command{
 	validationSetsCmd,
 	routineConsoleConfStartCmd,
 	systemRecoveryKeysCmd,
+	quotaGroupsCmd,
+	quotaGroupInfoCmd,
+	eventsCmd,
+	metricsCmd,
+	pendingRefreshNotificationCmd,
 }
 
 var (
@@ -249,6 +255,10 @@ type snapInstruction struct {
 	License  *licenseData `json:"license"`
 	Snaps    []string     `json:"snaps"`
 	Users    []string     `json:"users"`
+	// SnapshotKey is used to encrypt snapshots
+	SnapshotKey []byte `json:"snapshot-key,omitempty"`
+	// Hold is how long refreshes are held for, a duration or "forever"
+	Hold string `json:"hold,omitempty"`
 
 	// The fields below should not be unmarshalled into. Do not export them.
 	userID int
@@ -294,6 +304,12 @@ func (inst *snapInstruction) validate() error {
 			return fmt.Errorf("leave-cohort can only be specified for refresh or switch")
 		}
 	}
+	if inst.SnapshotKey != nil && inst.Action != "snapshot" {
+		return fmt.Errorf("snapshot-key can only be specified for snapshot")
+	}
+	if inst.Hold != "" && inst.Action != "hold" {
+		return fmt.Errorf("hold can only be specified for hold")
+	}
 	if inst.Action == "install" {
 		for _, snapName := range inst.Snaps {
 			// FIXME: alternatively we could simply mutate *inst
@@ -327,6 +343,9 @@ var (
 	snapstateRevertToRevision  = snapstate.RevertToRevision
 	snapstateSwitch            = snapstate.Switch
 
+	snapstateHoldRefreshesByUser   = snapstate.HoldRefreshesByUser
+	snapstateUnholdRefreshesByUser = snapstate.UnholdRefreshesByUser
+
 	snapshotList    = snapshotstate.List
 	snapshotCheck   = snapshotstate.Check
 	snapshotForget  = snapshotstate.Forget
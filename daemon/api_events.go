@@ -0,0 +1,312 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/strutil"
+)
+
+var eventsCmd = &Command{
+	Path:   "/v2/events",
+	UserOK: true,
+	GET:    getEvents,
+}
+
+var knownEventTypes = []string{
+	client.EventChangeUpdate,
+	client.EventTaskUpdate,
+	client.EventTaskProgress,
+	client.EventWarning,
+	client.EventSnapInstalled,
+	client.EventSnapRemoved,
+}
+
+// eventsBufferSize is how many events can be queued for a
+// subscriber before new events get dropped for it.
+const eventsBufferSize = 64
+
+var eventsTimeNow = time.Now
+
+type eventFilter struct {
+	types    []string
+	changeID string
+}
+
+func (f *eventFilter) matches(ev *client.Event) bool {
+	if len(f.types) > 0 && !strutil.ListContains(f.types, ev.Type) {
+		return false
+	}
+	if f.changeID != "" && f.changeID != ev.ChangeID {
+		return false
+	}
+	return true
+}
+
+type eventSubscription struct {
+	filter eventFilter
+	ch     chan *client.Event
+}
+
+// eventHub fans out the notifications of the state to the
+// subscribed /v2/events clients.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[*eventSubscription]bool
+	closed bool
+}
+
+// newEventHub returns a hub observing the given state, which must be
+// locked.
+func newEventHub(st *state.State) *eventHub {
+	h := &eventHub{
+		subs: make(map[*eventSubscription]bool),
+	}
+	st.AddObserver(&state.Observer{
+		TaskStatusChanged:   h.taskStatusChanged,
+		ChangeStatusChanged: h.changeStatusChanged,
+		TaskProgressChanged: h.taskProgressChanged,
+		WarningAdded:        h.warningAdded,
+	})
+	return h
+}
+
+func (h *eventHub) subscribe(filter eventFilter) *eventSubscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := &eventSubscription{
+		filter: filter,
+		ch:     make(chan *client.Event, eventsBufferSize),
+	}
+	if h.closed {
+		close(sub.ch)
+		return sub
+	}
+	h.subs[sub] = true
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *eventSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[sub] {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// close ends all the subscriptions, the daemon is going away.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		close(sub.ch)
+	}
+	h.subs = make(map[*eventSubscription]bool)
+	h.closed = true
+}
+
+func (h *eventHub) publish(ev *client.Event) {
+	ev.Timestamp = eventsTimeNow()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if !sub.filter.matches(ev) {
+			continue
+		}
+		// never block the state, slow readers miss events
+		select {
+		case sub.ch <- ev:
+		default:
+			logger.Debugf("dropping %s event for slow events reader", ev.Type)
+		}
+	}
+}
+
+func (h *eventHub) taskStatusChanged(t *state.Task, old, new state.Status) {
+	ev := &client.Event{
+		Type:    client.EventTaskUpdate,
+		TaskID:  t.ID(),
+		Kind:    t.Kind(),
+		Summary: t.Summary(),
+		Status:  new.String(),
+		Ready:   new.Ready(),
+	}
+	if chg := t.Change(); chg != nil {
+		ev.ChangeID = chg.ID()
+	}
+	h.publish(ev)
+}
+
+func (h *eventHub) taskProgressChanged(t *state.Task, label string, done, total int) {
+	ev := &client.Event{
+		Type:    client.EventTaskProgress,
+		TaskID:  t.ID(),
+		Kind:    t.Kind(),
+		Summary: t.Summary(),
+		Status:  t.Status().String(),
+		Progress: &client.TaskProgress{
+			Label: label,
+			Done:  done,
+			Total: total,
+		},
+	}
+	if chg := t.Change(); chg != nil {
+		ev.ChangeID = chg.ID()
+	}
+	h.publish(ev)
+}
+
+func (h *eventHub) changeStatusChanged(chg *state.Change, old, new state.Status) {
+	var snapNames []string
+	if err := chg.Get("snap-names", &snapNames); err != nil && err != state.ErrNoState {
+		logger.Noticef("cannot get snap names of change %s: %v", chg.ID(), err)
+	}
+	h.publish(&client.Event{
+		Type:      client.EventChangeUpdate,
+		ChangeID:  chg.ID(),
+		Kind:      chg.Kind(),
+		Summary:   chg.Summary(),
+		Status:    new.String(),
+		Ready:     new.Ready(),
+		SnapNames: snapNames,
+	})
+
+	if new != state.DoneStatus {
+		return
+	}
+	var typ string
+	switch chg.Kind() {
+	case "install-snap", "try-snap":
+		typ = client.EventSnapInstalled
+	case "remove-snap":
+		typ = client.EventSnapRemoved
+	default:
+		return
+	}
+	h.publish(&client.Event{
+		Type:      typ,
+		ChangeID:  chg.ID(),
+		Kind:      chg.Kind(),
+		SnapNames: snapNames,
+	})
+}
+
+func (h *eventHub) warningAdded(w *state.Warning) {
+	h.publish(&client.Event{
+		Type:    client.EventWarning,
+		Message: w.String(),
+	})
+}
+
+// eventHub returns the hub of the daemon, setting it up on first use.
+func (d *Daemon) eventHub() *eventHub {
+	// the state lock is taken before the daemon one, as it happens
+	// when restarts are requested
+	d.state.Lock()
+	defer d.state.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.events == nil {
+		d.events = newEventHub(d.state)
+	}
+	return d.events
+}
+
+func getEvents(c *Command, r *http.Request, user *auth.UserState) Response {
+	query := r.URL.Query()
+
+	var filter eventFilter
+	if s := query.Get("types"); s != "" {
+		filter.types = strutil.CommaSeparatedList(s)
+		for _, typ := range filter.types {
+			if !strutil.ListContains(knownEventTypes, typ) {
+				return BadRequest("invalid event type %q", typ)
+			}
+		}
+	}
+	filter.changeID = query.Get("change-id")
+
+	hub := c.d.eventHub()
+	return &eventsResponse{
+		hub: hub,
+		sub: hub.subscribe(filter),
+	}
+}
+
+// An eventsResponse streams the events of a subscription as a
+// json-seq response, until either the client goes away or the
+// daemon stops.
+type eventsResponse struct {
+	hub *eventHub
+	sub *eventSubscription
+}
+
+func (er *eventsResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer er.hub.unsubscribe(er.sub)
+
+	w.Header().Set("Content-Type", "application/json-seq")
+	w.WriteHeader(200)
+
+	flusher, hasFlusher := w.(http.Flusher)
+	flush := func(writer *bufio.Writer) error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if hasFlusher {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	writer := bufio.NewWriter(w)
+	enc := json.NewEncoder(writer)
+	if err := flush(writer); err != nil {
+		return
+	}
+	for {
+		select {
+		case ev, ok := <-er.sub.ch:
+			if !ok {
+				return
+			}
+			writer.WriteByte(0x1E) // RS -- see ascii(7), and RFC7464
+			if err := enc.Encode(ev); err != nil {
+				logger.Noticef("cannot stream events: %v", err)
+				return
+			}
+			if err := flush(writer); err != nil {
+				logger.Debugf("cannot stream events: %v", err)
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
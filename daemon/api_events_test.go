@@ -0,0 +1,145 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2020 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var _ = check.Suite(&eventsSuite{})
+
+type eventsSuite struct {
+	apiBaseSuite
+}
+
+func (s *eventsSuite) SetUpTest(c *check.C) {
+	s.apiBaseSuite.SetUpTest(c)
+
+	s.AddCleanup(daemon.MockEventsTimeNow(func() time.Time {
+		return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	}))
+}
+
+func (s *eventsSuite) TestEventsStream(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("GET", "/v2/events", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil)
+
+	st := d.Overlord().State()
+	st.Lock()
+	chg := st.NewChange("install-snap", "Install foo")
+	chg.Set("snap-names", []string{"foo"})
+	t := st.NewTask("link-snap", "Link foo")
+	chg.AddTask(t)
+	t.SetStatus(state.DoingStatus)
+	t.SetProgress("linking", 1, 2)
+	t.SetStatus(state.DoneStatus)
+	st.Warnf("something happened")
+	st.Unlock()
+
+	d.CloseEvents()
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.HeaderMap.Get("Content-Type"), check.Equals, "application/json-seq")
+	c.Check(rec.Body.String(), check.Equals, `
+{"type":"task-update","timestamp":"2021-03-04T05:06:07Z","change-id":"1","task-id":"1","kind":"link-snap","summary":"Link foo","status":"Doing"}
+{"type":"change-update","timestamp":"2021-03-04T05:06:07Z","change-id":"1","kind":"install-snap","summary":"Install foo","status":"Doing","snap-names":["foo"]}
+{"type":"task-progress","timestamp":"2021-03-04T05:06:07Z","change-id":"1","task-id":"1","kind":"link-snap","summary":"Link foo","status":"Doing","progress":{"label":"linking","done":1,"total":2}}
+{"type":"task-update","timestamp":"2021-03-04T05:06:07Z","change-id":"1","task-id":"1","kind":"link-snap","summary":"Link foo","status":"Done","ready":true}
+{"type":"change-update","timestamp":"2021-03-04T05:06:07Z","change-id":"1","kind":"install-snap","summary":"Install foo","status":"Done","ready":true,"snap-names":["foo"]}
+{"type":"snap-installed","timestamp":"2021-03-04T05:06:07Z","change-id":"1","kind":"install-snap","snap-names":["foo"]}
+{"type":"warning","timestamp":"2021-03-04T05:06:07Z","message":"something happened"}
+`[1:])
+}
+
+func (s *eventsSuite) TestEventsFilter(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("GET", "/v2/events?types=change-update,snap-removed&change-id=2", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil)
+
+	st := d.Overlord().State()
+	st.Lock()
+	for _, kind := range []string{"install-snap", "remove-snap"} {
+		chg := st.NewChange(kind, "...")
+		t := st.NewTask("foo", "...")
+		chg.AddTask(t)
+		t.SetStatus(state.DoneStatus)
+	}
+	st.Warnf("something happened")
+	st.Unlock()
+
+	d.CloseEvents()
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.Body.String(), check.Equals, `
+{"type":"change-update","timestamp":"2021-03-04T05:06:07Z","change-id":"2","kind":"remove-snap","summary":"...","status":"Done","ready":true}
+{"type":"snap-removed","timestamp":"2021-03-04T05:06:07Z","change-id":"2","kind":"remove-snap"}
+`[1:])
+}
+
+func (s *eventsSuite) TestEventsBadType(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("GET", "/v2/events?types=foo", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, `invalid event type "foo"`)
+}
+
+func (s *eventsSuite) TestEventsClientGoesAway(c *check.C) {
+	d := s.daemonWithOverlordMock(c)
+
+	req, err := http.NewRequest("GET", "/v2/events", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil)
+
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req.WithContext(ctx))
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.Body.String(), check.Equals, "")
+
+	// the subscription is gone, publishing does not block
+	st := d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	for i := 0; i < 100; i++ {
+		st.Warnf("warning %d", i)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -32,6 +33,7 @@ import (
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
 )
@@ -153,7 +155,7 @@ func searchStore(c *Command, r *http.Request, user *auth.UserState) Response {
 		Sources:           []string{"store"},
 	}
 
-	return sendStorePackages(route, meta, found)
+	return sendStorePackages(route, meta, found, nil, nil)
 }
 
 func findOne(c *Command, r *http.Request, user *auth.UserState, name string) Response {
@@ -201,15 +203,30 @@ func storeUpdates(c *Command, r *http.Request, user *auth.UserState) Response {
 	state := c.d.overlord.State()
 	state.Lock()
 	updates, err := snapstateRefreshCandidates(state, user)
-	state.Unlock()
 	if err != nil {
+		state.Unlock()
 		return InternalError("cannot list updates: %v", err)
 	}
+	held, err := snapstate.HeldSnaps(state)
+	state.Unlock()
+	if err != nil {
+		return InternalError("cannot list held snaps: %v", err)
+	}
 
-	return sendStorePackages(route, nil, updates)
+	downloaded := make(map[string]bool)
+	for _, update := range updates {
+		if snapstate.InDownloadCache(&update.DownloadInfo) {
+			downloaded[update.InstanceName()] = true
+		}
+	}
+
+	return sendStorePackages(route, nil, updates, held, downloaded)
 }
 
-func sendStorePackages(route *mux.Route, meta *Meta, found []*snap.Info) Response {
+// sendStorePackages sends the given snaps from the store, held maps the snaps
+// whose refresh is held to the time until which they are held, downloaded
+// holds the snaps whose update was already downloaded.
+func sendStorePackages(route *mux.Route, meta *Meta, found []*snap.Info, held map[string]time.Time, downloaded map[string]bool) Response {
 	results := make([]*json.RawMessage, 0, len(found))
 	for _, x := range found {
 		url, err := route.URL("name", x.InstanceName())
@@ -218,7 +235,12 @@ func sendStorePackages(route *mux.Route, meta *Meta, found []*snap.Info) Respons
 			continue
 		}
 
-		data, err := json.Marshal(webify(mapRemote(x), url.String()))
+		result := mapRemote(x)
+		if until, ok := held[x.InstanceName()]; ok {
+			result.Hold = &until
+		}
+		result.Downloaded = downloaded[x.InstanceName()]
+		data, err := json.Marshal(webify(result, url.String()))
 		if err != nil {
 			return InternalError("%v", err)
 		}
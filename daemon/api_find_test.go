@@ -21,12 +21,17 @@ package daemon_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
 	"gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/snap"
@@ -102,6 +107,101 @@ func (s *findSuite) TestFindRefreshes(c *check.C) {
 	c.Check(s.actions, check.HasLen, 1)
 }
 
+func (s *findSuite) TestFindRefreshesHeld(c *check.C) {
+	d := s.daemon(c)
+
+	s.rsnaps = []*snap.Info{{
+		SideInfo: snap.SideInfo{
+			RealName: "store",
+		},
+		Publisher: snap.StoreAccount{
+			ID:          "foo-id",
+			Username:    "foo",
+			DisplayName: "Foo",
+			Validation:  "unproven",
+		},
+	}}
+	s.mockSnap(c, "name: store\nversion: 1.0")
+	s.mockSnap(c, "name: gating-snap\nversion: 1.0")
+
+	holdUntil := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	st := d.Overlord().State()
+	st.Lock()
+	st.Set("snaps-hold", map[string]map[string]map[string]time.Time{
+		"store": {
+			"gating-snap": {
+				"first-held": time.Now(),
+				"hold-until": holdUntil,
+			},
+		},
+	})
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/find?select=refresh", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+
+	snaps := snapList(rsp.Result)
+	c.Assert(snaps, check.HasLen, 1)
+	c.Assert(snaps[0]["name"], check.Equals, "store")
+	c.Check(snaps[0]["hold"], check.Equals, holdUntil.Format(time.RFC3339))
+}
+
+func (s *findSuite) TestFindRefreshesDownloaded(c *check.C) {
+	s.daemon(c)
+
+	s.rsnaps = []*snap.Info{{
+		SideInfo: snap.SideInfo{
+			RealName: "store",
+		},
+		DownloadInfo: snap.DownloadInfo{
+			Sha3_384: "store-sha3",
+		},
+		Publisher: snap.StoreAccount{
+			ID:          "foo-id",
+			Username:    "foo",
+			DisplayName: "Foo",
+			Validation:  "unproven",
+		},
+	}, {
+		SideInfo: snap.SideInfo{
+			RealName: "other",
+		},
+		DownloadInfo: snap.DownloadInfo{
+			Sha3_384: "other-sha3",
+		},
+		Publisher: snap.StoreAccount{
+			ID:          "foo-id",
+			Username:    "foo",
+			DisplayName: "Foo",
+			Validation:  "unproven",
+		},
+	}}
+	s.mockSnap(c, "name: store\nversion: 1.0")
+	s.mockSnap(c, "name: other\nversion: 1.0")
+
+	// the update of "store" was pre-downloaded
+	c.Assert(os.MkdirAll(dirs.SnapDownloadCacheDir, 0700), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapDownloadCacheDir, "store-sha3"), nil, 0600), check.IsNil)
+
+	req, err := http.NewRequest("GET", "/v2/find?select=refresh", nil)
+	c.Assert(err, check.IsNil)
+
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+
+	snaps := snapList(rsp.Result)
+	c.Assert(snaps, check.HasLen, 2)
+	downloaded := make(map[string]interface{})
+	for _, snap := range snaps {
+		downloaded[snap["name"].(string)] = snap["downloaded"]
+	}
+	c.Check(downloaded, check.DeepEquals, map[string]interface{}{
+		"store": true,
+		"other": nil,
+	})
+}
+
 func (s *findSuite) TestFindRefreshSideloaded(c *check.C) {
 	d := s.daemon(c)
 
@@ -0,0 +1,66 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/metrics"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var _ = check.Suite(&metricsSuite{})
+
+type metricsSuite struct {
+	apiBaseSuite
+}
+
+func (s *metricsSuite) TestMetrics(c *check.C) {
+	s.daemonWithOverlordMock(c)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	chg := st.NewChange("some-change", "...")
+	chg.SetStatus(state.DoneStatus)
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/metrics", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	s.req(c, req, nil).ServeHTTP(rec, req)
+
+	c.Check(rec.Code, check.Equals, 200)
+	c.Check(rec.HeaderMap.Get("Content-Type"), check.Equals, metrics.ContentType)
+	c.Check(rec.Body.String(), check.Matches, `(?ms).*^# TYPE snapd_changes counter$.*`)
+	c.Check(rec.Body.String(), check.Matches, `(?ms).*^snapd_changes_total{kind="some-change",status="Done"} 1$.*`)
+	c.Check(rec.Body.String(), check.Matches, `(?ms).*^# TYPE snapd_state_lock_hold_seconds histogram$.*`)
+	c.Check(rec.Body.String(), check.Matches, `(?ms).*^# EOF\n\z`)
+}
+
+func (s *metricsSuite) TestMetricsRootOnly(c *check.C) {
+	s.daemonWithOverlordMock(c)
+	req, err := http.NewRequest("GET", "/v2/metrics", nil)
+	c.Assert(err, check.IsNil)
+	cmd, _ := handlerCommand(c, s.d, req)
+	c.Check(cmd.RootOnly, check.Equals, true)
+}
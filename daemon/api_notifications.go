@@ -0,0 +1,129 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/sandbox/cgroup"
+)
+
+var pendingRefreshNotificationCmd = &Command{
+	Path:       "/v2/notifications/pending-refresh",
+	UserPostOK: true,
+	POST:       postPendingRefreshAction,
+}
+
+var (
+	cgroupPidsOfSnap = cgroup.PidsOfSnap
+	cgroupUserOfPid  = cgroup.UserOfPid
+
+	snapstatePostponeRefresh = snapstate.PostponeRefresh
+)
+
+// userRunsSnap returns whether the given user runs any app or hook of
+// the snap.
+func userRunsSnap(uid int, instanceName string) (bool, error) {
+	pids, err := cgroupPidsOfSnap(instanceName)
+	if err != nil {
+		return false, err
+	}
+	for _, tagPids := range pids {
+		for _, pid := range tagPids {
+			if pidUid, err := cgroupUserOfPid(pid); err == nil && pidUid == uid {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// postPendingRefreshAction delivers the choice of a user, made on the
+// notification about a refresh inhibited by running apps.
+func postPendingRefreshAction(c *Command, r *http.Request, user *auth.UserState) Response {
+	var action client.PendingRefreshAction
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&action); err != nil {
+		return BadRequest("cannot decode request body into pending refresh action: %v", err)
+	}
+	if dec.More() {
+		return BadRequest("spurious content after pending refresh action")
+	}
+	if action.InstanceName == "" {
+		return BadRequest("pending refresh action needs a snap")
+	}
+	switch action.Action {
+	case client.PendingRefreshActionRefreshNow, client.PendingRefreshActionPostpone:
+	default:
+		return BadRequest("unknown pending refresh action %q", action.Action)
+	}
+
+	// only the users affected by the refresh can act on it
+	if user == nil {
+		_, uid, _, err := ucrednetGet(r.RemoteAddr)
+		if err != nil {
+			return Forbidden("cannot get remote user: %v", err)
+		}
+		if uid != 0 {
+			running, err := userRunsSnap(int(uid), action.InstanceName)
+			if err != nil {
+				return InternalError("cannot check the users of snap %q: %v", action.InstanceName, err)
+			}
+			if !running {
+				return Forbidden("cannot act on the refresh of snap %q not run by the user", action.InstanceName)
+			}
+		}
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if action.Action == client.PendingRefreshActionPostpone {
+		if err := snapstatePostponeRefresh(st, action.InstanceName); err != nil {
+			if err == state.ErrNoState {
+				return SnapNotFound(action.InstanceName, err)
+			}
+			return BadRequest("%v", err)
+		}
+		return SyncResponse(nil, nil)
+	}
+
+	var userID int
+	if user != nil {
+		userID = user.ID
+	}
+	ts, err := snapstateUpdate(st, action.InstanceName, nil, userID, snapstate.Flags{IsAutoRefresh: true})
+	if err != nil {
+		return errToResponse(err, []string{action.InstanceName}, InternalError, "cannot refresh: %v")
+	}
+	msg := fmt.Sprintf(i18n.G("Refresh %q snap"), action.InstanceName)
+	chg := newChange(st, "refresh-snap", msg, []*state.TaskSet{ts}, []string{action.InstanceName})
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
@@ -0,0 +1,170 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var _ = check.Suite(&notificationsSuite{})
+
+type notificationsSuite struct {
+	apiBaseSuite
+
+	postponed []string
+	updated   []string
+	flags     snapstate.Flags
+}
+
+func (s *notificationsSuite) SetUpTest(c *check.C) {
+	s.apiBaseSuite.SetUpTest(c)
+
+	s.postponed = nil
+	s.updated = nil
+	s.AddCleanup(daemon.MockSnapstatePostponeRefresh(func(st *state.State, name string) error {
+		s.postponed = append(s.postponed, name)
+		return nil
+	}))
+	s.AddCleanup(daemon.MockSnapstateUpdate(func(st *state.State, name string, opts *snapstate.RevisionOptions, userID int, flags snapstate.Flags) (*state.TaskSet, error) {
+		s.updated = append(s.updated, name)
+		s.flags = flags
+		t := st.NewTask("fake-refresh-snap", "Doing a fake refresh")
+		return state.NewTaskSet(t), nil
+	}))
+	// uid 1000 runs foo, uid 1001 runs nothing
+	s.AddCleanup(daemon.MockCgroupPidsOfSnap(func(name string) (map[string][]int, error) {
+		if name == "foo" {
+			return map[string][]int{"snap.foo.app": {100, 101}}, nil
+		}
+		return nil, nil
+	}))
+	s.AddCleanup(daemon.MockCgroupUserOfPid(func(pid int) (int, error) {
+		switch pid {
+		case 100:
+			return 0, errors.New("cannot find the user of pid 100")
+		case 101:
+			return 1000, nil
+		}
+		return -1, errors.New("unexpected pid")
+	}))
+
+	s.daemonWithOverlordMock(c)
+}
+
+func (s *notificationsSuite) pendingRefreshReq(c *check.C, body, remoteAddr string) daemon.Response {
+	req, err := http.NewRequest("POST", "/v2/notifications/pending-refresh", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = remoteAddr
+	return s.req(c, req, nil)
+}
+
+func (s *notificationsSuite) TestUserPostOK(c *check.C) {
+	req, err := http.NewRequest("POST", "/v2/notifications/pending-refresh", nil)
+	c.Assert(err, check.IsNil)
+	cmd, _ := handlerCommand(c, s.d, req)
+	c.Check(cmd.UserPostOK, check.Equals, true)
+}
+
+func (s *notificationsSuite) TestPostpone(c *check.C) {
+	rsp := s.pendingRefreshReq(c, `{"instance-name": "foo", "action": "postpone"}`, "pid=100;uid=1000;socket=;")
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 200,
+		Type:   "sync",
+	})
+	c.Check(s.postponed, check.DeepEquals, []string{"foo"})
+	c.Check(s.updated, check.HasLen, 0)
+}
+
+func (s *notificationsSuite) TestPostponeError(c *check.C) {
+	restore := daemon.MockSnapstatePostponeRefresh(func(st *state.State, name string) error {
+		return errors.New(`no pending refresh of snap "foo"`)
+	})
+	defer restore()
+
+	rsp := s.pendingRefreshReq(c, `{"instance-name": "foo", "action": "postpone"}`, "pid=100;uid=0;socket=;")
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 400,
+		Type:   "error",
+		Result: &daemon.ErrorResult{Message: `no pending refresh of snap "foo"`},
+	})
+}
+
+func (s *notificationsSuite) TestRefreshNow(c *check.C) {
+	rsp := s.pendingRefreshReq(c, `{"instance-name": "foo", "action": "refresh-now"}`, "pid=100;uid=1000;socket=;").(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Check(s.updated, check.DeepEquals, []string{"foo"})
+	c.Check(s.flags, check.DeepEquals, snapstate.Flags{IsAutoRefresh: true})
+	c.Check(s.postponed, check.HasLen, 0)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "refresh-snap")
+	c.Check(chg.Summary(), check.Equals, `Refresh "foo" snap`)
+	var names []string
+	c.Assert(chg.Get("snap-names", &names), check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"foo"})
+}
+
+func (s *notificationsSuite) TestRootCanAct(c *check.C) {
+	rsp := s.pendingRefreshReq(c, `{"instance-name": "bar", "action": "postpone"}`, "pid=100;uid=0;socket=;")
+	c.Check(rsp.(*daemon.Resp).Status, check.Equals, 200)
+	c.Check(s.postponed, check.DeepEquals, []string{"bar"})
+}
+
+func (s *notificationsSuite) TestOtherUsersCannotAct(c *check.C) {
+	rsp := s.pendingRefreshReq(c, `{"instance-name": "foo", "action": "refresh-now"}`, "pid=100;uid=1001;socket=;")
+	c.Check(rsp, check.DeepEquals, &daemon.Resp{
+		Status: 403,
+		Type:   "error",
+		Result: &daemon.ErrorResult{Message: `cannot act on the refresh of snap "foo" not run by the user`},
+	})
+	c.Check(s.updated, check.HasLen, 0)
+}
+
+func (s *notificationsSuite) TestBadRequests(c *check.C) {
+	for _, t := range []struct {
+		body, err string
+	}{
+		{`{"instance-name": "foo", "action": "frobnicate"}`, `unknown pending refresh action "frobnicate"`},
+		{`{"action": "postpone"}`, `pending refresh action needs a snap`},
+		{`{"instance-name": "foo", "action": "postpone"}{}`, `spurious content after pending refresh action`},
+		{`{"instance-name":`, `cannot decode request body into pending refresh action: unexpected EOF`},
+	} {
+		rsp := s.pendingRefreshReq(c, t.body, "pid=100;uid=0;socket=;")
+		c.Check(rsp, check.DeepEquals, &daemon.Resp{
+			Status: 400,
+			Type:   "error",
+			Result: &daemon.ErrorResult{Message: t.err},
+		}, check.Commentf(t.body))
+	}
+	c.Check(s.postponed, check.HasLen, 0)
+	c.Check(s.updated, check.HasLen, 0)
+}
@@ -0,0 +1,210 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/features"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/naming"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+var (
+	quotaGroupsCmd = &Command{
+		Path:     "/v2/quotas",
+		UserOK:   true,
+		PolkitOK: "io.snapcraft.snapd.manage",
+		GET:      getQuotaGroups,
+		POST:     postQuotaGroup,
+	}
+	quotaGroupInfoCmd = &Command{
+		Path:   "/v2/quotas/{group}",
+		UserOK: true,
+		GET:    getQuotaGroupInfo,
+	}
+)
+
+var (
+	servicestateCreateQuota = servicestate.CreateQuota
+	servicestateUpdateQuota = servicestate.UpdateQuota
+	servicestateRemoveQuota = servicestate.RemoveQuota
+)
+
+// postQuotaGroupData is the request body of a POST to /v2/quotas, keep this
+// in sync with client/postQuotaData.
+type postQuotaGroupData struct {
+	// Action can be "ensure" or "remove"
+	Action      string              `json:"action"`
+	GroupName   string              `json:"group-name"`
+	Parent      string              `json:"parent,omitempty"`
+	Snaps       []string            `json:"snaps,omitempty"`
+	Constraints *client.QuotaValues `json:"constraints,omitempty"`
+}
+
+func quotaGroupResult(grp *quota.Group) client.QuotaGroupResult {
+	return client.QuotaGroupResult{
+		GroupName: grp.Name,
+		Parent:    grp.ParentGroup,
+		Subgroups: grp.SubGroups,
+		Snaps:     grp.Snaps,
+		Constraints: &client.QuotaValues{
+			Memory: grp.Limits.Memory,
+			CPU:    grp.Limits.CPU,
+			Tasks:  grp.Limits.Tasks,
+		},
+	}
+}
+
+// getQuotaGroups returns all quota groups sorted by name.
+func getQuotaGroups(c *Command, r *http.Request, _ *auth.UserState) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	quotas, err := servicestate.AllQuotas(st)
+	if err != nil {
+		return InternalError("cannot get quota groups: %v", err)
+	}
+
+	names := make([]string, 0, len(quotas))
+	for name := range quotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]client.QuotaGroupResult, len(names))
+	for i, name := range names {
+		results[i] = quotaGroupResult(quotas[name])
+	}
+	return SyncResponse(results, nil)
+}
+
+// getQuotaGroupInfo returns details of a single quota group.
+func getQuotaGroupInfo(c *Command, r *http.Request, _ *auth.UserState) Response {
+	vars := muxVars(r)
+	groupName := vars["group"]
+	if err := naming.ValidateQuotaGroup(groupName); err != nil {
+		return BadRequest(err.Error())
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	grp, err := servicestate.GetQuota(st, groupName)
+	if err == servicestate.ErrQuotaNotFound {
+		return NotFound("cannot find quota group %q", groupName)
+	}
+	if err != nil {
+		return InternalError("cannot get quota group %q: %v", groupName, err)
+	}
+
+	return SyncResponse(quotaGroupResult(grp), nil)
+}
+
+// postQuotaGroup creates, updates, or removes a quota group.
+func postQuotaGroup(c *Command, r *http.Request, _ *auth.UserState) Response {
+	var data postQuotaGroupData
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&data); err != nil {
+		return BadRequest("cannot decode quota action from request body: %v", err)
+	}
+	if decoder.More() {
+		return BadRequest("extra content found in request body")
+	}
+
+	if err := naming.ValidateQuotaGroup(data.GroupName); err != nil {
+		return BadRequest(err.Error())
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	tr := config.NewTransaction(st)
+	enabled, err := features.Flag(tr, features.QuotaGroups)
+	if err != nil {
+		return InternalError("cannot check for quota groups feature: %v", err)
+	}
+	if !enabled {
+		_, confName := features.QuotaGroups.ConfigOption()
+		return BadRequest("quota groups are disabled, set '%s' to true", confName)
+	}
+
+	var ts *state.TaskSet
+	var summary string
+	switch data.Action {
+	case "ensure":
+		var limits quota.Resources
+		if data.Constraints != nil {
+			limits = quota.Resources{
+				Memory: data.Constraints.Memory,
+				CPU:    data.Constraints.CPU,
+				Tasks:  data.Constraints.Tasks,
+			}
+		}
+		var grp *quota.Group
+		grp, err = servicestate.GetQuota(st, data.GroupName)
+		switch err {
+		case servicestate.ErrQuotaNotFound:
+			ts, err = servicestateCreateQuota(st, data.GroupName, data.Parent, data.Snaps, limits)
+			summary = fmt.Sprintf("Create quota group %q", data.GroupName)
+		case nil:
+			if data.Parent != "" && data.Parent != grp.ParentGroup {
+				return BadRequest("cannot move quota group %q to a different parent", data.GroupName)
+			}
+			ts, err = servicestateUpdateQuota(st, data.GroupName, servicestate.QuotaGroupUpdate{
+				AddSnaps:  data.Snaps,
+				NewLimits: limits,
+			})
+			summary = fmt.Sprintf("Update quota group %q", data.GroupName)
+		}
+	case "remove":
+		ts, err = servicestateRemoveQuota(st, data.GroupName)
+		summary = fmt.Sprintf("Remove quota group %q", data.GroupName)
+	default:
+		return BadRequest("unknown quota action %q", data.Action)
+	}
+	if err == servicestate.ErrQuotaNotFound {
+		return NotFound("cannot find quota group %q", data.GroupName)
+	}
+	if err != nil {
+		if cce, ok := err.(*snapstate.ChangeConflictError); ok {
+			return SnapChangeConflict(cce)
+		}
+		return BadRequest(err.Error())
+	}
+
+	chg := newChange(st, "quota-control", summary, []*state.TaskSet{ts}, data.Snaps)
+	ensureStateSoon(st)
+
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
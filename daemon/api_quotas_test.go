@@ -0,0 +1,324 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+var _ = check.Suite(&apiQuotaSuite{})
+
+type apiQuotaSuite struct {
+	apiBaseSuite
+
+	ensureSoonCalled int
+}
+
+func (s *apiQuotaSuite) SetUpTest(c *check.C) {
+	s.apiBaseSuite.SetUpTest(c)
+	d := s.daemon(c)
+
+	s.ensureSoonCalled = 0
+	_, restore := daemon.MockEnsureStateSoon(func(st *state.State) {
+		s.ensureSoonCalled++
+	})
+	s.AddCleanup(restore)
+
+	st := d.Overlord().State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "experimental.quota-groups", true)
+	tr.Commit()
+	st.Unlock()
+}
+
+func mockQuotas(st *state.State, c *check.C) {
+	st.Lock()
+	defer st.Unlock()
+	grps := map[string]*quota.Group{
+		"foo": {
+			Name:      "foo",
+			SubGroups: []string{"bar"},
+			Snaps:     []string{"test-snap"},
+			Limits:    quota.Resources{Memory: quantity.SizeGiB},
+		},
+		"bar": {
+			Name:        "bar",
+			ParentGroup: "foo",
+			Limits:      quota.Resources{Memory: quantity.SizeMiB},
+		},
+		"baz": {
+			Name:   "baz",
+			Limits: quota.Resources{Tasks: 32, CPU: 50},
+		},
+	}
+	c.Assert(quota.ResolveCrossReferences(grps), check.IsNil)
+	st.Set("quotas", grps)
+}
+
+func (s *apiQuotaSuite) postQuota(c *check.C, data interface{}) daemon.Response {
+	body, err := json.Marshal(data)
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/v2/quotas", bytes.NewReader(body))
+	c.Assert(err, check.IsNil)
+	return s.req(c, req, nil)
+}
+
+func (s *apiQuotaSuite) TestPostQuotaFeatureDisabled(c *check.C) {
+	st := s.d.Overlord().State()
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "experimental.quota-groups", false)
+	tr.Commit()
+	st.Unlock()
+
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "booze",
+	}).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Equals, `quota groups are disabled, set 'experimental.quota-groups' to true`)
+}
+
+func (s *apiQuotaSuite) TestPostQuotaUnknownAction(c *check.C) {
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":     "foo",
+		"group-name": "bar",
+	}).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Equals, `unknown quota action "foo"`)
+}
+
+func (s *apiQuotaSuite) TestPostQuotaInvalidGroupName(c *check.C) {
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "$$$",
+	}).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Matches, `invalid quota group name.*`)
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaCreate(c *check.C) {
+	var called int
+	r := daemon.MockServicestateCreateQuota(func(st *state.State, name string, parentName string, snaps []string, limits quota.Resources) (*state.TaskSet, error) {
+		called++
+		c.Check(name, check.Equals, "booze")
+		c.Check(parentName, check.Equals, "foo")
+		c.Check(snaps, check.DeepEquals, []string{"bar"})
+		c.Check(limits, check.Equals, quota.Resources{Memory: 1000 * quantity.SizeKiB})
+		return state.NewTaskSet(st.NewTask("foo-quota", "...")), nil
+	})
+	defer r()
+
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":      "ensure",
+		"group-name":  "booze",
+		"parent":      "foo",
+		"snaps":       []string{"bar"},
+		"constraints": map[string]interface{}{"memory": 1000 * quantity.SizeKiB},
+	}).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeAsync)
+	c.Check(called, check.Equals, 1)
+	c.Check(s.ensureSoonCalled, check.Equals, 1)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "quota-control")
+	c.Check(chg.Summary(), check.Equals, `Create quota group "booze"`)
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaCreateFails(c *check.C) {
+	r := daemon.MockServicestateCreateQuota(func(st *state.State, name string, parentName string, snaps []string, limits quota.Resources) (*state.TaskSet, error) {
+		return nil, &snapstate.ChangeConflictError{Snap: "bar", ChangeKind: "remove"}
+	})
+	defer r()
+
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":      "ensure",
+		"group-name":  "booze",
+		"snaps":       []string{"bar"},
+		"constraints": map[string]interface{}{"memory": 1000},
+	}).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 409)
+	c.Check(rsp.ErrorResult().Kind, check.Equals, client.ErrorKindSnapChangeConflict)
+
+	r = daemon.MockServicestateCreateQuota(func(st *state.State, name string, parentName string, snaps []string, limits quota.Resources) (*state.TaskSet, error) {
+		return nil, servicestate.ErrQuotaNotFound
+	})
+	defer r()
+	rsp = s.postQuota(c, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "booze",
+	}).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 404)
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaUpdate(c *check.C) {
+	mockQuotas(s.d.Overlord().State(), c)
+
+	var called int
+	r := daemon.MockServicestateUpdateQuota(func(st *state.State, name string, opts servicestate.QuotaGroupUpdate) (*state.TaskSet, error) {
+		called++
+		c.Check(name, check.Equals, "baz")
+		c.Check(opts, check.DeepEquals, servicestate.QuotaGroupUpdate{
+			AddSnaps:  []string{"some-snap"},
+			NewLimits: quota.Resources{Tasks: 64},
+		})
+		return state.NewTaskSet(st.NewTask("foo-quota", "...")), nil
+	})
+	defer r()
+
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":      "ensure",
+		"group-name":  "baz",
+		"snaps":       []string{"some-snap"},
+		"constraints": map[string]interface{}{"tasks": 64},
+	}).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Check(called, check.Equals, 1)
+	c.Check(s.ensureSoonCalled, check.Equals, 1)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Summary(), check.Equals, `Update quota group "baz"`)
+}
+
+func (s *apiQuotaSuite) TestPostEnsureQuotaUpdateCannotChangeParent(c *check.C) {
+	mockQuotas(s.d.Overlord().State(), c)
+
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":     "ensure",
+		"group-name": "bar",
+		"parent":     "baz",
+	}).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Equals, `cannot move quota group "bar" to a different parent`)
+}
+
+func (s *apiQuotaSuite) TestPostRemoveQuota(c *check.C) {
+	var called int
+	r := daemon.MockServicestateRemoveQuota(func(st *state.State, name string) (*state.TaskSet, error) {
+		called++
+		c.Check(name, check.Equals, "booze")
+		return state.NewTaskSet(st.NewTask("foo-quota", "...")), nil
+	})
+	defer r()
+
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":     "remove",
+		"group-name": "booze",
+	}).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 202)
+	c.Check(called, check.Equals, 1)
+	c.Check(s.ensureSoonCalled, check.Equals, 1)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Summary(), check.Equals, `Remove quota group "booze"`)
+}
+
+func (s *apiQuotaSuite) TestPostRemoveQuotaNotFound(c *check.C) {
+	rsp := s.postQuota(c, map[string]interface{}{
+		"action":     "remove",
+		"group-name": "booze",
+	}).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 404)
+	c.Check(rsp.ErrorResult().Message, check.Equals, `cannot find quota group "booze"`)
+}
+
+func (s *apiQuotaSuite) TestListQuotas(c *check.C) {
+	mockQuotas(s.d.Overlord().State(), c)
+
+	req, err := http.NewRequest("GET", "/v2/quotas", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, []client.QuotaGroupResult{
+		{
+			GroupName:   "bar",
+			Parent:      "foo",
+			Constraints: &client.QuotaValues{Memory: quantity.SizeMiB},
+		},
+		{
+			GroupName:   "baz",
+			Constraints: &client.QuotaValues{Tasks: 32, CPU: 50},
+		},
+		{
+			GroupName:   "foo",
+			Subgroups:   []string{"bar"},
+			Snaps:       []string{"test-snap"},
+			Constraints: &client.QuotaValues{Memory: quantity.SizeGiB},
+		},
+	})
+}
+
+func (s *apiQuotaSuite) TestListQuotasNone(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/quotas", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.HasLen, 0)
+}
+
+func (s *apiQuotaSuite) TestGetQuota(c *check.C) {
+	mockQuotas(s.d.Overlord().State(), c)
+
+	req, err := http.NewRequest("GET", "/v2/quotas/foo", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, client.QuotaGroupResult{
+		GroupName:   "foo",
+		Subgroups:   []string{"bar"},
+		Snaps:       []string{"test-snap"},
+		Constraints: &client.QuotaValues{Memory: quantity.SizeGiB},
+	})
+}
+
+func (s *apiQuotaSuite) TestGetQuotaNotFound(c *check.C) {
+	req, err := http.NewRequest("GET", "/v2/quotas/unknown", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 404)
+	c.Check(rsp.ErrorResult().Message, check.Equals, `cannot find quota group "unknown"`)
+}
@@ -0,0 +1,66 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"net/http"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var snapVerifyCmd = &Command{
+	Path:   "/v2/snaps/{name}/verify",
+	UserOK: true,
+	GET:    getSnapVerify,
+}
+
+func getSnapVerify(c *Command, r *http.Request, user *auth.UserState) Response {
+	vars := muxVars(r)
+	name := vars["name"]
+
+	st := c.d.overlord.State()
+	st.Lock()
+	check, err := snapstate.NewSnapFileCheck(st, name)
+	st.Unlock()
+	switch err {
+	case nil:
+		// ok
+	case state.ErrNoState:
+		return SnapNotFound(name, err)
+	case snapstate.ErrSnapNotAsserted:
+		return BadRequest("cannot verify snap %q: %v", name, err)
+	default:
+		return InternalError("cannot verify snap %q: %v", name, err)
+	}
+
+	err = check.Run()
+	if _, ok := err.(*snapstate.SnapIntegrityError); err != nil && !ok {
+		return InternalError("cannot verify snap %q: %v", name, err)
+	}
+	return SyncResponse(&client.SnapVerification{
+		Snap:     name,
+		Revision: check.Info.Revision,
+		SHA3_384: check.SHA3_384,
+		Verified: err == nil,
+	}, nil)
+}
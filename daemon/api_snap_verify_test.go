@@ -0,0 +1,132 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/daemon"
+	"github.com/snapcore/snapd/overlord/assertstate/assertstatetest"
+	"github.com/snapcore/snapd/snap"
+)
+
+var _ = check.Suite(&snapVerifySuite{})
+
+type snapVerifySuite struct {
+	apiBaseSuite
+}
+
+// mockAssertedSnap installs the given snap with a snap-revision
+// assertion matching its file.
+func (s *snapVerifySuite) mockAssertedSnap(c *check.C, d *daemon.Daemon, name string, revision snap.Revision) *snap.Info {
+	info := s.mkInstalledInState(c, d, name, "", "v1", revision, true, "")
+
+	devAcct := assertstest.NewAccount(s.StoreSigning, "devel", map[string]interface{}{
+		"account-id": "devel-id",
+	}, "")
+	snapDecl, err := s.StoreSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      info.SnapID,
+		"snap-name":    name,
+		"publisher-id": devAcct.AccountID(),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+	digest, size, err := asserts.SnapFileSHA3_384(info.MountFile())
+	c.Assert(err, check.IsNil)
+	snapRev, err := s.StoreSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+		"snap-sha3-384": digest,
+		"snap-size":     fmt.Sprintf("%d", size),
+		"snap-id":       info.SnapID,
+		"snap-revision": revision.String(),
+		"developer-id":  devAcct.AccountID(),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+
+	st := d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	assertstatetest.AddMany(st, s.StoreSigning.StoreAccountKey(""), devAcct, snapDecl, snapRev)
+
+	return info
+}
+
+func (s *snapVerifySuite) TestVerifySnap(c *check.C) {
+	d := s.daemon(c)
+	info := s.mockAssertedSnap(c, d, "foo", snap.R(10))
+	digest, _, err := asserts.SnapFileSHA3_384(info.MountFile())
+	c.Assert(err, check.IsNil)
+
+	req, err := http.NewRequest("GET", "/v2/snaps/foo/verify", nil)
+	c.Assert(err, check.IsNil)
+	s.checkGetOnly(c, req)
+
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result, check.DeepEquals, &client.SnapVerification{
+		Snap:     "foo",
+		Revision: snap.R(10),
+		SHA3_384: digest,
+		Verified: true,
+	})
+}
+
+func (s *snapVerifySuite) TestVerifySnapMismatch(c *check.C) {
+	d := s.daemon(c)
+	info := s.mockAssertedSnap(c, d, "foo", snap.R(10))
+	c.Assert(ioutil.WriteFile(info.MountFile(), []byte("tampered"), 0644), check.IsNil)
+
+	req, err := http.NewRequest("GET", "/v2/snaps/foo/verify", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 200)
+	c.Check(rsp.Result.(*client.SnapVerification).Verified, check.Equals, false)
+}
+
+func (s *snapVerifySuite) TestVerifySnapNotAsserted(c *check.C) {
+	d := s.daemon(c)
+	s.mkInstalledInState(c, d, "foo", "", "v1", snap.R(-1), true, "")
+
+	req, err := http.NewRequest("GET", "/v2/snaps/foo/verify", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeError)
+	c.Assert(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, `cannot verify snap "foo": snap has no snap-revision assertion`)
+}
+
+func (s *snapVerifySuite) TestVerifySnapNotFound(c *check.C) {
+	s.daemon(c)
+
+	req, err := http.NewRequest("GET", "/v2/snaps/foo/verify", nil)
+	c.Assert(err, check.IsNil)
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 404)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Kind, check.Equals, client.ErrorKindSnapNotFound)
+}
@@ -26,11 +26,13 @@ import (
 	"mime"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/strutil"
@@ -90,6 +92,17 @@ func snapOpMany(c *Command, r *http.Request, user *auth.UserState) Response {
 		return BadRequest("%v", err)
 	}
 
+	if inst.Action == "hold" && inst.Hold == "forever" {
+		// only administrators can hold refreshes forever
+		_, uid, _, err := ucrednetGet(r.RemoteAddr)
+		if err != nil {
+			return Forbidden("cannot get remote user: %v", err)
+		}
+		if uid != 0 {
+			return Forbidden("only administrators can hold refreshes forever")
+		}
+	}
+
 	st := c.d.overlord.State()
 	st.Lock()
 	defer st.Unlock()
@@ -134,6 +147,10 @@ func (inst *snapInstruction) dispatchForMany() (op snapManyActionFunc) {
 	case "snapshot":
 		// see api_snapshots.go
 		op = snapshotMany
+	case "hold":
+		op = snapHoldMany
+	case "unhold":
+		op = snapUnholdMany
 	}
 	return op
 }
@@ -229,6 +246,61 @@ func snapRemoveMany(inst *snapInstruction, st *state.State) (*snapInstructionRes
 	}, nil
 }
 
+func snapHoldMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
+	var duration time.Duration
+	switch inst.Hold {
+	case "":
+		return nil, fmt.Errorf("hold duration must be specified")
+	case "forever":
+		duration = snapstate.HoldForever
+	default:
+		var err error
+		duration, err = time.ParseDuration(inst.Hold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hold duration %q: %v", inst.Hold, err)
+		}
+	}
+	if err := snapstateHoldRefreshesByUser(st, duration, inst.Snaps); err != nil {
+		return nil, err
+	}
+
+	var msg string
+	switch len(inst.Snaps) {
+	case 1:
+		msg = fmt.Sprintf(i18n.G("Hold refreshes of snap %q"), inst.Snaps[0])
+	default:
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		msg = fmt.Sprintf(i18n.G("Hold refreshes of snaps %s"), strutil.Quoted(inst.Snaps))
+	}
+
+	return &snapInstructionResult{
+		Summary:  msg,
+		Affected: inst.Snaps,
+	}, nil
+}
+
+func snapUnholdMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
+	if err := snapstateUnholdRefreshesByUser(st, inst.Snaps); err != nil {
+		return nil, err
+	}
+
+	var msg string
+	switch len(inst.Snaps) {
+	case 0:
+		msg = i18n.G("Release refresh holds of all snaps")
+	case 1:
+		msg = fmt.Sprintf(i18n.G("Release refresh hold of snap %q"), inst.Snaps[0])
+	default:
+		// TRANSLATORS: the %s is a comma-separated list of quoted snap names
+		msg = fmt.Sprintf(i18n.G("Release refresh holds of snaps %s"), strutil.Quoted(inst.Snaps))
+	}
+
+	return &snapInstructionResult{
+		Summary:  msg,
+		Affected: inst.Snaps,
+	}, nil
+}
+
 // query many snaps
 func getSnapsInfo(c *Command, r *http.Request, user *auth.UserState) Response {
 
@@ -33,6 +33,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -41,7 +42,7 @@ import (
 	//"github.com/snapcore/snapd/asserts/assertstest"
 	//"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/daemon"
-	//"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	//"github.com/snapcore/snapd/overlord/assertstate/assertstatetest"
 	"github.com/snapcore/snapd/overlord/auth"
@@ -477,6 +478,111 @@ func (s *snapsSuite) TestPostSnapsNoWeirdses(c *check.C) {
 	}
 }
 
+func (s *snapsSuite) TestHoldMany(c *check.C) {
+	var holdDuration time.Duration
+	defer daemon.MockSnapstateHoldRefreshesByUser(func(_ *state.State, duration time.Duration, names []string) error {
+		holdDuration = duration
+		c.Check(names, check.DeepEquals, []string{"foo", "bar"})
+		return nil
+	})()
+
+	d := s.daemon(c)
+	inst := &daemon.SnapInstruction{Action: "hold", Snaps: []string{"foo", "bar"}, Hold: "72h"}
+	st := d.Overlord().State()
+	st.Lock()
+	res, err := inst.DispatchForMany()(inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(res.Summary, check.Equals, `Hold refreshes of snaps "foo", "bar"`)
+	c.Check(res.Affected, check.DeepEquals, inst.Snaps)
+	c.Check(res.Tasksets, check.HasLen, 0)
+	c.Check(holdDuration, check.Equals, 72*time.Hour)
+
+	inst.Hold = "forever"
+	st.Lock()
+	_, err = inst.DispatchForMany()(inst, st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Check(holdDuration, check.Equals, snapstate.HoldForever)
+
+	for _, hold := range []string{"", "potato"} {
+		inst.Hold = hold
+		st.Lock()
+		_, err = inst.DispatchForMany()(inst, st)
+		st.Unlock()
+		c.Check(err, check.NotNil)
+	}
+}
+
+func (s *snapsSuite) TestUnholdMany(c *check.C) {
+	var unheld []string
+	defer daemon.MockSnapstateUnholdRefreshesByUser(func(_ *state.State, names []string) error {
+		unheld = names
+		return nil
+	})()
+
+	d := s.daemon(c)
+	st := d.Overlord().State()
+	for _, tst := range []struct {
+		snaps []string
+		msg   string
+	}{
+		{nil, "Release refresh holds of all snaps"},
+		{[]string{"foo"}, `Release refresh hold of snap "foo"`},
+		{[]string{"foo", "bar"}, `Release refresh holds of snaps "foo", "bar"`},
+	} {
+		inst := &daemon.SnapInstruction{Action: "unhold", Snaps: tst.snaps}
+		st.Lock()
+		res, err := inst.DispatchForMany()(inst, st)
+		st.Unlock()
+		c.Assert(err, check.IsNil)
+		c.Check(res.Summary, check.Equals, tst.msg)
+		c.Check(unheld, check.DeepEquals, tst.snaps)
+	}
+}
+
+func (s *snapsSuite) TestPostSnapsHoldForeverOnlyRoot(c *check.C) {
+	holdCalled := 0
+	defer daemon.MockSnapstateHoldRefreshesByUser(func(_ *state.State, duration time.Duration, names []string) error {
+		holdCalled++
+		c.Check(duration, check.Equals, snapstate.HoldForever)
+		return nil
+	})()
+	var uid uint32 = 1000
+	defer daemon.MockUcrednetGet(func(string) (int32, uint32, string, error) {
+		return 100, uid, dirs.SnapdSocket, nil
+	})()
+
+	s.daemonWithOverlordMockAndStore(c)
+
+	req, err := http.NewRequest("POST", "/v2/snaps", strings.NewReader(`{"action": "hold", "snaps": ["foo"], "hold": "forever"}`))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 403)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, `only administrators can hold refreshes forever`)
+	c.Check(holdCalled, check.Equals, 0)
+
+	uid = 0
+	req, err = http.NewRequest("POST", "/v2/snaps", strings.NewReader(`{"action": "hold", "snaps": ["foo"], "hold": "forever"}`))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+	rsp = s.req(c, req, nil).(*daemon.Resp)
+	c.Check(rsp.Type, check.Equals, daemon.ResponseTypeAsync)
+	c.Check(holdCalled, check.Equals, 1)
+}
+
+func (s *snapsSuite) TestPostSnapsHoldOnlyForHold(c *check.C) {
+	s.daemonWithOverlordMockAndStore(c)
+
+	req, err := http.NewRequest("POST", "/v2/snaps", strings.NewReader(`{"action": "remove", "snaps": ["foo"], "hold": "1h"}`))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/json")
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Check(rsp.Status, check.Equals, 400)
+	c.Check(rsp.Result.(*daemon.ErrorResult).Message, check.Equals, `hold can only be specified for hold`)
+}
+
 func (s *snapsSuite) TestPostSnapsOp(c *check.C) {
 	s.testPostSnapsOp(c, "application/json")
 }
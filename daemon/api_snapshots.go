@@ -21,6 +21,7 @@ package daemon
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -77,6 +78,8 @@ type snapshotAction struct {
 	Action string   `json:"action"`
 	Snaps  []string `json:"snaps,omitempty"`
 	Users  []string `json:"users,omitempty"`
+	// Key is needed to check or restore encrypted snapshots
+	Key []byte `json:"key,omitempty"`
 }
 
 func (action snapshotAction) String() string {
@@ -125,13 +128,16 @@ func changeSnapshots(c *Command, r *http.Request, user *auth.UserState) Response
 
 	switch action.Action {
 	case "check":
-		affected, ts, err = snapshotCheck(st, action.SetID, action.Snaps, action.Users)
+		affected, ts, err = snapshotCheck(st, action.SetID, action.Snaps, action.Users, action.Key)
 	case "restore":
-		affected, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users)
+		affected, ts, err = snapshotRestore(st, action.SetID, action.Snaps, action.Users, action.Key)
 	case "forget":
 		if len(action.Users) != 0 {
 			return BadRequest(`snapshot "forget" operation cannot specify users`)
 		}
+		if action.Key != nil {
+			return BadRequest(`snapshot "forget" operation cannot specify a key`)
+		}
 		affected, ts, err = snapshotForget(st, action.SetID, action.Snaps)
 	default:
 		return BadRequest("unknown snapshot operation %q", action.Action)
@@ -191,12 +197,19 @@ func doSnapshotImport(c *Command, r *http.Request, user *auth.UserState) Respons
 	if err != nil {
 		return BadRequest("cannot parse Content-Length: %v", err)
 	}
+	var key []byte
+	if encodedKey := r.Header.Get(client.SnapshotKeyHeader); encodedKey != "" {
+		key, err = base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return BadRequest("cannot decode snapshot key: %v", err)
+		}
+	}
 	// ensure we don't read more than we expect
 	limitedBodyReader := io.LimitReader(r.Body, expectedSize)
 
 	// XXX: check that we have enough space to import the compressed snapshots
 	st := c.d.overlord.State()
-	setID, snapNames, err := snapshotImport(context.TODO(), st, limitedBodyReader)
+	setID, snapNames, err := snapshotImport(context.TODO(), st, limitedBodyReader, key)
 	if err != nil {
 		return BadRequest(err.Error())
 	}
@@ -206,7 +219,7 @@ func doSnapshotImport(c *Command, r *http.Request, user *auth.UserState) Respons
 }
 
 func snapshotMany(inst *snapInstruction, st *state.State) (*snapInstructionResult, error) {
-	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users)
+	setID, snapshotted, ts, err := snapshotSave(st, inst.Snaps, inst.Users, inst.SnapshotKey)
 	if err != nil {
 		return nil, err
 	}
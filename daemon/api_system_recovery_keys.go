@@ -20,29 +20,51 @@
 package daemon
 
 import (
+	"encoding/json"
 	"net/http"
 	"path/filepath"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/secboot"
 )
 
 var systemRecoveryKeysCmd = &Command{
 	Path:     "/v2/system-recovery-keys",
 	GET:      getSystemRecoveryKeys,
+	POST:     postSystemRecoveryKeys,
 	RootOnly: true,
 }
 
 func getSystemRecoveryKeys(c *Command, r *http.Request, user *auth.UserState) Response {
 	var rsp client.SystemRecoveryKeysResponse
 
-	rkey, err := secboot.RecoveryKeyFromFile(filepath.Join(dirs.SnapFDEDir, "recovery.key"))
+	st := c.d.overlord.State()
+	st.Lock()
+	last, err := devicestate.LastRecoveryKeyChange(st)
+	st.Unlock()
 	if err != nil {
 		return InternalError(err.Error())
 	}
-	rsp.RecoveryKey = rkey.String()
+	if last != nil {
+		rsp.LastChange = &client.RecoveryKeyChange{
+			Action: last.Action,
+			Time:   last.Time,
+		}
+	}
+
+	// there is no recovery key anymore once it was removed
+	if last == nil || last.Action != "remove" {
+		rkey, err := secboot.RecoveryKeyFromFile(filepath.Join(dirs.SnapFDEDir, "recovery.key"))
+		if err != nil {
+			return InternalError(err.Error())
+		}
+		rsp.RecoveryKey = rkey.String()
+	}
 
 	reinstallKey, err := secboot.RecoveryKeyFromFile(filepath.Join(dirs.SnapFDEDir, "reinstall.key"))
 	if err != nil {
@@ -52,3 +74,49 @@ func getSystemRecoveryKeys(c *Command, r *http.Request, user *auth.UserState) Re
 
 	return SyncResponse(&rsp, nil)
 }
+
+var (
+	devicestateRotateRecoveryKey  = devicestate.RotateRecoveryKey
+	devicestateRemoveRecoveryKeys = devicestate.RemoveRecoveryKeys
+)
+
+type recoveryKeysRequest struct {
+	Action string `json:"action"`
+}
+
+func postSystemRecoveryKeys(c *Command, r *http.Request, user *auth.UserState) Response {
+	var req recoveryKeysRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&req); err != nil {
+		return BadRequest("cannot decode request body into recovery keys action: %v", err)
+	}
+	if decoder.More() {
+		return BadRequest("extra content found in request body")
+	}
+
+	var change func(st *state.State) (*state.Change, error)
+	switch req.Action {
+	case "rotate":
+		change = devicestateRotateRecoveryKey
+	case "remove":
+		change = devicestateRemoveRecoveryKeys
+	default:
+		return BadRequest("unsupported recovery keys action %q", req.Action)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	chg, err := change(st)
+	if err != nil {
+		if cce, ok := err.(*snapstate.ChangeConflictError); ok {
+			return SnapChangeConflict(cce)
+		}
+		return BadRequest("cannot %s recovery keys: %v", req.Action, err)
+	}
+
+	ensureStateSoon(st)
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
@@ -21,17 +21,24 @@ package daemon_test
 
 import (
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/daemon"
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/secboot"
 )
 
@@ -90,3 +97,133 @@ func (s *recoveryKeysSuite) TestSystemGetRecoveryAsUserErrors(c *C) {
 	s.serveHTTP(c, rec, req)
 	c.Assert(rec.Code, Equals, 401)
 }
+
+func (s *recoveryKeysSuite) TestSystemGetRecoveryKeysRemoved(c *C) {
+	d := s.daemon(c)
+	mockSystemRecoveryKeys(c)
+	c.Assert(os.Remove(filepath.Join(dirs.SnapFDEDir, "recovery.key")), IsNil)
+
+	removed := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	st := d.Overlord().State()
+	st.Lock()
+	st.Set("recovery-key-change", &devicestate.RecoveryKeyChange{
+		Action: "remove",
+		Time:   removed,
+	})
+	st.Unlock()
+
+	req, err := http.NewRequest("GET", "/v2/system-recovery-keys", nil)
+	c.Assert(err, IsNil)
+
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, Equals, 200)
+	srk := rsp.Result.(*client.SystemRecoveryKeysResponse)
+	reinstallKey := secboot.RecoveryKey{'1', '2', '3', '4', '5', '6', '7', '8', '9', '0', '1', '2', '3', '4', '5', '6'}
+	c.Assert(srk, DeepEquals, &client.SystemRecoveryKeysResponse{
+		ReinstallKey: reinstallKey.String(),
+		LastChange: &client.RecoveryKeyChange{
+			Action: "remove",
+			Time:   removed,
+		},
+	})
+}
+
+func (s *recoveryKeysSuite) TestSystemPostRecoveryKeysHappy(c *C) {
+	d := s.daemon(c)
+	st := d.Overlord().State()
+
+	ensureSoonCalled := 0
+	_, restore := daemon.MockEnsureStateSoon(func(st *state.State) {
+		ensureSoonCalled++
+	})
+	defer restore()
+
+	called := ""
+	restore = daemon.MockDevicestateRotateRecoveryKey(func(st *state.State) (*state.Change, error) {
+		called = "rotate"
+		return st.NewChange("rotate-recovery-key", "..."), nil
+	})
+	defer restore()
+	restore = daemon.MockDevicestateRemoveRecoveryKeys(func(st *state.State) (*state.Change, error) {
+		called = "remove"
+		return st.NewChange("remove-recovery-keys", "..."), nil
+	})
+	defer restore()
+
+	for _, tc := range []struct {
+		action, kind string
+	}{
+		{"rotate", "rotate-recovery-key"},
+		{"remove", "remove-recovery-keys"},
+	} {
+		ensureSoonCalled = 0
+		body := `{"action":"` + tc.action + `"}`
+		req, err := http.NewRequest("POST", "/v2/system-recovery-keys", strings.NewReader(body))
+		c.Assert(err, IsNil)
+		req.RemoteAddr = "pid=100;uid=0;socket=;"
+
+		rec := httptest.NewRecorder()
+		s.serveHTTP(c, rec, req)
+		c.Check(rec.Code, Equals, 202)
+		c.Check(called, Equals, tc.action)
+		c.Check(ensureSoonCalled, Equals, 1)
+
+		var rsp map[string]interface{}
+		c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+		st.Lock()
+		chg := st.Change(rsp["change"].(string))
+		st.Unlock()
+		c.Assert(chg, NotNil)
+		c.Check(chg.Kind(), Equals, tc.kind)
+	}
+}
+
+func (s *recoveryKeysSuite) TestSystemPostRecoveryKeysUnhappy(c *C) {
+	s.daemon(c)
+
+	for _, tc := range []struct {
+		body             string
+		changeErr        error
+		expectedHttpCode int
+		expectedErr      string
+	}{
+		{`{"action":"frobnicate"}`, nil, 400, `unsupported recovery keys action "frobnicate"`},
+		{`{"action":"rotate"}{}`, nil, 400, "extra content found in request body"},
+		{`{"action":"rotate"}`, errors.New("boom"), 400, "cannot rotate recovery keys: boom"},
+		{`{"action":"rotate"}`, &snapstate.ChangeConflictError{
+			ChangeKind: "rotate-recovery-key",
+			Message:    "cannot change the recovery key, another change of the recovery key is in progress",
+		}, 409, "cannot change the recovery key, another change of the recovery key is in progress"},
+	} {
+		restore := daemon.MockDevicestateRotateRecoveryKey(func(st *state.State) (*state.Change, error) {
+			c.Check(tc.changeErr, NotNil)
+			return nil, tc.changeErr
+		})
+		defer restore()
+
+		req, err := http.NewRequest("POST", "/v2/system-recovery-keys", strings.NewReader(tc.body))
+		c.Assert(err, IsNil)
+		req.RemoteAddr = "pid=100;uid=0;socket=;"
+
+		rec := httptest.NewRecorder()
+		s.serveHTTP(c, rec, req)
+		c.Check(rec.Code, Equals, tc.expectedHttpCode)
+
+		var rspBody map[string]interface{}
+		c.Assert(json.Unmarshal(rec.Body.Bytes(), &rspBody), IsNil)
+		result := rspBody["result"].(map[string]interface{})
+		c.Check(result["message"], Equals, tc.expectedErr)
+	}
+}
+
+func (s *recoveryKeysSuite) TestSystemPostRecoveryKeysAsUserErrors(c *C) {
+	s.daemon(c)
+
+	req, err := http.NewRequest("POST", "/v2/system-recovery-keys", strings.NewReader(`{"action":"rotate"}`))
+	c.Assert(err, IsNil)
+
+	req.RemoteAddr = "pid=100;uid=1000;socket=;"
+	rec := httptest.NewRecorder()
+	s.serveHTTP(c, rec, req)
+	c.Assert(rec.Code, Equals, 401)
+}
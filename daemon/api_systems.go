@@ -27,6 +27,7 @@ import (
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/snap"
 )
 
@@ -100,6 +101,8 @@ func getSystems(c *Command, r *http.Request, user *auth.UserState) Response {
 
 type systemActionRequest struct {
 	Action string `json:"action"`
+	// Label of the system to create
+	Label string `json:"label,omitempty"`
 	client.SystemAction
 }
 
@@ -119,6 +122,8 @@ func postSystemsAction(c *Command, r *http.Request, user *auth.UserState) Respon
 		return postSystemActionDo(c, systemLabel, &req)
 	case "reboot":
 		return postSystemActionReboot(c, systemLabel, &req)
+	case "create":
+		return postSystemActionCreate(c, systemLabel, &req)
 	default:
 		return BadRequest("unsupported action %q", req.Action)
 	}
@@ -167,3 +172,29 @@ func postSystemActionDo(c *Command, systemLabel string, req *systemActionRequest
 	}
 	return SyncResponse(nil, nil)
 }
+
+var devicestateCreateRecoverySystem = devicestate.CreateRecoverySystem
+
+func postSystemActionCreate(c *Command, systemLabel string, req *systemActionRequest) Response {
+	if systemLabel != "" {
+		return BadRequest("cannot create a system using an existing system label")
+	}
+	if req.Label == "" {
+		return BadRequest("system create action requires the label to be provided")
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	chg, err := devicestateCreateRecoverySystem(st, req.Label)
+	if err != nil {
+		if cce, ok := err.(*snapstate.ChangeConflictError); ok {
+			return SnapChangeConflict(cce)
+		}
+		return BadRequest("cannot create recovery system %q: %v", req.Label, err)
+	}
+
+	ensureStateSoon(st)
+	return AsyncResponse(nil, &Meta{Change: chg.ID()})
+}
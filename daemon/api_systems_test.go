@@ -42,6 +42,7 @@ import (
 	"github.com/snapcore/snapd/overlord/assertstate/assertstatetest"
 	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/seed"
 	"github.com/snapcore/snapd/seed/seedtest"
@@ -183,6 +184,7 @@ func (s *systemsSuite) TestSystemsGetSome(c *check.C) {
 				Actions: []client.SystemAction{
 					{Title: "Reinstall", Mode: "install"},
 					{Title: "Recover", Mode: "recover"},
+					{Title: "Factory reset", Mode: "factory-reset"},
 					{Title: "Run normally", Mode: "run"},
 				},
 			},
@@ -676,3 +678,80 @@ func (s *systemsSuite) TestSystemRebootUnhappy(c *check.C) {
 		c.Check(result["message"], check.Equals, tc.expectedErr)
 	}
 }
+
+func (s *systemsSuite) TestSystemCreateHappy(c *check.C) {
+	d := s.daemon(c)
+	st := d.Overlord().State()
+
+	ensureSoonCalled := 0
+	_, restore := daemon.MockEnsureStateSoon(func(st *state.State) {
+		ensureSoonCalled++
+	})
+	defer restore()
+
+	called := 0
+	restore = daemon.MockDevicestateCreateRecoverySystem(func(st *state.State, label string) (*state.Change, error) {
+		called++
+		c.Check(label, check.Equals, "1234")
+		return st.NewChange("create-recovery-system", "..."), nil
+	})
+	defer restore()
+
+	body := `{"action":"create", "label":"1234"}`
+	req, err := http.NewRequest("POST", "/v2/systems", strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	req.RemoteAddr = "pid=100;uid=0;socket=;"
+
+	rec := httptest.NewRecorder()
+	s.serveHTTP(c, rec, req)
+	c.Check(rec.Code, check.Equals, 202)
+	c.Check(called, check.Equals, 1)
+	c.Check(ensureSoonCalled, check.Equals, 1)
+
+	var rsp map[string]interface{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp["change"].(string))
+	c.Assert(chg, check.NotNil)
+	c.Check(chg.Kind(), check.Equals, "create-recovery-system")
+}
+
+func (s *systemsSuite) TestSystemCreateUnhappy(c *check.C) {
+	s.daemon(c)
+
+	for _, tc := range []struct {
+		url, body        string
+		createErr        error
+		expectedHttpCode int
+		expectedErr      string
+	}{
+		{"/v2/systems", `{"action":"create"}`, nil, 400, "system create action requires the label to be provided"},
+		{"/v2/systems/20191119", `{"action":"create", "label":"1234"}`, nil, 400, "cannot create a system using an existing system label"},
+		{"/v2/systems", `{"action":"create", "label":"1234"}`, fmt.Errorf("boom"), 400, `cannot create recovery system "1234": boom`},
+		{"/v2/systems", `{"action":"create", "label":"1234"}`, &snapstate.ChangeConflictError{
+			ChangeKind: "create-recovery-system",
+			Message:    "cannot create a recovery system, another one is being created",
+		}, 409, "cannot create a recovery system, another one is being created"},
+	} {
+		restore := daemon.MockDevicestateCreateRecoverySystem(func(st *state.State, label string) (*state.Change, error) {
+			c.Check(tc.createErr, check.NotNil)
+			return nil, tc.createErr
+		})
+		defer restore()
+
+		req, err := http.NewRequest("POST", tc.url, strings.NewReader(tc.body))
+		c.Assert(err, check.IsNil)
+		req.RemoteAddr = "pid=100;uid=0;socket=;"
+
+		rec := httptest.NewRecorder()
+		s.serveHTTP(c, rec, req)
+		c.Check(rec.Code, check.Equals, tc.expectedHttpCode)
+
+		var rspBody map[string]interface{}
+		err = json.Unmarshal(rec.Body.Bytes(), &rspBody)
+		c.Check(err, check.IsNil)
+		result := rspBody["result"].(map[string]interface{})
+		c.Check(result["message"], check.Equals, tc.expectedErr)
+	}
+}
@@ -383,8 +383,10 @@ func (s *apiSuite) TestMapLocalFields(c *check.C) {
 		"foo": {Snap: info, Name: "foo", Command: "foo"},
 		"bar": {Snap: info, Name: "bar", Command: "bar"},
 	}
+	holdUntil := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
 	about := aboutSnap{
 		info: info,
+		hold: &holdUntil,
 		snapst: &snapstate.SnapState{
 			Active:          true,
 			TrackingChannel: "flaky/beta",
@@ -425,6 +427,7 @@ func (s *apiSuite) TestMapLocalFields(c *check.C) {
 		License:          "MIT",
 		CommonIDs:        []string{"foo", "bar"},
 		MountedFrom:      filepath.Join(dirs.SnapBlobDir, "some-snap_instance_7.snap"),
+		Hold:             &holdUntil,
 		Media:            media,
 		Apps: []client.AppInfo{
 			{Snap: "some-snap_instance", Name: "bar"},
@@ -1015,6 +1018,24 @@ func (s *apiSuite) TestPostSnapCohortRandoAction(c *check.C) {
 	}
 }
 
+func (s *apiSuite) TestPostSnapSnapshotKeyRandoAction(c *check.C) {
+	s.daemonWithOverlordMock(c)
+	s.vars = map[string]string{"name": "some-snap"}
+	const expectedErr = "snapshot-key can only be specified for snapshot"
+
+	for _, action := range []string{"install", "refresh", "remove", "xyzzy"} {
+		buf := strings.NewReader(fmt.Sprintf(`{"action": "%s", "snapshot-key": "c2Vrcml0"}`, action))
+		req, err := http.NewRequest("POST", "/v2/snaps/some-snap", buf)
+		c.Assert(err, check.IsNil)
+
+		rsp := postSnap(snapCmd, req, nil).(*resp)
+
+		c.Check(rsp.Type, check.Equals, ResponseTypeError)
+		c.Check(rsp.Status, check.Equals, 400, check.Commentf("%q", action))
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, expectedErr, check.Commentf("%q", action))
+	}
+}
+
 func (s *apiSuite) TestPostSnapLeaveCohortRandoAction(c *check.C) {
 	s.daemonWithOverlordMock(c)
 	s.vars = map[string]string{"name": "some-snap"}
@@ -28,9 +28,11 @@ import (
 	"strings"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -47,6 +49,8 @@ var (
 	}
 )
 
+var assertstateEnforceValidationSet = assertstate.EnforceValidationSet
+
 type validationSetResult struct {
 	AccountID string `json:"account-id"`
 	Name      string `json:"name"`
@@ -122,8 +126,10 @@ func listValidationSets(c *Command, r *http.Request, _ *auth.UserState) Response
 	results := make([]validationSetResult, len(names))
 	for i, vs := range names {
 		tr := validationSets[vs]
-		// TODO: evaluate against installed snaps
-		var valid bool
+		valid, err := validateAgainstInstalledSnaps(st, tr)
+		if err != nil {
+			return InternalError("cannot check validation set %s: %v", vs, err)
+		}
 		modeStr, err := modeString(tr.Mode)
 		if err != nil {
 			return InternalError(err.Error())
@@ -187,8 +193,10 @@ func getValidationSet(c *Command, r *http.Request, _ *auth.UserState) Response {
 	if err != nil {
 		return InternalError(err.Error())
 	}
-	// TODO: evaluate against installed snaps
-	var valid bool
+	valid, err := validateAgainstInstalledSnaps(st, &tr)
+	if err != nil {
+		return InternalError("cannot check validation set %s: %v", assertstate.ValidationSetKey(accountID, name), err)
+	}
 	res := validationSetResult{
 		AccountID: tr.AccountID,
 		Name:      tr.Name,
@@ -206,7 +214,37 @@ type validationSetApplyRequest struct {
 	Sequence int    `json:"sequence,omitempty"`
 }
 
-func applyValidationSet(c *Command, r *http.Request, _ *auth.UserState) Response {
+// validateAgainstInstalledSnaps checks whether the installed snaps satisfy
+// the validation set assertion of the given tracking. A validation set whose
+// assertion is not available locally is reported as not valid.
+func validateAgainstInstalledSnaps(st *state.State, tr *assertstate.ValidationSetTracking) (bool, error) {
+	vs, err := assertstate.ValidationSetAssertion(st, tr.AccountID, tr.Name, tr.Sequence())
+	if asserts.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sets := snapasserts.NewValidationSets()
+	if err := sets.Add(vs); err != nil {
+		return false, err
+	}
+	snaps, err := snapstate.InstalledSnaps(st)
+	if err != nil {
+		return false, err
+	}
+	err = sets.CheckInstalledSnaps(snaps)
+	if _, ok := err.(*snapasserts.ValidationSetsValidationError); ok {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func applyValidationSet(c *Command, r *http.Request, user *auth.UserState) Response {
 	vars := muxVars(r)
 	accountID := vars["account"]
 	name := vars["name"]
@@ -238,13 +276,17 @@ func applyValidationSet(c *Command, r *http.Request, _ *auth.UserState) Response
 	case "forget":
 		return forgetValidationSet(st, accountID, name, req.Sequence)
 	case "apply":
-		return updateValidationSet(st, accountID, name, req.Mode, req.Sequence)
+		var userID int
+		if user != nil {
+			userID = user.ID
+		}
+		return updateValidationSet(st, accountID, name, req.Mode, req.Sequence, userID)
 	default:
 		return BadRequest("unsupported action %q", req.Action)
 	}
 }
 
-func updateValidationSet(st *state.State, accountID, name string, reqMode string, sequence int) Response {
+func updateValidationSet(st *state.State, accountID, name string, reqMode string, sequence, userID int) Response {
 	var mode assertstate.ValidationSetMode
 	switch reqMode {
 	case "monitor":
@@ -255,6 +297,13 @@ func updateValidationSet(st *state.State, accountID, name string, reqMode string
 		return BadRequest("invalid mode %q", reqMode)
 	}
 
+	if mode == assertstate.Enforce {
+		if _, err := assertstateEnforceValidationSet(st, accountID, name, sequence, userID); err != nil {
+			return BadRequest("cannot enforce validation set: %v", err)
+		}
+		return SyncResponse(nil, nil)
+	}
+
 	// TODO: if pinned, check if we have the needed assertion locally;
 	// check with the store if there is something newer there;
 	// check what is the latest in the store if the assertion is not pinned.
@@ -267,9 +316,6 @@ func updateValidationSet(st *state.State, accountID, name string, reqMode string
 		PinnedAt: sequence,
 	}
 
-	// TODO: if the mode is enforced  check that the assertion is valid before
-	// saving it; for one from the store add it to the assertion db.
-
 	assertstate.UpdateValidationSet(st, &tr)
 	return SyncResponse(nil, nil)
 }
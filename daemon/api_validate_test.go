@@ -27,8 +27,10 @@ import (
 
 	"gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/daemon"
 	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/assertstate/assertstatetest"
 	"github.com/snapcore/snapd/overlord/state"
 )
 
@@ -43,6 +45,43 @@ func (s *apiValidationSetsSuite) SetUpTest(c *check.C) {
 	d := s.daemon(c)
 	d.Overlord().Loop()
 	s.AddCleanup(func() { d.Overlord().Stop() })
+
+	// don't look for the assertions by default, just track them
+	s.AddCleanup(daemon.MockAssertstateEnforceValidationSet(func(st *state.State, accountID, name string, sequence, userID int) (*assertstate.ValidationSetTracking, error) {
+		tr := &assertstate.ValidationSetTracking{
+			AccountID: accountID,
+			Name:      name,
+			Mode:      assertstate.Enforce,
+			PinnedAt:  sequence,
+		}
+		assertstate.UpdateValidationSet(st, tr)
+		return tr, nil
+	}))
+}
+
+func (s *apiValidationSetsSuite) mockValidationSetAssert(c *check.C, name, sequence, presence string) {
+	vs, err := s.StoreSigning.Sign(asserts.ValidationSetType, map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "can0nical",
+		"series":       "16",
+		"account-id":   "can0nical",
+		"name":         name,
+		"sequence":     sequence,
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "snap-b",
+				"id":       "yOqKhntON3vR7kwEbVPsILm7bUViPDzz",
+				"presence": presence,
+			},
+		},
+		"timestamp": "2030-11-06T09:16:26Z",
+	}, nil, "")
+	c.Assert(err, check.IsNil)
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	assertstatetest.AddMany(st, s.StoreSigning.StoreAccountKey(""), vs)
 }
 
 func mockValidationSetsTracking(st *state.State) {
@@ -187,6 +226,45 @@ func (s *apiValidationSetsSuite) TestGetValidationSetOne(c *check.C) {
 	})
 }
 
+func (s *apiValidationSetsSuite) TestGetValidationSetValid(c *check.C) {
+	// snap-b is not installed
+	s.mockValidationSetAssert(c, "optional", "1", "optional")
+	s.mockValidationSetAssert(c, "required", "3", "required")
+
+	st := s.d.Overlord().State()
+	st.Lock()
+	assertstate.UpdateValidationSet(st, &assertstate.ValidationSetTracking{
+		AccountID: "can0nical",
+		Name:      "optional",
+		Mode:      assertstate.Monitor,
+		Current:   1,
+	})
+	assertstate.UpdateValidationSet(st, &assertstate.ValidationSetTracking{
+		AccountID: "can0nical",
+		Name:      "required",
+		Mode:      assertstate.Monitor,
+		PinnedAt:  3,
+		Current:   3,
+	})
+	st.Unlock()
+
+	for _, tc := range []struct {
+		name  string
+		valid bool
+	}{
+		{"optional", true},
+		{"required", false},
+	} {
+		req, err := http.NewRequest("GET", "/v2/validation-sets/can0nical/"+tc.name, nil)
+		c.Assert(err, check.IsNil)
+
+		rsp := s.req(c, req, nil).(*daemon.Resp)
+		c.Assert(rsp.Status, check.Equals, 200)
+		res := rsp.Result.(daemon.ValidationSetResult)
+		c.Check(res.Valid, check.Equals, tc.valid, check.Commentf("%s", tc.name))
+	}
+}
+
 func (s *apiValidationSetsSuite) TestGetValidationSetPinned(c *check.C) {
 	q := url.Values{}
 	q.Set("sequence", "9")
@@ -309,6 +387,35 @@ func (s *apiValidationSetsSuite) TestApplyValidationSet(c *check.C) {
 	}
 }
 
+func (s *apiValidationSetsSuite) TestApplyValidationSetEnforceError(c *check.C) {
+	var called int
+	restore := daemon.MockAssertstateEnforceValidationSet(func(st *state.State, accountID, name string, sequence, userID int) (*assertstate.ValidationSetTracking, error) {
+		called++
+		c.Check(accountID, check.Equals, "foo")
+		c.Check(name, check.Equals, "bar")
+		c.Check(sequence, check.Equals, 3)
+		return nil, fmt.Errorf("validation sets assertions are not met:\n- missing required snaps:\n  - snap-b (required by sets foo/bar)")
+	})
+	defer restore()
+
+	req, err := http.NewRequest("POST", "/v2/validation-sets/foo/bar", strings.NewReader(`{"action":"apply","mode":"enforce","sequence":3}`))
+	c.Assert(err, check.IsNil)
+
+	rsp := s.req(c, req, nil).(*daemon.Resp)
+	c.Assert(rsp.Status, check.Equals, 400)
+	c.Check(rsp.ErrorResult().Message, check.Equals, `cannot enforce validation set: validation sets assertions are not met:
+- missing required snaps:
+  - snap-b (required by sets foo/bar)`)
+	c.Check(called, check.Equals, 1)
+
+	// nothing was tracked
+	st := s.d.Overlord().State()
+	st.Lock()
+	defer st.Unlock()
+	var tr assertstate.ValidationSetTracking
+	c.Check(assertstate.GetValidationSet(st, "foo", "bar", &tr), check.Equals, state.ErrNoState)
+}
+
 func (s *apiValidationSetsSuite) TestForgetValidationSet(c *check.C) {
 	st := s.d.Overlord().State()
 
@@ -75,6 +75,7 @@ type Daemon struct {
 	tomb            tomb.Tomb
 	router          *mux.Router
 	standbyOpinions *standby.StandbyOpinions
+	events          *eventHub
 
 	// set to what kind of restart was requested if any
 	requestedRestart state.RestartType
@@ -104,6 +105,8 @@ type Command struct {
 	GuestOK bool
 	// can non-admin GET?
 	UserOK bool
+	// can non-admin POST? the command then checks what the user can do
+	UserPostOK bool
 	// is this path accessible on the snapd-snap socket?
 	SnapOK bool
 	// this path is only accessible to root
@@ -131,6 +134,7 @@ var polkitCheckAuthorization = polkit.CheckAuthorization
 // - if the user is `root` everything is allowed
 // - if a user is logged in (via `snap login`) and the command doesn't have RootOnly, everything is allowed
 // - POST/PUT all require `root`, or just `snap login` if not RootOnly
+// - UserPostOK: any uid can access POST, the command restricts what they can do
 //
 // Otherwise for GET requests the following parameters are honored:
 // - GuestOK: anyone can access GET
@@ -138,7 +142,7 @@ var polkitCheckAuthorization = polkit.CheckAuthorization
 // - RootOnly: only root can access this
 // - SnapOK: a snap can access this via `snapctl`
 func (c *Command) canAccess(r *http.Request, user *auth.UserState) accessResult {
-	if c.RootOnly && (c.UserOK || c.GuestOK || c.SnapOK) {
+	if c.RootOnly && (c.UserOK || c.UserPostOK || c.GuestOK || c.SnapOK) {
 		// programming error
 		logger.Panicf("Command can't have RootOnly together with any *OK flag")
 	}
@@ -179,6 +183,10 @@ func (c *Command) canAccess(r *http.Request, user *auth.UserState) accessResult
 		}
 	}
 
+	if r.Method == "POST" && isUser && c.UserPostOK {
+		return accessOK
+	}
+
 	// Remaining admin checks rely on identifying peer uid
 	if !isUser {
 		return accessUnauthorized
@@ -602,6 +610,15 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 	// We're using the background context here because the tomb's
 	// context will likely already have been cancelled when we are
 	// called.
+	d.mu.Lock()
+	events := d.events
+	d.mu.Unlock()
+	if events != nil {
+		// end the long-lived events streams, they would otherwise
+		// hold up the shutdown
+		events.close()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	d.tomb.Kill(d.serve.Shutdown(ctx))
 	cancel()
@@ -360,6 +360,21 @@ func (s *daemonSuite) TestUserAccess(c *check.C) {
 	c.Check(cmd.canAccess(put, nil), check.Equals, accessUnauthorized)
 }
 
+func (s *daemonSuite) TestUserPostAccess(c *check.C) {
+	get := &http.Request{Method: "GET", RemoteAddr: "pid=100;uid=42;socket=;"}
+	post := &http.Request{Method: "POST", RemoteAddr: "pid=100;uid=42;socket=;"}
+	put := &http.Request{Method: "PUT", RemoteAddr: "pid=100;uid=42;socket=;"}
+
+	cmd := &Command{d: newTestDaemon(c), UserPostOK: true}
+	c.Check(cmd.canAccess(get, nil), check.Equals, accessUnauthorized)
+	c.Check(cmd.canAccess(post, nil), check.Equals, accessOK)
+	c.Check(cmd.canAccess(put, nil), check.Equals, accessUnauthorized)
+
+	// not from snaps though
+	post = &http.Request{Method: "POST", RemoteAddr: fmt.Sprintf("pid=100;uid=42;socket=%s;", dirs.SnapSocket)}
+	c.Check(cmd.canAccess(post, nil), check.Equals, accessUnauthorized)
+}
+
 func (s *daemonSuite) TestLoggedInUserAccess(c *check.C) {
 	user := &auth.UserState{}
 	get := &http.Request{Method: "GET", RemoteAddr: "pid=100;uid=42;socket=;"}
@@ -19,6 +19,19 @@
 
 package daemon
 
+import (
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
 type (
 	ValidationSetResult = validationSetResult
 )
+
+func MockAssertstateEnforceValidationSet(f func(*state.State, string, string, int, int) (*assertstate.ValidationSetTracking, error)) func() {
+	old := assertstateEnforceValidationSet
+	assertstateEnforceValidationSet = f
+	return func() {
+		assertstateEnforceValidationSet = old
+	}
+}
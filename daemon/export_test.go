@@ -149,6 +149,38 @@ func MockSnapstateUpdateMany(mock func(context.Context, *state.State, []string,
 	}
 }
 
+func MockSnapstateUpdate(mock func(*state.State, string, *snapstate.RevisionOptions, int, snapstate.Flags) (*state.TaskSet, error)) (restore func()) {
+	oldSnapstateUpdate := snapstateUpdate
+	snapstateUpdate = mock
+	return func() {
+		snapstateUpdate = oldSnapstateUpdate
+	}
+}
+
+func MockSnapstatePostponeRefresh(mock func(*state.State, string) error) (restore func()) {
+	oldSnapstatePostponeRefresh := snapstatePostponeRefresh
+	snapstatePostponeRefresh = mock
+	return func() {
+		snapstatePostponeRefresh = oldSnapstatePostponeRefresh
+	}
+}
+
+func MockCgroupPidsOfSnap(mock func(string) (map[string][]int, error)) (restore func()) {
+	oldCgroupPidsOfSnap := cgroupPidsOfSnap
+	cgroupPidsOfSnap = mock
+	return func() {
+		cgroupPidsOfSnap = oldCgroupPidsOfSnap
+	}
+}
+
+func MockCgroupUserOfPid(mock func(int) (int, error)) (restore func()) {
+	oldCgroupUserOfPid := cgroupUserOfPid
+	cgroupUserOfPid = mock
+	return func() {
+		cgroupUserOfPid = oldCgroupUserOfPid
+	}
+}
+
 func MockSnapstateRemoveMany(mock func(*state.State, []string) ([]string, []*state.TaskSet, error)) (restore func()) {
 	oldSnapstateRemoveMany := snapstateRemoveMany
 	snapstateRemoveMany = mock
@@ -157,6 +189,22 @@ func MockSnapstateRemoveMany(mock func(*state.State, []string) ([]string, []*sta
 	}
 }
 
+func MockSnapstateHoldRefreshesByUser(mock func(*state.State, time.Duration, []string) error) (restore func()) {
+	oldSnapstateHoldRefreshesByUser := snapstateHoldRefreshesByUser
+	snapstateHoldRefreshesByUser = mock
+	return func() {
+		snapstateHoldRefreshesByUser = oldSnapstateHoldRefreshesByUser
+	}
+}
+
+func MockSnapstateUnholdRefreshesByUser(mock func(*state.State, []string) error) (restore func()) {
+	oldSnapstateUnholdRefreshesByUser := snapstateUnholdRefreshesByUser
+	snapstateUnholdRefreshesByUser = mock
+	return func() {
+		snapstateUnholdRefreshesByUser = oldSnapstateUnholdRefreshesByUser
+	}
+}
+
 type (
 	Resp            = resp
 	ErrorResult     = errorResult
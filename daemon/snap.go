@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/client/clientutil"
@@ -33,6 +34,7 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/squashfs"
 )
 
 var errNoSnap = errors.New("snap not installed")
@@ -41,6 +43,8 @@ type aboutSnap struct {
 	info   *snap.Info
 	snapst *snapstate.SnapState
 	health *client.SnapHealth
+	// hold is the time until which the refresh of the snap is held, if any
+	hold *time.Time
 }
 
 // localSnapInfo returns the information about the current snap for the given name plus the SnapState with the active flag and other snap revisions.
@@ -72,10 +76,16 @@ func localSnapInfo(st *state.State, name string) (aboutSnap, error) {
 		return aboutSnap{}, err
 	}
 
+	held, err := snapstate.HeldSnaps(st)
+	if err != nil {
+		return aboutSnap{}, err
+	}
+
 	return aboutSnap{
 		info:   info,
 		snapst: &snapst,
 		health: clientHealthFromHealthstate(health),
+		hold:   holdOf(held, name),
 	}, nil
 }
 
@@ -95,12 +105,18 @@ func allLocalSnapInfos(st *state.State, all bool, wanted map[string]bool) ([]abo
 		return nil, err
 	}
 
+	held, err := snapstate.HeldSnaps(st)
+	if err != nil {
+		return nil, err
+	}
+
 	var firstErr error
 	for name, snapst := range snapStates {
 		if len(wanted) > 0 && !wanted[name] {
 			continue
 		}
 		health := clientHealthFromHealthstate(healths[name])
+		hold := holdOf(held, name)
 		var aboutThis []aboutSnap
 		var info *snap.Info
 		var err error
@@ -122,13 +138,13 @@ func allLocalSnapInfos(st *state.State, all bool, wanted map[string]bool) ([]abo
 				if err != nil && firstErr == nil {
 					firstErr = err
 				}
-				aboutThis = append(aboutThis, aboutSnap{info, snapst, health})
+				aboutThis = append(aboutThis, aboutSnap{info, snapst, health, hold})
 			}
 		} else {
 			info, err = snapst.CurrentInfo()
 			if err == nil {
 				info.Publisher, err = publisherAccount(st, info.SnapID)
-				aboutThis = append(aboutThis, aboutSnap{info, snapst, health})
+				aboutThis = append(aboutThis, aboutSnap{info, snapst, health, hold})
 			}
 		}
 
@@ -145,6 +161,14 @@ func allLocalSnapInfos(st *state.State, all bool, wanted map[string]bool) ([]abo
 	return about, firstErr
 }
 
+func holdOf(held map[string]time.Time, name string) *time.Time {
+	until, ok := held[name]
+	if !ok {
+		return nil
+	}
+	return &until
+}
+
 func publisherAccount(st *state.State, snapID string) (snap.StoreAccount, error) {
 	if snapID == "" {
 		return snap.StoreAccount{}, nil
@@ -205,8 +229,11 @@ func mapLocal(about aboutSnap, sd clientutil.StatusDecorator) *client.Snap {
 		// not exist (this might help e.g. snapcraft clean up after a
 		// prime dir)
 		result.MountedFrom, _ = os.Readlink(result.MountedFrom)
+	} else {
+		result.Compression, _ = squashfs.Compression(result.MountedFrom)
 	}
 	result.Health = about.health
+	result.Hold = about.hold
 
 	return result
 }
@@ -59,6 +59,11 @@ const (
 	CheckDiskSpaceInstall
 	// CheckDiskSpaceRefresh controls free disk space check on snap refresh.
 	CheckDiskSpaceRefresh
+	// QuotaGroups controls whether snap services can be placed in resource
+	// quota groups.
+	QuotaGroups
+	// GateAutoRefreshHook enables refresh control from snaps via gate-auto-refresh hook.
+	GateAutoRefreshHook
 
 	// lastFeature is the final known feature, it is only used for testing.
 	lastFeature
@@ -94,6 +99,10 @@ var featureNames = map[SnapdFeature]string{
 	CheckDiskSpaceInstall: "check-disk-space-install",
 	CheckDiskSpaceRefresh: "check-disk-space-refresh",
 	CheckDiskSpaceRemove:  "check-disk-space-remove",
+
+	QuotaGroups: "quota-groups",
+
+	GateAutoRefreshHook: "gate-auto-refresh-hook",
 }
 
 // featuresEnabledWhenUnset contains a set of features that are enabled when not explicitly configured.
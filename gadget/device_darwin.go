@@ -35,6 +35,16 @@ func findDeviceForStructureWithFallback(ps *LaidOutStructure) (string, quantity.
 	return "", 0, errNotImplemented
 }
 
+func findDeviceForStructureInVolume(lv *LaidOutVolume) deviceLookupFunc {
+	return func(ps *LaidOutStructure) (string, quantity.Offset, error) {
+		return "", 0, errNotImplemented
+	}
+}
+
+func FindDiskForVolume(lv *LaidOutVolume) (string, error) {
+	return "", errNotImplemented
+}
+
 func findMountPointForStructure(ps *LaidOutStructure) (string, error) {
 	return "", errNotImplemented
 }
@@ -144,6 +144,65 @@ func findDeviceForStructureWithFallback(ps *LaidOutStructure) (dev string, offs
 	return dev, ps.StartOffset, nil
 }
 
+// findDeviceForStructureInVolume returns a device lookup function that,
+// similar to findDeviceForStructureWithFallback, locates the non-filesystem
+// structures of the given volume. Should there be no exact match, the
+// structure is located within the disk of the volume, see FindDiskForVolume.
+//
+// This is meant for the volumes of multi-volume gadgets other than the system
+// volume, which are on a different disk than the one mounted at /writable.
+func findDeviceForStructureInVolume(lv *LaidOutVolume) deviceLookupFunc {
+	return func(ps *LaidOutStructure) (string, quantity.Offset, error) {
+		if ps.HasFilesystem() {
+			return "", 0, fmt.Errorf("internal error: cannot use with filesystem structures")
+		}
+
+		dev, err := FindDeviceForStructure(ps)
+		if err == nil {
+			return dev, 0, nil
+		}
+		if err != ErrDeviceNotFound || (ps.IsPartition() && ps.Name != "") {
+			return "", 0, err
+		}
+
+		dev, err = FindDiskForVolume(lv)
+		if err != nil {
+			return "", 0, err
+		}
+		// start offset is calculated as an absolute position within the volume
+		return dev, ps.StartOffset, nil
+	}
+}
+
+// FindDiskForVolume attempts to find the disk holding the given volume, by
+// locating its structures that can be found by name or filesystem label, see
+// FindDeviceForStructure. All the structures found must be on the same disk.
+func FindDiskForVolume(lv *LaidOutVolume) (string, error) {
+	var disk string
+	for i := range lv.LaidOutStructure {
+		ps := &lv.LaidOutStructure[i]
+		dev, err := FindDeviceForStructure(ps)
+		if err == ErrDeviceNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		parent, err := ParentDiskFromMountSource(dev)
+		if err != nil {
+			return "", fmt.Errorf("cannot find disk of structure %v: %v", ps, err)
+		}
+		if disk != "" && parent != disk {
+			return "", fmt.Errorf("conflicting disk match, structure %v is on %v, while previous structures are on %v", ps, parent, disk)
+		}
+		disk = parent
+	}
+	if disk == "" {
+		return "", ErrDeviceNotFound
+	}
+	return disk, nil
+}
+
 // findMountPointForStructure locates a mount point of a device that matches
 // given structure. The structure must have a filesystem defined, otherwise an
 // error is raised.
@@ -489,6 +489,108 @@ func (d *deviceSuite) TestDeviceFindFallbackPassThrough(c *C) {
 	c.Check(offs, Equals, quantity.Offset(0))
 }
 
+func (d *deviceSuite) setupMockSysfsForEmmc(c *C) {
+	// a second disk, with a partition named boot-config
+	err := ioutil.WriteFile(filepath.Join(d.dir, "/dev/emmc0p1"), nil, 0644)
+	c.Assert(err, IsNil)
+	err = os.Symlink("../../emmc0p1", filepath.Join(d.dir, "/dev/disk/by-partlabel/boot-config"))
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(filepath.Join(d.dir, "/dev/emmc0"), nil, 0644)
+	c.Assert(err, IsNil)
+	err = os.MkdirAll(filepath.Join(d.dir, "/sys/block/emmc0/emmc0p1"), 0755)
+	c.Assert(err, IsNil)
+}
+
+func mockEmmcVolume() *gadget.LaidOutVolume {
+	return &gadget.LaidOutVolume{
+		Volume: &gadget.Volume{Schema: "gpt"},
+		LaidOutStructure: []gadget.LaidOutStructure{
+			{
+				VolumeStructure: &gadget.VolumeStructure{
+					Name: "boot-assets",
+					Type: "bare",
+				},
+				StartOffset: 123,
+			}, {
+				VolumeStructure: &gadget.VolumeStructure{
+					Name: "boot-config",
+					Type: "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+				},
+				StartOffset: 1 * quantity.OffsetMiB,
+			},
+		},
+	}
+}
+
+func (d *deviceSuite) TestFindDiskForVolumeHappy(c *C) {
+	d.setupMockSysfs(c)
+	d.setupMockSysfsForEmmc(c)
+
+	disk, err := gadget.FindDiskForVolume(mockEmmcVolume())
+	c.Assert(err, IsNil)
+	c.Check(disk, Equals, filepath.Join(d.dir, "/dev/emmc0"))
+}
+
+func (d *deviceSuite) TestFindDiskForVolumeNotFound(c *C) {
+	d.setupMockSysfs(c)
+
+	_, err := gadget.FindDiskForVolume(mockEmmcVolume())
+	c.Assert(err, Equals, gadget.ErrDeviceNotFound)
+}
+
+func (d *deviceSuite) TestFindDiskForVolumeConflict(c *C) {
+	d.setupMockSysfs(c)
+	d.setupMockSysfsForEmmc(c)
+
+	vol := mockEmmcVolume()
+	vol.LaidOutStructure = append(vol.LaidOutStructure, gadget.LaidOutStructure{
+		VolumeStructure: &gadget.VolumeStructure{
+			Name:       "writable",
+			Filesystem: "ext4",
+		},
+		StartOffset: 2 * quantity.OffsetMiB,
+	})
+	_, err := gadget.FindDiskForVolume(vol)
+	c.Assert(err, ErrorMatches, `conflicting disk match, structure #0 \("writable"\) is on .*/dev/fakedevice0, while previous structures are on .*/dev/emmc0`)
+}
+
+func (d *deviceSuite) TestDeviceFindInVolume(c *C) {
+	d.setupMockSysfs(c)
+	d.setupMockSysfsForEmmc(c)
+	// the system is booted from fakedevice0
+	restore := osutil.MockMountInfo(fmt.Sprintf(writableMountInfoFmt, d.dir))
+	defer restore()
+
+	vol := mockEmmcVolume()
+	lookup := gadget.FindDeviceForStructureInVolume(vol)
+
+	// bare structures are located within the disk of the volume
+	found, offs, err := lookup(&vol.LaidOutStructure[0])
+	c.Assert(err, IsNil)
+	c.Check(found, Equals, filepath.Join(d.dir, "/dev/emmc0"))
+	c.Check(offs, Equals, quantity.Offset(123))
+
+	// partitions are found directly
+	found, offs, err = lookup(&vol.LaidOutStructure[1])
+	c.Assert(err, IsNil)
+	c.Check(found, Equals, filepath.Join(d.dir, "/dev/emmc0p1"))
+	c.Check(offs, Equals, quantity.Offset(0))
+
+	// named partitions must exist
+	_, _, err = lookup(&gadget.LaidOutStructure{
+		VolumeStructure: &gadget.VolumeStructure{
+			Name: "missing",
+			Type: "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+		},
+	})
+	c.Assert(err, Equals, gadget.ErrDeviceNotFound)
+
+	_, _, err = lookup(&gadget.LaidOutStructure{
+		VolumeStructure: &gadget.VolumeStructure{Filesystem: "ext4"},
+	})
+	c.Assert(err, ErrorMatches, "internal error: cannot use with filesystem structures")
+}
+
 func (d *deviceSuite) TestDeviceFindMountPointErrorsWithBare(c *C) {
 	p, err := gadget.FindMountPointForStructure(&gadget.LaidOutStructure{
 		VolumeStructure: &gadget.VolumeStructure{
@@ -37,9 +37,10 @@ var (
 	RuleValidateVolumeStructure = ruleValidateVolumeStructure
 	EnsureVolumeRuleConsistency = ensureVolumeRuleConsistency
 
-	ResolveVolume      = resolveVolume
-	CanUpdateStructure = canUpdateStructure
-	CanUpdateVolume    = canUpdateVolume
+	ResolveVolumes        = resolveVolumes
+	ResolveUpdatedVolumes = resolveUpdatedVolumes
+	CanUpdateStructure    = canUpdateStructure
+	CanUpdateVolume       = canUpdateVolume
 
 	WriteFile = writeFileOrSymlink
 
@@ -55,6 +56,7 @@ var (
 	NewMountedFilesystemUpdater = newMountedFilesystemUpdater
 
 	FindDeviceForStructureWithFallback = findDeviceForStructureWithFallback
+	FindDeviceForStructureInVolume     = findDeviceForStructureInVolume
 	FindMountPointForStructure         = findMountPointForStructure
 
 	ParseRelativeOffset = parseRelativeOffset
@@ -62,6 +64,18 @@ var (
 	SplitKernelRef = splitKernelRef
 )
 
+func (p volumePair) Name() string { return p.name }
+func (p volumePair) Old() *Volume { return p.old }
+func (p volumePair) New() *Volume { return p.new }
+
+func MockFindDiskForVolume(mock func(lv *LaidOutVolume) (string, error)) (restore func()) {
+	old := findDiskForVolume
+	findDiskForVolume = mock
+	return func() {
+		findDiskForVolume = old
+	}
+}
+
 func MockEvalSymlinks(mock func(path string) (string, error)) (restore func()) {
 	oldEvalSymlinks := evalSymlinks
 	evalSymlinks = mock
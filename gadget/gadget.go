@@ -35,6 +35,7 @@ import (
 	"github.com/snapcore/snapd/gadget/edition"
 	"github.com/snapcore/snapd/gadget/quantity"
 	"github.com/snapcore/snapd/metautil"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/strutil"
@@ -95,6 +96,63 @@ type Info struct {
 	Defaults map[string]map[string]interface{} `yaml:"defaults,omitempty"`
 
 	Connections []Connection `yaml:"connections"`
+
+	// KernelCmdline describes the kernel command line arguments that can
+	// be set by the device owner.
+	KernelCmdline KernelCmdline `yaml:"kernel-cmdline,omitempty"`
+}
+
+// KernelCmdline describes the kernel command line arguments that can be
+// appended with the system.kernel.cmdline-append option.
+type KernelCmdline struct {
+	// Allow lists the allowed arguments, each being either a bare
+	// parameter, param=value to allow that value only, or param=* to allow
+	// any value.
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+func splitKernelArg(arg string) (param, value string, hasValue bool) {
+	idx := strings.IndexByte(arg, '=')
+	if idx == -1 {
+		return arg, "", false
+	}
+	return arg[:idx], arg[idx+1:], true
+}
+
+func validateKernelCmdline(kc *KernelCmdline) error {
+	for _, allowed := range kc.Allow {
+		args, err := osutil.KernelCommandLineSplit(allowed)
+		if err != nil {
+			return fmt.Errorf("invalid kernel command line argument %q: %v", allowed, err)
+		}
+		if len(args) != 1 || args[0] != allowed {
+			return fmt.Errorf("invalid kernel command line argument %q: not a single argument", allowed)
+		}
+		param, value, _ := splitKernelArg(allowed)
+		if param == "" || strings.Contains(param, "*") || strings.Contains(value, "*") && value != "*" {
+			return fmt.Errorf("invalid kernel command line argument %q", allowed)
+		}
+		if strings.HasPrefix(param, "snapd_") {
+			return fmt.Errorf("cannot allow snapd specific kernel command line argument %q", allowed)
+		}
+	}
+	return nil
+}
+
+// IsAllowed returns whether the given kernel command line argument is allowed
+// by the gadget.
+func (kc *KernelCmdline) IsAllowed(arg string) bool {
+	param, value, hasValue := splitKernelArg(arg)
+	for _, allowed := range kc.Allow {
+		allowedParam, allowedValue, allowedHasValue := splitKernelArg(allowed)
+		if param != allowedParam || hasValue != allowedHasValue {
+			continue
+		}
+		if allowedValue == "*" || allowedValue == value {
+			return true
+		}
+	}
+	return false
 }
 
 // Volume defines the structure and content for the image to be written into a
@@ -330,6 +388,10 @@ func InfoFromGadgetYaml(gadgetYaml []byte, model Model) (*Info, error) {
 		}
 	}
 
+	if err := validateKernelCmdline(&gi.KernelCmdline); err != nil {
+		return nil, fmt.Errorf("invalid kernel-cmdline: %v", err)
+	}
+
 	if len(gi.Volumes) == 0 && classicOrUnconstrained(model) {
 		// volumes can be left out on classic
 		// can still specify defaults though
@@ -887,19 +949,23 @@ func (s *RelativeOffset) UnmarshalYAML(unmarshal func(interface{}) error) error
 // nil or an error describing the incompatibility.
 func IsCompatible(current, new *Info) error {
 	// XXX: the only compatibility we have now is making sure that the new
-	// layout can be used on an existing volume
-	if len(new.Volumes) > 1 {
-		return fmt.Errorf("gadgets with multiple volumes are unsupported")
-	}
-
-	// XXX: the code below errors out with more than 1 volume in the current
-	// gadget, we allow this scenario in update but better bail out here and
-	// have users fix their gadgets
-	currentVol, newVol, err := resolveVolume(current, new)
+	// layout can be used on the existing volumes
+	pairs, err := resolveVolumes(current, new)
 	if err != nil {
 		return err
 	}
+	for _, pair := range pairs {
+		if err := isVolumeCompatible(pair.old, pair.new); err != nil {
+			if len(pairs) > 1 {
+				return fmt.Errorf("volume %q: %v", pair.name, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
 
+func isVolumeCompatible(currentVol, newVol *Volume) error {
 	if currentVol.Schema == "" || newVol.Schema == "" {
 		return fmt.Errorf("internal error: unset volume schemas: old: %q new: %q", currentVol.Schema, newVol.Schema)
 	}
@@ -921,16 +987,33 @@ func IsCompatible(current, new *Info) error {
 	return nil
 }
 
+// IsSystemVolume returns whether the volume holds the structures with the
+// system roles, that is the volume the system is installed on.
+func IsSystemVolume(vol *Volume) bool {
+	for _, vs := range vol.Structure {
+		switch vs.Role {
+		case SystemSeed, SystemBoot, SystemData, SystemSave:
+			return true
+		}
+	}
+	return false
+}
+
 // LaidOutVolumeFromGadget takes a gadget rootdir and lays out the
-// partitions as specified.
+// partitions of the system volume as specified.
 func LaidOutVolumeFromGadget(gadgetRoot string, model Model) (*LaidOutVolume, error) {
+	system, _, err := LaidOutVolumesFromGadget(gadgetRoot, model)
+	return system, err
+}
+
+// LaidOutVolumesFromGadget takes a gadget rootdir and lays out the
+// partitions of all its volumes as specified. It returns the system
+// volume, see IsSystemVolume, along with all the volumes by name. The
+// only volume of a single volume gadget is its system volume.
+func LaidOutVolumesFromGadget(gadgetRoot string, model Model) (system *LaidOutVolume, all map[string]*LaidOutVolume, err error) {
 	info, err := ReadInfo(gadgetRoot, model)
 	if err != nil {
-		return nil, err
-	}
-	// Limit ourselves to just one volume for now.
-	if len(info.Volumes) != 1 {
-		return nil, fmt.Errorf("cannot position multiple volumes yet")
+		return nil, nil, err
 	}
 
 	constraints := LayoutConstraints{
@@ -938,15 +1021,24 @@ func LaidOutVolumeFromGadget(gadgetRoot string, model Model) (*LaidOutVolume, er
 		SectorSize:        512,
 	}
 
-	for _, vol := range info.Volumes {
-		pvol, err := LayoutVolume(gadgetRoot, vol, constraints)
+	all = make(map[string]*LaidOutVolume, len(info.Volumes))
+	for name, vol := range info.Volumes {
+		lvol, err := LayoutVolume(gadgetRoot, vol, constraints)
 		if err != nil {
-			return nil, err
+			if len(info.Volumes) > 1 {
+				return nil, nil, fmt.Errorf("cannot lay out volume %q: %v", name, err)
+			}
+			return nil, nil, err
 		}
-		// we know  info.Volumes map has size 1 so we can return here
-		return pvol, nil
+		all[name] = lvol
+		if len(info.Volumes) == 1 || IsSystemVolume(vol) {
+			system = lvol
+		}
+	}
+	if system == nil {
+		return nil, nil, fmt.Errorf("cannot find the system volume among the gadget volumes")
 	}
-	return nil, fmt.Errorf("internal error in PositionedVolumeFromGadget: this line cannot be reached")
+	return system, all, nil
 }
 
 func flatten(path string, cfg interface{}, out map[string]interface{}) {
@@ -258,6 +258,18 @@ volumes:
         size: 1G
 `)
 
+var gadgetYamlUC20PCWithEmmc = append(append([]byte(nil), gadgetYamlUC20PC...), []byte(`
+  emmc:
+    schema: mbr
+    structure:
+      - name: boot-assets
+        type: bare
+        size: 1M
+        offset: 0
+        content:
+          - image: boot-assets.img
+`)...)
+
 var gadgetYamlRPi = []byte(`
 device-tree: bcm2709-rpi-2-b
 volumes:
@@ -612,6 +624,65 @@ func (s *gadgetYamlTestSuite) TestReadGadgetDefaultsMultiline(c *C) {
 	})
 }
 
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlKernelCmdline(c *C) {
+	err := ioutil.WriteFile(s.gadgetYamlPath, []byte(`
+kernel-cmdline:
+  allow:
+    - quiet
+    - console=ttyS0
+    - loglevel=*
+`), 0644)
+	c.Assert(err, IsNil)
+
+	ginfo, err := gadget.ReadInfo(s.dir, &modelConstraints{classic: true})
+	c.Assert(err, IsNil)
+	c.Check(ginfo.KernelCmdline, DeepEquals, gadget.KernelCmdline{
+		Allow: []string{"quiet", "console=ttyS0", "loglevel=*"},
+	})
+}
+
+func (s *gadgetYamlTestSuite) TestReadGadgetYamlKernelCmdlineInvalid(c *C) {
+	for _, tc := range []struct {
+		allow string
+		err   string
+	}{
+		{`"foo bar"`, `invalid kernel-cmdline: invalid kernel command line argument "foo bar": not a single argument`},
+		{`"foo=\"bar"`, `invalid kernel-cmdline: invalid kernel command line argument "foo=\\"bar": unbalanced quoting`},
+		{`"=foo"`, `invalid kernel-cmdline: invalid kernel command line argument "=foo": unexpected assignment`},
+		{`"*"`, `invalid kernel-cmdline: invalid kernel command line argument "\*"`},
+		{`"foo=ba*"`, `invalid kernel-cmdline: invalid kernel command line argument "foo=ba\*"`},
+		{`snapd_recovery_mode=*`, `invalid kernel-cmdline: cannot allow snapd specific kernel command line argument "snapd_recovery_mode=\*"`},
+	} {
+		err := ioutil.WriteFile(s.gadgetYamlPath, []byte(fmt.Sprintf("kernel-cmdline:\n  allow: [%s]\n", tc.allow)), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = gadget.ReadInfo(s.dir, &modelConstraints{classic: true})
+		c.Check(err, ErrorMatches, tc.err, Commentf("%s", tc.allow))
+	}
+}
+
+func (s *gadgetYamlTestSuite) TestKernelCmdlineIsAllowed(c *C) {
+	kc := &gadget.KernelCmdline{
+		Allow: []string{"quiet", "console=ttyS0", "loglevel=*"},
+	}
+	for _, tc := range []struct {
+		arg     string
+		allowed bool
+	}{
+		{"quiet", true},
+		{"quiet=1", false},
+		{"console=ttyS0", true},
+		{"console=ttyS1", false},
+		{"console", false},
+		{"loglevel=3", true},
+		{"loglevel=", true},
+		{"loglevel", false},
+		{"splash", false},
+	} {
+		c.Check(kc.IsAllowed(tc.arg), Equals, tc.allowed, Commentf("%q", tc.arg))
+	}
+}
+
 func asOffsetPtr(offs quantity.Offset) *quantity.Offset {
 	goff := offs
 	return &goff
@@ -1916,12 +1987,60 @@ func (s *gadgetYamlTestSuite) TestGadgetFromMetaEmpty(c *C) {
 	c.Assert(giCore, IsNil)
 }
 
-func (s *gadgetYamlTestSuite) TestLaidOutVolumeFromGadgetMultiVolume(c *C) {
+func (s *gadgetYamlTestSuite) TestLaidOutVolumeFromGadgetMultiVolumeError(c *C) {
 	err := ioutil.WriteFile(s.gadgetYamlPath, mockMultiVolumeGadgetYaml, 0644)
 	c.Assert(err, IsNil)
 
 	_, err = gadget.LaidOutVolumeFromGadget(s.dir, nil)
-	c.Assert(err, ErrorMatches, "cannot position multiple volumes yet")
+	c.Assert(err, ErrorMatches, `cannot lay out volume "u-boot-frobinator": cannot lay out volume, structure #0 \("u-boot"\) size is not a multiple of sector size 512`)
+}
+
+func (s *gadgetYamlTestSuite) TestLaidOutVolumesFromGadgetMultiVolume(c *C) {
+	err := ioutil.WriteFile(s.gadgetYamlPath, gadgetYamlUC20PCWithEmmc, 0644)
+	c.Assert(err, IsNil)
+	for _, fn := range []string{"pc-boot.img", "pc-core.img", "boot-assets.img"} {
+		err = ioutil.WriteFile(filepath.Join(s.dir, fn), nil, 0644)
+		c.Assert(err, IsNil)
+	}
+
+	system, all, err := gadget.LaidOutVolumesFromGadget(s.dir, uc20Constraints)
+	c.Assert(err, IsNil)
+	c.Assert(all, HasLen, 2)
+	c.Check(system, Equals, all["pc"])
+	c.Check(system.LaidOutStructure, HasLen, 6)
+	emmc := all["emmc"]
+	c.Assert(emmc.LaidOutStructure, HasLen, 1)
+	c.Check(emmc.LaidOutStructure[0].Name, Equals, "boot-assets")
+	c.Check(emmc.LaidOutStructure[0].LaidOutContent, HasLen, 1)
+
+	// the system volume is returned
+	lv, err := gadget.LaidOutVolumeFromGadget(s.dir, uc20Constraints)
+	c.Assert(err, IsNil)
+	c.Check(lv.LaidOutStructure, HasLen, 6)
+	c.Check(lv.Volume.Bootloader, Equals, "grub")
+}
+
+func (s *gadgetYamlTestSuite) TestLaidOutVolumesFromGadgetNoSystemVolume(c *C) {
+	err := ioutil.WriteFile(s.gadgetYamlPath, []byte(`
+volumes:
+  one:
+    bootloader: u-boot
+    schema: mbr
+    structure:
+      - name: foo
+        type: bare
+        size: 1M
+  two:
+    schema: mbr
+    structure:
+      - name: bar
+        type: bare
+        size: 1M
+`), 0644)
+	c.Assert(err, IsNil)
+
+	_, _, err = gadget.LaidOutVolumesFromGadget(s.dir, nil)
+	c.Assert(err, ErrorMatches, "cannot find the system volume among the gadget volumes")
 }
 
 func (s *gadgetYamlTestSuite) TestLaidOutVolumeFromGadgetHappy(c *C) {
@@ -2108,7 +2227,7 @@ volumes:
 		err        string
 	}{
 		{mockOtherYaml, `cannot find entry for volume "volumename" in updated gadget info`},
-		{mockManyYaml, "gadgets with multiple volumes are unsupported"},
+		{mockManyYaml, `cannot add volume "volumename-many" with an update`},
 		{mockBadStructureSizeYaml, `cannot lay out the new volume: cannot lay out volume, structure #0 \("bad-size"\) size is not a multiple of sector size 512`},
 		{mockBadIDYaml, "incompatible layout change: incompatible ID change from 0C to 0D"},
 		{mockSchemaYaml, "incompatible layout change: incompatible schema change from mbr to gpt"},
@@ -2129,6 +2248,55 @@ volumes:
 	}
 }
 
+func (s *gadgetCompatibilityTestSuite) TestGadgetIsCompatibleMultiVolume(c *C) {
+	var mockYaml = []byte(`
+volumes:
+  volumename:
+    schema: mbr
+    bootloader: u-boot
+    id: 0C
+  other:
+    schema: gpt
+    id: 0D
+`)
+	var mockBadIDYaml = []byte(`
+volumes:
+  volumename:
+    schema: mbr
+    bootloader: u-boot
+    id: 0C
+  other:
+    schema: gpt
+    id: 0E
+`)
+	var mockRemovedYaml = []byte(`
+volumes:
+  volumename:
+    schema: mbr
+    bootloader: u-boot
+    id: 0C
+`)
+	gi, err := gadget.InfoFromGadgetYaml(mockYaml, coreConstraints)
+	c.Assert(err, IsNil)
+	for _, tc := range []struct {
+		gadgetYaml []byte
+		err        string
+	}{
+		{mockYaml, ""},
+		{mockBadIDYaml, `volume "other": incompatible layout change: incompatible ID change from 0D to 0E`},
+		{mockRemovedYaml, `cannot find entry for volume "other" in updated gadget info`},
+	} {
+		giNew, err := gadget.InfoFromGadgetYaml(tc.gadgetYaml, coreConstraints)
+		c.Assert(err, IsNil)
+		err = gadget.IsCompatible(gi, giNew)
+		if tc.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, tc.err)
+		}
+	}
+}
+
 func (s *gadgetCompatibilityTestSuite) TestGadgetIsCompatibleBadStructure(c *C) {
 	var baseYaml = `
 volumes:
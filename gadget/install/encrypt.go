@@ -38,6 +38,7 @@ var (
 var (
 	secbootFormatEncryptedDevice = secboot.FormatEncryptedDevice
 	secbootAddRecoveryKey        = secboot.AddRecoveryKey
+	secbootAddPassphrase         = secboot.AddPassphrase
 )
 
 // encryptedDevice represents a LUKS-backed encrypted block device.
@@ -74,6 +75,10 @@ func (dev *encryptedDevice) AddRecoveryKey(key secboot.EncryptionKey, rkey secbo
 	return secbootAddRecoveryKey(key, rkey, dev.parent.Node)
 }
 
+func (dev *encryptedDevice) AddPassphrase(key secboot.EncryptionKey, passphrase string) error {
+	return secbootAddPassphrase(key, passphrase, dev.parent.Node)
+}
+
 func (dev *encryptedDevice) Close() error {
 	return cryptsetupClose(dev.name)
 }
@@ -176,3 +176,42 @@ func (s *encryptSuite) TestAddRecoveryKey(c *C) {
 		})
 	}
 }
+
+func (s *encryptSuite) TestAddPassphrase(c *C) {
+	for _, tc := range []struct {
+		mockedAddErr error
+		expectedErr  string
+	}{
+		{mockedAddErr: nil, expectedErr: ""},
+		{mockedAddErr: errors.New("add passphrase error"), expectedErr: "add passphrase error"},
+	} {
+		s.mockCryptsetup = testutil.MockCommand(c, "cryptsetup", "")
+		s.AddCleanup(s.mockCryptsetup.Restore)
+
+		restore := install.MockSecbootFormatEncryptedDevice(func(key secboot.EncryptionKey, label, node string) error {
+			return nil
+		})
+		defer restore()
+
+		calls := 0
+		restore = install.MockSecbootAddPassphrase(func(key secboot.EncryptionKey, passphrase, node string) error {
+			calls++
+			c.Assert(key, DeepEquals, s.mockedEncryptionKey)
+			c.Assert(passphrase, Equals, "my passphrase")
+			c.Assert(node, Equals, "/dev/node1")
+			return tc.mockedAddErr
+		})
+		defer restore()
+
+		dev, err := install.NewEncryptedDevice(&mockDeviceStructure, s.mockedEncryptionKey, "some-label")
+		c.Assert(err, IsNil)
+
+		err = dev.AddPassphrase(s.mockedEncryptionKey, "my passphrase")
+		c.Assert(calls, Equals, 1)
+		if tc.expectedErr == "" {
+			c.Assert(err, IsNil)
+		} else {
+			c.Assert(err, ErrorMatches, tc.expectedErr)
+		}
+	}
+}
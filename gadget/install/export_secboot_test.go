@@ -45,3 +45,11 @@ func MockSecbootAddRecoveryKey(f func(key secboot.EncryptionKey, rkey secboot.Re
 		secbootAddRecoveryKey = old
 	}
 }
+
+func MockSecbootAddPassphrase(f func(key secboot.EncryptionKey, passphrase, node string) error) (restore func()) {
+	old := secbootAddPassphrase
+	secbootAddPassphrase = f
+	return func() {
+		secbootAddPassphrase = old
+	}
+}
@@ -24,9 +24,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/gadget/quantity"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/secboot"
 )
@@ -52,7 +54,9 @@ func deviceFromRole(lv *gadget.LaidOutVolume, role string) (device string, err e
 }
 
 // Run bootstraps the partitions of a device, by either creating
-// missing ones or recreating installed ones.
+// missing ones or recreating installed ones. For multi-volume gadgets,
+// the other volumes are bootstrapped on the disks holding their existing
+// structures.
 func Run(model gadget.Model, gadgetRoot, device string, options Options, observer gadget.ContentObserver) (*InstalledSystemSideData, error) {
 	logger.Noticef("installing a new system")
 	logger.Noticef("        gadget data from: %v", gadgetRoot)
@@ -63,7 +67,7 @@ func Run(model gadget.Model, gadgetRoot, device string, options Options, observe
 		return nil, fmt.Errorf("cannot use empty gadget root directory")
 	}
 
-	lv, err := gadget.LaidOutVolumeFromGadget(gadgetRoot, model)
+	lv, volumes, err := gadget.LaidOutVolumesFromGadget(gadgetRoot, model)
 	if err != nil {
 		return nil, fmt.Errorf("cannot layout the volume: %v", err)
 	}
@@ -79,20 +83,23 @@ func Run(model gadget.Model, gadgetRoot, device string, options Options, observe
 		}
 	}
 
-	diskLayout, err := gadget.OnDiskVolumeFromDevice(device)
-	if err != nil {
-		return nil, fmt.Errorf("cannot read %v partitions: %v", device, err)
-	}
-
-	// check if the current partition table is compatible with the gadget,
-	// ignoring partitions added by the installer (will be removed later)
-	if err := ensureLayoutCompatibility(lv, diskLayout); err != nil {
-		return nil, fmt.Errorf("gadget and %v partition table not compatible: %v", device, err)
+	// the system volume goes first, the other volumes of multi-volume
+	// gadgets are matched to their disks through their existing
+	// structures
+	installVolumes := []*installVolume{{laidOut: lv, device: device}}
+	for _, name := range otherVolumeNames(lv, volumes) {
+		vol := volumes[name]
+		volDevice, err := gadget.FindDiskForVolume(vol)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find device for volume %q: %v", name, err)
+		}
+		installVolumes = append(installVolumes, &installVolume{laidOut: vol, device: volDevice})
 	}
 
-	// remove partitions added during a previous install attempt
-	if err := removeCreatedPartitions(lv, diskLayout); err != nil {
-		return nil, fmt.Errorf("cannot remove partitions from previous install: %v", err)
+	for _, vol := range installVolumes {
+		if err := vol.prepare(); err != nil {
+			return nil, err
+		}
 	}
 	// at this point we removed any existing partition, nuke any
 	// of the existing sealed key files placed outside of the
@@ -104,31 +111,16 @@ func Run(model gadget.Model, gadgetRoot, device string, options Options, observe
 		}
 	}
 
-	created, err := createMissingPartitions(diskLayout, lv)
-	if err != nil {
-		return nil, fmt.Errorf("cannot create the partitions: %v", err)
-	}
-
-	makeKeySet := func() (*EncryptionKeySet, error) {
-		key, err := secboot.NewEncryptionKey()
+	var created []gadget.OnDiskStructure
+	for _, vol := range installVolumes {
+		volCreated, err := createMissingPartitions(vol.diskLayout, vol.laidOut)
 		if err != nil {
-			return nil, fmt.Errorf("cannot create encryption key: %v", err)
+			return nil, fmt.Errorf("cannot create the partitions: %v", err)
 		}
-
-		rkey, err := secboot.NewRecoveryKey()
-		if err != nil {
-			return nil, fmt.Errorf("cannot create recovery key: %v", err)
-		}
-		return &EncryptionKeySet{
-			Key:         key,
-			RecoveryKey: rkey,
-		}, nil
-	}
-	roleNeedsEncryption := func(role string) bool {
-		return role == gadget.SystemData || role == gadget.SystemSave
+		created = append(created, volCreated...)
 	}
-	var keysForRoles map[string]*EncryptionKeySet
 
+	var keysForRoles map[string]*EncryptionKeySet
 	for _, part := range created {
 		roleFmt := ""
 		if part.Role != "" {
@@ -136,48 +128,204 @@ func Run(model gadget.Model, gadgetRoot, device string, options Options, observe
 		}
 		logger.Noticef("created new partition %v for structure %v (size %v) %s",
 			part.Node, part, part.Size.IECString(), roleFmt)
-		if options.Encrypt && roleNeedsEncryption(part.Role) {
-			keys, err := makeKeySet()
-			if err != nil {
-				return nil, err
-			}
-			logger.Noticef("encrypting partition device %v", part.Node)
-			dataPart, err := newEncryptedDevice(&part, keys.Key, part.Label)
-			if err != nil {
-				return nil, err
-			}
-
-			if err := dataPart.AddRecoveryKey(keys.Key, keys.RecoveryKey); err != nil {
-				return nil, err
-			}
-
-			// update the encrypted device node
-			part.Node = dataPart.Node
+		keys, err := installOnePartition(&part, gadgetRoot, options, observer)
+		if err != nil {
+			return nil, err
+		}
+		if keys != nil {
 			if keysForRoles == nil {
 				keysForRoles = map[string]*EncryptionKeySet{}
 			}
 			keysForRoles[part.Role] = keys
-			logger.Noticef("encrypted device %v", part.Node)
 		}
+	}
+
+	return &InstalledSystemSideData{
+		KeysForRoles: keysForRoles,
+	}, nil
+}
+
+// FactoryReset recreates the ubuntu-boot and ubuntu-data partitions of
+// an installed system, keeping the partition table and ubuntu-save
+// intact. With encryption, ubuntu-data is encrypted with a new key.
+func FactoryReset(model gadget.Model, gadgetRoot, device string, options Options, observer gadget.ContentObserver) (*InstalledSystemSideData, error) {
+	logger.Noticef("performing factory reset on an installed device")
+	logger.Noticef("        gadget data from: %v", gadgetRoot)
+	if options.Encrypt {
+		logger.Noticef("        encryption: on")
+	}
+	if gadgetRoot == "" {
+		return nil, fmt.Errorf("cannot use empty gadget root directory")
+	}
+
+	lv, _, err := gadget.LaidOutVolumesFromGadget(gadgetRoot, model)
+	if err != nil {
+		return nil, fmt.Errorf("cannot layout the volume: %v", err)
+	}
+
+	if device == "" {
+		device, err = deviceFromRole(lv, gadget.SystemSeed)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find device to recreate partitions on: %v", err)
+		}
+	}
+
+	diskLayout, err := gadget.OnDiskVolumeFromDevice(device)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %v partitions: %v", device, err)
+	}
+	if err := ensureLayoutCompatibility(lv, diskLayout); err != nil {
+		return nil, fmt.Errorf("gadget and %v partition table not compatible: %v", device, err)
+	}
 
-		if err := makeFilesystem(&part); err != nil {
+	var keysForRoles map[string]*EncryptionKeySet
+	for _, ls := range lv.LaidOutStructure {
+		if ls.Role != gadget.SystemBoot && ls.Role != gadget.SystemData {
+			continue
+		}
+		ds, err := onDiskStructureAt(diskLayout, ls.StartOffset)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find partition for role %v: %v", ls.Role, err)
+		}
+		part := gadget.OnDiskStructure{
+			LaidOutStructure: ls,
+			Node:             ds.Node,
+			Size:             ds.Size,
+		}
+		logger.Noticef("recreating partition %v for structure %v (size %v) role %v",
+			part.Node, part, part.Size.IECString(), part.Role)
+		keys, err := installOnePartition(&part, gadgetRoot, options, observer)
+		if err != nil {
 			return nil, err
 		}
+		if keys != nil {
+			keysForRoles = map[string]*EncryptionKeySet{part.Role: keys}
+		}
+	}
+
+	return &InstalledSystemSideData{
+		KeysForRoles: keysForRoles,
+	}, nil
+}
 
-		if err := writeContent(&part, gadgetRoot, observer); err != nil {
+func onDiskStructureAt(diskLayout *gadget.OnDiskVolume, offset quantity.Offset) (*gadget.OnDiskStructure, error) {
+	for i, ds := range diskLayout.Structure {
+		if ds.StartOffset == offset {
+			return &diskLayout.Structure[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no partition starts at offset %d (%s) on %v", offset, offset.IECString(), diskLayout.Device)
+}
+
+func makeKeySet() (*EncryptionKeySet, error) {
+	key, err := secboot.NewEncryptionKey()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create encryption key: %v", err)
+	}
+
+	rkey, err := secboot.NewRecoveryKey()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create recovery key: %v", err)
+	}
+	return &EncryptionKeySet{
+		Key:         key,
+		RecoveryKey: rkey,
+	}, nil
+}
+
+func roleNeedsEncryption(role string) bool {
+	return role == gadget.SystemData || role == gadget.SystemSave
+}
+
+// installOnePartition encrypts if needed, creates the filesystem and
+// writes the content of the given partition, mounting it if requested.
+// It returns the encryption keys of the partition, if it was encrypted.
+func installOnePartition(part *gadget.OnDiskStructure, gadgetRoot string, options Options, observer gadget.ContentObserver) (*EncryptionKeySet, error) {
+	var keys *EncryptionKeySet
+	if options.Encrypt && roleNeedsEncryption(part.Role) {
+		var err error
+		keys, err = makeKeySet()
+		if err != nil {
+			return nil, err
+		}
+		logger.Noticef("encrypting partition device %v", part.Node)
+		dataPart, err := newEncryptedDevice(part, keys.Key, part.Label)
+		if err != nil {
 			return nil, err
 		}
 
-		if options.Mount && part.Label != "" && part.HasFilesystem() {
-			if err := mountFilesystem(&part, boot.InitramfsRunMntDir); err != nil {
+		if err := dataPart.AddRecoveryKey(keys.Key, keys.RecoveryKey); err != nil {
+			return nil, err
+		}
+		if options.Passphrase != "" {
+			if err := dataPart.AddPassphrase(keys.Key, options.Passphrase); err != nil {
 				return nil, err
 			}
 		}
+
+		// update the encrypted device node
+		part.Node = dataPart.Node
+		logger.Noticef("encrypted device %v", part.Node)
 	}
 
-	return &InstalledSystemSideData{
-		KeysForRoles: keysForRoles,
-	}, nil
+	if err := makeFilesystem(part); err != nil {
+		return nil, err
+	}
+
+	if err := writeContent(part, gadgetRoot, observer); err != nil {
+		return nil, err
+	}
+
+	if options.Mount && part.Label != "" && part.HasFilesystem() {
+		if err := mountFilesystem(part, boot.InitramfsRunMntDir); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// installVolume is a gadget volume to install along with the device it is
+// installed on.
+type installVolume struct {
+	laidOut    *gadget.LaidOutVolume
+	device     string
+	diskLayout *gadget.OnDiskVolume
+}
+
+// prepare reads the partition table of the device, checks that the volume
+// can be installed there and removes the partitions created during a
+// previous install attempt.
+func (vol *installVolume) prepare() error {
+	diskLayout, err := gadget.OnDiskVolumeFromDevice(vol.device)
+	if err != nil {
+		return fmt.Errorf("cannot read %v partitions: %v", vol.device, err)
+	}
+
+	// check if the current partition table is compatible with the gadget,
+	// ignoring partitions added by the installer (will be removed later)
+	if err := ensureLayoutCompatibility(vol.laidOut, diskLayout); err != nil {
+		return fmt.Errorf("gadget and %v partition table not compatible: %v", vol.device, err)
+	}
+
+	// remove partitions added during a previous install attempt
+	if err := removeCreatedPartitions(vol.laidOut, diskLayout); err != nil {
+		return fmt.Errorf("cannot remove partitions from previous install: %v", err)
+	}
+	vol.diskLayout = diskLayout
+	return nil
+}
+
+// otherVolumeNames returns the sorted names of the volumes other than the
+// system one.
+func otherVolumeNames(system *gadget.LaidOutVolume, volumes map[string]*gadget.LaidOutVolume) []string {
+	var names []string
+	for name, vol := range volumes {
+		if vol != system {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // isCreatableAtInstall returns whether the gadget structure would be created at
@@ -29,3 +29,7 @@ import (
 func Run(model gadget.Model, gadgetRoot, device string, options Options, _ gadget.ContentObserver) (*InstalledSystemSideData, error) {
 	return nil, fmt.Errorf("build without secboot support")
 }
+
+func FactoryReset(model gadget.Model, gadgetRoot, device string, options Options, _ gadget.ContentObserver) (*InstalledSystemSideData, error) {
+	return nil, fmt.Errorf("build without secboot support")
+}
@@ -60,6 +60,12 @@ func (s *installSuite) TestInstallRunError(c *C) {
 	c.Check(sys, IsNil)
 }
 
+func (s *installSuite) TestFactoryResetError(c *C) {
+	sys, err := install.FactoryReset(nil, "", "", install.Options{}, nil)
+	c.Assert(err, ErrorMatches, "cannot use empty gadget root directory")
+	c.Check(sys, IsNil)
+}
+
 const mockGadgetYaml = `volumes:
   pc:
     bootloader: grub
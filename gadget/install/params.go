@@ -28,6 +28,9 @@ type Options struct {
 	Mount bool
 	// Encrypt the data partition
 	Encrypt bool
+	// Passphrase to add as an additional way to unlock the encrypted
+	// partitions, if not empty
+	Passphrase string
 }
 
 // EncryptionKeySet is a set of encryption keys.
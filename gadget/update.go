@@ -22,6 +22,8 @@ package gadget
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
+	"sort"
 
 	"github.com/snapcore/snapd/gadget/quantity"
 	"github.com/snapcore/snapd/logger"
@@ -120,85 +122,173 @@ type ContentUpdateObserver interface {
 //
 // Data that would be modified during the update is first backed up inside the
 // rollback directory. Should the apply step fail, the modified data is
-// recovered.
+// recovered. For gadgets with multiple volumes, each volume is backed up in
+// its own subdirectory of the rollback directory, named after the volume.
+// Volumes added or removed by the new gadget, and volumes other than the
+// system one whose disk cannot be found, are skipped with a warning.
 func Update(old, new GadgetData, rollbackDirPath string, updatePolicy UpdatePolicyFunc, observer ContentUpdateObserver) error {
-	// TODO: support multi-volume gadgets. But for now we simply
-	//       do not do any gadget updates on those. We cannot error
-	//       here because this would break refreshes of gadgets even
-	//       when they don't require any updates.
-	if len(new.Info.Volumes) != 1 || len(old.Info.Volumes) != 1 {
-		logger.Noticef("WARNING: gadget assests cannot be updated yet when multiple volumes are used")
-		return nil
-	}
-
-	oldVol, newVol, err := resolveVolume(old.Info, new.Info)
+	pairs, err := resolveUpdatedVolumes(old.Info, new.Info)
 	if err != nil {
 		return err
 	}
 
+	if updatePolicy == nil {
+		updatePolicy = defaultPolicy
+	}
+
+	var updates []updatePair
+	for _, pair := range pairs {
+		volUpdates, err := resolveVolumeUpdate(pair.old, pair.new, new.RootDir, updatePolicy)
+		if err != nil {
+			if len(pairs) > 1 {
+				return fmt.Errorf("volume %q: %v", pair.name, err)
+			}
+			return err
+		}
+		if len(volUpdates) == 0 {
+			continue
+		}
+		// the structures of the system volume can fall back to the
+		// disk of /writable, like in LaidOutVolumesFromGadget the only
+		// volume of a gadget is its system volume
+		systemVolume := len(new.Info.Volumes) == 1 || IsSystemVolume(pair.new)
+		if !systemVolume {
+			// we cannot error here because this would break
+			// refreshes of gadgets whose other volumes are not
+			// present on the device
+			_, err := findDiskForVolume(volUpdates[0].volume)
+			if err == ErrDeviceNotFound {
+				logger.Noticef("WARNING: cannot find the disk of volume %q, its assets are not updated", pair.name)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("volume %q: %v", pair.name, err)
+			}
+		}
+		rollbackDir := rollbackDirPath
+		if len(pairs) > 1 {
+			rollbackDir = filepath.Join(rollbackDirPath, pair.name)
+		}
+		for i := range volUpdates {
+			volUpdates[i].rollbackDir = rollbackDir
+			volUpdates[i].systemVolume = systemVolume
+		}
+		updates = append(updates, volUpdates...)
+	}
+	if len(updates) == 0 {
+		// nothing to update
+		return ErrNoUpdate
+	}
+
+	return applyUpdates(new, updates, observer)
+}
+
+// resolveVolumeUpdate returns the structures of the given volume that need
+// an update.
+func resolveVolumeUpdate(oldVol, newVol *Volume, newRootDir string, updatePolicy UpdatePolicyFunc) ([]updatePair, error) {
 	if oldVol.Schema == "" || newVol.Schema == "" {
-		return fmt.Errorf("internal error: unset volume schemas: old: %q new: %q", oldVol.Schema, newVol.Schema)
+		return nil, fmt.Errorf("internal error: unset volume schemas: old: %q new: %q", oldVol.Schema, newVol.Schema)
 	}
 
 	// layout old partially, without going deep into the layout of structure
 	// content
 	pOld, err := LayoutVolumePartially(oldVol, defaultConstraints)
 	if err != nil {
-		return fmt.Errorf("cannot lay out the old volume: %v", err)
+		return nil, fmt.Errorf("cannot lay out the old volume: %v", err)
 	}
 
 	// layout new
-	pNew, err := LayoutVolume(new.RootDir, newVol, defaultConstraints)
+	pNew, err := LayoutVolume(newRootDir, newVol, defaultConstraints)
 	if err != nil {
-		return fmt.Errorf("cannot lay out the new volume: %v", err)
+		return nil, fmt.Errorf("cannot lay out the new volume: %v", err)
 	}
 
 	if err := canUpdateVolume(pOld, pNew); err != nil {
-		return fmt.Errorf("cannot apply update to volume: %v", err)
+		return nil, fmt.Errorf("cannot apply update to volume: %v", err)
 	}
 
-	if updatePolicy == nil {
-		updatePolicy = defaultPolicy
-	}
 	// now we know which structure is which, find which ones need an update
 	updates, err := resolveUpdate(pOld, pNew, updatePolicy)
 	if err != nil {
-		return err
-	}
-	if len(updates) == 0 {
-		// nothing to update
-		return ErrNoUpdate
+		return nil, err
 	}
 
 	// can update old layout to new layout
 	for _, update := range updates {
 		if err := canUpdateStructure(update.from, update.to, pNew.Schema); err != nil {
-			return fmt.Errorf("cannot update volume structure %v: %v", update.to, err)
+			return nil, fmt.Errorf("cannot update volume structure %v: %v", update.to, err)
 		}
 	}
+	return updates, nil
+}
 
-	return applyUpdates(new, updates, rollbackDirPath, observer)
+// volumePair holds the definitions of a volume in the old and new gadget.
+type volumePair struct {
+	name string
+	old  *Volume
+	new  *Volume
 }
 
-func resolveVolume(old *Info, new *Info) (oldVol, newVol *Volume, err error) {
-	// support only one volume
-	if len(new.Volumes) != 1 || len(old.Volumes) != 1 {
-		return nil, nil, errors.New("cannot update with more than one volume")
+// resolveVolumes matches the volumes of the old and new gadget by name, the
+// set of volumes cannot change. The pairs are sorted by volume name.
+func resolveVolumes(old *Info, new *Info) ([]volumePair, error) {
+	names := make([]string, 0, len(old.Volumes))
+	for name := range old.Volumes {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	var name string
-	for n := range old.Volumes {
-		name = n
-		break
+	pairs := make([]volumePair, 0, len(names))
+	for _, name := range names {
+		newV, ok := new.Volumes[name]
+		if !ok {
+			return nil, fmt.Errorf("cannot find entry for volume %q in updated gadget info", name)
+		}
+		pairs = append(pairs, volumePair{name: name, old: old.Volumes[name], new: newV})
+	}
+	for name := range new.Volumes {
+		if _, ok := old.Volumes[name]; !ok {
+			return nil, fmt.Errorf("cannot add volume %q with an update", name)
+		}
+	}
+	return pairs, nil
+}
+
+// resolveUpdatedVolumes is like resolveVolumes, but the volumes that were
+// added or removed by the new gadget with multiple volumes are skipped with a
+// warning. We cannot error here because this would break refreshes of
+// gadgets even when they don't require any updates.
+func resolveUpdatedVolumes(old *Info, new *Info) ([]volumePair, error) {
+	if len(old.Volumes) == 1 && len(new.Volumes) == 1 {
+		return resolveVolumes(old, new)
 	}
-	oldV := old.Volumes[name]
 
-	newV, ok := new.Volumes[name]
-	if !ok {
-		return nil, nil, fmt.Errorf("cannot find entry for volume %q in updated gadget info", name)
+	names := make([]string, 0, len(old.Volumes))
+	for name := range old.Volumes {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	return oldV, newV, nil
+	pairs := make([]volumePair, 0, len(names))
+	for _, name := range names {
+		newV, ok := new.Volumes[name]
+		if !ok {
+			logger.Noticef("WARNING: volume %q was removed from the gadget, its assets are not updated", name)
+			continue
+		}
+		pairs = append(pairs, volumePair{name: name, old: old.Volumes[name], new: newV})
+	}
+	added := make([]string, 0, len(new.Volumes))
+	for name := range new.Volumes {
+		if _, ok := old.Volumes[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		logger.Noticef("WARNING: volume %q was added to the gadget, it cannot be set up with an update", name)
+	}
+	return pairs, nil
 }
 
 func isSameOffset(one *quantity.Offset, two *quantity.Offset) bool {
@@ -293,6 +383,12 @@ func canUpdateVolume(from *PartiallyLaidOutVolume, to *LaidOutVolume) error {
 type updatePair struct {
 	from *LaidOutStructure
 	to   *LaidOutStructure
+
+	// volume is the new layout of the volume of the structure
+	volume *LaidOutVolume
+	// systemVolume is set when the structure is in the system volume
+	systemVolume bool
+	rollbackDir  string
 }
 
 func defaultPolicy(from, to *LaidOutStructure) bool {
@@ -320,8 +416,9 @@ func resolveUpdate(oldVol *PartiallyLaidOutVolume, newVol *LaidOutVolume, policy
 		// available
 		if policy(&oldStruct, &newStruct) {
 			updates = append(updates, updatePair{
-				from: &oldVol.LaidOutStructure[j],
-				to:   &newVol.LaidOutStructure[j],
+				from:   &oldVol.LaidOutStructure[j],
+				to:     &newVol.LaidOutStructure[j],
+				volume: newVol,
 			})
 		}
 	}
@@ -340,11 +437,16 @@ type Updater interface {
 	Rollback() error
 }
 
-func applyUpdates(new GadgetData, updates []updatePair, rollbackDir string, observer ContentUpdateObserver) error {
+func applyUpdates(new GadgetData, updates []updatePair, observer ContentUpdateObserver) error {
 	updaters := make([]Updater, len(updates))
 
 	for i, one := range updates {
-		up, err := updaterForStructure(one.to, new.RootDir, rollbackDir, observer)
+		vol := one.volume
+		if one.systemVolume {
+			// the structures can be found through /writable
+			vol = nil
+		}
+		up, err := updaterForStructure(one.to, vol, new.RootDir, one.rollbackDir, observer)
 		if err != nil {
 			return fmt.Errorf("cannot prepare update for volume structure %v: %v", one.to, err)
 		}
@@ -417,11 +519,21 @@ func applyUpdates(new GadgetData, updates []updatePair, rollbackDir string, obse
 
 var updaterForStructure = updaterForStructureImpl
 
-func updaterForStructureImpl(ps *LaidOutStructure, newRootDir, rollbackDir string, observer ContentUpdateObserver) (Updater, error) {
+var findDiskForVolume = FindDiskForVolume
+
+// updaterForStructureImpl returns the updater of the given structure, vol is
+// the layout of its volume, or nil for the system volume.
+func updaterForStructureImpl(ps *LaidOutStructure, vol *LaidOutVolume, newRootDir, rollbackDir string, observer ContentUpdateObserver) (Updater, error) {
 	var updater Updater
 	var err error
 	if !ps.HasFilesystem() {
-		updater, err = newRawStructureUpdater(newRootDir, ps, rollbackDir, findDeviceForStructureWithFallback)
+		deviceLookup := findDeviceForStructureWithFallback
+		if vol != nil {
+			// the fallback to the disk of /writable applies
+			// to the system volume only
+			deviceLookup = findDeviceForStructureInVolume(vol)
+		}
+		updater, err = newRawStructureUpdater(newRootDir, ps, rollbackDir, deviceLookup)
 	} else {
 		updater, err = newMountedFilesystemUpdater(newRootDir, ps, rollbackDir, findMountPointForStructure, observer)
 	}
@@ -429,7 +541,7 @@ func updaterForStructureImpl(ps *LaidOutStructure, newRootDir, rollbackDir strin
 }
 
 // MockUpdaterForStructure replace internal call with a mocked one, for use in tests only
-func MockUpdaterForStructure(mock func(ps *LaidOutStructure, rootDir, rollbackDir string, observer ContentUpdateObserver) (Updater, error)) (restore func()) {
+func MockUpdaterForStructure(mock func(ps *LaidOutStructure, vol *LaidOutVolume, rootDir, rollbackDir string, observer ContentUpdateObserver) (Updater, error)) (restore func()) {
 	old := updaterForStructure
 	updaterForStructure = mock
 	return func() {
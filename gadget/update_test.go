@@ -25,7 +25,6 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 
 	. "gopkg.in/check.v1"
 
@@ -41,7 +40,7 @@ type updateTestSuite struct{}
 
 var _ = Suite(&updateTestSuite{})
 
-func (u *updateTestSuite) TestResolveVolumeDifferentName(c *C) {
+func (u *updateTestSuite) TestResolveVolumesDifferentName(c *C) {
 	oldInfo := &gadget.Info{
 		Volumes: map[string]*gadget.Volume{
 			"old": {},
@@ -52,13 +51,12 @@ func (u *updateTestSuite) TestResolveVolumeDifferentName(c *C) {
 			"not-old": {},
 		},
 	}
-	oldVol, newVol, err := gadget.ResolveVolume(oldInfo, noMatchInfo)
+	pairs, err := gadget.ResolveVolumes(oldInfo, noMatchInfo)
 	c.Assert(err, ErrorMatches, `cannot find entry for volume "old" in updated gadget info`)
-	c.Assert(oldVol, IsNil)
-	c.Assert(newVol, IsNil)
+	c.Assert(pairs, IsNil)
 }
 
-func (u *updateTestSuite) TestResolveVolumeTooMany(c *C) {
+func (u *updateTestSuite) TestResolveVolumesRemoved(c *C) {
 	oldInfo := &gadget.Info{
 		Volumes: map[string]*gadget.Volume{
 			"old":         {},
@@ -70,27 +68,90 @@ func (u *updateTestSuite) TestResolveVolumeTooMany(c *C) {
 			"old": {},
 		},
 	}
-	oldVol, newVol, err := gadget.ResolveVolume(oldInfo, noMatchInfo)
-	c.Assert(err, ErrorMatches, `cannot update with more than one volume`)
-	c.Assert(oldVol, IsNil)
-	c.Assert(newVol, IsNil)
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	pairs, err := gadget.ResolveVolumes(oldInfo, noMatchInfo)
+	c.Assert(err, ErrorMatches, `cannot find entry for volume "another-one" in updated gadget info`)
+	c.Assert(pairs, IsNil)
+
+	// the removed volume is skipped by updates
+	pairs, err = gadget.ResolveUpdatedVolumes(oldInfo, noMatchInfo)
+	c.Assert(err, IsNil)
+	c.Assert(pairs, HasLen, 1)
+	c.Check(pairs[0].Name(), Equals, "old")
+	c.Check(logbuf.String(), testutil.Contains, `WARNING: volume "another-one" was removed from the gadget, its assets are not updated`)
+}
+
+func (u *updateTestSuite) TestResolveVolumesAdded(c *C) {
+	oldInfo := &gadget.Info{
+		Volumes: map[string]*gadget.Volume{
+			"old": {},
+		},
+	}
+	newInfo := &gadget.Info{
+		Volumes: map[string]*gadget.Volume{
+			"old":         {},
+			"another-one": {},
+		},
+	}
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	pairs, err := gadget.ResolveVolumes(oldInfo, newInfo)
+	c.Assert(err, ErrorMatches, `cannot add volume "another-one" with an update`)
+	c.Assert(pairs, IsNil)
+
+	// the added volume is skipped by updates
+	pairs, err = gadget.ResolveUpdatedVolumes(oldInfo, newInfo)
+	c.Assert(err, IsNil)
+	c.Assert(pairs, HasLen, 1)
+	c.Check(pairs[0].Name(), Equals, "old")
+	c.Check(logbuf.String(), testutil.Contains, `WARNING: volume "another-one" was added to the gadget, it cannot be set up with an update`)
 }
 
-func (u *updateTestSuite) TestResolveVolumeSimple(c *C) {
+func (u *updateTestSuite) TestResolveVolumesSimple(c *C) {
 	oldInfo := &gadget.Info{
 		Volumes: map[string]*gadget.Volume{
 			"old": {Bootloader: "u-boot"},
 		},
 	}
-	noMatchInfo := &gadget.Info{
+	newInfo := &gadget.Info{
 		Volumes: map[string]*gadget.Volume{
 			"old": {Bootloader: "grub"},
 		},
 	}
-	oldVol, newVol, err := gadget.ResolveVolume(oldInfo, noMatchInfo)
+	pairs, err := gadget.ResolveVolumes(oldInfo, newInfo)
+	c.Assert(err, IsNil)
+	c.Assert(pairs, HasLen, 1)
+	c.Check(pairs[0].Name(), Equals, "old")
+	c.Check(pairs[0].Old(), DeepEquals, &gadget.Volume{Bootloader: "u-boot"})
+	c.Check(pairs[0].New(), DeepEquals, &gadget.Volume{Bootloader: "grub"})
+}
+
+func (u *updateTestSuite) TestResolveVolumesMany(c *C) {
+	oldInfo := &gadget.Info{
+		Volumes: map[string]*gadget.Volume{
+			"pc":   {Bootloader: "grub"},
+			"emmc": {},
+		},
+	}
+	newInfo := &gadget.Info{
+		Volumes: map[string]*gadget.Volume{
+			"pc":   {Bootloader: "grub", ID: "0C"},
+			"emmc": {ID: "0D"},
+		},
+	}
+	pairs, err := gadget.ResolveVolumes(oldInfo, newInfo)
 	c.Assert(err, IsNil)
-	c.Assert(oldVol, DeepEquals, &gadget.Volume{Bootloader: "u-boot"})
-	c.Assert(newVol, DeepEquals, &gadget.Volume{Bootloader: "grub"})
+	c.Assert(pairs, HasLen, 2)
+	// sorted by name
+	c.Check(pairs[0].Name(), Equals, "emmc")
+	c.Check(pairs[0].Old(), Equals, oldInfo.Volumes["emmc"])
+	c.Check(pairs[0].New(), Equals, newInfo.Volumes["emmc"])
+	c.Check(pairs[1].Name(), Equals, "pc")
+	c.Check(pairs[1].Old(), Equals, oldInfo.Volumes["pc"])
+	c.Check(pairs[1].New(), Equals, newInfo.Volumes["pc"])
 }
 
 type canUpdateTestCase struct {
@@ -704,7 +765,7 @@ func (u *updateTestSuite) TestUpdateApplyHappy(c *C) {
 	updaterForStructureCalls := 0
 	updateCalls := make(map[string]bool)
 	backupCalls := make(map[string]bool)
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		c.Assert(psRootDir, Equals, newData.RootDir)
 		c.Assert(psRollbackDir, Equals, rollbackDir)
 		c.Assert(observer, Equals, muo)
@@ -785,7 +846,7 @@ func (u *updateTestSuite) TestUpdateApplyOnlyWhenNeeded(c *C) {
 
 	muo := &mockUpdateProcessObserver{}
 	updaterForStructureCalls := 0
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		c.Assert(psRootDir, Equals, newData.RootDir)
 		c.Assert(psRollbackDir, Equals, rollbackDir)
 
@@ -992,7 +1053,7 @@ func (u *updateTestSuite) TestUpdateApplyErrorDifferentVolume(c *C) {
 	newData := gadget.GadgetData{Info: newInfo, RootDir: c.MkDir()}
 	rollbackDir := c.MkDir()
 
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		c.Fatalf("unexpected call")
 		return &mockUpdater{}, nil
 	})
@@ -1038,7 +1099,7 @@ func (u *updateTestSuite) TestUpdateApplyUpdatesAreOptInWithDefaultPolicy(c *C)
 
 	muo := &mockUpdateProcessObserver{}
 
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		c.Fatalf("unexpected call")
 		return &mockUpdater{}, nil
 	})
@@ -1094,7 +1155,7 @@ func (u *updateTestSuite) TestUpdateApplyUpdatesArePolicyControlled(c *C) {
 	newData.Info.Volumes["foo"].Structure[4].Update.Edition = 5
 
 	toUpdate := map[string]int{}
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		toUpdate[ps.Name]++
 		return &mockUpdater{}, nil
 	})
@@ -1145,7 +1206,7 @@ func (u *updateTestSuite) TestUpdateApplyUpdatesRemodelPolicy(c *C) {
 	oldData.Info.Volumes["foo"].Structure[4].Update.Edition = 5
 
 	toUpdate := map[string]int{}
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		toUpdate[ps.Name] = toUpdate[ps.Name] + 1
 		return &mockUpdater{}, nil
 	})
@@ -1171,7 +1232,7 @@ func (u *updateTestSuite) TestUpdateApplyBackupFails(c *C) {
 
 	muo := &mockUpdateProcessObserver{}
 	updaterForStructureCalls := 0
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		updater := &mockUpdater{
 			updateCb: func() error {
 				c.Fatalf("unexpected update call")
@@ -1214,7 +1275,7 @@ func (u *updateTestSuite) TestUpdateApplyUpdateFailsThenRollback(c *C) {
 	backupCalls := make(map[string]bool)
 	rollbackCalls := make(map[string]bool)
 	updaterForStructureCalls := 0
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		updater := &mockUpdater{
 			backupCb: func() error {
 				backupCalls[ps.Name] = true
@@ -1281,7 +1342,7 @@ func (u *updateTestSuite) TestUpdateApplyUpdateErrorRollbackFail(c *C) {
 	backupCalls := make(map[string]bool)
 	rollbackCalls := make(map[string]bool)
 	updaterForStructureCalls := 0
-	restore = gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore = gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		updater := &mockUpdater{
 			backupCb: func() error {
 				backupCalls[ps.Name] = true
@@ -1349,7 +1410,7 @@ func (u *updateTestSuite) TestUpdateApplyBadUpdater(c *C) {
 	newData.Info.Volumes["foo"].Structure[1].Update.Edition = 2
 	newData.Info.Volumes["foo"].Structure[2].Update.Edition = 3
 
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		return nil, errors.New("bad updater for structure")
 	})
 	defer restore()
@@ -1389,7 +1450,7 @@ func (u *updateTestSuite) TestUpdaterForStructure(c *C) {
 		},
 		StartOffset: 1 * quantity.OffsetMiB,
 	}
-	updater, err := gadget.UpdaterForStructure(psBare, gadgetRootDir, rollbackDir, nil)
+	updater, err := gadget.UpdaterForStructure(psBare, nil, gadgetRootDir, rollbackDir, nil)
 	c.Assert(err, IsNil)
 	c.Assert(updater, FitsTypeOf, &gadget.RawStructureUpdater{})
 
@@ -1401,50 +1462,292 @@ func (u *updateTestSuite) TestUpdaterForStructure(c *C) {
 		},
 		StartOffset: 1 * quantity.OffsetMiB,
 	}
-	updater, err = gadget.UpdaterForStructure(psFs, gadgetRootDir, rollbackDir, nil)
+	updater, err = gadget.UpdaterForStructure(psFs, nil, gadgetRootDir, rollbackDir, nil)
 	c.Assert(err, IsNil)
 	c.Assert(updater, FitsTypeOf, &gadget.MountedFilesystemUpdater{})
 
 	// trigger errors
-	updater, err = gadget.UpdaterForStructure(psBare, gadgetRootDir, "", nil)
+	updater, err = gadget.UpdaterForStructure(psBare, nil, gadgetRootDir, "", nil)
 	c.Assert(err, ErrorMatches, "internal error: backup directory cannot be unset")
 	c.Assert(updater, IsNil)
 
-	updater, err = gadget.UpdaterForStructure(psFs, "", rollbackDir, nil)
+	updater, err = gadget.UpdaterForStructure(psFs, nil, "", rollbackDir, nil)
 	c.Assert(err, ErrorMatches, "internal error: gadget content directory cannot be unset")
 	c.Assert(updater, IsNil)
 }
 
+func addEmmcVolume(c *C, oldData, newData gadget.GadgetData) {
+	bootStruct := gadget.VolumeStructure{
+		Name: "boot-assets",
+		Type: "bare",
+		Size: 2 * quantity.SizeMiB,
+		Content: []gadget.VolumeContent{
+			{Image: "boot.img"},
+		},
+	}
+	for _, data := range []gadget.GadgetData{oldData, newData} {
+		data.Info.Volumes["emmc"] = &gadget.Volume{
+			Schema:    "mbr",
+			Structure: []gadget.VolumeStructure{bootStruct},
+		}
+		makeSizedFile(c, filepath.Join(data.RootDir, "boot.img"), quantity.SizeMiB, nil)
+	}
+}
+
+func (u *updateTestSuite) TestUpdateApplyMultiVolume(c *C) {
+	oldData, newData, rollbackDir := updateDataSet(c)
+	addEmmcVolume(c, oldData, newData)
+	restore := gadget.MockFindDiskForVolume(func(lv *gadget.LaidOutVolume) (string, error) {
+		return "/dev/mmcblk0", nil
+	})
+	defer restore()
+	// update a struct in each volume
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+	newData.Info.Volumes["emmc"].Structure[0].Update.Edition = 1
+
+	muo := &mockUpdateProcessObserver{}
+	var updated []string
+	backupCalls := make(map[string]bool)
+	restore = gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, vol *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+		c.Assert(psRootDir, Equals, newData.RootDir)
+		c.Assert(observer, Equals, muo)
+
+		switch ps.Name {
+		case "boot-assets":
+			c.Check(vol.Volume, Equals, newData.Info.Volumes["emmc"])
+			c.Check(psRollbackDir, Equals, filepath.Join(rollbackDir, "emmc"))
+			c.Check(ps.LaidOutContent, HasLen, 1)
+		case "first":
+			c.Check(vol.Volume, Equals, newData.Info.Volumes["foo"])
+			c.Check(psRollbackDir, Equals, filepath.Join(rollbackDir, "foo"))
+		default:
+			c.Fatalf("unexpected call for %q", ps.Name)
+		}
+		mu := &mockUpdater{
+			backupCb: func() error {
+				backupCalls[ps.Name] = true
+				return nil
+			},
+			updateCb: func() error {
+				updated = append(updated, ps.Name)
+				return nil
+			},
+			rollbackCb: func() error {
+				c.Fatalf("unexpected call")
+				return errors.New("not called")
+			},
+		}
+		return mu, nil
+	})
+	defer restore()
+
+	err := gadget.Update(oldData, newData, rollbackDir, nil, muo)
+	c.Assert(err, IsNil)
+	c.Check(backupCalls, DeepEquals, map[string]bool{
+		"boot-assets": true,
+		"first":       true,
+	})
+	// volumes are updated in the order of their names
+	c.Check(updated, DeepEquals, []string{"boot-assets", "first"})
+	// all the volumes are backed up before any write
+	c.Check(muo.beforeWriteCalled, Equals, 1)
+	c.Check(muo.canceledCalled, Equals, 0)
+}
+
+func (u *updateTestSuite) TestUpdateApplyMultiVolumeRollback(c *C) {
+	oldData, newData, rollbackDir := updateDataSet(c)
+	addEmmcVolume(c, oldData, newData)
+	restore := gadget.MockFindDiskForVolume(func(lv *gadget.LaidOutVolume) (string, error) {
+		return "/dev/mmcblk0", nil
+	})
+	defer restore()
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+	newData.Info.Volumes["emmc"].Structure[0].Update.Edition = 1
+
+	muo := &mockUpdateProcessObserver{}
+	var rolledBack []string
+	restore = gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, vol *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+		mu := &mockUpdater{
+			updateCb: func() error {
+				if ps.Name == "first" {
+					return errors.New("failed")
+				}
+				return nil
+			},
+			rollbackCb: func() error {
+				rolledBack = append(rolledBack, ps.Name)
+				return nil
+			},
+		}
+		return mu, nil
+	})
+	defer restore()
+
+	err := gadget.Update(oldData, newData, rollbackDir, nil, muo)
+	c.Assert(err, ErrorMatches, `cannot update volume structure #0 \("first"\): failed`)
+	// the update of the other volume is rolled back too
+	c.Check(rolledBack, DeepEquals, []string{"boot-assets", "first"})
+	c.Check(muo.canceledCalled, Equals, 1)
+}
+
+func (u *updateTestSuite) TestUpdateApplyMultiVolumeErrorIllegalStructureUpdate(c *C) {
+	oldData, newData, rollbackDir := updateDataSet(c)
+	addEmmcVolume(c, oldData, newData)
+	newData.Info.Volumes["emmc"].Structure[0].Update.Edition = 1
+	newData.Info.Volumes["emmc"].Structure[0].Size = 3 * quantity.SizeMiB
+
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, vol *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+		c.Fatalf("unexpected call")
+		return &mockUpdater{}, nil
+	})
+	defer restore()
+
+	err := gadget.Update(oldData, newData, rollbackDir, nil, nil)
+	c.Assert(err, ErrorMatches, `volume "emmc": cannot update volume structure #0 \("boot-assets"\): cannot change structure size from 2097152 to 3145728`)
+}
+
 func (u *updateTestSuite) TestUpdaterMultiVolumesDoesNotError(c *C) {
 	logbuf, restore := logger.MockLogger()
 	defer restore()
 
-	multiVolume := gadget.GadgetData{
-		Info: &gadget.Info{
-			Volumes: map[string]*gadget.Volume{
-				"1": {},
-				"2": {},
-			},
-		},
+	oldData, newData, rollbackDir := updateDataSet(c)
+	for _, data := range []gadget.GadgetData{oldData, newData} {
+		data.Info.Volumes["foo"].Structure[2].Role = gadget.SystemData
 	}
-	singleVolume := gadget.GadgetData{
-		Info: &gadget.Info{
-			Volumes: map[string]*gadget.Volume{
-				"1": {},
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+	// the volume of the new gadget cannot be set up with an update
+	newData.Info.Volumes["emmc"] = &gadget.Volume{Schema: "mbr"}
+
+	var updated []string
+	restore = gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, vol *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+		// foo is the system volume
+		c.Check(vol, IsNil)
+		return &mockUpdater{
+			updateCb: func() error {
+				updated = append(updated, ps.Name)
+				return nil
 			},
-		},
-	}
+		}, nil
+	})
+	defer restore()
+	restore = gadget.MockFindDiskForVolume(func(lv *gadget.LaidOutVolume) (string, error) {
+		c.Fatalf("unexpected call")
+		return "", nil
+	})
+	defer restore()
 
 	// a new multi volume gadget update gives no error
-	err := gadget.Update(singleVolume, multiVolume, "some-rollback-dir", nil, nil)
+	err := gadget.Update(oldData, newData, rollbackDir, nil, nil)
 	c.Assert(err, IsNil)
-	// but it warns that nothing happens either
-	c.Assert(logbuf.String(), testutil.Contains, "WARNING: gadget assests cannot be updated yet when multiple volumes are used")
+	c.Check(updated, DeepEquals, []string{"first"})
+	// but it warns that the new volume is not set up
+	c.Check(logbuf.String(), testutil.Contains, `WARNING: volume "emmc" was added to the gadget, it cannot be set up with an update`)
 
-	// same for old
-	err = gadget.Update(multiVolume, singleVolume, "some-rollback-dir", nil, nil)
+	// same for the volumes removed from the gadget
+	updated = nil
+	err = gadget.Update(newData, oldData, rollbackDir, nil, nil)
+	c.Assert(err, Equals, gadget.ErrNoUpdate)
+	c.Check(updated, HasLen, 0)
+	c.Check(logbuf.String(), testutil.Contains, `WARNING: volume "emmc" was removed from the gadget, its assets are not updated`)
+}
+
+func (u *updateTestSuite) TestUpdateApplyMultiVolumeDiskNotFound(c *C) {
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	oldData, newData, rollbackDir := updateDataSet(c)
+	addEmmcVolume(c, oldData, newData)
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+	newData.Info.Volumes["emmc"].Structure[0].Update.Edition = 1
+
+	var updated []string
+	restore = gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, vol *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+		return &mockUpdater{
+			updateCb: func() error {
+				updated = append(updated, ps.Name)
+				return nil
+			},
+		}, nil
+	})
+	defer restore()
+	restore = gadget.MockFindDiskForVolume(func(lv *gadget.LaidOutVolume) (string, error) {
+		if lv.Volume == newData.Info.Volumes["emmc"] {
+			return "", gadget.ErrDeviceNotFound
+		}
+		return "/dev/sda", nil
+	})
+	defer restore()
+
+	// the volume that is not on the device is skipped
+	err := gadget.Update(oldData, newData, rollbackDir, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(updated, DeepEquals, []string{"first"})
+	c.Check(logbuf.String(), testutil.Contains, `WARNING: cannot find the disk of volume "emmc", its assets are not updated`)
+
+	// other errors are not ignored
+	restore = gadget.MockFindDiskForVolume(func(lv *gadget.LaidOutVolume) (string, error) {
+		return "", errors.New("conflicting disk match")
+	})
+	defer restore()
+	err = gadget.Update(oldData, newData, rollbackDir, nil, nil)
+	c.Assert(err, ErrorMatches, `volume "emmc": conflicting disk match`)
+}
+
+func (u *updateTestSuite) TestUpdateApplyMultiVolumeSystemVolume(c *C) {
+	oldData, newData, rollbackDir := updateDataSet(c)
+	addEmmcVolume(c, oldData, newData)
+	for _, data := range []gadget.GadgetData{oldData, newData} {
+		data.Info.Volumes["foo"].Structure[2].Role = gadget.SystemData
+	}
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+	newData.Info.Volumes["emmc"].Structure[0].Update.Edition = 1
+
+	vols := make(map[string]*gadget.LaidOutVolume)
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, vol *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+		vols[ps.Name] = vol
+		return &mockUpdater{}, nil
+	})
+	defer restore()
+	var disks []*gadget.Volume
+	restore = gadget.MockFindDiskForVolume(func(lv *gadget.LaidOutVolume) (string, error) {
+		disks = append(disks, lv.Volume)
+		return "/dev/mmcblk0", nil
+	})
+	defer restore()
+
+	err := gadget.Update(oldData, newData, rollbackDir, nil, nil)
+	c.Assert(err, IsNil)
+	// only the disk of the other volume is looked up
+	c.Check(disks, DeepEquals, []*gadget.Volume{newData.Info.Volumes["emmc"]})
+	// and the structures of the system volume can fall back to the
+	// disk of /writable
+	c.Check(vols["first"], IsNil)
+	c.Assert(vols["boot-assets"], NotNil)
+	c.Check(vols["boot-assets"].Volume, Equals, newData.Info.Volumes["emmc"])
+}
+
+func (u *updateTestSuite) TestUpdateApplySingleVolumeIsSystemVolume(c *C) {
+	oldData, newData, rollbackDir := updateDataSet(c)
+	// the volume has no system roles, but it is the only one
+	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
+
+	called := 0
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, vol *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+		called++
+		// so its structures can fall back to the disk of /writable
+		c.Check(vol, IsNil)
+		return &mockUpdater{}, nil
+	})
+	defer restore()
+	restore = gadget.MockFindDiskForVolume(func(lv *gadget.LaidOutVolume) (string, error) {
+		c.Fatalf("unexpected call")
+		return "", nil
+	})
+	defer restore()
+
+	err := gadget.Update(oldData, newData, rollbackDir, nil, nil)
 	c.Assert(err, IsNil)
-	c.Assert(strings.Count(logbuf.String(), "WARNING: gadget assests cannot be updated yet when multiple volumes are used"), Equals, 2)
+	c.Check(called, Equals, 1)
 }
 
 func (u *updateTestSuite) TestUpdateApplyNoChangedContentInAll(c *C) {
@@ -1459,7 +1762,7 @@ func (u *updateTestSuite) TestUpdateApplyNoChangedContentInAll(c *C) {
 	muo := &mockUpdateProcessObserver{}
 	expectedStructs := []string{"first", "second"}
 	updateCalls := 0
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		mu := &mockUpdater{
 			updateCb: func() error {
 				c.Assert(expectedStructs, testutil.Contains, ps.Name)
@@ -1497,7 +1800,7 @@ func (u *updateTestSuite) TestUpdateApplyNoChangedContentInSome(c *C) {
 	muo := &mockUpdateProcessObserver{}
 	expectedStructs := []string{"first", "second"}
 	updateCalls := 0
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		mu := &mockUpdater{
 			updateCb: func() error {
 				c.Assert(expectedStructs, testutil.Contains, ps.Name)
@@ -1530,7 +1833,7 @@ func (u *updateTestSuite) TestUpdateApplyObserverBeforeWriteErrs(c *C) {
 	oldData, newData, rollbackDir := updateDataSet(c)
 	newData.Info.Volumes["foo"].Structure[0].Update.Edition = 1
 
-	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore := gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		updater := &mockUpdater{
 			updateCb: func() error {
 				c.Fatalf("unexpected call")
@@ -1561,7 +1864,7 @@ func (u *updateTestSuite) TestUpdateApplyObserverCanceledErrs(c *C) {
 
 	backupErr := errors.New("backup fails")
 	updateErr := errors.New("update fails")
-	restore = gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
+	restore = gadget.MockUpdaterForStructure(func(ps *gadget.LaidOutStructure, _ *gadget.LaidOutVolume, psRootDir, psRollbackDir string, observer gadget.ContentUpdateObserver) (gadget.Updater, error) {
 		updater := &mockUpdater{
 			backupCb: func() error { return backupErr },
 			updateCb: func() error { return updateErr },
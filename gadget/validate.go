@@ -22,6 +22,7 @@ package gadget
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/snapcore/snapd/kernel"
@@ -64,6 +65,9 @@ func Validate(info *Info, model Model, extra *ValidationConstraints) error {
 
 func validateEncryptionSupport(info *Info) error {
 	for name, vol := range info.Volumes {
+		if len(info.Volumes) > 1 && !IsSystemVolume(vol) {
+			continue
+		}
 		var haveSave bool
 		for _, s := range vol.Structure {
 			if s.Role == SystemSave {
@@ -79,15 +83,34 @@ func validateEncryptionSupport(info *Info) error {
 }
 
 func ruleValidateVolumes(vols map[string]*Volume, model Model) error {
+	var systemVolumes []string
 	for name, v := range vols {
-		if err := ruleValidateVolume(name, v, model); err != nil {
+		// with multiple volumes, only the system one carries the
+		// system roles, the others are checked for consistency below
+		checkRoles := len(vols) == 1 || IsSystemVolume(v)
+		if err := ruleValidateVolume(name, v, model, checkRoles); err != nil {
 			return fmt.Errorf("invalid volume %q: %v", name, err)
 		}
+		if checkRoles {
+			systemVolumes = append(systemVolumes, name)
+		}
+	}
+	switch {
+	case len(vols) <= 1:
+		// checked above
+	case len(systemVolumes) == 0:
+		// none of the volumes carries the system roles
+		if err := ensureVolumeRuleConsistency(&validationState{}, model); err != nil {
+			return fmt.Errorf("invalid gadget volumes: %v", err)
+		}
+	case len(systemVolumes) > 1:
+		sort.Strings(systemVolumes)
+		return fmt.Errorf("system roles must be defined in a single volume, found in %s", strutil.Quoted(systemVolumes))
 	}
 	return nil
 }
 
-func ruleValidateVolume(name string, vol *Volume, model Model) error {
+func ruleValidateVolume(name string, vol *Volume, model Model, checkRoles bool) error {
 	state := &validationState{}
 
 	for idx, s := range vol.Structure {
@@ -121,6 +144,9 @@ func ruleValidateVolume(name string, vol *Volume, model Model) error {
 
 	}
 
+	if !checkRoles {
+		return nil
+	}
 	if err := ensureVolumeRuleConsistency(state, model); err != nil {
 		return err
 	}
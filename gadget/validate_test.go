@@ -335,6 +335,76 @@ volumes:
 	}
 }
 
+const gadgetYamlEmmcVolume = `
+  emmc:
+    structure:
+      - name: boot-assets
+        type: bare
+        size: 1M
+`
+
+func (s *validateGadgetTestSuite) TestValidateMultiVolumeHappy(c *C) {
+	makeSizedFile(c, filepath.Join(s.dir, "meta/gadget.yaml"), 0, []byte(gadgetYamlContentWithSave+gadgetYamlEmmcVolume))
+
+	mod := &modelConstraints{systemSeed: true}
+	ginfo, err := gadget.ReadInfo(s.dir, mod)
+	c.Assert(err, IsNil)
+	c.Assert(ginfo.Volumes, HasLen, 2)
+	// only the system volume needs to support encryption
+	err = gadget.Validate(ginfo, mod, &gadget.ValidationConstraints{
+		EncryptedData: true,
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *validateGadgetTestSuite) TestValidateMultiVolumeRolesInManyVolumes(c *C) {
+	gadgetYamlContent := `
+volumes:
+  vol1:
+    bootloader: grub
+    structure:
+      - name: foo
+        type: DA,21686148-6449-6E6F-744E-656564454649
+        size: 1M
+        role: system-boot
+  vol2:
+    structure:
+      - name: bar
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 1M
+        role: system-data
+`
+	makeSizedFile(c, filepath.Join(s.dir, "meta/gadget.yaml"), 0, []byte(gadgetYamlContent))
+
+	ginfo, err := gadget.ReadInfo(s.dir, nil)
+	c.Assert(err, IsNil)
+	err = gadget.Validate(ginfo, nil, nil)
+	c.Assert(err, ErrorMatches, `system roles must be defined in a single volume, found in "vol1", "vol2"`)
+}
+
+func (s *validateGadgetTestSuite) TestValidateMultiVolumeNoRoles(c *C) {
+	gadgetYamlContent := `
+volumes:
+  vol1:
+    bootloader: grub
+    structure:
+      - name: foo
+        type: bare
+        size: 1M
+` + gadgetYamlEmmcVolume
+	makeSizedFile(c, filepath.Join(s.dir, "meta/gadget.yaml"), 0, []byte(gadgetYamlContent))
+
+	ginfo, err := gadget.ReadInfo(s.dir, nil)
+	c.Assert(err, IsNil)
+	// fine without constraints
+	err = gadget.Validate(ginfo, nil, nil)
+	c.Assert(err, IsNil)
+
+	mod := &modelConstraints{systemSeed: true}
+	err = gadget.Validate(ginfo, mod, nil)
+	c.Assert(err, ErrorMatches, `invalid gadget volumes: model requires system-seed partition, but no system-seed or system-data partition found`)
+}
+
 func (s *validateGadgetTestSuite) TestRuleValidateHybridGadget(c *C) {
 	// this is the kind of volumes setup recommended to be
 	// prepared for a possible UC18 -> UC20 transition
@@ -28,11 +28,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -352,9 +354,14 @@ func (tsto *ToolingStore) DownloadSnap(name string, opts DownloadOptions) (targe
 
 // AssertionFetcher creates an asserts.Fetcher for assertions against the given store using dlOpts for authorization, the fetcher will add assertions in the given database and after that also call save for each of them.
 func (tsto *ToolingStore) AssertionFetcher(db *asserts.Database, save func(asserts.Assertion) error) asserts.Fetcher {
-	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
-		return tsto.sto.Assertion(ref.Type, ref.PrimaryKey, tsto.user)
-	}
+	return newAssertionFetcher(db, tsto.retrieveAssertion, save)
+}
+
+func (tsto *ToolingStore) retrieveAssertion(ref *asserts.Ref) (asserts.Assertion, error) {
+	return tsto.sto.Assertion(ref.Type, ref.PrimaryKey, tsto.user)
+}
+
+func newAssertionFetcher(db *asserts.Database, retrieve func(*asserts.Ref) (asserts.Assertion, error), save func(asserts.Assertion) error) asserts.Fetcher {
 	save2 := func(a asserts.Assertion) error {
 		// for checking
 		err := db.Add(a)
@@ -404,3 +411,119 @@ func (tsto *ToolingStore) Find(at *asserts.AssertionType, headers map[string]str
 	}
 	return tsto.sto.Assertion(at, pk, tsto.user)
 }
+
+// validationSetRefs parses the given account-id/name=sequence
+// validation set references.
+func validationSetRefs(vsets []string) ([]*asserts.Ref, error) {
+	refs := make([]*asserts.Ref, 0, len(vsets))
+	for _, vset := range vsets {
+		parts := strings.Split(vset, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("cannot use validation set %q: expected account-id/name=sequence", vset)
+		}
+		seq, err := strconv.Atoi(parts[1])
+		if err != nil || seq <= 0 {
+			return nil, fmt.Errorf("cannot use validation set %q: invalid sequence %q", vset, parts[1])
+		}
+		accountAndName := strings.Split(parts[0], "/")
+		if len(accountAndName) != 2 {
+			return nil, fmt.Errorf("cannot use validation set %q: expected account-id/name=sequence", vset)
+		}
+		accountID, name := accountAndName[0], accountAndName[1]
+		if !asserts.IsValidAccountID(accountID) {
+			return nil, fmt.Errorf("cannot use validation set %q: invalid account ID %q", vset, accountID)
+		}
+		if !asserts.IsValidValidationSetName(name) {
+			return nil, fmt.Errorf("cannot use validation set %q: invalid name %q", vset, name)
+		}
+		refs = append(refs, &asserts.Ref{
+			Type:       asserts.ValidationSetType,
+			PrimaryKey: []string{release.Series, accountID, name, strconv.Itoa(seq)},
+		})
+	}
+	return refs, nil
+}
+
+// snapsDir is a directory of pre-fetched snaps and assertions.
+type snapsDir struct {
+	dir        string
+	assertions map[string]asserts.Assertion
+}
+
+// readSnapsDir reads the assertions from the *.assert files in the
+// given directory.
+func readSnapsDir(dir string) (*snapsDir, error) {
+	assertFiles, err := filepath.Glob(filepath.Join(dir, "*.assert"))
+	if err != nil {
+		return nil, err
+	}
+	sd := &snapsDir{
+		dir:        dir,
+		assertions: make(map[string]asserts.Assertion),
+	}
+	for _, fn := range assertFiles {
+		if err := sd.readAssertions(fn); err != nil {
+			return nil, err
+		}
+	}
+	return sd, nil
+}
+
+func (sd *snapsDir) readAssertions(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := asserts.NewDecoder(f)
+	for {
+		a, err := dec.Decode()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read assertions from %q: %v", fn, err)
+		}
+		u := a.Ref().Unique()
+		if prev := sd.assertions[u]; prev == nil || prev.Revision() < a.Revision() {
+			sd.assertions[u] = a
+		}
+	}
+}
+
+// retrieveAssertion returns a function that retrieves assertions from
+// the directory, falling back to the given retrieve function.
+func (sd *snapsDir) retrieveAssertion(fallback func(*asserts.Ref) (asserts.Assertion, error)) func(*asserts.Ref) (asserts.Assertion, error) {
+	return func(ref *asserts.Ref) (asserts.Assertion, error) {
+		if a := sd.assertions[ref.Unique()]; a != nil {
+			return a, nil
+		}
+		return fallback(ref)
+	}
+}
+
+// snapPath returns the path of the snap with the given name and
+// revision in the directory, or of its only revision there if rev is
+// unset. It returns "" if there is no such snap.
+func (sd *snapsDir) snapPath(name string, rev snap.Revision) (string, error) {
+	if !rev.Unset() {
+		fn := filepath.Join(sd.dir, fmt.Sprintf("%s_%s.snap", name, rev))
+		if !osutil.FileExists(fn) {
+			return "", nil
+		}
+		return fn, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(sd.dir, name+"_*.snap"))
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", nil
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("cannot choose between %d revisions of snap %q in %s", len(matches), name, sd.dir)
+	}
+}
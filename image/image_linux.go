@@ -123,6 +123,39 @@ func decodeModelAssertion(opts *Options) (*asserts.Model, error) {
 	return modela, nil
 }
 
+// fetchLocalSnap copies the pre-fetched snap at fn into the seed,
+// fetching and checking its assertions.
+func fetchLocalSnap(w *seedwriter.Writer, sn *seedwriter.SeedSnap, fn string, f seedwriter.RefAssertsFetcher, db asserts.RODatabase) error {
+	si, aRefs, err := seedwriter.DeriveSideInfo(fn, f, db)
+	if err != nil {
+		if asserts.IsNotFound(err) {
+			return fmt.Errorf("cannot find assertions for pre-fetched snap %q: %v", fn, err)
+		}
+		return err
+	}
+
+	snapFile, err := snapfile.Open(fn)
+	if err != nil {
+		return err
+	}
+	info, err := snap.ReadInfoFromSnapFile(snapFile, si)
+	if err != nil {
+		return err
+	}
+	if info.SnapName() != sn.SnapName() {
+		return fmt.Errorf("cannot use pre-fetched snap %q as snap %q", fn, sn.SnapName())
+	}
+
+	if err := w.SetInfo(sn, info); err != nil {
+		return err
+	}
+	if err := osutil.CopyFile(fn, sn.Path, 0); err != nil {
+		return err
+	}
+	sn.ARefs = aRefs
+	return nil
+}
+
 func unpackGadget(gadgetFname, gadgetUnpackDir string) error {
 	// FIXME: jumping through layers here, we need to make
 	//        unpack part of the container interface (again)
@@ -209,10 +242,26 @@ func setupSeed(tsto *ToolingStore, model *asserts.Model, opts *Options) error {
 		return err
 	}
 
+	vsets, err := validationSetRefs(opts.ValidationSets)
+	if err != nil {
+		return err
+	}
+
+	retrieve := tsto.retrieveAssertion
+	var localSnaps *snapsDir
+	if opts.SnapsDir != "" {
+		localSnaps, err = readSnapsDir(opts.SnapsDir)
+		if err != nil {
+			return err
+		}
+		retrieve = localSnaps.retrieveAssertion(retrieve)
+	}
+
 	wOpts := &seedwriter.Options{
 		SeedDir:        seedDir,
 		Label:          label,
 		DefaultChannel: opts.Channel,
+		ValidationSets: vsets,
 
 		TestSkipCopyUnverifiedModel: osutil.GetenvBool("UBUNTU_IMAGE_SKIP_COPY_UNVERIFIED_MODEL"),
 	}
@@ -249,19 +298,19 @@ func setupSeed(tsto *ToolingStore, model *asserts.Model, opts *Options) error {
 	}
 
 	newFetcher := func(save func(asserts.Assertion) error) asserts.Fetcher {
-		return tsto.AssertionFetcher(db, save)
+		return newAssertionFetcher(db, retrieve, save)
 	}
 	f, err := w.Start(db, newFetcher)
 	if err != nil {
 		return err
 	}
 
-	localSnaps, err := w.LocalSnaps()
+	optLocalSnaps, err := w.LocalSnaps()
 	if err != nil {
 		return err
 	}
 
-	for _, sn := range localSnaps {
+	for _, sn := range optLocalSnaps {
 		si, aRefs, err := seedwriter.DeriveSideInfo(sn.Path, f, db)
 		if err != nil && !asserts.IsNotFound(err) {
 			return err
@@ -293,6 +342,20 @@ func setupSeed(tsto *ToolingStore, model *asserts.Model, opts *Options) error {
 		}
 
 		for _, sn := range toDownload {
+			if localSnaps != nil {
+				fn, err := localSnaps.snapPath(sn.SnapName(), sn.Revision)
+				if err != nil {
+					return err
+				}
+				if fn != "" {
+					fmt.Fprintf(Stdout, "Fetching %s from %s\n", sn.SnapName(), opts.SnapsDir)
+					if err := fetchLocalSnap(w, sn, fn, f, db); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+
 			fmt.Fprintf(Stdout, "Fetching %s\n", sn.SnapName())
 
 			targetPathFunc := func(info *snap.Info) (string, error) {
@@ -304,8 +367,13 @@ func setupSeed(tsto *ToolingStore, model *asserts.Model, opts *Options) error {
 
 			dlOpts := DownloadOptions{
 				TargetPathFunc: targetPathFunc,
+				Revision:       sn.Revision,
 				Channel:        sn.Channel,
-				CohortKey:      opts.WideCohortKey,
+			}
+			if sn.Revision.Unset() {
+				// the cohort cannot be combined with the revision
+				// required by the validation sets
+				dlOpts.CohortKey = opts.WideCohortKey
 			}
 			fn, info, redirectChannel, err := tsto.DownloadSnap(sn.SnapName(), dlOpts) // TODO|XXX make this take the SnapRef really
 			if err != nil {
@@ -1275,6 +1275,206 @@ func (s *imageSuite) TestSetupSeedKernelPublisherMismatch(c *C) {
 	c.Assert(err, ErrorMatches, `cannot use kernel "pc-kernel" published by "other" for model by "my-brand"`)
 }
 
+func (s *imageSuite) makeValidationSet(c *C, name, sequence string, snaps ...interface{}) asserts.Assertion {
+	vset, err := s.Brands.Signing("my-brand").Sign(asserts.ValidationSetType, map[string]interface{}{
+		"authority-id": "my-brand",
+		"series":       "16",
+		"account-id":   "my-brand",
+		"name":         name,
+		"sequence":     sequence,
+		"snaps":        snaps,
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	return vset
+}
+
+func (s *imageSuite) TestSetupSeedValidationSets(c *C) {
+	restore := image.MockTrusted(s.StoreSigning.Trusted)
+	defer restore()
+
+	rootdir := filepath.Join(c.MkDir(), "image")
+	s.setupSnaps(c, map[string]string{
+		"pc":        "canonical",
+		"pc-kernel": "canonical",
+	}, "")
+	vset := s.makeValidationSet(c, "my-set", "2",
+		map[string]interface{}{
+			"name":     "pc-kernel",
+			"id":       s.AssertedSnapID("pc-kernel"),
+			"presence": "required",
+			"revision": "2",
+		},
+		map[string]interface{}{
+			"name":     "required-snap1",
+			"id":       s.AssertedSnapID("required-snap1"),
+			"presence": "required",
+			"revision": "3",
+		},
+	)
+	c.Assert(s.StoreSigning.Add(vset), IsNil)
+
+	opts := &image.Options{
+		PrepareDir:     filepath.Dir(rootdir),
+		ValidationSets: []string{"my-brand/my-set=2"},
+		WideCohortKey:  "wide-cohort-key",
+	}
+
+	err := image.SetupSeed(s.tsto, s.model, opts)
+	c.Assert(err, IsNil)
+
+	// the required revisions were downloaded, outside of the cohort
+	c.Assert(s.storeActions, HasLen, 4)
+	c.Check(s.storeActions[1], DeepEquals, &store.SnapAction{
+		Action:       "download",
+		InstanceName: "pc-kernel",
+		Revision:     snap.R(2),
+	})
+	c.Check(s.storeActions[2], DeepEquals, &store.SnapAction{
+		Action:       "download",
+		InstanceName: "pc",
+		Channel:      stableChannel,
+		CohortKey:    "wide-cohort-key",
+	})
+	c.Check(s.storeActions[3], DeepEquals, &store.SnapAction{
+		Action:       "download",
+		InstanceName: "required-snap1",
+		Revision:     snap.R(3),
+	})
+
+	// the validation set is part of the seed
+	seeddir := filepath.Join(rootdir, "var/lib/snapd/seed")
+	_, _, roDB := s.loadSeed(c, seeddir)
+	_, err = vset.Ref().Resolve(roDB.Find)
+	c.Check(err, IsNil)
+}
+
+func (s *imageSuite) TestSetupSeedValidationSetsNotMet(c *C) {
+	restore := image.MockTrusted(s.StoreSigning.Trusted)
+	defer restore()
+
+	rootdir := filepath.Join(c.MkDir(), "image")
+	s.setupSnaps(c, map[string]string{
+		"pc":        "canonical",
+		"pc-kernel": "canonical",
+	}, "")
+	vset := s.makeValidationSet(c, "my-set", "1",
+		map[string]interface{}{
+			"name":     "required-snap1",
+			"id":       s.AssertedSnapID("required-snap1"),
+			"presence": "required",
+			"revision": "4",
+		},
+	)
+	c.Assert(s.StoreSigning.Add(vset), IsNil)
+
+	opts := &image.Options{
+		PrepareDir:     filepath.Dir(rootdir),
+		ValidationSets: []string{"my-brand/my-set=1"},
+	}
+
+	// the fake store serves revision 3 regardless
+	err := image.SetupSeed(s.tsto, s.model, opts)
+	c.Assert(err, ErrorMatches, `(?s)cannot seed snaps: validation sets assertions are not met:.*required-snap1 \(required at revision 4 by sets my-brand/my-set\)`)
+}
+
+func (s *imageSuite) TestSetupSeedValidationSetsInvalidRefs(c *C) {
+	opts := &image.Options{
+		PrepareDir: c.MkDir(),
+	}
+	for _, t := range []struct {
+		vset, err string
+	}{
+		{"my-brand/my-set", `cannot use validation set "my-brand/my-set": expected account-id/name=sequence`},
+		{"my-brand=1", `cannot use validation set "my-brand=1": expected account-id/name=sequence`},
+		{"my-brand/my-set=0", `cannot use validation set "my-brand/my-set=0": invalid sequence "0"`},
+		{"my-brand/my-set=x", `cannot use validation set "my-brand/my-set=x": invalid sequence "x"`},
+		{"my brand/my-set=1", `cannot use validation set "my brand/my-set=1": invalid account ID "my brand"`},
+		{"my-brand/My_Set=1", `cannot use validation set "my-brand/My_Set=1": invalid name "My_Set"`},
+	} {
+		opts.ValidationSets = []string{t.vset}
+		err := image.SetupSeed(s.tsto, s.model, opts)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+func (s *imageSuite) TestSetupSeedSnapsDir(c *C) {
+	restore := image.MockTrusted(s.StoreSigning.Trusted)
+	defer restore()
+
+	rootdir := filepath.Join(c.MkDir(), "image")
+	s.setupSnaps(c, map[string]string{
+		"pc":        "canonical",
+		"pc-kernel": "canonical",
+	}, "")
+
+	// the validation set is only available locally
+	vset := s.makeValidationSet(c, "my-set", "1",
+		map[string]interface{}{
+			"name":     "pc-kernel",
+			"id":       s.AssertedSnapID("pc-kernel"),
+			"presence": "required",
+			"revision": "2",
+		},
+	)
+	snapsDir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(snapsDir, "my-set.assert"), asserts.Encode(vset), 0644)
+	c.Assert(err, IsNil)
+	err = osutil.CopyFile(s.AssertedSnap("pc-kernel"), filepath.Join(snapsDir, "pc-kernel_2.snap"), 0)
+	c.Assert(err, IsNil)
+	err = osutil.CopyFile(s.AssertedSnap("pc"), filepath.Join(snapsDir, "pc_1.snap"), 0)
+	c.Assert(err, IsNil)
+
+	opts := &image.Options{
+		PrepareDir:     filepath.Dir(rootdir),
+		ValidationSets: []string{"my-brand/my-set=1"},
+		SnapsDir:       snapsDir,
+	}
+
+	err = image.SetupSeed(s.tsto, s.model, opts)
+	c.Assert(err, IsNil)
+
+	c.Check(s.stdout.String(), testutil.Contains, fmt.Sprintf("Fetching pc-kernel from %s\n", snapsDir))
+	c.Check(s.stdout.String(), testutil.Contains, fmt.Sprintf("Fetching pc from %s\n", snapsDir))
+
+	// only the snaps missing locally were downloaded
+	c.Assert(s.storeActions, HasLen, 2)
+	c.Check(s.storeActions[0].InstanceName, Equals, "core")
+	c.Check(s.storeActions[1].InstanceName, Equals, "required-snap1")
+
+	seeddir := filepath.Join(rootdir, "var/lib/snapd/seed")
+	essSnaps, _, _ := s.loadSeed(c, seeddir)
+	c.Assert(essSnaps, HasLen, 3)
+	c.Check(essSnaps[1].SideInfo, DeepEquals, &s.AssertedSnapInfo("pc-kernel").SideInfo)
+	c.Check(essSnaps[1].Path, testutil.FilePresent)
+	c.Check(essSnaps[2].SideInfo, DeepEquals, &s.AssertedSnapInfo("pc").SideInfo)
+}
+
+func (s *imageSuite) TestSetupSeedSnapsDirAmbiguous(c *C) {
+	restore := image.MockTrusted(s.StoreSigning.Trusted)
+	defer restore()
+
+	rootdir := filepath.Join(c.MkDir(), "image")
+	s.setupSnaps(c, map[string]string{
+		"pc":        "canonical",
+		"pc-kernel": "canonical",
+	}, "")
+
+	snapsDir := c.MkDir()
+	for _, fn := range []string{"pc-kernel_1.snap", "pc-kernel_2.snap"} {
+		err := osutil.CopyFile(s.AssertedSnap("pc-kernel"), filepath.Join(snapsDir, fn), 0)
+		c.Assert(err, IsNil)
+	}
+
+	opts := &image.Options{
+		PrepareDir: filepath.Dir(rootdir),
+		SnapsDir:   snapsDir,
+	}
+
+	err := image.SetupSeed(s.tsto, s.model, opts)
+	c.Assert(err, ErrorMatches, `cannot choose between 2 revisions of snap "pc-kernel" in .*`)
+}
+
 func (s *imageSuite) TestInstallCloudConfigNoConfig(c *C) {
 	targetDir := c.MkDir()
 	emptyGadgetDir := c.MkDir()
@@ -36,6 +36,16 @@ type Options struct {
 
 	PrepareDir string
 
+	// ValidationSets are validation sets, given as
+	// account-id/name=sequence, that the seeded snaps must satisfy.
+	// They also fix the revisions of the snaps to fetch.
+	ValidationSets []string
+
+	// SnapsDir is an optional directory of pre-fetched snaps
+	// (named <snap>_<revision>.snap) and assertions (in *.assert
+	// files) to use in preference to the store.
+	SnapsDir string
+
 	// Architecture to use if none is specified by the model,
 	// useful only for classic mode. If set must match the model otherwise.
 	Architecture string
@@ -19,6 +19,8 @@
 
 package logger
 
+import "time"
+
 func GetLogger() Logger {
 	lock.Lock()
 	defer lock.Unlock()
@@ -42,3 +44,11 @@ func ProcCmdlineMustMock(new bool) (restore func()) {
 		procCmdlineUseDefaultMockInTests = old
 	}
 }
+
+func MockTimeNow(f func() time.Time) (restore func()) {
+	old := timeNow
+	timeNow = f
+	return func() {
+		timeNow = old
+	}
+}
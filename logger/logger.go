@@ -21,11 +21,13 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/snapcore/snapd/osutil"
 )
@@ -38,11 +40,45 @@ type Logger interface {
 	Debug(msg string)
 }
 
+// A StructuredLogger is a Logger that can output fields describing the
+// context of messages along with them.
+type StructuredLogger interface {
+	Logger
+	// NoticeFields is like Notice, with fields attached
+	NoticeFields(msg string, fields map[string]string)
+	// DebugFields is like Debug, with fields attached
+	DebugFields(msg string, fields map[string]string)
+}
+
 const (
 	// DefaultFlags are passed to the default console log.Logger
 	DefaultFlags = log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile
 )
 
+// Level is the level of the messages output by loggers.
+type Level int
+
+const (
+	// LevelNotice outputs notices, debug messages are only output when
+	// enabled with SNAPD_DEBUG or on the kernel command line.
+	LevelNotice Level = iota
+	// LevelDebug outputs debug messages too.
+	LevelDebug
+)
+
+// ParseLevel parses a log level name, the empty string being the default
+// level.
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "", "notice":
+		return LevelNotice, nil
+	case "debug":
+		return LevelDebug, nil
+	default:
+		return LevelNotice, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
 type nullLogger struct{}
 
 func (nullLogger) Notice(string) {}
@@ -53,6 +89,7 @@ var NullLogger = nullLogger{}
 
 var (
 	logger Logger = NullLogger
+	level         = LevelNotice
 	lock   sync.Mutex
 )
 
@@ -119,15 +156,79 @@ func SetLogger(l Logger) {
 	logger = l
 }
 
+// SetLevel sets the level of the messages output by the global logger.
+func SetLevel(l Level) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	level = l
+}
+
+// A ContextLogger logs messages with fields describing their context, like
+// the change and task they relate to, attached. The fields are only output
+// by structured loggers.
+type ContextLogger struct {
+	fields map[string]string
+}
+
+// WithFields returns a ContextLogger attaching the given fields to messages.
+func WithFields(fields map[string]string) *ContextLogger {
+	cl := &ContextLogger{fields: make(map[string]string, len(fields))}
+	for k, v := range fields {
+		cl.fields[k] = v
+	}
+	return cl
+}
+
+// With returns a ContextLogger attaching the given field to messages, on top
+// of the ones of this logger.
+func (cl *ContextLogger) With(key, value string) *ContextLogger {
+	ncl := WithFields(cl.fields)
+	ncl.fields[key] = value
+	return ncl
+}
+
+// Noticef notifies the user of something
+func (cl *ContextLogger) Noticef(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if sl, ok := logger.(StructuredLogger); ok {
+		sl.NoticeFields(msg, cl.fields)
+	} else {
+		logger.Notice(msg)
+	}
+}
+
+// Debugf records something in the debug log
+func (cl *ContextLogger) Debugf(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if sl, ok := logger.(StructuredLogger); ok {
+		sl.DebugFields(msg, cl.fields)
+	} else {
+		logger.Debug(msg)
+	}
+}
+
 type Log struct {
 	log *log.Logger
 
 	debug bool
 }
 
+func debugEnabled(debug bool) bool {
+	return debug || level >= LevelDebug || osutil.GetenvBool("SNAPD_DEBUG")
+}
+
 // Debug only prints if SNAPD_DEBUG is set
 func (l *Log) Debug(msg string) {
-	if l.debug || osutil.GetenvBool("SNAPD_DEBUG") {
+	if debugEnabled(l.debug) {
 		l.log.Output(3, "DEBUG: "+msg)
 	}
 }
@@ -146,8 +247,72 @@ func New(w io.Writer, flag int) (Logger, error) {
 	return logger, nil
 }
 
-// SimpleSetup creates the default (console) logger
+var timeNow = time.Now
+
+// JSONLog is a StructuredLogger writing messages as JSON objects, one per
+// line.
+type JSONLog struct {
+	w io.Writer
+
+	debug bool
+}
+
+func (l *JSONLog) write(lvl, msg string, fields map[string]string) {
+	entry := make(map[string]string, len(fields)+3)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["time"] = timeNow().UTC().Format(time.RFC3339Nano)
+	entry["level"] = lvl
+	entry["msg"] = msg
+	// cannot fail with a map of strings
+	b, _ := json.Marshal(entry)
+	l.w.Write(append(b, '\n'))
+}
+
+// Debug only prints if SNAPD_DEBUG is set
+func (l *JSONLog) Debug(msg string) {
+	l.DebugFields(msg, nil)
+}
+
+// Notice alerts the user about something
+func (l *JSONLog) Notice(msg string) {
+	l.NoticeFields(msg, nil)
+}
+
+// DebugFields is like Debug, with fields attached
+func (l *JSONLog) DebugFields(msg string, fields map[string]string) {
+	if debugEnabled(l.debug) {
+		l.write("debug", msg, fields)
+	}
+}
+
+// NoticeFields is like Notice, with fields attached
+func (l *JSONLog) NoticeFields(msg string, fields map[string]string) {
+	l.write("notice", msg, fields)
+}
+
+// NewJSON creates a StructuredLogger writing JSON objects to the given
+// io.Writer.
+func NewJSON(w io.Writer) (Logger, error) {
+	logger := &JSONLog{
+		w:     w,
+		debug: debugEnabledOnKernelCmdline(),
+	}
+	return logger, nil
+}
+
+// SimpleSetup creates the default (console) logger, which writes JSON
+// objects if SNAPD_LOG_FORMAT is set to json
 func SimpleSetup() error {
+	if os.Getenv("SNAPD_LOG_FORMAT") == "json" {
+		l, err := NewJSON(os.Stderr)
+		if err == nil {
+			SetLogger(l)
+		}
+		return err
+	}
+
 	flags := log.Lshortfile
 	if term := os.Getenv("TERM"); term != "" {
 		// snapd is probably not running under systemd
@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 
@@ -146,3 +147,84 @@ func (s *LogSuite) TestIntegrationDebugFromKernelCmdline(c *C) {
 	l.Debug("xyzzy")
 	c.Check(buf.String(), testutil.Contains, `DEBUG: xyzzy`)
 }
+
+func (s *LogSuite) TestSetLevel(c *C) {
+	defer logger.SetLevel(logger.LevelNotice)
+
+	logger.Debugf("xyzzy")
+	c.Check(s.logbuf.String(), Equals, "")
+
+	logger.SetLevel(logger.LevelDebug)
+	logger.Debugf("xyzzy")
+	c.Check(s.logbuf.String(), Matches, `(?m).*logger_test\.go:\d+: DEBUG: xyzzy`)
+
+	s.logbuf.Reset()
+	logger.SetLevel(logger.LevelNotice)
+	logger.Debugf("xyzzy")
+	c.Check(s.logbuf.String(), Equals, "")
+}
+
+func (s *LogSuite) TestParseLevel(c *C) {
+	for _, tc := range []struct {
+		in    string
+		level logger.Level
+		err   string
+	}{
+		{"", logger.LevelNotice, ""},
+		{"notice", logger.LevelNotice, ""},
+		{"debug", logger.LevelDebug, ""},
+		{"verbose", logger.LevelNotice, `unknown log level "verbose"`},
+	} {
+		level, err := logger.ParseLevel(tc.in)
+		if tc.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, tc.err)
+		}
+		c.Check(level, Equals, tc.level, Commentf("%q", tc.in))
+	}
+}
+
+func (s *LogSuite) TestContextLoggerText(c *C) {
+	cl := logger.WithFields(map[string]string{"change-id": "1"}).With("snap", "foo")
+	cl.Noticef("xyzzy %d", 42)
+	// fields are only output by structured loggers
+	c.Check(s.logbuf.String(), Matches, `(?m).*logger_test\.go:\d+: xyzzy 42\n`)
+}
+
+func (s *LogSuite) TestJSON(c *C) {
+	restore := logger.MockTimeNow(func() time.Time {
+		return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	})
+	defer restore()
+
+	var buf bytes.Buffer
+	l, err := logger.NewJSON(&buf)
+	c.Assert(err, IsNil)
+	logger.SetLogger(l)
+
+	logger.Noticef("xyzzy")
+	logger.Debugf("not output")
+
+	base := logger.WithFields(map[string]string{"change-id": "1", "task-id": "2"})
+	cl := base.With("snap", "foo")
+	cl.Noticef("hello %s", "world")
+	cl.Debugf("not output either")
+	logger.SetLevel(logger.LevelDebug)
+	defer logger.SetLevel(logger.LevelNotice)
+	base.Debugf("plugh")
+
+	c.Check(buf.String(), Equals, `{"level":"notice","msg":"xyzzy","time":"2021-03-04T05:06:07Z"}
+{"change-id":"1","level":"notice","msg":"hello world","snap":"foo","task-id":"2","time":"2021-03-04T05:06:07Z"}
+{"change-id":"1","level":"debug","msg":"plugh","task-id":"2","time":"2021-03-04T05:06:07Z"}
+`)
+}
+
+func (s *LogSuite) TestSimpleSetupJSON(c *C) {
+	os.Setenv("SNAPD_LOG_FORMAT", "json")
+	defer os.Unsetenv("SNAPD_LOG_FORMAT")
+
+	err := logger.SimpleSetup()
+	c.Assert(err, IsNil)
+	c.Check(logger.GetLogger(), FitsTypeOf, &logger.JSONLog{})
+}
@@ -0,0 +1,102 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/metrics"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type metricsSuite struct {
+	testutil.BaseTest
+}
+
+var _ = Suite(&metricsSuite{})
+
+func (s *metricsSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.AddCleanup(metrics.MockRegistry())
+}
+
+func (s *metricsSuite) TestEmpty(c *C) {
+	var buf bytes.Buffer
+	c.Assert(metrics.WriteTo(&buf), IsNil)
+	c.Check(buf.String(), Equals, "# EOF\n")
+}
+
+func (s *metricsSuite) TestCounter(c *C) {
+	cnt := metrics.NewCounter("snapd_things", "Things that happened.", "kind", "outcome")
+	cnt.Inc("foo", "Done")
+	cnt.Inc("foo", "Done")
+	cnt.Add(2.5, "bar", `Err"or`)
+	plain := metrics.NewCounter("snapd_bytes", "Bytes.\nAll of them.")
+	plain.Add(1024)
+
+	var buf bytes.Buffer
+	c.Assert(metrics.WriteTo(&buf), IsNil)
+	c.Check(buf.String(), Equals, `# TYPE snapd_bytes counter
+# HELP snapd_bytes Bytes.\nAll of them.
+snapd_bytes_total 1024
+# TYPE snapd_things counter
+# HELP snapd_things Things that happened.
+snapd_things_total{kind="bar",outcome="Err\"or"} 2.5
+snapd_things_total{kind="foo",outcome="Done"} 2
+# EOF
+`)
+}
+
+func (s *metricsSuite) TestCounterMisuse(c *C) {
+	cnt := metrics.NewCounter("snapd_things", "Things.", "kind")
+	c.Check(func() { cnt.Inc() }, PanicMatches, `internal error: metric "snapd_things" expects 1 label values, got 0`)
+	c.Check(func() { cnt.Add(-1, "foo") }, PanicMatches, `internal error: cannot decrease counter "snapd_things"`)
+	c.Check(func() { metrics.NewCounter("snapd_things", "Again.") }, PanicMatches, `internal error: metric "snapd_things" registered twice`)
+}
+
+func (s *metricsSuite) TestHistogram(c *C) {
+	h := metrics.NewHistogram("snapd_duration_seconds", "Durations.", []float64{0.1, 1}, "kind")
+	h.ObserveDuration(50*time.Millisecond, "foo")
+	h.Observe(0.5, "foo")
+	h.Observe(2, "foo")
+
+	var buf bytes.Buffer
+	c.Assert(metrics.WriteTo(&buf), IsNil)
+	c.Check(buf.String(), Equals, `# TYPE snapd_duration_seconds histogram
+# HELP snapd_duration_seconds Durations.
+snapd_duration_seconds_bucket{kind="foo",le="0.1"} 1
+snapd_duration_seconds_bucket{kind="foo",le="1"} 2
+snapd_duration_seconds_bucket{kind="foo",le="+Inf"} 3
+snapd_duration_seconds_sum{kind="foo"} 2.55
+snapd_duration_seconds_count{kind="foo"} 3
+# EOF
+`)
+}
+
+func (s *metricsSuite) TestHistogramUnsortedBuckets(c *C) {
+	c.Check(func() { metrics.NewHistogram("snapd_foo", "Foo.", []float64{1, 0.1}) }, PanicMatches,
+		`internal error: buckets of histogram "snapd_foo" are not sorted`)
+}
@@ -0,0 +1,108 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package squashfs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// kernelConfigOptions maps the squashfs compressions to the kernel
+// configuration option needed to mount them.
+var kernelConfigOptions = map[string]string{
+	"gzip": "CONFIG_SQUASHFS_ZLIB",
+	"lzo":  "CONFIG_SQUASHFS_LZO",
+	"xz":   "CONFIG_SQUASHFS_XZ",
+	"lz4":  "CONFIG_SQUASHFS_LZ4",
+	"zstd": "CONFIG_SQUASHFS_ZSTD",
+}
+
+// kernelConfig returns the configuration of the running kernel, or
+// nil if it cannot be found.
+func kernelConfig() (io.ReadCloser, error) {
+	bootConfig := filepath.Join(dirs.GlobalRootDir, "/boot", "config-"+osutil.KernelVersion())
+	f, err := os.Open(bootConfig)
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err = os.Open(filepath.Join(dirs.GlobalRootDir, "/proc/config.gz"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// CheckCompressionSupported returns an error if the running kernel is
+// known not to be able to mount squashfs filesystems using the given
+// compression. When the configuration of the kernel cannot be found,
+// or fuse is used to mount snaps, no error is returned.
+func CheckCompressionSupported(compression string) error {
+	if NeedsFuse() {
+		return nil
+	}
+	option, ok := kernelConfigOptions[compression]
+	if !ok {
+		return fmt.Errorf("unknown squashfs compression %q", compression)
+	}
+
+	config, err := kernelConfig()
+	if err != nil {
+		return fmt.Errorf("cannot read kernel configuration: %v", err)
+	}
+	if config == nil {
+		return nil
+	}
+	defer config.Close()
+
+	scanner := bufio.NewScanner(config)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == option+"=y" {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("cannot read kernel configuration: %v", err)
+	}
+	return fmt.Errorf("%s compressed squashfs filesystems are not supported by the running kernel (%s is not set)", compression, option)
+}
@@ -0,0 +1,117 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package squashfs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/squashfs"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type compressionSuite struct{}
+
+var _ = Suite(&compressionSuite{})
+
+const mockKernelConfig = `# comment
+CONFIG_SQUASHFS=y
+CONFIG_SQUASHFS_ZLIB=y
+CONFIG_SQUASHFS_LZ4=y
+CONFIG_SQUASHFS_LZO=y
+CONFIG_SQUASHFS_XZ=y
+# CONFIG_SQUASHFS_ZSTD is not set
+`
+
+func (s *compressionSuite) SetUpTest(c *C) {
+	dirs.SetRootDir(c.MkDir())
+}
+
+func (s *compressionSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("")
+}
+
+func (s *compressionSuite) checkSupport(c *C) {
+	for _, comp := range []string{"gzip", "lz4", "lzo", "xz"} {
+		c.Check(squashfs.CheckCompressionSupported(comp), IsNil, Commentf(comp))
+	}
+	err := squashfs.CheckCompressionSupported("zstd")
+	c.Check(err, ErrorMatches, `zstd compressed squashfs filesystems are not supported by the running kernel \(CONFIG_SQUASHFS_ZSTD is not set\)`)
+}
+
+func (s *compressionSuite) TestCheckCompressionSupportedBootConfig(c *C) {
+	defer squashfs.MockNeedsFuse(false)()
+	defer osutil.MockKernelVersion("5.4.0-42-generic")()
+
+	p := filepath.Join(dirs.GlobalRootDir, "/boot/config-5.4.0-42-generic")
+	c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(p, []byte(mockKernelConfig), 0644), IsNil)
+
+	s.checkSupport(c)
+}
+
+func (s *compressionSuite) TestCheckCompressionSupportedProcConfig(c *C) {
+	defer squashfs.MockNeedsFuse(false)()
+	defer osutil.MockKernelVersion("5.4.0-42-generic")()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(mockKernelConfig))
+	c.Assert(err, IsNil)
+	c.Assert(gz.Close(), IsNil)
+
+	p := filepath.Join(dirs.GlobalRootDir, "/proc/config.gz")
+	c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(p, buf.Bytes(), 0644), IsNil)
+
+	s.checkSupport(c)
+}
+
+func (s *compressionSuite) TestCheckCompressionSupportedNoConfig(c *C) {
+	defer squashfs.MockNeedsFuse(false)()
+
+	c.Check(squashfs.CheckCompressionSupported("zstd"), IsNil)
+}
+
+func (s *compressionSuite) TestCheckCompressionSupportedFuse(c *C) {
+	defer squashfs.MockNeedsFuse(true)()
+	defer osutil.MockKernelVersion("5.4.0-42-generic")()
+
+	p := filepath.Join(dirs.GlobalRootDir, "/boot/config-5.4.0-42-generic")
+	c.Assert(os.MkdirAll(filepath.Dir(p), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(p, []byte(mockKernelConfig), 0644), IsNil)
+
+	c.Check(squashfs.CheckCompressionSupported("zstd"), IsNil)
+}
+
+func (s *compressionSuite) TestCheckCompressionSupportedUnknown(c *C) {
+	defer squashfs.MockNeedsFuse(false)()
+
+	c.Check(squashfs.CheckCompressionSupported("silly"), ErrorMatches, `unknown squashfs compression "silly"`)
+}
@@ -24,6 +24,7 @@ package assertstate
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/snapcore/snapd/asserts"
@@ -257,6 +258,19 @@ func SnapDeclaration(s *state.State, snapID string) (*asserts.SnapDeclaration, e
 	return a.(*asserts.SnapDeclaration), nil
 }
 
+// SnapRevision returns the snap-revision assertion for the given snap-id and revision if it is present in the system assertion database.
+func SnapRevision(s *state.State, snapID string, revision snap.Revision) (*asserts.SnapRevision, error) {
+	db := DB(s)
+	as, err := db.FindMany(asserts.SnapRevisionType, map[string]string{
+		"snap-id":       snapID,
+		"snap-revision": revision.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return as[0].(*asserts.SnapRevision), nil
+}
+
 // Publisher returns the account assertion for publisher of the given snap-id if it is present in the system assertion database.
 func Publisher(s *state.State, snapID string) (*asserts.Account, error) {
 	db := DB(s)
@@ -330,9 +344,136 @@ func delayedCrossMgrInit() {
 	snapstate.AutoRefreshAssertions = AutoRefreshAssertions
 	// hook retrieving auto-aliases into snapstate logic
 	snapstate.AutoAliases = AutoAliases
+	// hook the enforced validation sets into snapstate logic
+	snapstate.EnforcedValidationSets = EnforcedValidationSets
+	// hook retrieving snap-revision assertions into snapstate logic
+	snapstate.SnapRevisionAssertion = SnapRevision
 }
 
 // AutoRefreshAssertions tries to refresh all assertions
 func AutoRefreshAssertions(s *state.State, userID int) error {
 	return RefreshSnapDeclarations(s, userID)
 }
+
+// ValidationSetAssertion returns the validation set assertion with the given
+// account ID, name and sequence from the system assertion database. If
+// sequence is 0 the latest known sequence is returned.
+func ValidationSetAssertion(s *state.State, accountID, name string, sequence int) (*asserts.ValidationSet, error) {
+	db := cachedDB(s)
+	headers := map[string]string{
+		"series":     release.Series,
+		"account-id": accountID,
+		"name":       name,
+	}
+	if sequence > 0 {
+		headers["sequence"] = strconv.Itoa(sequence)
+		a, err := db.Find(asserts.ValidationSetType, headers)
+		if err != nil {
+			return nil, err
+		}
+		return a.(*asserts.ValidationSet), nil
+	}
+	a, err := db.FindSequence(asserts.ValidationSetType, headers, -1, -1)
+	if err != nil {
+		return nil, err
+	}
+	return a.(*asserts.ValidationSet), nil
+}
+
+// EnforcedValidationSets returns the validation sets tracked in enforce mode.
+func EnforcedValidationSets(s *state.State) (*snapasserts.ValidationSets, error) {
+	valsets, err := ValidationSets(s)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := snapasserts.NewValidationSets()
+	for _, tr := range valsets {
+		if tr.Mode != Enforce {
+			continue
+		}
+		vs, err := ValidationSetAssertion(s, tr.AccountID, tr.Name, tr.Sequence())
+		if err != nil {
+			return nil, fmt.Errorf("cannot find validation set %s: %v", ValidationSetKey(tr.AccountID, tr.Name), err)
+		}
+		if err := sets.Add(vs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sets.Conflict(); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
+
+// EnforceValidationSet tries to track the given validation set in enforce
+// mode. The assertion is fetched from the store if it is pinned at the given
+// sequence and not available locally. It fails if the validation set
+// conflicts with the ones already enforced or if the installed snaps do not
+// satisfy the validation sets.
+func EnforceValidationSet(s *state.State, accountID, name string, sequence, userID int) (*ValidationSetTracking, error) {
+	vs, err := ValidationSetAssertion(s, accountID, name, sequence)
+	if asserts.IsNotFound(err) && sequence > 0 {
+		var deviceCtx snapstate.DeviceContext
+		deviceCtx, err = snapstate.DevicePastSeeding(s, nil)
+		if err != nil {
+			return nil, err
+		}
+		err = doFetch(s, userID, deviceCtx, func(f asserts.Fetcher) error {
+			return f.Fetch(&asserts.Ref{
+				Type:       asserts.ValidationSetType,
+				PrimaryKey: []string{release.Series, accountID, name, strconv.Itoa(sequence)},
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		vs, err = ValidationSetAssertion(s, accountID, name, sequence)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot find validation set %s: %v", ValidationSetKey(accountID, name), err)
+	}
+
+	valsets, err := ValidationSets(s)
+	if err != nil {
+		return nil, err
+	}
+	sets := snapasserts.NewValidationSets()
+	if err := sets.Add(vs); err != nil {
+		return nil, err
+	}
+	for key, tr := range valsets {
+		if tr.Mode != Enforce || key == ValidationSetKey(accountID, name) {
+			continue
+		}
+		other, err := ValidationSetAssertion(s, tr.AccountID, tr.Name, tr.Sequence())
+		if err != nil {
+			return nil, fmt.Errorf("cannot find validation set %s: %v", key, err)
+		}
+		if err := sets.Add(other); err != nil {
+			return nil, err
+		}
+	}
+	if err := sets.Conflict(); err != nil {
+		return nil, err
+	}
+
+	snaps, err := snapstate.InstalledSnaps(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := sets.CheckInstalledSnaps(snaps); err != nil {
+		return nil, err
+	}
+
+	tr := &ValidationSetTracking{
+		AccountID: accountID,
+		Name:      name,
+		Mode:      Enforce,
+		PinnedAt:  sequence,
+		Current:   vs.Sequence(),
+	}
+	UpdateValidationSet(s, tr)
+	return tr, nil
+}
@@ -38,6 +38,7 @@ import (
 
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/snapasserts"
 	"github.com/snapcore/snapd/asserts/sysdb"
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/httputil"
@@ -49,6 +50,7 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate/snapstatetest"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/store/storetest"
@@ -67,6 +69,7 @@ type assertMgrSuite struct {
 
 	storeSigning *assertstest.StoreStack
 	dev1Acct     *asserts.Account
+	dev1AcctKey  *asserts.AccountKey
 	dev1Signing  *assertstest.SigningDB
 
 	fakeStore        snapstate.StoreService
@@ -210,8 +213,8 @@ func (s *assertMgrSuite) SetUpTest(c *C) {
 	c.Assert(err, IsNil)
 
 	// developer signing
-	dev1AcctKey := assertstest.NewAccountKey(s.storeSigning, s.dev1Acct, nil, dev1PrivKey.PublicKey(), "")
-	err = s.storeSigning.Add(dev1AcctKey)
+	s.dev1AcctKey = assertstest.NewAccountKey(s.storeSigning, s.dev1Acct, nil, dev1PrivKey.PublicKey(), "")
+	err = s.storeSigning.Add(s.dev1AcctKey)
 	c.Assert(err, IsNil)
 
 	s.dev1Signing = assertstest.NewSigningDB(s.dev1Acct.AccountID(), dev1PrivKey)
@@ -1901,6 +1904,26 @@ func (s *assertMgrSuite) TestSnapDeclaration(c *C) {
 	c.Check(snapDecl.SnapName(), Equals, "foo")
 }
 
+func (s *assertMgrSuite) TestSnapRevision(c *C) {
+	s.prereqSnapAssertions(c, 10, 11)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	err := assertstate.DoFetch(s.state, 0, s.trivialDeviceCtx, func(f asserts.Fetcher) error {
+		return f.Fetch(&asserts.Ref{Type: asserts.SnapRevisionType, PrimaryKey: []string{makeDigest(10)}})
+	})
+	c.Assert(err, IsNil)
+
+	_, err = assertstate.SnapRevision(s.state, "snap-id-1", snap.R(11))
+	c.Check(asserts.IsNotFound(err), Equals, true)
+
+	snapRev, err := assertstate.SnapRevision(s.state, "snap-id-1", snap.R(10))
+	c.Assert(err, IsNil)
+	c.Check(snapRev.SnapRevision(), Equals, 10)
+	c.Check(snapRev.SnapSHA3_384(), Equals, makeDigest(10))
+}
+
 func (s *assertMgrSuite) TestAutoAliasesTemporaryFallback(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -2076,3 +2099,136 @@ func (s *assertMgrSuite) TestStore(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(store.Store(), Equals, "foo")
 }
+
+func (s *assertMgrSuite) validationSetAssert(c *C, name, sequence, revision string) *asserts.ValidationSet {
+	headers := map[string]interface{}{
+		"series":       "16",
+		"authority-id": s.dev1Acct.AccountID(),
+		"account-id":   s.dev1Acct.AccountID(),
+		"name":         name,
+		"sequence":     sequence,
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":     "foo",
+				"id":       "qOqKhntON3vR7kwEbVPsILm7bUViPDzz",
+				"presence": "required",
+				"revision": revision,
+			},
+		},
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	a, err := s.dev1Signing.Sign(asserts.ValidationSetType, headers, nil, "")
+	c.Assert(err, IsNil)
+	return a.(*asserts.ValidationSet)
+}
+
+func (s *assertMgrSuite) mockInstalledFoo(rev snap.Revision) {
+	snapstate.Set(s.state, "foo", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "foo", SnapID: "qOqKhntON3vR7kwEbVPsILm7bUViPDzz", Revision: rev},
+		},
+		Current: rev,
+	})
+}
+
+func (s *assertMgrSuite) TestEnforcedValidationSets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(assertstate.Add(s.state, s.storeSigning.StoreAccountKey("")), IsNil)
+	c.Assert(assertstate.Add(s.state, s.dev1Acct), IsNil)
+	c.Assert(assertstate.Add(s.state, s.dev1AcctKey), IsNil)
+	c.Assert(assertstate.Add(s.state, s.validationSetAssert(c, "bar", "1", "1")), IsNil)
+	c.Assert(assertstate.Add(s.state, s.validationSetAssert(c, "bar", "2", "3")), IsNil)
+	c.Assert(assertstate.Add(s.state, s.validationSetAssert(c, "baz", "1", "5")), IsNil)
+
+	// no validation sets tracked
+	sets, err := assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	_, rev, err := sets.CheckPresenceRequired(naming.Snap("foo"))
+	c.Assert(err, IsNil)
+	c.Check(rev.Unset(), Equals, true)
+
+	assertstate.UpdateValidationSet(s.state, &assertstate.ValidationSetTracking{
+		AccountID: s.dev1Acct.AccountID(),
+		Name:      "bar",
+		Mode:      assertstate.Enforce,
+		PinnedAt:  1,
+		Current:   1,
+	})
+	// only monitored
+	assertstate.UpdateValidationSet(s.state, &assertstate.ValidationSetTracking{
+		AccountID: s.dev1Acct.AccountID(),
+		Name:      "baz",
+		Mode:      assertstate.Monitor,
+		Current:   1,
+	})
+
+	sets, err = assertstate.EnforcedValidationSets(s.state)
+	c.Assert(err, IsNil)
+	requiredBy, rev, err := sets.CheckPresenceRequired(naming.Snap("foo"))
+	c.Assert(err, IsNil)
+	c.Check(requiredBy, DeepEquals, []string{s.dev1Acct.AccountID() + "/bar"})
+	c.Check(rev, Equals, snap.R(1))
+}
+
+func (s *assertMgrSuite) TestEnforceValidationSetFetches(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	s.mockInstalledFoo(snap.R(3))
+
+	c.Assert(s.storeSigning.Add(s.validationSetAssert(c, "bar", "2", "3")), IsNil)
+
+	tr, err := assertstate.EnforceValidationSet(s.state, s.dev1Acct.AccountID(), "bar", 2, 0)
+	c.Assert(err, IsNil)
+	c.Check(tr, DeepEquals, &assertstate.ValidationSetTracking{
+		AccountID: s.dev1Acct.AccountID(),
+		Name:      "bar",
+		Mode:      assertstate.Enforce,
+		PinnedAt:  2,
+		Current:   2,
+	})
+
+	var saved assertstate.ValidationSetTracking
+	c.Assert(assertstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "bar", &saved), IsNil)
+	c.Check(&saved, DeepEquals, tr)
+
+	// the assertion was added to the system database
+	vs, err := assertstate.ValidationSetAssertion(s.state, s.dev1Acct.AccountID(), "bar", 0)
+	c.Assert(err, IsNil)
+	c.Check(vs.Sequence(), Equals, 2)
+}
+
+func (s *assertMgrSuite) TestEnforceValidationSetNotMet(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+	s.mockInstalledFoo(snap.R(1))
+
+	c.Assert(s.storeSigning.Add(s.validationSetAssert(c, "bar", "2", "3")), IsNil)
+
+	_, err := assertstate.EnforceValidationSet(s.state, s.dev1Acct.AccountID(), "bar", 2, 0)
+	c.Assert(err, ErrorMatches, fmt.Sprintf(`validation sets assertions are not met:
+- snaps at wrong revisions:
+  - foo \(required at revision 3 by sets %s/bar\)`, s.dev1Acct.AccountID()))
+	c.Check(err, FitsTypeOf, &snapasserts.ValidationSetsValidationError{})
+
+	// not tracked
+	var tr assertstate.ValidationSetTracking
+	c.Check(assertstate.GetValidationSet(s.state, s.dev1Acct.AccountID(), "bar", &tr), Equals, state.ErrNoState)
+}
+
+func (s *assertMgrSuite) TestEnforceValidationSetNotFound(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setModel(sysdb.GenericClassicModel())
+
+	// not pinned and not available locally
+	_, err := assertstate.EnforceValidationSet(s.state, s.dev1Acct.AccountID(), "bar", 0, 0)
+	c.Assert(err, ErrorMatches, fmt.Sprintf(`cannot find validation set %s/bar: validation-set .* not found`, s.dev1Acct.AccountID()))
+}
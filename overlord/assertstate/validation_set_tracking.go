@@ -48,6 +48,14 @@ type ValidationSetTracking struct {
 	Current int `json:"current,omitempty"`
 }
 
+// Sequence returns the sequence number of the currently used validation set.
+func (tr *ValidationSetTracking) Sequence() int {
+	if tr.PinnedAt > 0 {
+		return tr.PinnedAt
+	}
+	return tr.Current
+}
+
 // ValidationSetKey formats the given account id and name into a validation set key.
 func ValidationSetKey(accountID, name string) string {
 	return fmt.Sprintf("%s/%s", accountID, name)
@@ -285,3 +285,16 @@ type ConfGetter interface {
 	Get(snapName, key string, result interface{}) error
 	GetMaybe(snapName, key string, result interface{}) error
 }
+
+// CoreCfg returns the value of the given option of the core snap as a
+// string, unset options are returned as "".
+func CoreCfg(tr ConfGetter, key string) (result string, err error) {
+	var v interface{} = ""
+	if err := tr.Get("core", key, &v); err != nil && !IsNoOption(err) {
+		return "", err
+	}
+	// TODO: we could have a fully typed approach but at the
+	// moment we also always use "" to mean unset as well, this is
+	// the smallest change
+	return fmt.Sprintf("%v", v), nil
+}
@@ -284,3 +284,26 @@ func (s *configHelpersSuite) TestPurgeNullsTopLevelNull(c *C) {
 		},
 	})
 }
+
+func (s *configHelpersSuite) TestCoreCfg(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "foo", "bar"), IsNil)
+	c.Assert(tr.Set("core", "baz", 42), IsNil)
+	c.Assert(tr.Set("core", "qux", true), IsNil)
+
+	for _, tc := range []struct {
+		key, value string
+	}{
+		{"foo", "bar"},
+		{"baz", "42"},
+		{"qux", "true"},
+		{"unset", ""},
+	} {
+		value, err := config.CoreCfg(tr, tc.key)
+		c.Assert(err, IsNil)
+		c.Check(value, Equals, tc.value, Commentf("%s", tc.key))
+	}
+}
@@ -39,14 +39,7 @@ var (
 
 // coreCfg returns the configuration value for the core snap.
 func coreCfg(tr config.ConfGetter, key string) (result string, err error) {
-	var v interface{} = ""
-	if err := tr.Get("core", key, &v); err != nil && !config.IsNoOption(err) {
-		return "", err
-	}
-	// TODO: we could have a fully typed approach but at the
-	// moment we also always use "" to mean unset as well, this is
-	// the smallest change
-	return fmt.Sprintf("%v", v), nil
+	return config.CoreCfg(tr, key)
 }
 
 // supportedConfigurations contains a set of handled configuration keys.
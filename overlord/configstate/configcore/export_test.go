@@ -19,7 +19,10 @@
 
 package configcore
 
-import "github.com/snapcore/snapd/osutil/sys"
+import (
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil/sys"
+)
 
 var (
 	UpdatePiConfig       = updatePiConfig
@@ -48,3 +51,19 @@ func MockChownPath(f func(string, sys.UserID, sys.GroupID) error) func() {
 		sysChownPath = old
 	}
 }
+
+func MockCheckFreeSpace(f func(path string, minSize uint64) error) func() {
+	old := osutilCheckFreeSpace
+	osutilCheckFreeSpace = f
+	return func() {
+		osutilCheckFreeSpace = old
+	}
+}
+
+func MockLoggerSetLevel(f func(logger.Level)) func() {
+	old := loggerSetLevel
+	loggerSetLevel = f
+	return func() {
+		loggerSetLevel = old
+	}
+}
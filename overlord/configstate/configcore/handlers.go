@@ -64,6 +64,9 @@ func init() {
 	// Export experimental.* flags to a place easily accessible from snapd helpers.
 	addFSOnlyHandler(validateExperimentalSettings, doExportExperimentalFlags, nil)
 
+	// logging.level
+	addFSOnlyHandler(validateLoggingSettings, handleLoggingConfiguration, nil)
+
 	// network.disable-ipv6
 	addFSOnlyHandler(validateNetworkSettings, handleNetworkConfiguration, coreOnly)
 
@@ -88,6 +91,18 @@ func init() {
 	// system.timezone
 	addFSOnlyHandler(validateTimezoneSettings, handleTimezoneConfiguration, coreOnly)
 
+	// system.hostname
+	addFSOnlyHandler(validateHostnameSettings, handleHostnameConfiguration, coreOnly)
+
+	// system.timesyncd.servers
+	addFSOnlyHandler(validateTimesyncdSettings, handleTimesyncdConfiguration, coreOnly)
+
+	// system.locale
+	addFSOnlyHandler(validateLocaleSettings, handleLocaleConfiguration, coreOnly)
+
+	// swap.size
+	addFSOnlyHandler(validateSwapSettings, handleSwapConfiguration, coreOnly)
+
 	sysconfig.ApplyFilesystemOnlyDefaultsImpl = func(rootDir string, defaults map[string]interface{}, options *sysconfig.FilesystemOnlyApplyOptions) error {
 		return filesystemOnlyApply(rootDir, plainCoreConfig(defaults), options)
 	}
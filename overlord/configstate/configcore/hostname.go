@@ -0,0 +1,100 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.hostname"] = true
+}
+
+// a hostname is made of labels of letters, digits and dashes, see
+// hostname(7), and is at most 64 characters long on Linux.
+var validHostnameLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`).MatchString
+
+func validHostname(hostname string) bool {
+	if len(hostname) > 64 {
+		return false
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if !validHostnameLabel(label) {
+			return false
+		}
+	}
+	return true
+}
+
+func validateHostnameSettings(tr config.ConfGetter) error {
+	hostname, err := coreCfg(tr, "system.hostname")
+	if err != nil {
+		return err
+	}
+	if hostname == "" {
+		return nil
+	}
+	if !validHostname(hostname) {
+		return fmt.Errorf("cannot set hostname %q: name not valid", hostname)
+	}
+
+	return nil
+}
+
+func handleHostnameConfiguration(tr config.ConfGetter, opts *fsOnlyContext) error {
+	hostname, err := coreCfg(tr, "system.hostname")
+	if err != nil {
+		return nil
+	}
+	// nothing to do
+	if hostname == "" {
+		return nil
+	}
+	// runtime system
+	if opts == nil {
+		output, err := exec.Command("hostnamectl", "set-hostname", hostname).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("cannot set hostname: %v", osutil.OutputErr(output, err))
+		}
+	} else {
+		// On the UC16/UC18/UC20 images the file /etc/hostname is a
+		// symlink to /etc/writable/hostname. The /etc/hostname is
+		// not part of the "writable-path" so we must set the file
+		// in /etc/writable here for this to work.
+		hostnamePath := filepath.Join(opts.RootDir, "/etc/writable/hostname")
+		if err := os.MkdirAll(filepath.Dir(hostnamePath), 0755); err != nil {
+			return err
+		}
+		if err := osutil.AtomicWriteFile(hostnamePath, []byte(hostname+"\n"), 0644, 0); err != nil {
+			return fmt.Errorf("cannot write hostname: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+)
+
+type snapIntegritySuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&snapIntegritySuite{})
+
+func (s *snapIntegritySuite) TestConfigureSnapIntegrityHappy(c *C) {
+	for _, mode := range []string{"", "warn", "enforce"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"snap-integrity": mode,
+			},
+		})
+		c.Check(err, IsNil, Commentf("%q", mode))
+	}
+}
+
+func (s *snapIntegritySuite) TestConfigureSnapIntegrityInvalid(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snap-integrity": "refuse",
+		},
+	})
+	c.Assert(err, ErrorMatches, `snap-integrity can only be set to 'warn' or 'enforce'`)
+}
@@ -0,0 +1,100 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/gadget"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+const kernelCmdlineAppendOpt = "system.kernel.cmdline-append"
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core."+kernelCmdlineAppendOpt] = true
+}
+
+// changedKernelCmdlineAppend returns the new value of the option and whether
+// it differs from the pristine one.
+func changedKernelCmdlineAppend(tr config.Conf) (string, bool, error) {
+	var pristine, value string
+	if err := tr.GetPristine("core", kernelCmdlineAppendOpt, &pristine); err != nil && !config.IsNoOption(err) {
+		return "", false, err
+	}
+	if err := tr.Get("core", kernelCmdlineAppendOpt, &value); err != nil && !config.IsNoOption(err) {
+		return "", false, err
+	}
+	return value, value != pristine, nil
+}
+
+// validateKernelCmdlineAppend validates the arguments appended to the kernel
+// command line, they are applied by devicestate once the configuration is
+// committed.
+func validateKernelCmdlineAppend(tr config.Conf) error {
+	value, changed, err := changedKernelCmdlineAppend(tr)
+	if err != nil || !changed {
+		return err
+	}
+	if err := boot.ValidateExtraKernelCommandLine(value); err != nil {
+		return fmt.Errorf("cannot set %q: %v", kernelCmdlineAppendOpt, err)
+	}
+	if value == "" {
+		return nil
+	}
+
+	st := tr.State()
+	st.Lock()
+	defer st.Unlock()
+
+	deviceCtx, err := snapstate.DeviceCtx(st, nil, nil)
+	if err != nil {
+		if err == state.ErrNoState {
+			return fmt.Errorf("cannot set %q: no device model yet", kernelCmdlineAppendOpt)
+		}
+		return err
+	}
+	if !deviceCtx.HasModeenv() {
+		return fmt.Errorf("cannot set %q: only supported on Ubuntu Core 20 and later", kernelCmdlineAppendOpt)
+	}
+	gadgetSnapInfo, err := snapstate.GadgetInfo(st, deviceCtx)
+	if err != nil {
+		return fmt.Errorf("cannot set %q: cannot get gadget: %v", kernelCmdlineAppendOpt, err)
+	}
+	gadgetInfo, err := gadget.ReadInfo(gadgetSnapInfo.MountDir(), deviceCtx.Model())
+	if err != nil {
+		return fmt.Errorf("cannot set %q: %v", kernelCmdlineAppendOpt, err)
+	}
+	args, err := osutil.KernelCommandLineSplit(value)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if !gadgetInfo.KernelCmdline.IsAllowed(arg) {
+			return fmt.Errorf("cannot set %q: argument %q is not allowed by the gadget", kernelCmdlineAppendOpt, arg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot/boottest"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/snapstate/snapstatetest"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+)
+
+type kernelCmdlineSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&kernelCmdlineSuite{})
+
+const kernelCmdlineGadgetYaml = `
+kernel-cmdline:
+  allow:
+    - quiet
+    - console=ttyS0
+    - loglevel=*
+volumes:
+  pc:
+    bootloader: grub
+    structure:
+      - name: ubuntu-seed
+        role: system-seed
+        filesystem: vfat
+        type: EF,C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+        size: 1200M
+      - name: ubuntu-boot
+        role: system-boot
+        filesystem: ext4
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 750M
+      - name: ubuntu-data
+        role: system-data
+        filesystem: ext4
+        type: 83,0FC63DAF-8483-4772-8E79-3D69D8477DE4
+        size: 1G
+`
+
+func (s *kernelCmdlineSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	err := os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc/"), 0755)
+	c.Assert(err, IsNil)
+
+	s.AddCleanup(release.MockOnClassic(false))
+	s.AddCleanup(snapstatetest.MockDeviceModel(boottest.MakeMockUC20Model()))
+
+	si := &snap.SideInfo{RealName: "pc", Revision: snap.R(1)}
+	snaptest.MockSnapWithFiles(c, "name: pc\ntype: gadget\nversion: 1.0", si, [][]string{
+		{"meta/gadget.yaml", kernelCmdlineGadgetYaml},
+	})
+	s.state.Lock()
+	snapstate.Set(s.state, "pc", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si},
+		Current:  snap.R(1),
+		Active:   true,
+		SnapType: "gadget",
+	})
+	s.state.Unlock()
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineAppendHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"system.kernel.cmdline-append": "quiet console=ttyS0 loglevel=3",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineAppendUnset(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.kernel.cmdline-append": "quiet",
+		},
+		changes: map[string]interface{}{
+			"system.kernel.cmdline-append": "",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineAppendUnchanged(c *C) {
+	// the current value is not validated again, even if the gadget
+	// does not allow it anymore
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.kernel.cmdline-append": "splash",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineAppendNotAllowed(c *C) {
+	for _, tc := range []struct {
+		args string
+		err  string
+	}{
+		{"splash", `cannot set "system.kernel.cmdline-append": argument "splash" is not allowed by the gadget`},
+		{"quiet console=tty1", `cannot set "system.kernel.cmdline-append": argument "console=tty1" is not allowed by the gadget`},
+		{"snapd_recovery_mode=recover", `cannot set "system.kernel.cmdline-append": cannot append snapd specific kernel command line argument "snapd_recovery_mode=recover"`},
+		{`quiet="`, `cannot set "system.kernel.cmdline-append": cannot parse kernel command line arguments: .*`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			changes: map[string]interface{}{
+				"system.kernel.cmdline-append": tc.args,
+			},
+		})
+		c.Check(err, ErrorMatches, tc.err, Commentf("%q", tc.args))
+	}
+}
+
+func (s *kernelCmdlineSuite) TestConfigureKernelCmdlineAppendNotUC20(c *C) {
+	s.AddCleanup(snapstatetest.MockDeviceModel(boottest.MakeMockModel()))
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		changes: map[string]interface{}{
+			"system.kernel.cmdline-append": "quiet",
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot set "system.kernel.cmdline-append": only supported on Ubuntu Core 20 and later`)
+}
@@ -0,0 +1,97 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type localeSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&localeSuite{})
+
+func (s *localeSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	err := os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc/"), 0755)
+	c.Assert(err, IsNil)
+}
+
+func (s *localeSuite) TestConfigureLocaleInvalid(c *C) {
+	invalidLocales := []string{
+		"english", "en-US", "en_us", "EN_US.UTF-8", "en_US.", "en_US.UTF-8@", "en_US;rm -rf /", "../../etc/passwd",
+	}
+
+	for _, locale := range invalidLocales {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.locale": locale,
+			},
+		})
+		c.Assert(err, ErrorMatches, `cannot set locale.*`, Commentf("%q", locale))
+	}
+}
+
+func (s *localeSuite) TestConfigureLocaleIntegration(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	mockedLocalectl := testutil.MockCommand(c, "localectl", "")
+	defer mockedLocalectl.Restore()
+
+	validLocales := []string{
+		"C", "C.UTF-8", "POSIX", "en", "en_US", "en_US.UTF-8", "de_DE.ISO-8859-15@euro", "ast_ES.UTF-8", "sr_RS@latin",
+	}
+
+	for _, locale := range validLocales {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.locale": locale,
+			},
+		})
+		c.Assert(err, IsNil)
+		c.Check(mockedLocalectl.Calls(), DeepEquals, [][]string{
+			{"localectl", "set-locale", "LANG=" + locale},
+		})
+		mockedLocalectl.ForgetCalls()
+	}
+}
+
+func (s *localeSuite) TestFilesystemOnlyApply(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"system.locale": "de_DE.UTF-8",
+	})
+	tmpDir := c.MkDir()
+	c.Assert(configcore.FilesystemOnlyApply(tmpDir, conf, nil), IsNil)
+
+	c.Check(filepath.Join(tmpDir, "/etc/writable/locale.conf"), testutil.FileEquals, "LANG=de_DE.UTF-8\n")
+}
@@ -0,0 +1,69 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.logging.level"] = true
+}
+
+var loggerSetLevel = logger.SetLevel
+
+func logLevel(tr config.ConfGetter) (logger.Level, error) {
+	levelStr, err := coreCfg(tr, "logging.level")
+	if err != nil {
+		return logger.LevelNotice, err
+	}
+	level, err := logger.ParseLevel(levelStr)
+	if err != nil {
+		return logger.LevelNotice, fmt.Errorf("cannot set logging.level: %v", err)
+	}
+	return level, nil
+}
+
+func validateLoggingSettings(tr config.ConfGetter) error {
+	_, err := logLevel(tr)
+	return err
+}
+
+func handleLoggingConfiguration(tr config.ConfGetter, opts *fsOnlyContext) error {
+	if opts != nil {
+		// the level only applies to a running snapd
+		return nil
+	}
+	level, err := logLevel(tr)
+	if err != nil {
+		return err
+	}
+	loggerSetLevel(level)
+	return nil
+}
+
+// ApplyLogLevel sets the log level of snapd from the logging.level option.
+func ApplyLogLevel(tr config.ConfGetter) error {
+	return handleLoggingConfiguration(tr, nil)
+}
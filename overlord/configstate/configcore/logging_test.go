@@ -0,0 +1,93 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+)
+
+type loggingSuite struct {
+	configcoreSuite
+
+	levels []logger.Level
+}
+
+var _ = Suite(&loggingSuite{})
+
+func (s *loggingSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	s.levels = nil
+	s.AddCleanup(configcore.MockLoggerSetLevel(func(level logger.Level) {
+		s.levels = append(s.levels, level)
+	}))
+}
+
+func (s *loggingSuite) TestConfigureLogLevel(c *C) {
+	for _, tc := range []struct {
+		value string
+		level logger.Level
+	}{
+		{"debug", logger.LevelDebug},
+		{"notice", logger.LevelNotice},
+		{"", logger.LevelNotice},
+	} {
+		s.levels = nil
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"logging.level": tc.value,
+			},
+		})
+		c.Assert(err, IsNil)
+		c.Check(s.levels, DeepEquals, []logger.Level{tc.level}, Commentf("%q", tc.value))
+	}
+}
+
+func (s *loggingSuite) TestConfigureLogLevelInvalid(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"logging.level": "verbose",
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot set logging.level: unknown log level "verbose"`)
+	c.Check(s.levels, HasLen, 0)
+}
+
+func (s *loggingSuite) TestApplyLogLevel(c *C) {
+	err := configcore.ApplyLogLevel(configcore.PlainCoreConfig(map[string]interface{}{
+		"logging.level": "debug",
+	}))
+	c.Assert(err, IsNil)
+	c.Check(s.levels, DeepEquals, []logger.Level{logger.LevelDebug})
+}
+
+func (s *loggingSuite) TestFilesystemOnlyApply(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"logging.level": "debug",
+	})
+	c.Assert(configcore.FilesystemOnlyApply(c.MkDir(), conf, nil), IsNil)
+	// the level only applies to a running snapd
+	c.Check(s.levels, HasLen, 0)
+}
@@ -0,0 +1,74 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+)
+
+type offlineStoreSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&offlineStoreSuite{})
+
+func (s *offlineStoreSuite) TestConfigureOfflineStoreDirHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.offline-dir": c.MkDir(),
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *offlineStoreSuite) TestConfigureOfflineStoreDirUnset(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.offline-dir": "",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *offlineStoreSuite) TestConfigureOfflineStoreDirRelative(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.offline-dir": "some/dir",
+		},
+	})
+	c.Assert(err, ErrorMatches, `store.offline-dir must be an absolute path`)
+}
+
+func (s *offlineStoreSuite) TestConfigureOfflineStoreDirMissing(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"store.offline-dir": filepath.Join(c.MkDir(), "missing"),
+		},
+	})
+	c.Assert(err, ErrorMatches, `store.offline-dir ".*/missing" is not a directory`)
+}
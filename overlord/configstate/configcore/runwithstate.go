@@ -53,6 +53,12 @@ func init() {
 	addWithStateHandler(validateRefreshSchedule, nil, validateOnly)
 	addWithStateHandler(validateRefreshRateLimit, nil, validateOnly)
 	addWithStateHandler(validateAutomaticSnapshotsExpiration, nil, validateOnly)
+	addWithStateHandler(validateSnapshotsEncryption, nil, validateOnly)
+	addWithStateHandler(validateScheduledSnapshots, nil, validateOnly)
+	addWithStateHandler(validateOfflineStoreDir, nil, validateOnly)
+	addWithStateHandler(validateSnapIntegrity, nil, validateOnly)
+	// system.kernel.cmdline-append is applied by devicestate
+	addWithStateHandler(validateKernelCmdlineAppend, nil, validateOnly)
 }
 
 type withStateHandler struct {
@@ -104,13 +104,13 @@ func switchDisableConsoleConfService(sysd systemd.Systemd, serviceName string, d
 		// gadget-defaults will also be set as part of the
 		// system install change. However during install mode
 		// console-conf has no "complete" file, it just never runs
-		// in install mode. So we need to detect this and do nothing
-		// or the install mode will fail.
+		// in install mode (nor in factory-reset mode). So we need to
+		// detect this and do nothing or the install mode will fail.
 		// XXX: instead of this hack we should look at the config
 		//      defaults and compare with the setting and exit if
 		//      they are the same but that requires some more changes.
 		mode, _, _ := boot.ModeAndRecoverySystemFromKernelCommandLine()
-		if mode == boot.ModeInstall {
+		if mode == boot.ModeInstall || mode == boot.ModeFactoryReset {
 			return nil
 		}
 
@@ -22,14 +22,27 @@ package configcore
 
 import (
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"time"
 
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
 )
 
 func init() {
 	// add supported configuration of this module
 	supportedConfigurations["core.snapshots.automatic.retention"] = true
+	supportedConfigurations["core.snapshots.encryption"] = true
+	supportedConfigurations["core.snapshots.schedule"] = true
+	supportedConfigurations["core.snapshots.scheduled.include"] = true
+	supportedConfigurations["core.snapshots.scheduled.exclude"] = true
+	supportedConfigurations["core.snapshots.scheduled.keep-last"] = true
+	supportedConfigurations["core.snapshots.scheduled.keep-daily"] = true
+	supportedConfigurations["core.snapshots.scheduled.keep-weekly"] = true
 }
 
 func validateAutomaticSnapshotsExpiration(tr config.Conf) error {
@@ -48,3 +61,62 @@ func validateAutomaticSnapshotsExpiration(tr config.Conf) error {
 	}
 	return nil
 }
+
+// validateSnapshotsEncryption checks the file holding the key used to
+// encrypt snapshots, when set.
+func validateSnapshotsEncryption(tr config.Conf) error {
+	keyFile, err := coreCfg(tr, "snapshots.encryption")
+	if err != nil {
+		return err
+	}
+	if keyFile == "" {
+		return nil
+	}
+	if !filepath.IsAbs(keyFile) {
+		return fmt.Errorf("snapshots.encryption must be an absolute path to a key file")
+	}
+	if !osutil.FileExists(keyFile) || osutil.IsDirectory(keyFile) {
+		return fmt.Errorf("snapshots.encryption key file %q does not exist", keyFile)
+	}
+	return nil
+}
+
+// validateScheduledSnapshots checks the schedule of the scheduled
+// snapshots, the snaps they include or exclude, and their retention.
+func validateScheduledSnapshots(tr config.Conf) error {
+	scheduleStr, err := coreCfg(tr, "snapshots.schedule")
+	if err != nil {
+		return err
+	}
+	if scheduleStr != "" {
+		if _, err := timeutil.ParseSchedule(scheduleStr); err != nil {
+			return fmt.Errorf("snapshots.schedule cannot be parsed: %v", err)
+		}
+	}
+
+	for _, opt := range []string{"snapshots.scheduled.include", "snapshots.scheduled.exclude"} {
+		snapsStr, err := coreCfg(tr, opt)
+		if err != nil {
+			return err
+		}
+		for _, name := range strutil.CommaSeparatedList(snapsStr) {
+			if err := snap.ValidateInstanceName(name); err != nil {
+				return fmt.Errorf("%s must be a comma separated list of snap names: %v", opt, err)
+			}
+		}
+	}
+
+	for _, opt := range []string{"snapshots.scheduled.keep-last", "snapshots.scheduled.keep-daily", "snapshots.scheduled.keep-weekly"} {
+		keepStr, err := coreCfg(tr, opt)
+		if err != nil {
+			return err
+		}
+		if keepStr == "" {
+			continue
+		}
+		if n, err := strconv.ParseUint(keepStr, 10, 16); err != nil || n > 1000 {
+			return fmt.Errorf("%s must be a number between 0 and 1000, not %q", opt, keepStr)
+		}
+	}
+	return nil
+}
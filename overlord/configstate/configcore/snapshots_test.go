@@ -20,6 +20,9 @@
 package configcore_test
 
 import (
+	"io/ioutil"
+	"path/filepath"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/overlord/configstate/configcore"
@@ -70,3 +73,87 @@ func (s *refreshSuite) TestConfigureAutomaticSnapshotsExpirationInvalid(c *C) {
 	})
 	c.Assert(err, ErrorMatches, `snapshots.automatic.retention cannot be parsed:.*`)
 }
+
+func (s *snapshotsSuite) TestConfigureSnapshotsEncryptionHappy(c *C) {
+	keyFile := filepath.Join(c.MkDir(), "key")
+	c.Assert(ioutil.WriteFile(keyFile, []byte("sekrit"), 0600), IsNil)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.encryption": keyFile,
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotsSuite) TestConfigureSnapshotsEncryptionRelative(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.encryption": "some/key",
+		},
+	})
+	c.Assert(err, ErrorMatches, `snapshots.encryption must be an absolute path to a key file`)
+}
+
+func (s *snapshotsSuite) TestConfigureSnapshotsEncryptionMissing(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.encryption": "/does/not/exist",
+		},
+	})
+	c.Assert(err, ErrorMatches, `snapshots.encryption key file "/does/not/exist" does not exist`)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsHappy(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.schedule":              "mon,10:00~12:00",
+			"snapshots.scheduled.include":     "foo,bar_instance",
+			"snapshots.scheduled.exclude":     "baz",
+			"snapshots.scheduled.keep-last":   "5",
+			"snapshots.scheduled.keep-daily":  "7",
+			"snapshots.scheduled.keep-weekly": "0",
+		},
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsInvalidSchedule(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"snapshots.schedule": "invalid",
+		},
+	})
+	c.Assert(err, ErrorMatches, `snapshots.schedule cannot be parsed: .*`)
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsInvalidSnaps(c *C) {
+	for _, opt := range []string{"snapshots.scheduled.include", "snapshots.scheduled.exclude"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				opt: "foo,Not Valid",
+			},
+		})
+		c.Check(err, ErrorMatches, opt+` must be a comma separated list of snap names: invalid snap name: "Not Valid"`)
+	}
+}
+
+func (s *snapshotsSuite) TestConfigureScheduledSnapshotsInvalidRetention(c *C) {
+	for _, opt := range []string{"snapshots.scheduled.keep-last", "snapshots.scheduled.keep-daily", "snapshots.scheduled.keep-weekly"} {
+		for _, value := range []string{"-1", "many", "1001"} {
+			err := configcore.Run(&mockConf{
+				state: s.state,
+				conf: map[string]interface{}{
+					opt: value,
+				},
+			})
+			c.Check(err, ErrorMatches, opt+` must be a number between 0 and 1000, not "`+value+`"`)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+)
+
+// swapFile is the swap file managed with swap.size, it lives on the
+// writable partition
+const swapFile = "/var/lib/swapfile"
+
+// minSwapSize is the smallest swap file that can be set with swap.size
+const minSwapSize = 1000 * 1000
+
+var osutilCheckFreeSpace = osutil.CheckFreeSpace
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.swap.size"] = true
+}
+
+// swapSize returns the size of the swap file in bytes, 0 meaning no swap
+// file.
+func swapSize(tr config.ConfGetter) (int64, error) {
+	sizeStr, err := coreCfg(tr, "swap.size")
+	if err != nil {
+		return 0, err
+	}
+	if sizeStr == "" || sizeStr == "0" {
+		return 0, nil
+	}
+	size, err := strutil.ParseByteSize(sizeStr)
+	if err != nil {
+		return 0, fmt.Errorf("swap.size %v", err)
+	}
+	if size < minSwapSize {
+		return 0, fmt.Errorf("swap.size must be at least 1MB, or 0 to disable")
+	}
+	return size, nil
+}
+
+func validateSwapSettings(tr config.ConfGetter) error {
+	_, err := swapSize(tr)
+	return err
+}
+
+func handleSwapConfiguration(tr config.ConfGetter, opts *fsOnlyContext) error {
+	if opts != nil {
+		// the swap file is only created on a running system, gadget
+		// defaults get applied again when seeding
+		return nil
+	}
+
+	size, err := swapSize(tr)
+	if err != nil {
+		return err
+	}
+
+	swapPath := filepath.Join(dirs.GlobalRootDir, swapFile)
+	var currentSize int64
+	fi, err := os.Stat(swapPath)
+	switch {
+	case err == nil:
+		currentSize = fi.Size()
+	case !os.IsNotExist(err):
+		return err
+	}
+	haveUnit := osutil.FileExists(systemd.SwapUnitPath(swapFile))
+	if size == currentSize && (size == 0 || haveUnit) {
+		// nothing to do
+		return nil
+	}
+
+	// the space of the current swap file is reclaimed when resizing it
+	if size > currentSize {
+		if err := osutilCheckFreeSpace(filepath.Dir(swapPath), uint64(size-currentSize)); err != nil {
+			return fmt.Errorf("cannot set swap.size: %v", err)
+		}
+	}
+
+	// stop using the current swap file before resizing or removing it
+	sysd := systemd.NewUnderRoot(dirs.GlobalRootDir, systemd.SystemMode, &sysdLogger{})
+	if err := sysd.RemoveSwapUnitFile(swapFile); err != nil {
+		return err
+	}
+	if err := os.Remove(swapPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+
+	if err := createSwapFile(swapPath, size); err != nil {
+		return fmt.Errorf("cannot create swap file: %v", err)
+	}
+	if _, err := sysd.AddSwapUnitFile(swapFile); err != nil {
+		return err
+	}
+	return nil
+}
+
+// createSwapFile creates a swap file of the given size, the file only
+// appears at the given path once it is ready to be used.
+func createSwapFile(swapPath string, size int64) (err error) {
+	if err := os.MkdirAll(filepath.Dir(swapPath), 0755); err != nil {
+		return err
+	}
+	tmpPath := swapPath + ".new"
+	// swap files must not be readable by others
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if output, err := exec.Command("fallocate", "-l", strconv.FormatInt(size, 10), tmpPath).CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	if output, err := exec.Command("mkswap", tmpPath).CombinedOutput(); err != nil {
+		return osutil.OutputErr(output, err)
+	}
+	return os.Rename(tmpPath, swapPath)
+}
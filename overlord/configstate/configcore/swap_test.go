@@ -0,0 +1,275 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type swapSuite struct {
+	configcoreSuite
+
+	swapPath        string
+	swapUnitPath    string
+	mockFallocate   *testutil.MockCmd
+	mockMkswap      *testutil.MockCmd
+	freeSpaceChecks []uint64
+}
+
+var _ = Suite(&swapSuite{})
+
+func (s *swapSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	err := os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc/"), 0755)
+	c.Assert(err, IsNil)
+
+	s.AddCleanup(release.MockOnClassic(false))
+
+	s.swapPath = filepath.Join(dirs.GlobalRootDir, "/var/lib/swapfile")
+	s.swapUnitPath = systemd.SwapUnitPath("/var/lib/swapfile")
+
+	// fallocate -l <size> <path>
+	s.mockFallocate = testutil.MockCommand(c, "fallocate", `truncate -s "$2" "$3"`)
+	s.AddCleanup(s.mockFallocate.Restore)
+	s.mockMkswap = testutil.MockCommand(c, "mkswap", "")
+	s.AddCleanup(s.mockMkswap.Restore)
+
+	s.freeSpaceChecks = nil
+	s.AddCleanup(configcore.MockCheckFreeSpace(func(path string, minSize uint64) error {
+		c.Check(path, Equals, filepath.Dir(s.swapPath))
+		s.freeSpaceChecks = append(s.freeSpaceChecks, minSize)
+		return nil
+	}))
+}
+
+func (s *swapSuite) mockSwap(c *C, size int64) {
+	c.Assert(os.MkdirAll(filepath.Dir(s.swapPath), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(s.swapPath, nil, 0600), IsNil)
+	c.Assert(os.Truncate(s.swapPath, size), IsNil)
+	c.Assert(os.MkdirAll(filepath.Dir(s.swapUnitPath), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(s.swapUnitPath, nil, 0644), IsNil)
+}
+
+func (s *swapSuite) TestConfigureSwapSizeInvalid(c *C) {
+	for _, tc := range []struct {
+		size string
+		err  string
+	}{
+		{"foo", `swap.size cannot parse "foo": no numerical prefix`},
+		{"100", `swap.size cannot parse "100": need a number with a unit as input`},
+		{"100XB", `swap.size cannot parse "100XB": try 'kB' or 'MB'`},
+		{"-1MB", `swap.size cannot parse "-1MB": size cannot be negative`},
+		{"10kB", `swap.size must be at least 1MB, or 0 to disable`},
+	} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"swap.size": tc.size,
+			},
+		})
+		c.Check(err, ErrorMatches, tc.err, Commentf("%q", tc.size))
+	}
+	c.Check(s.mockFallocate.Calls(), HasLen, 0)
+}
+
+func (s *swapSuite) TestConfigureSwapSizeCreate(c *C) {
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"swap.size": "100MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.freeSpaceChecks, DeepEquals, []uint64{100 * 1000 * 1000})
+	c.Check(s.mockFallocate.Calls(), DeepEquals, [][]string{
+		{"fallocate", "-l", "100000000", s.swapPath + ".new"},
+	})
+	c.Check(s.mockMkswap.Calls(), DeepEquals, [][]string{
+		{"mkswap", s.swapPath + ".new"},
+	})
+	fi, err := os.Stat(s.swapPath)
+	c.Assert(err, IsNil)
+	c.Check(fi.Size(), Equals, int64(100*1000*1000))
+	c.Check(fi.Mode().Perm(), Equals, os.FileMode(0600))
+	c.Check(s.swapUnitPath, testutil.FileContains, "What=/var/lib/swapfile\n")
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"--root", dirs.GlobalRootDir, "enable", "var-lib-swapfile.swap"},
+		{"start", "var-lib-swapfile.swap"},
+	})
+}
+
+func (s *swapSuite) TestConfigureSwapSizeResize(c *C) {
+	s.mockSwap(c, 100*1000*1000)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"swap.size": "300MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	// the space of the current swap file is reclaimed
+	c.Check(s.freeSpaceChecks, DeepEquals, []uint64{200 * 1000 * 1000})
+	fi, err := os.Stat(s.swapPath)
+	c.Assert(err, IsNil)
+	c.Check(fi.Size(), Equals, int64(300*1000*1000))
+	c.Check(s.swapUnitPath, testutil.FilePresent)
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		// the current swap file is deactivated first
+		{"stop", "var-lib-swapfile.swap"},
+		{"show", "--property=ActiveState", "var-lib-swapfile.swap"},
+		{"--root", dirs.GlobalRootDir, "disable", "var-lib-swapfile.swap"},
+		{"daemon-reload"},
+		{"daemon-reload"},
+		{"--root", dirs.GlobalRootDir, "enable", "var-lib-swapfile.swap"},
+		{"start", "var-lib-swapfile.swap"},
+	})
+}
+
+func (s *swapSuite) TestConfigureSwapSizeShrink(c *C) {
+	s.mockSwap(c, 300*1000*1000)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"swap.size": "100MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	// no extra space is needed
+	c.Check(s.freeSpaceChecks, HasLen, 0)
+	fi, err := os.Stat(s.swapPath)
+	c.Assert(err, IsNil)
+	c.Check(fi.Size(), Equals, int64(100*1000*1000))
+}
+
+func (s *swapSuite) TestConfigureSwapSizeUnchanged(c *C) {
+	s.mockSwap(c, 100*1000*1000)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"swap.size": "100MB",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.mockFallocate.Calls(), HasLen, 0)
+	c.Check(s.systemctlArgs, HasLen, 0)
+}
+
+func (s *swapSuite) TestConfigureSwapSizeRemove(c *C) {
+	s.mockSwap(c, 100*1000*1000)
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"swap.size": "0",
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(s.swapPath, testutil.FileAbsent)
+	c.Check(s.swapUnitPath, testutil.FileAbsent)
+	c.Check(s.mockFallocate.Calls(), HasLen, 0)
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"stop", "var-lib-swapfile.swap"},
+		{"show", "--property=ActiveState", "var-lib-swapfile.swap"},
+		{"--root", dirs.GlobalRootDir, "disable", "var-lib-swapfile.swap"},
+		{"daemon-reload"},
+	})
+}
+
+func (s *swapSuite) TestConfigureSwapSizeNotEnoughSpace(c *C) {
+	s.mockSwap(c, 100*1000*1000)
+	restore := configcore.MockCheckFreeSpace(func(path string, minSize uint64) error {
+		return &osutil.NotEnoughDiskSpaceError{Path: path, Delta: 1000}
+	})
+	defer restore()
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"swap.size": "1GB",
+		},
+	})
+	c.Assert(err, ErrorMatches, `cannot set swap.size: insufficient space in ".*", at least 1kB more is required`)
+
+	// the current swap file is untouched
+	fi, err := os.Stat(s.swapPath)
+	c.Assert(err, IsNil)
+	c.Check(fi.Size(), Equals, int64(100*1000*1000))
+	c.Check(s.swapUnitPath, testutil.FilePresent)
+	c.Check(s.systemctlArgs, HasLen, 0)
+}
+
+func (s *swapSuite) TestConfigureSwapSizeMkswapFails(c *C) {
+	s.mockMkswap.Restore()
+	s.mockMkswap = testutil.MockCommand(c, "mkswap", "echo mkswap failed; exit 1")
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"swap.size": "100MB",
+		},
+	})
+	c.Assert(err, ErrorMatches, "cannot create swap file: mkswap failed")
+
+	// no leftovers
+	c.Check(s.swapPath, testutil.FileAbsent)
+	c.Check(s.swapPath+".new", testutil.FileAbsent)
+	c.Check(s.swapUnitPath, testutil.FileAbsent)
+}
+
+func (s *swapSuite) TestFilesystemOnlyApply(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"swap.size": "100MB",
+	})
+	tmpDir := c.MkDir()
+	c.Assert(configcore.FilesystemOnlyApply(tmpDir, conf, nil), IsNil)
+
+	// the swap file is created on the running system only
+	c.Check(s.mockFallocate.Calls(), HasLen, 0)
+	c.Check(filepath.Join(tmpDir, "/var/lib/swapfile"), testutil.FileAbsent)
+}
+
+func (s *swapSuite) TestFilesystemOnlyApplyInvalid(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"swap.size": "foo",
+	})
+	err := configcore.FilesystemOnlyApply(c.MkDir(), conf, nil)
+	c.Assert(err, ErrorMatches, `swap.size cannot parse "foo": .*`)
+}
@@ -0,0 +1,99 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+)
+
+func init() {
+	// add supported configuration of this module
+	supportedConfigurations["core.system.timesyncd.servers"] = true
+}
+
+func timesyncdServers(tr config.ConfGetter) ([]string, error) {
+	serversStr, err := coreCfg(tr, "system.timesyncd.servers")
+	if err != nil {
+		return nil, err
+	}
+	return strutil.CommaSeparatedList(serversStr), nil
+}
+
+func validateTimesyncdSettings(tr config.ConfGetter) error {
+	servers, err := timesyncdServers(tr)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if net.ParseIP(server) == nil && !validHostname(server) {
+			return fmt.Errorf("cannot set time server %q: name not valid", server)
+		}
+	}
+
+	return nil
+}
+
+func handleTimesyncdConfiguration(tr config.ConfGetter, opts *fsOnlyContext) error {
+	servers, err := timesyncdServers(tr)
+	if err != nil {
+		return err
+	}
+
+	rootDir := dirs.GlobalRootDir
+	if opts != nil {
+		rootDir = opts.RootDir
+	}
+	dir := filepath.Join(rootDir, "/etc/systemd/timesyncd.conf.d")
+	name := "10-snapd-servers.conf"
+	dirContent := make(map[string]osutil.FileState, 1)
+	if len(servers) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		dirContent[name] = &osutil.MemoryFileState{
+			Content: []byte(fmt.Sprintf("[Time]\nNTP=%s\n", strings.Join(servers, " "))),
+			Mode:    0644,
+		}
+	}
+	changed, removed, err := osutil.EnsureDirState(dir, name, dirContent)
+	if err != nil {
+		return err
+	}
+
+	// runtime system, restart timesyncd to use the new servers
+	if opts == nil && (len(changed) > 0 || len(removed) > 0) {
+		sysd := systemd.NewUnderRoot(dirs.GlobalRootDir, systemd.SystemMode, &sysdLogger{})
+		if err := sysd.ReloadOrRestart("systemd-timesyncd"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package configcore_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/configstate/configcore"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type timesyncdSuite struct {
+	configcoreSuite
+}
+
+var _ = Suite(&timesyncdSuite{})
+
+func (s *timesyncdSuite) SetUpTest(c *C) {
+	s.configcoreSuite.SetUpTest(c)
+
+	err := os.MkdirAll(filepath.Join(dirs.GlobalRootDir, "/etc/"), 0755)
+	c.Assert(err, IsNil)
+}
+
+func (s *timesyncdSuite) TestConfigureTimesyncdServersInvalid(c *C) {
+	for _, servers := range []string{"-foo", "ntp.example.com,no_underscores", "ntp.example.com ntp2.example.com"} {
+		err := configcore.Run(&mockConf{
+			state: s.state,
+			conf: map[string]interface{}{
+				"system.timesyncd.servers": servers,
+			},
+		})
+		c.Assert(err, ErrorMatches, `cannot set time server .*: name not valid`, Commentf("%q", servers))
+	}
+}
+
+func (s *timesyncdSuite) TestConfigureTimesyncdServersIntegration(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	confPath := filepath.Join(dirs.GlobalRootDir, "/etc/systemd/timesyncd.conf.d/10-snapd-servers.conf")
+
+	err := configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timesyncd.servers": "ntp.example.com, 192.168.0.1,2001:db8::1",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(confPath, testutil.FileEquals, "[Time]\nNTP=ntp.example.com 192.168.0.1 2001:db8::1\n")
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"reload-or-restart", "systemd-timesyncd"},
+	})
+	s.systemctlArgs = nil
+
+	// nothing changed, no restart
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timesyncd.servers": "ntp.example.com,192.168.0.1,2001:db8::1",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(s.systemctlArgs, HasLen, 0)
+
+	// unsetting the servers goes back to the default ones
+	err = configcore.Run(&mockConf{
+		state: s.state,
+		conf: map[string]interface{}{
+			"system.timesyncd.servers": "",
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(confPath, testutil.FileAbsent)
+	c.Check(s.systemctlArgs, DeepEquals, [][]string{
+		{"reload-or-restart", "systemd-timesyncd"},
+	})
+}
+
+func (s *timesyncdSuite) TestFilesystemOnlyApply(c *C) {
+	conf := configcore.PlainCoreConfig(map[string]interface{}{
+		"system.timesyncd.servers": "ntp1.example.com,ntp2.example.com",
+	})
+	tmpDir := c.MkDir()
+	c.Assert(configcore.FilesystemOnlyApply(tmpDir, conf, nil), IsNil)
+
+	c.Check(filepath.Join(tmpDir, "/etc/systemd/timesyncd.conf.d/10-snapd-servers.conf"), testutil.FileEquals, "[Time]\nNTP=ntp1.example.com ntp2.example.com\n")
+	c.Check(s.systemctlArgs, HasLen, 0)
+}
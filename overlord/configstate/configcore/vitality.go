@@ -30,6 +30,7 @@ import (
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/naming"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/timings"
 	"github.com/snapcore/snapd/wrappers"
 )
@@ -103,13 +104,25 @@ func handleVitalityConfiguration(tr config.Conf, opts *fsOnlyContext) error {
 			return err
 		}
 
+		// keep the services in the slice of the quota group of the snap
+		var quotaGrp *quota.Group
+		if snapstate.QuotaGroupForSnap != nil {
+			quotaGrp, err = snapstate.QuotaGroupForSnap(st, instanceName)
+			if err != nil {
+				return err
+			}
+		}
+
 		// rank changed, rewrite/restart services
 		for _, app := range info.Apps {
 			if !app.IsService() {
 				continue
 			}
 
-			opts := &wrappers.AddSnapServicesOptions{VitalityRank: rank}
+			opts := &wrappers.AddSnapServicesOptions{
+				VitalityRank: rank,
+				QuotaGroup:   quotaGrp,
+			}
 			if err := wrappers.AddSnapServices(info, opts, progress.Null); err != nil {
 				return err
 			}
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/configstate/configcore"
 	"github.com/snapcore/snapd/overlord/hookstate"
@@ -31,6 +32,7 @@ import (
 
 var configcoreRun = configcore.Run
 var configcoreExportExperimentalFlags = configcore.ExportExperimentalFlags
+var configcoreApplyLogLevel = configcore.ApplyLogLevel
 
 func MockConfigcoreRun(f func(config.Conf) error) (restore func()) {
 	origConfigcoreRun := configcoreRun
@@ -48,6 +50,14 @@ func MockConfigcoreExportExperimentalFlags(mock func(tr config.ConfGetter) error
 	}
 }
 
+func MockConfigcoreApplyLogLevel(mock func(tr config.ConfGetter) error) (restore func()) {
+	old := configcoreApplyLogLevel
+	configcoreApplyLogLevel = mock
+	return func() {
+		configcoreApplyLogLevel = old
+	}
+}
+
 func Init(st *state.State, hookManager *hookstate.HookManager) error {
 	// Most configuration is handled via the "configure" hook of the
 	// snaps. However some configuration is internally handled
@@ -68,5 +78,8 @@ func Init(st *state.State, hookManager *hookstate.HookManager) error {
 	if err := configcoreExportExperimentalFlags(tr); err != nil {
 		return fmt.Errorf("cannot export experimental config flags: %v", err)
 	}
+	if err := configcoreApplyLogLevel(tr); err != nil {
+		logger.Noticef("Cannot apply log level: %v", err)
+	}
 	return nil
 }
@@ -25,6 +25,7 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/configstate"
 	"github.com/snapcore/snapd/overlord/configstate/config"
@@ -369,3 +370,26 @@ func (s *configcoreExportSuite) TestExportErr(c *C) {
 	c.Assert(err, ErrorMatches, "cannot export experimental config flags: bad bad")
 	c.Assert(calls, Equals, 1)
 }
+
+func (s *configcoreExportSuite) TestApplyLogLevel(c *C) {
+	var val string
+
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "logging.level", "debug")
+	tr.Commit()
+
+	r := configstate.MockConfigcoreApplyLogLevel(func(conf config.ConfGetter) error {
+		err := conf.Get("core", "logging.level", &val)
+		c.Assert(err, IsNil)
+		return fmt.Errorf("boom")
+	})
+	defer r()
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	// failing to apply the log level is not fatal
+	err := configstate.Init(s.state, s.hookMgr)
+	c.Assert(err, IsNil)
+	c.Check(val, Equals, "debug")
+	c.Check(logbuf.String(), testutil.Contains, "Cannot apply log level: boom")
+}
@@ -86,6 +86,8 @@ type DeviceManager struct {
 
 	ensureInstalledRan bool
 
+	ensureFactoryResetRan bool
+
 	cloudInitAlreadyRestricted           bool
 	cloudInitErrorAttemptStart           *time.Time
 	cloudInitEnabledInactiveAttemptStart *time.Time
@@ -133,6 +135,7 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, runner *state.T
 	runner.AddHandler("mark-preseeded", m.doMarkPreseeded, nil)
 	runner.AddHandler("mark-seeded", m.doMarkSeeded, nil)
 	runner.AddHandler("setup-run-system", m.doSetupRunSystem, nil)
+	runner.AddHandler("factory-reset-run-system", m.doFactoryResetRunSystem, nil)
 	runner.AddHandler("prepare-remodeling", m.doPrepareRemodeling, nil)
 	runner.AddCleanup("prepare-remodeling", m.cleanupRemodel)
 	// this *must* always run last and finalizes a remodel
@@ -145,6 +148,12 @@ func Manager(s *state.State, hookManager *hookstate.HookManager, runner *state.T
 	// or gadget snaps. There are no further changes to the boot assets,
 	// unless a new gadget update is deployed.
 	runner.AddHandler("update-gadget-assets", m.doUpdateGadgetAssets, nil)
+	// the candidate recovery system is removed when it fails to boot
+	runner.AddHandler("create-recovery-system", m.doCreateRecoverySystem, m.undoCreateRecoverySystem)
+	runner.AddHandler("finalize-recovery-system", m.doFinalizeTriedRecoverySystem, nil)
+	runner.AddHandler("rotate-recovery-key", m.doRotateRecoveryKey, nil)
+	runner.AddHandler("remove-recovery-keys", m.doRemoveRecoveryKeys, nil)
+	runner.AddHandler("update-kernel-cmdline-append", m.doUpdateKernelCmdlineAppend, m.undoUpdateKernelCmdlineAppend)
 
 	runner.AddBlocked(gadgetUpdateBlocked)
 
@@ -411,6 +420,24 @@ func (m *DeviceManager) ensureOperational() error {
 		return nil
 	}
 
+	if osutil.FileExists(factoryResetMarkerFile()) {
+		// first boot after a factory reset, the device keeps the
+		// identity kept in ubuntu-save
+		if !seeded {
+			return nil
+		}
+		restored, err := m.restoreSerialFromSave(device)
+		if err != nil {
+			logger.Noticef("cannot restore serial from ubuntu-save, the device registers again: %v", err)
+		}
+		if err := os.Remove(factoryResetMarkerFile()); err != nil {
+			return err
+		}
+		if restored {
+			return nil
+		}
+	}
+
 	var storeID, gadget string
 	model, err := m.Model()
 	if err != nil && err != state.ErrNoState {
@@ -499,6 +526,73 @@ func (m *DeviceManager) ensureOperational() error {
 	return nil
 }
 
+// factoryResetMarkerFile is written to ubuntu-data by factory reset.
+func factoryResetMarkerFile() string {
+	return filepath.Join(dirs.SnapDeviceDir, "factory-reset")
+}
+
+// restoreSerialFromSave restores the serial of the device from the
+// ubuntu-save assertion database, if it is there together with its device
+// key. It returns whether the device is registered again.
+func (m *DeviceManager) restoreSerialFromSave(device *auth.DeviceState) (restored bool, err error) {
+	var serial *asserts.Serial
+	batch := asserts.NewBatch(nil)
+	err = m.withSaveAssertDB(func(savedb *asserts.Database) error {
+		serials, err := savedb.FindMany(asserts.SerialType, map[string]string{
+			"brand-id": device.Brand,
+			"model":    device.Model,
+		})
+		if asserts.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, a := range serials {
+			cand := a.(*asserts.Serial)
+			err := m.withKeypairMgr(func(keypairMgr asserts.KeypairManager) error {
+				_, err := keypairMgr.Get(cand.DeviceKey().ID())
+				return err
+			})
+			if err == nil {
+				serial = cand
+				break
+			}
+		}
+		if serial == nil {
+			return nil
+		}
+		retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+			return ref.Resolve(savedb.Find)
+		}
+		return batch.Fetch(assertstate.DB(m.state), retrieve, func(f asserts.Fetcher) error {
+			return f.Save(serial)
+		})
+	})
+	if err == errNoSaveSupport {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if serial == nil {
+		return false, nil
+	}
+	if err := assertstate.AddBatch(m.state, batch, &asserts.CommitOptions{Precheck: true}); err != nil {
+		return false, err
+	}
+
+	device.KeyID = serial.DeviceKey().ID()
+	device.Serial = serial.Serial()
+	if err := m.setDevice(device); err != nil {
+		return false, err
+	}
+	logger.Noticef("restored serial %q from ubuntu-save", serial.Serial())
+	m.markRegistered()
+	m.state.EnsureBefore(0)
+	return true, nil
+}
+
 var startTime time.Time
 
 func init() {
@@ -832,6 +926,45 @@ func (m *DeviceManager) ensureInstalled() error {
 	return nil
 }
 
+func (m *DeviceManager) ensureFactoryReset() error {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	if release.OnClassic {
+		return nil
+	}
+
+	if m.ensureFactoryResetRan {
+		return nil
+	}
+
+	if m.SystemMode() != "factory-reset" {
+		return nil
+	}
+
+	var seeded bool
+	err := m.state.Get("seeded", &seeded)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	if !seeded {
+		return nil
+	}
+
+	if m.changeInFlight("factory-reset") {
+		return nil
+	}
+
+	m.ensureFactoryResetRan = true
+
+	factoryReset := m.state.NewTask("factory-reset-run-system", i18n.G("Perform factory reset of the system"))
+
+	chg := m.state.NewChange("factory-reset", i18n.G("Perform factory reset"))
+	chg.AddAll(state.NewTaskSet(factoryReset))
+
+	return nil
+}
+
 var timeNow = time.Now
 
 // StartOfOperationTime returns the time when snapd started operating,
@@ -960,6 +1093,14 @@ func (m *DeviceManager) Ensure() error {
 		if err := m.ensureInstalled(); err != nil {
 			errs = append(errs, err)
 		}
+
+		if err := m.ensureFactoryReset(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if err := m.ensureKernelCmdlineAppend(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
 	if len(errs) > 0 {
@@ -1130,10 +1271,12 @@ var defaultSystemActions = []SystemAction{
 var currentSystemActions = []SystemAction{
 	{Title: "Reinstall", Mode: "install"},
 	{Title: "Recover", Mode: "recover"},
+	{Title: "Factory reset", Mode: "factory-reset"},
 	{Title: "Run normally", Mode: "run"},
 }
 var recoverSystemActions = []SystemAction{
 	{Title: "Reinstall", Mode: "install"},
+	{Title: "Factory reset", Mode: "factory-reset"},
 	{Title: "Run normally", Mode: "run"},
 }
 
@@ -1180,8 +1323,8 @@ var ErrUnsupportedAction = errors.New("unsupported action")
 // When called without a systemLabel but with a mode it will use
 // the current system to enter the given mode.
 //
-// Note that "recover" and "run" modes are only available for the
-// current system.
+// Note that "recover", "factory-reset" and "run" modes are only
+// available for the current system.
 func (m *DeviceManager) Reboot(systemLabel, mode string) error {
 	rebootCurrent := func() {
 		logger.Noticef("rebooting system")
@@ -1286,8 +1429,9 @@ func (m *DeviceManager) switchToSystemAndMode(systemLabel, mode string, sameSyst
 			sameSystemAndMode()
 			return nil
 		}
-	case "install":
-		// requesting system actions in install mode does not make sense atm
+	case "install", "factory-reset":
+		// requesting system actions in install or factory-reset mode
+		// does not make sense atm
 		//
 		// TODO:UC20: maybe factory hooks will be able to something like
 		// this?
@@ -24,13 +24,16 @@ package devicestate
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"sync"
 
 	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/netutil"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/assertstate"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/configstate/config"
@@ -39,8 +42,10 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/seed"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/naming"
+	"github.com/snapcore/snapd/strutil"
 )
 
 var (
@@ -637,3 +642,97 @@ func Remodeling(st *state.State) bool {
 	}
 	return false
 }
+
+// CreateRecoverySystem creates a new recovery system with the given label
+// using the snaps and assertions present in the running system. The new
+// system is tried by rebooting into it before it is added to the list of
+// current recovery systems.
+func CreateRecoverySystem(st *state.State, label string) (*state.Change, error) {
+	if err := seed.ValidateUC20SeedSystemLabel(label); err != nil {
+		return nil, err
+	}
+	model, err := findModel(st)
+	if err != nil {
+		return nil, err
+	}
+	if model.Grade() == asserts.ModelGradeUnset {
+		return nil, fmt.Errorf("cannot create recovery systems on non UC20 devices")
+	}
+	if osutil.IsDirectory(filepath.Join(boot.InitramfsUbuntuSeedDir, "systems", label)) {
+		return nil, fmt.Errorf("recovery system %q already exists", label)
+	}
+	for _, chg := range st.Changes() {
+		if !chg.IsReady() && chg.Kind() == "create-recovery-system" {
+			return nil, &snapstate.ChangeConflictError{
+				ChangeKind: "create-recovery-system",
+				Message:    "cannot create a recovery system, another one is being created",
+			}
+		}
+	}
+
+	chg := st.NewChange("create-recovery-system", fmt.Sprintf(i18n.G("Create new recovery system with label %q"), label))
+	create := st.NewTask("create-recovery-system", fmt.Sprintf(i18n.G("Create recovery system with label %q"), label))
+	create.Set("recovery-system-setup", &recoverySystemSetup{Label: label})
+	finalize := st.NewTask("finalize-recovery-system", fmt.Sprintf(i18n.G("Finalize recovery system with label %q"), label))
+	finalize.WaitFor(create)
+	finalize.Set("recovery-system-setup-task", create.ID())
+	chg.AddAll(state.NewTaskSet(create, finalize))
+
+	return chg, nil
+}
+
+var recoveryKeyChangeKinds = []string{"rotate-recovery-key", "remove-recovery-keys"}
+
+func checkRecoveryKeyChange(st *state.State) error {
+	model, err := findModel(st)
+	if err != nil {
+		return err
+	}
+	if model.Grade() == asserts.ModelGradeUnset {
+		return fmt.Errorf("cannot change the recovery key on non UC20 devices")
+	}
+	if !osutil.FileExists(recoveryKeyFile()) {
+		return fmt.Errorf("no recovery key available")
+	}
+	for _, chg := range st.Changes() {
+		if chg.IsReady() || !strutil.ListContains(recoveryKeyChangeKinds, chg.Kind()) {
+			continue
+		}
+		return &snapstate.ChangeConflictError{
+			ChangeKind: chg.Kind(),
+			Message:    "cannot change the recovery key, another change of the recovery key is in progress",
+		}
+	}
+	return nil
+}
+
+// RotateRecoveryKey replaces the recovery key of the encrypted ubuntu-data
+// partition with a newly generated one, which is also added to the
+// encrypted ubuntu-save partition. The previous recovery key is removed.
+func RotateRecoveryKey(st *state.State) (*state.Change, error) {
+	if err := checkRecoveryKeyChange(st); err != nil {
+		return nil, err
+	}
+
+	chg := st.NewChange("rotate-recovery-key", i18n.G("Rotate the recovery key"))
+	rotate := st.NewTask("rotate-recovery-key", i18n.G("Replace the recovery key of the encrypted partitions"))
+	chg.AddTask(rotate)
+
+	return chg, nil
+}
+
+// RemoveRecoveryKeys removes the recovery key from the encrypted
+// partitions. Note that no recovery key can be added afterwards, as adding
+// one requires an existing recovery key. The reinstall key of ubuntu-save
+// is kept.
+func RemoveRecoveryKeys(st *state.State) (*state.Change, error) {
+	if err := checkRecoveryKeyChange(st); err != nil {
+		return nil, err
+	}
+
+	chg := st.NewChange("remove-recovery-keys", i18n.G("Remove the recovery keys"))
+	remove := st.NewTask("remove-recovery-keys", i18n.G("Remove the recovery key from the encrypted partitions"))
+	chg.AddTask(remove)
+
+	return chg, nil
+}
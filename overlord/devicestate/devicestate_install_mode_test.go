@@ -37,6 +37,7 @@ import (
 	"github.com/snapcore/snapd/gadget"
 	"github.com/snapcore/snapd/gadget/install"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil/disks"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/overlord/devicestate"
 	"github.com/snapcore/snapd/overlord/devicestate/devicestatetest"
@@ -98,6 +99,10 @@ const (
 )
 
 func (s *deviceMgrInstallModeSuite) makeMockInstalledPcGadget(c *C, grade, gadgetDefaultsYaml string) *asserts.Model {
+	return s.makeMockInstalledPcGadgetWithStorageProtection(c, grade, "", gadgetDefaultsYaml)
+}
+
+func (s *deviceMgrInstallModeSuite) makeMockInstalledPcGadgetWithStorageProtection(c *C, grade, storageProtection, gadgetDefaultsYaml string) *asserts.Model {
 	si := &snap.SideInfo{
 		RealName: "pc-kernel",
 		Revision: snap.R(1),
@@ -142,7 +147,7 @@ func (s *deviceMgrInstallModeSuite) makeMockInstalledPcGadget(c *C, grade, gadge
 	})
 	snaptest.MockSnapWithFiles(c, "name: core20\ntype: base", si, nil)
 
-	mockModel := s.makeModelAssertionInState(c, "my-brand", "my-model", map[string]interface{}{
+	headers := map[string]interface{}{
 		"display-name": "my model",
 		"architecture": "amd64",
 		"base":         "core20",
@@ -160,7 +165,12 @@ func (s *deviceMgrInstallModeSuite) makeMockInstalledPcGadget(c *C, grade, gadge
 				"type":            "gadget",
 				"default-channel": "20",
 			}},
-	})
+	}
+	if storageProtection != "" {
+		headers["storage-safety"] = "encrypted"
+		headers["storage-protection"] = storageProtection
+	}
+	mockModel := s.makeModelAssertionInState(c, "my-brand", "my-model", headers)
 	devicestatetest.SetDevice(s.state, &auth.DeviceState{
 		Brand: "my-brand",
 		Model: "my-model",
@@ -175,6 +185,9 @@ type encTestCase struct {
 	bypass            bool
 	encrypt           bool
 	trustedBootloader bool
+	storageProtection string
+	installAuth       string
+	installErr        error
 }
 
 var (
@@ -206,6 +219,9 @@ func (s *deviceMgrInstallModeSuite) doRunChangeTestWithEncryption(c *C, grade st
 		brOpts = options
 		installSealingObserver = obs
 		installRunCalled++
+		if tc.installErr != nil {
+			return nil, tc.installErr
+		}
 		var keysForRoles map[string]*install.EncryptionKeySet
 		if tc.encrypt {
 			keysForRoles = map[string]*install.EncryptionKeySet{
@@ -247,9 +263,24 @@ func (s *deviceMgrInstallModeSuite) doRunChangeTestWithEncryption(c *C, grade st
 	}
 
 	s.state.Lock()
-	mockModel := s.makeMockInstalledPcGadget(c, grade, "")
+	mockModel := s.makeMockInstalledPcGadgetWithStorageProtection(c, grade, tc.storageProtection, "")
 	s.state.Unlock()
 
+	installAuthFile := filepath.Join(boot.InitramfsSeedEncryptionKeyDir, "install-auth")
+	if tc.installAuth != "" {
+		c.Assert(os.MkdirAll(filepath.Dir(installAuthFile), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(installAuthFile, []byte(tc.installAuth+"\n"), 0600), IsNil)
+		// keep a link to see what is left on disk
+		c.Assert(os.Link(installAuthFile, installAuthFile+".link"), IsNil)
+	}
+	checkInstallAuthGone := func() {
+		c.Check(installAuthFile, testutil.FileAbsent)
+		if tc.installAuth != "" {
+			// and was overwritten before
+			c.Check(installAuthFile+".link", testutil.FileEquals, make([]byte, len(tc.installAuth)+1))
+		}
+	}
+
 	bypassEncryptionPath := filepath.Join(boot.InitramfsUbuntuSeedDir, ".force-unencrypted")
 	if tc.bypass {
 		err := os.MkdirAll(filepath.Dir(bypassEncryptionPath), 0755)
@@ -269,11 +300,15 @@ func (s *deviceMgrInstallModeSuite) doRunChangeTestWithEncryption(c *C, grade st
 		c.Check(bootWith.BasePath, Matches, ".*/var/lib/snapd/snaps/core20_2.snap")
 		c.Check(bootWith.RecoverySystemDir, Matches, "/systems/20191218")
 		c.Check(bootWith.UnpackedGadgetDir, Equals, filepath.Join(dirs.SnapMountDir, "pc/1"))
-		if tc.encrypt {
+		if tc.encrypt && tc.storageProtection != "passphrase" {
 			c.Check(seal, NotNil)
 		} else {
 			c.Check(seal, IsNil)
 		}
+		// the install authentication is still around
+		if tc.installAuth != "" {
+			c.Check(installAuthFile, testutil.FilePresent)
+		}
 		bootMakeBootableCalled++
 		return nil
 	})
@@ -300,7 +335,8 @@ func (s *deviceMgrInstallModeSuite) doRunChangeTestWithEncryption(c *C, grade st
 
 	// and was run successfully
 	if err := installSystem.Err(); err != nil {
-		// we failed, no further checks needed
+		// we failed, the install authentication is gone nonetheless
+		checkInstallAuthGone()
 		return err
 	}
 
@@ -310,9 +346,14 @@ func (s *deviceMgrInstallModeSuite) doRunChangeTestWithEncryption(c *C, grade st
 	c.Assert(brGadgetRoot, Equals, filepath.Join(dirs.SnapMountDir, "/pc/1"))
 	c.Assert(brDevice, Equals, "")
 	if tc.encrypt {
+		expectedPassphrase := ""
+		if tc.storageProtection == "passphrase" {
+			expectedPassphrase = tc.installAuth
+		}
 		c.Assert(brOpts, DeepEquals, install.Options{
-			Mount:   true,
-			Encrypt: true,
+			Mount:      true,
+			Encrypt:    true,
+			Passphrase: expectedPassphrase,
 		})
 	} else {
 		c.Assert(brOpts, DeepEquals, install.Options{
@@ -333,6 +374,8 @@ func (s *deviceMgrInstallModeSuite) doRunChangeTestWithEncryption(c *C, grade st
 	c.Assert(installRunCalled, Equals, 1)
 	c.Assert(bootMakeBootableCalled, Equals, 1)
 	c.Assert(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystemNow})
+	// and removed once done
+	checkInstallAuthGone()
 
 	return nil
 }
@@ -480,12 +523,58 @@ func (s *deviceMgrInstallModeSuite) TestInstallSecuredWithTPMAndSave(c *C) {
 	c.Check(filepath.Join(boot.InstallHostFDEDataDir, "recovery.key"), testutil.FileEquals, dataRecoveryKey[:])
 	c.Check(filepath.Join(boot.InstallHostFDEDataDir, "ubuntu-save.key"), testutil.FileEquals, saveKey[:])
 	c.Check(filepath.Join(boot.InstallHostFDEDataDir, "reinstall.key"), testutil.FileEquals, reinstallKey[:])
+	c.Check(filepath.Join(boot.InstallHostFDESaveDir, "reinstall.key"), testutil.FileEquals, reinstallKey[:])
 	marker, err := ioutil.ReadFile(filepath.Join(boot.InstallHostFDEDataDir, "marker"))
 	c.Assert(err, IsNil)
 	c.Check(marker, HasLen, 32)
 	c.Check(filepath.Join(boot.InstallHostFDESaveDir, "marker"), testutil.FileEquals, marker)
 }
 
+func (s *deviceMgrInstallModeSuite) TestInstallSecuredWithTPMAndPIN(c *C) {
+	err := s.doRunChangeTestWithEncryption(c, "secured", encTestCase{
+		tpm: true, bypass: false, encrypt: true, trustedBootloader: true,
+		storageProtection: "tpm+pin", installAuth: "1234",
+	})
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(boot.InstallHostFDEDataDir, "recovery.key"), testutil.FileEquals, dataRecoveryKey[:])
+}
+
+func (s *deviceMgrInstallModeSuite) TestInstallSecuredWithPassphrase(c *C) {
+	// no TPM is needed
+	err := s.doRunChangeTestWithEncryption(c, "secured", encTestCase{
+		tpm: false, bypass: false, encrypt: true, trustedBootloader: true,
+		storageProtection: "passphrase", installAuth: "my passphrase",
+	})
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(boot.InstallHostFDEDataDir, "recovery.key"), testutil.FileEquals, dataRecoveryKey[:])
+	c.Check(filepath.Join(boot.InstallHostFDEDataDir, "ubuntu-save.key"), testutil.FileEquals, saveKey[:])
+}
+
+func (s *deviceMgrInstallModeSuite) TestInstallSecuredWithPassphraseInstallError(c *C) {
+	err := s.doRunChangeTestWithEncryption(c, "secured", encTestCase{
+		tpm: false, bypass: false, encrypt: true, trustedBootloader: true,
+		storageProtection: "passphrase", installAuth: "my passphrase",
+		installErr: fmt.Errorf("boom"),
+	})
+	c.Assert(err, ErrorMatches, `(?s).*cannot install system: boom.*`)
+}
+
+func (s *deviceMgrInstallModeSuite) TestInstallSecuredWithTPMAndNoPIN(c *C) {
+	err := s.doRunChangeTestWithEncryption(c, "secured", encTestCase{
+		tpm: true, bypass: false, encrypt: true, trustedBootloader: true,
+		storageProtection: "tpm+pin",
+	})
+	c.Assert(err, ErrorMatches, `(?s).*cannot install system with storage-protection "tpm\+pin": no PIN provided.*`)
+}
+
+func (s *deviceMgrInstallModeSuite) TestInstallSecuredWithNoPassphrase(c *C) {
+	err := s.doRunChangeTestWithEncryption(c, "secured", encTestCase{
+		tpm: true, bypass: false, encrypt: true, trustedBootloader: true,
+		storageProtection: "passphrase",
+	})
+	c.Assert(err, ErrorMatches, `(?s).*cannot install system with storage-protection "passphrase": no passphrase provided.*`)
+}
+
 func (s *deviceMgrInstallModeSuite) TestInstallSecuredBypassEncryption(c *C) {
 	err := s.doRunChangeTestWithEncryption(c, "secured", encTestCase{tpm: false, bypass: true, encrypt: false})
 	c.Assert(err, ErrorMatches, "(?s).*cannot encrypt device storage as mandated by model grade secured:.*TPM not available.*")
@@ -914,6 +1003,41 @@ func (s *deviceMgrInstallModeSuite) TestInstallCheckEncryptedStorageSafety(c *C)
 	}
 }
 
+func (s *deviceMgrInstallModeSuite) TestInstallCheckEncryptedStorageProtectionPassphrase(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	restore := devicestate.MockSecbootCheckKeySealingSupported(func() error { return fmt.Errorf("TPM not available") })
+	defer restore()
+
+	mockModel := s.makeModelAssertionInState(c, "my-brand", "my-model", map[string]interface{}{
+		"display-name":       "my model",
+		"architecture":       "amd64",
+		"base":               "core20",
+		"grade":              "secured",
+		"storage-protection": "passphrase",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              pcKernelSnapID,
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc",
+				"id":              pcSnapID,
+				"type":            "gadget",
+				"default-channel": "20",
+			}},
+	})
+	deviceCtx := &snapstatetest.TrivialDeviceContext{DeviceModel: mockModel}
+
+	// the keys are not sealed, no TPM is needed
+	encrypt, err := devicestate.DeviceManagerCheckEncryption(s.mgr, s.state, deviceCtx)
+	c.Assert(err, IsNil)
+	c.Check(encrypt, Equals, true)
+}
+
 func (s *deviceMgrInstallModeSuite) TestInstallCheckEncryptedErrors(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
@@ -1079,3 +1203,350 @@ func (s *deviceMgrInstallModeSuite) TestInstallCheckEncryptedErrorsLogsHook(c *C
 	c.Check(err, IsNil)
 	c.Check(logbuf.String(), Matches, "(?s).*: not encrypting device storage as querying kernel fde-setup hook did not succeed:.*\n")
 }
+
+func (s *deviceMgrInstallModeSuite) findFactoryReset() *state.Change {
+	for _, chg := range s.state.Changes() {
+		if chg.Kind() == "factory-reset" {
+			return chg
+		}
+	}
+	return nil
+}
+
+type factoryResetTestCase struct {
+	encrypted         bool
+	storageProtection string
+	installAuth       string
+	// previousReinstallKey is set when the reinstall key of the
+	// previous install is known
+	previousReinstallKey bool
+	// rotatedRecoveryKey is set when the recovery key was rotated,
+	// which added it to ubuntu-save
+	rotatedRecoveryKey bool
+}
+
+var previousReinstallKey = secboot.RecoveryKey{'p', 'r', 'e', 'v', 'i', 'o', 'u', 's', 9, 10, 11, 12, 13, 14, 15, 16}
+
+var rotatedRecoveryKey = secboot.RecoveryKey{'r', 'o', 't', 'a', 't', 'e', 'd', 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+func (s *deviceMgrInstallModeSuite) doRunFactoryResetChange(c *C, grade string, tc factoryResetTestCase) error {
+	restore := release.MockOnClassic(false)
+	defer restore()
+	bootloaderRootdir := c.MkDir()
+
+	labels := map[string]string{
+		"ubuntu-seed": "ubuntu-seed-partuuid",
+	}
+	if tc.encrypted {
+		labels["ubuntu-save-enc"] = "ubuntu-save-enc-partuuid"
+	} else {
+		labels["ubuntu-save"] = "ubuntu-save-partuuid"
+	}
+	restore = disks.MockMountPointDisksToPartitionMapping(map[disks.Mountpoint]*disks.MockDiskMapping{
+		{Mountpoint: boot.InitramfsUbuntuSeedDir}: {
+			FilesystemLabelToPartUUID: labels,
+			DiskHasPartitions:         true,
+		},
+	})
+	defer restore()
+
+	var brOpts install.Options
+	var factoryResetCalled int
+	var installSealingObserver gadget.ContentObserver
+	restore = devicestate.MockInstallFactoryReset(func(mod gadget.Model, gadgetRoot, device string, options install.Options, obs gadget.ContentObserver) (*install.InstalledSystemSideData, error) {
+		// ensure we can grab the lock here, i.e. that it's not taken
+		s.state.Lock()
+		s.state.Unlock()
+
+		c.Check(mod.Grade(), Equals, asserts.ModelGrade(grade))
+		c.Check(gadgetRoot, Equals, filepath.Join(dirs.SnapMountDir, "/pc/1"))
+		c.Check(device, Equals, "")
+
+		brOpts = options
+		installSealingObserver = obs
+		factoryResetCalled++
+		var keysForRoles map[string]*install.EncryptionKeySet
+		if options.Encrypt {
+			keysForRoles = map[string]*install.EncryptionKeySet{
+				gadget.SystemData: {
+					Key:         dataEncryptionKey,
+					RecoveryKey: dataRecoveryKey,
+				},
+			}
+		}
+		return &install.InstalledSystemSideData{
+			KeysForRoles: keysForRoles,
+		}, nil
+	})
+	defer restore()
+	restore = devicestate.MockInstallRun(func(mod gadget.Model, gadgetRoot, device string, options install.Options, obs gadget.ContentObserver) (*install.InstalledSystemSideData, error) {
+		c.Fatalf("unexpected call")
+		return nil, nil
+	})
+	defer restore()
+
+	restore = devicestate.MockSecbootDiskUnlockKeyFromKernel(func(devicePath string) (secboot.EncryptionKey, error) {
+		c.Check(devicePath, Equals, "/dev/disk/by-partuuid/ubuntu-save-enc-partuuid")
+		return saveKey, nil
+	})
+	defer restore()
+	var addedRecoveryKeys []secboot.RecoveryKey
+	restore = devicestate.MockSecbootAddRecoveryKey(func(key secboot.EncryptionKey, rkey secboot.RecoveryKey, node string) error {
+		c.Check(key, DeepEquals, saveKey)
+		c.Check(node, Equals, "/dev/disk/by-partuuid/ubuntu-save-enc-partuuid")
+		addedRecoveryKeys = append(addedRecoveryKeys, rkey)
+		return nil
+	})
+	defer restore()
+	var removedRecoveryKeys []secboot.RecoveryKey
+	restore = devicestate.MockSecbootRemoveRecoveryKey(func(rkey secboot.RecoveryKey, node string) error {
+		c.Check(node, Equals, "/dev/disk/by-partuuid/ubuntu-save-enc-partuuid")
+		// the new key is already recorded in ubuntu-save
+		c.Check(filepath.Join(boot.InstallHostFDESaveDir, "reinstall.key"), testutil.FileEquals, addedRecoveryKeys[0][:])
+		removedRecoveryKeys = append(removedRecoveryKeys, rkey)
+		return nil
+	})
+	defer restore()
+	if tc.previousReinstallKey {
+		c.Assert(previousReinstallKey.Save(filepath.Join(boot.InstallHostFDESaveDir, "reinstall.key")), IsNil)
+	}
+	if tc.rotatedRecoveryKey {
+		c.Assert(rotatedRecoveryKey.Save(filepath.Join(boot.InstallHostFDESaveDir, "recovery.key")), IsNil)
+	}
+
+	installAuthFile := filepath.Join(boot.InitramfsSeedEncryptionKeyDir, "install-auth")
+	if tc.installAuth != "" {
+		c.Assert(os.MkdirAll(filepath.Dir(installAuthFile), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(installAuthFile, []byte(tc.installAuth+"\n"), 0600), IsNil)
+		// keep a link to see what is left on disk
+		c.Assert(os.Link(installAuthFile, installAuthFile+".link"), IsNil)
+	}
+	checkInstallAuthGone := func() {
+		c.Check(installAuthFile, testutil.FileAbsent)
+		if tc.installAuth != "" {
+			// and was overwritten before
+			c.Check(installAuthFile+".link", testutil.FileEquals, make([]byte, len(tc.installAuth)+1))
+		}
+	}
+
+	if tc.encrypted {
+		tab := bootloadertest.Mock("trusted", bootloaderRootdir).WithTrustedAssets()
+		tab.TrustedAssetsList = []string{"trusted-asset"}
+		bootloader.Force(tab)
+		s.AddCleanup(func() { bootloader.Force(nil) })
+
+		err := os.MkdirAll(boot.InitramfsUbuntuSeedDir, 0755)
+		c.Assert(err, IsNil)
+		err = ioutil.WriteFile(filepath.Join(boot.InitramfsUbuntuSeedDir, "trusted-asset"), nil, 0644)
+		c.Assert(err, IsNil)
+	}
+
+	s.state.Lock()
+	mockModel := s.makeMockInstalledPcGadgetWithStorageProtection(c, grade, tc.storageProtection, "")
+	s.state.Unlock()
+
+	bootMakeBootableCalled := 0
+	restore = devicestate.MockBootMakeBootableAfterDataReset(func(model *asserts.Model, rootdir string, bootWith *boot.BootableSet, seal *boot.TrustedAssetsInstallObserver) error {
+		c.Check(model, DeepEquals, mockModel)
+		c.Check(rootdir, Equals, dirs.GlobalRootDir)
+		c.Check(bootWith.KernelPath, Matches, ".*/var/lib/snapd/snaps/pc-kernel_1.snap")
+		c.Check(bootWith.BasePath, Matches, ".*/var/lib/snapd/snaps/core20_2.snap")
+		c.Check(bootWith.RecoverySystemDir, Matches, "/systems/20191218")
+		c.Check(bootWith.UnpackedGadgetDir, Equals, filepath.Join(dirs.SnapMountDir, "pc/1"))
+		if tc.encrypted {
+			c.Check(seal, NotNil)
+		} else {
+			c.Check(seal, IsNil)
+		}
+		bootMakeBootableCalled++
+		return nil
+	})
+	defer restore()
+	restore = devicestate.MockBootMakeBootable(func(model *asserts.Model, rootdir string, bootWith *boot.BootableSet, seal *boot.TrustedAssetsInstallObserver) error {
+		c.Fatalf("unexpected call")
+		return nil
+	})
+	defer restore()
+
+	modeenv := boot.Modeenv{
+		Mode:           "factory-reset",
+		RecoverySystem: "20191218",
+	}
+	c.Assert(modeenv.WriteTo(""), IsNil)
+	devicestate.SetSystemMode(s.mgr, "factory-reset")
+
+	// normally done by snap-bootstrap
+	err := os.MkdirAll(boot.InitramfsUbuntuBootDir, 0755)
+	c.Assert(err, IsNil)
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(s.findInstallSystem(), IsNil)
+	factoryReset := s.findFactoryReset()
+	c.Assert(factoryReset, NotNil)
+
+	if err := factoryReset.Err(); err != nil {
+		// we failed, the install authentication is gone nonetheless
+		checkInstallAuthGone()
+		return err
+	}
+
+	c.Assert(factoryReset.Status(), Equals, state.DoneStatus)
+	c.Check(brOpts, DeepEquals, install.Options{
+		Mount:   true,
+		Encrypt: tc.encrypted,
+	})
+	if tc.encrypted {
+		c.Assert(installSealingObserver, NotNil)
+		// a new reinstall key was added to ubuntu-save
+		c.Assert(addedRecoveryKeys, HasLen, 1)
+		c.Check(filepath.Join(boot.InstallHostFDEDataDir, "recovery.key"), testutil.FileEquals, dataRecoveryKey[:])
+		c.Check(filepath.Join(boot.InstallHostFDEDataDir, "ubuntu-save.key"), testutil.FileEquals, saveKey[:])
+		c.Check(filepath.Join(boot.InstallHostFDEDataDir, "reinstall.key"), testutil.FileEquals, addedRecoveryKeys[0][:])
+		c.Check(filepath.Join(boot.InstallHostFDESaveDir, "reinstall.key"), testutil.FileEquals, addedRecoveryKeys[0][:])
+		// and the previous one was removed, if known, as well as
+		// the rotated recovery key
+		var expectedRemoved []secboot.RecoveryKey
+		if tc.previousReinstallKey {
+			expectedRemoved = append(expectedRemoved, previousReinstallKey)
+		}
+		if tc.rotatedRecoveryKey {
+			expectedRemoved = append(expectedRemoved, rotatedRecoveryKey)
+		}
+		c.Check(removedRecoveryKeys, DeepEquals, expectedRemoved)
+		c.Check(filepath.Join(boot.InstallHostFDESaveDir, "recovery.key"), testutil.FileAbsent)
+		c.Check(filepath.Join(boot.InstallHostFDEDataDir, "marker"), testutil.FilePresent)
+		c.Check(filepath.Join(boot.InstallHostFDESaveDir, "marker"), testutil.FilePresent)
+	} else {
+		c.Assert(installSealingObserver, IsNil)
+		c.Check(addedRecoveryKeys, HasLen, 0)
+	}
+
+	var buf bytes.Buffer
+	c.Assert(asserts.NewEncoder(&buf).Encode(mockModel), IsNil)
+	c.Check(filepath.Join(boot.InitramfsUbuntuBootDir, "device/model"), testutil.FileEquals, buf.String())
+	c.Check(s.ConfigureTargetSystemOptsPassed, HasLen, 1)
+	// the serial is restored on the first boot
+	c.Check(filepath.Join(boot.InstallHostWritableDir, "var/lib/snapd/device/factory-reset"), testutil.FilePresent)
+
+	c.Check(factoryResetCalled, Equals, 1)
+	c.Check(bootMakeBootableCalled, Equals, 1)
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystemNow})
+	checkInstallAuthGone()
+
+	return nil
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetUnencrypted(c *C) {
+	err := s.doRunFactoryResetChange(c, "dangerous", factoryResetTestCase{})
+	c.Assert(err, IsNil)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetEncrypted(c *C) {
+	err := s.doRunFactoryResetChange(c, "secured", factoryResetTestCase{encrypted: true})
+	c.Assert(err, IsNil)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetEncryptedRemovesPreviousReinstallKey(c *C) {
+	err := s.doRunFactoryResetChange(c, "secured", factoryResetTestCase{
+		encrypted:            true,
+		previousReinstallKey: true,
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetEncryptedRemovesRotatedRecoveryKey(c *C) {
+	err := s.doRunFactoryResetChange(c, "secured", factoryResetTestCase{
+		encrypted:            true,
+		previousReinstallKey: true,
+		rotatedRecoveryKey:   true,
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetEncryptedWithTPMAndPIN(c *C) {
+	err := s.doRunFactoryResetChange(c, "secured", factoryResetTestCase{
+		encrypted:            true,
+		storageProtection:    "tpm+pin",
+		installAuth:          "1234",
+		previousReinstallKey: true,
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetEncryptedWithTPMAndNoPIN(c *C) {
+	err := s.doRunFactoryResetChange(c, "secured", factoryResetTestCase{
+		encrypted:         true,
+		storageProtection: "tpm+pin",
+	})
+	c.Assert(err, ErrorMatches, `(?s).*storage-protection "tpm\+pin": no PIN provided.*`)
+	c.Check(s.restartRequests, HasLen, 0)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetEncryptedWithPassphraseUnsupported(c *C) {
+	err := s.doRunFactoryResetChange(c, "secured", factoryResetTestCase{
+		encrypted:         true,
+		storageProtection: "passphrase",
+	})
+	c.Assert(err, ErrorMatches, `(?ms)cannot perform the following tasks:
+- Perform factory reset of the system \(cannot perform factory reset of a system with storage-protection "passphrase"\)`)
+	c.Check(s.restartRequests, HasLen, 0)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetTaskErrors(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	restore = disks.MockMountPointDisksToPartitionMapping(map[disks.Mountpoint]*disks.MockDiskMapping{
+		{Mountpoint: boot.InitramfsUbuntuSeedDir}: {
+			FilesystemLabelToPartUUID: map[string]string{
+				"ubuntu-seed": "ubuntu-seed-partuuid",
+			},
+			DiskHasPartitions: true,
+		},
+	})
+	defer restore()
+
+	restore = devicestate.MockInstallFactoryReset(func(mod gadget.Model, gadgetRoot, device string, options install.Options, _ gadget.ContentObserver) (*install.InstalledSystemSideData, error) {
+		return nil, fmt.Errorf("The horror, The horror")
+	})
+	defer restore()
+
+	err := ioutil.WriteFile(filepath.Join(dirs.GlobalRootDir, "/var/lib/snapd/modeenv"),
+		[]byte("mode=factory-reset\nrecovery_system=20191218\n"), 0644)
+	c.Assert(err, IsNil)
+
+	s.state.Lock()
+	s.makeMockInstalledPcGadget(c, "dangerous", "")
+	devicestate.SetSystemMode(s.mgr, "factory-reset")
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	factoryReset := s.findFactoryReset()
+	c.Check(factoryReset.Err(), ErrorMatches, `(?ms)cannot perform the following tasks:
+- Perform factory reset of the system \(cannot perform factory reset: The horror, The horror\)`)
+	// no restart request on failure
+	c.Check(s.restartRequests, HasLen, 0)
+}
+
+func (s *deviceMgrInstallModeSuite) TestFactoryResetNotInFactoryResetModeNoChg(c *C) {
+	restore := release.MockOnClassic(false)
+	defer restore()
+
+	s.state.Lock()
+	devicestate.SetSystemMode(s.mgr, "run")
+	s.state.Unlock()
+
+	s.settle(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(s.findFactoryReset(), IsNil)
+}
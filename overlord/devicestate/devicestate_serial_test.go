@@ -21,6 +21,7 @@ package devicestate_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -2013,3 +2014,98 @@ func (s *deviceMgrSerialSuite) TestFullDeviceRegistrationUC20Happy(c *C) {
 	})
 	c.Assert(err, IsNil)
 }
+
+func (s *deviceMgrSerialSuite) TestDeviceRegistrationUC20RestoredAfterFactoryReset(c *C) {
+	defer sysdb.InjectTrusted([]asserts.Assertion{s.storeSigning.TrustedKey})()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	model := s.makeModelAssertionInState(c, "canonical", "pc-20", map[string]interface{}{
+		"architecture": "amd64",
+		// UC20
+		"base": "core20",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              snaptest.AssertedSnapID("oc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc",
+				"id":              snaptest.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
+
+	// the state after the factory reset
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc-20",
+	})
+	devicestate.SetSaveAvailable(s.mgr, true)
+	c.Assert(os.MkdirAll(dirs.SnapDeviceDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapDeviceDir, "factory-reset"), nil, 0644), IsNil)
+
+	// ubuntu-save has the device key and the serial
+	c.Assert(devicestate.KeypairManager(s.mgr).Put(devKey), IsNil)
+	encDevKey, err := asserts.EncodePublicKey(devKey.PublicKey())
+	c.Assert(err, IsNil)
+	serial, err := s.storeSigning.Sign(asserts.SerialType, map[string]interface{}{
+		"brand-id":            "canonical",
+		"model":               "pc-20",
+		"serial":              "8989",
+		"device-key":          string(encDevKey),
+		"device-key-sha3-384": devKey.PublicKey().ID(),
+		"timestamp":           time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	savedb, err := sysdb.OpenAt(dirs.SnapDeviceSaveDir)
+	c.Assert(err, IsNil)
+	retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+		return ref.Resolve(s.storeSigning.Find)
+	}
+	b := asserts.NewBatch(nil)
+	err = b.Fetch(savedb, retrieve, func(f asserts.Fetcher) error {
+		if err := f.Save(model); err != nil {
+			return err
+		}
+		return f.Save(serial)
+	})
+	c.Assert(err, IsNil)
+	c.Assert(b.CommitTo(savedb, nil), IsNil)
+
+	// avoid full seeding
+	s.seeding()
+	devicestatetest.MockGadget(c, s.state, "pc", snap.R(2), nil)
+	s.state.Set("seeded", true)
+	// skip boot ok logic
+	devicestate.SetBootOkRan(s.mgr, true)
+
+	s.state.Unlock()
+	s.settle(c)
+	s.state.Lock()
+
+	// the device did not register again
+	c.Check(s.findBecomeOperationalChange(), IsNil)
+	device, err := devicestatetest.Device(s.state)
+	c.Assert(err, IsNil)
+	c.Check(device.Serial, Equals, "8989")
+	c.Check(device.KeyID, Equals, devKey.PublicKey().ID())
+	_, err = s.db.Find(asserts.SerialType, map[string]string{
+		"brand-id": "canonical",
+		"model":    "pc-20",
+		"serial":   "8989",
+	})
+	c.Check(err, IsNil)
+	c.Check(filepath.Join(dirs.SnapDeviceDir, "factory-reset"), testutil.FileAbsent)
+
+	select {
+	case <-s.mgr.Registered():
+	case <-time.After(5 * time.Second):
+		c.Fatal("should have been marked registered")
+	}
+}
@@ -32,6 +32,7 @@ import (
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/overlord/storecontext"
+	"github.com/snapcore/snapd/secboot"
 	"github.com/snapcore/snapd/sysconfig"
 	"github.com/snapcore/snapd/timings"
 )
@@ -272,6 +273,30 @@ func MockInstallRun(f func(model gadget.Model, gadgetRoot, device string, option
 	}
 }
 
+func MockInstallFactoryReset(f func(model gadget.Model, gadgetRoot, device string, options install.Options, observer gadget.ContentObserver) (*install.InstalledSystemSideData, error)) (restore func()) {
+	old := installFactoryReset
+	installFactoryReset = f
+	return func() {
+		installFactoryReset = old
+	}
+}
+
+func MockBootMakeBootableAfterDataReset(f func(model *asserts.Model, rootdir string, bootWith *boot.BootableSet, seal *boot.TrustedAssetsInstallObserver) error) (restore func()) {
+	old := bootMakeBootableAfterDataReset
+	bootMakeBootableAfterDataReset = f
+	return func() {
+		bootMakeBootableAfterDataReset = old
+	}
+}
+
+func MockSecbootDiskUnlockKeyFromKernel(f func(devicePath string) (secboot.EncryptionKey, error)) (restore func()) {
+	old := secbootDiskUnlockKeyFromKernel
+	secbootDiskUnlockKeyFromKernel = f
+	return func() {
+		secbootDiskUnlockKeyFromKernel = old
+	}
+}
+
 func MockCloudInitStatus(f func() (sysconfig.CloudInitState, error)) (restore func()) {
 	old := cloudInitStatus
 	cloudInitStatus = f
@@ -303,3 +328,59 @@ func DeviceManagerCheckEncryption(mgr *DeviceManager, st *state.State, deviceCtx
 func DeviceManagerCheckFDEFeatures(mgr *DeviceManager, st *state.State) error {
 	return mgr.checkFDEFeatures(st)
 }
+
+func MockBootSetTryRecoverySystem(f func(dev boot.Device, systemLabel string) error) (restore func()) {
+	old := bootSetTryRecoverySystem
+	bootSetTryRecoverySystem = f
+	return func() {
+		bootSetTryRecoverySystem = old
+	}
+}
+
+func MockBootInspectTryRecoverySystemOutcome(f func(dev boot.Device) (boot.TryRecoverySystemOutcome, string, error)) (restore func()) {
+	old := bootInspectTryRecoverySystemOutcome
+	bootInspectTryRecoverySystemOutcome = f
+	return func() {
+		bootInspectTryRecoverySystemOutcome = old
+	}
+}
+
+func MockBootClearTryRecoverySystem(f func(dev boot.Device, systemLabel string, dropSystem bool) error) (restore func()) {
+	old := bootClearTryRecoverySystem
+	bootClearTryRecoverySystem = f
+	return func() {
+		bootClearTryRecoverySystem = old
+	}
+}
+
+func MockSecbootAddRecoveryKey(f func(key secboot.EncryptionKey, rkey secboot.RecoveryKey, node string) error) (restore func()) {
+	old := secbootAddRecoveryKey
+	secbootAddRecoveryKey = f
+	return func() {
+		secbootAddRecoveryKey = old
+	}
+}
+
+func MockSecbootAddRecoveryKeyUsingRecoveryKey(f func(existing, rkey secboot.RecoveryKey, node string) error) (restore func()) {
+	old := secbootAddRecoveryKeyUsingRecoveryKey
+	secbootAddRecoveryKeyUsingRecoveryKey = f
+	return func() {
+		secbootAddRecoveryKeyUsingRecoveryKey = old
+	}
+}
+
+func MockSecbootRemoveRecoveryKey(f func(rkey secboot.RecoveryKey, node string) error) (restore func()) {
+	old := secbootRemoveRecoveryKey
+	secbootRemoveRecoveryKey = f
+	return func() {
+		secbootRemoveRecoveryKey = old
+	}
+}
+
+func MockBootSetExtraKernelCommandLine(f func(dev boot.Device, extraArgs string) (bool, error)) (restore func()) {
+	old := bootSetExtraKernelCommandLine
+	bootSetExtraKernelCommandLine = f
+	return func() {
+		bootSetExtraKernelCommandLine = old
+	}
+}
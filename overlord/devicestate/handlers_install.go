@@ -21,9 +21,12 @@ package devicestate
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"golang.org/x/xerrors"
 	"gopkg.in/tomb.v2"
 
 	"github.com/snapcore/snapd/asserts"
@@ -33,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/gadget/install"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/disks"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/randutil"
@@ -41,8 +45,11 @@ import (
 )
 
 var (
-	bootMakeBootable = boot.MakeBootable
-	installRun       = install.Run
+	bootMakeBootable               = boot.MakeBootable
+	bootMakeBootableAfterDataReset = boot.MakeBootableAfterDataReset
+	installRun                     = install.Run
+	installFactoryReset            = install.FactoryReset
+	secbootDiskUnlockKeyFromKernel = secboot.DiskUnlockKeyFromKernel
 
 	sysconfigConfigureTargetSystem = sysconfig.ConfigureTargetSystem
 )
@@ -134,6 +141,25 @@ func (m *DeviceManager) doSetupRunSystem(t *state.Task, _ *tomb.Tomb) error {
 
 	model := deviceCtx.Model()
 
+	var installAuth string
+	protection := model.StorageProtection()
+	if useEncryption && (protection == asserts.StorageProtectionTPMPIN || protection == asserts.StorageProtectionPassphrase) {
+		// the passphrase or PIN must not be left around on
+		// ubuntu-seed, whatever the outcome of the install
+		defer func() {
+			if err := removeInstallAuth(); err != nil && !os.IsNotExist(err) {
+				logger.Noticef("cannot remove install authentication file: %v", err)
+			}
+		}()
+		installAuth, err = readInstallAuth(protection)
+		if err != nil {
+			return err
+		}
+		if protection == asserts.StorageProtectionPassphrase {
+			bopts.Passphrase = installAuth
+		}
+	}
+
 	// make sure that gadget is usable for the set up we want to use it in
 	validationConstraints := gadget.ValidationConstraints{
 		EncryptedData: useEncryption,
@@ -184,6 +210,9 @@ func (m *DeviceManager) doSetupRunSystem(t *state.Task, _ *tomb.Tomb) error {
 
 		// make note of the encryption keys
 		trustedInstallObserver.ChosenEncryptionKeys(dataKeySet.Key, saveKeySet.Key)
+		if protection == asserts.StorageProtectionTPMPIN {
+			trustedInstallObserver.ChosenPIN(installAuth)
+		}
 
 		// keep track of recovery assets
 		if err := trustedInstallObserver.ObserveExistingTrustedRecoveryAssets(boot.InitramfsUbuntuSeedDir); err != nil {
@@ -232,10 +261,22 @@ func (m *DeviceManager) doSetupRunSystem(t *state.Task, _ *tomb.Tomb) error {
 		UnpackedGadgetDir: gadgetDir,
 	}
 	rootdir := dirs.GlobalRootDir
-	if err := bootMakeBootable(deviceCtx.Model(), rootdir, bootWith, trustedInstallObserver); err != nil {
+	sealer := trustedInstallObserver
+	if protection == asserts.StorageProtectionPassphrase {
+		// the keys are not sealed, the encrypted partitions are
+		// unlocked with the passphrase on boot instead
+		sealer = nil
+	}
+	if err := bootMakeBootable(deviceCtx.Model(), rootdir, bootWith, sealer); err != nil {
 		return fmt.Errorf("cannot make run system bootable: %v", err)
 	}
 
+	// do not restart into the run system unless the passphrase or PIN
+	// is gone from ubuntu-seed
+	if err := removeInstallAuth(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove install authentication file: %v", err)
+	}
+
 	// request a restart as the last action after a successful install
 	logger.Noticef("request system restart")
 	st.RequestRestart(state.RestartSystemNow)
@@ -243,6 +284,298 @@ func (m *DeviceManager) doSetupRunSystem(t *state.Task, _ *tomb.Tomb) error {
 	return nil
 }
 
+// encryptedSavePartition returns the partition device of the encrypted
+// ubuntu-save partition of the disk holding ubuntu-seed, or an empty
+// string if ubuntu-save is not encrypted.
+func encryptedSavePartition() (string, error) {
+	disk, err := disks.DiskFromMountPoint(boot.InitramfsUbuntuSeedDir, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot find the disk of ubuntu-seed: %v", err)
+	}
+	partUUID, err := disk.FindMatchingPartitionUUIDWithFsLabel("ubuntu-save-enc")
+	if err != nil {
+		var errNotFound disks.PartitionNotFoundError
+		if xerrors.As(err, &errNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("cannot find the encrypted ubuntu-save partition: %v", err)
+	}
+	return filepath.Join("/dev/disk/by-partuuid", partUUID), nil
+}
+
+func (m *DeviceManager) doFactoryResetRunSystem(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	perfTimings := state.TimingsForTask(t)
+	defer perfTimings.Save(st)
+
+	deviceCtx, err := DeviceCtx(st, t, nil)
+	if err != nil {
+		return fmt.Errorf("cannot get device context: %v", err)
+	}
+	gadgetInfo, err := snapstate.GadgetInfo(st, deviceCtx)
+	if err != nil {
+		return fmt.Errorf("cannot get gadget info: %v", err)
+	}
+	gadgetDir := gadgetInfo.MountDir()
+
+	kernelInfo, err := snapstate.KernelInfo(st, deviceCtx)
+	if err != nil {
+		return fmt.Errorf("cannot get kernel info: %v", err)
+	}
+
+	modeEnv, err := maybeReadModeenv()
+	if err != nil {
+		return err
+	}
+	if modeEnv == nil {
+		return fmt.Errorf("missing modeenv, cannot proceed")
+	}
+
+	model := deviceCtx.Model()
+
+	// the system keeps using the encryption of ubuntu-save, which
+	// has been unlocked with the fallback key by snap-bootstrap
+	savePart, err := encryptedSavePartition()
+	if err != nil {
+		return err
+	}
+	useEncryption := savePart != ""
+	var installAuth string
+	protection := model.StorageProtection()
+	if useEncryption {
+		// Systems encrypted using the kernel fde-setup hook or
+		// protected with a passphrase cannot be reset: the ubuntu-save
+		// key is obtained from the kernel keyring, where it is only
+		// placed when snap-bootstrap unlocked ubuntu-save with a key
+		// sealed to the TPM.
+		if hasFDESetupHookInKernel(kernelInfo) {
+			return fmt.Errorf("cannot perform factory reset of a system encrypted using the kernel fde-setup hook")
+		}
+		switch protection {
+		case asserts.StorageProtectionPassphrase:
+			return fmt.Errorf("cannot perform factory reset of a system with storage-protection %q", protection)
+		case asserts.StorageProtectionTPMPIN:
+			// the new keys are protected with a new PIN, provided
+			// like at install time
+			defer func() {
+				if err := removeInstallAuth(); err != nil && !os.IsNotExist(err) {
+					logger.Noticef("cannot remove install authentication file: %v", err)
+				}
+			}()
+			installAuth, err = readInstallAuth(protection)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// make sure that gadget is usable for the set up we want to use it in
+	validationConstraints := gadget.ValidationConstraints{
+		EncryptedData: useEncryption,
+	}
+	ginfo, err := gadget.ReadInfoAndValidate(gadgetDir, model, &validationConstraints)
+	if err != nil {
+		return fmt.Errorf("cannot use gadget: %v", err)
+	}
+	if err := gadget.ValidateContent(ginfo, gadgetDir); err != nil {
+		return fmt.Errorf("cannot use gadget: %v", err)
+	}
+
+	var trustedInstallObserver *boot.TrustedAssetsInstallObserver
+	// get a nice nil interface by default
+	var installObserver gadget.ContentObserver
+	trustedInstallObserver, err = boot.TrustedAssetsInstallObserverForModel(model, gadgetDir, useEncryption)
+	if err != nil && err != boot.ErrObserverNotApplicable {
+		return fmt.Errorf("cannot setup asset install observer: %v", err)
+	}
+	if err == nil {
+		installObserver = trustedInstallObserver
+		if !useEncryption {
+			// there will be no key sealing, so past the
+			// installation pass no other methods need to be called
+			trustedInstallObserver = nil
+		}
+	}
+
+	bopts := install.Options{
+		Mount:   true,
+		Encrypt: useEncryption,
+	}
+	var installedSystem *install.InstalledSystemSideData
+	logger.Noticef("recreate and deploy ubuntu-boot and ubuntu-data partitions")
+	func() {
+		st.Unlock()
+		defer st.Lock()
+		installedSystem, err = installFactoryReset(model, gadgetDir, "", bopts, installObserver)
+	}()
+	if err != nil {
+		return fmt.Errorf("cannot perform factory reset: %v", err)
+	}
+
+	if trustedInstallObserver != nil {
+		// sanity check
+		if installedSystem.KeysForRoles == nil || installedSystem.KeysForRoles[gadget.SystemData] == nil {
+			return fmt.Errorf("internal error: system encryption keys are unset")
+		}
+		dataKeySet := installedSystem.KeysForRoles[gadget.SystemData]
+
+		saveKey, err := secbootDiskUnlockKeyFromKernel(savePart)
+		if err != nil {
+			return fmt.Errorf("cannot obtain the ubuntu-save key: %v", err)
+		}
+		// the reinstall key stored in the previous ubuntu-data is gone
+		// with it, replace it with a new one in ubuntu-save
+		prevReinstallKey, err := previousReinstallKey()
+		if err != nil {
+			return err
+		}
+		reinstallKey, err := secboot.NewRecoveryKey()
+		if err != nil {
+			return fmt.Errorf("cannot create reinstall key: %v", err)
+		}
+		if err := secbootAddRecoveryKey(saveKey, reinstallKey, savePart); err != nil {
+			return fmt.Errorf("cannot add reinstall key to ubuntu-save: %v", err)
+		}
+		// record the new key before the previous one is removed, a
+		// reset interrupted in between can then be performed again
+		if err := reinstallKey.Save(saveReinstallKeyFile()); err != nil {
+			return fmt.Errorf("cannot store reinstall key: %v", err)
+		}
+		if prevReinstallKey != nil {
+			if err := secbootRemoveRecoveryKey(*prevReinstallKey, savePart); err != nil {
+				return fmt.Errorf("cannot remove previous reinstall key from ubuntu-save: %v", err)
+			}
+		}
+		// the recovery key of ubuntu-data is gone as well, it was
+		// also added to ubuntu-save if it was rotated
+		if err := removeSaveRecoveryKey(savePart); err != nil {
+			return err
+		}
+		installedSystem.KeysForRoles[gadget.SystemSave] = &install.EncryptionKeySet{
+			Key:         saveKey,
+			RecoveryKey: reinstallKey,
+		}
+
+		// make note of the encryption keys
+		trustedInstallObserver.ChosenEncryptionKeys(dataKeySet.Key, saveKey)
+		if protection == asserts.StorageProtectionTPMPIN {
+			trustedInstallObserver.ChosenPIN(installAuth)
+		}
+
+		// keep track of recovery assets
+		if err := trustedInstallObserver.ObserveExistingTrustedRecoveryAssets(boot.InitramfsUbuntuSeedDir); err != nil {
+			return fmt.Errorf("cannot observe existing trusted recovery assets: %v", err)
+		}
+		if err := saveKeys(installedSystem.KeysForRoles); err != nil {
+			return err
+		}
+		// write markers containing a secret to pair data and save
+		if err := writeMarkers(); err != nil {
+			return err
+		}
+	}
+
+	// the serial is restored from ubuntu-save on the first boot of the
+	// run system
+	if err := writeFactoryResetMarker(); err != nil {
+		return err
+	}
+
+	// keep track of the model we installed
+	err = os.MkdirAll(filepath.Join(boot.InitramfsUbuntuBootDir, "device"), 0755)
+	if err != nil {
+		return fmt.Errorf("cannot store the model: %v", err)
+	}
+	err = writeModel(model, filepath.Join(boot.InitramfsUbuntuBootDir, "device/model"))
+	if err != nil {
+		return fmt.Errorf("cannot store the model: %v", err)
+	}
+
+	// configure the run system
+	opts := &sysconfig.Options{TargetRootDir: boot.InstallHostWritableDir, GadgetDir: gadgetDir}
+	// configure cloud init
+	setSysconfigCloudOptions(opts, gadgetDir, model)
+	if err := sysconfigConfigureTargetSystem(opts); err != nil {
+		return err
+	}
+
+	// make it bootable
+	logger.Noticef("make system bootable")
+	bootBaseInfo, err := snapstate.BootBaseInfo(st, deviceCtx)
+	if err != nil {
+		return fmt.Errorf("cannot get boot base info: %v", err)
+	}
+	recoverySystemDir := filepath.Join("/systems", modeEnv.RecoverySystem)
+	bootWith := &boot.BootableSet{
+		Base:              bootBaseInfo,
+		BasePath:          bootBaseInfo.MountFile(),
+		Kernel:            kernelInfo,
+		KernelPath:        kernelInfo.MountFile(),
+		RecoverySystemDir: recoverySystemDir,
+		UnpackedGadgetDir: gadgetDir,
+	}
+	if err := bootMakeBootableAfterDataReset(model, dirs.GlobalRootDir, bootWith, trustedInstallObserver); err != nil {
+		return fmt.Errorf("cannot make run system bootable: %v", err)
+	}
+
+	// do not restart into the run system unless the PIN is gone from
+	// ubuntu-seed
+	if err := removeInstallAuth(); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove install authentication file: %v", err)
+	}
+
+	// request a restart as the last action after a successful reset
+	logger.Noticef("request system restart")
+	st.RequestRestart(state.RestartSystemNow)
+
+	return nil
+}
+
+// previousReinstallKey returns the reinstall key of the previous install
+// or factory reset, as kept in ubuntu-save, or nil if it is not known.
+func previousReinstallKey() (*secboot.RecoveryKey, error) {
+	if !osutil.FileExists(saveReinstallKeyFile()) {
+		// installed before the reinstall key was kept in ubuntu-save
+		logger.Noticef("previous reinstall key is unknown, it will be kept in ubuntu-save")
+		return nil, nil
+	}
+	key, err := secboot.RecoveryKeyFromFile(saveReinstallKeyFile())
+	if err != nil {
+		return nil, fmt.Errorf("cannot read previous reinstall key: %v", err)
+	}
+	return key, nil
+}
+
+// removeSaveRecoveryKey removes the recovery key that was added to
+// ubuntu-save when it was rotated, as recorded in ubuntu-save.
+func removeSaveRecoveryKey(savePart string) error {
+	keyFile := saveRecoveryKeyFile(boot.InstallHostFDESaveDir)
+	if !osutil.FileExists(keyFile) {
+		return nil
+	}
+	key, err := secboot.RecoveryKeyFromFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot read previous recovery key: %v", err)
+	}
+	if err := secbootRemoveRecoveryKey(*key, savePart); err != nil {
+		return fmt.Errorf("cannot remove previous recovery key from ubuntu-save: %v", err)
+	}
+	return os.Remove(keyFile)
+}
+
+// writeFactoryResetMarker writes the marker of a factory reset to the new
+// ubuntu-data.
+func writeFactoryResetMarker() error {
+	marker := filepath.Join(dirs.SnapDeviceDirUnder(boot.InstallHostWritableDir), "factory-reset")
+	if err := os.MkdirAll(filepath.Dir(marker), 0755); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(marker, nil, 0644, 0)
+}
+
 // writeMarkers writes markers containing the same secret to pair data and save.
 func writeMarkers() error {
 	// ensure directory for markers exists
@@ -301,9 +634,70 @@ func saveKeys(keysForRoles map[string]*install.EncryptionKeySet) error {
 	if err := saveKeySet.RecoveryKey.Save(reinstallSaveKey); err != nil {
 		return fmt.Errorf("cannot store reinstall key: %v", err)
 	}
+	// keep a copy in ubuntu-save, which outlives ubuntu-data, so that
+	// the key can be removed when it is replaced on factory reset
+	if err := saveKeySet.RecoveryKey.Save(saveReinstallKeyFile()); err != nil {
+		return fmt.Errorf("cannot store reinstall key: %v", err)
+	}
 	return nil
 }
 
+func saveReinstallKeyFile() string {
+	return filepath.Join(boot.InstallHostFDESaveDir, "reinstall.key")
+}
+
+// installAuthFile is the file with the passphrase or PIN of the encrypted
+// storage. It is written in plain text to ubuntu-seed by whoever prepares
+// the device: along with the image before the first boot in install mode,
+// or before rebooting into factory-reset mode. It is removed as soon as
+// the install or the reset is over.
+func installAuthFile() string {
+	return filepath.Join(boot.InitramfsSeedEncryptionKeyDir, "install-auth")
+}
+
+// removeInstallAuth overwrites the contents of the install authentication
+// file before removing it, so that the secret is not left in the free
+// blocks of ubuntu-seed.
+func removeInstallAuth() error {
+	f, err := os.OpenFile(installAuthFile(), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err == nil {
+		_, err = f.Write(make([]byte, st.Size()))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot overwrite: %v", err)
+	}
+	return os.Remove(installAuthFile())
+}
+
+// readInstallAuth reads the passphrase or PIN protecting the encrypted
+// storage, as required by the storage-protection of the model. It is
+// provided in the install-auth file on ubuntu-seed.
+func readInstallAuth(protection asserts.StorageProtection) (string, error) {
+	data, err := ioutil.ReadFile(installAuthFile())
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("cannot read install authentication file: %v", err)
+	}
+	auth := strings.TrimSuffix(string(data), "\n")
+	if auth == "" {
+		what := "passphrase"
+		if protection == asserts.StorageProtectionTPMPIN {
+			what = "PIN"
+		}
+		return "", fmt.Errorf("cannot install system with storage-protection %q: no %s provided", protection, what)
+	}
+	return auth, nil
+}
+
 var secbootCheckKeySealingSupported = secboot.CheckKeySealingSupported
 
 // checkEncryption verifies whether encryption should be used based on the
@@ -329,6 +723,12 @@ func (m *DeviceManager) checkEncryption(st *state.State, deviceCtx snapstate.Dev
 		return false, nil
 	}
 
+	// with a passphrase the encrypted storage is unlocked by the user on
+	// boot, the keys are not sealed
+	if model.StorageProtection() == asserts.StorageProtectionPassphrase {
+		return true, nil
+	}
+
 	// check if encryption is available
 	var (
 		hasFDESetupHook    bool
@@ -337,6 +737,9 @@ func (m *DeviceManager) checkEncryption(st *state.State, deviceCtx snapstate.Dev
 	if kernelInfo, err := snapstate.KernelInfo(st, deviceCtx); err == nil {
 		if hasFDESetupHook = hasFDESetupHookInKernel(kernelInfo); hasFDESetupHook {
 			checkEncryptionErr = m.checkFDEFeatures(st)
+			if checkEncryptionErr == nil && model.StorageProtection() == asserts.StorageProtectionTPMPIN {
+				checkEncryptionErr = fmt.Errorf("the kernel fde-setup hook does not support storage-protection %q", asserts.StorageProtectionTPMPIN)
+			}
 		}
 	}
 	// Note that having a fde-setup hook will disable the build-in
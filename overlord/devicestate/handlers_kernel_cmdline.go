@@ -0,0 +1,124 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate
+
+import (
+	"fmt"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+var bootSetExtraKernelCommandLine = boot.SetExtraKernelCommandLine
+
+// ensureKernelCmdlineAppend applies the system.kernel.cmdline-append option
+// once its new value is committed, with a change of its own.
+func (m *DeviceManager) ensureKernelCmdlineAppend() error {
+	m.state.Lock()
+	defer m.state.Unlock()
+
+	if m.SystemMode() != "run" {
+		return nil
+	}
+	var seeded bool
+	if err := m.state.Get("seeded", &seeded); err != nil && err != state.ErrNoState {
+		return err
+	}
+	if !seeded {
+		return nil
+	}
+
+	tr := config.NewTransaction(m.state)
+	var value string
+	if err := tr.GetMaybe("core", "system.kernel.cmdline-append", &value); err != nil {
+		return err
+	}
+	// the value of the last update, which is not retried if it failed
+	var applied string
+	if err := m.state.Get("kernel-cmdline-append", &applied); err != nil && err != state.ErrNoState {
+		return err
+	}
+	if value == applied {
+		return nil
+	}
+	if m.changeInFlight("update-kernel-cmdline") {
+		return nil
+	}
+
+	t := m.state.NewTask("update-kernel-cmdline-append", fmt.Sprintf(i18n.G("Append %q to the kernel command line"), value))
+	t.Set("cmdline-append", value)
+	t.Set("previous-cmdline-append", applied)
+	chg := m.state.NewChange("update-kernel-cmdline", i18n.G("Update the kernel command line"))
+	chg.AddTask(t)
+	m.state.Set("kernel-cmdline-append", value)
+	m.state.EnsureBefore(0)
+	return nil
+}
+
+// setKernelCmdlineAppend sets the arguments appended to the kernel command
+// line, as found in the task under the given key. It returns whether a
+// restart is needed for them to take effect.
+func setKernelCmdlineAppend(t *state.Task, key string) (needsReboot bool, err error) {
+	var value string
+	if err := t.Get(key, &value); err != nil {
+		return false, err
+	}
+	deviceCtx, err := DeviceCtx(t.State(), t, nil)
+	if err != nil {
+		return false, err
+	}
+	needsReboot, err = bootSetExtraKernelCommandLine(deviceCtx, value)
+	if err != nil {
+		return false, fmt.Errorf("cannot set kernel command line arguments: %v", err)
+	}
+	return needsReboot, nil
+}
+
+func (m *DeviceManager) doUpdateKernelCmdlineAppend(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	needsReboot, err := setKernelCmdlineAppend(t, "cmdline-append")
+	if err != nil || !needsReboot {
+		return err
+	}
+	t.SetStatus(state.DoneStatus)
+	st.RequestRestart(state.RestartSystem)
+	return nil
+}
+
+func (m *DeviceManager) undoUpdateKernelCmdlineAppend(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	needsReboot, err := setKernelCmdlineAppend(t, "previous-cmdline-append")
+	if err != nil || !needsReboot {
+		return err
+	}
+	t.SetStatus(state.UndoneStatus)
+	st.RequestRestart(state.RestartSystem)
+	return nil
+}
@@ -0,0 +1,214 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate_test
+
+import (
+	"errors"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/devicestate/devicestatetest"
+	"github.com/snapcore/snapd/overlord/state"
+)
+
+type kernelCmdlineSuite struct {
+	deviceMgrBaseSuite
+
+	setArgs     []string
+	needsReboot bool
+	setErr      error
+}
+
+var _ = Suite(&kernelCmdlineSuite{})
+
+func (s *kernelCmdlineSuite) SetUpTest(c *C) {
+	s.deviceMgrBaseSuite.SetUpTest(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.state.Set("seeded", true)
+	s.makeModelAssertionInState(c, "my-brand", "pc-20", map[string]interface{}{
+		"architecture": "amd64",
+		"grade":        "dangerous",
+		"base":         "core20",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              pcKernelSnapID,
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc",
+				"id":              pcSnapID,
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand:  "my-brand",
+		Model:  "pc-20",
+		Serial: "serialserialserial",
+	})
+
+	s.setArgs = nil
+	s.needsReboot = true
+	s.setErr = nil
+	s.AddCleanup(devicestate.MockBootSetExtraKernelCommandLine(func(dev boot.Device, extraArgs string) (bool, error) {
+		c.Check(dev.Model().Model(), Equals, "pc-20")
+		s.setArgs = append(s.setArgs, extraArgs)
+		return s.needsReboot, s.setErr
+	}))
+}
+
+func (s *kernelCmdlineSuite) setOption(c *C, value string) {
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "system.kernel.cmdline-append", value), IsNil)
+	tr.Commit()
+}
+
+func (s *kernelCmdlineSuite) runEnsure(c *C) {
+	s.state.Unlock()
+	defer s.state.Lock()
+	for i := 0; i < 3; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+}
+
+func (s *kernelCmdlineSuite) findChanges() []*state.Change {
+	var chgs []*state.Change
+	for _, chg := range s.state.Changes() {
+		if chg.Kind() == "update-kernel-cmdline" {
+			chgs = append(chgs, chg)
+		}
+	}
+	return chgs
+}
+
+func (s *kernelCmdlineSuite) TestUpdateKernelCmdlineAppendHappy(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// nothing to do without the option
+	s.runEnsure(c)
+	c.Check(s.findChanges(), HasLen, 0)
+
+	s.setOption(c, "quiet console=ttyS0")
+	s.runEnsure(c)
+
+	chgs := s.findChanges()
+	c.Assert(chgs, HasLen, 1)
+	chg := chgs[0]
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	c.Check(chg.Summary(), Equals, "Update the kernel command line")
+	tsks := chg.Tasks()
+	c.Assert(tsks, HasLen, 1)
+	c.Check(tsks[0].Kind(), Equals, "update-kernel-cmdline-append")
+	c.Check(tsks[0].Summary(), Equals, `Append "quiet console=ttyS0" to the kernel command line`)
+	c.Check(s.setArgs, DeepEquals, []string{"quiet console=ttyS0"})
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem})
+
+	// the update is done once
+	s.runEnsure(c)
+	c.Check(s.findChanges(), HasLen, 1)
+
+	// and again when the option is unset
+	s.setOption(c, "")
+	s.runEnsure(c)
+	chgs = s.findChanges()
+	c.Assert(chgs, HasLen, 2)
+	c.Check(s.setArgs, DeepEquals, []string{"quiet console=ttyS0", ""})
+}
+
+func (s *kernelCmdlineSuite) TestUpdateKernelCmdlineAppendNoReboot(c *C) {
+	s.needsReboot = false
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setOption(c, "quiet")
+	s.runEnsure(c)
+
+	chgs := s.findChanges()
+	c.Assert(chgs, HasLen, 1)
+	c.Assert(chgs[0].Status(), Equals, state.DoneStatus, Commentf("%v", chgs[0].Err()))
+	c.Check(s.setArgs, DeepEquals, []string{"quiet"})
+	c.Check(s.restartRequests, HasLen, 0)
+}
+
+func (s *kernelCmdlineSuite) TestUpdateKernelCmdlineAppendError(c *C) {
+	s.setErr = errors.New("boom")
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setOption(c, "quiet")
+	s.runEnsure(c)
+
+	chgs := s.findChanges()
+	c.Assert(chgs, HasLen, 1)
+	c.Check(chgs[0].Status(), Equals, state.ErrorStatus)
+	c.Check(chgs[0].Err(), ErrorMatches, `(?s).*cannot set kernel command line arguments: boom.*`)
+	c.Check(s.restartRequests, HasLen, 0)
+
+	// a failed update is not retried until the option changes
+	s.runEnsure(c)
+	c.Check(s.findChanges(), HasLen, 1)
+}
+
+func (s *kernelCmdlineSuite) TestUpdateKernelCmdlineAppendUndo(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.setOption(c, "quiet")
+	s.runEnsure(c)
+	c.Assert(s.findChanges(), HasLen, 1)
+
+	s.setOption(c, "quiet console=ttyS0")
+	s.runEnsure(c)
+	c.Assert(s.findChanges(), HasLen, 2)
+	var chg *state.Change
+	for _, ch := range s.findChanges() {
+		if ch.Tasks()[0].Summary() == `Append "quiet console=ttyS0" to the kernel command line` {
+			chg = ch
+		}
+	}
+	c.Assert(chg, NotNil)
+	t := chg.Tasks()[0]
+	c.Assert(t.Status(), Equals, state.DoneStatus)
+
+	// have the change fail after the update
+	terr := s.state.NewTask("error-trigger", "provoking total undo")
+	terr.WaitFor(t)
+	chg.AddTask(terr)
+	s.runEnsure(c)
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(t.Status(), Equals, state.UndoneStatus)
+	// the previous arguments are restored
+	c.Check(s.setArgs, DeepEquals, []string{"quiet", "quiet console=ttyS0", "quiet"})
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystem, state.RestartSystem, state.RestartSystem})
+}
@@ -0,0 +1,412 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/disks"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/secboot"
+)
+
+var (
+	secbootAddRecoveryKey                 = secboot.AddRecoveryKey
+	secbootAddRecoveryKeyUsingRecoveryKey = secboot.AddRecoveryKeyUsingRecoveryKey
+	secbootRemoveRecoveryKey              = secboot.RemoveRecoveryKey
+)
+
+// RecoveryKeyChange is the record of the last change of the recovery key.
+type RecoveryKeyChange struct {
+	// Action is either "rotate" or "remove".
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
+	// InSave is set when the recovery key was also added to
+	// ubuntu-save.
+	InSave bool `json:"in-save,omitempty"`
+}
+
+// LastRecoveryKeyChange returns the record of the last change of the
+// recovery key, or nil if it was not changed since install.
+func LastRecoveryKeyChange(st *state.State) (*RecoveryKeyChange, error) {
+	var last RecoveryKeyChange
+	err := st.Get("recovery-key-change", &last)
+	if err == state.ErrNoState {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &last, nil
+}
+
+func recordRecoveryKeyChange(st *state.State, action string, inSave bool) {
+	logger.Noticef("Recovery key action %q performed", action)
+	st.Set("recovery-key-change", &RecoveryKeyChange{
+		Action: action,
+		Time:   timeNow(),
+		InSave: inSave,
+	})
+}
+
+func recoveryKeyFile() string {
+	return filepath.Join(dirs.SnapFDEDir, "recovery.key")
+}
+
+// saveRecoveryKeyFile is a copy of the recovery key kept in ubuntu-save
+// when the key was added there as well. Factory reset, which loses the
+// recovery key file along with ubuntu-data, uses it to remove the key from
+// ubuntu-save.
+func saveRecoveryKeyFile(saveFDEDir string) string {
+	return filepath.Join(saveFDEDir, "recovery.key")
+}
+
+// keepRecoveryKeyInSave stores a copy of the current recovery key in
+// ubuntu-save.
+func keepRecoveryKeyInSave() error {
+	key, err := secboot.RecoveryKeyFromFile(recoveryKeyFile())
+	if err != nil {
+		return err
+	}
+	if err := key.Save(saveRecoveryKeyFile(dirs.SnapFDEDirUnderSave(dirs.SnapSaveDir))); err != nil {
+		return fmt.Errorf("cannot store the recovery key in ubuntu-save: %v", err)
+	}
+	return nil
+}
+
+func saveKeyFromFile() (secboot.EncryptionKey, error) {
+	var key secboot.EncryptionKey
+	data, err := ioutil.ReadFile(filepath.Join(dirs.SnapFDEDir, "ubuntu-save.key"))
+	if err != nil {
+		return key, fmt.Errorf("cannot read ubuntu-save key: %v", err)
+	}
+	if len(data) != len(key) {
+		return key, fmt.Errorf("cannot read ubuntu-save key: unexpected size %v", len(data))
+	}
+	copy(key[:], data)
+	return key, nil
+}
+
+// encryptedPartitions returns the partition devices of the encrypted
+// ubuntu-data and, if there is one, ubuntu-save partitions.
+func encryptedPartitions() (data, save string, err error) {
+	disk, err := disks.DiskFromMountPoint(boot.InitramfsDataDir, &disks.Options{IsDecryptedDevice: true})
+	if err != nil {
+		return "", "", fmt.Errorf("cannot find the disk of ubuntu-data: %v", err)
+	}
+	partUUID, err := disk.FindMatchingPartitionUUIDWithFsLabel("ubuntu-data-enc")
+	if err != nil {
+		return "", "", fmt.Errorf("cannot find the encrypted ubuntu-data partition: %v", err)
+	}
+	data = filepath.Join("/dev/disk/by-partuuid", partUUID)
+
+	partUUID, err = disk.FindMatchingPartitionUUIDWithFsLabel("ubuntu-save-enc")
+	if err != nil {
+		var errNotFound disks.PartitionNotFoundError
+		if xerrors.As(err, &errNotFound) {
+			// no ubuntu-save
+			return data, "", nil
+		}
+		return "", "", fmt.Errorf("cannot find the encrypted ubuntu-save partition: %v", err)
+	}
+	save = filepath.Join("/dev/disk/by-partuuid", partUUID)
+	return data, save, nil
+}
+
+// newRecoveryKeyFile is where the new recovery key is kept while the
+// recovery key is being rotated, it replaces recoveryKeyFile once the
+// previous key is gone from the key slots.
+func newRecoveryKeyFile() string {
+	return filepath.Join(dirs.SnapFDEDir, "recovery.key.new")
+}
+
+// The steps of the rotation of the recovery key, the last one reached is
+// kept in the task so that a rotation interrupted by a restart is resumed.
+const (
+	rotationAdding          = "adding"
+	rotationAdded           = "added"
+	rotationRemovedFromData = "removed-from-data"
+	rotationOldRemoved      = "old-removed"
+)
+
+func (m *DeviceManager) doRotateRecoveryKey(t *state.Task, _ *tomb.Tomb) (err error) {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	// the last change is only recorded once the rotation is complete,
+	// so this is the record of the previous key
+	last, err := LastRecoveryKeyChange(st)
+	if err != nil {
+		return err
+	}
+	dataPart, savePart, err := encryptedPartitions()
+	if err != nil {
+		return err
+	}
+
+	var step string
+	if err := t.Get("recovery-key-rotation-step", &step); err != nil && err != state.ErrNoState {
+		return err
+	}
+	setStep := func(s string) {
+		step = s
+		t.Set("recovery-key-rotation-step", s)
+	}
+
+	if step == rotationOldRemoved && !osutil.FileExists(newRecoveryKeyFile()) {
+		// restarted after the new key replaced the previous one
+		if savePart != "" {
+			if err := keepRecoveryKeyInSave(); err != nil {
+				return err
+			}
+		}
+		recordRecoveryKeyChange(st, "rotate", savePart != "")
+		return nil
+	}
+
+	// the keys are kept in files only, the previous key stays in the
+	// recovery key file until the rotation is complete
+	oldKey, err := secboot.RecoveryKeyFromFile(recoveryKeyFile())
+	if err != nil {
+		return err
+	}
+	var newKey secboot.RecoveryKey
+	if step == "" {
+		newKey, err = secboot.NewRecoveryKey()
+		if err != nil {
+			return fmt.Errorf("cannot create a new recovery key: %v", err)
+		}
+		if err := newKey.Save(newRecoveryKeyFile()); err != nil {
+			return fmt.Errorf("cannot store the new recovery key: %v", err)
+		}
+	} else {
+		key, err := secboot.RecoveryKeyFromFile(newRecoveryKeyFile())
+		if err != nil {
+			return err
+		}
+		newKey = *key
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		// do not leave the new key behind in the key slots without
+		// a record of it
+		st.Unlock()
+		kept := abortRecoveryKeyRotation(step, *oldKey, newKey, dataPart, savePart)
+		st.Lock()
+		if kept {
+			if savePart != "" {
+				if err := keepRecoveryKeyInSave(); err != nil {
+					logger.Noticef("%v", err)
+				}
+			}
+			recordRecoveryKeyChange(st, "rotate", savePart != "")
+			return
+		}
+		t.Clear("recovery-key-rotation-step")
+	}()
+
+	if step == "" || step == rotationAdding {
+		resumed := step == rotationAdding
+		setStep(rotationAdding)
+
+		// changing the key slots takes a while, do it without
+		// holding the state lock
+		st.Unlock()
+		if resumed {
+			// the new key may have been added already before the
+			// restart, do not end up with an untracked key slot
+			removeRecoveryKeyBestEffort(newKey, dataPart, savePart)
+		}
+		err = addRecoveryKey(*oldKey, newKey, dataPart, savePart)
+		st.Lock()
+		if err != nil {
+			return err
+		}
+		setStep(rotationAdded)
+		t.Logf("Added a new recovery key")
+	}
+
+	// the previous key is removed from one partition at a time, as it
+	// cannot be removed again once it is gone
+	if step == rotationAdded {
+		st.Unlock()
+		err = secbootRemoveRecoveryKey(*oldKey, dataPart)
+		st.Lock()
+		if err != nil {
+			return fmt.Errorf("cannot remove the previous recovery key: ubuntu-data: %v", err)
+		}
+		setStep(rotationRemovedFromData)
+	}
+	if step == rotationRemovedFromData {
+		// the recovery key generated at install time is only in
+		// ubuntu-data
+		if savePart != "" && last != nil && last.InSave {
+			st.Unlock()
+			err = secbootRemoveRecoveryKey(*oldKey, savePart)
+			st.Lock()
+			if err != nil {
+				return fmt.Errorf("cannot remove the previous recovery key: ubuntu-save: %v", err)
+			}
+		}
+		setStep(rotationOldRemoved)
+	}
+
+	// the recovery key file is replaced only once the previous key is
+	// gone from the key slots
+	if err := os.Rename(newRecoveryKeyFile(), recoveryKeyFile()); err != nil {
+		return fmt.Errorf("cannot store the new recovery key: %v", err)
+	}
+	if savePart != "" {
+		if err := keepRecoveryKeyInSave(); err != nil {
+			return err
+		}
+	}
+	recordRecoveryKeyChange(st, "rotate", savePart != "")
+	return nil
+}
+
+// abortRecoveryKeyRotation undoes the rotation of the recovery key that
+// failed after reaching the given step. If the previous key cannot be put
+// back, the new key is kept in its place and true is returned.
+func abortRecoveryKeyRotation(step string, oldKey, newKey secboot.RecoveryKey, dataPart, savePart string) (kept bool) {
+	switch step {
+	case rotationAdded:
+		removeRecoveryKeyBestEffort(newKey, dataPart, savePart)
+	case rotationRemovedFromData:
+		// the new key is the only recovery key of ubuntu-data
+		if err := secbootAddRecoveryKeyUsingRecoveryKey(newKey, oldKey, dataPart); err != nil {
+			logger.Noticef("cannot restore the previous recovery key, keeping the new one: %v", err)
+			if err := os.Rename(newRecoveryKeyFile(), recoveryKeyFile()); err != nil {
+				logger.Noticef("cannot store the new recovery key: %v", err)
+			}
+			return true
+		}
+		removeRecoveryKeyBestEffort(newKey, dataPart, savePart)
+	}
+	// the new key was removed from the key slots again by
+	// addRecoveryKey on failure when adding it
+	if err := os.Remove(newRecoveryKeyFile()); err != nil && !os.IsNotExist(err) {
+		logger.Noticef("cannot remove the new recovery key: %v", err)
+	}
+	return false
+}
+
+// removeRecoveryKeyBestEffort removes the recovery key from ubuntu-data and
+// ubuntu-save, if it is there.
+func removeRecoveryKeyBestEffort(key secboot.RecoveryKey, dataPart, savePart string) {
+	for _, part := range []string{dataPart, savePart} {
+		if part == "" {
+			continue
+		}
+		if err := secbootRemoveRecoveryKey(key, part); err != nil {
+			logger.Debugf("cannot remove recovery key from %s: %v", part, err)
+		}
+	}
+}
+
+// addRecoveryKey adds the new recovery key to ubuntu-data and ubuntu-save,
+// leaving the key slots unchanged on failure.
+func addRecoveryKey(oldKey, newKey secboot.RecoveryKey, dataPart, savePart string) error {
+	if err := secbootAddRecoveryKeyUsingRecoveryKey(oldKey, newKey, dataPart); err != nil {
+		return fmt.Errorf("cannot add the new recovery key to ubuntu-data: %v", err)
+	}
+	if savePart == "" {
+		return nil
+	}
+	saveKey, err := saveKeyFromFile()
+	if err == nil {
+		err = secbootAddRecoveryKey(saveKey, newKey, savePart)
+	}
+	if err != nil {
+		if rmErr := secbootRemoveRecoveryKey(newKey, dataPart); rmErr != nil {
+			logger.Noticef("cannot remove the new recovery key from ubuntu-data: %v", rmErr)
+		}
+		return fmt.Errorf("cannot add the new recovery key to ubuntu-save: %v", err)
+	}
+	return nil
+}
+
+// removeRecoveryKey removes the recovery key from ubuntu-data and, if it
+// was added there, from ubuntu-save.
+func removeRecoveryKey(key secboot.RecoveryKey, dataPart, savePart string, last *RecoveryKeyChange) error {
+	if err := secbootRemoveRecoveryKey(key, dataPart); err != nil {
+		return fmt.Errorf("ubuntu-data: %v", err)
+	}
+	// the recovery key generated at install time is only in ubuntu-data
+	if savePart == "" || last == nil || !last.InSave {
+		return nil
+	}
+	if err := secbootRemoveRecoveryKey(key, savePart); err != nil {
+		return fmt.Errorf("ubuntu-save: %v", err)
+	}
+	return nil
+}
+
+func (m *DeviceManager) doRemoveRecoveryKeys(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	last, err := LastRecoveryKeyChange(st)
+	if err != nil {
+		return err
+	}
+	key, err := secboot.RecoveryKeyFromFile(recoveryKeyFile())
+	if err != nil {
+		return err
+	}
+	dataPart, savePart, err := encryptedPartitions()
+	if err != nil {
+		return err
+	}
+
+	st.Unlock()
+	err = removeRecoveryKey(*key, dataPart, savePart, last)
+	st.Lock()
+	if err != nil {
+		return fmt.Errorf("cannot remove the recovery key: %v", err)
+	}
+
+	if err := os.Remove(recoveryKeyFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	saveRecoveryKey := saveRecoveryKeyFile(dirs.SnapFDEDirUnderSave(dirs.SnapSaveDir))
+	if err := os.Remove(saveRecoveryKey); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	recordRecoveryKeyChange(st, "remove", false)
+	t.Logf("Removed the recovery key")
+	return nil
+}
@@ -0,0 +1,607 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil/disks"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/devicestate/devicestatetest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/secboot"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type recoveryKeysSuite struct {
+	deviceMgrBaseSuite
+
+	saveKey secboot.EncryptionKey
+	rkey    secboot.RecoveryKey
+	now     time.Time
+
+	// calls records the calls to the mocked secboot helpers
+	calls []string
+	// slots tracks the recovery keys in the mocked partitions
+	slots map[string][]secboot.RecoveryKey
+}
+
+var _ = Suite(&recoveryKeysSuite{})
+
+const (
+	dataPartNode = "/dev/disk/by-partuuid/ubuntu-data-enc-partuuid"
+	savePartNode = "/dev/disk/by-partuuid/ubuntu-save-enc-partuuid"
+)
+
+func (s *recoveryKeysSuite) SetUpTest(c *C) {
+	s.deviceMgrBaseSuite.SetUpTest(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.state.Set("seeded", true)
+	s.makeModelAssertionInState(c, "my-brand", "pc-20", map[string]interface{}{
+		"architecture": "amd64",
+		"grade":        "dangerous",
+		"base":         "core20",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              pcKernelSnapID,
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc",
+				"id":              pcSnapID,
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand:  "my-brand",
+		Model:  "pc-20",
+		Serial: "serialserialserial",
+	})
+
+	for i := range s.saveKey {
+		s.saveKey[i] = byte(i)
+	}
+	c.Assert(s.saveKey.Save(filepath.Join(dirs.SnapFDEDir, "ubuntu-save.key")), IsNil)
+	s.rkey = secboot.RecoveryKey{'r', 'e', 'c', 'o', 'v', 'e', 'r', 'y', 10, 11, 12, 13, 14, 15, 16, 17}
+	c.Assert(s.rkey.Save(filepath.Join(dirs.SnapFDEDir, "recovery.key")), IsNil)
+
+	s.now = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.AddCleanup(devicestate.MockTimeNow(func() time.Time { return s.now }))
+
+	s.mockDisk(true)
+
+	// the recovery key generated at install is only in ubuntu-data
+	s.slots = map[string][]secboot.RecoveryKey{
+		dataPartNode: {s.rkey},
+		savePartNode: nil,
+	}
+	s.calls = nil
+	s.AddCleanup(devicestate.MockSecbootAddRecoveryKeyUsingRecoveryKey(func(existing, rkey secboot.RecoveryKey, node string) error {
+		s.calls = append(s.calls, "add-using-recovery-key:"+node)
+		if !s.hasKey(node, existing) {
+			return errors.New("no key available with this passphrase")
+		}
+		s.slots[node] = append(s.slots[node], rkey)
+		return nil
+	}))
+	s.AddCleanup(devicestate.MockSecbootAddRecoveryKey(func(key secboot.EncryptionKey, rkey secboot.RecoveryKey, node string) error {
+		s.calls = append(s.calls, "add:"+node)
+		c.Check(key, DeepEquals, s.saveKey)
+		s.slots[node] = append(s.slots[node], rkey)
+		return nil
+	}))
+	s.AddCleanup(devicestate.MockSecbootRemoveRecoveryKey(func(rkey secboot.RecoveryKey, node string) error {
+		s.calls = append(s.calls, "remove:"+node)
+		for i, k := range s.slots[node] {
+			if k == rkey {
+				s.slots[node] = append(s.slots[node][:i], s.slots[node][i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("no key available with this passphrase")
+	}))
+}
+
+func (s *recoveryKeysSuite) mockDisk(withSave bool) {
+	labels := map[string]string{
+		"ubuntu-data-enc": "ubuntu-data-enc-partuuid",
+	}
+	if withSave {
+		labels["ubuntu-save-enc"] = "ubuntu-save-enc-partuuid"
+	}
+	s.AddCleanup(disks.MockMountPointDisksToPartitionMapping(map[disks.Mountpoint]*disks.MockDiskMapping{
+		{Mountpoint: boot.InitramfsDataDir, IsDecryptedDevice: true}: {
+			FilesystemLabelToPartUUID: labels,
+			DiskHasPartitions:         true,
+		},
+	}))
+}
+
+func (s *recoveryKeysSuite) hasKey(node string, rkey secboot.RecoveryKey) bool {
+	for _, k := range s.slots[node] {
+		if k == rkey {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *recoveryKeysSuite) runChange(c *C) {
+	s.state.Unlock()
+	defer s.state.Lock()
+	for i := 0; i < 3; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+}
+
+func (s *recoveryKeysSuite) currentKey(c *C) secboot.RecoveryKey {
+	rkey, err := secboot.RecoveryKeyFromFile(filepath.Join(dirs.SnapFDEDir, "recovery.key"))
+	c.Assert(err, IsNil)
+	return *rkey
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyTasks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	c.Check(chg.Kind(), Equals, "rotate-recovery-key")
+	c.Check(chg.Summary(), Equals, "Rotate the recovery key")
+	tsks := chg.Tasks()
+	c.Assert(tsks, HasLen, 1)
+	c.Check(tsks[0].Kind(), Equals, "rotate-recovery-key")
+
+	// other changes of the recovery key conflict
+	_, err = devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, ErrorMatches, "cannot change the recovery key, another change of the recovery key is in progress")
+	c.Check(err, FitsTypeOf, &snapstate.ChangeConflictError{})
+	_, err = devicestate.RemoveRecoveryKeys(s.state)
+	c.Assert(err, ErrorMatches, "cannot change the recovery key, another change of the recovery key is in progress")
+}
+
+func (s *recoveryKeysSuite) TestRecoveryKeyChangeErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(os.Remove(filepath.Join(dirs.SnapFDEDir, "recovery.key")), IsNil)
+	_, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, ErrorMatches, "no recovery key available")
+	_, err = devicestate.RemoveRecoveryKeys(s.state)
+	c.Assert(err, ErrorMatches, "no recovery key available")
+
+	s.state.Unlock()
+	s.setPCModelInState(c)
+	s.state.Lock()
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc",
+	})
+	_, err = devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, ErrorMatches, "cannot change the recovery key on non UC20 devices")
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyHappy(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	last, err := devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last, IsNil)
+
+	chg, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	c.Check(s.calls, DeepEquals, []string{
+		"add-using-recovery-key:" + dataPartNode,
+		"add:" + savePartNode,
+		"remove:" + dataPartNode,
+	})
+	newKey := s.currentKey(c)
+	c.Check(newKey, Not(Equals), s.rkey)
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{newKey})
+	c.Check(s.slots[savePartNode], DeepEquals, []secboot.RecoveryKey{newKey})
+	s.checkNoKeysInTask(c, chg)
+	st, err := os.Stat(filepath.Join(dirs.SnapFDEDir, "recovery.key"))
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+	// a copy is kept in ubuntu-save for factory reset
+	c.Check(filepath.Join(dirs.SnapSaveDir, "device/fde/recovery.key"), testutil.FileEquals, newKey[:])
+
+	last, err = devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last, DeepEquals, &devicestate.RecoveryKeyChange{
+		Action: "rotate",
+		Time:   s.now,
+		InSave: true,
+	})
+
+	// rotating again removes the previous key from ubuntu-save too
+	s.calls = nil
+	chg, err = devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	c.Check(s.calls, DeepEquals, []string{
+		"add-using-recovery-key:" + dataPartNode,
+		"add:" + savePartNode,
+		"remove:" + dataPartNode,
+		"remove:" + savePartNode,
+	})
+	newerKey := s.currentKey(c)
+	c.Check(newerKey, Not(Equals), newKey)
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{newerKey})
+	c.Check(s.slots[savePartNode], DeepEquals, []secboot.RecoveryKey{newerKey})
+	c.Check(filepath.Join(dirs.SnapSaveDir, "device/fde/recovery.key"), testutil.FileEquals, newerKey[:])
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyNoSave(c *C) {
+	s.mockDisk(false)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	c.Check(s.calls, DeepEquals, []string{
+		"add-using-recovery-key:" + dataPartNode,
+		"remove:" + dataPartNode,
+	})
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{s.currentKey(c)})
+	c.Check(filepath.Join(dirs.SnapSaveDir, "device/fde/recovery.key"), testutil.FileAbsent)
+
+	last, err := devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last, DeepEquals, &devicestate.RecoveryKeyChange{
+		Action: "rotate",
+		Time:   s.now,
+	})
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeySaveError(c *C) {
+	s.AddCleanup(devicestate.MockSecbootAddRecoveryKey(func(key secboot.EncryptionKey, rkey secboot.RecoveryKey, node string) error {
+		s.calls = append(s.calls, "add:"+node)
+		return errors.New("boom")
+	}))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot add the new recovery key to ubuntu-save: boom.*`)
+
+	// the new key was removed from ubuntu-data again
+	c.Check(s.calls, DeepEquals, []string{
+		"add-using-recovery-key:" + dataPartNode,
+		"add:" + savePartNode,
+		"remove:" + dataPartNode,
+	})
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{s.rkey})
+	c.Check(s.currentKey(c), Equals, s.rkey)
+	s.checkNoKeysInTask(c, chg)
+
+	last, err := devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last, IsNil)
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyRemoveFromDataError(c *C) {
+	s.AddCleanup(devicestate.MockSecbootRemoveRecoveryKey(func(rkey secboot.RecoveryKey, node string) error {
+		s.calls = append(s.calls, "remove:"+node)
+		if rkey == s.rkey {
+			return errors.New("boom")
+		}
+		for i, k := range s.slots[node] {
+			if k == rkey {
+				s.slots[node] = append(s.slots[node][:i], s.slots[node][i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("no key available with this passphrase")
+	}))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot remove the previous recovery key: ubuntu-data: boom.*`)
+
+	// the new key was removed from the key slots again
+	c.Check(s.calls, DeepEquals, []string{
+		"add-using-recovery-key:" + dataPartNode,
+		"add:" + savePartNode,
+		"remove:" + dataPartNode,
+		"remove:" + dataPartNode,
+		"remove:" + savePartNode,
+	})
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{s.rkey})
+	c.Check(s.slots[savePartNode], HasLen, 0)
+	c.Check(s.currentKey(c), Equals, s.rkey)
+	s.checkNoKeysInTask(c, chg)
+
+	last, err := devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last, IsNil)
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyRemoveFromSaveError(c *C) {
+	s.AddCleanup(devicestate.MockSecbootRemoveRecoveryKey(func(rkey secboot.RecoveryKey, node string) error {
+		s.calls = append(s.calls, "remove:"+node)
+		if rkey == s.rkey && node == savePartNode {
+			return errors.New("boom")
+		}
+		for i, k := range s.slots[node] {
+			if k == rkey {
+				s.slots[node] = append(s.slots[node][:i], s.slots[node][i+1:]...)
+				return nil
+			}
+		}
+		return errors.New("no key available with this passphrase")
+	}))
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the previous key is in ubuntu-save too
+	s.state.Set("recovery-key-change", &devicestate.RecoveryKeyChange{
+		Action: "rotate",
+		Time:   s.now.Add(-time.Hour),
+		InSave: true,
+	})
+	s.slots[savePartNode] = []secboot.RecoveryKey{s.rkey}
+
+	chg, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot remove the previous recovery key: ubuntu-save: boom.*`)
+
+	// the previous key was put back in ubuntu-data, and the new one
+	// removed again
+	c.Check(s.calls, DeepEquals, []string{
+		"add-using-recovery-key:" + dataPartNode,
+		"add:" + savePartNode,
+		"remove:" + dataPartNode,
+		"remove:" + savePartNode,
+		"add-using-recovery-key:" + dataPartNode,
+		"remove:" + dataPartNode,
+		"remove:" + savePartNode,
+	})
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{s.rkey})
+	c.Check(s.slots[savePartNode], DeepEquals, []secboot.RecoveryKey{s.rkey})
+	c.Check(s.currentKey(c), Equals, s.rkey)
+	s.checkNoKeysInTask(c, chg)
+
+	last, err := devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last.Time, Equals, s.now.Add(-time.Hour))
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyResumeOldRemoved(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// restarted after the new key replaced the previous one in the
+	// recovery key file
+	chg := s.mockRotationInProgress(c, s.rkey, "old-removed")
+	c.Assert(os.Rename(filepath.Join(dirs.SnapFDEDir, "recovery.key.new"), filepath.Join(dirs.SnapFDEDir, "recovery.key")), IsNil)
+
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	c.Check(s.calls, HasLen, 0)
+	c.Check(s.currentKey(c), Equals, s.rkey)
+
+	last, err := devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last, DeepEquals, &devicestate.RecoveryKeyChange{
+		Action: "rotate",
+		Time:   s.now,
+		InSave: true,
+	})
+}
+
+func (s *recoveryKeysSuite) mockRotationInProgress(c *C, newKey secboot.RecoveryKey, step string) *state.Change {
+	chg, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	chg.Tasks()[0].Set("recovery-key-rotation-step", step)
+	c.Assert(newKey.Save(filepath.Join(dirs.SnapFDEDir, "recovery.key.new")), IsNil)
+	return chg
+}
+
+func (s *recoveryKeysSuite) checkNoKeysInTask(c *C, chg *state.Change) {
+	// only the step of the rotation is kept in the state
+	data, err := json.Marshal(chg.Tasks()[0])
+	c.Assert(err, IsNil)
+	var task struct {
+		Data map[string]*json.RawMessage `json:"data"`
+	}
+	c.Assert(json.Unmarshal(data, &task), IsNil)
+	for k := range task.Data {
+		c.Check(k, Equals, "recovery-key-rotation-step")
+	}
+	c.Check(filepath.Join(dirs.SnapFDEDir, "recovery.key.new"), testutil.FileAbsent)
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyResumeAdding(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// restarted after the new key was added to ubuntu-data only
+	newKey := secboot.RecoveryKey{'n', 'e', 'w', 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	s.slots[dataPartNode] = append(s.slots[dataPartNode], newKey)
+	chg := s.mockRotationInProgress(c, newKey, "adding")
+
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	c.Check(s.calls, DeepEquals, []string{
+		"remove:" + dataPartNode,
+		"remove:" + savePartNode,
+		"add-using-recovery-key:" + dataPartNode,
+		"add:" + savePartNode,
+		"remove:" + dataPartNode,
+	})
+	// no stray key slots are left
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{newKey})
+	c.Check(s.slots[savePartNode], DeepEquals, []secboot.RecoveryKey{newKey})
+	c.Check(s.currentKey(c), Equals, newKey)
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyResumeAdded(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// restarted after the new key was added, the recovery key file
+	// still has the previous key
+	newKey := secboot.RecoveryKey{'n', 'e', 'w', 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	s.slots[dataPartNode] = append(s.slots[dataPartNode], newKey)
+	s.slots[savePartNode] = append(s.slots[savePartNode], newKey)
+	chg := s.mockRotationInProgress(c, newKey, "added")
+
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	// the previous key is the one removed, not the new one
+	c.Check(s.calls, DeepEquals, []string{
+		"remove:" + dataPartNode,
+	})
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{newKey})
+	c.Check(s.slots[savePartNode], DeepEquals, []secboot.RecoveryKey{newKey})
+	c.Check(s.currentKey(c), Equals, newKey)
+
+	last, err := devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last, DeepEquals, &devicestate.RecoveryKeyChange{
+		Action: "rotate",
+		Time:   s.now,
+		InSave: true,
+	})
+}
+
+func (s *recoveryKeysSuite) TestRotateRecoveryKeyResumeRemovedFromData(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the previous key was in ubuntu-save too, and the restart happened
+	// after it was removed from ubuntu-data
+	s.state.Set("recovery-key-change", &devicestate.RecoveryKeyChange{
+		Action: "rotate",
+		Time:   s.now.Add(-time.Hour),
+		InSave: true,
+	})
+	newKey := secboot.RecoveryKey{'n', 'e', 'w', 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	s.slots[dataPartNode] = []secboot.RecoveryKey{newKey}
+	s.slots[savePartNode] = []secboot.RecoveryKey{s.rkey, newKey}
+	chg := s.mockRotationInProgress(c, newKey, "removed-from-data")
+
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	c.Check(s.calls, DeepEquals, []string{
+		"remove:" + savePartNode,
+	})
+	c.Check(s.slots[dataPartNode], DeepEquals, []secboot.RecoveryKey{newKey})
+	c.Check(s.slots[savePartNode], DeepEquals, []secboot.RecoveryKey{newKey})
+	c.Check(s.currentKey(c), Equals, newKey)
+}
+
+func (s *recoveryKeysSuite) TestRemoveRecoveryKeysHappy(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the key was rotated and is in ubuntu-save too
+	chg, err := devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, IsNil)
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	s.calls = nil
+	s.now = s.now.Add(time.Hour)
+	chg, err = devicestate.RemoveRecoveryKeys(s.state)
+	c.Assert(err, IsNil)
+	c.Check(chg.Kind(), Equals, "remove-recovery-keys")
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	c.Check(s.calls, DeepEquals, []string{
+		"remove:" + dataPartNode,
+		"remove:" + savePartNode,
+	})
+	c.Check(s.slots[dataPartNode], HasLen, 0)
+	c.Check(s.slots[savePartNode], HasLen, 0)
+	c.Check(filepath.Join(dirs.SnapFDEDir, "recovery.key"), testutil.FileAbsent)
+	c.Check(filepath.Join(dirs.SnapSaveDir, "device/fde/recovery.key"), testutil.FileAbsent)
+
+	last, err := devicestate.LastRecoveryKeyChange(s.state)
+	c.Assert(err, IsNil)
+	c.Check(last, DeepEquals, &devicestate.RecoveryKeyChange{
+		Action: "remove",
+		Time:   s.now,
+	})
+
+	// no recovery key to authorize adding a new one
+	_, err = devicestate.RotateRecoveryKey(s.state)
+	c.Assert(err, ErrorMatches, "no recovery key available")
+}
+
+func (s *recoveryKeysSuite) TestRemoveRecoveryKeysInstallKey(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.RemoveRecoveryKeys(s.state)
+	c.Assert(err, IsNil)
+	s.runChange(c)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	// the key generated at install time is only in ubuntu-data
+	c.Check(s.calls, DeepEquals, []string{
+		"remove:" + dataPartNode,
+	})
+	c.Check(filepath.Join(dirs.SnapFDEDir, "recovery.key"), testutil.FileAbsent)
+}
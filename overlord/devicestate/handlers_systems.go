@@ -0,0 +1,209 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/assertstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// recoverySystemSetup is the setup of a recovery system being created,
+// stored in the create-recovery-system task.
+type recoverySystemSetup struct {
+	// Label of the recovery system
+	Label string `json:"label"`
+	// Directory of the recovery system in the seed
+	Directory string `json:"directory"`
+	// SnapFiles are the snap files newly added to the seed for the
+	// recovery system
+	SnapFiles []string `json:"snap-files,omitempty"`
+}
+
+func taskRecoverySystemSetup(t *state.Task) (*recoverySystemSetup, error) {
+	var setup recoverySystemSetup
+
+	err := t.Get("recovery-system-setup", &setup)
+	if err == nil {
+		return &setup, nil
+	}
+	if err != state.ErrNoState {
+		return nil, err
+	}
+	// find the task which holds the setup
+	var id string
+	if err := t.Get("recovery-system-setup-task", &id); err != nil {
+		return nil, err
+	}
+	ts := t.State().Task(id)
+	if ts == nil {
+		return nil, fmt.Errorf("internal error: tasks are being pruned")
+	}
+	if err := ts.Get("recovery-system-setup", &setup); err != nil {
+		return nil, err
+	}
+	return &setup, nil
+}
+
+var (
+	bootSetTryRecoverySystem            = boot.SetTryRecoverySystem
+	bootInspectTryRecoverySystemOutcome = boot.InspectTryRecoverySystemOutcome
+	bootClearTryRecoverySystem          = boot.ClearTryRecoverySystem
+)
+
+// removeRecoverySystemFiles removes the snap files newly added to the seed
+// and the directory of the recovery system described by setup.
+func removeRecoverySystemFiles(setup *recoverySystemSetup) error {
+	for _, p := range setup.SnapFiles {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("cannot remove snap file %q: %v", p, err)
+		}
+	}
+	if setup.Directory != "" {
+		if err := os.RemoveAll(setup.Directory); err != nil {
+			return fmt.Errorf("cannot remove recovery system %q: %v", setup.Label, err)
+		}
+	}
+	return nil
+}
+
+func (m *DeviceManager) doCreateRecoverySystem(t *state.Task, _ *tomb.Tomb) (err error) {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	deviceCtx, err := DeviceCtx(st, t, nil)
+	if err != nil {
+		return err
+	}
+	setup, err := taskRecoverySystemSetup(t)
+	if err != nil {
+		return err
+	}
+	db := assertstate.DB(st)
+	getInfo := func(name string) (*snap.Info, error) {
+		st.Lock()
+		defer st.Unlock()
+		return snapstate.CurrentInfo(st, name)
+	}
+
+	// writing the seed can take a while, do it without holding the
+	// state lock
+	st.Unlock()
+	dir, newFiles, err := createSystemForModelFromValidatedSnaps(deviceCtx.Model(), setup.Label, db, getInfo)
+	st.Lock()
+	if err != nil {
+		return fmt.Errorf("cannot create a recovery system: %v", err)
+	}
+	setup.Directory = dir
+	setup.SnapFiles = newFiles
+	t.Set("recovery-system-setup", setup)
+	defer func() {
+		if err == nil {
+			return
+		}
+		// undo is not run for a task that failed in do, remove the
+		// system now so that it can be created again
+		if rmErr := removeRecoverySystemFiles(setup); rmErr != nil {
+			logger.Noticef("%v", rmErr)
+			return
+		}
+		setup.Directory = ""
+		setup.SnapFiles = nil
+		t.Set("recovery-system-setup", setup)
+	}()
+
+	if err := bootSetTryRecoverySystem(deviceCtx, setup.Label); err != nil {
+		return fmt.Errorf("cannot attempt booting into recovery system %q: %v", setup.Label, err)
+	}
+
+	t.Logf("Restarting into candidate recovery system %q", setup.Label)
+	// this task is done, the finalize task will inspect the outcome of
+	// booting into the new system
+	t.SetStatus(state.DoneStatus)
+	st.RequestRestart(state.RestartSystemNow)
+
+	return nil
+}
+
+func (m *DeviceManager) undoCreateRecoverySystem(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	deviceCtx, err := DeviceCtx(st, t, nil)
+	if err != nil {
+		return err
+	}
+	setup, err := taskRecoverySystemSetup(t)
+	if err != nil {
+		return err
+	}
+
+	if err := bootClearTryRecoverySystem(deviceCtx, setup.Label, true); err != nil {
+		return fmt.Errorf("cannot clear the recovery system %q: %v", setup.Label, err)
+	}
+	return removeRecoverySystemFiles(setup)
+}
+
+func (m *DeviceManager) doFinalizeTriedRecoverySystem(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if ok, _ := st.Restarting(); ok {
+		// don't continue until we are in the restarted snapd
+		t.Logf("Waiting for system reboot...")
+		return &state.Retry{}
+	}
+
+	deviceCtx, err := DeviceCtx(st, t, nil)
+	if err != nil {
+		return err
+	}
+	setup, err := taskRecoverySystemSetup(t)
+	if err != nil {
+		return err
+	}
+
+	outcome, label, err := bootInspectTryRecoverySystemOutcome(deviceCtx)
+	if err != nil {
+		return fmt.Errorf("cannot inspect the outcome of trying recovery system %q: %v", setup.Label, err)
+	}
+	if outcome != boot.TryRecoverySystemOutcomeSuccess || label != setup.Label {
+		// undo of create-recovery-system cleans up
+		return fmt.Errorf("cannot promote recovery system %q: system has failed to boot", setup.Label)
+	}
+
+	// keep the system in the modeenv and the boot chains
+	if err := bootClearTryRecoverySystem(deviceCtx, setup.Label, false); err != nil {
+		return fmt.Errorf("cannot promote recovery system %q: %v", setup.Label, err)
+	}
+	t.Logf("Recovery system %q was booted successfully", setup.Label)
+	return nil
+}
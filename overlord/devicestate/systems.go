@@ -21,11 +21,19 @@ package devicestate
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/boot"
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/snapstate"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/seed"
+	"github.com/snapcore/snapd/seed/seedwriter"
+	"github.com/snapcore/snapd/snap"
 )
 
 func checkSystemRequestConflict(st *state.State, systemLabel string) error {
@@ -115,8 +123,8 @@ func currentSystemForMode(st *state.State, mode string) (*currentSystem, error)
 	case "run":
 		actions = currentSystemActions
 		system, err = currentSeededSystem(st)
-	case "install":
-		// there is no current system for install mode
+	case "install", "factory-reset":
+		// there is no current system for install or factory-reset mode
 		return nil, nil
 	case "recover":
 		actions = recoverSystemActions
@@ -176,3 +184,135 @@ func seededSystemFromModeenv() (*seededSystem, error) {
 	}
 	return seededSys, nil
 }
+
+type getSnapInfoFunc func(name string) (*snap.Info, error)
+
+// createSystemForModelFromValidatedSnaps creates a new recovery system
+// with the given label for the model, under ubuntu-seed. The snaps are
+// sourced from the ones installed in the system as provided by getInfo,
+// and their assertions are taken from db. It returns the directory of
+// the new system and the list of snap files that were newly added to the
+// seed.
+func createSystemForModelFromValidatedSnaps(model *asserts.Model, label string, db asserts.RODatabase, getInfo getSnapInfoFunc) (dir string, newFiles []string, err error) {
+	if model.Grade() == asserts.ModelGradeUnset {
+		return "", nil, fmt.Errorf("cannot create a system for non UC20 model")
+	}
+
+	logger.Noticef("creating recovery system with label %q for %q", label, model.Model())
+
+	wOpts := &seedwriter.Options{
+		SeedDir: boot.InitramfsUbuntuSeedDir,
+		Label:   label,
+	}
+	w, err := seedwriter.New(model, wOpts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// optional snaps of the model are included only when they are
+	// installed
+	var optSnaps []*seedwriter.OptionsSnap
+	for _, modSnap := range model.SnapsWithoutEssential() {
+		if modSnap.Presence != "optional" {
+			continue
+		}
+		if _, err := getInfo(modSnap.SnapName()); err == nil {
+			optSnaps = append(optSnaps, &seedwriter.OptionsSnap{Name: modSnap.SnapName()})
+		}
+	}
+	if err := w.SetOptionsSnaps(optSnaps); err != nil {
+		return "", nil, err
+	}
+
+	newFetcher := func(save func(asserts.Assertion) error) asserts.Fetcher {
+		// the assertions are already in the system database
+		retrieve := func(ref *asserts.Ref) (asserts.Assertion, error) {
+			return ref.Resolve(db.Find)
+		}
+		return asserts.NewFetcher(db, retrieve, save)
+	}
+	f, err := w.Start(db, newFetcher)
+	if err != nil {
+		return "", nil, err
+	}
+	// track the files separately from the named return value, which is
+	// reset by the error returns below
+	var copiedFiles []string
+	systemDir := filepath.Join(boot.InitramfsUbuntuSeedDir, "systems", label)
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, p := range copiedFiles {
+			os.Remove(p)
+		}
+		os.RemoveAll(systemDir)
+	}()
+
+	for {
+		var toDownload []*seedwriter.SeedSnap
+		toDownload, err = w.SnapsToDownload()
+		if err != nil {
+			return "", nil, err
+		}
+
+		for _, sn := range toDownload {
+			var info *snap.Info
+			info, err = getInfo(sn.SnapName())
+			if err != nil {
+				return "", nil, err
+			}
+			if info.SnapID == "" {
+				return "", nil, fmt.Errorf("cannot create a system with unasserted snap %q", sn.SnapName())
+			}
+			if err := w.SetInfo(sn, info); err != nil {
+				return "", nil, err
+			}
+			// the snap may already be present in the seed, the
+			// snaps directory is shared between the systems
+			if !osutil.FileExists(sn.Path) {
+				if err := osutil.CopyFile(info.MountFile(), sn.Path, 0); err != nil {
+					return "", nil, fmt.Errorf("cannot copy snap %q: %v", sn.SnapName(), err)
+				}
+				copiedFiles = append(copiedFiles, sn.Path)
+			}
+
+			// fetch snap assertions
+			prev := len(f.Refs())
+			var snapRevs []asserts.Assertion
+			snapRevs, err = db.FindMany(asserts.SnapRevisionType, map[string]string{
+				"snap-id":       info.SnapID,
+				"snap-revision": info.Revision.String(),
+			})
+			if err != nil {
+				return "", nil, fmt.Errorf("cannot find snap-revision for snap %q: %v", sn.SnapName(), err)
+			}
+			if err := f.Save(snapRevs[0]); err != nil {
+				return "", nil, err
+			}
+			sn.ARefs = f.Refs()[prev:]
+		}
+
+		var complete bool
+		complete, err = w.Downloaded()
+		if err != nil {
+			return "", nil, err
+		}
+		if complete {
+			break
+		}
+	}
+
+	copySnap := func(name, src, dst string) error {
+		// all snaps were put in place already
+		return fmt.Errorf("internal error: unexpected local snap %q", name)
+	}
+	if err := w.SeedSnaps(copySnap); err != nil {
+		return "", nil, err
+	}
+	if err := w.WriteMeta(); err != nil {
+		return "", nil, err
+	}
+
+	return systemDir, copiedFiles, nil
+}
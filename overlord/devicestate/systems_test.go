@@ -0,0 +1,350 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package devicestate_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/boot"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/overlord/devicestate"
+	"github.com/snapcore/snapd/overlord/devicestate/devicestatetest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/seed"
+	"github.com/snapcore/snapd/seed/seedtest"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+	"github.com/snapcore/snapd/timings"
+)
+
+type createRecoverySystemSuite struct {
+	deviceMgrBaseSuite
+
+	ss *seedtest.SeedSnaps
+
+	tried   []string
+	cleared []string
+	dropped []string
+}
+
+var _ = Suite(&createRecoverySystemSuite{})
+
+func (s *createRecoverySystemSuite) SetUpTest(c *C) {
+	s.deviceMgrBaseSuite.SetUpTest(c)
+
+	s.AddCleanup(seed.MockTrusted(s.storeSigning.Trusted))
+
+	s.ss = &seedtest.SeedSnaps{
+		StoreSigning: s.storeSigning,
+		Brands:       s.brands,
+	}
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.state.Set("seeded", true)
+	s.makeModelAssertionInState(c, "my-brand", "pc-20", map[string]interface{}{
+		"architecture": "amd64",
+		"grade":        "dangerous",
+		"base":         "core20",
+		"snaps": []interface{}{
+			map[string]interface{}{
+				"name":            "pc-kernel",
+				"id":              s.ss.AssertedSnapID("pc-kernel"),
+				"type":            "kernel",
+				"default-channel": "20",
+			},
+			map[string]interface{}{
+				"name":            "pc",
+				"id":              s.ss.AssertedSnapID("pc"),
+				"type":            "gadget",
+				"default-channel": "20",
+			},
+		},
+	})
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand:  "my-brand",
+		Model:  "pc-20",
+		Serial: "serialserialserial",
+	})
+
+	for _, yaml := range []string{
+		"name: snapd\nversion: 1\ntype: snapd",
+		"name: pc-kernel\nversion: 1\ntype: kernel",
+		"name: core20\nversion: 1\ntype: base",
+		"name: pc\nversion: 1\ntype: gadget\nbase: core20",
+	} {
+		s.mockInstalledAssertedSnap(c, yaml)
+	}
+
+	m := &boot.Modeenv{
+		Mode:                   "run",
+		RecoverySystem:         "20200825",
+		CurrentRecoverySystems: []string{"20200825"},
+	}
+	c.Assert(m.WriteTo(""), IsNil)
+
+	s.tried = nil
+	s.cleared = nil
+	s.dropped = nil
+	s.AddCleanup(devicestate.MockBootSetTryRecoverySystem(func(dev boot.Device, label string) error {
+		c.Check(dev.HasModeenv(), Equals, true)
+		s.tried = append(s.tried, label)
+		return nil
+	}))
+	s.AddCleanup(devicestate.MockBootClearTryRecoverySystem(func(dev boot.Device, label string, dropSystem bool) error {
+		if dropSystem {
+			s.dropped = append(s.dropped, label)
+		} else {
+			s.cleared = append(s.cleared, label)
+		}
+		return nil
+	}))
+}
+
+func (s *createRecoverySystemSuite) mockInstalledAssertedSnap(c *C, snapYaml string) {
+	snapDecl, _ := s.ss.MakeAssertedSnap(c, snapYaml, nil, snap.R(1), "canonical", s.db)
+	info := s.ss.AssertedSnapInfo(snapDecl.SnapName())
+
+	si := &snap.SideInfo{
+		RealName: info.SnapName(),
+		SnapID:   info.SnapID,
+		Revision: snap.R(1),
+	}
+	snapstate.Set(s.state, info.SnapName(), &snapstate.SnapState{
+		SnapType: string(info.Type()),
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+	// the snap is mounted and its file is in place
+	mountedInfo := snaptest.MockSnap(c, snapYaml, si)
+	c.Assert(osutil.CopyFile(s.ss.AssertedSnap(info.SnapName()), mountedInfo.MountFile(), osutil.CopyFlagOverwrite), IsNil)
+}
+
+func (s *createRecoverySystemSuite) mockOutcome(outcome boot.TryRecoverySystemOutcome, label string) {
+	s.AddCleanup(devicestate.MockBootInspectTryRecoverySystemOutcome(func(dev boot.Device) (boot.TryRecoverySystemOutcome, string, error) {
+		return outcome, label, nil
+	}))
+}
+
+func (s *createRecoverySystemSuite) runUntilRestart(c *C) {
+	s.state.Unlock()
+	defer s.state.Lock()
+	for i := 0; i < 3; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+}
+
+func (s *createRecoverySystemSuite) TestCreateRecoverySystemTasks(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, IsNil)
+	c.Check(chg.Kind(), Equals, "create-recovery-system")
+	c.Check(chg.Summary(), Equals, `Create new recovery system with label "1234"`)
+	tsks := chg.Tasks()
+	c.Assert(tsks, HasLen, 2)
+	c.Check(tsks[0].Kind(), Equals, "create-recovery-system")
+	c.Check(tsks[1].Kind(), Equals, "finalize-recovery-system")
+	c.Check(tsks[1].WaitTasks(), DeepEquals, []*state.Task{tsks[0]})
+
+	// another one conflicts
+	_, err = devicestate.CreateRecoverySystem(s.state, "5678")
+	c.Assert(err, ErrorMatches, "cannot create a recovery system, another one is being created")
+	c.Check(err, FitsTypeOf, &snapstate.ChangeConflictError{})
+}
+
+func (s *createRecoverySystemSuite) TestCreateRecoverySystemErrors(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	_, err := devicestate.CreateRecoverySystem(s.state, "Invalid_Label")
+	c.Assert(err, ErrorMatches, `invalid seed system label: "Invalid_Label"`)
+
+	c.Assert(os.MkdirAll(filepath.Join(boot.InitramfsUbuntuSeedDir, "systems", "1234"), 0755), IsNil)
+	_, err = devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, ErrorMatches, `recovery system "1234" already exists`)
+}
+
+func (s *createRecoverySystemSuite) TestCreateRecoverySystemNonUC20(c *C) {
+	s.setPCModelInState(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	devicestatetest.SetDevice(s.state, &auth.DeviceState{
+		Brand: "canonical",
+		Model: "pc",
+	})
+
+	_, err := devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, ErrorMatches, "cannot create recovery systems on non UC20 devices")
+}
+
+func (s *createRecoverySystemSuite) TestCreateRecoverySystemHappy(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, IsNil)
+
+	s.runUntilRestart(c)
+
+	tsks := chg.Tasks()
+	c.Assert(tsks, HasLen, 2)
+	c.Assert(tsks[0].Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	c.Check(tsks[1].Status(), Equals, state.DoingStatus)
+	c.Check(s.restartRequests, DeepEquals, []state.RestartType{state.RestartSystemNow})
+	c.Check(s.tried, DeepEquals, []string{"1234"})
+
+	// the new system is a valid seed
+	sd, err := seed.Open(boot.InitramfsUbuntuSeedDir, "1234")
+	c.Assert(err, IsNil)
+	c.Assert(sd.LoadAssertions(nil, nil), IsNil)
+	c.Check(sd.Model().Model(), Equals, "pc-20")
+	c.Assert(sd.LoadMeta(timings.New(nil)), IsNil)
+	var names []string
+	for _, sn := range sd.EssentialSnaps() {
+		names = append(names, sn.SnapName())
+	}
+	c.Check(names, DeepEquals, []string{"snapd", "pc-kernel", "core20", "pc"})
+
+	// system rebooted into the new system and back
+	state.MockRestarting(s.state, state.RestartUnset)
+	s.mockOutcome(boot.TryRecoverySystemOutcomeSuccess, "1234")
+
+	s.runUntilRestart(c)
+
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	c.Check(s.cleared, DeepEquals, []string{"1234"})
+	c.Check(s.dropped, HasLen, 0)
+	c.Check(osutil.IsDirectory(filepath.Join(boot.InitramfsUbuntuSeedDir, "systems", "1234")), Equals, true)
+}
+
+func (s *createRecoverySystemSuite) TestCreateRecoverySystemFailedToBoot(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, IsNil)
+
+	s.runUntilRestart(c)
+	c.Assert(chg.Tasks()[0].Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	snapFile := filepath.Join(boot.InitramfsUbuntuSeedDir, "snaps", "pc_1.snap")
+	c.Check(snapFile, testutil.FilePresent)
+
+	// the candidate system did not report back
+	state.MockRestarting(s.state, state.RestartUnset)
+	s.mockOutcome(boot.TryRecoverySystemOutcomeFailure, "1234")
+
+	s.runUntilRestart(c)
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot promote recovery system "1234": system has failed to boot.*`)
+	c.Check(s.cleared, HasLen, 0)
+	c.Check(s.dropped, DeepEquals, []string{"1234"})
+	// the system and the snaps it added are gone
+	c.Check(osutil.IsDirectory(filepath.Join(boot.InitramfsUbuntuSeedDir, "systems", "1234")), Equals, false)
+	c.Check(snapFile, testutil.FileAbsent)
+}
+
+func (s *createRecoverySystemSuite) TestCreateRecoverySystemSnapsAlreadyInSeed(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the snaps dir is shared with the existing systems
+	snapFile := filepath.Join(boot.InitramfsUbuntuSeedDir, "snaps", "pc_1.snap")
+	c.Assert(os.MkdirAll(filepath.Dir(snapFile), 0755), IsNil)
+	c.Assert(osutil.CopyFile(s.ss.AssertedSnap("pc"), snapFile, 0), IsNil)
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, IsNil)
+	s.runUntilRestart(c)
+	c.Assert(chg.Tasks()[0].Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	state.MockRestarting(s.state, state.RestartUnset)
+	s.mockOutcome(boot.TryRecoverySystemOutcomeFailure, "1234")
+	s.runUntilRestart(c)
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+
+	// the snap which was already in the seed is kept
+	c.Check(snapFile, testutil.FilePresent)
+	c.Check(filepath.Join(boot.InitramfsUbuntuSeedDir, "snaps", "pc-kernel_1.snap"), testutil.FileAbsent)
+}
+
+func (s *createRecoverySystemSuite) TestCreateRecoverySystemSetTryFailsCleansUp(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	restore := devicestate.MockBootSetTryRecoverySystem(func(dev boot.Device, label string) error {
+		return fmt.Errorf("boom")
+	})
+	defer restore()
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, IsNil)
+	s.runUntilRestart(c)
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot attempt booting into recovery system "1234": boom.*`)
+	c.Check(s.restartRequests, HasLen, 0)
+	// the system and the snaps it added are gone
+	c.Check(osutil.IsDirectory(filepath.Join(boot.InitramfsUbuntuSeedDir, "systems", "1234")), Equals, false)
+	c.Check(filepath.Join(boot.InitramfsUbuntuSeedDir, "snaps", "pc_1.snap"), testutil.FileAbsent)
+
+	// and the same label can be used again
+	restore()
+	chg, err = devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, IsNil)
+	s.runUntilRestart(c)
+	c.Check(chg.Tasks()[0].Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	c.Check(s.tried, DeepEquals, []string{"1234"})
+}
+
+func (s *createRecoverySystemSuite) TestCreateRecoverySystemSeedErrorCleansUp(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the gadget is the last essential snap, the other ones have been
+	// copied by the time it is found to be unasserted
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "pc", &snapst), IsNil)
+	snapst.Sequence[0].SnapID = ""
+	snapstate.Set(s.state, "pc", &snapst)
+
+	chg, err := devicestate.CreateRecoverySystem(s.state, "1234")
+	c.Assert(err, IsNil)
+	s.runUntilRestart(c)
+
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot create a system with unasserted snap "pc".*`)
+	c.Check(osutil.IsDirectory(filepath.Join(boot.InitramfsUbuntuSeedDir, "systems", "1234")), Equals, false)
+	for _, name := range []string{"snapd_1.snap", "pc-kernel_1.snap", "core20_1.snap"} {
+		c.Check(filepath.Join(boot.InitramfsUbuntuSeedDir, "snaps", name), testutil.FileAbsent)
+	}
+}
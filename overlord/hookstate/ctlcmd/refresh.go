@@ -0,0 +1,146 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd
+
+import (
+	"fmt"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/snapstate"
+)
+
+type refreshCommand struct {
+	baseCommand
+
+	Pending bool `long:"pending" description:"Show pending refreshes of the calling snap"`
+	// these two options are mutually exclusive
+	Proceed bool `long:"proceed" description:"Proceed with potentially disruptive refreshes"`
+	Hold    bool `long:"hold" description:"Do not proceed with potentially disruptive refreshes"`
+}
+
+var shortRefreshHelp = i18n.G("The refresh command prints pending refreshes and can hold back disruptive ones.")
+var longRefreshHelp = i18n.G(`
+The refresh command prints pending refreshes of the calling snap and can hold
+back disruptive refreshes of other snaps, such as refreshes of the kernel or
+base snaps that can affect the operation of the calling snap.
+
+--hold can only be used from the gate-auto-refresh hook. It holds the refresh
+of the snaps affecting the calling snap for up to 7 days. The refresh cannot
+be held for more than 60 days in total.
+
+--proceed allows the refresh of the snaps held by the calling snap to proceed.
+
+--pending prints pending refresh information of the calling snap.
+
+If the gate-auto-refresh hook neither holds nor proceeds, the refresh is held.
+`)
+
+func init() {
+	addCommand("refresh", shortRefreshHelp, longRefreshHelp, func() command {
+		return &refreshCommand{}
+	})
+}
+
+func (c *refreshCommand) Execute(args []string) error {
+	context := c.context()
+	if context == nil {
+		return fmt.Errorf("cannot run refresh without a context")
+	}
+
+	if c.Proceed && c.Hold {
+		return fmt.Errorf("cannot use --proceed and --hold together")
+	}
+
+	if c.Pending {
+		if err := c.printPendingInfo(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case c.Proceed:
+		return c.proceed()
+	case c.Hold:
+		return c.hold()
+	}
+
+	return nil
+}
+
+func (c *refreshCommand) printPendingInfo() error {
+	ctx := c.context()
+	ctx.Lock()
+	defer ctx.Unlock()
+
+	st := ctx.State()
+	snapName := ctx.InstanceName()
+	pending, err := snapstate.PendingRefresh(st, snapName)
+	if err != nil {
+		return err
+	}
+
+	c.printf("pending: %s\n", pending.Pending)
+	if pending.Channel != "" {
+		c.printf("channel: %s\n", pending.Channel)
+	}
+	if pending.Version != "" {
+		c.printf("version: %s\n", pending.Version)
+	}
+	if !pending.Revision.Unset() {
+		c.printf("revision: %s\n", pending.Revision)
+	}
+	c.printf("base: %v\n", pending.Base)
+	c.printf("restart: %v\n", pending.Restart)
+	return nil
+}
+
+func (c *refreshCommand) hold() error {
+	ctx := c.context()
+	ctx.Lock()
+	defer ctx.Unlock()
+
+	if ctx.IsEphemeral() || ctx.HookName() != "gate-auto-refresh" {
+		return fmt.Errorf("can only hold refresh from gate-auto-refresh hook")
+	}
+
+	var affecting []string
+	if err := ctx.Get("affecting-snaps", &affecting); err != nil {
+		return fmt.Errorf("internal error: cannot get affecting snaps: %v", err)
+	}
+
+	st := ctx.State()
+	// record the decision, so that the hook handler does not hold again
+	ctx.Set("action", "hold")
+	return snapstate.HoldRefresh(st, ctx.InstanceName(), affecting...)
+}
+
+func (c *refreshCommand) proceed() error {
+	ctx := c.context()
+	ctx.Lock()
+	defer ctx.Unlock()
+
+	if !ctx.IsEphemeral() && ctx.HookName() == "gate-auto-refresh" {
+		ctx.Set("action", "proceed")
+	}
+
+	// proceed can be called from outside of the gate-auto-refresh hook as
+	// well, e.g. from an app of the snap, dropping all of its holds
+	return snapstate.ProceedWithRefresh(ctx.State(), ctx.InstanceName())
+}
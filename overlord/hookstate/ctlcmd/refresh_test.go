@@ -0,0 +1,169 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ctlcmd_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/hookstate/ctlcmd"
+	"github.com/snapcore/snapd/overlord/hookstate/hooktest"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type refreshSuite struct {
+	testutil.BaseTest
+	st          *state.State
+	mockHandler *hooktest.MockHandler
+}
+
+var _ = Suite(&refreshSuite{})
+
+func (s *refreshSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("/") })
+
+	s.mockHandler = hooktest.NewMockHandler()
+	s.st = state.New(nil)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+	for _, name := range []string{"snap1", "snap2", "kernel"} {
+		snapstate.Set(s.st, name, &snapstate.SnapState{
+			Active:   true,
+			Sequence: []*snap.SideInfo{{RealName: name, Revision: snap.R(1)}},
+			Current:  snap.R(1),
+		})
+	}
+}
+
+func (s *refreshSuite) mockContext(c *C, hook string) *hookstate.Context {
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	task := s.st.NewTask("test-task", "my test task")
+	task.Set("hook-context", map[string]interface{}{
+		"affecting-snaps": []string{"kernel"},
+	})
+	setup := &hookstate.HookSetup{Snap: "snap1", Revision: snap.R(1), Hook: hook}
+	ctx, err := hookstate.NewContext(task, s.st, setup, s.mockHandler, "")
+	c.Assert(err, IsNil)
+	return ctx
+}
+
+func (s *refreshSuite) TestRefreshHoldFromGateAutoRefreshHook(c *C) {
+	ctx := s.mockContext(c, "gate-auto-refresh")
+
+	stdout, stderr, err := ctlcmd.Run(ctx, []string{"refresh", "--hold"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "")
+	c.Check(string(stderr), Equals, "")
+
+	ctx.Lock()
+	defer ctx.Unlock()
+
+	var action string
+	c.Assert(ctx.Get("action", &action), IsNil)
+	c.Check(action, Equals, "hold")
+
+	held, err := snapstate.HeldSnaps(s.st)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 1)
+	_, ok := held["kernel"]
+	c.Check(ok, Equals, true)
+}
+
+func (s *refreshSuite) TestRefreshHoldOutsideOfGateAutoRefreshHook(c *C) {
+	ctx := s.mockContext(c, "configure")
+
+	_, _, err := ctlcmd.Run(ctx, []string{"refresh", "--hold"}, 0)
+	c.Assert(err, ErrorMatches, `can only hold refresh from gate-auto-refresh hook`)
+}
+
+func (s *refreshSuite) TestRefreshProceed(c *C) {
+	s.st.Lock()
+	c.Assert(snapstate.HoldRefresh(s.st, "snap1", "kernel"), IsNil)
+	c.Assert(snapstate.HoldRefresh(s.st, "snap2", "kernel"), IsNil)
+	s.st.Unlock()
+
+	ctx := s.mockContext(c, "gate-auto-refresh")
+	_, _, err := ctlcmd.Run(ctx, []string{"refresh", "--proceed"}, 0)
+	c.Assert(err, IsNil)
+
+	ctx.Lock()
+	defer ctx.Unlock()
+
+	var action string
+	c.Assert(ctx.Get("action", &action), IsNil)
+	c.Check(action, Equals, "proceed")
+
+	// still held by snap2
+	held, err := snapstate.HeldSnaps(s.st)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 1)
+}
+
+func (s *refreshSuite) TestRefreshProceedAndHoldConflict(c *C) {
+	ctx := s.mockContext(c, "gate-auto-refresh")
+	_, _, err := ctlcmd.Run(ctx, []string{"refresh", "--proceed", "--hold"}, 0)
+	c.Assert(err, ErrorMatches, `cannot use --proceed and --hold together`)
+}
+
+func (s *refreshSuite) TestRefreshPending(c *C) {
+	s.st.Lock()
+	s.st.Set("refresh-candidates", map[string]interface{}{
+		"snap1": map[string]interface{}{
+			"channel":  "stable",
+			"version":  "2.0",
+			"revision": "5",
+		},
+	})
+	s.st.Unlock()
+
+	ctx := s.mockContext(c, "gate-auto-refresh")
+	stdout, stderr, err := ctlcmd.Run(ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, `pending: ready
+channel: stable
+version: 2.0
+revision: 5
+base: false
+restart: false
+`)
+	c.Check(string(stderr), Equals, "")
+}
+
+func (s *refreshSuite) TestRefreshPendingNone(c *C) {
+	ctx := s.mockContext(c, "configure")
+	stdout, _, err := ctlcmd.Run(ctx, []string{"refresh", "--pending"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(string(stdout), Equals, "pending: none\nbase: false\nrestart: false\n")
+}
+
+func (s *refreshSuite) TestRefreshNotAllowedForNonRoot(c *C) {
+	ctx := s.mockContext(c, "gate-auto-refresh")
+	_, _, err := ctlcmd.Run(ctx, []string{"refresh"}, 1000)
+	c.Assert(err, ErrorMatches, `cannot use "refresh" with uid 1000, try with sudo`)
+}
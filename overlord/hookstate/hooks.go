@@ -20,6 +20,7 @@ package hookstate
 import (
 	"fmt"
 	"regexp"
+	"sort"
 
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/overlord/snapstate"
@@ -31,6 +32,7 @@ func init() {
 	snapstate.SetupPreRefreshHook = SetupPreRefreshHook
 	snapstate.SetupPostRefreshHook = SetupPostRefreshHook
 	snapstate.SetupRemoveHook = SetupRemoveHook
+	snapstate.SetupGateAutoRefreshHook = SetupGateAutoRefreshHook
 }
 
 func SetupInstallHook(st *state.State, snapName string) *state.Task {
@@ -99,6 +101,73 @@ func SetupRemoveHook(st *state.State, snapName string) *state.Task {
 	return task
 }
 
+func SetupGateAutoRefreshHook(st *state.State, snapName string, base, restart bool, affectingSnaps map[string]bool) *state.Task {
+	hooksup := &HookSetup{
+		Snap:        snapName,
+		Hook:        "gate-auto-refresh",
+		Optional:    true,
+		IgnoreError: true,
+	}
+
+	affecting := make([]string, 0, len(affectingSnaps))
+	for sn := range affectingSnaps {
+		affecting = append(affecting, sn)
+	}
+	sort.Strings(affecting)
+	contextData := map[string]interface{}{
+		"base":            base,
+		"restart":         restart,
+		"affecting-snaps": affecting,
+	}
+
+	summary := fmt.Sprintf(i18n.G("Run hook %s of snap %q"), hooksup.Hook, hooksup.Snap)
+	return HookTask(st, summary, hooksup, contextData)
+}
+
+type gateAutoRefreshHookHandler struct {
+	context *Context
+}
+
+func (h *gateAutoRefreshHookHandler) Before() error {
+	return nil
+}
+
+func (h *gateAutoRefreshHookHandler) Done() error {
+	ctx := h.context
+	ctx.Lock()
+	defer ctx.Unlock()
+
+	var action string
+	if err := ctx.Get("action", &action); err != nil && err != state.ErrNoState {
+		return err
+	}
+
+	if action != "" {
+		// snapctl refresh --hold or --proceed was called by the hook
+		// and already took care of it
+		return nil
+	}
+
+	// the refresh is held unless the snap explicitly decided to proceed,
+	// this includes the case of the hook failing
+	var affecting []string
+	if err := ctx.Get("affecting-snaps", &affecting); err != nil {
+		return fmt.Errorf("internal error: cannot get affecting snaps: %v", err)
+	}
+	if err := snapstate.HoldRefresh(ctx.State(), ctx.InstanceName(), affecting...); err != nil {
+		if _, ok := err.(*snapstate.HoldError); !ok {
+			return err
+		}
+		// the maximum postponement was reached, the refresh proceeds
+		ctx.Logf("%v", err)
+	}
+	return nil
+}
+
+func (h *gateAutoRefreshHookHandler) Error(err error) error {
+	return nil
+}
+
 func setupHooks(hookMgr *HookManager) {
 	handlerGenerator := func(context *Context) Handler {
 		return &snapHookHandler{}
@@ -108,4 +177,7 @@ func setupHooks(hookMgr *HookManager) {
 	hookMgr.Register(regexp.MustCompile("^post-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^pre-refresh$"), handlerGenerator)
 	hookMgr.Register(regexp.MustCompile("^remove$"), handlerGenerator)
+	hookMgr.Register(regexp.MustCompile("^gate-auto-refresh$"), func(context *Context) Handler {
+		return &gateAutoRefreshHookHandler{context: context}
+	})
 }
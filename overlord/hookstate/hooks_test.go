@@ -0,0 +1,168 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package hookstate_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/overlord/hookstate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+const snapaYaml = `name: snap-a
+version: 1
+hooks:
+    gate-auto-refresh:
+`
+
+const snapbYaml = `name: snap-b
+version: 1
+`
+
+type gateAutoRefreshHookSuite struct {
+	baseHookManagerSuite
+}
+
+var _ = Suite(&gateAutoRefreshHookSuite{})
+
+func (s *gateAutoRefreshHookSuite) SetUpTest(c *C) {
+	s.commonSetUpTest(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	for _, yaml := range []string{snapaYaml, snapbYaml} {
+		info := snaptest.MockInfo(c, yaml, nil)
+		si := &snap.SideInfo{RealName: info.SnapName(), SnapID: info.SnapName() + "-id", Revision: snap.R(1)}
+		snaptest.MockSnap(c, yaml, si)
+		snapstate.Set(s.state, info.SnapName(), &snapstate.SnapState{
+			Active:   true,
+			Sequence: []*snap.SideInfo{si},
+			Current:  snap.R(1),
+		})
+	}
+}
+
+func (s *gateAutoRefreshHookSuite) TearDownTest(c *C) {
+	s.commonTearDownTest(c)
+}
+
+func (s *gateAutoRefreshHookSuite) runGateAutoRefreshHook(c *C) *state.Change {
+	s.state.Lock()
+	task := hookstate.SetupGateAutoRefreshHook(s.state, "snap-a", false, true, map[string]bool{"snap-b": true})
+	chg := s.state.NewChange("auto-refresh", "...")
+	chg.AddTask(task)
+	s.state.Unlock()
+
+	c.Assert(s.o.Settle(5*time.Second), IsNil)
+	return chg
+}
+
+func (s *gateAutoRefreshHookSuite) TestSetupGateAutoRefreshHook(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	task := hookstate.SetupGateAutoRefreshHook(s.state, "snap-a", true, false, map[string]bool{"snap-b": true, "base": true})
+	c.Check(task.Kind(), Equals, "run-hook")
+	c.Check(task.Summary(), Equals, `Run hook gate-auto-refresh of snap "snap-a"`)
+
+	var hooksup hookstate.HookSetup
+	c.Assert(task.Get("hook-setup", &hooksup), IsNil)
+	c.Check(hooksup, DeepEquals, hookstate.HookSetup{
+		Snap:        "snap-a",
+		Hook:        "gate-auto-refresh",
+		Optional:    true,
+		IgnoreError: true,
+	})
+
+	var data map[string]interface{}
+	c.Assert(task.Get("hook-context", &data), IsNil)
+	c.Check(data, DeepEquals, map[string]interface{}{
+		"base":            true,
+		"restart":         false,
+		"affecting-snaps": []interface{}{"base", "snap-b"},
+	})
+}
+
+func (s *gateAutoRefreshHookSuite) TestGateAutoRefreshHookHoldsByDefault(c *C) {
+	chg := s.runGateAutoRefreshHook(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	c.Check(s.command.Calls(), DeepEquals, [][]string{{
+		"snap", "run", "--hook", "gate-auto-refresh", "-r", "unset", "snap-a",
+	}})
+
+	held, err := snapstate.HeldSnaps(s.state)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 1)
+	c.Check(held["snap-b"].IsZero(), Equals, false)
+}
+
+func (s *gateAutoRefreshHookSuite) TestGateAutoRefreshHookErrorHolds(c *C) {
+	cmd := testutil.MockCommand(c, "snap", "exit 1")
+	defer cmd.Restore()
+
+	chg := s.runGateAutoRefreshHook(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	// the error is ignored, but the refresh is held
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	c.Check(chg.Tasks()[0].Log(), HasLen, 1)
+	c.Check(chg.Tasks()[0].Log()[0], Matches, `.*ignoring failure in hook "gate-auto-refresh".*`)
+
+	held, err := snapstate.HeldSnaps(s.state)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 1)
+}
+
+func (s *gateAutoRefreshHookSuite) TestGateAutoRefreshHookProceed(c *C) {
+	// simulate "snapctl refresh --proceed" being called by the hook
+	s.manager.RegisterHijack("gate-auto-refresh", "snap-a", func(ctx *hookstate.Context) error {
+		ctx.Lock()
+		defer ctx.Unlock()
+		ctx.Set("action", "proceed")
+		return snapstate.ProceedWithRefresh(ctx.State(), ctx.InstanceName())
+	})
+
+	s.state.Lock()
+	c.Assert(snapstate.HoldRefresh(s.state, "snap-a", "snap-b"), IsNil)
+	s.state.Unlock()
+
+	chg := s.runGateAutoRefreshHook(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	held, err := snapstate.HeldSnaps(s.state)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 0)
+}
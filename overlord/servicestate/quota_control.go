@@ -0,0 +1,607 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"fmt"
+	"sort"
+
+	tomb "gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/timings"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+// QuotaControlAction is the serialized representation of a quota group
+// modification that lives in a task.
+type QuotaControlAction struct {
+	// QuotaName is the name of the quota group being controlled.
+	QuotaName string `json:"quota-name"`
+
+	// Action is the action being taken on the quota group. It can be either
+	// "create", "update", or "remove".
+	Action string `json:"action"`
+
+	// Limits are the resource limits of the quota group, for "update" only
+	// the limits which are set are changed.
+	Limits quota.Resources `json:"limits,omitempty"`
+
+	// AddSnaps is the set of snaps to add to the quota group.
+	AddSnaps []string `json:"snaps,omitempty"`
+
+	// ParentName is the name of the parent for the quota group if it is being
+	// created. Eventually this could be used with the "update" action to
+	// support moving quota groups from one parent to another, but that is
+	// currently not supported.
+	ParentName string `json:"parent-name,omitempty"`
+}
+
+// QuotaGroupUpdate reflects all of the modifications that can be performed
+// on a quota group in one operation.
+type QuotaGroupUpdate struct {
+	// AddSnaps is the set of snaps to add to the quota group. These are
+	// instance names of snaps, and are appended to the existing snaps in
+	// the quota group.
+	AddSnaps []string
+
+	// NewLimits are the new resource limits of the quota group, limits which
+	// are not set are left unchanged.
+	NewLimits quota.Resources
+}
+
+// CreateQuota attempts to create the specified quota group with the specified
+// snaps in it, returning a task set that performs the operation.
+func CreateQuota(st *state.State, name string, parentName string, snaps []string, limits quota.Resources) (*state.TaskSet, error) {
+	allGrps, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+
+	// make sure the group does not exist yet
+	if _, ok := allGrps[name]; ok {
+		return nil, fmt.Errorf("group %q already exists", name)
+	}
+
+	// make sure the specified snaps exist and aren't currently in another
+	// group
+	if err := validateSnapsForQuota(st, allGrps, snaps); err != nil {
+		return nil, err
+	}
+
+	qc := QuotaControlAction{
+		Action:     "create",
+		QuotaName:  name,
+		Limits:     limits,
+		AddSnaps:   snaps,
+		ParentName: parentName,
+	}
+
+	// validate the group and its position in the tree early, so that
+	// errors can be reported right away
+	grpsCopy, err := copyQuotas(allGrps)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := quotaCreate(&qc, grpsCopy); err != nil {
+		return nil, err
+	}
+
+	if err := checkQuotaConflict(st, name, snaps); err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf("Create quota group %q", name)
+	return quotaControlTs(st, summary, &qc), nil
+}
+
+// RemoveQuota deletes the specific quota group, returning a task set that
+// performs the operation. The services of the snaps in the group are moved
+// back to the default systemd slice.
+func RemoveQuota(st *state.State, name string) (*state.TaskSet, error) {
+	grp, err := GetQuota(st, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// XXX: remove this limitation eventually
+	if len(grp.SubGroups) != 0 {
+		return nil, fmt.Errorf("cannot remove quota group with sub-groups, remove the sub-groups first")
+	}
+
+	if err := checkQuotaConflict(st, name, grp.Snaps); err != nil {
+		return nil, err
+	}
+
+	qc := QuotaControlAction{
+		Action:    "remove",
+		QuotaName: name,
+	}
+	summary := fmt.Sprintf("Remove quota group %q", name)
+	return quotaControlTs(st, summary, &qc), nil
+}
+
+// UpdateQuota updates the quota as per the options, returning a task set that
+// performs the operation.
+func UpdateQuota(st *state.State, name string, updateOpts QuotaGroupUpdate) (*state.TaskSet, error) {
+	allGrps, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := allGrps[name]; !ok {
+		return nil, ErrQuotaNotFound
+	}
+
+	if err := validateSnapsForQuota(st, allGrps, updateOpts.AddSnaps); err != nil {
+		return nil, err
+	}
+
+	qc := QuotaControlAction{
+		Action:    "update",
+		QuotaName: name,
+		Limits:    updateOpts.NewLimits,
+		AddSnaps:  updateOpts.AddSnaps,
+	}
+
+	// validate the update early, so that errors can be reported right away
+	grpsCopy, err := copyQuotas(allGrps)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := quotaUpdate(&qc, grpsCopy); err != nil {
+		return nil, err
+	}
+
+	if err := checkQuotaConflict(st, name, updateOpts.AddSnaps); err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf("Update quota group %q", name)
+	return quotaControlTs(st, summary, &qc), nil
+}
+
+func quotaControlTs(st *state.State, summary string, qc *QuotaControlAction) *state.TaskSet {
+	task := st.NewTask("quota-control", summary)
+	task.Set("quota-control-action", qc)
+	return state.NewTaskSet(task)
+}
+
+// validateSnapsForQuota checks that the snaps are installed and are not
+// already members of a quota group.
+func validateSnapsForQuota(st *state.State, allGrps map[string]*quota.Group, snaps []string) error {
+	for _, name := range snaps {
+		var snapst snapstate.SnapState
+		if err := snapstate.Get(st, name, &snapst); err != nil {
+			if err == state.ErrNoState {
+				return fmt.Errorf("cannot use snap %q in group: snap not installed", name)
+			}
+			return err
+		}
+		if grp := quotaGroupForSnap(allGrps, name); grp != nil {
+			return fmt.Errorf("cannot add snap %q to group: snap already in quota group %q", name, grp.Name)
+		}
+	}
+	return nil
+}
+
+// checkQuotaConflict checks that there are no ongoing changes for the snaps
+// affected by the quota group operation or for the quota group itself.
+func checkQuotaConflict(st *state.State, name string, snaps []string) error {
+	for _, chg := range st.Changes() {
+		if chg.Status().Ready() {
+			continue
+		}
+		for _, t := range chg.Tasks() {
+			if t.Kind() != "quota-control" || t.Status().Ready() {
+				continue
+			}
+			var qc QuotaControlAction
+			if err := t.Get("quota-control-action", &qc); err != nil {
+				return fmt.Errorf("internal error: cannot get quota-control-action: %v", err)
+			}
+			if qc.QuotaName == name {
+				return &snapstate.ChangeConflictError{
+					Message:    fmt.Sprintf("quota group %q has %q change in progress", name, chg.Kind()),
+					ChangeKind: chg.Kind(),
+				}
+			}
+		}
+	}
+	return snapstate.CheckChangeConflictMany(st, snaps, "")
+}
+
+// copyQuotas returns a deep copy of the given quota groups, that can be
+// modified to check whether an operation is possible.
+func copyQuotas(allGrps map[string]*quota.Group) (map[string]*quota.Group, error) {
+	grps := make(map[string]*quota.Group, len(allGrps))
+	for name, grp := range allGrps {
+		grps[name] = &quota.Group{
+			Name:        grp.Name,
+			SubGroups:   append([]string(nil), grp.SubGroups...),
+			ParentGroup: grp.ParentGroup,
+			Snaps:       append([]string(nil), grp.Snaps...),
+			Limits:      grp.Limits,
+		}
+	}
+	if err := quota.ResolveCrossReferences(grps); err != nil {
+		return nil, err
+	}
+	return grps, nil
+}
+
+func quotaControlAffectedSnaps(t *state.Task) ([]string, error) {
+	var qc QuotaControlAction
+	if err := t.Get("quota-control-action", &qc); err != nil {
+		return nil, fmt.Errorf("internal error: cannot get quota-control-action: %v", err)
+	}
+
+	st := t.State()
+	switch qc.Action {
+	case "remove", "update":
+		// all the snaps of the group are affected
+		grp, err := GetQuota(st, qc.QuotaName)
+		if err == ErrQuotaNotFound {
+			return qc.AddSnaps, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return strutil.SortedListsUniqueMerge(sortedCopy(grp.Snaps), sortedCopy(qc.AddSnaps)), nil
+	}
+	return qc.AddSnaps, nil
+}
+
+func sortedCopy(l []string) []string {
+	cpy := append([]string(nil), l...)
+	sort.Strings(cpy)
+	return cpy
+}
+
+// quotaCreate creates the group described by the action in the given set of
+// groups, which is modified in place. It returns the new group and the updated
+// set of groups.
+func quotaCreate(qc *QuotaControlAction, allGrps map[string]*quota.Group) (*quota.Group, map[string]*quota.Group, error) {
+	if _, ok := allGrps[qc.QuotaName]; ok {
+		return nil, nil, fmt.Errorf("group %q already exists", qc.QuotaName)
+	}
+
+	var grp *quota.Group
+	var err error
+	if qc.ParentName != "" {
+		parentGrp, ok := allGrps[qc.ParentName]
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot create group under non-existent parent group %q", qc.ParentName)
+		}
+		grp, err = parentGrp.NewSubGroup(qc.QuotaName, qc.Limits)
+	} else {
+		grp, err = quota.NewGroup(qc.QuotaName, qc.Limits)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	grp.Snaps = qc.AddSnaps
+
+	if allGrps == nil {
+		allGrps = make(map[string]*quota.Group)
+	}
+	allGrps[qc.QuotaName] = grp
+
+	if err := quota.ResolveCrossReferences(allGrps); err != nil {
+		return nil, nil, err
+	}
+	return grp, allGrps, nil
+}
+
+// quotaUpdate applies the modifications described by the action to the group
+// in the given set of groups, which is modified in place.
+func quotaUpdate(qc *QuotaControlAction, allGrps map[string]*quota.Group) (*quota.Group, map[string]*quota.Group, error) {
+	grp, ok := allGrps[qc.QuotaName]
+	if !ok {
+		return nil, nil, fmt.Errorf("group %q does not exist", qc.QuotaName)
+	}
+
+	// the limits which are not set are left unchanged
+	newLimits := grp.Limits
+	if qc.Limits.Memory != 0 {
+		newLimits.Memory = qc.Limits.Memory
+	}
+	if qc.Limits.CPU != 0 {
+		newLimits.CPU = qc.Limits.CPU
+	}
+	if qc.Limits.Tasks != 0 {
+		newLimits.Tasks = qc.Limits.Tasks
+	}
+	if err := grp.UpdateLimits(newLimits); err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range qc.AddSnaps {
+		if !strutil.ListContains(grp.Snaps, name) {
+			grp.Snaps = append(grp.Snaps, name)
+		}
+	}
+
+	if err := quota.ResolveCrossReferences(allGrps); err != nil {
+		return nil, nil, err
+	}
+	return grp, allGrps, nil
+}
+
+// quotaRemove removes the group from the given set of groups, which is
+// modified in place.
+func quotaRemove(qc *QuotaControlAction, allGrps map[string]*quota.Group) (*quota.Group, map[string]*quota.Group, error) {
+	grp, ok := allGrps[qc.QuotaName]
+	if !ok {
+		return nil, nil, fmt.Errorf("group %q does not exist", qc.QuotaName)
+	}
+
+	if len(grp.SubGroups) != 0 {
+		return nil, nil, fmt.Errorf("cannot remove quota group with sub-groups, remove the sub-groups first")
+	}
+
+	if parent := grp.Parent(); parent != nil {
+		parent.RemoveSubGroup(grp.Name)
+	}
+	delete(allGrps, qc.QuotaName)
+
+	if err := quota.ResolveCrossReferences(allGrps); err != nil {
+		return nil, nil, err
+	}
+	return grp, allGrps, nil
+}
+
+func (m *ServiceManager) doQuotaControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	perfTimings := state.TimingsForTask(t)
+	defer perfTimings.Save(st)
+
+	var qc QuotaControlAction
+	if err := t.Get("quota-control-action", &qc); err != nil {
+		return fmt.Errorf("internal error: cannot get quota-control-action: %v", err)
+	}
+
+	allGrps, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+
+	// remember the groups as they were for undo, the first time only
+	var oldGrps map[string]*quota.Group
+	if err := t.Get("old-quota-groups", &oldGrps); err == state.ErrNoState {
+		t.Set("old-quota-groups", allGrps)
+	} else if err != nil {
+		return err
+	}
+
+	var grp *quota.Group
+	switch qc.Action {
+	case "create":
+		grp, allGrps, err = quotaCreate(&qc, allGrps)
+	case "update":
+		grp, allGrps, err = quotaUpdate(&qc, allGrps)
+	case "remove":
+		grp, allGrps, err = quotaRemove(&qc, allGrps)
+	default:
+		return fmt.Errorf("unknown action %q requested", qc.Action)
+	}
+	if err != nil {
+		return err
+	}
+
+	// on update the units of the snaps already in the group don't change,
+	// only the slice does
+	affectedSnaps := grp.Snaps
+	if qc.Action == "update" {
+		affectedSnaps = qc.AddSnaps
+	}
+
+	meter := snapstate.NewTaskProgressAdapterUnlocked(t)
+
+	if qc.Action != "remove" {
+		// the slice must exist before any service is moved into it
+		st.Unlock()
+		_, err := wrappers.EnsureQuotaGroupSlice(grp, meter)
+		st.Lock()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := updateQuotas(st, allGrps); err != nil {
+		return err
+	}
+
+	if err := ensureSnapServicesForQuota(st, affectedSnaps, allGrps, meter, perfTimings); err != nil {
+		return err
+	}
+
+	if qc.Action == "remove" {
+		// the services are not in the slice anymore, it can be dropped
+		st.Unlock()
+		err := wrappers.RemoveQuotaGroupSlice(grp, meter)
+		st.Lock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *ServiceManager) undoQuotaControl(t *state.Task, _ *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	perfTimings := state.TimingsForTask(t)
+	defer perfTimings.Save(st)
+
+	var qc QuotaControlAction
+	if err := t.Get("quota-control-action", &qc); err != nil {
+		return fmt.Errorf("internal error: cannot get quota-control-action: %v", err)
+	}
+	var oldGrps map[string]*quota.Group
+	if err := t.Get("old-quota-groups", &oldGrps); err != nil {
+		if err == state.ErrNoState {
+			// nothing was changed
+			return nil
+		}
+		return err
+	}
+	if err := quota.ResolveCrossReferences(oldGrps); err != nil {
+		return err
+	}
+
+	allGrps, err := AllQuotas(st)
+	if err != nil {
+		return err
+	}
+	oldGrp := oldGrps[qc.QuotaName]
+	grp := allGrps[qc.QuotaName]
+
+	// the snaps of the group before and after the change are affected
+	var oldSnaps, snaps []string
+	if oldGrp != nil {
+		oldSnaps = sortedCopy(oldGrp.Snaps)
+	}
+	if grp != nil {
+		snaps = sortedCopy(grp.Snaps)
+	}
+	affectedSnaps := strutil.SortedListsUniqueMerge(oldSnaps, snaps)
+
+	meter := snapstate.NewTaskProgressAdapterUnlocked(t)
+
+	if oldGrp != nil {
+		// bring back the slice as it was before moving any service
+		st.Unlock()
+		_, err := wrappers.EnsureQuotaGroupSlice(oldGrp, meter)
+		st.Lock()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := updateQuotas(st, oldGrps); err != nil {
+		return err
+	}
+
+	if err := ensureSnapServicesForQuota(st, affectedSnaps, oldGrps, meter, perfTimings); err != nil {
+		return err
+	}
+
+	if oldGrp == nil && grp != nil {
+		// the group was created by the change
+		st.Unlock()
+		err := wrappers.RemoveQuotaGroupSlice(grp, meter)
+		st.Lock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureSnapServicesForQuota regenerates the service units of the given snaps
+// according to the current quota groups and restarts the services which are
+// running, so that they are moved to the right slice.
+func ensureSnapServicesForQuota(st *state.State, snaps []string, allGrps map[string]*quota.Group, meter progress.Meter, tm timings.Measurer) error {
+	for _, name := range snaps {
+		var snapst snapstate.SnapState
+		if err := snapstate.Get(st, name, &snapst); err != nil {
+			if err == state.ErrNoState {
+				// the snap was removed in the meantime
+				continue
+			}
+			return err
+		}
+		if !snapst.Active {
+			// the services are regenerated when the snap becomes
+			// active again
+			continue
+		}
+		info, err := snapst.CurrentInfo()
+		if err != nil {
+			return err
+		}
+		if len(info.Services()) == 0 {
+			continue
+		}
+
+		opts, err := snapServiceOptions(st, name, allGrps)
+		if err != nil {
+			return err
+		}
+
+		st.Unlock()
+		err = wrappers.AddSnapServices(info, opts, meter)
+		if err == nil {
+			err = restartActiveServices(info, meter, tm)
+		}
+		st.Lock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restartActiveServices restarts the system services of the snap which are
+// currently running.
+func restartActiveServices(info *snap.Info, meter progress.Meter, tm timings.Measurer) error {
+	var names []string
+	var svcs []*snap.AppInfo
+	for _, app := range info.Services() {
+		if app.DaemonScope != snap.SystemDaemon {
+			continue
+		}
+		names = append(names, app.ServiceName())
+		svcs = append(svcs, app)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	sysd := systemd.New(systemd.SystemMode, meter)
+	sts, err := sysd.Status(names...)
+	if err != nil {
+		return err
+	}
+	var active []*snap.AppInfo
+	for i, st := range sts {
+		if st.Active {
+			active = append(active, svcs[i])
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	return wrappers.RestartServices(active, nil, meter, tm)
+}
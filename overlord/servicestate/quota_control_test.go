@@ -0,0 +1,428 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/servicestate"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/systemd"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type quotaControlSuite struct {
+	testutil.BaseTest
+	state      *state.State
+	o          *overlord.Overlord
+	se         *overlord.StateEngine
+	sysctlArgs [][]string
+	active     bool
+}
+
+var _ = Suite(&quotaControlSuite{})
+
+const quotaSnapYaml = `name: test-snap
+version: 1.0
+apps:
+  svc1:
+    daemon: simple
+`
+
+func (s *quotaControlSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("") })
+
+	s.o = overlord.Mock()
+	s.state = s.o.State()
+
+	s.sysctlArgs = nil
+	s.active = false
+	systemctlRestorer := systemd.MockSystemctl(func(cmd ...string) (buf []byte, err error) {
+		s.sysctlArgs = append(s.sysctlArgs, cmd)
+		switch {
+		case cmd[0] == "show" && cmd[1] == "--property=Id,ActiveState,UnitFileState,Type":
+			activeState := "inactive"
+			if s.active {
+				activeState = "active"
+			}
+			return []byte(fmt.Sprintf("Id=%s\nType=simple\nActiveState=%s\nUnitFileState=enabled\n", cmd[2], activeState)), nil
+		case cmd[0] == "show":
+			return []byte("ActiveState=inactive\n"), nil
+		}
+		return nil, nil
+	})
+	s.AddCleanup(systemctlRestorer)
+
+	serviceMgr := servicestate.Manager(s.state, s.o.TaskRunner())
+	s.o.AddManager(serviceMgr)
+	s.o.AddManager(s.o.TaskRunner())
+	s.se = s.o.StateEngine()
+	c.Assert(s.o.StartUp(), IsNil)
+	s.AddCleanup(s.se.Stop)
+}
+
+func (s *quotaControlSuite) mockTestSnap(c *C) *snap.Info {
+	si := snap.SideInfo{
+		RealName: "test-snap",
+		Revision: snap.R(7),
+	}
+	info := snaptest.MockSnap(c, quotaSnapYaml, &si)
+	snapstate.Set(s.state, "test-snap", &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{&si},
+		Current:  snap.R(7),
+		SnapType: "app",
+	})
+	return info
+}
+
+func (s *quotaControlSuite) runChange(c *C, ts *state.TaskSet) *state.Change {
+	chg := s.state.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+
+	s.state.Unlock()
+	err := s.o.Settle(5 * time.Second)
+	s.state.Lock()
+	c.Assert(err, IsNil)
+	return chg
+}
+
+func (s *quotaControlSuite) TestCreateQuota(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+	s.active = true
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", []string{"test-snap"}, quota.Resources{Memory: quantity.SizeGiB})
+	c.Assert(err, IsNil)
+	tasks := ts.Tasks()
+	c.Assert(tasks, HasLen, 1)
+	c.Check(tasks[0].Kind(), Equals, "quota-control")
+
+	var qc servicestate.QuotaControlAction
+	c.Assert(tasks[0].Get("quota-control-action", &qc), IsNil)
+	c.Check(qc, DeepEquals, servicestate.QuotaControlAction{
+		QuotaName: "foo",
+		Action:    "create",
+		Limits:    quota.Resources{Memory: quantity.SizeGiB},
+		AddSnaps:  []string{"test-snap"},
+	})
+
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	grp, err := servicestate.GetQuota(st, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp.Snaps, DeepEquals, []string{"test-snap"})
+	c.Check(grp.Limits, Equals, quota.Resources{Memory: quantity.SizeGiB})
+
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo.slice"), testutil.FileContains, "\nMemoryMax=1073741824\n")
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.test-snap.svc1.service"), testutil.FileContains, "\nSlice=snap.foo.slice\n")
+
+	c.Check(s.sysctlArgs, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"daemon-reload"},
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.test-snap.svc1.service"},
+		{"stop", "snap.test-snap.svc1.service"},
+		{"show", "--property=ActiveState", "snap.test-snap.svc1.service"},
+		{"start", "snap.test-snap.svc1.service"},
+	})
+
+	snapGrp, err := servicestate.QuotaGroupForSnap(st, "test-snap")
+	c.Assert(err, IsNil)
+	c.Check(snapGrp.Name, Equals, "foo")
+}
+
+func (s *quotaControlSuite) TestCreateQuotaInactiveServicesNotRestarted(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", []string{"test-snap"}, quota.Resources{Tasks: 32})
+	c.Assert(err, IsNil)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	c.Check(s.sysctlArgs, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"daemon-reload"},
+		{"show", "--property=Id,ActiveState,UnitFileState,Type", "snap.test-snap.svc1.service"},
+	})
+}
+
+func (s *quotaControlSuite) TestCreateQuotaErrors(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	_, err := servicestate.CreateQuota(st, "foo", "", []string{"missing-snap"}, quota.Resources{Tasks: 32})
+	c.Check(err, ErrorMatches, `cannot use snap "missing-snap" in group: snap not installed`)
+
+	_, err = servicestate.CreateQuota(st, "foo", "bar", nil, quota.Resources{Tasks: 32})
+	c.Check(err, ErrorMatches, `cannot create group under non-existent parent group "bar"`)
+
+	_, err = servicestate.CreateQuota(st, "foo", "", nil, quota.Resources{})
+	c.Check(err, ErrorMatches, `.*quota group must have at least one resource limit set`)
+
+	_, err = servicestate.CreateQuota(st, "snapd", "", nil, quota.Resources{Tasks: 32})
+	c.Check(err, ErrorMatches, `.*group name "snapd" reserved`)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", []string{"test-snap"}, quota.Resources{Tasks: 32})
+	c.Assert(err, IsNil)
+	s.runChange(c, ts)
+
+	_, err = servicestate.CreateQuota(st, "foo", "", nil, quota.Resources{Tasks: 32})
+	c.Check(err, ErrorMatches, `group "foo" already exists`)
+
+	_, err = servicestate.CreateQuota(st, "bar", "", []string{"test-snap"}, quota.Resources{Tasks: 32})
+	c.Check(err, ErrorMatches, `cannot add snap "test-snap" to group: snap already in quota group "foo"`)
+
+	_, err = servicestate.CreateQuota(st, "bar", "foo", nil, quota.Resources{Tasks: 64})
+	c.Check(err, ErrorMatches, `sub-group task limit of 64 is too large to fit inside remaining quota space 32 for parent group foo`)
+}
+
+func (s *quotaControlSuite) TestCreateSubGroup(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", nil, quota.Resources{Memory: quantity.SizeGiB})
+	c.Assert(err, IsNil)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	ts, err = servicestate.CreateQuota(st, "bar", "foo", []string{"test-snap"}, quota.Resources{Memory: quantity.SizeMiB})
+	c.Assert(err, IsNil)
+	chg = s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	allGrps, err := servicestate.AllQuotas(st)
+	c.Assert(err, IsNil)
+	c.Assert(allGrps, HasLen, 2)
+	c.Check(allGrps["foo"].SubGroups, DeepEquals, []string{"bar"})
+	c.Check(allGrps["bar"].ParentGroup, Equals, "foo")
+	c.Check(allGrps["bar"].Parent(), Equals, allGrps["foo"])
+
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo-bar.slice"), testutil.FilePresent)
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.test-snap.svc1.service"), testutil.FileContains, "\nSlice=snap.foo-bar.slice\n")
+
+	// the parent cannot be removed while it has sub-groups
+	_, err = servicestate.RemoveQuota(st, "foo")
+	c.Check(err, ErrorMatches, `cannot remove quota group with sub-groups, remove the sub-groups first`)
+}
+
+func (s *quotaControlSuite) TestUpdateQuota(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", nil, quota.Resources{Memory: quantity.SizeGiB, Tasks: 32})
+	c.Assert(err, IsNil)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	ts, err = servicestate.UpdateQuota(st, "foo", servicestate.QuotaGroupUpdate{
+		AddSnaps:  []string{"test-snap"},
+		NewLimits: quota.Resources{Memory: 2 * quantity.SizeGiB},
+	})
+	c.Assert(err, IsNil)
+	chg = s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	grp, err := servicestate.GetQuota(st, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp.Snaps, DeepEquals, []string{"test-snap"})
+	// the tasks limit was left unchanged
+	c.Check(grp.Limits, Equals, quota.Resources{Memory: 2 * quantity.SizeGiB, Tasks: 32})
+
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo.slice"), testutil.FileContains, "\nMemoryMax=2147483648\n")
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.test-snap.svc1.service"), testutil.FileContains, "\nSlice=snap.foo.slice\n")
+
+	_, err = servicestate.UpdateQuota(st, "bar", servicestate.QuotaGroupUpdate{})
+	c.Check(err, Equals, servicestate.ErrQuotaNotFound)
+
+	_, err = servicestate.UpdateQuota(st, "foo", servicestate.QuotaGroupUpdate{
+		NewLimits: quota.Resources{Memory: 1},
+	})
+	c.Check(err, ErrorMatches, `.*memory limit 1 is too small: size must be larger than 4096`)
+}
+
+func (s *quotaControlSuite) TestRemoveQuota(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", []string{"test-snap"}, quota.Resources{Memory: quantity.SizeGiB})
+	c.Assert(err, IsNil)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	ts, err = servicestate.RemoveQuota(st, "foo")
+	c.Assert(err, IsNil)
+	chg = s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	_, err = servicestate.GetQuota(st, "foo")
+	c.Check(err, Equals, servicestate.ErrQuotaNotFound)
+	allGrps, err := servicestate.AllQuotas(st)
+	c.Assert(err, IsNil)
+	c.Check(allGrps, HasLen, 0)
+
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo.slice"), testutil.FileAbsent)
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.test-snap.svc1.service"), Not(testutil.FileContains), "Slice=")
+
+	_, err = servicestate.RemoveQuota(st, "foo")
+	c.Check(err, Equals, servicestate.ErrQuotaNotFound)
+}
+
+func (s *quotaControlSuite) TestCreateQuotaUndo(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	s.o.TaskRunner().AddHandler("error-trigger", func(*state.Task, *tomb.Tomb) error {
+		return fmt.Errorf("boom")
+	}, nil)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", []string{"test-snap"}, quota.Resources{Memory: quantity.SizeGiB})
+	c.Assert(err, IsNil)
+	errTask := st.NewTask("error-trigger", "provoking undo")
+	errTask.WaitAll(ts)
+	ts.AddTask(errTask)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Tasks()[0].Status(), Equals, state.UndoneStatus)
+
+	_, err = servicestate.GetQuota(st, "foo")
+	c.Check(err, Equals, servicestate.ErrQuotaNotFound)
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo.slice"), testutil.FileAbsent)
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.test-snap.svc1.service"), Not(testutil.FileContains), "Slice=")
+}
+
+func (s *quotaControlSuite) TestUpdateQuotaUndo(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	s.o.TaskRunner().AddHandler("error-trigger", func(*state.Task, *tomb.Tomb) error {
+		return fmt.Errorf("boom")
+	}, nil)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", nil, quota.Resources{Memory: quantity.SizeGiB})
+	c.Assert(err, IsNil)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	ts, err = servicestate.UpdateQuota(st, "foo", servicestate.QuotaGroupUpdate{
+		AddSnaps:  []string{"test-snap"},
+		NewLimits: quota.Resources{Memory: 2 * quantity.SizeGiB},
+	})
+	c.Assert(err, IsNil)
+	errTask := st.NewTask("error-trigger", "provoking undo")
+	errTask.WaitAll(ts)
+	ts.AddTask(errTask)
+	chg = s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+
+	grp, err := servicestate.GetQuota(st, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp.Snaps, HasLen, 0)
+	c.Check(grp.Limits, Equals, quota.Resources{Memory: quantity.SizeGiB})
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo.slice"), testutil.FileContains, "\nMemoryMax=1073741824\n")
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.test-snap.svc1.service"), Not(testutil.FileContains), "Slice=")
+}
+
+func (s *quotaControlSuite) TestRemoveQuotaUndo(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	s.o.TaskRunner().AddHandler("error-trigger", func(*state.Task, *tomb.Tomb) error {
+		return fmt.Errorf("boom")
+	}, nil)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", []string{"test-snap"}, quota.Resources{Memory: quantity.SizeGiB})
+	c.Assert(err, IsNil)
+	chg := s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	ts, err = servicestate.RemoveQuota(st, "foo")
+	c.Assert(err, IsNil)
+	errTask := st.NewTask("error-trigger", "provoking undo")
+	errTask.WaitAll(ts)
+	ts.AddTask(errTask)
+	chg = s.runChange(c, ts)
+	c.Assert(chg.Status(), Equals, state.ErrorStatus)
+
+	grp, err := servicestate.GetQuota(st, "foo")
+	c.Assert(err, IsNil)
+	c.Check(grp.Snaps, DeepEquals, []string{"test-snap"})
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foo.slice"), testutil.FileContains, "\nMemoryMax=1073741824\n")
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.test-snap.svc1.service"), testutil.FileContains, "\nSlice=snap.foo.slice\n")
+}
+
+func (s *quotaControlSuite) TestQuotaConflict(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockTestSnap(c)
+
+	ts, err := servicestate.CreateQuota(st, "foo", "", []string{"test-snap"}, quota.Resources{Tasks: 32})
+	c.Assert(err, IsNil)
+	chg := st.NewChange("quota-control", "...")
+	chg.AddAll(ts)
+
+	_, err = snapstate.Remove(st, "test-snap", snap.Revision{}, nil)
+	c.Assert(err, ErrorMatches, `snap "test-snap" has "quota-control" change in progress`)
+}
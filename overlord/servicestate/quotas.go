@@ -0,0 +1,127 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package servicestate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap/quota"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/wrappers"
+)
+
+// ErrQuotaNotFound is returned when a quota group is not found.
+var ErrQuotaNotFound = errors.New("quota not found")
+
+// AllQuotas returns all currently tracked quota groups in the state. They are
+// validated for consistency using ResolveCrossReferences before being returned.
+func AllQuotas(st *state.State) (map[string]*quota.Group, error) {
+	var quotas map[string]*quota.Group
+	if err := st.Get("quotas", &quotas); err != nil {
+		if err != state.ErrNoState {
+			return nil, err
+		}
+		// otherwise there are no quotas so just return nil
+		return nil, nil
+	}
+
+	// quota groups are not serialized with all the necessary tracking
+	// information in the objects, so we need to thread some things around
+	if err := quota.ResolveCrossReferences(quotas); err != nil {
+		return nil, err
+	}
+
+	return quotas, nil
+}
+
+// GetQuota returns an individual quota group by name.
+func GetQuota(st *state.State, name string) (*quota.Group, error) {
+	allGrps, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+
+	group, ok := allGrps[name]
+	if !ok {
+		return nil, ErrQuotaNotFound
+	}
+
+	return group, nil
+}
+
+// updateQuotas updates the quota groups in the state after resolving and
+// validating all of them. The state must be locked by the caller.
+func updateQuotas(st *state.State, allGrps map[string]*quota.Group) error {
+	if err := quota.ResolveCrossReferences(allGrps); err != nil {
+		return err
+	}
+	if len(allGrps) == 0 {
+		st.Set("quotas", nil)
+		return nil
+	}
+	st.Set("quotas", allGrps)
+	return nil
+}
+
+// QuotaGroupForSnap returns the quota group the given snap is a member of, or
+// nil if the snap is not in any group.
+func QuotaGroupForSnap(st *state.State, instanceName string) (*quota.Group, error) {
+	allGrps, err := AllQuotas(st)
+	if err != nil {
+		return nil, err
+	}
+	return quotaGroupForSnap(allGrps, instanceName), nil
+}
+
+func quotaGroupForSnap(allGrps map[string]*quota.Group, instanceName string) *quota.Group {
+	for _, grp := range allGrps {
+		if strutil.ListContains(grp.Snaps, instanceName) {
+			return grp
+		}
+	}
+	return nil
+}
+
+// snapServiceOptions returns the options for generating the services of the
+// given snap, taking into account the vitality rank of the snap as well as the
+// quota group it is a member of.
+func snapServiceOptions(st *state.State, instanceName string, allGrps map[string]*quota.Group) (*wrappers.AddSnapServicesOptions, error) {
+	opts := &wrappers.AddSnapServicesOptions{
+		QuotaGroup: quotaGroupForSnap(allGrps, instanceName),
+	}
+
+	tr := config.NewTransaction(st)
+	var vitalityStr string
+	if err := tr.GetMaybe("core", "resilience.vitality-hint", &vitalityStr); err != nil {
+		return nil, fmt.Errorf("cannot get vitality hint: %v", err)
+	}
+	for i, s := range strings.Split(vitalityStr, ",") {
+		if s == instanceName {
+			opts.VitalityRank = i + 1
+			break
+		}
+	}
+
+	return opts, nil
+}
@@ -39,6 +39,8 @@ func Manager(st *state.State, runner *state.TaskRunner) *ServiceManager {
 	}
 	// TODO: undo handler
 	runner.AddHandler("service-control", m.doServiceControl, nil)
+
+	runner.AddHandler("quota-control", m.doQuotaControl, m.undoQuotaControl)
 	return m
 }
 
@@ -50,6 +52,9 @@ func (m *ServiceManager) Ensure() error {
 func delayedCrossMgrInit() {
 	// hook into conflict checks mechanisms
 	snapstate.AddAffectedSnapsByAttr("service-action", serviceControlAffectedSnaps)
+	snapstate.AddAffectedSnapsByKind("quota-control", quotaControlAffectedSnaps)
+	// put the services of snaps in their quota groups
+	snapstate.QuotaGroupForSnap = QuotaGroupForSnap
 }
 
 func serviceControlAffectedSnaps(t *state.Task) ([]string, error) {
@@ -25,6 +25,7 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"crypto/cipher"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -259,29 +260,48 @@ func isSnapshotFilename(filePath string) (ok bool, setID uint64) {
 
 // EstimateSnapshotSize calculates estimated size of the snapshot.
 func EstimateSnapshotSize(si *snap.Info, usernames []string) (uint64, error) {
-	var total uint64
-	calculateSize := func(path string, finfo os.FileInfo, err error) error {
-		if finfo.Mode().IsRegular() {
-			total += uint64(finfo.Size())
-		}
-		return err
+	snapshotOptions, err := snap.ReadSnapshotYaml(si)
+	if err != nil {
+		return 0, err
 	}
 
-	visitDir := func(dir string) error {
-		exists, isDir, err := osutil.DirExists(dir)
-		if err != nil {
-			return err
-		}
-		if !(exists && isDir) {
+	var total uint64
+	visitDirs := func(dataDir string, excludes []string) error {
+		parent, revdir := filepath.Split(dataDir)
+		calculateSize := func(path string, finfo os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if rel, err := filepath.Rel(parent, path); err == nil && isExcluded(rel, excludes) {
+				if finfo.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if finfo.Mode().IsRegular() {
+				total += uint64(finfo.Size())
+			}
 			return nil
 		}
-		return filepath.Walk(dir, calculateSize)
-	}
 
-	for _, dir := range []string{si.DataDir(), si.CommonDataDir()} {
-		if err := visitDir(dir); err != nil {
-			return 0, err
+		for _, dir := range []string{revdir, "common"} {
+			dir = filepath.Join(parent, dir)
+			exists, isDir, err := osutil.DirExists(dir)
+			if err != nil {
+				return err
+			}
+			if !(exists && isDir) {
+				continue
+			}
+			if err := filepath.Walk(dir, calculateSize); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
+
+	if err := visitDirs(si.DataDir(), snapshotExcludes(snapshotOptions, si.DataDir(), false)); err != nil {
+		return 0, err
 	}
 
 	users, err := usersForUsernames(usernames)
@@ -289,10 +309,8 @@ func EstimateSnapshotSize(si *snap.Info, usernames []string) (uint64, error) {
 		return 0, err
 	}
 	for _, usr := range users {
-		if err := visitDir(si.UserDataDir(usr.HomeDir)); err != nil {
-			return 0, err
-		}
-		if err := visitDir(si.UserCommonDataDir(usr.HomeDir)); err != nil {
+		dataDir := si.UserDataDir(usr.HomeDir)
+		if err := visitDirs(dataDir, snapshotExcludes(snapshotOptions, dataDir, true)); err != nil {
 			return 0, err
 		}
 	}
@@ -301,8 +319,49 @@ func EstimateSnapshotSize(si *snap.Info, usernames []string) (uint64, error) {
 	return total, nil
 }
 
-// Save a snapshot
-func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string) (*client.Snapshot, error) {
+// snapshotExcludes returns the snapshot exclusion patterns that apply to
+// the system archive, or to the user archives if user is set, relative
+// to the parent directory of the given data directory (as the paths in
+// the archive are).
+func snapshotExcludes(opts *snap.SnapshotOptions, dataDir string, user bool) []string {
+	if opts == nil {
+		return nil
+	}
+	dataVar, commonVar := "$SNAP_DATA/", "$SNAP_COMMON/"
+	if user {
+		dataVar, commonVar = "$SNAP_USER_DATA/", "$SNAP_USER_COMMON/"
+	}
+	revdir := filepath.Base(dataDir)
+
+	var excludes []string
+	for _, pattern := range opts.Exclude {
+		switch {
+		case strings.HasPrefix(pattern, dataVar):
+			excludes = append(excludes, filepath.Join(revdir, pattern[len(dataVar):]))
+		case strings.HasPrefix(pattern, commonVar):
+			excludes = append(excludes, filepath.Join("common", pattern[len(commonVar):]))
+		}
+	}
+	return excludes
+}
+
+// isExcluded returns whether the given path, relative to the parent of
+// the data directories, matches one of the exclusion patterns. The
+// contents of an excluded directory are excluded too, but that is left
+// to the caller.
+func isExcluded(path string, excludes []string) bool {
+	for _, pattern := range excludes {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Save a snapshot. If a key is given, the archives are encrypted with a
+// key derived from it; otherwise the archives are stored in the chunk
+// store, sharing the chunks that did not change with other snapshots.
+func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
 	if err := os.MkdirAll(dirs.SnapshotsDir, 0700); err != nil {
 		return nil, err
 	}
@@ -321,6 +380,27 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 		// Note: Auto is no longer set in the Snapshot.
 	}
 
+	snapshotOptions, err := snap.ReadSnapshotYaml(si)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Options = snapshotOptions
+
+	var aead cipher.AEAD
+	if key != nil {
+		snapshot.Encryption, aead, err = newEncryption(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set up snapshot encryption: %v", err)
+		}
+	} else {
+		// encrypted archives would not deduplicate anyway
+		snapshot.Chunked = true
+		// chunks that are in the store must stay there until
+		// the snapshot references them
+		chunkStoreLock.RLock()
+		defer chunkStoreLock.RUnlock()
+	}
+
 	aw, err := osutil.NewAtomicFile(Filename(snapshot), 0600, 0, osutil.NoChown, osutil.NoChown)
 	if err != nil {
 		return nil, err
@@ -330,7 +410,7 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 
 	w := zip.NewWriter(aw)
 	defer w.Close() // note this does not close the file descriptor (that's done by hand on the atomic writer, above)
-	if err := addDirToZip(ctx, snapshot, w, "root", archiveName, si.DataDir()); err != nil {
+	if err := addDirToZip(ctx, snapshot, w, aead, "root", archiveName, si.DataDir(), snapshotExcludes(snapshotOptions, si.DataDir(), false)); err != nil {
 		return nil, err
 	}
 
@@ -340,7 +420,8 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 	}
 
 	for _, usr := range users {
-		if err := addDirToZip(ctx, snapshot, w, usr.Username, userArchiveName(usr), si.UserDataDir(usr.HomeDir)); err != nil {
+		dataDir := si.UserDataDir(usr.HomeDir)
+		if err := addDirToZip(ctx, snapshot, w, aead, usr.Username, userArchiveName(usr), dataDir, snapshotExcludes(snapshotOptions, dataDir, true)); err != nil {
 			return nil, err
 		}
 	}
@@ -373,12 +454,19 @@ func Save(ctx context.Context, id uint64, si *snap.Info, cfg map[string]interfac
 		return nil, err
 	}
 
+	if snapshot.Chunked {
+		if err := refSnapshotChunks(Filename(snapshot)); err != nil {
+			os.Remove(Filename(snapshot))
+			return nil, fmt.Errorf("cannot reference snapshot chunks: %v", err)
+		}
+	}
+
 	return snapshot, nil
 }
 
 var isTesting = snapdenv.Testing()
 
-func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, username string, entry, dir string) error {
+func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer, aead cipher.AEAD, username string, entry, dir string, excludes []string) error {
 	parent, revdir := filepath.Split(dir)
 	exists, isDir, err := osutil.DirExists(parent)
 	if err != nil {
@@ -394,10 +482,22 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 	}
 	tarArgs := []string{
 		"--create",
-		"--sparse", "--gzip",
+		"--sparse",
 		"--format", "gnu",
 		"--directory", parent,
 	}
+	if !snapshot.Chunked {
+		// chunks are compressed individually
+		tarArgs = append(tarArgs, "--gzip")
+	}
+	if len(excludes) > 0 {
+		// match the patterns like filepath.Match does, as
+		// EstimateSnapshotSize does
+		tarArgs = append(tarArgs, "--anchored", "--wildcards", "--no-wildcards-match-slash")
+		for _, pattern := range excludes {
+			tarArgs = append(tarArgs, "--exclude", pattern)
+		}
+	}
 
 	noRev, noCommon := true, true
 
@@ -443,7 +543,22 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 	hasher := crypto.SHA3_384.New()
 
 	cmd := tarAsUser(username, tarArgs...)
+	// the hash and size are the ones of the archive as stored
 	cmd.Stdout = io.MultiWriter(archiveWriter, hasher, &sz)
+	var encWriter *encryptingWriter
+	if aead != nil {
+		encWriter, err = newEncryptingWriter(cmd.Stdout, aead, entry)
+		if err != nil {
+			return err
+		}
+		cmd.Stdout = encWriter
+	}
+	var chunkWriter *chunkingWriter
+	if snapshot.Chunked {
+		// the archive as stored is the manifest of its chunks
+		chunkWriter = &chunkingWriter{}
+		cmd.Stdout = chunkWriter
+	}
 	matchCounter := &strutil.MatchCounter{N: 1}
 	cmd.Stderr = matchCounter
 	if isTesting {
@@ -457,6 +572,21 @@ func addDirToZip(ctx context.Context, snapshot *client.Snapshot, w *zip.Writer,
 		}
 		return fmt.Errorf("tar failed: %v", err)
 	}
+	if encWriter != nil {
+		if err := encWriter.Close(); err != nil {
+			return err
+		}
+	}
+	if chunkWriter != nil {
+		if err := chunkWriter.Close(); err != nil {
+			return err
+		}
+		if err := writeManifest(io.MultiWriter(archiveWriter, hasher), chunkWriter.manifest); err != nil {
+			return err
+		}
+		// the size of a chunked snapshot is that of its chunks
+		snapshot.Size += chunkWriter.stored
+	}
 
 	snapshot.SHA3_384[entry] = fmt.Sprintf("%x", hasher.Sum(nil))
 	snapshot.Size += sz.Size()
@@ -645,8 +775,9 @@ func CleanupAbandondedImports() (cleaned int, err error) {
 	return cleaned, nil
 }
 
-// Import a snapshot from the export file format
-func Import(ctx context.Context, id uint64, r io.Reader) (snapNames []string, err error) {
+// Import a snapshot from the export file format. The key is needed to
+// verify encrypted snapshots.
+func Import(ctx context.Context, id uint64, r io.Reader, key []byte) (snapNames []string, err error) {
 	errPrefix := fmt.Sprintf("cannot import snapshot %d", id)
 
 	tr := newImportTransaction(id)
@@ -659,11 +790,20 @@ func Import(ctx context.Context, id uint64, r io.Reader) (snapNames []string, er
 	// Cancel once Committed is a NOP
 	defer tr.Cancel()
 
+	// imported chunks must stay in the store until referenced
+	chunkStoreLock.RLock()
+	defer chunkStoreLock.RUnlock()
+
 	// Unpack and validate the streamed data
-	snapNames, err = unpackVerifySnapshotImport(r, id)
+	snapNames, chunkRefs, err := unpackVerifySnapshotImport(r, id, key)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %v", errPrefix, err)
 	}
+	if len(chunkRefs) > 0 {
+		if _, err := updateChunkRefs(chunkRefs, nil); err != nil {
+			return nil, fmt.Errorf("%s: %v", errPrefix, err)
+		}
+	}
 	if err := tr.Commit(); err != nil {
 		return nil, err
 	}
@@ -684,7 +824,30 @@ func writeOneSnapshotFile(targetPath string, tr io.Reader) error {
 	return nil
 }
 
-func unpackVerifySnapshotImport(r io.Reader, realSetID uint64) (snapNames []string, err error) {
+func writeImportedChunk(name string, tr io.Reader) error {
+	chunkHash := strings.TrimPrefix(name, exportChunksPrefix)
+	if !isChunkHash(chunkHash) {
+		return fmt.Errorf("unexpected chunk filename in import stream: %v", name)
+	}
+	if osutil.FileExists(chunkPath(chunkHash)) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(chunkPath(chunkHash)), 0700); err != nil {
+		return err
+	}
+	// the chunk is verified when checking the snapshots using it
+	aw, err := osutil.NewAtomicFile(chunkPath(chunkHash), 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return err
+	}
+	defer aw.Cancel()
+	if _, err := io.Copy(aw, tr); err != nil {
+		return fmt.Errorf("cannot write snapshot chunk %.7s…: %v", chunkHash, err)
+	}
+	return aw.Commit()
+}
+
+func unpackVerifySnapshotImport(r io.Reader, realSetID uint64, key []byte) (snapNames, chunkRefs []string, err error) {
 	var exportFound bool
 
 	tr := tar.NewReader(r)
@@ -698,12 +861,20 @@ func unpackVerifySnapshotImport(r io.Reader, realSetID uint64) (snapNames []stri
 		}
 		switch {
 		case tarErr != nil:
-			return nil, fmt.Errorf("cannot read snapshot import: %v", tarErr)
+			return nil, nil, fmt.Errorf("cannot read snapshot import: %v", tarErr)
 		case header == nil:
 			// should not happen
-			return nil, fmt.Errorf("tar header not found")
+			return nil, nil, fmt.Errorf("tar header not found")
 		case header.Typeflag == tar.TypeDir:
-			return nil, errors.New("unexpected directory in import file")
+			return nil, nil, errors.New("unexpected directory in import file")
+		}
+
+		if strings.HasPrefix(header.Name, exportChunksPrefix) {
+			// the chunks come before the snapshots using them
+			if err := writeImportedChunk(header.Name, tr); err != nil {
+				return nil, nil, err
+			}
+			continue
 		}
 
 		if header.Name == "export.json" {
@@ -722,42 +893,59 @@ func unpackVerifySnapshotImport(r io.Reader, realSetID uint64) (snapNames []stri
 		// the rest that is still valid.
 		l := strings.SplitN(header.Name, "_", 2)
 		if len(l) != 2 {
-			return nil, fmt.Errorf("unexpected filename in import stream: %v", header.Name)
+			return nil, nil, fmt.Errorf("unexpected filename in import stream: %v", header.Name)
 		}
 		targetPath := path.Join(dirs.SnapshotsDir, fmt.Sprintf("%d_%s", realSetID, l[1]))
 		if err := writeOneSnapshotFile(targetPath, tr); err != nil {
-			return snapNames, err
+			return snapNames, nil, err
 		}
 
 		r, err := backendOpen(targetPath, realSetID)
 		if err != nil {
-			return snapNames, fmt.Errorf("cannot open snapshot: %v", err)
+			return snapNames, nil, fmt.Errorf("cannot open snapshot: %v", err)
 		}
-		err = r.Check(context.TODO(), nil)
+		if key != nil {
+			err = r.UseKey(key)
+		}
+		if err == nil {
+			err = r.Check(context.TODO(), nil)
+		}
+		var refs []string
+		if err == nil {
+			refs, err = r.chunkRefs()
+		}
+		chunkRefs = append(chunkRefs, refs...)
 		r.Close()
 		snapNames = append(snapNames, r.Snap)
 		if err != nil {
-			return snapNames, fmt.Errorf("validation failed for %q: %v", targetPath, err)
+			return snapNames, nil, fmt.Errorf("validation failed for %q: %v", targetPath, err)
 		}
 	}
 
 	if !exportFound {
-		return nil, fmt.Errorf("no export.json file in uploaded data")
+		return nil, nil, fmt.Errorf("no export.json file in uploaded data")
 	}
 	// XXX: validate using the unmarshalled export.json hashes here
 
-	return snapNames, nil
+	return snapNames, chunkRefs, nil
 }
 
+// exportChunksPrefix is the prefix of the names of the chunks used by
+// the exported snapshots in the export file.
+const exportChunksPrefix = "chunks/"
+
 type exportMetadata struct {
 	Format int       `json:"format"`
 	Date   time.Time `json:"date"`
 	Files  []string  `json:"files"`
+	Chunks []string  `json:"chunks,omitempty"`
 }
 
 type SnapshotExport struct {
 	// open snapshot files
 	snapshotFiles []*os.File
+	// chunks used by the snapshots, opened when streaming
+	chunks []string
 
 	// remember setID mostly for nicer errors
 	setID uint64
@@ -770,6 +958,8 @@ type SnapshotExport struct {
 // Close()ed after use to avoid leaking file descriptors.
 func NewSnapshotExport(ctx context.Context, setID uint64) (se *SnapshotExport, err error) {
 	var snapshotFiles []*os.File
+	var chunks []string
+	seenChunks := make(map[string]bool)
 
 	defer func() {
 		// cleanup any open FDs if anything goes wrong
@@ -798,6 +988,17 @@ func NewSnapshotExport(ctx context.Context, setID uint64) (se *SnapshotExport, e
 				return fmt.Errorf("cannot open file from descriptor %d", fd)
 			}
 			snapshotFiles = append(snapshotFiles, f)
+
+			refs, err := reader.chunkRefs()
+			if err != nil {
+				return err
+			}
+			for _, chunkHash := range refs {
+				if !seenChunks[chunkHash] {
+					seenChunks[chunkHash] = true
+					chunks = append(chunks, chunkHash)
+				}
+			}
 		}
 		return nil
 	})
@@ -808,7 +1009,9 @@ func NewSnapshotExport(ctx context.Context, setID uint64) (se *SnapshotExport, e
 		return nil, fmt.Errorf("no snapshot data found for %v", setID)
 	}
 
-	se = &SnapshotExport{snapshotFiles: snapshotFiles, setID: setID}
+	sort.Strings(chunks)
+
+	se = &SnapshotExport{snapshotFiles: snapshotFiles, chunks: chunks, setID: setID}
 
 	// ensure we never leak FDs even if the user does not call close
 	runtime.SetFinalizer(se, (*SnapshotExport).Close)
@@ -818,7 +1021,8 @@ func NewSnapshotExport(ctx context.Context, setID uint64) (se *SnapshotExport, e
 
 // Init will calculate the snapshot size. This can take some time
 // so it should be called without any locks. The SnapshotExport
-// keeps the FDs open so even files moved/deleted will be found.
+// keeps the FDs open so even files moved/deleted will be found;
+// the chunks used by the snapshots are only opened when streaming.
 func (se *SnapshotExport) Init() error {
 	// Export once into a dummy writer so that we can set the size
 	// of the export. This is then used to set the Content-Length
@@ -852,6 +1056,13 @@ func (se *SnapshotExport) StreamTo(w io.Writer) error {
 	var files []string
 	tw := tar.NewWriter(w)
 	defer tw.Close()
+	// the chunks go first so that they are in place when the
+	// snapshots using them get verified on import
+	for _, chunkHash := range se.chunks {
+		if err := streamChunkTo(tw, chunkHash); err != nil {
+			return err
+		}
+	}
 	for _, snapshotFile := range se.snapshotFiles {
 		stat, err := snapshotFile.Stat()
 		if err != nil {
@@ -884,6 +1095,7 @@ func (se *SnapshotExport) StreamTo(w io.Writer) error {
 		Format: 1,
 		Date:   timeNow(),
 		Files:  files,
+		Chunks: se.chunks,
 	}
 	metaDataBuf, err := json.Marshal(&meta)
 	if err != nil {
@@ -905,3 +1117,29 @@ func (se *SnapshotExport) StreamTo(w io.Writer) error {
 
 	return nil
 }
+
+func streamChunkTo(tw *tar.Writer, chunkHash string) error {
+	f, err := os.Open(chunkPath(chunkHash))
+	if err != nil {
+		return fmt.Errorf("cannot open snapshot chunk %.7s…: %v", chunkHash, err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     exportChunksPrefix + chunkHash,
+		Size:     stat.Size(),
+		Mode:     0600,
+		ModTime:  stat.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("cannot write header for chunk %.7s…: %v", chunkHash, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("cannot write data for chunk %.7s…: %v", chunkHash, err)
+	}
+	return nil
+}
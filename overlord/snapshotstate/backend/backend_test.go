@@ -23,6 +23,7 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto"
 	"encoding/json"
@@ -122,6 +123,8 @@ func (s *snapshotSuite) SetUpTest(c *check.C) {
 		return &rv, nil
 	}),
 		backend.MockIsTesting(s.isTesting),
+		// keep deriving keys cheap
+		backend.MockKdfCount(1024),
 	)
 
 	s.tarPath, err = exec.LookPath("tar")
@@ -448,7 +451,7 @@ func (s *snapshotSuite) TestIterSetIDoverride(c *check.C) {
 	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33", Epoch: epoch}
 	cfg := map[string]interface{}{"some-setting": false}
 
-	shw, err := backend.Save(context.TODO(), 12, info, cfg, []string{"snapuser"})
+	shw, err := backend.Save(context.TODO(), 12, info, cfg, []string{"snapuser"}, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(shw.SetID, check.Equals, uint64(12))
 
@@ -558,11 +561,11 @@ func (s *snapshotSuite) TestAddDirToZipBails(c *check.C) {
 	buf, restore := logger.MockLogger()
 	defer restore()
 	// note as the zip is nil this would panic if it didn't bail
-	c.Check(backend.AddDirToZip(nil, snapshot, nil, "", "an/entry", filepath.Join(s.root, "nonexistent")), check.IsNil)
+	c.Check(backend.AddDirToZip(nil, snapshot, nil, nil, "", "an/entry", filepath.Join(s.root, "nonexistent"), nil), check.IsNil)
 	// no log for the non-existent case
 	c.Check(buf.String(), check.Equals, "")
 	buf.Reset()
-	c.Check(backend.AddDirToZip(nil, snapshot, nil, "", "an/entry", "/etc/passwd"), check.IsNil)
+	c.Check(backend.AddDirToZip(nil, snapshot, nil, nil, "", "an/entry", "/etc/passwd", nil), check.IsNil)
 	c.Check(buf.String(), check.Matches, "(?m).* is not a directory.")
 }
 
@@ -576,7 +579,7 @@ func (s *snapshotSuite) TestAddDirToZipTarFails(c *check.C) {
 
 	var buf bytes.Buffer
 	z := zip.NewWriter(&buf)
-	c.Assert(backend.AddDirToZip(ctx, nil, z, "", "an/entry", d), check.ErrorMatches, ".* context canceled")
+	c.Assert(backend.AddDirToZip(ctx, &client.Snapshot{}, z, nil, "", "an/entry", d, nil), check.ErrorMatches, ".* context canceled")
 }
 
 func (s *snapshotSuite) TestAddDirToZip(c *check.C) {
@@ -590,7 +593,7 @@ func (s *snapshotSuite) TestAddDirToZip(c *check.C) {
 	snapshot := &client.Snapshot{
 		SHA3_384: map[string]string{},
 	}
-	c.Assert(backend.AddDirToZip(context.Background(), snapshot, z, "", "an/entry", d), check.IsNil)
+	c.Assert(backend.AddDirToZip(context.Background(), snapshot, z, nil, "", "an/entry", d, nil), check.IsNil)
 	z.Close() // write out the central directory
 
 	c.Check(snapshot.SHA3_384, check.HasLen, 1)
@@ -603,6 +606,68 @@ func (s *snapshotSuite) TestAddDirToZip(c *check.C) {
 	c.Check(r.File[0].Name, check.Equals, "an/entry")
 }
 
+func (s *snapshotSuite) TestAddDirToZipExcludes(c *check.C) {
+	d := filepath.Join(s.root, "foo")
+	for _, fn := range []string{"foo/keep", "foo/cache/a", "foo/cache/b/c", "foo/data.tmp", "foo/sub/data.tmp", "common/keep", "common/log"} {
+		c.Assert(os.MkdirAll(filepath.Dir(filepath.Join(s.root, fn)), 0755), check.IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(s.root, fn), []byte("hello\n"), 0644), check.IsNil)
+	}
+
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	snapshot := &client.Snapshot{
+		SHA3_384: map[string]string{},
+	}
+	excludes := []string{"foo/cache", "foo/*.tmp", "common/log"}
+	c.Assert(backend.AddDirToZip(context.Background(), snapshot, z, nil, "root", "an/entry", d, excludes), check.IsNil)
+	z.Close()
+
+	br := bytes.NewReader(buf.Bytes())
+	r, err := zip.NewReader(br, int64(br.Len()))
+	c.Assert(err, check.IsNil)
+	c.Assert(r.File, check.HasLen, 1)
+	rc, err := r.File[0].Open()
+	c.Assert(err, check.IsNil)
+	defer rc.Close()
+	gz, err := gzip.NewReader(rc)
+	c.Assert(err, check.IsNil)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, check.IsNil)
+		names = append(names, strings.TrimSuffix(hdr.Name, "/"))
+	}
+	sort.Strings(names)
+	c.Check(names, check.DeepEquals, []string{"common", "common/keep", "foo", "foo/keep", "foo/sub", "foo/sub/data.tmp"})
+}
+
+func (s *snapshotSuite) TestSaveExcludes(c *check.C) {
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42)}, Version: "v1.33"}
+	c.Assert(os.MkdirAll(filepath.Join(info.MountDir(), "meta"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(info.MountDir(), "meta/snapshots.yaml"), []byte("exclude: [$SNAP_COMMON/bar]\n"), 0644), check.IsNil)
+
+	shw, err := backend.Save(context.TODO(), 1, info, nil, nil, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(shw.Options, check.DeepEquals, &snap.SnapshotOptions{Exclude: []string{"$SNAP_COMMON/bar"}})
+
+	shr, err := backend.Open(backend.Filename(shw), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Check(shr.Options, check.DeepEquals, shw.Options)
+
+	c.Assert(os.RemoveAll(info.DataDir()), check.IsNil)
+	c.Assert(os.RemoveAll(info.CommonDataDir()), check.IsNil)
+	rs, err := shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+	c.Check(filepath.Join(info.DataDir(), "foo"), testutil.FileEquals, "versioned system canary\n")
+	c.Check(filepath.Join(info.CommonDataDir(), "bar"), testutil.FileAbsent)
+}
+
 func (s *snapshotSuite) TestHappyRoundtrip(c *check.C) {
 	s.testHappyRoundtrip(c, "marker")
 }
@@ -636,7 +701,7 @@ func (s *snapshotSuite) testHappyRoundtrip(c *check.C, marker string) {
 	cfg := map[string]interface{}{"some-setting": false}
 	shID := uint64(12)
 
-	shw, err := backend.Save(context.TODO(), shID, info, cfg, []string{"snapuser"})
+	shw, err := backend.Save(context.TODO(), shID, info, cfg, []string{"snapuser"}, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(shw.SetID, check.Equals, shID)
 	c.Check(shw.Snap, check.Equals, info.InstanceName())
@@ -678,7 +743,7 @@ func (s *snapshotSuite) testHappyRoundtrip(c *check.C, marker string) {
 	dirs.SetRootDir(newroot)
 
 	var diff = func() *exec.Cmd {
-		cmd := exec.Command("diff", "-urN", "-x*.zip", s.root, newroot)
+		cmd := exec.Command("diff", "-urN", "-x*.zip", "-xchunks", s.root, newroot)
 		// cmd.Stdout = os.Stdout
 		// cmd.Stderr = os.Stderr
 		return cmd
@@ -710,7 +775,7 @@ func (s *snapshotSuite) TestOpenSetIDoverride(c *check.C) {
 	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33", Epoch: epoch}
 	cfg := map[string]interface{}{"some-setting": false}
 
-	shw, err := backend.Save(context.TODO(), 12, info, cfg, []string{"snapuser"})
+	shw, err := backend.Save(context.TODO(), 12, info, cfg, []string{"snapuser"}, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(shw.SetID, check.Equals, uint64(12))
 
@@ -734,7 +799,7 @@ func (s *snapshotSuite) TestRestoreRoundtripDifferentRevision(c *check.C) {
 	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33", Epoch: epoch}
 	shID := uint64(12)
 
-	shw, err := backend.Save(context.TODO(), shID, info, nil, []string{"snapuser"})
+	shw, err := backend.Save(context.TODO(), shID, info, nil, []string{"snapuser"}, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(shw.Revision, check.Equals, info.Revision)
 
@@ -758,7 +823,7 @@ func (s *snapshotSuite) TestRestoreRoundtripDifferentRevision(c *check.C) {
 	dirs.SetRootDir(newroot)
 
 	var diff = func() *exec.Cmd {
-		cmd := exec.Command("diff", "-urN", "-x*.zip", s.root, newroot)
+		cmd := exec.Command("diff", "-urN", "-x*.zip", "-xchunks", s.root, newroot)
 		// cmd.Stdout = os.Stdout
 		// cmd.Stderr = os.Stderr
 		return cmd
@@ -952,7 +1017,7 @@ func (s *snapshotSuite) TestImport(c *check.C) {
 		c.Assert(err, check.IsNil, comm)
 		defer f.Close()
 
-		snapNames, err := backend.Import(context.Background(), t.setID, f)
+		snapNames, err := backend.Import(context.Background(), t.setID, f, nil)
 		if t.error != "" {
 			c.Check(err, check.ErrorMatches, t.error, comm)
 			continue
@@ -985,7 +1050,7 @@ func (s *snapshotSuite) TestImportCheckErorr(c *check.C) {
 
 	f, err := os.Open(tarFile1)
 	c.Assert(err, check.IsNil)
-	_, err = backend.Import(context.Background(), 14, f)
+	_, err = backend.Import(context.Background(), 14, f, nil)
 	c.Assert(err, check.ErrorMatches, `cannot import snapshot 14: validation failed for .+/14_foo_1.0_199.zip": snapshot entry "archive.tgz" expected hash \(d5ef563…\) does not match actual \(6655519…\)`)
 }
 
@@ -1000,7 +1065,7 @@ func (s *snapshotSuite) TestImportExportRoundtrip(c *check.C) {
 	cfg := map[string]interface{}{"some-setting": false}
 	shID := uint64(12)
 
-	shw, err := backend.Save(ctx, shID, info, cfg, []string{"snapuser"})
+	shw, err := backend.Save(ctx, shID, info, cfg, []string{"snapuser"}, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(shw.SetID, check.Equals, shID)
 
@@ -1018,7 +1083,7 @@ func (s *snapshotSuite) TestImportExportRoundtrip(c *check.C) {
 	// now import it
 	c.Assert(os.Remove(filepath.Join(dirs.SnapshotsDir, "12_hello-snap_v1.33_42.zip")), check.IsNil)
 
-	names, err := backend.Import(ctx, 123, buf)
+	names, err := backend.Import(ctx, 123, buf, nil)
 	c.Assert(err, check.IsNil)
 	c.Check(names, check.DeepEquals, []string{"hello-snap"})
 
@@ -1035,6 +1100,206 @@ func (s *snapshotSuite) TestImportExportRoundtrip(c *check.C) {
 	c.Check(rdr.IsValid(), check.Equals, true)
 }
 
+func (s *snapshotSuite) TestImportExportRoundtripEncrypted(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	err := os.MkdirAll(dirs.SnapshotsDir, 0755)
+	c.Assert(err, check.IsNil)
+
+	ctx := context.TODO()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	key := []byte("sekrit")
+
+	shw, err := backend.Save(ctx, 12, info, nil, []string{"snapuser"}, key)
+	c.Assert(err, check.IsNil)
+	c.Assert(shw.Encryption, check.NotNil)
+	c.Check(shw.Encryption.Cipher, check.Equals, "aes-256-gcm")
+	c.Check(shw.Encryption.KDF, check.Equals, "openpgp-s2k-iterated-sha256")
+	c.Check(shw.Encryption.Salt, check.HasLen, 16)
+	c.Check(shw.Encryption.Count, check.Equals, 1024)
+	c.Check(hashkeys(shw), check.DeepEquals, []string{"archive.tgz", "user/snapuser.tgz"})
+
+	// the data is not stored in the clear
+	rdr, err := backend.Open(backend.Filename(shw), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	c.Check(rdr.Encryption, check.DeepEquals, shw.Encryption)
+	c.Check(rdr.Check(ctx, nil), check.Equals, backend.ErrKeyNeeded)
+	_, err = rdr.Restore(ctx, snap.R(0), nil, logger.Debugf)
+	c.Check(err, check.Equals, backend.ErrKeyNeeded)
+	c.Check(rdr.UseKey([]byte("wrong")), check.Equals, backend.ErrWrongKey)
+	c.Assert(rdr.UseKey(key), check.IsNil)
+	c.Check(rdr.Check(ctx, nil), check.IsNil)
+	rdr.Close()
+
+	export, err := backend.NewSnapshotExport(ctx, shw.SetID)
+	c.Assert(err, check.IsNil)
+	c.Assert(export.Init(), check.IsNil)
+	buf := bytes.NewBuffer(nil)
+	c.Assert(export.StreamTo(buf), check.IsNil)
+	c.Assert(os.Remove(backend.Filename(shw)), check.IsNil)
+	exported := buf.Bytes()
+
+	_, err = backend.Import(ctx, 123, bytes.NewReader(exported), nil)
+	c.Check(err, check.ErrorMatches, `cannot import snapshot 123: validation failed for .*: cannot access the data of an encrypted snapshot without its key`)
+	_, err = backend.Import(ctx, 123, bytes.NewReader(exported), []byte("wrong"))
+	c.Check(err, check.ErrorMatches, `cannot import snapshot 123: validation failed for .*: cannot use key: the snapshot was encrypted with a different one`)
+
+	names, err := backend.Import(ctx, 123, bytes.NewReader(exported), key)
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"hello-snap"})
+}
+
+func (s *snapshotSuite) TestEncryptedRoundtrip(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	logger.SimpleSetup()
+
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+	key := []byte("sekrit")
+
+	shw, err := backend.Save(context.TODO(), 12, info, nil, []string{"snapuser"}, key)
+	c.Assert(err, check.IsNil)
+
+	shr, err := backend.Open(backend.Filename(shw), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	defer shr.Close()
+	c.Assert(shr.UseKey(key), check.IsNil)
+
+	newroot := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(newroot, "home/snapuser"), 0755), check.IsNil)
+	dirs.SetRootDir(newroot)
+
+	rs, err := shr.Restore(context.TODO(), snap.R(0), nil, logger.Debugf)
+	c.Assert(err, check.IsNil)
+	rs.Cleanup()
+	c.Check(exec.Command("diff", "-urN", "-x*.zip", s.root, newroot).Run(), check.IsNil)
+}
+
+func chunkFiles(c *check.C) []string {
+	chunks, err := filepath.Glob(filepath.Join(dirs.SnapshotsDir, "chunks", "*", "*"))
+	c.Assert(err, check.IsNil)
+	return chunks
+}
+
+func (s *snapshotSuite) TestChunkedRemove(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	ctx := context.TODO()
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+
+	sh1, err := backend.Save(ctx, 1, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(sh1.Chunked, check.Equals, true)
+	chunks := chunkFiles(c)
+	c.Assert(chunks, check.Not(check.HasLen), 0)
+
+	// the same data is stored only once
+	sh2, err := backend.Save(ctx, 2, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(chunkFiles(c), check.DeepEquals, chunks)
+
+	// the chunks are kept while a snapshot uses them
+	c.Assert(backend.Remove(backend.Filename(sh1)), check.IsNil)
+	c.Check(osutil.FileExists(backend.Filename(sh1)), check.Equals, false)
+	c.Check(chunkFiles(c), check.DeepEquals, chunks)
+	r, err := backend.Open(backend.Filename(sh2), backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	c.Check(r.Check(ctx, nil), check.IsNil)
+	r.Close()
+
+	// and removed with the last one
+	c.Assert(backend.Remove(backend.Filename(sh2)), check.IsNil)
+	c.Check(chunkFiles(c), check.HasLen, 0)
+	c.Check(filepath.Join(dirs.SnapshotsDir, "chunks", "refcounts.json"), testutil.FileAbsent)
+}
+
+func (s *snapshotSuite) TestChunkedImportAfterRemove(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	ctx := context.TODO()
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+
+	shw, err := backend.Save(ctx, 12, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, check.IsNil)
+	chunks := chunkFiles(c)
+
+	export, err := backend.NewSnapshotExport(ctx, shw.SetID)
+	c.Assert(err, check.IsNil)
+	buf := bytes.NewBuffer(nil)
+	c.Assert(export.StreamTo(buf), check.IsNil)
+	export.Close()
+
+	c.Assert(backend.Remove(backend.Filename(shw)), check.IsNil)
+	c.Check(chunkFiles(c), check.HasLen, 0)
+
+	// the export brings the chunks along
+	names, err := backend.Import(ctx, 123, buf, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(names, check.DeepEquals, []string{"hello-snap"})
+	c.Check(chunkFiles(c), check.DeepEquals, chunks)
+
+	fn := filepath.Join(dirs.SnapshotsDir, "123_hello-snap_v1.33_42.zip")
+	r, err := backend.Open(fn, backend.ExtractFnameSetID)
+	c.Assert(err, check.IsNil)
+	c.Check(r.Check(ctx, nil), check.IsNil)
+	r.Close()
+
+	// and references them
+	c.Assert(backend.Remove(fn), check.IsNil)
+	c.Check(chunkFiles(c), check.HasLen, 0)
+}
+
+func (s *snapshotSuite) TestCleanupUnreferencedChunks(c *check.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("this test cannot run as root (runuser will fail)")
+	}
+	ctx := context.TODO()
+	info := &snap.Info{SideInfo: snap.SideInfo{RealName: "hello-snap", Revision: snap.R(42), SnapID: "hello-id"}, Version: "v1.33"}
+
+	shw, err := backend.Save(ctx, 12, info, nil, []string{"snapuser"}, nil)
+	c.Assert(err, check.IsNil)
+	chunks := chunkFiles(c)
+
+	// a chunk left behind by an interrupted save
+	_, _, err = backend.WriteChunked([]byte("stray data"))
+	c.Assert(err, check.IsNil)
+	c.Check(chunkFiles(c), check.HasLen, len(chunks)+1)
+	// and lost reference counts
+	c.Assert(os.Remove(filepath.Join(dirs.SnapshotsDir, "chunks", "refcounts.json")), check.IsNil)
+
+	removed, err := backend.CleanupUnreferencedChunks()
+	c.Assert(err, check.IsNil)
+	c.Check(removed, check.Equals, 1)
+	c.Check(chunkFiles(c), check.DeepEquals, chunks)
+
+	// the reference counts were rebuilt
+	c.Assert(backend.Remove(backend.Filename(shw)), check.IsNil)
+	c.Check(chunkFiles(c), check.HasLen, 0)
+}
+
+func (s *snapshotSuite) TestCleanupUnreferencedChunksNoStore(c *check.C) {
+	removed, err := backend.CleanupUnreferencedChunks()
+	c.Assert(err, check.IsNil)
+	c.Check(removed, check.Equals, 0)
+}
+
+func (s *snapshotSuite) TestCleanupUnreferencedChunksBrokenSnapshot(c *check.C) {
+	_, _, err := backend.WriteChunked([]byte("some data"))
+	c.Assert(err, check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapshotsDir, "1_foo_1.0_1.zip"), []byte("not a zip"), 0600), check.IsNil)
+
+	// the chunks the broken snapshot uses are unknown so nothing is removed
+	removed, err := backend.CleanupUnreferencedChunks()
+	c.Assert(err, check.ErrorMatches, "cannot determine the chunks used by all snapshots")
+	c.Check(removed, check.Equals, 0)
+	c.Check(chunkFiles(c), check.HasLen, 1)
+}
+
 func (s *snapshotSuite) TestEstimateSnapshotSize(c *check.C) {
 	restore := backend.MockUsersForUsernames(func(usernames []string) ([]*user.User, error) {
 		return []*user.User{{HomeDir: filepath.Join(s.root, "home/user1")}}, nil
@@ -1071,6 +1336,56 @@ func (s *snapshotSuite) TestEstimateSnapshotSize(c *check.C) {
 	c.Check(sz, check.Equals, uint64(expected))
 }
 
+func (s *snapshotSuite) TestEstimateSnapshotSizeExcludes(c *check.C) {
+	restore := backend.MockUsersForUsernames(func(usernames []string) ([]*user.User, error) {
+		return []*user.User{{HomeDir: filepath.Join(s.root, "home/user1")}}, nil
+	})
+	defer restore()
+
+	var info = &snap.Info{
+		SuggestedName: "foo",
+		SideInfo: snap.SideInfo{
+			Revision: snap.R(7),
+		},
+	}
+	c.Assert(os.MkdirAll(filepath.Join(info.MountDir(), "meta"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(info.MountDir(), "meta/snapshots.yaml"), []byte(`exclude:
+  - $SNAP_DATA/cache
+  - $SNAP_COMMON/*.log
+  - $SNAP_USER_DATA/cache
+`), 0644), check.IsNil)
+
+	for fn, size := range map[string]int{
+		"/var/snap/foo/7/data":                 1,
+		"/var/snap/foo/7/cache/a":              10,
+		"/var/snap/foo/7/cache/b/c":            100,
+		"/var/snap/foo/common/some.log":        1000,
+		"/var/snap/foo/common/sub/some.log":    2,
+		"/home/user1/snap/foo/7/cache/a":       10000,
+		"/home/user1/snap/foo/7/data":          4,
+		"/home/user1/snap/foo/common/some.log": 8,
+	} {
+		c.Assert(os.MkdirAll(filepath.Dir(filepath.Join(s.root, fn)), 0755), check.IsNil)
+		c.Assert(ioutil.WriteFile(filepath.Join(s.root, fn), make([]byte, size), 0644), check.IsNil)
+	}
+
+	sz, err := backend.EstimateSnapshotSize(info, nil)
+	c.Assert(err, check.IsNil)
+	c.Check(sz, check.Equals, uint64(1+2+4+8))
+}
+
+func (s *snapshotSuite) TestEstimateSnapshotSizeBadSnapshotYaml(c *check.C) {
+	var info = &snap.Info{
+		SuggestedName: "foo",
+		SideInfo:      snap.SideInfo{Revision: snap.R(7)},
+	}
+	c.Assert(os.MkdirAll(filepath.Join(info.MountDir(), "meta"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(info.MountDir(), "meta/snapshots.yaml"), []byte("exclude: [/etc]\n"), 0644), check.IsNil)
+
+	_, err := backend.EstimateSnapshotSize(info, nil)
+	c.Check(err, check.ErrorMatches, `invalid meta/snapshots.yaml: snapshot exclude path must start with one of .*: "/etc"`)
+}
+
 func (s *snapshotSuite) TestEstimateSnapshotSizeEmpty(c *check.C) {
 	restore := backend.MockUsersForUsernames(func(usernames []string) ([]*user.User, error) {
 		return []*user.User{{HomeDir: filepath.Join(s.root, "home/user1")}}, nil
@@ -1146,11 +1461,11 @@ func (s *snapshotSuite) TestExportTwice(c *check.C) {
 	}
 	// create a snapshot
 	shID := uint64(12)
-	_, err := backend.Save(context.TODO(), shID, info, nil, []string{"snapuser"})
+	_, err := backend.Save(context.TODO(), shID, info, nil, []string{"snapuser"}, nil)
 	c.Check(err, check.IsNil)
 
-	// num_files + export.json + footer
-	expectedSize := int64(4*512 + 1024 + 2*512)
+	// num_files + one chunk per archive + export.json + footer
+	expectedSize := int64(4*512 + 2*1024 + 1024 + 2*512)
 	// do on export at the start of the epoch
 	restore := backend.MockTimeNow(func() time.Time { return time.Time{} })
 	defer restore()
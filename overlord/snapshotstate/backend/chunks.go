@@ -0,0 +1,518 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+)
+
+// Chunked snapshots do not store the tar archives of the snap data in
+// the snapshot zip file itself. Instead the (uncompressed) tar stream
+// is cut into content-defined chunks which are stored, compressed and
+// named after their hash, in a chunk store shared by all snapshots;
+// the zip only contains a manifest listing the chunks of each
+// archive. Chunks that did not change between two snapshots are
+// therefore only stored once.
+//
+// Chunks are reference counted by the snapshot files using them, so
+// that removing a snapshot file also removes the chunks no other
+// snapshot needs.
+
+const (
+	chunksDirName      = "chunks"
+	chunkRefCountsName = "refcounts.json"
+)
+
+var (
+	// chunkMinSize, chunkMaxSize and chunkMask control the
+	// content-defined chunking; with the default mask chunks are
+	// about 1MiB on average.
+	chunkMinSize        = 256 * 1024
+	chunkMaxSize        = 4 * 1024 * 1024
+	chunkMask    uint64 = (1<<20 - 1) << 44
+
+	// chunkStoreLock must be held for reading while adding chunks
+	// (and their references) to the store, and for writing while
+	// removing chunks from it.
+	chunkStoreLock sync.RWMutex
+	// refCountsLock serializes updates of the reference counts.
+	refCountsLock sync.Mutex
+)
+
+// gearTable is the table used by the rolling hash that finds the
+// chunk boundaries. It must never change, as that would move the
+// boundaries and defeat the deduplication of existing chunks.
+var gearTable = func() (table [256]uint64) {
+	// splitmix64 with a fixed seed
+	seed := uint64(0x736e617073686f74)
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+func chunksDir() string {
+	return filepath.Join(dirs.SnapshotsDir, chunksDirName)
+}
+
+func chunkPath(chunkHash string) string {
+	return filepath.Join(chunksDir(), chunkHash[:2], chunkHash)
+}
+
+func isChunkHash(s string) bool {
+	if len(s) != 2*crypto.SHA3_384.Size() {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// A manifestEntry describes one chunk of an archive.
+type manifestEntry struct {
+	hash string
+	size int64
+}
+
+func writeManifest(w io.Writer, manifest []manifestEntry) error {
+	for _, entry := range manifest {
+		if _, err := fmt.Fprintf(w, "%s %d\n", entry.hash, entry.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readManifest(r io.Reader) ([]manifestEntry, error) {
+	var manifest []manifestEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || !isChunkHash(fields[0]) {
+			return nil, fmt.Errorf("invalid chunk manifest line %q", scanner.Text())
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid chunk size in manifest line %q", scanner.Text())
+		}
+		manifest = append(manifest, manifestEntry{hash: fields[0], size: size})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeChunk adds the given data to the chunk store, unless it is
+// already there. It returns the size of the stored chunk.
+func writeChunk(chunkHash string, data []byte) (int64, error) {
+	p := chunkPath(chunkHash)
+	if fi, err := os.Stat(p); err == nil {
+		return fi.Size(), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	if err := osutil.AtomicWriteFile(p, buf.Bytes(), 0600, 0); err != nil {
+		return 0, fmt.Errorf("cannot store snapshot chunk: %v", err)
+	}
+	return int64(buf.Len()), nil
+}
+
+// chunkingWriter cuts the data written to it into chunks and adds
+// them to the chunk store.
+type chunkingWriter struct {
+	buf    []byte
+	rolled uint64
+
+	manifest []manifestEntry
+	// stored is the size of the chunks as stored
+	stored int64
+}
+
+func (cw *chunkingWriter) Write(p []byte) (int, error) {
+	for i, b := range p {
+		cw.buf = append(cw.buf, b)
+		cw.rolled = (cw.rolled << 1) + gearTable[b]
+		if len(cw.buf) < chunkMinSize {
+			continue
+		}
+		if cw.rolled&chunkMask == 0 || len(cw.buf) >= chunkMaxSize {
+			if err := cw.flush(); err != nil {
+				return i, err
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (cw *chunkingWriter) flush() error {
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	hasher := crypto.SHA3_384.New()
+	hasher.Write(cw.buf)
+	chunkHash := fmt.Sprintf("%x", hasher.Sum(nil))
+	sz, err := writeChunk(chunkHash, cw.buf)
+	if err != nil {
+		return err
+	}
+	cw.manifest = append(cw.manifest, manifestEntry{hash: chunkHash, size: int64(len(cw.buf))})
+	cw.stored += sz
+	cw.buf = cw.buf[:0]
+	return nil
+}
+
+// Close stores the last chunk.
+func (cw *chunkingWriter) Close() error {
+	return cw.flush()
+}
+
+// chunksReader reads the data of the chunks in a manifest from the
+// given chunk store directory, verifying each chunk as it goes.
+type chunksReader struct {
+	dir      string
+	manifest []manifestEntry
+
+	cur    *os.File
+	gz     *gzip.Reader
+	hasher hash.Hash
+	sz     osutil.Sizer
+}
+
+func newChunksReader(dir string, manifest []manifestEntry) *chunksReader {
+	return &chunksReader{dir: dir, manifest: manifest, hasher: crypto.SHA3_384.New()}
+}
+
+func (cr *chunksReader) next() error {
+	entry := cr.manifest[0]
+	f, err := os.Open(filepath.Join(cr.dir, entry.hash[:2], entry.hash))
+	if err != nil {
+		return fmt.Errorf("cannot open snapshot chunk %.7s…: %v", entry.hash, err)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("cannot read snapshot chunk %.7s…: %v", entry.hash, err)
+	}
+	cr.cur, cr.gz = f, gz
+	cr.hasher.Reset()
+	cr.sz.Reset()
+	return nil
+}
+
+func (cr *chunksReader) finish() error {
+	entry := cr.manifest[0]
+	cr.manifest = cr.manifest[1:]
+	cr.cur.Close()
+	cr.cur, cr.gz = nil, nil
+	if cr.sz.Size() != entry.size {
+		return fmt.Errorf("snapshot chunk %.7s… size (%d) different from actual (%d)", entry.hash, entry.size, cr.sz.Size())
+	}
+	if actualHash := fmt.Sprintf("%x", cr.hasher.Sum(nil)); actualHash != entry.hash {
+		return fmt.Errorf("snapshot chunk %.7s… does not match its hash (%.7s…)", entry.hash, actualHash)
+	}
+	return nil
+}
+
+func (cr *chunksReader) Read(p []byte) (int, error) {
+	for {
+		if cr.cur == nil {
+			if len(cr.manifest) == 0 {
+				return 0, io.EOF
+			}
+			if err := cr.next(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := cr.gz.Read(p)
+		cr.hasher.Write(p[:n])
+		cr.sz.Write(p[:n])
+		if err == io.EOF {
+			if err := cr.finish(); err != nil {
+				return n, err
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close releases the chunk being read, if any.
+func (cr *chunksReader) Close() error {
+	if cr.cur != nil {
+		return cr.cur.Close()
+	}
+	return nil
+}
+
+func loadChunkRefCounts() (map[string]int, error) {
+	refCounts := make(map[string]int)
+	f, err := os.Open(filepath.Join(chunksDir(), chunkRefCountsName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return refCounts, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&refCounts); err != nil {
+		return nil, fmt.Errorf("cannot decode snapshot chunk reference counts: %v", err)
+	}
+	return refCounts, nil
+}
+
+func saveChunkRefCounts(refCounts map[string]int) error {
+	p := filepath.Join(chunksDir(), chunkRefCountsName)
+	if len(refCounts) == 0 {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	buf, err := json.Marshal(refCounts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(chunksDir(), 0700); err != nil {
+		return err
+	}
+	return osutil.AtomicWriteFile(p, buf, 0600, 0)
+}
+
+// updateChunkRefs adds a reference to the chunks in add and drops one
+// from the chunks in drop, returning the chunks that are no longer
+// referenced at all.
+func updateChunkRefs(add, drop []string) (unused []string, err error) {
+	refCountsLock.Lock()
+	defer refCountsLock.Unlock()
+
+	refCounts, err := loadChunkRefCounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, chunkHash := range add {
+		refCounts[chunkHash]++
+	}
+	for _, chunkHash := range drop {
+		refCounts[chunkHash]--
+		if refCounts[chunkHash] <= 0 {
+			delete(refCounts, chunkHash)
+			unused = append(unused, chunkHash)
+		}
+	}
+	if err := saveChunkRefCounts(refCounts); err != nil {
+		return nil, fmt.Errorf("cannot save snapshot chunk reference counts: %v", err)
+	}
+	return unused, nil
+}
+
+func removeChunks(chunkHashes []string) {
+	for _, chunkHash := range chunkHashes {
+		if err := os.Remove(chunkPath(chunkHash)); err != nil && !os.IsNotExist(err) {
+			logger.Noticef("Cannot remove unused snapshot chunk: %v.", err)
+		}
+	}
+}
+
+// chunkRefs returns the chunks used by the snapshot, once each.
+func (r *Reader) chunkRefs() ([]string, error) {
+	if !r.Chunked {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	var refs []string
+	for entry := range r.SHA3_384 {
+		body, _, err := zipMember(r.File, entry)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err := readManifest(body)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read snapshot entry %q: %v", entry, err)
+		}
+		for _, chunk := range manifest {
+			if !seen[chunk.hash] {
+				seen[chunk.hash] = true
+				refs = append(refs, chunk.hash)
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// refSnapshotChunks adds the references of the given snapshot file to
+// the chunks it uses.
+func refSnapshotChunks(fn string) error {
+	r, err := Open(fn, ExtractFnameSetID)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	refs, err := r.chunkRefs()
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	_, err = updateChunkRefs(refs, nil)
+	return err
+}
+
+// Remove a snapshot file, along with the chunks that are only used by
+// it.
+func Remove(fn string) error {
+	var refs []string
+	if r, err := Open(fn, ExtractFnameSetID); err == nil {
+		refs, err = r.chunkRefs()
+		r.Close()
+		if err != nil {
+			logger.Noticef("Cannot read the chunks used by snapshot %q: %v.", fn, err)
+		}
+	}
+
+	chunkStoreLock.Lock()
+	defer chunkStoreLock.Unlock()
+
+	if err := os.Remove(fn); err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	unused, err := updateChunkRefs(nil, refs)
+	if err != nil {
+		// the chunks will be reclaimed by the next cleanup
+		logger.Noticef("Cannot update snapshot chunk references: %v.", err)
+		return nil
+	}
+	removeChunks(unused)
+	return nil
+}
+
+var errIncompleteChunkRefs = errors.New("cannot determine the chunks used by all snapshots")
+
+// CleanupUnreferencedChunks recomputes the reference counts of the
+// chunk store from the snapshots, and removes the chunks no snapshot
+// uses anymore (for example left behind by an interrupted save or
+// import). Nothing is changed unless the chunks used by every snapshot
+// could be determined.
+//
+// The amount of chunks removed is returned.
+func CleanupUnreferencedChunks() (removed int, err error) {
+	chunkStoreLock.Lock()
+	defer chunkStoreLock.Unlock()
+
+	if exists, _, _ := osutil.DirExists(chunksDir()); !exists {
+		return 0, nil
+	}
+
+	snapshotFiles, err := filepathGlob(filepath.Join(dirs.SnapshotsDir, "*.zip"))
+	if err != nil {
+		return 0, err
+	}
+	refCounts := make(map[string]int)
+	complete := true
+	for _, fn := range snapshotFiles {
+		ok, setID := isSnapshotFilename(fn)
+		if !ok {
+			continue
+		}
+		if importInProgressFor(setID) {
+			complete = false
+			continue
+		}
+		r, err := Open(fn, setID)
+		if err != nil {
+			logger.Noticef("Cannot open snapshot %q: %v.", fn, err)
+			complete = false
+			continue
+		}
+		refs, err := r.chunkRefs()
+		r.Close()
+		if err != nil {
+			logger.Noticef("Cannot read the chunks used by snapshot %q: %v.", fn, err)
+			complete = false
+			continue
+		}
+		for _, chunkHash := range refs {
+			refCounts[chunkHash]++
+		}
+	}
+
+	if !complete {
+		return 0, errIncompleteChunkRefs
+	}
+	refCountsLock.Lock()
+	defer refCountsLock.Unlock()
+	if err := saveChunkRefCounts(refCounts); err != nil {
+		return 0, fmt.Errorf("cannot save snapshot chunk reference counts: %v", err)
+	}
+
+	chunkFiles, err := filepathGlob(filepath.Join(chunksDir(), "*", "*"))
+	if err != nil {
+		return 0, err
+	}
+	var unused []string
+	for _, p := range chunkFiles {
+		chunkHash := filepath.Base(p)
+		if !isChunkHash(chunkHash) || refCounts[chunkHash] > 0 {
+			continue
+		}
+		unused = append(unused, chunkHash)
+	}
+	removeChunks(unused)
+	return len(unused), nil
+}
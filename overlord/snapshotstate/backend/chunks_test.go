@@ -0,0 +1,168 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+)
+
+type chunksSuite struct {
+	restore func()
+}
+
+var _ = check.Suite(&chunksSuite{})
+
+func (s *chunksSuite) SetUpTest(c *check.C) {
+	dirs.SetRootDir(c.MkDir())
+	// small chunks, about 1KiB on average
+	s.restore = backend.MockChunkSizes(256, 4096, (1<<10-1)<<54)
+}
+
+func (s *chunksSuite) TearDownTest(c *check.C) {
+	s.restore()
+	dirs.SetRootDir("")
+}
+
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func manifestHashes(c *check.C, manifest string) []string {
+	var hashes []string
+	for _, line := range strings.Split(strings.TrimSpace(manifest), "\n") {
+		fields := strings.Fields(line)
+		c.Assert(fields, check.HasLen, 2)
+		sz, err := strconv.Atoi(fields[1])
+		c.Assert(err, check.IsNil)
+		c.Check(sz <= 4096, check.Equals, true)
+		hashes = append(hashes, fields[0])
+	}
+	return hashes
+}
+
+func (s *chunksSuite) TestRoundtrip(c *check.C) {
+	data := randomData(1, 64*1024)
+
+	manifest, stored, err := backend.WriteChunked(data)
+	c.Assert(err, check.IsNil)
+	c.Check(stored > 0, check.Equals, true)
+	hashes := manifestHashes(c, manifest)
+	c.Check(len(hashes) > 1, check.Equals, true)
+	for _, h := range hashes {
+		c.Check(osutil.FileExists(backend.ChunkPath(h)), check.Equals, true)
+	}
+
+	out, err := backend.ReadChunked(manifest)
+	c.Assert(err, check.IsNil)
+	c.Check(out, check.DeepEquals, data)
+}
+
+func (s *chunksSuite) TestEmpty(c *check.C) {
+	manifest, stored, err := backend.WriteChunked(nil)
+	c.Assert(err, check.IsNil)
+	c.Check(manifest, check.Equals, "")
+	c.Check(stored, check.Equals, int64(0))
+
+	out, err := backend.ReadChunked(manifest)
+	c.Assert(err, check.IsNil)
+	c.Check(out, check.HasLen, 0)
+}
+
+func (s *chunksSuite) TestDeduplication(c *check.C) {
+	data := randomData(2, 64*1024)
+	manifest1, _, err := backend.WriteChunked(data)
+	c.Assert(err, check.IsNil)
+
+	// change a few bytes in the middle, and insert some more
+	changed := append([]byte{}, data[:32*1024]...)
+	changed = append(changed, []byte("something new")...)
+	changed = append(changed, data[32*1024+4:]...)
+	manifest2, _, err := backend.WriteChunked(changed)
+	c.Assert(err, check.IsNil)
+
+	known := make(map[string]bool)
+	hashes1 := manifestHashes(c, manifest1)
+	for _, h := range hashes1 {
+		known[h] = true
+	}
+	hashes2 := manifestHashes(c, manifest2)
+	var shared int
+	for _, h := range hashes2 {
+		if known[h] {
+			shared++
+		}
+	}
+	// only the chunks around the change differ
+	c.Check(len(hashes2)-shared <= 3, check.Equals, true, check.Commentf("%d of %d chunks shared", shared, len(hashes2)))
+
+	out, err := backend.ReadChunked(manifest2)
+	c.Assert(err, check.IsNil)
+	c.Check(out, check.DeepEquals, changed)
+}
+
+func (s *chunksSuite) TestCorruptedChunk(c *check.C) {
+	manifest, _, err := backend.WriteChunked(randomData(3, 8*1024))
+	c.Assert(err, check.IsNil)
+	hashes := manifestHashes(c, manifest)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("not the data you are looking for"))
+	gz.Close()
+	c.Assert(ioutil.WriteFile(backend.ChunkPath(hashes[0]), buf.Bytes(), 0600), check.IsNil)
+
+	_, err = backend.ReadChunked(manifest)
+	c.Check(err, check.ErrorMatches, `snapshot chunk \S+ size \(\d+\) different from actual \(32\)`)
+}
+
+func (s *chunksSuite) TestMissingChunk(c *check.C) {
+	manifest := strings.Repeat("0", 96) + " 10\n"
+	_, err := backend.ReadChunked(manifest)
+	c.Check(err, check.ErrorMatches, `cannot open snapshot chunk 0000000…: .* no such file or directory`)
+}
+
+func (s *chunksSuite) TestBadManifest(c *check.C) {
+	for _, t := range []struct {
+		manifest string
+		err      string
+	}{
+		{"potato\n", `invalid chunk manifest line "potato"`},
+		{"abc 10\n", `invalid chunk manifest line "abc 10"`},
+		{strings.Repeat("x", 96) + " 10\n", `invalid chunk manifest line "x+ 10"`},
+		{strings.Repeat("0", 96) + " -1\n", `invalid chunk size in manifest line "0+ -1"`},
+		{strings.Repeat("0", 96) + " ten\n", `invalid chunk size in manifest line "0+ ten"`},
+	} {
+		_, err := backend.ReadChunked(t.manifest)
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("%q", t.manifest))
+	}
+}
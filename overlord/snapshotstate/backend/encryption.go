@@ -0,0 +1,272 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/openpgp/s2k"
+
+	"github.com/snapcore/snapd/client"
+)
+
+const (
+	encryptionCipher = "aes-256-gcm"
+	encryptionKDF    = "openpgp-s2k-iterated-sha256"
+
+	// the archives are encrypted in chunks, so they can be streamed
+	encryptionChunkSize = 64 * 1024
+	// the nonce of each chunk is a random prefix, chosen for each
+	// archive, followed by the index of the chunk
+	noncePrefixSize = 8
+
+	keyCheckLabel = "snapd snapshot key check"
+)
+
+var (
+	// ErrKeyNeeded is returned when accessing the data of an
+	// encrypted snapshot without its key.
+	ErrKeyNeeded = errors.New("cannot access the data of an encrypted snapshot without its key")
+	// ErrWrongKey is returned when the key does not match the one the
+	// snapshot was encrypted with.
+	ErrWrongKey = errors.New("cannot use key: the snapshot was encrypted with a different one")
+
+	// kdfCount is the number of bytes hashed to derive a key, the
+	// maximum allowed by OpenPGP
+	kdfCount = 65011712
+
+	randRead = rand.Read
+)
+
+func deriveKey(key []byte, enc *client.SnapshotEncryption) []byte {
+	derived := make([]byte, 32)
+	s2k.Iterated(derived, sha256.New(), key, enc.Salt, enc.Count)
+	return derived
+}
+
+func keyCheck(derived []byte) string {
+	mac := hmac.New(sha256.New, derived)
+	mac.Write([]byte(keyCheckLabel))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newAEAD(derived []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newEncryption sets up the encryption of a new snapshot with a key
+// derived from the given one, with a new salt.
+func newEncryption(key []byte) (*client.SnapshotEncryption, cipher.AEAD, error) {
+	salt := make([]byte, 16)
+	if _, err := randRead(salt); err != nil {
+		return nil, nil, err
+	}
+	enc := &client.SnapshotEncryption{
+		Cipher: encryptionCipher,
+		KDF:    encryptionKDF,
+		Salt:   salt,
+		Count:  kdfCount,
+	}
+	derived := deriveKey(key, enc)
+	enc.KeyCheck = keyCheck(derived)
+	aead, err := newAEAD(derived)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, aead, nil
+}
+
+// openEncryption returns the cipher to decrypt the archives of a snapshot
+// encrypted as described, with the given key.
+func openEncryption(key []byte, enc *client.SnapshotEncryption) (cipher.AEAD, error) {
+	if enc.Cipher != encryptionCipher || enc.KDF != encryptionKDF {
+		return nil, fmt.Errorf("unsupported snapshot encryption %q with key derivation %q", enc.Cipher, enc.KDF)
+	}
+	derived := deriveKey(key, enc)
+	if !hmac.Equal([]byte(keyCheck(derived)), []byte(enc.KeyCheck)) {
+		return nil, ErrWrongKey
+	}
+	return newAEAD(derived)
+}
+
+// chunkNonce returns the nonce of the given chunk.
+func chunkNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], index)
+	return nonce
+}
+
+// chunkAdditionalData binds the chunks to their archive, and marks the
+// last one so that truncation is detected.
+func chunkAdditionalData(entry string, last bool) []byte {
+	ad := append([]byte(entry), 0)
+	if last {
+		ad = append(ad, 1)
+	} else {
+		ad = append(ad, 0)
+	}
+	return ad
+}
+
+// encryptingWriter encrypts what is written to it in chunks, the last
+// one is written on Close.
+type encryptingWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	entry  string
+	prefix []byte
+	index  uint32
+	buf    []byte
+}
+
+func newEncryptingWriter(w io.Writer, aead cipher.AEAD, entry string) (*encryptingWriter, error) {
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := randRead(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &encryptingWriter{
+		w:      w,
+		aead:   aead,
+		entry:  entry,
+		prefix: prefix,
+		buf:    make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+func (ew *encryptingWriter) seal(last bool) error {
+	sealed := ew.aead.Seal(nil, chunkNonce(ew.prefix, ew.index), ew.buf, chunkAdditionalData(ew.entry, last))
+	if _, err := ew.w.Write(sealed); err != nil {
+		return err
+	}
+	ew.index++
+	ew.buf = ew.buf[:0]
+	return nil
+}
+
+func (ew *encryptingWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data comes, as the
+		// last chunk is sealed differently
+		if len(ew.buf) == encryptionChunkSize {
+			if err := ew.seal(false); err != nil {
+				return 0, err
+			}
+		}
+		k := encryptionChunkSize - len(ew.buf)
+		if k > len(p) {
+			k = len(p)
+		}
+		ew.buf = append(ew.buf, p[:k]...)
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// Close writes the last chunk, it does not close the underlying writer.
+func (ew *encryptingWriter) Close() error {
+	return ew.seal(true)
+}
+
+// decryptingReader decrypts the chunks written by an encryptingWriter.
+type decryptingReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	entry  string
+	prefix []byte
+	index  uint32
+	sealed []byte
+	plain  []byte
+	done   bool
+}
+
+func newDecryptingReader(r io.Reader, aead cipher.AEAD, entry string) (*decryptingReader, error) {
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("cannot read encrypted archive %q: %v", entry, err)
+	}
+	return &decryptingReader{
+		r:      bufio.NewReader(r),
+		aead:   aead,
+		entry:  entry,
+		prefix: prefix,
+		sealed: make([]byte, encryptionChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (dr *decryptingReader) open() error {
+	var last bool
+	n, err := io.ReadFull(dr.r, dr.sealed)
+	switch err {
+	case nil:
+		// a full chunk is the last one if nothing follows
+		if _, err := dr.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		return fmt.Errorf("cannot decrypt archive %q: data is truncated", dr.entry)
+	default:
+		return err
+	}
+	plain, err := dr.aead.Open(dr.sealed[:0], chunkNonce(dr.prefix, dr.index), dr.sealed[:n], chunkAdditionalData(dr.entry, last))
+	if err != nil {
+		return fmt.Errorf("cannot decrypt archive %q: %v", dr.entry, err)
+	}
+	dr.plain = plain
+	dr.index++
+	dr.done = last
+	return nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
@@ -0,0 +1,141 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package backend_test
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+)
+
+type encryptionSuite struct {
+	restore func()
+}
+
+var _ = check.Suite(&encryptionSuite{})
+
+func (s *encryptionSuite) SetUpTest(c *check.C) {
+	s.restore = backend.MockKdfCount(1024)
+}
+
+func (s *encryptionSuite) TearDownTest(c *check.C) {
+	s.restore()
+}
+
+func (s *encryptionSuite) encrypt(c *check.C, key, data []byte) ([]byte, *client.SnapshotEncryption) {
+	enc, aead, err := backend.NewEncryption(key)
+	c.Assert(err, check.IsNil)
+
+	var buf bytes.Buffer
+	w, err := backend.NewEncryptingWriter(&buf, aead, "an/entry")
+	c.Assert(err, check.IsNil)
+	// write in odd sizes to cross the chunk boundaries
+	for len(data) > 0 {
+		n := 1000
+		if n > len(data) {
+			n = len(data)
+		}
+		_, err := w.Write(data[:n])
+		c.Assert(err, check.IsNil)
+		data = data[n:]
+	}
+	c.Assert(w.Close(), check.IsNil)
+	return buf.Bytes(), enc
+}
+
+func (s *encryptionSuite) decrypt(key, sealed []byte, enc *client.SnapshotEncryption, entry string) ([]byte, error) {
+	aead, err := backend.OpenEncryption(key, enc)
+	if err != nil {
+		return nil, err
+	}
+	r, err := backend.NewDecryptingReader(bytes.NewReader(sealed), aead, entry)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func (s *encryptionSuite) TestRoundtrip(c *check.C) {
+	key := []byte("sekrit")
+	for _, size := range []int{0, 1, backend.EncryptionChunkSize - 1, backend.EncryptionChunkSize, backend.EncryptionChunkSize + 1, 3*backend.EncryptionChunkSize + 42} {
+		comm := check.Commentf("%d", size)
+		data := bytes.Repeat([]byte{'x'}, size)
+		sealed, enc := s.encrypt(c, key, data)
+		c.Check(bytes.Contains(sealed, []byte("xxxxxxxx")), check.Equals, false, comm)
+
+		plain, err := s.decrypt(key, sealed, enc, "an/entry")
+		c.Assert(err, check.IsNil, comm)
+		c.Check(plain, check.DeepEquals, data, comm)
+	}
+}
+
+func (s *encryptionSuite) TestSaltPerSnapshot(c *check.C) {
+	enc1, _, err := backend.NewEncryption([]byte("sekrit"))
+	c.Assert(err, check.IsNil)
+	enc2, _, err := backend.NewEncryption([]byte("sekrit"))
+	c.Assert(err, check.IsNil)
+	c.Check(enc1.Salt, check.Not(check.DeepEquals), enc2.Salt)
+	c.Check(enc1.KeyCheck, check.Not(check.Equals), enc2.KeyCheck)
+}
+
+func (s *encryptionSuite) TestWrongKey(c *check.C) {
+	sealed, enc := s.encrypt(c, []byte("sekrit"), []byte("hello"))
+	_, err := s.decrypt([]byte("other"), sealed, enc, "an/entry")
+	c.Check(err, check.Equals, backend.ErrWrongKey)
+}
+
+func (s *encryptionSuite) TestUnsupported(c *check.C) {
+	sealed, enc := s.encrypt(c, []byte("sekrit"), []byte("hello"))
+	enc.Cipher = "rot13"
+	_, err := s.decrypt([]byte("sekrit"), sealed, enc, "an/entry")
+	c.Check(err, check.ErrorMatches, `unsupported snapshot encryption "rot13" with key derivation "openpgp-s2k-iterated-sha256"`)
+}
+
+func (s *encryptionSuite) TestTampered(c *check.C) {
+	key := []byte("sekrit")
+	data := bytes.Repeat([]byte{'x'}, 2*backend.EncryptionChunkSize+10)
+	sealed, enc := s.encrypt(c, key, data)
+
+	// a flipped bit
+	tampered := append([]byte(nil), sealed...)
+	tampered[100] ^= 1
+	_, err := s.decrypt(key, tampered, enc, "an/entry")
+	c.Check(err, check.ErrorMatches, `cannot decrypt archive "an/entry": cipher: message authentication failed`)
+
+	// a different archive
+	_, err = s.decrypt(key, sealed, enc, "other/entry")
+	c.Check(err, check.ErrorMatches, `cannot decrypt archive "other/entry": cipher: message authentication failed`)
+}
+
+func (s *encryptionSuite) TestTruncated(c *check.C) {
+	key := []byte("sekrit")
+	data := bytes.Repeat([]byte{'x'}, 2*backend.EncryptionChunkSize+10)
+	sealed, enc := s.encrypt(c, key, data)
+	chunk := backend.EncryptionChunkSize + 16
+
+	for _, size := range []int{4, 8, 8 + chunk, 8 + 2*chunk, len(sealed) - 1} {
+		_, err := s.decrypt(key, sealed[:size], enc, "an/entry")
+		c.Check(err, check.ErrorMatches, `cannot (read encrypted|decrypt) archive "an/entry": .*`, check.Commentf("%d", size))
+	}
+}
@@ -20,8 +20,11 @@
 package backend
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
 	"os/user"
+	"strings"
 	"time"
 
 	"github.com/snapcore/snapd/client"
@@ -140,3 +143,66 @@ func MockFilepathGlob(new func(pattern string) (matches []string, err error)) (r
 		filepathGlob = oldFilepathGlob
 	}
 }
+
+var (
+	NewEncryption       = newEncryption
+	OpenEncryption      = openEncryption
+	NewEncryptingWriter = newEncryptingWriter
+	NewDecryptingReader = newDecryptingReader
+)
+
+const EncryptionChunkSize = encryptionChunkSize
+
+func MockKdfCount(count int) (restore func()) {
+	oldKdfCount := kdfCount
+	kdfCount = count
+	return func() {
+		kdfCount = oldKdfCount
+	}
+}
+
+var ChunkPath = chunkPath
+
+func MockChunkSizes(min, max int, mask uint64) (restore func()) {
+	oldMin, oldMax, oldMask := chunkMinSize, chunkMaxSize, chunkMask
+	chunkMinSize, chunkMaxSize, chunkMask = min, max, mask
+	return func() {
+		chunkMinSize, chunkMaxSize, chunkMask = oldMin, oldMax, oldMask
+	}
+}
+
+// WriteChunked stores the data in the chunk store, returning the
+// manifest of its chunks and their stored size.
+func WriteChunked(data []byte) (manifest string, stored int64, err error) {
+	cw := &chunkingWriter{}
+	// write in odd sizes so writes straddle the chunk boundaries
+	for len(data) > 0 {
+		n := 1000
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := cw.Write(data[:n]); err != nil {
+			return "", 0, err
+		}
+		data = data[n:]
+	}
+	if err := cw.Close(); err != nil {
+		return "", 0, err
+	}
+	var buf bytes.Buffer
+	if err := writeManifest(&buf, cw.manifest); err != nil {
+		return "", 0, err
+	}
+	return buf.String(), cw.stored, nil
+}
+
+// ReadChunked reads back the data of the chunks in the manifest.
+func ReadChunked(manifest string) ([]byte, error) {
+	entries, err := readManifest(strings.NewReader(manifest))
+	if err != nil {
+		return nil, err
+	}
+	cr := newChunksReader(chunksDir(), entries)
+	defer cr.Close()
+	return ioutil.ReadAll(cr)
+}
@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"crypto/cipher"
 	"errors"
 	"fmt"
 	"hash"
@@ -50,6 +51,9 @@ const ExtractFnameSetID = 0
 type Reader struct {
 	*os.File
 	client.Snapshot
+
+	// aead decrypts the archives of encrypted snapshots
+	aead cipher.AEAD
 }
 
 // Open a Snapshot given its full filename.
@@ -142,6 +146,53 @@ func Open(fn string, setID uint64) (reader *Reader, e error) {
 	return reader, nil
 }
 
+// UseKey sets the key to access the data of an encrypted snapshot. It
+// does nothing for snapshots that are not encrypted.
+func (r *Reader) UseKey(key []byte) error {
+	if r.Encryption == nil {
+		return nil
+	}
+	aead, err := openEncryption(key, r.Encryption)
+	if err != nil {
+		return err
+	}
+	r.aead = aead
+	return nil
+}
+
+// checkKey returns an error if the snapshot is encrypted and no key was
+// given to access it.
+func (r *Reader) checkKey() error {
+	if r.Encryption != nil && r.aead == nil {
+		return ErrKeyNeeded
+	}
+	return nil
+}
+
+// archiveReader returns a reader of the content of the given archive,
+// decrypting it or reading it from the chunk store if needed.
+func (r *Reader) archiveReader(entry string, body io.Reader) (io.ReadCloser, error) {
+	if r.Chunked {
+		manifest, err := readManifest(body)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read snapshot entry %q: %v", entry, err)
+		}
+		// the chunk store is next to the snapshot
+		return newChunksReader(filepath.Join(filepath.Dir(r.Name()), chunksDirName), manifest), nil
+	}
+	if r.Encryption == nil {
+		return ioutil.NopCloser(body), nil
+	}
+	if err := r.checkKey(); err != nil {
+		return nil, err
+	}
+	dr, err := newDecryptingReader(body, r.aead, entry)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(dr), nil
+}
+
 func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) error {
 	body, reportedSize, err := zipMember(r.File, entry)
 	if err != nil {
@@ -150,10 +201,18 @@ func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) e
 	defer body.Close()
 
 	expectedHash := r.SHA3_384[entry]
-	readSize, err := io.Copy(io.MultiWriter(osutil.ContextWriter(ctx), hasher), body)
+	var sz osutil.Sizer
+	data, err := r.archiveReader(entry, io.TeeReader(body, io.MultiWriter(hasher, &sz)))
 	if err != nil {
 		return err
 	}
+	defer data.Close()
+	// encrypted archives are also checked by decrypting them, and
+	// chunked ones by reading their chunks
+	if _, err := io.Copy(osutil.ContextWriter(ctx), data); err != nil {
+		return err
+	}
+	readSize := sz.Size()
 
 	if readSize != reportedSize {
 		return fmt.Errorf("snapshot entry %q size (%d) different from actual (%d)", entry, reportedSize, readSize)
@@ -167,6 +226,9 @@ func (r *Reader) checkOne(ctx context.Context, entry string, hasher hash.Hash) e
 
 // Check that the data contained in the snapshot matches its hashsums.
 func (r *Reader) Check(ctx context.Context, usernames []string) error {
+	if err := r.checkKey(); err != nil {
+		return err
+	}
 	sort.Strings(usernames)
 
 	hasher := crypto.SHA3_384.New()
@@ -197,6 +259,10 @@ type Logf func(format string, args ...interface{})
 // or the one in the snapshot) with that contained in the snapshot. It keeps
 // track of the old data in the task so it can be undone (or cleaned up).
 func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames []string, logf Logf) (rs *RestoreState, e error) {
+	if err := r.checkKey(); err != nil {
+		return nil, err
+	}
+
 	rs = &RestoreState{}
 	defer func() {
 		if e != nil {
@@ -317,15 +383,24 @@ func (r *Reader) Restore(ctx context.Context, current snap.Revision, usernames [
 
 		expectedHash := r.SHA3_384[entry]
 
-		tr := io.TeeReader(body, io.MultiWriter(hasher, &sz))
+		tr, err := r.archiveReader(entry, io.TeeReader(body, io.MultiWriter(hasher, &sz)))
+		if err != nil {
+			return rs, err
+		}
+		defer tr.Close()
 
+		tarArgs := []string{
+			"--extract",
+			"--preserve-permissions", "--preserve-order",
+			"--directory", tempdir,
+		}
+		if !r.Chunked {
+			tarArgs = append(tarArgs, "--gunzip")
+		}
 		// resist the temptation of using archive/tar unless it's proven
 		// that calling out to tar has issues -- there are a lot of
 		// special cases we'd need to consider otherwise
-		cmd := tarAsUser(username,
-			"--extract",
-			"--preserve-permissions", "--preserve-order", "--gunzip",
-			"--directory", tempdir)
+		cmd := tarAsUser(username, tarArgs...)
 		cmd.Env = []string{}
 		cmd.Stdin = tr
 		matchCounter := &strutil.MatchCounter{N: 1}
@@ -33,20 +33,24 @@ import (
 )
 
 var (
-	NewSnapshotSetID           = newSnapshotSetID
-	AllActiveSnapNames         = allActiveSnapNames
-	SnapSummariesInSnapshotSet = snapSummariesInSnapshotSet
-	CheckSnapshotTaskConflict  = checkSnapshotTaskConflict
-	Filename                   = filename
-	DoSave                     = doSave
-	DoRestore                  = doRestore
-	UndoRestore                = undoRestore
-	CleanupRestore             = cleanupRestore
-	DoCheck                    = doCheck
-	DoForget                   = doForget
-	SaveExpiration             = saveExpiration
-	ExpiredSnapshotSets        = expiredSnapshotSets
-	RemoveSnapshotState        = removeSnapshotState
+	NewSnapshotSetID            = newSnapshotSetID
+	AllActiveSnapNames          = allActiveSnapNames
+	SnapSummariesInSnapshotSet  = snapSummariesInSnapshotSet
+	CheckSnapshotTaskConflict   = checkSnapshotTaskConflict
+	Filename                    = filename
+	DoSave                      = doSave
+	DoRestore                   = doRestore
+	UndoRestore                 = undoRestore
+	CleanupRestore              = cleanupRestore
+	DoCheck                     = doCheck
+	DoForget                    = doForget
+	SaveExpiration              = saveExpiration
+	ExpiredSnapshotSets         = expiredSnapshotSets
+	RemoveSnapshotState         = removeSnapshotState
+	SetTaskKey                  = setTaskKey
+	SaveScheduledTime           = saveScheduledTime
+	ScheduledSnapshotSnaps      = scheduledSnapshotSnaps
+	PrunedScheduledSnapshotSets = prunedScheduledSnapshotSets
 
 	DefaultAutomaticSnapshotExpiration = defaultAutomaticSnapshotExpiration
 )
@@ -64,11 +68,11 @@ func (summaries snapshotSnapSummaries) AsMaps() []map[string]string {
 	return out
 }
 
-func MockOsRemove(f func(string) error) (restore func()) {
-	old := osRemove
-	osRemove = f
+func MockBackendRemove(f func(string) error) (restore func()) {
+	old := backendRemove
+	backendRemove = f
 	return func() {
-		osRemove = old
+		backendRemove = old
 	}
 }
 
@@ -152,7 +156,7 @@ func MockBackendCleanup(f func(*backend.RestoreState)) (restore func()) {
 	}
 }
 
-func MockBackendImport(f func(context.Context, uint64, io.Reader) ([]string, error)) (restore func()) {
+func MockBackendImport(f func(context.Context, uint64, io.Reader, []byte) ([]string, error)) (restore func()) {
 	old := backendImport
 	backendImport = f
 	return func() {
@@ -160,6 +164,14 @@ func MockBackendImport(f func(context.Context, uint64, io.Reader) ([]string, err
 	}
 }
 
+func MockBackendCleanupUnreferencedChunks(f func() (int, error)) (restore func()) {
+	old := backendCleanupUnreferencedChunks
+	backendCleanupUnreferencedChunks = f
+	return func() {
+		backendCleanupUnreferencedChunks = old
+	}
+}
+
 func MockBackenCleanupAbandondedImports(f func() (int, error)) (restore func()) {
 	old := backendCleanupAbandondedImports
 	backendCleanupAbandondedImports = f
@@ -196,3 +208,12 @@ func MockConfigSetSnapConfig(f func(*state.State, string, *json.RawMessage) erro
 func SetLastForgetExpiredSnapshotTime(mgr *SnapshotManager, t time.Time) {
 	mgr.lastForgetExpiredSnapshotTime = t
 }
+
+func NextScheduledSnapshot(mgr *SnapshotManager) time.Time {
+	return mgr.nextScheduledSnapshot
+}
+
+func PruneSnapshotSets(last, daily, weekly int, taken map[uint64]time.Time) map[uint64]bool {
+	retention := &snapshotRetention{Last: last, Daily: daily, Weekly: weekly}
+	return retention.prune(taken)
+}
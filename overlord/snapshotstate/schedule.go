@@ -0,0 +1,307 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapshotstate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/timeutil"
+)
+
+var (
+	// the longest time between two scheduled snapshots, whatever the
+	// schedule says
+	maxScheduledSnapshotDelay = 35 * 24 * time.Hour
+	// how long to wait before trying again when a scheduled snapshot
+	// conflicts with other changes of the snaps
+	scheduledSnapshotRetryDelay = 10 * time.Minute
+
+	// how many scheduled snapshot sets are kept, if no retention is
+	// set by the user
+	defaultScheduledSnapshotsKeepLast = 3
+)
+
+func coreCfg(st *state.State, key string) (string, error) {
+	return config.CoreCfg(config.NewTransaction(st), key)
+}
+
+// scheduledSnapshotsSchedule returns the schedule set with the
+// snapshots.schedule option, if any.
+func scheduledSnapshotsSchedule(st *state.State) (schedule []*timeutil.Schedule, scheduleStr string, err error) {
+	scheduleStr, err = coreCfg(st, "snapshots.schedule")
+	if err != nil || scheduleStr == "" {
+		return nil, "", err
+	}
+	schedule, err = timeutil.ParseSchedule(scheduleStr)
+	if err != nil {
+		return nil, "", fmt.Errorf("snapshots.schedule cannot be parsed: %v", err)
+	}
+	return schedule, scheduleStr, nil
+}
+
+// scheduledSnapshotSnaps returns the active snaps to include in
+// scheduled snapshots: the ones in snapshots.scheduled.include (all of
+// them if unset), except the ones in snapshots.scheduled.exclude.
+func scheduledSnapshotSnaps(st *state.State) ([]string, error) {
+	includeStr, err := coreCfg(st, "snapshots.scheduled.include")
+	if err != nil {
+		return nil, err
+	}
+	excludeStr, err := coreCfg(st, "snapshots.scheduled.exclude")
+	if err != nil {
+		return nil, err
+	}
+	include := strutil.CommaSeparatedList(includeStr)
+	exclude := strutil.CommaSeparatedList(excludeStr)
+
+	active, err := allActiveSnapNames(st)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range active {
+		if len(include) > 0 && !strutil.ListContains(include, name) {
+			continue
+		}
+		if strutil.ListContains(exclude, name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// snapshotRetention is the policy deciding which scheduled snapshot
+// sets are kept: the Last ones, plus the newest one of each of the
+// last Daily days and Weekly weeks that have sets. The newest set is
+// always kept.
+type snapshotRetention struct {
+	Last   int
+	Daily  int
+	Weekly int
+}
+
+func scheduledSnapshotRetention(st *state.State) (*snapshotRetention, error) {
+	var retention snapshotRetention
+	var isSet bool
+	for _, opt := range []struct {
+		key string
+		n   *int
+	}{
+		{"snapshots.scheduled.keep-last", &retention.Last},
+		{"snapshots.scheduled.keep-daily", &retention.Daily},
+		{"snapshots.scheduled.keep-weekly", &retention.Weekly},
+	} {
+		keepStr, err := coreCfg(st, opt.key)
+		if err != nil {
+			return nil, err
+		}
+		if keepStr == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(keepStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s cannot be parsed: %v", opt.key, err)
+		}
+		*opt.n = int(n)
+		isSet = true
+	}
+	if !isSet {
+		retention.Last = defaultScheduledSnapshotsKeepLast
+	}
+	return &retention, nil
+}
+
+// prune returns the sets, given with the time they were taken, that the
+// retention policy does not keep.
+func (retention *snapshotRetention) prune(taken map[uint64]time.Time) map[uint64]bool {
+	setIDs := make([]uint64, 0, len(taken))
+	for setID := range taken {
+		setIDs = append(setIDs, setID)
+	}
+	// newest first
+	sort.Slice(setIDs, func(i, j int) bool {
+		ti, tj := taken[setIDs[i]], taken[setIDs[j]]
+		if ti.Equal(tj) {
+			return setIDs[i] > setIDs[j]
+		}
+		return ti.After(tj)
+	})
+
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	pruned := make(map[uint64]bool)
+	for i, setID := range setIDs {
+		t := taken[setID].Local()
+		keep := i == 0 || i < retention.Last
+
+		day := t.Format("2006-01-02")
+		if !days[day] && len(days) < retention.Daily {
+			days[day] = true
+			keep = true
+		}
+		year, week := t.ISOWeek()
+		weekStr := fmt.Sprintf("%d-%d", year, week)
+		if !weeks[weekStr] && len(weeks) < retention.Weekly {
+			weeks[weekStr] = true
+			keep = true
+		}
+
+		if !keep {
+			pruned[setID] = true
+		}
+	}
+	return pruned
+}
+
+// prunedScheduledSnapshotSets returns the scheduled snapshot sets that
+// are not kept by the retention policy.
+// The state needs to be locked by the caller.
+func prunedScheduledSnapshotSets(st *state.State) (map[uint64]bool, error) {
+	var snapshots map[uint64]*snapshotState
+	err := st.Get("snapshots", &snapshots)
+	if err != nil {
+		if err != state.ErrNoState {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	taken := make(map[uint64]time.Time)
+	for setID, snapshotSet := range snapshots {
+		if snapshotSet.ScheduledTime != nil {
+			taken[setID] = *snapshotSet.ScheduledTime
+		}
+	}
+	if len(taken) == 0 {
+		return nil, nil
+	}
+
+	retention, err := scheduledSnapshotRetention(st)
+	if err != nil {
+		return nil, err
+	}
+	return retention.prune(taken), nil
+}
+
+// scheduledSnapshotInFlight returns whether the last scheduled snapshot
+// is still being taken. Once it is done, a failure is reported as a
+// warning, and a success triggers forgetting the sets the retention
+// policy does not keep.
+// The state needs to be locked by the caller.
+func (mgr *SnapshotManager) scheduledSnapshotInFlight() bool {
+	st := mgr.state
+	var chgID string
+	if err := st.Get("scheduled-snapshot-change", &chgID); err != nil {
+		return false
+	}
+	if chg := st.Change(chgID); chg != nil {
+		if !chg.Status().Ready() {
+			return true
+		}
+		if err := chg.Err(); err != nil {
+			st.Warnf("cannot take scheduled snapshot: %v", err)
+		} else {
+			mgr.lastForgetExpiredSnapshotTime = time.Time{}
+		}
+	}
+	st.Set("scheduled-snapshot-change", nil)
+	return false
+}
+
+// ensureScheduledSnapshots takes a snapshot of the snaps when the
+// snapshots.schedule timer says so. Failures are reported as warnings.
+func (mgr *SnapshotManager) ensureScheduledSnapshots() {
+	st := mgr.state
+	st.Lock()
+	defer st.Unlock()
+
+	if mgr.scheduledSnapshotInFlight() {
+		return
+	}
+
+	schedule, scheduleStr, err := scheduledSnapshotsSchedule(st)
+	if err != nil {
+		st.Warnf("cannot take scheduled snapshots: %v", err)
+		return
+	}
+	if len(schedule) == 0 {
+		mgr.nextScheduledSnapshot = time.Time{}
+		mgr.lastSnapshotSchedule = ""
+		return
+	}
+	if scheduleStr != mgr.lastSnapshotSchedule {
+		mgr.nextScheduledSnapshot = time.Time{}
+		mgr.lastSnapshotSchedule = scheduleStr
+	}
+
+	now := time.Now()
+	if mgr.nextScheduledSnapshot.IsZero() {
+		var last time.Time
+		if err := st.Get("last-scheduled-snapshot", &last); err != nil && err != state.ErrNoState {
+			st.Warnf("cannot take scheduled snapshots: %v", err)
+			return
+		}
+		if last.IsZero() {
+			// the schedule is new, wait for its first window
+			last = now
+			st.Set("last-scheduled-snapshot", last)
+		}
+		mgr.nextScheduledSnapshot = now.Add(timeutil.Next(schedule, last, maxScheduledSnapshotDelay))
+		logger.Debugf("Next scheduled snapshot at %s.", mgr.nextScheduledSnapshot.Format(time.RFC3339))
+	}
+	if mgr.nextScheduledSnapshot.After(now) {
+		return
+	}
+
+	names, err := scheduledSnapshotSnaps(st)
+	if err != nil {
+		st.Warnf("cannot take scheduled snapshot: %v", err)
+		return
+	}
+	if len(names) == 0 {
+		logger.Noticef("No snaps to take a scheduled snapshot of.")
+	} else {
+		setID, _, ts, err := save(st, names, nil, nil, true)
+		if err != nil {
+			if _, ok := err.(*snapstate.ChangeConflictError); ok {
+				logger.Debugf("Postponing scheduled snapshot: %v.", err)
+				mgr.nextScheduledSnapshot = now.Add(scheduledSnapshotRetryDelay)
+				return
+			}
+			st.Warnf("cannot take scheduled snapshot: %v", err)
+		} else {
+			chg := st.NewChange("save-snapshot", fmt.Sprintf("Save scheduled snapshot set #%d", setID))
+			chg.AddAll(ts)
+			chg.Set("api-data", map[string]interface{}{"set-id": setID, "snap-names": names})
+			st.Set("scheduled-snapshot-change", chg.ID())
+		}
+	}
+	st.Set("last-scheduled-snapshot", now)
+	mgr.nextScheduledSnapshot = time.Time{}
+}
@@ -0,0 +1,354 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapshotstate_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapshotstate"
+	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func setCoreConfig(c *check.C, st *state.State, conf map[string]interface{}) {
+	tr := config.NewTransaction(st)
+	for k, v := range conf {
+		c.Assert(tr.Set("core", k, v), check.IsNil)
+	}
+	tr.Commit()
+}
+
+func mockActiveSnaps(names ...string) (restore func()) {
+	return snapshotstate.MockSnapstateAll(func(*state.State) (map[string]*snapstate.SnapState, error) {
+		all := map[string]*snapstate.SnapState{
+			"inactive-snap": {Active: false},
+		}
+		for _, name := range names {
+			all[name] = &snapstate.SnapState{Active: true}
+		}
+		return all, nil
+	})
+}
+
+func (snapshotSuite) TestPruneSnapshotSets(c *check.C) {
+	// a Wednesday, in ISO week 24
+	now := time.Date(2021, 6, 16, 12, 0, 0, 0, time.Local)
+	taken := map[uint64]time.Time{
+		1: now.AddDate(0, 0, -15),                    // week 22
+		2: now.AddDate(0, 0, -8),                     // week 23
+		3: now.AddDate(0, 0, -2).Add(-2 * time.Hour), // Monday
+		4: now.AddDate(0, 0, -2).Add(-time.Hour),     // Monday
+		5: now.AddDate(0, 0, -1),                     // Tuesday
+		6: now.Add(-time.Hour),
+		7: now,
+	}
+
+	for _, t := range []struct {
+		last, daily, weekly int
+		pruned              []uint64
+	}{
+		{2, 0, 0, []uint64{1, 2, 3, 4, 5}},
+		{0, 3, 0, []uint64{1, 2, 3, 6}},
+		{0, 0, 3, []uint64{3, 4, 5, 6}},
+		{1, 2, 2, []uint64{1, 3, 4, 6}},
+		{10, 0, 0, nil},
+		// the newest set is always kept
+		{0, 0, 0, []uint64{1, 2, 3, 4, 5, 6}},
+	} {
+		var pruned []uint64
+		for setID := range snapshotstate.PruneSnapshotSets(t.last, t.daily, t.weekly, taken) {
+			pruned = append(pruned, setID)
+		}
+		sort.Slice(pruned, func(i, j int) bool { return pruned[i] < pruned[j] })
+		c.Check(pruned, check.DeepEquals, t.pruned, check.Commentf("%+v", t))
+	}
+}
+
+func (snapshotSuite) TestPrunedScheduledSnapshotSets(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	pruned, err := snapshotstate.PrunedScheduledSnapshotSets(st)
+	c.Assert(err, check.IsNil)
+	c.Check(pruned, check.HasLen, 0)
+
+	now := time.Now()
+	for i := 1; i <= 5; i++ {
+		c.Assert(snapshotstate.SaveScheduledTime(st, uint64(i), now.Add(time.Duration(i)*time.Minute)), check.IsNil)
+	}
+	// not a scheduled set
+	c.Assert(snapshotstate.SaveExpiration(st, 6, now.Add(-time.Hour)), check.IsNil)
+
+	// the last 3 are kept by default
+	pruned, err = snapshotstate.PrunedScheduledSnapshotSets(st)
+	c.Assert(err, check.IsNil)
+	c.Check(pruned, check.DeepEquals, map[uint64]bool{1: true, 2: true})
+
+	setCoreConfig(c, st, map[string]interface{}{"snapshots.scheduled.keep-last": 1})
+	pruned, err = snapshotstate.PrunedScheduledSnapshotSets(st)
+	c.Assert(err, check.IsNil)
+	c.Check(pruned, check.DeepEquals, map[uint64]bool{1: true, 2: true, 3: true, 4: true})
+
+	// scheduled sets do not expire
+	expired, err := snapshotstate.ExpiredSnapshotSets(st, now)
+	c.Assert(err, check.IsNil)
+	c.Check(expired, check.DeepEquals, map[uint64]bool{6: true})
+}
+
+func (snapshotSuite) TestScheduledSnapshotSnaps(c *check.C) {
+	defer mockActiveSnaps("a-snap", "b-snap", "c-snap")()
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	for _, t := range []struct {
+		include, exclude string
+		snaps            []string
+	}{
+		{"", "", []string{"a-snap", "b-snap", "c-snap"}},
+		{"", "b-snap", []string{"a-snap", "c-snap"}},
+		{"a-snap,b-snap,inactive-snap", "", []string{"a-snap", "b-snap"}},
+		{"a-snap,b-snap", "a-snap", []string{"b-snap"}},
+		{"", "a-snap,b-snap,c-snap", nil},
+	} {
+		setCoreConfig(c, st, map[string]interface{}{
+			"snapshots.scheduled.include": t.include,
+			"snapshots.scheduled.exclude": t.exclude,
+		})
+		snaps, err := snapshotstate.ScheduledSnapshotSnaps(st)
+		c.Assert(err, check.IsNil)
+		c.Check(snaps, check.DeepEquals, t.snaps, check.Commentf("%+v", t))
+	}
+}
+
+func (snapshotSuite) TestEnsureTakesScheduledSnapshot(c *check.C) {
+	defer mockActiveSnaps("a-snap", "b-snap")()
+	defer snapshotstate.MockSnapstateCheckChangeConflictMany(func(*state.State, []string, string) error {
+		return nil
+	})()
+
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	st.Lock()
+	defer st.Unlock()
+	setCoreConfig(c, st, map[string]interface{}{"snapshots.schedule": "00:00-23:59"})
+	st.Set("last-scheduled-snapshot", time.Now().Add(-48*time.Hour))
+
+	before := time.Now()
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+
+	changes := st.Changes()
+	c.Assert(changes, check.HasLen, 1)
+	chg := changes[0]
+	c.Check(chg.Kind(), check.Equals, "save-snapshot")
+	c.Check(chg.Summary(), check.Equals, "Save scheduled snapshot set #1")
+	var names []string
+	for _, task := range chg.Tasks() {
+		var snapshot map[string]interface{}
+		c.Assert(task.Get("snapshot-setup", &snapshot), check.IsNil)
+		c.Check(snapshot["scheduled"], check.Equals, true)
+		names = append(names, snapshot["snap"].(string))
+	}
+	sort.Strings(names)
+	c.Check(names, check.DeepEquals, []string{"a-snap", "b-snap"})
+
+	var chgID string
+	c.Assert(st.Get("scheduled-snapshot-change", &chgID), check.IsNil)
+	c.Check(chgID, check.Equals, chg.ID())
+	var last time.Time
+	c.Assert(st.Get("last-scheduled-snapshot", &last), check.IsNil)
+	c.Check(last.Before(before), check.Equals, false)
+
+	// nothing else happens while the change is in flight
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+	c.Check(st.Changes(), check.HasLen, 1)
+}
+
+func (snapshotSuite) TestEnsureScheduledSnapshotNewSchedule(c *check.C) {
+	defer mockActiveSnaps("a-snap")()
+
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	st.Lock()
+	defer st.Unlock()
+	setCoreConfig(c, st, map[string]interface{}{"snapshots.schedule": "mon,10:00"})
+
+	before := time.Now()
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+
+	// the first snapshot waits for the schedule
+	c.Check(st.Changes(), check.HasLen, 0)
+	var last time.Time
+	c.Assert(st.Get("last-scheduled-snapshot", &last), check.IsNil)
+	c.Check(last.Before(before), check.Equals, false)
+	c.Check(snapshotstate.NextScheduledSnapshot(mgr).After(before), check.Equals, true)
+}
+
+func (snapshotSuite) TestEnsureScheduledSnapshotConflict(c *check.C) {
+	defer mockActiveSnaps("a-snap")()
+	defer snapshotstate.MockSnapstateCheckChangeConflictMany(func(*state.State, []string, string) error {
+		return &snapstate.ChangeConflictError{Snap: "a-snap", ChangeKind: "refresh"}
+	})()
+
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	st.Lock()
+	defer st.Unlock()
+	setCoreConfig(c, st, map[string]interface{}{"snapshots.schedule": "00:00-23:59"})
+	lastBefore := time.Now().Add(-48 * time.Hour)
+	st.Set("last-scheduled-snapshot", lastBefore)
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+
+	// postponed, quietly
+	c.Check(st.Changes(), check.HasLen, 0)
+	c.Check(st.AllWarnings(), check.HasLen, 0)
+	c.Check(snapshotstate.NextScheduledSnapshot(mgr).After(time.Now().Add(5*time.Minute)), check.Equals, true)
+	var last time.Time
+	c.Assert(st.Get("last-scheduled-snapshot", &last), check.IsNil)
+	c.Check(last.Equal(lastBefore), check.Equals, true)
+}
+
+func (snapshotSuite) TestEnsureScheduledSnapshotBadSchedule(c *check.C) {
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	st.Lock()
+	defer st.Unlock()
+	setCoreConfig(c, st, map[string]interface{}{"snapshots.schedule": "invalid"})
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+
+	c.Check(st.Changes(), check.HasLen, 0)
+	warnings := st.AllWarnings()
+	c.Assert(warnings, check.HasLen, 1)
+	c.Check(warnings[0].String(), check.Matches, `cannot take scheduled snapshots: snapshots.schedule cannot be parsed: .*`)
+}
+
+func (snapshotSuite) TestEnsureScheduledSnapshotReportsFailure(c *check.C) {
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	st.Lock()
+	defer st.Unlock()
+	chg := st.NewChange("save-snapshot", "...")
+	task := st.NewTask("save-snapshot", "...")
+	task.Errorf("boom")
+	task.SetStatus(state.ErrorStatus)
+	chg.AddTask(task)
+	st.Set("scheduled-snapshot-change", chg.ID())
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+
+	warnings := st.AllWarnings()
+	c.Assert(warnings, check.HasLen, 1)
+	c.Check(warnings[0].String(), testutil.Contains, "cannot take scheduled snapshot: cannot perform the following tasks:")
+	var chgID string
+	c.Check(st.Get("scheduled-snapshot-change", &chgID), check.Equals, state.ErrNoState)
+}
+
+func (snapshotSuite) TestEnsureScheduledSnapshotPrunesAfterSuccess(c *check.C) {
+	dir := c.MkDir()
+	var files []*os.File
+	for _, name := range []string{"1_a-snap.zip", "1_b-snap.zip", "3_a-snap.zip"} {
+		f, err := os.Create(filepath.Join(dir, name))
+		c.Assert(err, check.IsNil)
+		defer f.Close()
+		files = append(files, f)
+	}
+	defer snapshotstate.MockBackendIter(func(_ context.Context, f func(*backend.Reader) error) error {
+		for _, file := range files {
+			var setID uint64 = 1
+			if filepath.Base(file.Name())[0] == '3' {
+				setID = 3
+			}
+			if err := f(&backend.Reader{Snapshot: client.Snapshot{SetID: setID}, File: file}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})()
+	var removed []string
+	defer snapshotstate.MockBackendRemove(func(fn string) error {
+		removed = append(removed, filepath.Base(fn))
+		return nil
+	})()
+
+	st := state.New(nil)
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+
+	st.Lock()
+	defer st.Unlock()
+	setCoreConfig(c, st, map[string]interface{}{"snapshots.scheduled.keep-last": 2})
+	now := time.Now()
+	for i := 1; i <= 4; i++ {
+		c.Assert(snapshotstate.SaveScheduledTime(st, uint64(i), now.Add(time.Duration(i)*time.Minute)), check.IsNil)
+	}
+	// forgetting was done recently
+	snapshotstate.SetLastForgetExpiredSnapshotTime(mgr, now)
+
+	chg := st.NewChange("save-snapshot", "...")
+	task := st.NewTask("save-snapshot", "...")
+	task.SetStatus(state.DoneStatus)
+	chg.AddTask(task)
+	st.Set("scheduled-snapshot-change", chg.ID())
+
+	st.Unlock()
+	c.Assert(mgr.Ensure(), check.IsNil)
+	st.Lock()
+
+	// all the files of set 1 are gone, set 2 has no files
+	c.Check(removed, check.DeepEquals, []string{"1_a-snap.zip", "1_b-snap.zip"})
+	var snapshots map[uint64]interface{}
+	c.Assert(st.Get("snapshots", &snapshots), check.IsNil)
+	var setIDs []uint64
+	for setID := range snapshots {
+		setIDs = append(setIDs, setID)
+	}
+	sort.Slice(setIDs, func(i, j int) bool { return setIDs[i] < setIDs[j] })
+	c.Check(setIDs, check.DeepEquals, []uint64{2, 3, 4})
+}
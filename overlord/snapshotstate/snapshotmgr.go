@@ -23,7 +23,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"time"
 
 	"gopkg.in/tomb.v2"
@@ -38,7 +37,7 @@ import (
 )
 
 var (
-	osRemove             = os.Remove
+	backendRemove        = backend.Remove
 	snapstateCurrentInfo = snapstate.CurrentInfo
 	configGetSnapConfig  = config.GetSnapConfig
 	configSetSnapConfig  = config.SetSnapConfig
@@ -50,7 +49,8 @@ var (
 	backendRevert        = (*backend.RestoreState).Revert // ditto
 	backendCleanup       = (*backend.RestoreState).Cleanup
 
-	backendCleanupAbandondedImports = backend.CleanupAbandondedImports
+	backendCleanupAbandondedImports  = backend.CleanupAbandondedImports
+	backendCleanupUnreferencedChunks = backend.CleanupUnreferencedChunks
 
 	autoExpirationInterval = time.Hour * 24 // interval between forgetExpiredSnapshots runs as part of Ensure()
 )
@@ -60,6 +60,9 @@ type SnapshotManager struct {
 	state *state.State
 
 	lastForgetExpiredSnapshotTime time.Time
+
+	nextScheduledSnapshot time.Time
+	lastSnapshotSchedule  string
 }
 
 // Manager returns a new SnapshotManager
@@ -82,6 +85,8 @@ func Manager(st *state.State, runner *state.TaskRunner) *SnapshotManager {
 
 // Ensure is part of the overlord.StateManager interface.
 func (mgr *SnapshotManager) Ensure() error {
+	mgr.ensureScheduledSnapshots()
+
 	// process expired snapshots once a day.
 	if time.Now().After(mgr.lastForgetExpiredSnapshotTime.Add(autoExpirationInterval)) {
 		return mgr.forgetExpiredSnapshots()
@@ -94,6 +99,10 @@ func (mgr *SnapshotManager) StartUp() error {
 	if _, err := backendCleanupAbandondedImports(); err != nil {
 		logger.Noticef("cannot cleanup incomplete imports: %v", err)
 	}
+	// this also reclaims the chunks of interrupted saves and imports
+	if _, err := backendCleanupUnreferencedChunks(); err != nil {
+		logger.Noticef("cannot cleanup unused snapshot chunks: %v", err)
+	}
 	return nil
 }
 
@@ -105,11 +114,22 @@ func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
 	if err != nil {
 		return fmt.Errorf("internal error: cannot determine expired snapshots: %v", err)
 	}
+	pruned, err := prunedScheduledSnapshotSets(mgr.state)
+	if err != nil {
+		return fmt.Errorf("internal error: cannot determine scheduled snapshots to forget: %v", err)
+	}
+	for setID := range pruned {
+		if sets == nil {
+			sets = make(map[uint64]bool)
+		}
+		sets[setID] = true
+	}
 
 	if len(sets) == 0 {
 		return nil
 	}
 
+	forgotten := make(map[uint64]bool)
 	err = backendIter(context.TODO(), func(r *backend.Reader) error {
 		// forget needs to conflict with check and restore
 		if err := checkSnapshotTaskConflict(mgr.state, r.SetID, "check-snapshot", "restore-snapshot"); err != nil {
@@ -117,20 +137,26 @@ func (mgr *SnapshotManager) forgetExpiredSnapshots() error {
 			return nil
 		}
 		if sets[r.SetID] {
-			delete(sets, r.SetID)
-			// remove from state first: in case removeSnapshotState succeeds but osRemove fails we will never attempt
-			// to automatically remove this snapshot again and will leave it on the disk (so the user can still try to remove it manually);
-			// this is better than the other way around where a failing osRemove would be retried forever because snapshot would never
-			// leave the state.
-			if err := removeSnapshotState(mgr.state, r.SetID); err != nil {
-				return fmt.Errorf("internal error: cannot remove state of snapshot set %d: %v", r.SetID, err)
+			if !forgotten[r.SetID] {
+				forgotten[r.SetID] = true
+				// remove from state first: in case removeSnapshotState succeeds but backendRemove fails we will never attempt
+				// to automatically remove this snapshot again and will leave it on the disk (so the user can still try to remove it manually);
+				// this is better than the other way around where a failing backendRemove would be retried forever because snapshot would never
+				// leave the state.
+				if err := removeSnapshotState(mgr.state, r.SetID); err != nil {
+					return fmt.Errorf("internal error: cannot remove state of snapshot set %d: %v", r.SetID, err)
+				}
 			}
-			if err := osRemove(r.Name()); err != nil {
+			// scheduled sets have a file for each snap
+			if err := backendRemove(r.Name()); err != nil {
 				return fmt.Errorf("cannot remove snapshot file %q: %v", r.Name(), err)
 			}
 		}
 		return nil
 	})
+	for setID := range forgotten {
+		delete(sets, setID)
+	}
 
 	if err != nil {
 		return fmt.Errorf("cannot process expired snapshots: %v", err)
@@ -165,6 +191,14 @@ type snapshotSetup struct {
 	Filename string        `json:"filename,omitempty"`
 	Current  snap.Revision `json:"current"`
 	Auto     bool          `json:"auto,omitempty"`
+	// Scheduled is set when saving on the snapshots.schedule timer
+	Scheduled bool `json:"scheduled,omitempty"`
+	// Encrypt is set when saving encrypted snapshots; the key itself
+	// is never kept in the state
+	Encrypt bool `json:"encrypt,omitempty"`
+	// KeyGiven is set when a key was given for the task, which is only
+	// kept in memory and so is lost on restart
+	KeyGiven bool `json:"key-given,omitempty"`
 }
 
 func filename(setID uint64, si *snap.Info) string {
@@ -179,17 +213,26 @@ func filename(setID uint64, si *snap.Info) string {
 
 // prepareSave does all the steps of doSave that require the state lock;
 // it has no real significance beyond making the lock handling simpler
-func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg map[string]interface{}, err error) {
+func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg map[string]interface{}, key []byte, err error) {
 	st := task.State()
 	st.Lock()
 	defer st.Unlock()
 
 	if err := task.Get("snapshot-setup", &snapshot); err != nil {
-		return nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
+		return nil, nil, nil, nil, taskGetErrMsg(task, err, "snapshot")
 	}
 	cur, err = snapstateCurrentInfo(st, snapshot.Snap)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
+	}
+	if snapshot.Encrypt {
+		key, err = taskKey(task, snapshot)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if key == nil {
+			return nil, nil, nil, nil, fmt.Errorf("cannot encrypt snapshot: the key is no longer available (keys are not kept across restarts)")
+		}
 	}
 	// updating snapshot-setup with the filename, for use in undo
 	snapshot.Filename = filename(snapshot.SetID, cur)
@@ -197,11 +240,11 @@ func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg
 
 	rawCfg, err := configGetSnapConfig(st, snapshot.Snap)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 	if rawCfg != nil {
 		if err := json.Unmarshal(*rawCfg, &cfg); err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 	}
 
@@ -209,22 +252,29 @@ func prepareSave(task *state.Task) (snapshot *snapshotSetup, cur *snap.Info, cfg
 	if snapshot.Auto {
 		expiration, err := AutomaticSnapshotExpiration(st)
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 		if err := saveExpiration(st, snapshot.SetID, time.Now().Add(expiration)); err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
+		}
+	}
+	if snapshot.Scheduled {
+		if err := saveScheduledTime(st, snapshot.SetID, time.Now()); err != nil {
+			return nil, nil, nil, nil, err
 		}
 	}
 
-	return snapshot, cur, cfg, nil
+	return snapshot, cur, cfg, key, nil
 }
 
 func doSave(task *state.Task, tomb *tomb.Tomb) error {
-	snapshot, cur, cfg, err := prepareSave(task)
+	defer forgetTaskKey(task)
+
+	snapshot, cur, cfg, key, err := prepareSave(task)
 	if err != nil {
 		return err
 	}
-	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users)
+	_, err = backendSave(tomb.Context(nil), snapshot.SetID, cur, cfg, snapshot.Users, key)
 	if err != nil {
 		st := task.State()
 		st.Lock()
@@ -257,16 +307,29 @@ func prepareRestore(task *state.Task) (snapshot *snapshotSetup, oldCfg map[strin
 		}
 	}
 
+	key, err := taskKey(task, snapshot)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	reader, err = backendOpen(snapshot.Filename, backend.ExtractFnameSetID)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("cannot open snapshot: %v", err)
 	}
+	if key != nil {
+		if err := reader.UseKey(key); err != nil {
+			reader.Close()
+			return nil, nil, nil, err
+		}
+	}
 	// note given the Open succeeded, caller needs to close it when done
 
 	return snapshot, oldCfg, reader, nil
 }
 
 func doRestore(task *state.Task, tomb *tomb.Tomb) error {
+	defer forgetTaskKey(task)
+
 	snapshot, oldCfg, reader, err := prepareRestore(task)
 	if err != nil {
 		return err
@@ -362,21 +425,33 @@ func cleanupRestore(task *state.Task, _ *tomb.Tomb) error {
 }
 
 func doCheck(task *state.Task, tomb *tomb.Tomb) error {
+	defer forgetTaskKey(task)
+
 	var snapshot snapshotSetup
 
 	st := task.State()
 	st.Lock()
 	err := task.Get("snapshot-setup", &snapshot)
-	st.Unlock()
 	if err != nil {
+		st.Unlock()
 		return taskGetErrMsg(task, err, "snapshot")
 	}
+	key, err := taskKey(task, &snapshot)
+	st.Unlock()
+	if err != nil {
+		return err
+	}
 
 	reader, err := backendOpen(snapshot.Filename, backend.ExtractFnameSetID)
 	if err != nil {
 		return fmt.Errorf("cannot open snapshot: %v", err)
 	}
 	defer reader.Close()
+	if key != nil {
+		if err := reader.UseKey(key); err != nil {
+			return err
+		}
+	}
 
 	return backendCheck(reader, tomb.Context(nil), snapshot.Users)
 }
@@ -403,7 +478,7 @@ func doForget(task *state.Task, _ *tomb.Tomb) error {
 		return fmt.Errorf("internal error: cannot remove state of snapshot set %d: %v", snapshot.SetID, err)
 	}
 
-	return osRemove(snapshot.Filename)
+	return backendRemove(snapshot.Filename)
 }
 
 func delayedCrossMgrInit() {
@@ -413,7 +488,7 @@ func delayedCrossMgrInit() {
 	snapstate.EstimateSnapshotSize = EstimateSnapshotSize
 }
 
-func MockBackendSave(f func(context.Context, uint64, *snap.Info, map[string]interface{}, []string) (*client.Snapshot, error)) (restore func()) {
+func MockBackendSave(f func(context.Context, uint64, *snap.Info, map[string]interface{}, []string, []byte) (*client.Snapshot, error)) (restore func()) {
 	old := backendSave
 	backendSave = f
 	return func() {
@@ -23,6 +23,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
@@ -35,6 +36,7 @@ import (
 	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapshotstate"
 	"github.com/snapcore/snapd/overlord/snapshotstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
@@ -81,11 +83,11 @@ func mockDummySnapshot(c *check.C) (restore func()) {
 
 func (snapshotSuite) TestEnsureForgetsSnapshots(c *check.C) {
 	var removedSnapshot string
-	restoreOsRemove := snapshotstate.MockOsRemove(func(fileName string) error {
+	restoreBackendRemove := snapshotstate.MockBackendRemove(func(fileName string) error {
 		removedSnapshot = fileName
 		return nil
 	})
-	defer restoreOsRemove()
+	defer restoreBackendRemove()
 
 	restore := mockDummySnapshot(c)
 	defer restore()
@@ -130,10 +132,10 @@ func (snapshotSuite) TestEnsureForgetsSnapshotsRunsRegularly(c *check.C) {
 	restoreBackendIter := snapshotstate.MockBackendIter(fakeIter)
 	defer restoreBackendIter()
 
-	restoreOsRemove := snapshotstate.MockOsRemove(func(fileName string) error {
+	restoreBackendRemove := snapshotstate.MockBackendRemove(func(fileName string) error {
 		return nil
 	})
-	defer restoreOsRemove()
+	defer restoreBackendRemove()
 
 	st := state.New(nil)
 	runner := state.NewTaskRunner(st)
@@ -169,11 +171,11 @@ func (snapshotSuite) TestEnsureForgetsSnapshotsRunsRegularly(c *check.C) {
 
 func (snapshotSuite) testEnsureForgetSnapshotsConflict(c *check.C, snapshotTaskKind string) {
 	removeCalled := 0
-	restoreOsRemove := snapshotstate.MockOsRemove(func(string) error {
+	restoreBackendRemove := snapshotstate.MockBackendRemove(func(string) error {
 		removeCalled++
 		return nil
 	})
-	defer restoreOsRemove()
+	defer restoreBackendRemove()
 
 	restore := mockDummySnapshot(c)
 	defer restore()
@@ -263,7 +265,7 @@ func (snapshotSuite) TestDoSave(c *check.C) {
 		buf := json.RawMessage(`{"hello": "there"}`)
 		return &buf, nil
 	})()
-	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string) (*client.Snapshot, error) {
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
 		c.Check(id, check.Equals, uint64(42))
 		c.Check(si, check.DeepEquals, &snapInfo)
 		c.Check(cfg, check.DeepEquals, map[string]interface{}{"hello": "there"})
@@ -284,12 +286,84 @@ func (snapshotSuite) TestDoSave(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (snapshotSuite) TestDoSaveEncrypted(c *check.C) {
+	snapInfo := snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "a-snap",
+			Revision: snap.R(-1),
+		},
+		Version: "1.33",
+	}
+	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) { return &snapInfo, nil })()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) { return nil, nil })()
+	var savedKey []byte
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
+		savedKey = key
+		return nil, nil
+	})()
+
+	st := state.New(nil)
+	st.Lock()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":    42,
+		"snap":      "a-snap",
+		"encrypt":   true,
+		"key-given": true,
+	})
+	snapshotstate.SetTaskKey(task, []byte("sekrit"))
+	st.Unlock()
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(savedKey, check.DeepEquals, []byte("sekrit"))
+
+	// the key is forgotten once used, as it is on restart
+	err = snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `cannot use the key given for snapshot set #42: keys are not kept across restarts, retry the operation`)
+}
+
+func (snapshotSuite) TestDoSaveEncryptedKeyFile(c *check.C) {
+	snapInfo := snap.Info{
+		SideInfo: snap.SideInfo{
+			RealName: "a-snap",
+			Revision: snap.R(-1),
+		},
+		Version: "1.33",
+	}
+	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) { return &snapInfo, nil })()
+	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) { return nil, nil })()
+	var savedKey []byte
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
+		savedKey = key
+		return nil, nil
+	})()
+
+	keyFile := filepath.Join(c.MkDir(), "key")
+	c.Assert(ioutil.WriteFile(keyFile, []byte("from-file"), 0600), check.IsNil)
+
+	st := state.New(nil)
+	st.Lock()
+	tr := config.NewTransaction(st)
+	tr.Set("core", "snapshots.encryption", keyFile)
+	tr.Commit()
+	task := st.NewTask("save-snapshot", "...")
+	task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":  42,
+		"snap":    "a-snap",
+		"encrypt": true,
+	})
+	st.Unlock()
+	err := snapshotstate.DoSave(task, &tomb.Tomb{})
+	c.Assert(err, check.IsNil)
+	c.Check(savedKey, check.DeepEquals, []byte("from-file"))
+}
+
 func (snapshotSuite) TestDoSaveFailsWithNoSnap(c *check.C) {
 	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) {
 		return nil, errors.New("bzzt")
 	})()
 	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) { return nil, nil })()
-	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string) (*client.Snapshot, error) {
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
 		return nil, nil
 	})()
 
@@ -316,7 +390,7 @@ func (snapshotSuite) TestDoSaveFailsWithNoSnapshot(c *check.C) {
 	}
 	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) { return &snapInfo, nil })()
 	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) { return nil, nil })()
-	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string) (*client.Snapshot, error) {
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
 		return nil, nil
 	})()
 
@@ -340,7 +414,7 @@ func (snapshotSuite) TestDoSaveFailsBackendError(c *check.C) {
 	}
 	defer snapshotstate.MockSnapstateCurrentInfo(func(*state.State, string) (*snap.Info, error) { return &snapInfo, nil })()
 	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) { return nil, nil })()
-	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string) (*client.Snapshot, error) {
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
 		return nil, errors.New("bzzt")
 	})()
 
@@ -369,7 +443,7 @@ func (snapshotSuite) TestDoSaveFailsConfigError(c *check.C) {
 	defer snapshotstate.MockConfigGetSnapConfig(func(*state.State, string) (*json.RawMessage, error) {
 		return nil, errors.New("bzzt")
 	})()
-	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string) (*client.Snapshot, error) {
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
 		return nil, nil
 	})()
 
@@ -400,7 +474,7 @@ func (snapshotSuite) TestDoSaveFailsBadConfig(c *check.C) {
 		buf := json.RawMessage(`"hello-there"`)
 		return &buf, nil
 	})()
-	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string) (*client.Snapshot, error) {
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
 		return nil, nil
 	})()
 
@@ -433,7 +507,7 @@ func (snapshotSuite) TestDoSaveFailureRemovesStateEntry(c *check.C) {
 	defer snapshotstate.MockConfigGetSnapConfig(func(_ *state.State, snapname string) (*json.RawMessage, error) {
 		return nil, nil
 	})()
-	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string) (*client.Snapshot, error) {
+	defer snapshotstate.MockBackendSave(func(_ context.Context, id uint64, si *snap.Info, cfg map[string]interface{}, usernames []string, key []byte) (*client.Snapshot, error) {
 		var expirations map[uint64]interface{}
 		st.Lock()
 		defer st.Unlock()
@@ -487,7 +561,7 @@ func (rs *readerSuite) SetUpTest(c *check.C) {
 
 	rs.calls = nil
 	rs.restores = []func(){
-		snapshotstate.MockOsRemove(func(string) error {
+		snapshotstate.MockBackendRemove(func(string) error {
 			rs.calls = append(rs.calls, "remove")
 			return nil
 		}),
@@ -699,8 +773,54 @@ func (rs *readerSuite) TestDoCheck(c *check.C) {
 	c.Check(rs.calls, check.DeepEquals, []string{"open", "check"})
 }
 
+func (rs *readerSuite) TestDoCheckKeyLost(c *check.C) {
+	st := rs.task.State()
+	st.Lock()
+	rs.task.Set("snapshot-setup", map[string]interface{}{
+		"set-id":    1,
+		"snap":      "a-snap",
+		"filename":  "/some/1_file.zip",
+		"key-given": true,
+	})
+	// a key file is set, but it is not the key that was given
+	tr := config.NewTransaction(st)
+	c.Assert(tr.Set("core", "snapshots.encryption", "/some/key/file"), check.IsNil)
+	tr.Commit()
+	st.Unlock()
+
+	err := snapshotstate.DoCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.ErrorMatches, `cannot use the key given for snapshot set #1: keys are not kept across restarts, retry the operation`)
+	c.Check(rs.calls, check.HasLen, 0)
+}
+
+func (rs *readerSuite) TestDoCheckWrongKey(c *check.C) {
+	defer snapshotstate.MockBackendOpen(func(filename string, setID uint64) (*backend.Reader, error) {
+		rs.calls = append(rs.calls, "open")
+		return &backend.Reader{
+			Snapshot: client.Snapshot{
+				Encryption: &client.SnapshotEncryption{
+					Cipher:   "aes-256-gcm",
+					KDF:      "openpgp-s2k-iterated-sha256",
+					Salt:     []byte("salt"),
+					Count:    1024,
+					KeyCheck: "not-the-key-check",
+				},
+			},
+		}, nil
+	})()
+
+	st := rs.task.State()
+	st.Lock()
+	snapshotstate.SetTaskKey(rs.task, []byte("sekrit"))
+	st.Unlock()
+
+	err := snapshotstate.DoCheck(rs.task, &tomb.Tomb{})
+	c.Assert(err, check.Equals, backend.ErrWrongKey)
+	c.Check(rs.calls, check.DeepEquals, []string{"open"})
+}
+
 func (rs *readerSuite) TestDoRemove(c *check.C) {
-	defer snapshotstate.MockOsRemove(func(filename string) error {
+	defer snapshotstate.MockBackendRemove(func(filename string) error {
 		c.Check(filename, check.Equals, "/some/1_file.zip")
 		rs.calls = append(rs.calls, "remove")
 		return nil
@@ -711,7 +831,7 @@ func (rs *readerSuite) TestDoRemove(c *check.C) {
 }
 
 func (rs *readerSuite) TestDoForgetRemovesAutomaticSnapshotExpiry(c *check.C) {
-	defer snapshotstate.MockOsRemove(func(filename string) error {
+	defer snapshotstate.MockBackendRemove(func(filename string) error {
 		return nil
 	})()
 
@@ -766,6 +886,29 @@ func (snapshotSuite) TestManagerRunCleanupAbandondedImportsAtStartup(c *check.C)
 	c.Check(n, check.Equals, 1)
 }
 
+func (snapshotSuite) TestManagerRunCleanupUnreferencedChunksAtStartup(c *check.C) {
+	logbuf, restore := logger.MockLogger()
+	defer restore()
+
+	n := 0
+	restore = snapshotstate.MockBackendCleanupUnreferencedChunks(func() (int, error) {
+		n++
+		return 0, errors.New("some error")
+	})
+	defer restore()
+
+	o := overlord.Mock()
+	st := o.State()
+	mgr := snapshotstate.Manager(st, state.NewTaskRunner(st))
+	c.Assert(mgr, check.NotNil)
+	o.AddManager(mgr)
+	err := o.Settle(100 * time.Millisecond)
+	c.Assert(err, check.IsNil)
+
+	c.Check(n, check.Equals, 1)
+	c.Check(logbuf.String(), testutil.Contains, "cannot cleanup unused snapshot chunks: some error\n")
+}
+
 func (snapshotSuite) TestManagerRunCleanupAbandondedImportsAtStartupErrorLogged(c *check.C) {
 	logbuf, restore := logger.MockLogger()
 	defer restore()
@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"sort"
 	"time"
 
@@ -44,6 +45,7 @@ var (
 	backendIter                      = backend.Iter
 	backendEstimateSnapshotSize      = backend.EstimateSnapshotSize
 	backendList                      = backend.List
+	ioutilReadFile                   = ioutil.ReadFile
 
 	// Default expiration time for automatic snapshots, if not set by the user
 	defaultAutomaticSnapshotExpiration = time.Hour * 24 * 31
@@ -51,6 +53,10 @@ var (
 
 type snapshotState struct {
 	ExpiryTime time.Time `json:"expiry-time"`
+	// ScheduledTime is set for the sets taken on the snapshots.schedule
+	// timer, which are forgotten following the retention policy
+	// rather than on expiry
+	ScheduledTime *time.Time `json:"scheduled-time,omitempty"`
 }
 
 func newSnapshotSetID(st *state.State) (uint64, error) {
@@ -143,9 +149,84 @@ func AutomaticSnapshotExpiration(st *state.State) (time.Duration, error) {
 	return defaultAutomaticSnapshotExpiration, nil
 }
 
+// encryptionKeyFile returns the path of the file holding the key used to
+// encrypt snapshots, if set with the snapshots.encryption option.
+func encryptionKeyFile(st *state.State) (string, error) {
+	var keyFile string
+	tr := config.NewTransaction(st)
+	err := tr.Get("core", "snapshots.encryption", &keyFile)
+	if err != nil && !config.IsNoOption(err) {
+		return "", err
+	}
+	return keyFile, nil
+}
+
+// snapshotKeysKey is the cache key of the keys given for snapshot tasks,
+// by task ID. Keys are only ever kept in memory.
+type snapshotKeysKey struct{}
+
+func cachedKeys(st *state.State) map[string][]byte {
+	keys, _ := st.Cached(snapshotKeysKey{}).(map[string][]byte)
+	if keys == nil {
+		keys = make(map[string][]byte)
+		st.Cache(snapshotKeysKey{}, keys)
+	}
+	return keys
+}
+
+func setTaskKey(task *state.Task, key []byte) {
+	if key != nil {
+		cachedKeys(task.State())[task.ID()] = key
+	}
+}
+
+func forgetTaskKey(task *state.Task) {
+	st := task.State()
+	st.Lock()
+	defer st.Unlock()
+	delete(cachedKeys(st), task.ID())
+}
+
+// taskKey returns the key given for the task or, if none was given, the
+// one from the file set with the snapshots.encryption option, if any.
+func taskKey(task *state.Task, snapshot *snapshotSetup) ([]byte, error) {
+	st := task.State()
+	if key, ok := cachedKeys(st)[task.ID()]; ok {
+		return key, nil
+	}
+	if snapshot.KeyGiven {
+		// do not fall back to a different key
+		return nil, fmt.Errorf("cannot use the key given for snapshot set #%d: keys are not kept across restarts, retry the operation", snapshot.SetID)
+	}
+	keyFile, err := encryptionKeyFile(st)
+	if err != nil || keyFile == "" {
+		return nil, err
+	}
+	key, err := ioutilReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read snapshot encryption key: %v", err)
+	}
+	return key, nil
+}
+
 // saveExpiration saves expiration date of the given snapshot set, in the state.
 // The state needs to be locked by the caller.
 func saveExpiration(st *state.State, setID uint64, expiryTime time.Time) error {
+	return saveSnapshotState(st, setID, &snapshotState{
+		ExpiryTime: expiryTime,
+	})
+}
+
+// saveScheduledTime saves the time the given scheduled snapshot set was
+// taken, in the state.
+// The state needs to be locked by the caller.
+func saveScheduledTime(st *state.State, setID uint64, scheduledTime time.Time) error {
+	return saveSnapshotState(st, setID, &snapshotState{
+		ScheduledTime: &scheduledTime,
+	})
+}
+
+func saveSnapshotState(st *state.State, setID uint64, snapshotSet *snapshotState) error {
 	var snapshots map[uint64]*json.RawMessage
 	err := st.Get("snapshots", &snapshots)
 	if err != nil && err != state.ErrNoState {
@@ -154,9 +235,7 @@ func saveExpiration(st *state.State, setID uint64, expiryTime time.Time) error {
 	if snapshots == nil {
 		snapshots = make(map[uint64]*json.RawMessage)
 	}
-	data, err := json.Marshal(&snapshotState{
-		ExpiryTime: expiryTime,
-	})
+	data, err := json.Marshal(snapshotSet)
 	if err != nil {
 		return err
 	}
@@ -199,6 +278,10 @@ func expiredSnapshotSets(st *state.State, cutoffTime time.Time) (map[uint64]bool
 
 	expired := make(map[uint64]bool)
 	for setID, snapshotSet := range snapshots {
+		if snapshotSet.ExpiryTime.IsZero() {
+			// scheduled sets do not expire
+			continue
+		}
 		if snapshotSet.ExpiryTime.Before(cutoffTime) {
 			expired[setID] = true
 		}
@@ -220,10 +303,20 @@ func (summaries snapshotSnapSummaries) snapNames() []string {
 }
 
 type snapshotSnapSummary struct {
-	snap     string
-	snapID   string
-	filename string
-	epoch    snap.Epoch
+	snap      string
+	snapID    string
+	filename  string
+	epoch     snap.Epoch
+	encrypted bool
+}
+
+func (summaries snapshotSnapSummaries) encrypted() bool {
+	for _, summary := range summaries {
+		if summary.encrypted {
+			return true
+		}
+	}
+	return false
 }
 
 // snapSummariesInSnapshotSet goes looking for the requested snaps in the
@@ -236,10 +329,11 @@ func snapSummariesInSnapshotSet(setID uint64, requested []string) (summaries sna
 			found = true
 			if len(requested) == 0 || strutil.SortedListContains(requested, r.Snap) {
 				summaries = append(summaries, &snapshotSnapSummary{
-					filename: r.Name(),
-					snap:     r.Snap,
-					snapID:   r.SnapID,
-					epoch:    r.Epoch,
+					filename:  r.Name(),
+					snap:      r.Snap,
+					snapID:    r.SnapID,
+					epoch:     r.Epoch,
+					encrypted: r.Encryption != nil,
 				})
 			}
 		}
@@ -323,24 +417,42 @@ func List(ctx context.Context, st *state.State, setID uint64, snapNames []string
 //          newImportTransaction(setID).Cancel()
 //      But it needs to happen early *before* anything can start new imports
 
-// Import a given snapshot ID from an exported snapshot
-func Import(ctx context.Context, st *state.State, r io.Reader) (setID uint64, snapNames []string, err error) {
+// Import a given snapshot ID from an exported snapshot. The key is
+// needed to verify encrypted snapshots, if not given the one set with
+// the snapshots.encryption option is used.
+func Import(ctx context.Context, st *state.State, r io.Reader, key []byte) (setID uint64, snapNames []string, err error) {
 	st.Lock()
 	setID, err = newSnapshotSetID(st)
+	var keyFile string
+	if err == nil && key == nil {
+		keyFile, err = encryptionKeyFile(st)
+	}
 	st.Unlock()
 	if err != nil {
 		return 0, nil, err
 	}
-	snapNames, err = backendImport(ctx, setID, r)
+	if keyFile != "" {
+		key, err = ioutilReadFile(keyFile)
+		if err != nil {
+			return 0, nil, fmt.Errorf("cannot read snapshot encryption key: %v", err)
+		}
+	}
+	snapNames, err = backendImport(ctx, setID, r, key)
 	if err != nil {
 		return 0, nil, err
 	}
 	return setID, snapNames, nil
 }
 
-// Save creates a taskset for taking snapshots of snaps' data.
+// Save creates a taskset for taking snapshots of snaps' data. If a key
+// is given, or one is set with the snapshots.encryption option, the
+// snapshots are encrypted.
 // Note that the state must be locked by the caller.
-func Save(st *state.State, instanceNames []string, users []string) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+func Save(st *state.State, instanceNames []string, users []string, key []byte) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
+	return save(st, instanceNames, users, key, false)
+}
+
+func save(st *state.State, instanceNames []string, users []string, key []byte, scheduled bool) (setID uint64, snapsSaved []string, ts *state.TaskSet, err error) {
 	if len(instanceNames) == 0 {
 		instanceNames, err = allActiveSnapNames(st)
 		if err != nil {
@@ -353,6 +465,11 @@ func Save(st *state.State, instanceNames []string, users []string) (setID uint64
 		return 0, nil, nil, err
 	}
 
+	keyFile, err := encryptionKeyFile(st)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
 	setID, err = newSnapshotSetID(st)
 	if err != nil {
 		return 0, nil, nil, err
@@ -364,11 +481,15 @@ func Save(st *state.State, instanceNames []string, users []string) (setID uint64
 		desc := fmt.Sprintf("Save data of snap %q in snapshot set #%d", name, setID)
 		task := st.NewTask("save-snapshot", desc)
 		snapshot := snapshotSetup{
-			SetID: setID,
-			Snap:  name,
-			Users: users,
+			SetID:     setID,
+			Snap:      name,
+			Users:     users,
+			Scheduled: scheduled,
+			Encrypt:   key != nil || keyFile != "",
+			KeyGiven:  key != nil,
 		}
 		task.Set("snapshot-setup", &snapshot)
+		setTaskKey(task, key)
 		// Here, note that a snapshot set behaves as a unit: it either
 		// succeeds, or fails, as a whole; we don't use lanes, to have
 		// some snaps' snapshot succeed and not others in a single set.
@@ -394,6 +515,10 @@ func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err
 	if expiration == 0 {
 		return nil, snapstate.ErrNothingToDo
 	}
+	keyFile, err := encryptionKeyFile(st)
+	if err != nil {
+		return nil, err
+	}
 	setID, err := newSnapshotSetID(st)
 	if err != nil {
 		return nil, err
@@ -403,9 +528,10 @@ func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err
 	desc := fmt.Sprintf("Save data of snap %q in automatic snapshot set #%d", snapName, setID)
 	task := st.NewTask("save-snapshot", desc)
 	snapshot := snapshotSetup{
-		SetID: setID,
-		Snap:  snapName,
-		Auto:  true,
+		SetID:   setID,
+		Snap:    snapName,
+		Auto:    true,
+		Encrypt: keyFile != "",
 	}
 	task.Set("snapshot-setup", &snapshot)
 	ts.AddTask(task)
@@ -413,13 +539,18 @@ func AutomaticSnapshot(st *state.State, snapName string) (ts *state.TaskSet, err
 	return ts, nil
 }
 
-// Restore creates a taskset for restoring a snapshot's data.
+// Restore creates a taskset for restoring a snapshot's data. The key is
+// needed for encrypted snapshots, if not given the one set with the
+// snapshots.encryption option is used.
 // Note that the state must be locked by the caller.
-func Restore(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
+func Restore(st *state.State, setID uint64, snapNames []string, users []string, key []byte) (snapsFound []string, ts *state.TaskSet, err error) {
 	summaries, err := snapSummariesInSnapshotSet(setID, snapNames)
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := checkKeyAvailable(st, setID, summaries, key); err != nil {
+		return nil, nil, err
+	}
 	all, err := snapstateAll(st)
 	if err != nil {
 		return nil, nil, err
@@ -465,8 +596,10 @@ func Restore(st *state.State, setID uint64, snapNames []string, users []string)
 			Users:    users,
 			Filename: summary.filename,
 			Current:  current,
+			KeyGiven: key != nil,
 		}
 		task.Set("snapshot-setup", &snapshot)
+		setTaskKey(task, key)
 		// see the note about snapshots not using lanes, above.
 		ts.AddTask(task)
 	}
@@ -474,9 +607,11 @@ func Restore(st *state.State, setID uint64, snapNames []string, users []string)
 	return snapsFound, ts, nil
 }
 
-// Check creates a taskset for checking a snapshot's data.
+// Check creates a taskset for checking a snapshot's data. The key is
+// needed for encrypted snapshots, if not given the one set with the
+// snapshots.encryption option is used.
 // Note that the state must be locked by the caller.
-func Check(st *state.State, setID uint64, snapNames []string, users []string) (snapsFound []string, ts *state.TaskSet, err error) {
+func Check(st *state.State, setID uint64, snapNames []string, users []string, key []byte) (snapsFound []string, ts *state.TaskSet, err error) {
 	// check needs to conflict with forget of itself
 	if err := checkSnapshotTaskConflict(st, setID, "forget-snapshot"); err != nil {
 		return nil, nil, err
@@ -486,6 +621,9 @@ func Check(st *state.State, setID uint64, snapNames []string, users []string) (s
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := checkKeyAvailable(st, setID, summaries, key); err != nil {
+		return nil, nil, err
+	}
 
 	ts = state.NewTaskSet()
 
@@ -497,14 +635,32 @@ func Check(st *state.State, setID uint64, snapNames []string, users []string) (s
 			Snap:     summary.snap,
 			Users:    users,
 			Filename: summary.filename,
+			KeyGiven: key != nil,
 		}
 		task.Set("snapshot-setup", &snapshot)
+		setTaskKey(task, key)
 		ts.AddTask(task)
 	}
 
 	return summaries.snapNames(), ts, nil
 }
 
+// checkKeyAvailable returns an error if the snapshots are encrypted but
+// no key is given or set with the snapshots.encryption option.
+func checkKeyAvailable(st *state.State, setID uint64, summaries snapshotSnapSummaries, key []byte) error {
+	if key != nil || !summaries.encrypted() {
+		return nil
+	}
+	keyFile, err := encryptionKeyFile(st)
+	if err != nil {
+		return err
+	}
+	if keyFile == "" {
+		return fmt.Errorf("cannot use snapshot set #%d: it is encrypted and no key was given", setID)
+	}
+	return nil
+}
+
 // Forget creates a taskset for deletinig a snapshot.
 // Note that the state must be locked by the caller.
 func Forget(st *state.State, setID uint64, snapNames []string) (snapsFound []string, ts *state.TaskSet, err error) {
@@ -570,6 +570,16 @@ var asyncPendingRefreshNotification = func(context context.Context, client *user
 	}()
 }
 
+// asyncFinishRefreshNotification broadcasts a desktop notification about a
+// completed refresh in a goroutine, see asyncPendingRefreshNotification.
+var asyncFinishRefreshNotification = func(context context.Context, client *userclient.Client, refreshInfo *userclient.FinishedSnapRefreshInfo) {
+	go func() {
+		if err := client.FinishRefreshNotification(context, refreshInfo); err != nil {
+			logger.Noticef("Cannot send notification about finished refresh: %v", err)
+		}
+	}()
+}
+
 // inhibitRefresh returns an error if refresh is inhibited by running apps.
 //
 // Internally the snap state is updated to remember when the inhibition first
@@ -583,8 +593,10 @@ func inhibitRefresh(st *state.State, snapst *SnapState, info *snap.Info, checker
 
 	// Get pending refresh information from compatible errors or synthesize a new one.
 	var refreshInfo *userclient.PendingSnapRefreshInfo
+	var uids []int
 	if err, ok := checkerErr.(*BusySnapError); ok {
 		refreshInfo = err.PendingSnapRefreshInfo()
+		uids = usersOfPids(err.Pids())
 	} else {
 		refreshInfo = &userclient.PendingSnapRefreshInfo{
 			InstanceName: info.InstanceName(),
@@ -617,7 +629,45 @@ func inhibitRefresh(st *state.State, snapst *SnapState, info *snap.Info, checker
 		checkerErr = nil
 	}
 
+	// Users that postponed the refresh do not want to hear about it until
+	// the refresh is forced.
+	if checkerErr != nil && snapst.RefreshPostponedUntil != nil && now.Before(*snapst.RefreshPostponedUntil) {
+		return checkerErr
+	}
+
+	// Only notify the users running the snap, if they are known.
+	client := userclient.New()
+	if len(uids) > 0 {
+		client = userclient.NewForUids(uids...)
+		// remember them to let them know when the refresh finishes
+		snapst.RefreshInhibitedUids = mergeUids(snapst.RefreshInhibitedUids, uids)
+		Set(st, info.InstanceName(), snapst)
+	}
 	// Send the notification asynchronously to avoid holding the state lock.
-	asyncPendingRefreshNotification(context.TODO(), userclient.New(), refreshInfo)
+	asyncPendingRefreshNotification(context.TODO(), client, refreshInfo)
 	return checkerErr
 }
+
+// postponeRefreshDuration is for how long users can ask not to be notified
+// again about a refresh inhibited by running apps.
+const postponeRefreshDuration = 24 * time.Hour
+
+// PostponeRefresh records that the users do not want to be notified again
+// about the refresh of the given snap, inhibited by running apps, for a
+// while. The refresh is still forced once the inhibition window ends.
+func PostponeRefresh(st *state.State, instanceName string) error {
+	var snapst SnapState
+	if err := Get(st, instanceName, &snapst); err != nil {
+		return err
+	}
+	if snapst.RefreshInhibitedTime == nil {
+		return fmt.Errorf("no pending refresh of snap %q", instanceName)
+	}
+	until := timeNow().Add(postponeRefreshDuration)
+	if deadline := snapst.RefreshInhibitedTime.Add(maxInhibition); until.After(deadline) {
+		until = deadline
+	}
+	snapst.RefreshPostponedUntil = &until
+	Set(st, instanceName, &snapst)
+	return nil
+}
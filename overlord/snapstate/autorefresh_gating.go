@@ -0,0 +1,669 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/strutil"
+)
+
+// maxHoldDuration is the maximum time a single hold requested by a gating
+// snap lasts. Holds can be renewed, but never beyond maxPostponement since
+// the refresh of the affected snap was first held.
+const maxHoldDuration = 7 * 24 * time.Hour
+
+var timeNow = time.Now
+
+// holdState represents the state of a hold on the refresh of a snap
+// requested by a gating snap.
+type holdState struct {
+	// FirstHeld is the time when the snap was first held by the gating
+	// snap, it is used to enforce the maximum postponement.
+	FirstHeld time.Time `json:"first-held"`
+	// HoldUntil is the time until the refresh of the snap is held.
+	HoldUntil time.Time `json:"hold-until"`
+}
+
+// refreshCandidate describes a pending auto-refresh of a snap.
+type refreshCandidate struct {
+	Channel  string        `json:"channel,omitempty"`
+	Version  string        `json:"version,omitempty"`
+	Revision snap.Revision `json:"revision"`
+}
+
+// HoldError is returned by HoldRefresh when some of the snaps cannot be held
+// anymore because the maximum postponement was reached.
+type HoldError struct {
+	// SnapsInError maps the snaps that could not be held to the reason.
+	SnapsInError map[string]string
+}
+
+func (h *HoldError) Error() string {
+	names := make([]string, 0, len(h.SnapsInError))
+	for name := range h.SnapsInError {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reasons := make([]string, 0, len(names))
+	for _, name := range names {
+		reasons = append(reasons, fmt.Sprintf("%s (%s)", name, h.SnapsInError[name]))
+	}
+	return fmt.Sprintf("cannot hold some snaps:\n - %s", strings.Join(reasons, "\n - "))
+}
+
+func refreshHolds(st *state.State) (map[string]map[string]*holdState, error) {
+	// held snap -> holding snap(s) -> first-held/hold-until time
+	var holds map[string]map[string]*holdState
+	if err := st.Get("snaps-hold", &holds); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+	if holds == nil {
+		holds = make(map[string]map[string]*holdState)
+	}
+	return holds, nil
+}
+
+func setRefreshHolds(st *state.State, holds map[string]map[string]*holdState) {
+	if len(holds) == 0 {
+		st.Set("snaps-hold", nil)
+		return
+	}
+	st.Set("snaps-hold", holds)
+}
+
+// HoldRefresh marks the snaps affectingSnaps as held for refresh on behalf of
+// the gatingSnap, for up to maxHoldDuration. A snap cannot be held for longer
+// than maxPostponement since it was first held by the gating snap, in which
+// case a *HoldError is returned and the other snaps are held nonetheless.
+func HoldRefresh(st *state.State, gatingSnap string, affectingSnaps ...string) error {
+	holds, err := refreshHolds(st)
+	if err != nil {
+		return err
+	}
+
+	now := timeNow()
+	herr := &HoldError{SnapsInError: make(map[string]string)}
+	for _, heldSnap := range affectingSnaps {
+		hold, ok := holds[heldSnap][gatingSnap]
+		if !ok {
+			hold = &holdState{FirstHeld: now}
+		}
+		limit := hold.FirstHeld.Add(maxPostponement)
+		if !now.Before(limit) {
+			herr.SnapsInError[heldSnap] = fmt.Sprintf("maximum postponement of %d days reached", int(maxPostponement.Hours()/24))
+			continue
+		}
+		hold.HoldUntil = now.Add(maxHoldDuration)
+		if hold.HoldUntil.After(limit) {
+			hold.HoldUntil = limit
+		}
+		if holds[heldSnap] == nil {
+			holds[heldSnap] = make(map[string]*holdState)
+		}
+		holds[heldSnap][gatingSnap] = hold
+	}
+	setRefreshHolds(st, holds)
+
+	if len(herr.SnapsInError) > 0 {
+		return herr
+	}
+	return nil
+}
+
+// ProceedWithRefresh drops all the holds of the gatingSnap, allowing the
+// snaps it was holding to be refreshed.
+func ProceedWithRefresh(st *state.State, gatingSnap string) error {
+	holds, err := refreshHolds(st)
+	if err != nil {
+		return err
+	}
+	for heldSnap, holdingSnaps := range holds {
+		delete(holdingSnaps, gatingSnap)
+		if len(holdingSnaps) == 0 {
+			delete(holds, heldSnap)
+		}
+	}
+	setRefreshHolds(st, holds)
+	return nil
+}
+
+// holdingUser is recorded as the holding snap of the refresh holds
+// requested by the user rather than by a gating snap.
+const holdingUser = "system"
+
+// HoldForever is the duration of a refresh hold requested by the user which
+// never expires.
+const HoldForever = time.Duration(math.MaxInt64)
+
+// HoldRefreshesByUser holds the refreshes of the given snaps on behalf of
+// the user for the given duration, or forever with HoldForever. Other
+// durations cannot exceed maxPostponement. Unlike the holds of gating
+// snaps, these also apply to refreshes of all snaps requested by the user,
+// but not to refreshes of the held snaps requested explicitly.
+func HoldRefreshesByUser(st *state.State, duration time.Duration, snaps []string) error {
+	if len(snaps) == 0 {
+		return fmt.Errorf("no snaps to hold")
+	}
+	if duration <= 0 {
+		return fmt.Errorf("invalid hold duration %v", duration)
+	}
+	if duration != HoldForever && duration > maxPostponement {
+		return fmt.Errorf("cannot hold refreshes for more than %d days unless forever", int(maxPostponement.Hours()/24))
+	}
+	for _, name := range snaps {
+		var snapst SnapState
+		if err := Get(st, name, &snapst); err != nil {
+			if err == state.ErrNoState {
+				return &snap.NotInstalledError{Snap: name}
+			}
+			return err
+		}
+	}
+
+	holds, err := refreshHolds(st)
+	if err != nil {
+		return err
+	}
+	now := timeNow()
+	for _, name := range snaps {
+		if holds[name] == nil {
+			holds[name] = make(map[string]*holdState)
+		}
+		holds[name][holdingUser] = &holdState{
+			FirstHeld: now,
+			HoldUntil: now.Add(duration),
+		}
+	}
+	setRefreshHolds(st, holds)
+	return nil
+}
+
+// UnholdRefreshesByUser drops the refresh holds requested by the user for
+// the given snaps, or for all snaps if none is given.
+func UnholdRefreshesByUser(st *state.State, snaps []string) error {
+	holds, err := refreshHolds(st)
+	if err != nil {
+		return err
+	}
+	for heldSnap, holdingSnaps := range holds {
+		if len(snaps) != 0 && !strutil.ListContains(snaps, heldSnap) {
+			continue
+		}
+		delete(holdingSnaps, holdingUser)
+		if len(holdingSnaps) == 0 {
+			delete(holds, heldSnap)
+		}
+	}
+	setRefreshHolds(st, holds)
+	return nil
+}
+
+// userHeldSnaps returns the snaps whose refreshes are held by the user,
+// mapped to the time until which they are held.
+func userHeldSnaps(st *state.State) (map[string]time.Time, error) {
+	// prune the expired holds first
+	if _, err := HeldSnaps(st); err != nil {
+		return nil, err
+	}
+	holds, err := refreshHolds(st)
+	if err != nil {
+		return nil, err
+	}
+	var held map[string]time.Time
+	for heldSnap, holdingSnaps := range holds {
+		hold, ok := holdingSnaps[holdingUser]
+		if !ok {
+			continue
+		}
+		if held == nil {
+			held = make(map[string]time.Time)
+		}
+		held[heldSnap] = hold.HoldUntil
+	}
+	return held, nil
+}
+
+// HeldSnaps returns the snaps whose refresh is currently held, by gating
+// snaps or by the user, mapped to the time until which they are held.
+// Expired holds, and holds of snaps which are no longer installed, are
+// pruned.
+func HeldSnaps(st *state.State) (map[string]time.Time, error) {
+	holds, err := refreshHolds(st)
+	if err != nil {
+		return nil, err
+	}
+	if len(holds) == 0 {
+		return nil, nil
+	}
+
+	installed := func(name string) bool {
+		var snapst SnapState
+		return Get(st, name, &snapst) == nil
+	}
+
+	now := timeNow()
+	held := make(map[string]time.Time)
+	for heldSnap, holdingSnaps := range holds {
+		for holdingSnap, hold := range holdingSnaps {
+			if !hold.HoldUntil.After(now) || (holdingSnap != holdingUser && !installed(holdingSnap)) {
+				delete(holdingSnaps, holdingSnap)
+				continue
+			}
+			if hold.HoldUntil.After(held[heldSnap]) {
+				held[heldSnap] = hold.HoldUntil
+			}
+		}
+		if len(holdingSnaps) == 0 || !installed(heldSnap) {
+			delete(holds, heldSnap)
+			delete(held, heldSnap)
+		}
+	}
+	setRefreshHolds(st, holds)
+	return held, nil
+}
+
+// AffectedSnapInfo describes how a snap with a gate-auto-refresh hook is
+// affected by a pending auto-refresh.
+type AffectedSnapInfo struct {
+	// Restart is set when the refresh requires a restart of the system.
+	Restart bool
+	// Base is set when the base of the snap is refreshed.
+	Base bool
+	// AffectingSnaps are the snaps being refreshed which affect the snap.
+	AffectingSnaps map[string]bool
+}
+
+func hasGateAutoRefreshHook(info *snap.Info) bool {
+	return info.Hooks["gate-auto-refresh"] != nil
+}
+
+// affectedByRefresh returns the snaps with a gate-auto-refresh hook which are
+// affected by the refresh of the given snaps: the snaps themselves, the snaps
+// using a refreshed base, the snaps consuming content of a refreshed snap and,
+// if the refresh implies a restart of the system, all of them.
+func affectedByRefresh(st *state.State, updates []string) (map[string]*AffectedSnapInfo, error) {
+	all, err := All(st)
+	if err != nil {
+		return nil, err
+	}
+
+	// the snaps with the hook
+	gating := make(map[string]*snap.Info)
+	for name, snapst := range all {
+		if !snapst.Active {
+			continue
+		}
+		info, err := snapst.CurrentInfo()
+		if err != nil {
+			return nil, err
+		}
+		if hasGateAutoRefreshHook(info) {
+			gating[name] = info
+		}
+	}
+	if len(gating) == 0 {
+		return nil, nil
+	}
+
+	affected := make(map[string]*AffectedSnapInfo)
+	addAffected := func(snapName, affectingSnap string, restart, base bool) {
+		if affected[snapName] == nil {
+			affected[snapName] = &AffectedSnapInfo{
+				AffectingSnaps: make(map[string]bool),
+			}
+		}
+		aff := affected[snapName]
+		aff.AffectingSnaps[affectingSnap] = true
+		aff.Restart = aff.Restart || restart
+		aff.Base = aff.Base || base
+	}
+
+	repo := ifacerepo.Get(st)
+	for _, name := range updates {
+		snapst := all[name]
+		if snapst == nil {
+			continue
+		}
+		if info := gating[name]; info != nil {
+			addAffected(name, name, false, false)
+		}
+
+		typ, err := snapst.Type()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case snap.TypeKernel, snap.TypeGadget, snap.TypeOS:
+			// the system is restarted, all snaps are affected
+			for gatingName := range gating {
+				addAffected(gatingName, name, true, false)
+			}
+			if typ != snap.TypeOS {
+				continue
+			}
+			fallthrough
+		case snap.TypeBase:
+			for gatingName, info := range gating {
+				base := info.Base
+				if base == "" && info.Type() == snap.TypeApp {
+					base = "core"
+				}
+				if base == name {
+					addAffected(gatingName, name, false, true)
+				}
+			}
+		}
+
+		// the consumers of content provided by the snap
+		conns, err := repo.Connections(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, cref := range conns {
+			if cref.SlotRef.Snap != name {
+				continue
+			}
+			slot := repo.Slot(cref.SlotRef.Snap, cref.SlotRef.Name)
+			if slot == nil || slot.Interface != "content" {
+				continue
+			}
+			if _, ok := gating[cref.PlugRef.Snap]; ok {
+				addAffected(cref.PlugRef.Snap, name, false, false)
+			}
+		}
+	}
+
+	return affected, nil
+}
+
+// SetupGateAutoRefreshHook is set by the hook manager to create a
+// gate-auto-refresh hook task for the given snap.
+var SetupGateAutoRefreshHook = func(st *state.State, snapName string, base, restart bool, affectingSnaps map[string]bool) *state.Task {
+	panic("internal error: snapstate.SetupGateAutoRefreshHook is unset")
+}
+
+// autoRefreshPhase1 queries the store for refresh candidates and, if there
+// are snaps with a gate-auto-refresh hook affected by them, creates the tasks
+// running the hooks followed by a conditional-auto-refresh task, which will
+// create the actual refresh tasks for the snaps which were not held. If no
+// snap is affected the refresh tasks are created right away.
+func autoRefreshPhase1(ctx context.Context, st *state.State) ([]string, []*state.TaskSet, error) {
+	hasGating, err := anyGateAutoRefreshHook(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasGating {
+		st.Set("refresh-candidates", nil)
+		return autoRefreshPhase2(ctx, st, nil, "")
+	}
+
+	refreshOpts := &store.RefreshOptions{IsAutoRefresh: true}
+	updates, _, _, err := refreshCandidates(ctx, st, nil, nil, refreshOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(updates) == 0 {
+		st.Set("refresh-candidates", nil)
+		return nil, nil, nil
+	}
+
+	names := make([]string, 0, len(updates))
+	candidates := make(map[string]*refreshCandidate, len(updates))
+	for _, up := range updates {
+		names = append(names, up.InstanceName())
+		candidates[up.InstanceName()] = &refreshCandidate{
+			Channel:  up.Channel,
+			Version:  up.Version,
+			Revision: up.Revision,
+		}
+	}
+	sort.Strings(names)
+	st.Set("refresh-candidates", candidates)
+
+	// the snaps held by the user stay pending, without asking the gating
+	// snaps about them
+	userHeld, err := userHeldSnaps(st)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(userHeld) > 0 {
+		notHeld := make([]string, 0, len(names))
+		for _, name := range names {
+			if _, ok := userHeld[name]; !ok {
+				notHeld = append(notHeld, name)
+			}
+		}
+		names = notHeld
+		if len(names) == 0 {
+			return nil, nil, nil
+		}
+	}
+
+	affected, err := affectedByRefresh(st, names)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(affected) == 0 {
+		// nobody to ask, refresh right away
+		return autoRefreshPhase2(ctx, st, names, "")
+	}
+
+	affectedNames := make([]string, 0, len(affected))
+	for name := range affected {
+		affectedNames = append(affectedNames, name)
+	}
+	sort.Strings(affectedNames)
+
+	ts := state.NewTaskSet()
+	var prev *state.Task
+	for _, name := range affectedNames {
+		aff := affected[name]
+		hookTask := SetupGateAutoRefreshHook(st, name, aff.Base, aff.Restart, aff.AffectingSnaps)
+		if prev != nil {
+			hookTask.WaitFor(prev)
+		}
+		ts.AddTask(hookTask)
+		prev = hookTask
+	}
+
+	conditional := st.NewTask("conditional-auto-refresh", i18n.G("Run auto-refresh for ready snaps"))
+	conditional.Set("snaps", names)
+	conditional.WaitAll(ts)
+	ts.AddTask(conditional)
+
+	return names, []*state.TaskSet{ts}, nil
+}
+
+// autoRefreshPhase2 creates the refresh tasks for the given snaps, or for
+// all the snaps with updates if names is nil. fromChange is the change the
+// tasks will be added to, if any.
+var autoRefreshPhase2 = func(ctx context.Context, st *state.State, names []string, fromChange string) ([]string, []*state.TaskSet, error) {
+	var filter updateFilter
+	if names != nil {
+		// keep the semantics of refreshing all snaps, e.g. snaps with
+		// conflicting changes are skipped rather than failing all
+		filter = func(update *snap.Info, _ *SnapState) bool {
+			return strutil.ListContains(names, update.InstanceName())
+		}
+	}
+	flags := &Flags{IsAutoRefresh: true}
+	return updateManyFiltered(ctx, st, nil, 0, filter, flags, fromChange)
+}
+
+// anyGateAutoRefreshHook returns whether any of the active snaps has a
+// gate-auto-refresh hook.
+func anyGateAutoRefreshHook(st *state.State) (bool, error) {
+	all, err := All(st)
+	if err != nil {
+		return false, err
+	}
+	for _, snapst := range all {
+		if !snapst.Active {
+			continue
+		}
+		info, err := snapst.CurrentInfo()
+		if err != nil {
+			return false, err
+		}
+		if hasGateAutoRefreshHook(info) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *SnapManager) doConditionalAutoRefresh(t *state.Task, tomb *tomb.Tomb) error {
+	st := t.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var snaps []string
+	if err := t.Get("snaps", &snaps); err != nil {
+		return err
+	}
+
+	held, err := HeldSnaps(st)
+	if err != nil {
+		return err
+	}
+
+	var toUpdate []string
+	var heldNames []string
+	for _, name := range snaps {
+		if _, ok := held[name]; ok {
+			heldNames = append(heldNames, name)
+			continue
+		}
+		toUpdate = append(toUpdate, name)
+	}
+	if len(heldNames) > 0 {
+		t.Logf("Auto-refresh of %s is held by other snaps.", strutil.Quoted(heldNames))
+	}
+
+	// only the held snaps remain pending
+	var candidates map[string]*refreshCandidate
+	if err := st.Get("refresh-candidates", &candidates); err != nil && err != state.ErrNoState {
+		return err
+	}
+	for _, name := range toUpdate {
+		delete(candidates, name)
+	}
+	if len(candidates) == 0 {
+		st.Set("refresh-candidates", nil)
+	} else {
+		st.Set("refresh-candidates", candidates)
+	}
+
+	if len(toUpdate) == 0 {
+		t.Logf("No snaps to auto-refresh.")
+		return nil
+	}
+
+	chg := t.Change()
+	updated, tasksets, err := autoRefreshPhase2(tomb.Context(nil), st, toUpdate, chg.ID())
+	if err != nil {
+		return err
+	}
+	if len(updated) == 0 {
+		t.Logf("No snaps to auto-refresh found.")
+		return nil
+	}
+
+	t.Logf("Created auto-refresh tasks for %s.", strutil.Quoted(updated))
+	for _, ts := range tasksets {
+		chg.AddAll(ts)
+	}
+	st.EnsureBefore(0)
+
+	return nil
+}
+
+// PendingRefreshInfo describes a pending auto-refresh of a snap, as seen by
+// the snap itself.
+type PendingRefreshInfo struct {
+	// Pending is "ready" if the snap will be refreshed on the next
+	// auto-refresh, "inhibited" if its refresh is held, or "none" if there
+	// is no refresh for the snap.
+	Pending  string
+	Channel  string
+	Version  string
+	Revision snap.Revision
+	// Base is set when the base of the snap has a pending refresh.
+	Base bool
+	// Restart is set when a pending refresh requires a restart of the
+	// system.
+	Restart bool
+}
+
+// PendingRefresh returns information about the pending auto-refresh
+// affecting the given snap.
+func PendingRefresh(st *state.State, snapName string) (*PendingRefreshInfo, error) {
+	var candidates map[string]*refreshCandidate
+	if err := st.Get("refresh-candidates", &candidates); err != nil && err != state.ErrNoState {
+		return nil, err
+	}
+
+	pending := &PendingRefreshInfo{Pending: "none"}
+	if cand := candidates[snapName]; cand != nil {
+		pending.Pending = "ready"
+		pending.Channel = cand.Channel
+		pending.Version = cand.Version
+		pending.Revision = cand.Revision
+
+		held, err := HeldSnaps(st)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := held[snapName]; ok {
+			pending.Pending = "inhibited"
+		}
+	}
+
+	if len(candidates) > 0 {
+		names := make([]string, 0, len(candidates))
+		for name := range candidates {
+			names = append(names, name)
+		}
+		affected, err := affectedByRefresh(st, names)
+		if err != nil {
+			return nil, err
+		}
+		if aff := affected[snapName]; aff != nil {
+			pending.Base = aff.Base
+			pending.Restart = aff.Restart
+		}
+	}
+
+	return pending, nil
+}
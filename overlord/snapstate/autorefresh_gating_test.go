@@ -0,0 +1,470 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	"context"
+	"time"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/interfaces"
+	"github.com/snapcore/snapd/interfaces/ifacetest"
+	"github.com/snapcore/snapd/overlord"
+	"github.com/snapcore/snapd/overlord/ifacestate/ifacerepo"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snaptest"
+	"github.com/snapcore/snapd/testutil"
+)
+
+type autoRefreshGatingSuite struct {
+	testutil.BaseTest
+	o     *overlord.Overlord
+	state *state.State
+	repo  *interfaces.Repository
+}
+
+var _ = Suite(&autoRefreshGatingSuite{})
+
+func (s *autoRefreshGatingSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	dirs.SetRootDir(c.MkDir())
+	s.AddCleanup(func() { dirs.SetRootDir("/") })
+
+	s.o = overlord.Mock()
+	s.state = s.o.State()
+
+	s.repo = interfaces.NewRepository()
+	c.Assert(s.repo.AddInterface(&ifacetest.TestInterface{InterfaceName: "content"}), IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	ifacerepo.Replace(s.state, s.repo)
+}
+
+const snapAyaml = `name: snap-a
+version: 1
+base: base-snap-a
+hooks:
+  gate-auto-refresh:
+`
+
+const snapByaml = `name: snap-b
+version: 1
+hooks:
+  gate-auto-refresh:
+plugs:
+  content:
+    interface: content
+`
+
+const snapCyaml = `name: snap-c
+version: 1
+slots:
+  content:
+    interface: content
+`
+
+const baseSnapAyaml = `name: base-snap-a
+type: base
+version: 1
+`
+
+const kernelYaml = `name: kernel
+type: kernel
+version: 1
+`
+
+func (s *autoRefreshGatingSuite) mockInstalledSnap(c *C, snapYaml string) *snap.Info {
+	info := snaptest.MockInfo(c, snapYaml, nil)
+	si := &snap.SideInfo{
+		RealName: info.SnapName(),
+		SnapID:   info.SnapName() + "-id",
+		Revision: snap.R(1),
+	}
+	info = snaptest.MockSnap(c, snapYaml, si)
+	snapstate.Set(s.state, info.InstanceName(), &snapstate.SnapState{
+		Active:   true,
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+		SnapType: string(info.Type()),
+	})
+	c.Assert(s.repo.AddSnap(info), IsNil)
+	return info
+}
+
+func (s *autoRefreshGatingSuite) TestHoldRefresh(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockInstalledSnap(c, snapAyaml)
+	s.mockInstalledSnap(c, baseSnapAyaml)
+	s.mockInstalledSnap(c, kernelYaml)
+
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(now)
+	defer restore()
+
+	c.Assert(snapstate.HoldRefresh(st, "snap-a", "base-snap-a", "kernel"), IsNil)
+
+	held, err := snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"base-snap-a": now.Add(7 * 24 * time.Hour),
+		"kernel":      now.Add(7 * 24 * time.Hour),
+	})
+
+	// renewing the hold extends it
+	later := now.Add(5 * 24 * time.Hour)
+	restore = snapstate.MockTimeNow(later)
+	defer restore()
+	c.Assert(snapstate.HoldRefresh(st, "snap-a", "kernel"), IsNil)
+
+	held, err = snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"base-snap-a": now.Add(7 * 24 * time.Hour),
+		"kernel":      later.Add(7 * 24 * time.Hour),
+	})
+
+	// expired holds are pruned
+	restore = snapstate.MockTimeNow(now.Add(8 * 24 * time.Hour))
+	defer restore()
+	held, err = snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"kernel": later.Add(7 * 24 * time.Hour),
+	})
+
+	c.Assert(snapstate.ProceedWithRefresh(st, "snap-a"), IsNil)
+	held, err = snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 0)
+}
+
+func (s *autoRefreshGatingSuite) TestHoldRefreshMaxPostponement(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockInstalledSnap(c, snapAyaml)
+	s.mockInstalledSnap(c, baseSnapAyaml)
+	s.mockInstalledSnap(c, kernelYaml)
+
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(now)
+	defer restore()
+	c.Assert(snapstate.HoldRefresh(st, "snap-a", "kernel"), IsNil)
+
+	// the hold is capped by the maximum postponement
+	restore = snapstate.MockTimeNow(now.Add(58 * 24 * time.Hour))
+	defer restore()
+	c.Assert(snapstate.HoldRefresh(st, "snap-a", "kernel"), IsNil)
+	held, err := snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"kernel": now.Add(60 * 24 * time.Hour),
+	})
+
+	// and cannot be renewed anymore after that, other snaps are still
+	// held though
+	restore = snapstate.MockTimeNow(now.Add(60 * 24 * time.Hour))
+	defer restore()
+	err = snapstate.HoldRefresh(st, "snap-a", "kernel", "base-snap-a")
+	c.Assert(err, ErrorMatches, `cannot hold some snaps:
+ - kernel \(maximum postponement of 60 days reached\)`)
+	c.Check(err, FitsTypeOf, &snapstate.HoldError{})
+
+	held, err = snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"base-snap-a": now.Add(67 * 24 * time.Hour),
+	})
+}
+
+func (s *autoRefreshGatingSuite) TestHeldSnapsPrunesRemovedSnaps(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockInstalledSnap(c, snapAyaml)
+	s.mockInstalledSnap(c, kernelYaml)
+
+	c.Assert(snapstate.HoldRefresh(st, "snap-a", "kernel"), IsNil)
+	snapstate.Set(st, "snap-a", nil)
+
+	held, err := snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 0)
+
+	var holds map[string]interface{}
+	c.Check(st.Get("snaps-hold", &holds), Equals, state.ErrNoState)
+}
+
+func (s *autoRefreshGatingSuite) TestHoldRefreshesByUser(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockInstalledSnap(c, snapAyaml)
+	s.mockInstalledSnap(c, baseSnapAyaml)
+	s.mockInstalledSnap(c, kernelYaml)
+
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(now)
+	defer restore()
+
+	c.Assert(snapstate.HoldRefreshesByUser(st, 48*time.Hour, []string{"kernel"}), IsNil)
+	c.Assert(snapstate.HoldRefreshesByUser(st, snapstate.HoldForever, []string{"base-snap-a"}), IsNil)
+	c.Assert(snapstate.HoldRefresh(st, "snap-a", "kernel"), IsNil)
+
+	held, err := snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"base-snap-a": now.Add(snapstate.HoldForever),
+		"kernel":      now.Add(7 * 24 * time.Hour),
+	})
+
+	// the holds of the user remain after the gating snap is gone
+	snapstate.Set(st, "snap-a", nil)
+	held, err = snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"base-snap-a": now.Add(snapstate.HoldForever),
+		"kernel":      now.Add(48 * time.Hour),
+	})
+
+	// but expire like the others
+	restore = snapstate.MockTimeNow(now.Add(72 * time.Hour))
+	defer restore()
+	held, err = snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"base-snap-a": now.Add(snapstate.HoldForever),
+	})
+
+	c.Assert(snapstate.UnholdRefreshesByUser(st, []string{"base-snap-a"}), IsNil)
+	held, err = snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 0)
+}
+
+func (s *autoRefreshGatingSuite) TestUnholdRefreshesByUserAll(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockInstalledSnap(c, snapAyaml)
+	s.mockInstalledSnap(c, baseSnapAyaml)
+	s.mockInstalledSnap(c, kernelYaml)
+
+	now := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(now)
+	defer restore()
+
+	c.Assert(snapstate.HoldRefreshesByUser(st, time.Hour, []string{"kernel", "base-snap-a"}), IsNil)
+	c.Assert(snapstate.HoldRefresh(st, "snap-a", "kernel"), IsNil)
+
+	// the holds of the gating snaps are kept
+	c.Assert(snapstate.UnholdRefreshesByUser(st, nil), IsNil)
+	held, err := snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, DeepEquals, map[string]time.Time{
+		"kernel": now.Add(7 * 24 * time.Hour),
+	})
+}
+
+func (s *autoRefreshGatingSuite) TestHoldRefreshesByUserErrors(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockInstalledSnap(c, kernelYaml)
+
+	err := snapstate.HoldRefreshesByUser(st, time.Hour, nil)
+	c.Check(err, ErrorMatches, `no snaps to hold`)
+	err = snapstate.HoldRefreshesByUser(st, 0, []string{"kernel"})
+	c.Check(err, ErrorMatches, `invalid hold duration 0s`)
+	err = snapstate.HoldRefreshesByUser(st, 61*24*time.Hour, []string{"kernel"})
+	c.Check(err, ErrorMatches, `cannot hold refreshes for more than 60 days unless forever`)
+	err = snapstate.HoldRefreshesByUser(st, time.Hour, []string{"kernel", "snap-a"})
+	c.Check(err, ErrorMatches, `snap "snap-a" is not installed`)
+
+	held, err := snapstate.HeldSnaps(st)
+	c.Assert(err, IsNil)
+	c.Check(held, HasLen, 0)
+}
+
+func (s *autoRefreshGatingSuite) TestAffectedByRefresh(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	snapB := s.mockInstalledSnap(c, snapByaml)
+	snapC := s.mockInstalledSnap(c, snapCyaml)
+	s.mockInstalledSnap(c, snapAyaml)
+	s.mockInstalledSnap(c, baseSnapAyaml)
+	s.mockInstalledSnap(c, kernelYaml)
+
+	ref := interfaces.NewConnRef(snapB.Plugs["content"], snapC.Slots["content"])
+	_, err := s.repo.Connect(ref, nil, nil, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	// snap-a is affected by the refresh of itself and of its base, snap-b
+	// by the refresh of its content provider
+	affected, err := snapstate.AffectedByRefresh(st, []string{"base-snap-a", "snap-a", "snap-c"})
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, map[string]*snapstate.AffectedSnapInfo{
+		"snap-a": {
+			Base: true,
+			AffectingSnaps: map[string]bool{
+				"base-snap-a": true,
+				"snap-a":      true,
+			},
+		},
+		"snap-b": {
+			AffectingSnaps: map[string]bool{
+				"snap-c": true,
+			},
+		},
+	})
+
+	// the refresh of the kernel affects everybody
+	affected, err = snapstate.AffectedByRefresh(st, []string{"kernel"})
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, map[string]*snapstate.AffectedSnapInfo{
+		"snap-a": {
+			Restart:        true,
+			AffectingSnaps: map[string]bool{"kernel": true},
+		},
+		"snap-b": {
+			Restart:        true,
+			AffectingSnaps: map[string]bool{"kernel": true},
+		},
+	})
+
+	// snap-c has no hook and nobody consumes from snap-a
+	affected, err = snapstate.AffectedByRefresh(st, []string{"snap-b"})
+	c.Assert(err, IsNil)
+	c.Check(affected, DeepEquals, map[string]*snapstate.AffectedSnapInfo{
+		"snap-b": {
+			AffectingSnaps: map[string]bool{"snap-b": true},
+		},
+	})
+}
+
+func (s *autoRefreshGatingSuite) TestAutoRefreshPhase1NoGatingSnaps(c *C) {
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockInstalledSnap(c, snapCyaml)
+
+	var phase2Names []string
+	phase2Called := false
+	restore := snapstate.MockAutoRefreshPhase2(func(ctx context.Context, st *state.State, names []string, fromChange string) ([]string, []*state.TaskSet, error) {
+		phase2Called = true
+		phase2Names = names
+		c.Check(fromChange, Equals, "")
+		return []string{"snap-c"}, nil, nil
+	})
+	defer restore()
+
+	names, tss, err := snapstate.AutoRefreshPhase1(context.TODO(), st)
+	c.Assert(err, IsNil)
+	c.Check(names, DeepEquals, []string{"snap-c"})
+	c.Check(tss, HasLen, 0)
+	c.Check(phase2Called, Equals, true)
+	// all snaps with updates are refreshed
+	c.Check(phase2Names, IsNil)
+}
+
+func (s *autoRefreshGatingSuite) TestConditionalAutoRefresh(c *C) {
+	mgr, err := snapstate.Manager(s.state, s.o.TaskRunner())
+	c.Assert(err, IsNil)
+	s.o.AddManager(mgr)
+	s.o.TaskRunner().AddHandler("refresh-thing", func(*state.Task, *tomb.Tomb) error { return nil }, nil)
+	s.o.AddManager(s.o.TaskRunner())
+	c.Assert(s.o.StartUp(), IsNil)
+
+	st := s.state
+	st.Lock()
+	defer st.Unlock()
+
+	s.mockInstalledSnap(c, snapAyaml)
+	s.mockInstalledSnap(c, baseSnapAyaml)
+	s.mockInstalledSnap(c, kernelYaml)
+
+	st.Set("refresh-candidates", map[string]interface{}{
+		"base-snap-a": map[string]interface{}{"revision": "2"},
+		"kernel":      map[string]interface{}{"revision": "3", "version": "5.0"},
+	})
+	c.Assert(snapstate.HoldRefresh(st, "snap-a", "kernel"), IsNil)
+
+	var phase2Names []string
+	restore := snapstate.MockAutoRefreshPhase2(func(ctx context.Context, st *state.State, names []string, fromChange string) ([]string, []*state.TaskSet, error) {
+		phase2Names = names
+		c.Check(fromChange, Not(Equals), "")
+		ts := state.NewTaskSet(st.NewTask("refresh-thing", "..."))
+		return names, []*state.TaskSet{ts}, nil
+	})
+	defer restore()
+
+	chg := st.NewChange("auto-refresh", "...")
+	t := st.NewTask("conditional-auto-refresh", "...")
+	t.Set("snaps", []string{"base-snap-a", "kernel"})
+	chg.AddTask(t)
+
+	st.Unlock()
+	err = s.o.Settle(5 * time.Second)
+	st.Lock()
+	c.Assert(err, IsNil)
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+
+	// only the snap not held is refreshed
+	c.Check(phase2Names, DeepEquals, []string{"base-snap-a"})
+	c.Assert(chg.Tasks(), HasLen, 2)
+	c.Check(chg.Tasks()[1].Kind(), Equals, "refresh-thing")
+
+	// the held snap remains a candidate
+	pending, err := snapstate.PendingRefresh(st, "kernel")
+	c.Assert(err, IsNil)
+	c.Check(pending, DeepEquals, &snapstate.PendingRefreshInfo{
+		Pending:  "inhibited",
+		Version:  "5.0",
+		Revision: snap.R(3),
+	})
+	pending, err = snapstate.PendingRefresh(st, "base-snap-a")
+	c.Assert(err, IsNil)
+	c.Check(pending.Pending, Equals, "none")
+
+	// the refresh of the kernel affects snap-a
+	pending, err = snapstate.PendingRefresh(st, "snap-a")
+	c.Assert(err, IsNil)
+	c.Check(pending, DeepEquals, &snapstate.PendingRefreshInfo{
+		Pending: "none",
+		Restart: true,
+	})
+}
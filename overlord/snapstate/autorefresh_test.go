@@ -978,3 +978,162 @@ func (s *autoRefreshTestSuite) TestInhibitRefreshRefreshesWhenOverdue(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(notificationCount, Equals, 1)
 }
+
+func (s *autoRefreshTestSuite) TestInhibitRefreshNotifiesRunningUsers(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	var seenPids []int
+	restore := snapstate.MockCgroupUserOfPid(func(pid int) (int, error) {
+		seenPids = append(seenPids, pid)
+		switch pid {
+		case 123, 124:
+			return 1000, nil
+		case 125:
+			return 1001, nil
+		case 127:
+			return 999, nil
+		}
+		return -1, fmt.Errorf("cannot find the user of pid %v", pid)
+	})
+	defer restore()
+
+	notificationCount := 0
+	restore = snapstate.MockAsyncPendingRefreshNotification(func(ctx context.Context, client *userclient.Client, refreshInfo *userclient.PendingSnapRefreshInfo) {
+		notificationCount++
+		c.Check(client, NotNil)
+		c.Check(refreshInfo.InstanceName, Equals, "pkg")
+	})
+	defer restore()
+
+	si := &snap.SideInfo{RealName: "pkg", Revision: snap.R(1)}
+	info := &snap.Info{SideInfo: *si}
+	snapst := &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	}
+	err := snapstate.InhibitRefresh(s.state, snapst, info, func(si *snap.Info) error {
+		return snapstate.NewBusySnapError(si, []int{123, 124, 125, 126}, []string{"app"}, nil)
+	})
+	c.Assert(err, ErrorMatches, `snap "pkg" has running apps \(app\)`)
+	c.Check(notificationCount, Equals, 1)
+	c.Check(seenPids, DeepEquals, []int{123, 124, 125, 126})
+	c.Check(snapstate.UsersOfPids([]int{125, 123, 124, 126}), DeepEquals, []int{1000, 1001})
+
+	// the notified users are remembered for the finish notification
+	var snapst2 snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "pkg", &snapst2), IsNil)
+	c.Check(snapst2.RefreshInhibitedUids, DeepEquals, []int{1000, 1001})
+
+	// and more are added as they are notified
+	err = snapstate.InhibitRefresh(s.state, snapst, info, func(si *snap.Info) error {
+		return snapstate.NewBusySnapError(si, []int{127}, []string{"app"}, nil)
+	})
+	c.Assert(err, ErrorMatches, `snap "pkg" has running apps \(app\)`)
+	c.Check(notificationCount, Equals, 2)
+	c.Assert(snapstate.Get(s.state, "pkg", &snapst2), IsNil)
+	c.Check(snapst2.RefreshInhibitedUids, DeepEquals, []int{999, 1000, 1001})
+}
+
+func (s *autoRefreshTestSuite) TestInhibitRefreshPostponedSkipsNotification(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	notificationCount := 0
+	restore := snapstate.MockAsyncPendingRefreshNotification(func(ctx context.Context, client *userclient.Client, refreshInfo *userclient.PendingSnapRefreshInfo) {
+		notificationCount++
+	})
+	defer restore()
+
+	pastInstant := time.Now().Add(-time.Hour)
+	postponed := time.Now().Add(time.Hour)
+
+	si := &snap.SideInfo{RealName: "pkg", Revision: snap.R(1)}
+	info := &snap.Info{SideInfo: *si}
+	snapst := &snapstate.SnapState{
+		Sequence:              []*snap.SideInfo{si},
+		Current:               si.Revision,
+		RefreshInhibitedTime:  &pastInstant,
+		RefreshPostponedUntil: &postponed,
+	}
+	err := snapstate.InhibitRefresh(s.state, snapst, info, func(si *snap.Info) error {
+		return &snapstate.BusySnapError{SnapInfo: si}
+	})
+	c.Assert(err, ErrorMatches, `snap "pkg" has running apps or hooks`)
+	c.Check(notificationCount, Equals, 0)
+
+	// once the postponement is over the users are told again
+	expired := time.Now().Add(-time.Minute)
+	snapst.RefreshPostponedUntil = &expired
+	err = snapstate.InhibitRefresh(s.state, snapst, info, func(si *snap.Info) error {
+		return &snapstate.BusySnapError{SnapInfo: si}
+	})
+	c.Assert(err, ErrorMatches, `snap "pkg" has running apps or hooks`)
+	c.Check(notificationCount, Equals, 1)
+}
+
+func (s *autoRefreshTestSuite) TestPostponeRefresh(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(now)
+	defer restore()
+
+	inhibited := now.Add(-time.Hour)
+	si := &snap.SideInfo{RealName: "pkg", Revision: snap.R(1)}
+	snapstate.Set(s.state, "pkg", &snapstate.SnapState{
+		Sequence:             []*snap.SideInfo{si},
+		Current:              si.Revision,
+		RefreshInhibitedTime: &inhibited,
+	})
+
+	c.Assert(snapstate.PostponeRefresh(s.state, "pkg"), IsNil)
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "pkg", &snapst), IsNil)
+	c.Assert(snapst.RefreshPostponedUntil, NotNil)
+	c.Check(snapst.RefreshPostponedUntil.Equal(now.Add(24*time.Hour)), Equals, true)
+}
+
+func (s *autoRefreshTestSuite) TestPostponeRefreshWithinInhibitWindow(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	restore := snapstate.MockTimeNow(now)
+	defer restore()
+
+	// the inhibition window ends in an hour
+	inhibited := now.Add(-snapstate.MaxInhibition + time.Hour)
+	si := &snap.SideInfo{RealName: "pkg", Revision: snap.R(1)}
+	snapstate.Set(s.state, "pkg", &snapstate.SnapState{
+		Sequence:             []*snap.SideInfo{si},
+		Current:              si.Revision,
+		RefreshInhibitedTime: &inhibited,
+	})
+
+	c.Assert(snapstate.PostponeRefresh(s.state, "pkg"), IsNil)
+
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "pkg", &snapst), IsNil)
+	c.Assert(snapst.RefreshPostponedUntil, NotNil)
+	c.Check(snapst.RefreshPostponedUntil.Equal(now.Add(time.Hour)), Equals, true)
+}
+
+func (s *autoRefreshTestSuite) TestPostponeRefreshNotPending(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	si := &snap.SideInfo{RealName: "pkg", Revision: snap.R(1)}
+	snapstate.Set(s.state, "pkg", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+
+	err := snapstate.PostponeRefresh(s.state, "pkg")
+	c.Check(err, ErrorMatches, `no pending refresh of snap "pkg"`)
+
+	err = snapstate.PostponeRefresh(s.state, "unknown")
+	c.Check(err, Equals, state.ErrNoState)
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/timings"
 	"github.com/snapcore/snapd/wrappers"
 )
@@ -44,6 +45,10 @@ type LinkContext struct {
 	// protected from the OOM killer
 	VitalityRank int
 
+	// QuotaGroup is the quota group the snap is a member of, its services
+	// are placed in the systemd slice of the group
+	QuotaGroup *quota.Group
+
 	// RunInhibitHint is used only in Unlink snap, and can be used to
 	// establish run inhibition lock for refresh operations.
 	RunInhibitHint runinhibit.Hint
@@ -192,6 +197,7 @@ func (b Backend) generateWrappers(s *snap.Info, linkCtx LinkContext) error {
 	opts := &wrappers.AddSnapServicesOptions{
 		Preseeding:   b.preseed,
 		VitalityRank: linkCtx.VitalityRank,
+		QuotaGroup:   linkCtx.QuotaGroup,
 	}
 	if err = wrappers.AddSnapServices(s, opts, progress.Null); err != nil {
 		return err
@@ -336,6 +336,9 @@ func (f *fakeStore) lookupRefresh(cand refreshCand) (*snap.Info, error) {
 		name = "services-snap"
 	case "some-snap-id":
 		name = "some-snap"
+	case "mysnapididididididididididididid":
+		// a snap-id valid for assertions
+		name = "my-snap"
 	case "some-other-snap-id":
 		name = "some-other-snap"
 	case "some-epoch-snap-id":
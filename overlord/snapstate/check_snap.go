@@ -29,6 +29,7 @@ import (
 	"github.com/snapcore/snapd/asserts"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/squashfs"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/release"
@@ -346,6 +347,27 @@ func validateContainer(c snap.Container, s *snap.Info, logf func(format string,
 	return fmt.Errorf("%v; contact developer", err)
 }
 
+var squashfsCheckCompressionSupported = squashfs.CheckCompressionSupported
+
+// checkCompression ensures that the running kernel can mount the snap,
+// for containers that know how they are compressed.
+func checkCompression(c snap.Container, s *snap.Info) error {
+	compressed, ok := c.(interface {
+		Compression() (string, error)
+	})
+	if !ok {
+		return nil
+	}
+	compression, err := compressed.Compression()
+	if err != nil {
+		return err
+	}
+	if err := squashfsCheckCompressionSupported(compression); err != nil {
+		return fmt.Errorf("cannot install snap %q: %v", s.InstanceName(), err)
+	}
+	return nil
+}
+
 // checkSnap ensures that the snap can be installed.
 func checkSnap(st *state.State, snapFilePath, instanceName string, si *snap.SideInfo, curInfo *snap.Info, flags Flags, deviceCtx DeviceContext) error {
 	// This assumes that the snap was already verified or --dangerous was used.
@@ -363,6 +385,14 @@ func checkSnap(st *state.State, snapFilePath, instanceName string, si *snap.Side
 		return err
 	}
 
+	if _, err := snap.ReadSnapshotYamlFromSnapFile(c); err != nil {
+		return err
+	}
+
+	if err := checkCompression(c, s); err != nil {
+		return err
+	}
+
 	snapName, instanceKey := snap.SplitInstanceName(instanceName)
 	// update instance key to what was requested
 	s.InstanceKey = instanceKey
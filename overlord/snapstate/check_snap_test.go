@@ -93,6 +93,71 @@ architectures:
 	c.Assert(err.Error(), Equals, errorMsg)
 }
 
+type compressedContainer struct {
+	snap.Container
+	compression string
+}
+
+func (cc *compressedContainer) Compression() (string, error) {
+	return cc.compression, nil
+}
+
+func (s *checkSnapSuite) TestCheckSnapErrorOnUnsupportedCompression(c *C) {
+	info, err := snap.InfoFromSnapYaml([]byte("name: hello\nversion: 1.0\n"))
+	c.Assert(err, IsNil)
+
+	var openSnapFile = func(path string, si *snap.SideInfo) (*snap.Info, snap.Container, error) {
+		return info, &compressedContainer{emptyContainer(c), "zstd"}, nil
+	}
+	restore := snapstate.MockOpenSnapFile(openSnapFile)
+	defer restore()
+
+	var checked []string
+	restore = snapstate.MockSquashfsCheckCompressionSupported(func(compression string) error {
+		checked = append(checked, compression)
+		return fmt.Errorf("zstd compressed squashfs filesystems are not supported by the running kernel")
+	})
+	defer restore()
+
+	err = snapstate.CheckSnap(s.st, "snap-path", "hello", nil, nil, snapstate.Flags{}, nil)
+	c.Check(err, ErrorMatches, `cannot install snap "hello": zstd compressed squashfs filesystems are not supported by the running kernel`)
+	c.Check(checked, DeepEquals, []string{"zstd"})
+}
+
+func (s *checkSnapSuite) TestCheckSnapErrorOnInvalidSnapshotYaml(c *C) {
+	info, err := snap.InfoFromSnapYaml([]byte("name: hello\nversion: 1.0\n"))
+	c.Assert(err, IsNil)
+
+	var openSnapFile = func(path string, si *snap.SideInfo) (*snap.Info, snap.Container, error) {
+		return info, snaptest.MockContainer(c, [][]string{{"meta/snapshots.yaml", "exclude: [$SNAP_DATA/../../etc]\n"}}), nil
+	}
+	restore := snapstate.MockOpenSnapFile(openSnapFile)
+	defer restore()
+
+	err = snapstate.CheckSnap(s.st, "snap-path", "hello", nil, nil, snapstate.Flags{}, nil)
+	c.Check(err, ErrorMatches, `invalid meta/snapshots.yaml: snapshot exclude path must be clean: "\$SNAP_DATA/../../etc"`)
+}
+
+func (s *checkSnapSuite) TestCheckSnapSupportedCompression(c *C) {
+	info, err := snap.InfoFromSnapYaml([]byte("name: hello\nversion: 1.0\n"))
+	c.Assert(err, IsNil)
+
+	var openSnapFile = func(path string, si *snap.SideInfo) (*snap.Info, snap.Container, error) {
+		return info, &compressedContainer{emptyContainer(c), "lz4"}, nil
+	}
+	restore := snapstate.MockOpenSnapFile(openSnapFile)
+	defer restore()
+
+	restore = snapstate.MockSquashfsCheckCompressionSupported(func(compression string) error {
+		c.Check(compression, Equals, "lz4")
+		return nil
+	})
+	defer restore()
+
+	err = snapstate.CheckSnap(s.st, "snap-path", "hello", nil, nil, snapstate.Flags{}, nil)
+	c.Check(err, IsNil)
+}
+
 var assumesTests = []struct {
 	version string
 	assumes string
@@ -136,6 +136,11 @@ func CheckChangeConflictMany(st *state.State, instanceNames []string, ignoreChan
 			// conflicts
 			continue
 		}
+		if chg.Kind() == "pre-download" {
+			// pre-downloads only fill the download cache and
+			// do not touch the installed snap
+			continue
+		}
 
 		snaps, err := affectedSnaps(task)
 		if err != nil {
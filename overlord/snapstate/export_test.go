@@ -62,6 +62,12 @@ func MockOpenSnapFile(mock func(path string, si *snap.SideInfo) (*snap.Info, sna
 	return func() { openSnapFile = prevOpenSnapFile }
 }
 
+func MockSquashfsCheckCompressionSupported(mock func(compression string) error) (restore func()) {
+	prev := squashfsCheckCompressionSupported
+	squashfsCheckCompressionSupported = mock
+	return func() { squashfsCheckCompressionSupported = prev }
+}
+
 func MockErrtrackerReport(mock func(string, string, string, map[string]string) (string, error)) (restore func()) {
 	prev := errtrackerReport
 	errtrackerReport = mock
@@ -282,6 +288,7 @@ var (
 var (
 	InhibitRefresh = inhibitRefresh
 	MaxInhibition  = maxInhibition
+	UsersOfPids    = usersOfPids
 )
 
 func NewBusySnapError(info *snap.Info, pids []int, busyAppNames, busyHookNames []string) *BusySnapError {
@@ -302,3 +309,76 @@ func MockGenericRefreshCheck(fn func(info *snap.Info, canAppRunDuringRefresh fun
 func (m *autoRefresh) EnsureRefreshHoldAtLeast(d time.Duration) error {
 	return m.ensureRefreshHoldAtLeast(d)
 }
+
+// auto-refresh gating
+var (
+	AffectedByRefresh = affectedByRefresh
+	AutoRefreshPhase1 = autoRefreshPhase1
+)
+
+func MockTimeNow(t time.Time) (restore func()) {
+	old := timeNow
+	timeNow = func() time.Time { return t }
+	return func() {
+		timeNow = old
+	}
+}
+
+func MockAutoRefreshPhase2(f func(context.Context, *state.State, []string, string) ([]string, []*state.TaskSet, error)) (restore func()) {
+	old := autoRefreshPhase2
+	autoRefreshPhase2 = f
+	return func() {
+		autoRefreshPhase2 = old
+	}
+}
+
+func MockAsyncFinishRefreshNotification(fn func(context.Context, *userclient.Client, *userclient.FinishedSnapRefreshInfo)) (restore func()) {
+	old := asyncFinishRefreshNotification
+	asyncFinishRefreshNotification = fn
+	return func() {
+		asyncFinishRefreshNotification = old
+	}
+}
+
+func MockCgroupUserOfPid(fn func(pid int) (int, error)) (restore func()) {
+	old := cgroupUserOfPid
+	cgroupUserOfPid = fn
+	return func() {
+		cgroupUserOfPid = old
+	}
+}
+
+var NewIntegrityCheck = newIntegrityCheck
+
+func IntegrityCheckWait(ic *integrityCheck) {
+	ic.wait()
+}
+
+func IntegrityCheckStop(ic *integrityCheck) {
+	ic.stop()
+}
+
+func IntegrityCheckInProgress(ic *integrityCheck) bool {
+	return ic.runningCheck() != nil
+}
+
+func IntegrityCheckStopping(ic *integrityCheck) bool {
+	tmb := ic.runningCheck()
+	return tmb != nil && !tmb.Alive()
+}
+
+func MockSnapFileSHA3_384(f func(path string) (string, uint64, error)) (restore func()) {
+	old := snapFileSHA3_384
+	snapFileSHA3_384 = f
+	return func() {
+		snapFileSHA3_384 = old
+	}
+}
+
+func MockOsutilBootID(f func() (string, error)) (restore func()) {
+	old := osutilBootID
+	osutilBootID = f
+	return func() {
+		osutilBootID = old
+	}
+}
@@ -47,11 +47,19 @@ import (
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/timings"
+	userclient "github.com/snapcore/snapd/usersession/client"
 )
 
+// taskLogger returns a logger for a task of the snap manager, attaching the
+// name of the snap the task is about to messages, along with the task IDs.
+func taskLogger(t *state.Task, snapName string) *logger.ContextLogger {
+	return t.Logger().With("manager", "snap").With("snap", snapName)
+}
+
 // TaskSnapSetup returns the SnapSetup with task params hold by or referred to by the task.
 func TaskSnapSetup(t *state.Task) (*SnapSetup, error) {
 	var snapsup SnapSetup
@@ -493,9 +501,9 @@ func (m *SnapManager) undoPrepareSnap(t *state.Task, _ *tomb.Tomb) error {
 		oopsid, err := errtrackerReport(snapsup.SideInfo.RealName, strings.Join(logMsg, "\n"), strings.Join(dupSig, "\n"), extra)
 		st.Lock()
 		if err == nil {
-			logger.Noticef("Reported install problem for %q as %s", snapsup.SideInfo.RealName, oopsid)
+			taskLogger(t, snapsup.InstanceName()).Noticef("Reported install problem for %q as %s", snapsup.SideInfo.RealName, oopsid)
 		} else {
-			logger.Debugf("Cannot report problem: %s", err)
+			taskLogger(t, snapsup.InstanceName()).Debugf("Cannot report problem: %s", err)
 		}
 	}
 
@@ -604,6 +612,48 @@ func (m *SnapManager) doDownloadSnap(t *state.Task, tomb *tomb.Tomb) error {
 	return nil
 }
 
+// doPreDownloadSnap fetches the revision of a snap whose refresh is
+// inhibited by running apps into the download cache, so that once the
+// refresh can go ahead only linking is left to do.
+func (m *SnapManager) doPreDownloadSnap(t *state.Task, tomb *tomb.Tomb) error {
+	st := t.State()
+
+	st.Lock()
+	snapsup, theStore, user, err := downloadSnapParams(st, t)
+	var rate int64
+	if err == nil {
+		// NOTE rate is never negative
+		rate = autoRefreshRateLimited(st)
+	}
+	st.Unlock()
+	if err != nil {
+		return err
+	}
+	if snapsup.DownloadInfo == nil {
+		return fmt.Errorf("internal error: cannot pre-download snap %q without download information", snapsup.InstanceName())
+	}
+
+	meter := NewTaskProgressAdapterUnlocked(t)
+	// the store keeps a copy of the download in its cache, the
+	// downloaded file itself is not needed
+	targetFn := snapsup.MountFile() + ".pre-download"
+	dlOpts := &store.DownloadOptions{
+		IsAutoRefresh: true,
+		RateLimit:     rate,
+	}
+	if err := theStore.Download(tomb.Context(nil), snapsup.SnapName(), targetFn, snapsup.DownloadInfo, meter, user, dlOpts); err != nil {
+		return err
+	}
+	if err := os.Remove(targetFn); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	t.Logf("Downloaded snap %q (%s) ahead of its refresh", snapsup.InstanceName(), snapsup.Revision())
+	return nil
+}
+
 var (
 	mountPollInterval = 1 * time.Second
 )
@@ -702,7 +752,7 @@ func (m *SnapManager) doMountSnap(t *state.Task, _ *tomb.Tomb) error {
 		msg := fmt.Sprintf("expected snap %q revision %v to be mounted but is not", snapsup.InstanceName(), snapsup.Revision())
 		readInfoErr = fmt.Errorf("cannot proceed, %s", msg)
 		if i == 0 {
-			logger.Noticef(msg)
+			taskLogger(t, snapsup.InstanceName()).Noticef("%s", msg)
 		}
 		time.Sleep(mountPollInterval)
 	}
@@ -730,7 +780,7 @@ func (m *SnapManager) doMountSnap(t *state.Task, _ *tomb.Tomb) error {
 
 	if snapsup.Flags.RemoveSnapPath {
 		if err := os.Remove(snapsup.SnapPath); err != nil {
-			logger.Noticef("Failed to cleanup %s: %s", snapsup.SnapPath, err)
+			taskLogger(t, snapsup.InstanceName()).Noticef("Failed to cleanup %s: %s", snapsup.SnapPath, err)
 		}
 	}
 
@@ -884,9 +934,14 @@ func (m *SnapManager) undoUnlinkCurrentSnap(t *state.Task, _ *tomb.Tomb) error {
 	if err != nil {
 		return err
 	}
+	quotaGrp, err := quotaGroup(st, snapsup.InstanceName())
+	if err != nil {
+		return err
+	}
 	linkCtx := backend.LinkContext{
 		FirstInstall: false,
 		VitalityRank: vitalityRank,
+		QuotaGroup:   quotaGrp,
 	}
 	reboot, err := m.backend.LinkSnap(oldInfo, deviceCtx, linkCtx, perfTimings)
 	if err != nil {
@@ -1087,6 +1142,14 @@ func vitalityRank(st *state.State, instanceName string) (rank int, err error) {
 	return 0, nil
 }
 
+// quotaGroup returns the quota group the given snap is a member of, if any.
+func quotaGroup(st *state.State, instanceName string) (*quota.Group, error) {
+	if QuotaGroupForSnap == nil {
+		return nil, nil
+	}
+	return QuotaGroupForSnap(st, instanceName)
+}
+
 // LinkSnapParticipant is an interface for interacting with snap link/unlink
 // operations.
 //
@@ -1188,6 +1251,8 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 		snapst.Required = true
 	}
 	oldRefreshInhibitedTime := snapst.RefreshInhibitedTime
+	oldRefreshPostponedUntil := snapst.RefreshPostponedUntil
+	oldRefreshInhibitedUids := snapst.RefreshInhibitedUids
 	// only set userID if unset or logged out in snapst and if we
 	// actually have an associated user
 	if snapsup.UserID > 0 {
@@ -1228,9 +1293,14 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 	if err != nil {
 		return err
 	}
+	quotaGrp, err := quotaGroup(st, snapsup.InstanceName())
+	if err != nil {
+		return err
+	}
 	linkCtx := backend.LinkContext{
 		FirstInstall: oldCurrent.Unset(),
 		VitalityRank: vitalityRank,
+		QuotaGroup:   quotaGrp,
 	}
 	reboot, err := m.backend.LinkSnap(newInfo, deviceCtx, linkCtx, perfTimings)
 	// defer a cleanup helper which will unlink the snap if anything fails after
@@ -1283,10 +1353,14 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 	t.Set("old-current", oldCurrent)
 	t.Set("old-candidate-index", oldCandidateIndex)
 	t.Set("old-refresh-inhibited-time", oldRefreshInhibitedTime)
+	t.Set("old-refresh-postponed-until", oldRefreshPostponedUntil)
+	t.Set("old-refresh-inhibited-uids", oldRefreshInhibitedUids)
 	t.Set("old-cohort-key", oldCohortKey)
 
 	// Record the fact that the snap was refreshed successfully.
 	snapst.RefreshInhibitedTime = nil
+	snapst.RefreshPostponedUntil = nil
+	snapst.RefreshInhibitedUids = nil
 
 	if cand.SnapID != "" {
 		// write the auxiliary store info
@@ -1344,6 +1418,13 @@ func (m *SnapManager) doLinkSnap(t *state.Task, _ *tomb.Tomb) (err error) {
 	// Notify link snap participants about link changes.
 	notifyLinkParticipants(t, snapsup.InstanceName())
 
+	// Let the users that were told about the inhibited refresh know that
+	// it went ahead.
+	if len(oldRefreshInhibitedUids) > 0 {
+		refreshInfo := &userclient.FinishedSnapRefreshInfo{InstanceName: snapsup.InstanceName()}
+		asyncFinishRefreshNotification(context.TODO(), userclient.NewForUids(oldRefreshInhibitedUids...), refreshInfo)
+	}
+
 	// Make sure if state commits and snapst is mutated we won't be rerun
 	t.SetStatus(state.DoneStatus)
 
@@ -1532,6 +1613,14 @@ func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	if err := t.Get("old-refresh-inhibited-time", &oldRefreshInhibitedTime); err != nil && err != state.ErrNoState {
 		return err
 	}
+	var oldRefreshPostponedUntil *time.Time
+	if err := t.Get("old-refresh-postponed-until", &oldRefreshPostponedUntil); err != nil && err != state.ErrNoState {
+		return err
+	}
+	var oldRefreshInhibitedUids []int
+	if err := t.Get("old-refresh-inhibited-uids", &oldRefreshInhibitedUids); err != nil && err != state.ErrNoState {
+		return err
+	}
 	var oldCohortKey string
 	if err := t.Get("old-cohort-key", &oldCohortKey); err != nil && err != state.ErrNoState {
 		return err
@@ -1579,6 +1668,8 @@ func (m *SnapManager) undoLinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	snapst.JailMode = oldJailMode
 	snapst.Classic = oldClassic
 	snapst.RefreshInhibitedTime = oldRefreshInhibitedTime
+	snapst.RefreshPostponedUntil = oldRefreshPostponedUntil
+	snapst.RefreshInhibitedUids = oldRefreshInhibitedUids
 	snapst.CohortKey = oldCohortKey
 
 	newInfo, err := readInfo(snapsup.InstanceName(), snapsup.SideInfo, 0)
@@ -1773,9 +1864,9 @@ func (m *SnapManager) startSnapServices(t *state.Task, _ *tomb.Tomb) error {
 	for _, svc := range snapst.LastActiveDisabledServices {
 		app, ok := currentInfo.Apps[svc]
 		if !ok {
-			logger.Noticef("previously disabled service %s no longer exists", svc)
+			taskLogger(t, snapsup.InstanceName()).Noticef("previously disabled service %s no longer exists", svc)
 		} else if !app.IsService() {
-			logger.Noticef("previously disabled service %s is now an app and not a service", svc)
+			taskLogger(t, snapsup.InstanceName()).Noticef("previously disabled service %s is now an app and not a service", svc)
 		}
 	}
 
@@ -2083,9 +2174,14 @@ func (m *SnapManager) undoUnlinkSnap(t *state.Task, _ *tomb.Tomb) error {
 	if err != nil {
 		return err
 	}
+	quotaGrp, err := quotaGroup(st, snapsup.InstanceName())
+	if err != nil {
+		return err
+	}
 	linkCtx := backend.LinkContext{
 		FirstInstall: false,
 		VitalityRank: vitalityRank,
+		QuotaGroup:   quotaGrp,
 	}
 	reboot, err := m.backend.LinkSnap(info, deviceCtx, linkCtx, perfTimings)
 	if err != nil {
@@ -2221,7 +2317,7 @@ func (m *SnapManager) doDiscardSnap(t *state.Task, _ *tomb.Tomb) error {
 
 		// try to remove the auxiliary store info
 		if err := discardAuxStoreInfo(snapsup.SideInfo.SnapID); err != nil {
-			logger.Noticef("Cannot remove auxiliary store info for %q: %v", snapsup.InstanceName(), err)
+			taskLogger(t, snapsup.InstanceName()).Noticef("Cannot remove auxiliary store info for %q: %v", snapsup.InstanceName(), err)
 		}
 
 		// XXX: also remove sequence files?
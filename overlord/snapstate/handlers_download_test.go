@@ -31,6 +31,7 @@ import (
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/testutil"
 )
 
 type downloadSnapSuite struct {
@@ -295,3 +296,72 @@ func (s *downloadSnapSuite) TestDoDownloadRateLimitedIntegration(c *C) {
 	})
 
 }
+
+func (s *downloadSnapSuite) TestDoPreDownloadSnap(c *C) {
+	s.state.Lock()
+
+	si := &snap.SideInfo{
+		RealName: "foo",
+		SnapID:   "mySnapID",
+		Revision: snap.R(11),
+		Channel:  "my-channel",
+	}
+
+	t := s.state.NewTask("pre-download-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		Channel:  "some-channel",
+		SideInfo: si,
+		DownloadInfo: &snap.DownloadInfo{
+			DownloadURL: "http://some-url.com/snap",
+		},
+	})
+	chg := s.state.NewChange("pre-download", "...")
+	chg.AddTask(t)
+
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Check(t.Status(), Equals, state.DoneStatus)
+
+	// the download happened as for an auto-refresh, next to the
+	// place of the actual download
+	c.Assert(s.fakeStore.downloads, DeepEquals, []fakeDownload{
+		{
+			name:   "foo",
+			target: filepath.Join(dirs.SnapBlobDir, "foo_11.snap.pre-download"),
+			opts:   &store.DownloadOptions{IsAutoRefresh: true},
+		},
+	})
+	c.Check(filepath.Join(dirs.SnapBlobDir, "foo_11.snap.pre-download"), testutil.FileAbsent)
+}
+
+func (s *downloadSnapSuite) TestDoPreDownloadSnapNoDownloadInfo(c *C) {
+	s.state.Lock()
+
+	t := s.state.NewTask("pre-download-snap", "test")
+	t.Set("snap-setup", &snapstate.SnapSetup{
+		SideInfo: &snap.SideInfo{
+			RealName: "foo",
+			Revision: snap.R(11),
+		},
+	})
+	chg := s.state.NewChange("pre-download", "...")
+	chg.AddTask(t)
+
+	s.state.Unlock()
+
+	s.se.Ensure()
+	s.se.Wait()
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(chg.Err(), ErrorMatches, `(?s).*internal error: cannot pre-download snap "foo" without download information.*`)
+	c.Check(s.fakeStore.downloads, HasLen, 0)
+}
@@ -20,6 +20,7 @@
 package snapstate_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -42,6 +43,7 @@ import (
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/testutil"
+	userclient "github.com/snapcore/snapd/usersession/client"
 )
 
 type linkSnapSuite struct {
@@ -1202,14 +1204,23 @@ func (s *linkSnapSuite) TestLinkSnapResetsRefreshInhibitedTime(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
 
+	var finished []string
+	restore := snapstate.MockAsyncFinishRefreshNotification(func(ctx context.Context, client *userclient.Client, refreshInfo *userclient.FinishedSnapRefreshInfo) {
+		finished = append(finished, refreshInfo.InstanceName)
+	})
+	defer restore()
+
 	instant := time.Now()
+	postponed := instant.Add(time.Hour)
 
 	si := &snap.SideInfo{RealName: "snap", Revision: snap.R(1)}
 	sup := &snapstate.SnapSetup{SideInfo: si}
 	snapstate.Set(s.state, "snap", &snapstate.SnapState{
-		Sequence:             []*snap.SideInfo{si},
-		Current:              si.Revision,
-		RefreshInhibitedTime: &instant,
+		Sequence:              []*snap.SideInfo{si},
+		Current:               si.Revision,
+		RefreshInhibitedTime:  &instant,
+		RefreshPostponedUntil: &postponed,
+		RefreshInhibitedUids:  []int{1000},
 	})
 
 	task := s.state.NewTask("link-snap", "")
@@ -1233,18 +1244,68 @@ func (s *linkSnapSuite) TestLinkSnapResetsRefreshInhibitedTime(c *C) {
 	err := snapstate.Get(s.state, "snap", &snapst)
 	c.Assert(err, IsNil)
 	c.Check(snapst.RefreshInhibitedTime, IsNil)
+	c.Check(snapst.RefreshPostponedUntil, IsNil)
+	c.Check(snapst.RefreshInhibitedUids, IsNil)
 
 	var oldTime time.Time
 	c.Assert(task.Get("old-refresh-inhibited-time", &oldTime), IsNil)
 	c.Check(oldTime.Equal(instant), Equals, true)
+	c.Assert(task.Get("old-refresh-postponed-until", &oldTime), IsNil)
+	c.Check(oldTime.Equal(postponed), Equals, true)
+	var oldUids []int
+	c.Assert(task.Get("old-refresh-inhibited-uids", &oldUids), IsNil)
+	c.Check(oldUids, DeepEquals, []int{1000})
+
+	// the users waiting for the refresh are told it happened
+	c.Check(finished, DeepEquals, []string{"snap"})
 }
 
-func (s *linkSnapSuite) TestDoUndoLinkSnapRestoresRefreshInhibitedTime(c *C) {
+func (s *linkSnapSuite) TestLinkSnapNoFinishNotificationWhenNotInhibited(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
 
-	instant := time.Now()
+	var finished []string
+	restore := snapstate.MockAsyncFinishRefreshNotification(func(ctx context.Context, client *userclient.Client, refreshInfo *userclient.FinishedSnapRefreshInfo) {
+		finished = append(finished, refreshInfo.InstanceName)
+	})
+	defer restore()
+
+	si := &snap.SideInfo{RealName: "snap", Revision: snap.R(1)}
+	sup := &snapstate.SnapSetup{SideInfo: si}
+	snapstate.Set(s.state, "snap", &snapstate.SnapState{
+		Sequence: []*snap.SideInfo{si},
+		Current:  si.Revision,
+	})
+
+	task := s.state.NewTask("link-snap", "")
+	task.Set("snap-setup", sup)
+	chg := s.state.NewChange("test", "")
+	chg.AddTask(task)
+
+	s.state.Unlock()
+	for i := 0; i < 10; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Check(finished, HasLen, 0)
+}
+
+func (s *linkSnapSuite) TestLinkSnapNoFinishNotificationWithoutNotifiedUsers(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
 
+	var finished []string
+	restore := snapstate.MockAsyncFinishRefreshNotification(func(ctx context.Context, client *userclient.Client, refreshInfo *userclient.FinishedSnapRefreshInfo) {
+		finished = append(finished, refreshInfo.InstanceName)
+	})
+	defer restore()
+
+	// the refresh was inhibited but the users running the snap were
+	// not known, nobody is waiting to hear about it
+	instant := time.Now()
 	si := &snap.SideInfo{RealName: "snap", Revision: snap.R(1)}
 	sup := &snapstate.SnapSetup{SideInfo: si}
 	snapstate.Set(s.state, "snap", &snapstate.SnapState{
@@ -1258,6 +1319,43 @@ func (s *linkSnapSuite) TestDoUndoLinkSnapRestoresRefreshInhibitedTime(c *C) {
 	chg := s.state.NewChange("test", "")
 	chg.AddTask(task)
 
+	s.state.Unlock()
+	for i := 0; i < 10; i++ {
+		s.se.Ensure()
+		s.se.Wait()
+	}
+	s.state.Lock()
+
+	c.Assert(chg.Err(), IsNil)
+	c.Check(finished, HasLen, 0)
+}
+
+func (s *linkSnapSuite) TestDoUndoLinkSnapRestoresRefreshInhibitedTime(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	restore := snapstate.MockAsyncFinishRefreshNotification(func(ctx context.Context, client *userclient.Client, refreshInfo *userclient.FinishedSnapRefreshInfo) {
+	})
+	defer restore()
+
+	instant := time.Now()
+	postponed := instant.Add(time.Hour)
+
+	si := &snap.SideInfo{RealName: "snap", Revision: snap.R(1)}
+	sup := &snapstate.SnapSetup{SideInfo: si}
+	snapstate.Set(s.state, "snap", &snapstate.SnapState{
+		Sequence:              []*snap.SideInfo{si},
+		Current:               si.Revision,
+		RefreshInhibitedTime:  &instant,
+		RefreshPostponedUntil: &postponed,
+		RefreshInhibitedUids:  []int{1000, 1001},
+	})
+
+	task := s.state.NewTask("link-snap", "")
+	task.Set("snap-setup", sup)
+	chg := s.state.NewChange("test", "")
+	chg.AddTask(task)
+
 	terr := s.state.NewTask("error-trigger", "provoking total undo")
 	terr.WaitFor(task)
 	chg.AddTask(terr)
@@ -1279,6 +1377,8 @@ func (s *linkSnapSuite) TestDoUndoLinkSnapRestoresRefreshInhibitedTime(c *C) {
 	err := snapstate.Get(s.state, "snap", &snapst)
 	c.Assert(err, IsNil)
 	c.Check(snapst.RefreshInhibitedTime.Equal(instant), Equals, true)
+	c.Check(snapst.RefreshPostponedUntil.Equal(postponed), Equals, true)
+	c.Check(snapst.RefreshInhibitedUids, DeepEquals, []int{1000, 1001})
 }
 
 func (s *linkSnapSuite) TestUndoLinkSnapdFirstInstall(c *C) {
@@ -0,0 +1,370 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// SnapRevisionAssertion allows to hook getting the snap-revision
+// assertion of a snap revision from the system assertion database.
+var SnapRevisionAssertion func(st *state.State, snapID string, revision snap.Revision) (*asserts.SnapRevision, error)
+
+var (
+	integrityCheckInterval = 24 * time.Hour
+
+	snapFileSHA3_384 = asserts.SnapFileSHA3_384
+	osutilBootID     = osutil.BootID
+)
+
+// ErrSnapNotAsserted is returned when verifying a snap revision that
+// has no snap-revision assertion, e.g. one installed with --dangerous.
+var ErrSnapNotAsserted = errors.New("snap has no snap-revision assertion")
+
+// SnapIntegrityError is returned when the file of an installed snap
+// revision does not match its snap-revision assertion.
+type SnapIntegrityError struct {
+	Snap     string
+	Revision snap.Revision
+	Path     string
+}
+
+func (e *SnapIntegrityError) Error() string {
+	return fmt.Sprintf("snap %q revision %s file %s does not match its snap-revision assertion", e.Snap, e.Revision, e.Path)
+}
+
+// SnapFileCheck checks the file of an installed snap revision against
+// its snap-revision assertion.
+type SnapFileCheck struct {
+	Info *snap.Info
+
+	// SHA3_384 and Size are the expected digest and size of the file.
+	SHA3_384 string
+	Size     uint64
+}
+
+// NewSnapFileCheck prepares checking the file of the current revision
+// of the given snap. It returns ErrSnapNotAsserted if the revision has
+// no snap-revision assertion. The state needs to be locked by the
+// caller, but not while running the check.
+func NewSnapFileCheck(st *state.State, instanceName string) (*SnapFileCheck, error) {
+	var snapst SnapState
+	if err := Get(st, instanceName, &snapst); err != nil {
+		return nil, err
+	}
+	info, err := snapst.CurrentInfo()
+	if err != nil {
+		return nil, err
+	}
+	return newSnapFileCheck(st, info)
+}
+
+func newSnapFileCheck(st *state.State, info *snap.Info) (*SnapFileCheck, error) {
+	if info.SnapID == "" || info.Revision.Local() || SnapRevisionAssertion == nil {
+		return nil, ErrSnapNotAsserted
+	}
+	snapRev, err := SnapRevisionAssertion(st, info.SnapID, info.Revision)
+	if asserts.IsNotFound(err) {
+		return nil, ErrSnapNotAsserted
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SnapFileCheck{
+		Info:     info,
+		SHA3_384: snapRev.SnapSHA3_384(),
+		Size:     snapRev.SnapSize(),
+	}, nil
+}
+
+// Run recomputes the digest of the snap file and compares it with the
+// expected one. It returns a *SnapIntegrityError on mismatch.
+func (c *SnapFileCheck) Run() error {
+	path := c.Info.MountFile()
+	digest, size, err := snapFileSHA3_384(path)
+	if err != nil {
+		return fmt.Errorf("cannot compute digest of snap %q revision %s: %v", c.Info.InstanceName(), c.Info.Revision, err)
+	}
+	if digest != c.SHA3_384 || size != c.Size {
+		return &SnapIntegrityError{
+			Snap:     c.Info.InstanceName(),
+			Revision: c.Info.Revision,
+			Path:     path,
+		}
+	}
+	return nil
+}
+
+// integrityCheck periodically checks the files of the installed snaps
+// against their snap-revision assertions. With the snap-integrity
+// option set to "enforce", non essential snaps whose files do not
+// match are disabled on boot.
+type integrityCheck struct {
+	state *state.State
+
+	// running is the check in progress in the background, if any,
+	// it is protected by runningMu rather than the state lock so that
+	// it can be stopped while the state is locked
+	runningMu sync.Mutex
+	running   *tomb.Tomb
+}
+
+func newIntegrityCheck(st *state.State) *integrityCheck {
+	return &integrityCheck{state: st}
+}
+
+func integrityCheckMode(st *state.State) (string, error) {
+	tr := config.NewTransaction(st)
+	var mode string
+	if err := tr.GetMaybe("core", "snap-integrity", &mode); err != nil {
+		return "", err
+	}
+	if mode == "" {
+		mode = "warn"
+	}
+	return mode, nil
+}
+
+// Ensure starts checking the snap files in the background once per boot
+// and then every integrityCheckInterval.
+func (ic *integrityCheck) Ensure() error {
+	st := ic.state
+	st.Lock()
+	defer st.Unlock()
+
+	// no way to check without assertions
+	if SnapRevisionAssertion == nil {
+		return nil
+	}
+	// computing the digests takes a while, wait for the check in
+	// progress to finish
+	if ic.runningCheck() != nil {
+		return nil
+	}
+
+	var seeded bool
+	err := st.Get("seeded", &seeded)
+	if err != nil && err != state.ErrNoState {
+		return err
+	}
+	if !seeded {
+		return nil
+	}
+
+	bootID, err := osutilBootID()
+	if err != nil {
+		return err
+	}
+	var lastBootID string
+	if err := st.Get("integrity-check-boot-id", &lastBootID); err != nil && err != state.ErrNoState {
+		return err
+	}
+	var lastCheck time.Time
+	if err := st.Get("last-integrity-check", &lastCheck); err != nil && err != state.ErrNoState {
+		return err
+	}
+
+	onBoot := bootID != lastBootID
+	now := timeNow()
+	if !onBoot && now.Before(lastCheck.Add(integrityCheckInterval)) {
+		return nil
+	}
+
+	mode, err := integrityCheckMode(st)
+	if err != nil {
+		return err
+	}
+	enforce := onBoot && mode == "enforce"
+
+	logger.Debugf("Checking the integrity of the snap files.")
+	checks := ic.snapChecks()
+	tmb := &tomb.Tomb{}
+	ic.setRunningCheck(tmb)
+	tmb.Go(func() error {
+		mismatches, completed := runSnapChecks(tmb, checks)
+		if !completed {
+			ic.setRunningCheck(nil)
+			// stopped, the check is done again on the next start
+			return nil
+		}
+
+		st.Lock()
+		defer st.Unlock()
+		ic.setRunningCheck(nil)
+		ic.handleMismatches(mismatches, enforce)
+		st.Set("integrity-check-boot-id", bootID)
+		st.Set("last-integrity-check", now)
+		return nil
+	})
+	return nil
+}
+
+func (ic *integrityCheck) runningCheck() *tomb.Tomb {
+	ic.runningMu.Lock()
+	defer ic.runningMu.Unlock()
+	return ic.running
+}
+
+func (ic *integrityCheck) setRunningCheck(tmb *tomb.Tomb) {
+	ic.runningMu.Lock()
+	defer ic.runningMu.Unlock()
+	ic.running = tmb
+}
+
+// stop stops the check in progress, if any, and waits for it to finish.
+func (ic *integrityCheck) stop() {
+	tmb := ic.runningCheck()
+	if tmb == nil {
+		return
+	}
+	tmb.Kill(nil)
+	tmb.Wait()
+}
+
+// wait waits for the check in progress, if any, to finish.
+func (ic *integrityCheck) wait() {
+	tmb := ic.runningCheck()
+	if tmb == nil {
+		return
+	}
+	tmb.Wait()
+}
+
+// snapChecks prepares the checks of the files of the current revisions of
+// the active snaps. The state needs to be locked by the caller.
+func (ic *integrityCheck) snapChecks() []*SnapFileCheck {
+	st := ic.state
+	snapStates, err := All(st)
+	if err != nil {
+		logger.Noticef("Cannot check the integrity of the snap files: %v", err)
+		return nil
+	}
+	names := make([]string, 0, len(snapStates))
+	for name := range snapStates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var checks []*SnapFileCheck
+	for _, name := range names {
+		snapst := snapStates[name]
+		if !snapst.Active {
+			continue
+		}
+		info, err := snapst.CurrentInfo()
+		if err != nil {
+			logger.Noticef("Cannot check the integrity of snap %q: %v", name, err)
+			continue
+		}
+		check, err := newSnapFileCheck(st, info)
+		if err == ErrSnapNotAsserted {
+			continue
+		}
+		if err != nil {
+			logger.Noticef("Cannot check the integrity of snap %q: %v", name, err)
+			continue
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// runSnapChecks runs the checks, without the state lock, until the tomb
+// is killed. It returns the snaps that do not match their snap-revision
+// assertions and whether all the checks were run.
+func runSnapChecks(tmb *tomb.Tomb, checks []*SnapFileCheck) (mismatches []*snap.Info, completed bool) {
+	for _, check := range checks {
+		select {
+		case <-tmb.Dying():
+			return nil, false
+		default:
+		}
+		err := check.Run()
+		if _, ok := err.(*SnapIntegrityError); ok {
+			mismatches = append(mismatches, check.Info)
+			continue
+		}
+		if err != nil {
+			logger.Noticef("Cannot check the integrity of snap %q: %v", check.Info.InstanceName(), err)
+		}
+	}
+	return mismatches, true
+}
+
+// handleMismatches warns about the snaps whose files do not match their
+// snap-revision assertions and, when enforcing, disables the non essential
+// ones so that they are not used until they are enabled or refreshed
+// again. The state needs to be locked by the caller.
+func (ic *integrityCheck) handleMismatches(mismatches []*snap.Info, enforce bool) {
+	st := ic.state
+	for _, info := range mismatches {
+		if enforce && !isEssentialSnapType(info.Type()) {
+			if err := ic.disableSnap(info); err != nil {
+				st.Warnf("snap %q revision %s does not match its snap-revision assertion and cannot be disabled: %v", info.InstanceName(), info.Revision, err)
+				continue
+			}
+			st.Warnf("snap %q revision %s does not match its snap-revision assertion and is being disabled, it may have been tampered with", info.InstanceName(), info.Revision)
+			continue
+		}
+		st.Warnf("snap %q revision %s does not match its snap-revision assertion, it may have been tampered with", info.InstanceName(), info.Revision)
+	}
+}
+
+func (ic *integrityCheck) disableSnap(info *snap.Info) error {
+	st := ic.state
+	var snapst SnapState
+	if err := Get(st, info.InstanceName(), &snapst); err != nil {
+		return err
+	}
+	// the snap may have changed while its file was being checked
+	if !snapst.Active || snapst.Current != info.Revision {
+		return fmt.Errorf("snap changed while being checked")
+	}
+	ts, err := Disable(st, info.InstanceName())
+	if err != nil {
+		return err
+	}
+	chg := st.NewChange("disable", fmt.Sprintf(i18n.G("Disable %q snap not matching its snap-revision assertion"), info.InstanceName()))
+	chg.AddAll(ts)
+	st.EnsureBefore(0)
+	return nil
+}
+
+func isEssentialSnapType(typ snap.Type) bool {
+	switch typ {
+	case snap.TypeOS, snap.TypeBase, snap.TypeKernel, snap.TypeGadget, snap.TypeSnapd:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,365 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/overlord/configstate/config"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+)
+
+// setupIntegrityCheck installs some-snap and core with snap-revision
+// assertions matching their files, and local-snap without.
+func (s *snapmgrTestSuite) setupIntegrityCheck(c *C) map[string]*snap.Info {
+	infos := make(map[string]*snap.Info)
+	revisions := make(map[string]*asserts.SnapRevision)
+	for _, si := range []*snap.SideInfo{
+		{RealName: "some-snap", SnapID: "some-snap-id", Revision: snap.R(7)},
+		{RealName: "core", SnapID: "core-id", Revision: snap.R(1)},
+		{RealName: "local-snap", Revision: snap.R(-1)},
+	} {
+		info := &snap.Info{SideInfo: *si}
+		c.Assert(os.MkdirAll(filepath.Dir(info.MountFile()), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(info.MountFile(), []byte(si.RealName+" content"), 0644), IsNil)
+		infos[si.RealName] = info
+
+		s.state.Lock()
+		snapstate.Set(s.state, si.RealName, &snapstate.SnapState{
+			Active:   true,
+			Sequence: []*snap.SideInfo{si},
+			Current:  si.Revision,
+		})
+		s.state.Unlock()
+		if si.SnapID == "" {
+			continue
+		}
+		digest, size, err := asserts.SnapFileSHA3_384(info.MountFile())
+		c.Assert(err, IsNil)
+		revisions[si.SnapID] = assertstest.FakeAssertion(map[string]interface{}{
+			"type":          "snap-revision",
+			"authority-id":  "canonical",
+			"snap-sha3-384": digest,
+			"snap-id":       si.SnapID,
+			"snap-size":     strconv.FormatUint(size, 10),
+			"snap-revision": si.Revision.String(),
+			"developer-id":  "canonical",
+		}).(*asserts.SnapRevision)
+	}
+
+	old := snapstate.SnapRevisionAssertion
+	snapstate.SnapRevisionAssertion = func(st *state.State, snapID string, revision snap.Revision) (*asserts.SnapRevision, error) {
+		snapRev := revisions[snapID]
+		if snapRev == nil || snapRev.SnapRevision() != revision.N {
+			return nil, &asserts.NotFoundError{Type: asserts.SnapRevisionType}
+		}
+		return snapRev, nil
+	}
+	s.AddCleanup(func() { snapstate.SnapRevisionAssertion = old })
+	s.AddCleanup(snapstate.MockOsutilBootID(func() (string, error) {
+		return "boot-id-1", nil
+	}))
+	return infos
+}
+
+func (s *snapmgrTestSuite) tamper(c *C, info *snap.Info) {
+	c.Assert(ioutil.WriteFile(info.MountFile(), []byte("tampered"), 0644), IsNil)
+}
+
+func (s *snapmgrTestSuite) TestSnapFileCheck(c *C) {
+	infos := s.setupIntegrityCheck(c)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	check, err := snapstate.NewSnapFileCheck(s.state, "some-snap")
+	c.Assert(err, IsNil)
+	c.Check(check.Info.InstanceName(), Equals, "some-snap")
+	c.Check(check.Info.Revision, Equals, snap.R(7))
+	c.Check(check.Size, Equals, uint64(len("some-snap content")))
+	c.Check(check.Run(), IsNil)
+
+	s.tamper(c, infos["some-snap"])
+	err = check.Run()
+	c.Check(err, FitsTypeOf, &snapstate.SnapIntegrityError{})
+	c.Check(err, ErrorMatches, `snap "some-snap" revision 7 file .*/some-snap_7.snap does not match its snap-revision assertion`)
+
+	_, err = snapstate.NewSnapFileCheck(s.state, "local-snap")
+	c.Check(err, Equals, snapstate.ErrSnapNotAsserted)
+
+	_, err = snapstate.NewSnapFileCheck(s.state, "no-such-snap")
+	c.Check(err, Equals, state.ErrNoState)
+}
+
+func (s *snapmgrTestSuite) TestIntegrityCheckWarnsOnMismatch(c *C) {
+	infos := s.setupIntegrityCheck(c)
+	s.tamper(c, infos["some-snap"])
+	s.tamper(c, infos["local-snap"])
+
+	ic := snapstate.NewIntegrityCheck(s.state)
+	c.Assert(ic.Ensure(), IsNil)
+	snapstate.IntegrityCheckWait(ic)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	warns := s.state.AllWarnings()
+	c.Assert(warns, HasLen, 1)
+	c.Check(warns[0].String(), Equals, `snap "some-snap" revision 7 does not match its snap-revision assertion, it may have been tampered with`)
+	c.Check(s.fakeBackend.ops, HasLen, 0)
+
+	var bootID string
+	c.Check(s.state.Get("integrity-check-boot-id", &bootID), IsNil)
+	c.Check(bootID, Equals, "boot-id-1")
+	var last time.Time
+	c.Check(s.state.Get("last-integrity-check", &last), IsNil)
+	c.Check(last.IsZero(), Equals, false)
+}
+
+func (s *snapmgrTestSuite) TestIntegrityCheckEnforceOnBoot(c *C) {
+	infos := s.setupIntegrityCheck(c)
+	s.tamper(c, infos["some-snap"])
+	s.tamper(c, infos["core"])
+
+	s.state.Lock()
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "snap-integrity", "enforce"), IsNil)
+	tr.Commit()
+	s.state.Unlock()
+
+	ic := snapstate.NewIntegrityCheck(s.state)
+	c.Assert(ic.Ensure(), IsNil)
+	snapstate.IntegrityCheckWait(ic)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	warns := s.state.AllWarnings()
+	c.Assert(warns, HasLen, 2)
+	c.Check(warns[0].String(), Equals, `snap "core" revision 1 does not match its snap-revision assertion, it may have been tampered with`)
+	c.Check(warns[1].String(), Equals, `snap "some-snap" revision 7 does not match its snap-revision assertion and is being disabled, it may have been tampered with`)
+
+	// the snap is disabled by a change, essential snaps are never
+	// disabled
+	chgs := s.state.Changes()
+	c.Assert(chgs, HasLen, 1)
+	chg := chgs[0]
+	c.Check(chg.Kind(), Equals, "disable")
+	c.Check(chg.Summary(), Equals, `Disable "some-snap" snap not matching its snap-revision assertion`)
+	var kinds []string
+	for _, t := range chg.Tasks() {
+		kinds = append(kinds, t.Kind())
+	}
+	c.Check(kinds, DeepEquals, []string{"stop-snap-services", "remove-aliases", "unlink-snap", "remove-profiles"})
+
+	s.state.Unlock()
+	s.settle(c)
+	s.state.Lock()
+
+	c.Assert(chg.Status(), Equals, state.DoneStatus, Commentf("%v", chg.Err()))
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.Active, Equals, false)
+	c.Assert(snapstate.Get(s.state, "core", &snapst), IsNil)
+	c.Check(snapst.Active, Equals, true)
+}
+
+func (s *snapmgrTestSuite) TestIntegrityCheckEnforceConflict(c *C) {
+	infos := s.setupIntegrityCheck(c)
+	s.tamper(c, infos["some-snap"])
+
+	s.state.Lock()
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "snap-integrity", "enforce"), IsNil)
+	tr.Commit()
+	// the snap is being changed
+	chg := s.state.NewChange("refresh", "...")
+	t := s.state.NewTask("link-snap", "...")
+	t.Set("snap-setup", &snapstate.SnapSetup{SideInfo: &infos["some-snap"].SideInfo})
+	chg.AddTask(t)
+	s.state.Unlock()
+
+	ic := snapstate.NewIntegrityCheck(s.state)
+	c.Assert(ic.Ensure(), IsNil)
+	snapstate.IntegrityCheckWait(ic)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	c.Check(s.fakeBackend.ops, HasLen, 0)
+	warns := s.state.AllWarnings()
+	c.Assert(warns, HasLen, 1)
+	c.Check(warns[0].String(), Matches, `snap "some-snap" revision 7 does not match its snap-revision assertion and cannot be disabled: .*`)
+	var snapst snapstate.SnapState
+	c.Assert(snapstate.Get(s.state, "some-snap", &snapst), IsNil)
+	c.Check(snapst.Active, Equals, true)
+}
+
+func (s *snapmgrTestSuite) TestIntegrityCheckInBackground(c *C) {
+	s.setupIntegrityCheck(c)
+
+	started := make(chan bool)
+	release := make(chan bool)
+	var checked []string
+	restore := snapstate.MockSnapFileSHA3_384(func(path string) (string, uint64, error) {
+		if len(checked) == 0 {
+			close(started)
+			<-release
+		}
+		checked = append(checked, filepath.Base(path))
+		return asserts.SnapFileSHA3_384(path)
+	})
+	defer restore()
+
+	ic := snapstate.NewIntegrityCheck(s.state)
+	// the check does not block Ensure
+	c.Assert(ic.Ensure(), IsNil)
+	<-started
+	c.Check(snapstate.IntegrityCheckInProgress(ic), Equals, true)
+	// and is not started again while in progress
+	c.Assert(ic.Ensure(), IsNil)
+
+	close(release)
+	snapstate.IntegrityCheckWait(ic)
+	c.Check(snapstate.IntegrityCheckInProgress(ic), Equals, false)
+	c.Check(checked, DeepEquals, []string{"core_1.snap", "some-snap_7.snap"})
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	var bootID string
+	c.Check(s.state.Get("integrity-check-boot-id", &bootID), IsNil)
+	c.Check(bootID, Equals, "boot-id-1")
+}
+
+func (s *snapmgrTestSuite) TestIntegrityCheckStop(c *C) {
+	infos := s.setupIntegrityCheck(c)
+	s.tamper(c, infos["some-snap"])
+
+	started := make(chan bool)
+	release := make(chan bool)
+	var checked []string
+	restore := snapstate.MockSnapFileSHA3_384(func(path string) (string, uint64, error) {
+		if len(checked) == 0 {
+			close(started)
+			<-release
+		}
+		checked = append(checked, filepath.Base(path))
+		return asserts.SnapFileSHA3_384(path)
+	})
+	defer restore()
+
+	ic := snapstate.NewIntegrityCheck(s.state)
+	c.Assert(ic.Ensure(), IsNil)
+	<-started
+
+	stopped := make(chan bool)
+	go func() {
+		snapstate.IntegrityCheckStop(ic)
+		close(stopped)
+	}()
+	for !snapstate.IntegrityCheckStopping(ic) {
+		time.Sleep(time.Millisecond)
+	}
+	// the check of the current file is finished first
+	close(release)
+	<-stopped
+
+	// the remaining snaps were not checked
+	c.Check(checked, DeepEquals, []string{"core_1.snap"})
+	c.Check(snapstate.IntegrityCheckInProgress(ic), Equals, false)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(s.state.AllWarnings(), HasLen, 0)
+	// and the check is done again on the next start
+	var bootID string
+	c.Check(s.state.Get("integrity-check-boot-id", &bootID), Equals, state.ErrNoState)
+}
+
+func (s *snapmgrTestSuite) TestIntegrityCheckSchedule(c *C) {
+	infos := s.setupIntegrityCheck(c)
+
+	s.state.Lock()
+	tr := config.NewTransaction(s.state)
+	c.Assert(tr.Set("core", "snap-integrity", "enforce"), IsNil)
+	tr.Commit()
+	s.state.Unlock()
+
+	now := time.Now()
+	restore := snapstate.MockTimeNow(now)
+	defer restore()
+
+	ic := snapstate.NewIntegrityCheck(s.state)
+	c.Assert(ic.Ensure(), IsNil)
+	snapstate.IntegrityCheckWait(ic)
+
+	// no new check within the interval on the same boot
+	s.tamper(c, infos["some-snap"])
+	restore = snapstate.MockTimeNow(now.Add(time.Hour))
+	defer restore()
+	c.Assert(ic.Ensure(), IsNil)
+	snapstate.IntegrityCheckWait(ic)
+
+	s.state.Lock()
+	c.Check(s.state.AllWarnings(), HasLen, 0)
+	s.state.Unlock()
+
+	// the interval elapsed, the mismatch is reported but nothing is
+	// unmounted outside of boot
+	restore = snapstate.MockTimeNow(now.Add(25 * time.Hour))
+	defer restore()
+	c.Assert(ic.Ensure(), IsNil)
+	snapstate.IntegrityCheckWait(ic)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	warns := s.state.AllWarnings()
+	c.Assert(warns, HasLen, 1)
+	c.Check(warns[0].String(), Matches, `snap "some-snap" revision 7 does not match .*, it may have been tampered with`)
+	c.Check(s.fakeBackend.ops, HasLen, 0)
+}
+
+func (s *snapmgrTestSuite) TestIntegrityCheckNotSeeded(c *C) {
+	infos := s.setupIntegrityCheck(c)
+	s.tamper(c, infos["some-snap"])
+
+	s.state.Lock()
+	s.state.Set("seeded", nil)
+	s.state.Unlock()
+
+	ic := snapstate.NewIntegrityCheck(s.state)
+	c.Assert(ic.Ensure(), IsNil)
+
+	s.state.Lock()
+	defer s.state.Unlock()
+	c.Check(s.state.AllWarnings(), HasLen, 0)
+	var bootID string
+	c.Check(s.state.Get("integrity-check-boot-id", &bootID), Equals, state.ErrNoState)
+}
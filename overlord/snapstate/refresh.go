@@ -26,17 +26,58 @@ import (
 	"strings"
 
 	"github.com/snapcore/snapd/cmd/snaplock/runinhibit"
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/i18n"
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/sandbox/cgroup"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
 	userclient "github.com/snapcore/snapd/usersession/client"
 )
 
 // pidsOfSnap is a mockable version of PidsOfSnap
 var pidsOfSnap = cgroup.PidsOfSnap
 
+// cgroupUserOfPid is a mockable version of UserOfPid
+var cgroupUserOfPid = cgroup.UserOfPid
+
+// usersOfPids returns the sorted user IDs running the given processes, as
+// far as they can be determined.
+func usersOfPids(pids []int) []int {
+	seen := make(map[int]bool)
+	var uids []int
+	for _, pid := range pids {
+		uid, err := cgroupUserOfPid(pid)
+		if err != nil {
+			logger.Debugf("cannot find the user of pid %v: %v", pid, err)
+			continue
+		}
+		if !seen[uid] {
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+	}
+	sort.Ints(uids)
+	return uids
+}
+
+// mergeUids returns the sorted union of the given lists of uids.
+func mergeUids(a, b []int) []int {
+	seen := make(map[int]bool, len(a)+len(b))
+	var uids []int
+	for _, uid := range append(append([]int(nil), a...), b...) {
+		if !seen[uid] {
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+	}
+	sort.Ints(uids)
+	return uids
+}
+
 var genericRefreshCheck = func(info *snap.Info, canAppRunDuringRefresh func(app *snap.AppInfo) bool) error {
 	knownPids, err := pidsOfSnap(info.InstanceName())
 	if err != nil {
@@ -229,3 +270,48 @@ func softCheckNothingRunningForRefresh(st *state.State, snapst *SnapState, info
 		return inhibitRefresh(st, snapst, info, SoftNothingRunningRefreshCheck)
 	})
 }
+
+// InDownloadCache returns whether the snap revision described by the
+// given download information was already fetched into the download
+// cache of the store, as happens when pre-downloading it.
+func InDownloadCache(downloadInfo *snap.DownloadInfo) bool {
+	if downloadInfo == nil || downloadInfo.Sha3_384 == "" {
+		return false
+	}
+	// only the layout of the cache matters here, not its size
+	cache := store.NewCacheManager(dirs.SnapDownloadCacheDir, 0)
+	return cache.GetPath(downloadInfo.Sha3_384) != ""
+}
+
+// preDownloadSnap sets up a change fetching the revision of the given
+// snap setup into the download cache, unless that was already done or
+// is in progress. It is used when the refresh of the snap is inhibited
+// by its running apps.
+func preDownloadSnap(st *state.State, snapsup *SnapSetup) {
+	if snapsup.DownloadInfo == nil || InDownloadCache(snapsup.DownloadInfo) {
+		return
+	}
+	for _, chg := range st.Changes() {
+		if chg.Kind() != "pre-download" || chg.Status().Ready() {
+			continue
+		}
+		for _, t := range chg.Tasks() {
+			var other SnapSetup
+			if err := t.Get("snap-setup", &other); err != nil {
+				continue
+			}
+			if other.InstanceName() == snapsup.InstanceName() && other.Revision() == snapsup.Revision() {
+				return
+			}
+		}
+	}
+
+	instanceName := snapsup.InstanceName()
+	revision := snapsup.Revision()
+	t := st.NewTask("pre-download-snap", fmt.Sprintf(i18n.G("Pre-download snap %q (%s) from channel %q"), instanceName, revision, snapsup.Channel))
+	t.Set("snap-setup", snapsup)
+	chg := st.NewChange("pre-download", fmt.Sprintf(i18n.G("Pre-download snap %q (%s) for its refresh"), instanceName, revision))
+	chg.AddTask(t)
+	chg.Set("snap-names", []string{instanceName})
+	st.EnsureBefore(0)
+}
@@ -282,3 +282,15 @@ func (s *refreshSuite) TestDoHardRefreshFlowRefreshDisallowed(c *C) {
 	op := backend.ops.MustFindOp(c, "run-inhibit-snap-for-unlink")
 	c.Check(op.inhibitHint, Equals, runinhibit.Hint("refresh"))
 }
+
+func (s *refreshSuite) TestInDownloadCache(c *C) {
+	c.Check(snapstate.InDownloadCache(nil), Equals, false)
+	c.Check(snapstate.InDownloadCache(&snap.DownloadInfo{}), Equals, false)
+
+	downloadInfo := &snap.DownloadInfo{Sha3_384: "some-sha3"}
+	c.Check(snapstate.InDownloadCache(downloadInfo), Equals, false)
+
+	c.Assert(os.MkdirAll(dirs.SnapDownloadCacheDir, 0700), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dirs.SnapDownloadCacheDir, "some-sha3"), nil, 0600), IsNil)
+	c.Check(snapstate.InDownloadCache(downloadInfo), Equals, true)
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/configstate/config"
 	"github.com/snapcore/snapd/overlord/snapstate/backend"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/randutil"
@@ -42,8 +43,10 @@ import (
 	"github.com/snapcore/snapd/sandbox"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/channel"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/snapdenv"
 	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/store/offline"
 )
 
 var (
@@ -61,6 +64,7 @@ type SnapManager struct {
 	autoRefresh    *autoRefresh
 	refreshHints   *refreshHints
 	catalogRefresh *catalogRefresh
+	integrityCheck *integrityCheck
 
 	lastUbuntuCoreTransitionAttempt time.Time
 
@@ -174,6 +178,14 @@ type SnapState struct {
 	// attempted but inhibited because the snap was busy. This value is
 	// reset on each successful refresh.
 	RefreshInhibitedTime *time.Time `json:"refresh-inhibited-time,omitempty"`
+	// RefreshPostponedUntil records until when the users asked not to
+	// be notified again about the inhibited refresh. This value is
+	// reset on each successful refresh.
+	RefreshPostponedUntil *time.Time `json:"refresh-postponed-until,omitempty"`
+	// RefreshInhibitedUids records the users that were notified about the
+	// inhibited refresh, only they are told when the refresh finishes.
+	// This value is reset on each successful refresh.
+	RefreshInhibitedUids []int `json:"refresh-inhibited-uids,omitempty"`
 }
 
 func (snapst *SnapState) SetTrackingChannel(s string) error {
@@ -289,6 +301,9 @@ var AutomaticSnapshot func(st *state.State, instanceName string) (ts *state.Task
 var AutomaticSnapshotExpiration func(st *state.State) (time.Duration, error)
 var EstimateSnapshotSize func(st *state.State, instanceName string, users []string) (uint64, error)
 
+// QuotaGroupForSnap allows to hook service manager's QuotaGroupForSnap.
+var QuotaGroupForSnap func(st *state.State, instanceName string) (*quota.Group, error)
+
 func readInfo(name string, si *snap.SideInfo, flags int) (*snap.Info, error) {
 	info, err := snapReadInfo(name, si)
 	if err != nil && flags&errorOnBroken != 0 {
@@ -372,13 +387,41 @@ func cachedStore(st *state.State) StoreService {
 	return ubuntuStore.(StoreService)
 }
 
-// the store implementation has the interface consumed here
+type cachedOfflineStoreKey struct{}
+
+// offlineStore returns the store serving the directory set with the
+// store.offline-dir core option, if any.
+func offlineStore(st *state.State) StoreService {
+	var dir string
+	tr := config.NewTransaction(st)
+	if err := tr.Get("core", "store.offline-dir", &dir); err != nil && !config.IsNoOption(err) {
+		logger.Noticef("cannot get the offline store directory: %v", err)
+		return nil
+	}
+	if dir == "" {
+		return nil
+	}
+	// keep the same store as long as the directory is unchanged, it
+	// caches what it read from the snap files
+	if sto, ok := st.Cached(cachedOfflineStoreKey{}).(*offline.Store); ok && sto.Dir() == dir {
+		return sto
+	}
+	sto := offline.New(dir)
+	st.Cache(cachedOfflineStoreKey{}, sto)
+	return sto
+}
+
+// the store implementations have the interface consumed here
 var _ StoreService = (*store.Store)(nil)
+var _ StoreService = (*offline.Store)(nil)
 
-// Store returns the store service provided by the optional device context or
-// the one used by the snapstate package if the former has no
-// override.
+// Store returns the offline store if one is configured, or the store service
+// provided by the optional device context or the one used by the snapstate
+// package if the former has no override.
 func Store(st *state.State, deviceCtx DeviceContext) StoreService {
+	if sto := offlineStore(st); sto != nil {
+		return sto
+	}
 	if deviceCtx != nil {
 		sto := deviceCtx.Store()
 		if sto != nil {
@@ -406,6 +449,7 @@ func Manager(st *state.State, runner *state.TaskRunner) (*SnapManager, error) {
 	} else {
 		m.backend = backend.Backend{}
 	}
+	m.integrityCheck = newIntegrityCheck(st)
 
 	if err := os.MkdirAll(dirs.SnapCookieDir, 0700); err != nil {
 		return nil, fmt.Errorf("cannot create directory %q: %v", dirs.SnapCookieDir, err)
@@ -427,6 +471,7 @@ func Manager(st *state.State, runner *state.TaskRunner) (*SnapManager, error) {
 	runner.AddHandler("prerequisites", m.doPrerequisites, nil)
 	runner.AddHandler("prepare-snap", m.doPrepareSnap, m.undoPrepareSnap)
 	runner.AddHandler("download-snap", m.doDownloadSnap, m.undoPrepareSnap)
+	runner.AddHandler("pre-download-snap", m.doPreDownloadSnap, nil)
 	runner.AddHandler("mount-snap", m.doMountSnap, m.undoMountSnap)
 	runner.AddHandler("unlink-current-snap", m.doUnlinkCurrentSnap, m.undoUnlinkCurrentSnap)
 	runner.AddHandler("copy-snap-data", m.doCopySnapData, m.undoCopySnapData)
@@ -436,6 +481,7 @@ func Manager(st *state.State, runner *state.TaskRunner) (*SnapManager, error) {
 	runner.AddHandler("switch-snap-channel", m.doSwitchSnapChannel, nil)
 	runner.AddHandler("toggle-snap-flags", m.doToggleSnapFlags, nil)
 	runner.AddHandler("check-rerefresh", m.doCheckReRefresh, nil)
+	runner.AddHandler("conditional-auto-refresh", m.doConditionalAutoRefresh, nil)
 
 	// FIXME: drop the task entirely after a while
 	// (having this wart here avoids yet-another-patch)
@@ -854,6 +900,14 @@ func (m *SnapManager) localInstallCleanup() error {
 	return osutil.UnlinkManyAt(d, filenames)
 }
 
+// Stop implements StateStopper. It stops the check of the integrity of
+// the snap files, if running.
+func (m *SnapManager) Stop() {
+	if m.integrityCheck != nil {
+		m.integrityCheck.stop()
+	}
+}
+
 // Ensure implements StateManager.Ensure.
 func (m *SnapManager) Ensure() error {
 	if m.preseed {
@@ -872,6 +926,7 @@ func (m *SnapManager) Ensure() error {
 		m.autoRefresh.Ensure(),
 		m.refreshHints.Ensure(),
 		m.catalogRefresh.Ensure(),
+		m.integrityCheck.Ensure(),
 		m.localInstallCleanup(),
 	}
 
@@ -47,6 +47,7 @@ import (
 	"github.com/snapcore/snapd/release"
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/channel"
+	"github.com/snapcore/snapd/snap/naming"
 	"github.com/snapcore/snapd/store"
 	"github.com/snapcore/snapd/strutil"
 )
@@ -749,6 +750,13 @@ func InstallPath(st *state.State, si *snap.SideInfo, path, instanceName, channel
 	}
 	info.InstanceKey = instanceKey
 
+	if si.SnapID != "" {
+		opts := &RevisionOptions{Revision: si.Revision}
+		if _, err := checkInstallAgainstValidationSets(st, naming.NewSnapRef(info.SnapName(), si.SnapID), opts, flags); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	flags, err = ensureInstallPreconditions(st, info, flags, &snapst, deviceCtx)
 	if err != nil {
 		return nil, nil, err
@@ -826,6 +834,11 @@ func InstallWithDeviceContext(ctx context.Context, st *state.State, name string,
 		return nil, fmt.Errorf("invalid instance name: %v", err)
 	}
 
+	opts, err = checkInstallAgainstValidationSets(st, naming.Snap(snap.InstanceSnap(name)), opts, flags)
+	if err != nil {
+		return nil, err
+	}
+
 	sar, err := installInfo(ctx, st, name, opts, userID, deviceCtx)
 	if err != nil {
 		return nil, err
@@ -902,6 +915,7 @@ func InstallMany(st *state.State, names []string, userID int) ([]string, []*stat
 	}
 
 	toInstall := make([]string, 0, len(names))
+	revisions := make(map[string]snap.Revision)
 	for _, name := range names {
 		var snapst SnapState
 		err := Get(st, name, &snapst)
@@ -916,6 +930,14 @@ func InstallMany(st *state.State, names []string, userID int) ([]string, []*stat
 			return nil, nil, fmt.Errorf("invalid instance name: %v", err)
 		}
 
+		opts, err := checkInstallAgainstValidationSets(st, naming.Snap(snap.InstanceSnap(name)), &RevisionOptions{}, Flags{})
+		if err != nil {
+			return nil, nil, err
+		}
+		if !opts.Revision.Unset() {
+			revisions[name] = opts.Revision
+		}
+
 		toInstall = append(toInstall, name)
 	}
 
@@ -924,7 +946,7 @@ func InstallMany(st *state.State, names []string, userID int) ([]string, []*stat
 		return nil, nil, err
 	}
 
-	installs, err := installCandidates(st, toInstall, "stable", user)
+	installs, err := installCandidates(st, toInstall, "stable", revisions, user)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1056,6 +1078,26 @@ func updateManyFiltered(ctx context.Context, st *state.State, names []string, us
 		updates = actual
 	}
 
+	if len(names) == 0 {
+		// snaps held by the user are only refreshed when asked for
+		// explicitly
+		userHeld, err := userHeldSnaps(st)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(userHeld) > 0 {
+			actual := updates[:0]
+			for _, update := range updates {
+				if _, ok := userHeld[update.InstanceName()]; ok {
+					logger.Debugf("Skipping refresh of held snap %q.", update.InstanceName())
+					continue
+				}
+				actual = append(actual, update)
+			}
+			updates = actual
+		}
+	}
+
 	if ValidateRefreshes != nil && len(updates) != 0 {
 		updates, err = ValidateRefreshes(st, updates, ignoreValidation, userID, deviceCtx)
 		if err != nil {
@@ -1220,6 +1262,11 @@ func doUpdate(ctx context.Context, st *state.State, names []string, updates []*s
 
 		ts, err := doInstall(st, snapst, snapsup, 0, fromChange, inUseFor(deviceCtx))
 		if err != nil {
+			if _, ok := err.(*BusySnapError); ok {
+				// fetch the new revision while the apps keep running,
+				// the refresh then only has to link it
+				preDownloadSnap(st, snapsup)
+			}
 			if refreshAll {
 				// doing "refresh all", just skip this snap
 				logger.Noticef("cannot refresh snap %q: %v", update.InstanceName(), err)
@@ -1745,6 +1792,30 @@ func UpdateWithDeviceContext(st *state.State, name string, opts *RevisionOptions
 }
 
 func infoForUpdate(st *state.State, snapst *SnapState, name string, opts *RevisionOptions, userID int, flags Flags, deviceCtx DeviceContext) (*snap.Info, error) {
+	if !flags.IgnoreValidation {
+		enforced, err := enforcedValidationSets(st)
+		if err != nil {
+			return nil, err
+		}
+		requiredRev, err := requiredRevisionForRefresh(enforced, snapst)
+		if err != nil {
+			return nil, err
+		}
+		if !requiredRev.Unset() {
+			switch {
+			case opts.Revision.Unset() && requiredRev == snapst.Current:
+				// already at the revision required by validation sets
+				return nil, store.ErrNoUpdateAvailable
+			case opts.Revision.Unset():
+				pinned := *opts
+				pinned.Revision = requiredRev
+				opts = &pinned
+			case opts.Revision != requiredRev:
+				return nil, fmt.Errorf("cannot refresh snap %q to revision %s: validation sets require revision %s", name, opts.Revision, requiredRev)
+			}
+		}
+	}
+
 	if opts.Revision.Unset() {
 		// good ol' refresh
 		info, err := updateInfo(st, snapst, opts, userID, flags, deviceCtx)
@@ -1791,6 +1862,16 @@ func AutoRefresh(ctx context.Context, st *state.State) ([]string, []*state.TaskS
 		}
 	}
 
+	tr := config.NewTransaction(st)
+	gateAutoRefreshHook, err := features.Flag(tr, features.GateAutoRefreshHook)
+	if err != nil && !config.IsNoOption(err) {
+		return nil, nil, err
+	}
+	if gateAutoRefreshHook {
+		// snaps with a gate-auto-refresh hook get a say first
+		return autoRefreshPhase1(ctx, st)
+	}
+
 	return UpdateMany(ctx, st, nil, userID, &Flags{IsAutoRefresh: true})
 }
 
@@ -2059,6 +2140,12 @@ func removeTasks(st *state.State, name string, revision snap.Revision, flags *Re
 		return nil, 0, fmt.Errorf("snap %q is not removable: %v", name, err)
 	}
 
+	if removeAll {
+		if err := checkRemoveAgainstValidationSets(st, &snapst); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	// main/current SnapSetup
 	snapsup := SnapSetup{
 		SideInfo: &snap.SideInfo{
@@ -56,6 +56,7 @@ import (
 	"github.com/snapcore/snapd/snap"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/store/offline"
 	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/timeutil"
 
@@ -225,6 +226,7 @@ func (s *snapmgrTestSuite) TearDownTest(c *C) {
 	snapstate.ValidateRefreshes = nil
 	snapstate.AutoAliases = nil
 	snapstate.CanAutoRefresh = nil
+	snapstate.EnforcedValidationSets = nil
 }
 
 type ForeignTaskTracker interface {
@@ -344,6 +346,42 @@ func (s *snapmgrTestSuite) TestStoreWithDeviceContext(c *C) {
 	c.Check(store3, Equals, stoB)
 }
 
+func (s *snapmgrTestSuite) TestStoreOffline(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	sto := &store.Store{}
+	snapstate.ReplaceStore(s.state, sto)
+
+	dir := c.MkDir()
+	tr := config.NewTransaction(s.state)
+	tr.Set("core", "store.offline-dir", dir)
+	tr.Commit()
+
+	store1 := snapstate.Store(s.state, &snapstatetest.TrivialDeviceContext{CtxStore: sto})
+	c.Assert(store1, FitsTypeOf, &offline.Store{})
+	c.Check(store1.(*offline.Store).Dir(), Equals, dir)
+
+	// cached
+	store2 := snapstate.Store(s.state, nil)
+	c.Check(store2, Equals, store1)
+
+	// a new directory gives a new store
+	otherDir := c.MkDir()
+	tr = config.NewTransaction(s.state)
+	tr.Set("core", "store.offline-dir", otherDir)
+	tr.Commit()
+	store3 := snapstate.Store(s.state, nil)
+	c.Assert(store3, FitsTypeOf, &offline.Store{})
+	c.Check(store3.(*offline.Store).Dir(), Equals, otherDir)
+
+	// back to the regular store once unset
+	tr = config.NewTransaction(s.state)
+	tr.Set("core", "store.offline-dir", "")
+	tr.Commit()
+	c.Check(snapstate.Store(s.state, nil), Equals, sto)
+}
+
 func (s *snapmgrTestSuite) TestUserFromUserID(c *C) {
 	s.state.Lock()
 	defer s.state.Unlock()
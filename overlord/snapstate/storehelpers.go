@@ -466,6 +466,11 @@ func refreshCandidates(ctx context.Context, st *state.State, names []string, use
 	ignoreValidationByInstanceName := make(map[string]bool)
 	nCands := 0
 
+	enforced, err := enforcedValidationSets(st)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	addCand := func(installed *store.CurrentSnap, snapst *SnapState) {
 		// FIXME: snaps that are not active are skipped for now
 		//        until we know what we want to do
@@ -482,6 +487,16 @@ func refreshCandidates(ctx context.Context, st *state.State, names []string, use
 			return
 		}
 
+		requiredRev, err := requiredRevisionForRefresh(enforced, snapst)
+		if err != nil {
+			logger.Noticef("cannot determine revision required by validation sets for snap %q: %v", installed.InstanceName, err)
+			return
+		}
+		if !requiredRev.Unset() && requiredRev == snapst.Current {
+			// already at the revision required by validation sets
+			return
+		}
+
 		stateByInstanceName[installed.InstanceName] = snapst
 
 		if len(names) == 0 {
@@ -492,11 +507,15 @@ func refreshCandidates(ctx context.Context, st *state.State, names []string, use
 		if userID == 0 {
 			userID = fallbackID
 		}
-		actionsByUserID[userID] = append(actionsByUserID[userID], &store.SnapAction{
+		action := &store.SnapAction{
 			Action:       "refresh",
 			SnapID:       installed.SnapID,
 			InstanceName: installed.InstanceName,
-		})
+		}
+		if !requiredRev.Unset() {
+			action.Revision = requiredRev
+		}
+		actionsByUserID[userID] = append(actionsByUserID[userID], action)
 		if snapst.IgnoreValidation {
 			ignoreValidationByInstanceName[installed.InstanceName] = true
 		}
@@ -559,7 +578,7 @@ func refreshCandidates(ctx context.Context, st *state.State, names []string, use
 	return updates, stateByInstanceName, ignoreValidationByInstanceName, nil
 }
 
-func installCandidates(st *state.State, names []string, channel string, user *auth.UserState) ([]store.SnapActionResult, error) {
+func installCandidates(st *state.State, names []string, channel string, revisions map[string]snap.Revision, user *auth.UserState) ([]store.SnapActionResult, error) {
 	curSnaps, err := currentSnaps(st)
 	if err != nil {
 		return nil, err
@@ -578,6 +597,11 @@ func installCandidates(st *state.State, names []string, channel string, user *au
 			// the desired channel
 			Channel: channel,
 		}
+		if rev, ok := revisions[name]; ok {
+			// the revision required by validation sets
+			actions[i].Revision = rev
+			actions[i].Channel = ""
+		}
 	}
 
 	// TODO: possibly support a deviceCtx
@@ -0,0 +1,144 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/naming"
+)
+
+// EnforcedValidationSets allows to hook getting of validation sets in enforce
+// mode into installation, refresh and removal of snaps.
+var EnforcedValidationSets func(st *state.State) (*snapasserts.ValidationSets, error)
+
+// enforcedValidationSets returns the validation sets in enforce mode, or nil
+// if there is no way to get them.
+func enforcedValidationSets(st *state.State) (*snapasserts.ValidationSets, error) {
+	if EnforcedValidationSets == nil {
+		return nil, nil
+	}
+	return EnforcedValidationSets(st)
+}
+
+// checkInstallAgainstValidationSets checks whether the given snap can be
+// installed with the enforced validation sets. It returns the revision
+// options to use for the installation, which pin the revision required by
+// the validation sets if any.
+func checkInstallAgainstValidationSets(st *state.State, snapRef naming.SnapRef, opts *RevisionOptions, flags Flags) (*RevisionOptions, error) {
+	if flags.IgnoreValidation {
+		return opts, nil
+	}
+	enforced, err := enforcedValidationSets(st)
+	if err != nil || enforced == nil {
+		return opts, err
+	}
+
+	invalidFor, err := enforced.CheckPresenceInvalid(snapRef)
+	if err != nil {
+		return nil, err
+	}
+	if len(invalidFor) > 0 {
+		return nil, fmt.Errorf("cannot install snap %q: invalid for validation sets %s", snapRef.SnapName(), strings.Join(invalidFor, ","))
+	}
+
+	_, rev, err := enforced.CheckPresenceRequired(snapRef)
+	if err != nil {
+		return nil, err
+	}
+	if rev.Unset() {
+		return opts, nil
+	}
+	if !opts.Revision.Unset() {
+		if opts.Revision != rev {
+			return nil, fmt.Errorf("cannot install snap %q at revision %s: validation sets require revision %s", snapRef.SnapName(), opts.Revision, rev)
+		}
+		return opts, nil
+	}
+
+	// pin the revision required by the validation sets
+	pinned := *opts
+	pinned.Revision = rev
+	pinned.CohortKey = ""
+	return &pinned, nil
+}
+
+// requiredRevisionForRefresh returns the revision the given snap must be
+// refreshed to with the enforced validation sets, or the unset revision if
+// it is not constrained.
+func requiredRevisionForRefresh(enforced *snapasserts.ValidationSets, snapst *SnapState) (snap.Revision, error) {
+	if enforced == nil || snapst.IgnoreValidation {
+		return snap.Revision{}, nil
+	}
+	si := snapst.CurrentSideInfo()
+	if si == nil {
+		return snap.Revision{}, nil
+	}
+	snapRef := naming.NewSnapRef(si.RealName, si.SnapID)
+	if invalidFor, err := enforced.CheckPresenceInvalid(snapRef); err != nil || len(invalidFor) > 0 {
+		// nothing to pin an invalid snap to
+		return snap.Revision{}, err
+	}
+	_, rev, err := enforced.CheckPresenceRequired(snapRef)
+	return rev, err
+}
+
+// checkRemoveAgainstValidationSets checks whether the given snap can be
+// removed with the enforced validation sets.
+func checkRemoveAgainstValidationSets(st *state.State, snapst *SnapState) error {
+	enforced, err := enforcedValidationSets(st)
+	if err != nil || enforced == nil {
+		return err
+	}
+	si := snapst.CurrentSideInfo()
+	if si == nil {
+		return nil
+	}
+	requiredBy, _, err := enforced.CheckPresenceRequired(naming.NewSnapRef(si.RealName, si.SnapID))
+	if err != nil {
+		return err
+	}
+	if len(requiredBy) > 0 {
+		return fmt.Errorf("cannot remove snap %q: required by validation sets %s", si.RealName, strings.Join(requiredBy, ","))
+	}
+	return nil
+}
+
+// InstalledSnaps returns the current revisions of all the installed snaps
+// for checking against validation sets.
+func InstalledSnaps(st *state.State) ([]*snapasserts.InstalledSnap, error) {
+	snapStates, err := All(st)
+	if err != nil {
+		return nil, err
+	}
+	snaps := make([]*snapasserts.InstalledSnap, 0, len(snapStates))
+	for _, snapst := range snapStates {
+		si := snapst.CurrentSideInfo()
+		if si == nil {
+			continue
+		}
+		snaps = append(snaps, snapasserts.NewInstalledSnap(si.RealName, si.SnapID, si.Revision))
+	}
+	return snaps, nil
+}
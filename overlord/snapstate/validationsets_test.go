@@ -0,0 +1,242 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snapstate_test
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/asserts/snapasserts"
+	"github.com/snapcore/snapd/overlord/snapstate"
+	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/store"
+)
+
+func mockEnforcedValidationSet(c *C, presence, revision string) {
+	snaps := map[string]interface{}{
+		"name":     "my-snap",
+		"id":       "mysnapididididididididididididid",
+		"presence": presence,
+	}
+	if revision != "" {
+		snaps["revision"] = revision
+	}
+	vs := assertstest.FakeAssertion(map[string]interface{}{
+		"type":         "validation-set",
+		"authority-id": "foo",
+		"series":       "16",
+		"account-id":   "foo",
+		"name":         "bar",
+		"sequence":     "1",
+		"snaps":        []interface{}{snaps},
+	}).(*asserts.ValidationSet)
+
+	snapstate.EnforcedValidationSets = func(st *state.State) (*snapasserts.ValidationSets, error) {
+		sets := snapasserts.NewValidationSets()
+		c.Assert(sets.Add(vs), IsNil)
+		return sets, nil
+	}
+}
+
+func (s *snapmgrTestSuite) mockInstalledMySnap(rev snap.Revision) {
+	snapstate.Set(s.state, "my-snap", &snapstate.SnapState{
+		Active: true,
+		Sequence: []*snap.SideInfo{
+			{RealName: "my-snap", SnapID: "mysnapididididididididididididid", Revision: rev},
+		},
+		Current:  rev,
+		SnapType: "app",
+	})
+}
+
+func (s *snapmgrTestSuite) TestInstallValidationSetsInvalid(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	mockEnforcedValidationSet(c, "invalid", "")
+
+	_, err := snapstate.Install(context.Background(), s.state, "my-snap", nil, 0, snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot install snap "my-snap": invalid for validation sets foo/bar`)
+
+	// unless validation is ignored
+	_, err = snapstate.Install(context.Background(), s.state, "my-snap", nil, 0, snapstate.Flags{IgnoreValidation: true})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapmgrTestSuite) TestInstallValidationSetsPinsRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	mockEnforcedValidationSet(c, "required", "5")
+
+	_, err := snapstate.Install(context.Background(), s.state, "my-snap", nil, 0, snapstate.Flags{})
+	c.Assert(err, IsNil)
+
+	op := s.fakeBackend.ops.MustFindOp(c, "storesvc-snap-action:action")
+	c.Check(op.action, DeepEquals, store.SnapAction{
+		Action:       "install",
+		InstanceName: "my-snap",
+		Revision:     snap.R(5),
+	})
+	c.Check(op.revno, Equals, snap.R(5))
+}
+
+func (s *snapmgrTestSuite) TestInstallValidationSetsWrongRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	mockEnforcedValidationSet(c, "required", "5")
+
+	opts := &snapstate.RevisionOptions{Revision: snap.R(7)}
+	_, err := snapstate.Install(context.Background(), s.state, "my-snap", opts, 0, snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot install snap "my-snap" at revision 7: validation sets require revision 5`)
+}
+
+func (s *snapmgrTestSuite) TestInstallManyValidationSets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	mockEnforcedValidationSet(c, "required", "5")
+
+	installed, tts, err := snapstate.InstallMany(s.state, []string{"my-snap", "some-snap"}, 0)
+	c.Assert(err, IsNil)
+	c.Check(installed, DeepEquals, []string{"my-snap", "some-snap"})
+	c.Check(tts, HasLen, 2)
+
+	var actions []store.SnapAction
+	for _, op := range s.fakeBackend.ops {
+		if op.op == "storesvc-snap-action:action" {
+			actions = append(actions, op.action)
+		}
+	}
+	c.Check(actions, DeepEquals, []store.SnapAction{{
+		Action:       "install",
+		InstanceName: "my-snap",
+		Revision:     snap.R(5),
+	}, {
+		Action:       "install",
+		InstanceName: "some-snap",
+		Channel:      "stable",
+	}})
+
+	mockEnforcedValidationSet(c, "invalid", "")
+	_, _, err = snapstate.InstallMany(s.state, []string{"my-snap", "some-snap"}, 0)
+	c.Assert(err, ErrorMatches, `cannot install snap "my-snap": invalid for validation sets foo/bar`)
+}
+
+func (s *snapmgrTestSuite) TestUpdateValidationSetsPinsRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInstalledMySnap(snap.R(1))
+	mockEnforcedValidationSet(c, "required", "5")
+
+	_, err := snapstate.Update(s.state, "my-snap", nil, 0, snapstate.Flags{})
+	c.Assert(err, IsNil)
+
+	op := s.fakeBackend.ops.MustFindOp(c, "storesvc-snap-action:action")
+	c.Check(op.action, DeepEquals, store.SnapAction{
+		Action:       "refresh",
+		InstanceName: "my-snap",
+		SnapID:       "mysnapididididididididididididid",
+		Revision:     snap.R(5),
+	})
+	c.Check(op.revno, Equals, snap.R(5))
+}
+
+func (s *snapmgrTestSuite) TestUpdateValidationSetsAtRequiredRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInstalledMySnap(snap.R(5))
+	mockEnforcedValidationSet(c, "required", "5")
+
+	_, err := snapstate.Update(s.state, "my-snap", nil, 0, snapstate.Flags{})
+	c.Assert(err, Equals, store.ErrNoUpdateAvailable)
+	c.Check(s.fakeBackend.ops.Count("storesvc-snap-action:action"), Equals, 0)
+}
+
+func (s *snapmgrTestSuite) TestUpdateValidationSetsWrongRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInstalledMySnap(snap.R(1))
+	mockEnforcedValidationSet(c, "required", "5")
+
+	opts := &snapstate.RevisionOptions{Revision: snap.R(7)}
+	_, err := snapstate.Update(s.state, "my-snap", opts, 0, snapstate.Flags{})
+	c.Assert(err, ErrorMatches, `cannot refresh snap "my-snap" to revision 7: validation sets require revision 5`)
+
+	// unless validation is ignored
+	_, err = snapstate.Update(s.state, "my-snap", opts, 0, snapstate.Flags{IgnoreValidation: true})
+	c.Assert(err, IsNil)
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyValidationSets(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInstalledMySnap(snap.R(1))
+	mockEnforcedValidationSet(c, "required", "5")
+
+	updates, _, err := snapstate.UpdateMany(context.Background(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(updates, DeepEquals, []string{"my-snap"})
+
+	op := s.fakeBackend.ops.MustFindOp(c, "storesvc-snap-action:action")
+	c.Check(op.action, DeepEquals, store.SnapAction{
+		Action:       "refresh",
+		InstanceName: "my-snap",
+		SnapID:       "mysnapididididididididididididid",
+		Revision:     snap.R(5),
+	})
+}
+
+func (s *snapmgrTestSuite) TestUpdateManyValidationSetsAtRequiredRevision(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInstalledMySnap(snap.R(5))
+	mockEnforcedValidationSet(c, "required", "5")
+
+	updates, _, err := snapstate.UpdateMany(context.Background(), s.state, nil, 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(updates, HasLen, 0)
+	c.Check(s.fakeBackend.ops.Count("storesvc-snap-action:action"), Equals, 0)
+}
+
+func (s *snapmgrTestSuite) TestRemoveValidationSetsRequired(c *C) {
+	s.state.Lock()
+	defer s.state.Unlock()
+
+	s.mockInstalledMySnap(snap.R(5))
+	mockEnforcedValidationSet(c, "required", "")
+
+	_, err := snapstate.Remove(s.state, "my-snap", snap.R(0), nil)
+	c.Assert(err, ErrorMatches, `cannot remove snap "my-snap": required by validation sets foo/bar`)
+
+	mockEnforcedValidationSet(c, "optional", "")
+	_, err = snapstate.Remove(s.state, "my-snap", snap.R(0), nil)
+	c.Assert(err, IsNil)
+}
@@ -25,6 +25,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/snapcore/snapd/metrics"
 )
 
 // Status is used for status values for changes and tasks.
@@ -301,12 +303,24 @@ func (c *Change) Status() Status {
 // SetStatus sets the change status, overriding the default behavior (see Status method).
 func (c *Change) SetStatus(s Status) {
 	c.state.writing()
+	observed := len(c.state.observers) > 0
+	var old Status
+	if observed {
+		old = c.Status()
+	}
 	c.status = s
+	if observed {
+		if new := c.Status(); new != old {
+			c.state.notifyChangeStatusChanged(c, old, new)
+		}
+	}
 	if s.Ready() {
 		c.markReady()
 	}
 }
 
+var readyChanges = metrics.NewCounter("snapd_changes", "Changes that became ready, by kind and outcome.", "kind", "status")
+
 func (c *Change) markReady() {
 	select {
 	case <-c.ready:
@@ -315,6 +329,7 @@ func (c *Change) markReady() {
 	}
 	if c.readyTime.IsZero() {
 		c.readyTime = timeNow()
+		readyChanges.Inc(c.kind, c.Status().String())
 	}
 }
 
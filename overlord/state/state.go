@@ -32,6 +32,7 @@ import (
 	"time"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 )
 
 // A Backend is used by State to checkpoint on every unlock operation
@@ -100,6 +101,8 @@ const (
 type State struct {
 	mu  sync.Mutex
 	muC int32
+	// lockedAt is when the lock was last taken
+	lockedAt time.Time
 
 	lastTaskId   int
 	lastChangeId int
@@ -115,6 +118,8 @@ type State struct {
 
 	cache map[interface{}]interface{}
 
+	observers []*Observer
+
 	restarting RestartType
 	restartLck sync.Mutex
 	bootID     string
@@ -142,6 +147,7 @@ func (s *State) Modified() bool {
 func (s *State) Lock() {
 	s.mu.Lock()
 	atomic.AddInt32(&s.muC, 1)
+	s.lockedAt = time.Now()
 }
 
 func (s *State) reading() {
@@ -157,7 +163,10 @@ func (s *State) writing() {
 	}
 }
 
+var lockHoldTime = metrics.NewHistogram("snapd_state_lock_hold_seconds", "Time the state lock was held for.", nil)
+
 func (s *State) unlock() {
+	lockHoldTime.ObserveDuration(time.Since(s.lockedAt))
 	atomic.AddInt32(&s.muC, -1)
 	s.mu.Unlock()
 }
@@ -358,6 +367,71 @@ func (s *State) Cache(key, value interface{}) {
 	}
 }
 
+// Observer holds functions that are called, with the state lock held,
+// on notable transitions of the state. Any of them can be nil. The
+// functions must not block nor modify the state.
+type Observer struct {
+	// TaskStatusChanged is called when the status of a task changes.
+	TaskStatusChanged func(t *Task, old, new Status)
+	// ChangeStatusChanged is called when the aggregated or explicitly
+	// set status of a change changes.
+	ChangeStatusChanged func(chg *Change, old, new Status)
+	// TaskProgressChanged is called when the progress of a task is set.
+	TaskProgressChanged func(t *Task, label string, done, total int)
+	// WarningAdded is called when a warning with a new message is added.
+	WarningAdded func(w *Warning)
+}
+
+// AddObserver registers the given observer for notifications about
+// the state.
+func (s *State) AddObserver(o *Observer) {
+	s.reading() // Doesn't touch persisted data.
+	s.observers = append(s.observers, o)
+}
+
+// RemoveObserver unregisters the given observer.
+func (s *State) RemoveObserver(o *Observer) {
+	s.reading() // Doesn't touch persisted data.
+	for i, obs := range s.observers {
+		if obs == o {
+			s.observers = append(s.observers[:i:i], s.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *State) notifyTaskStatusChanged(t *Task, old, new Status) {
+	for _, o := range s.observers {
+		if o.TaskStatusChanged != nil {
+			o.TaskStatusChanged(t, old, new)
+		}
+	}
+}
+
+func (s *State) notifyChangeStatusChanged(chg *Change, old, new Status) {
+	for _, o := range s.observers {
+		if o.ChangeStatusChanged != nil {
+			o.ChangeStatusChanged(chg, old, new)
+		}
+	}
+}
+
+func (s *State) notifyTaskProgressChanged(t *Task, label string, done, total int) {
+	for _, o := range s.observers {
+		if o.TaskProgressChanged != nil {
+			o.TaskProgressChanged(t, label, done, total)
+		}
+	}
+}
+
+func (s *State) notifyWarningAdded(w *Warning) {
+	for _, o := range s.observers {
+		if o.WarningAdded != nil {
+			o.WarningAdded(w)
+		}
+	}
+}
+
 // NewChange adds a new change to the state.
 func (s *State) NewChange(kind, summary string) *Change {
 	s.writing()
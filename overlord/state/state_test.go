@@ -167,6 +167,60 @@ func (ss *stateSuite) TestCache(c *C) {
 	c.Assert(ok, Equals, false)
 }
 
+func (ss *stateSuite) TestObserver(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	var events []string
+	obs := &state.Observer{
+		TaskStatusChanged: func(t *state.Task, old, new state.Status) {
+			events = append(events, fmt.Sprintf("task %s: %s -> %s", t.Kind(), old, new))
+		},
+		ChangeStatusChanged: func(chg *state.Change, old, new state.Status) {
+			events = append(events, fmt.Sprintf("change %s: %s -> %s", chg.Kind(), old, new))
+		},
+		TaskProgressChanged: func(t *state.Task, label string, done, total int) {
+			events = append(events, fmt.Sprintf("task %s progress: %s %d/%d", t.Kind(), label, done, total))
+		},
+		WarningAdded: func(w *state.Warning) {
+			events = append(events, fmt.Sprintf("warning: %s", w))
+		},
+	}
+	st.AddObserver(obs)
+
+	chg := st.NewChange("chg", "...")
+	t1 := st.NewTask("foo", "...")
+	t2 := st.NewTask("bar", "...")
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+
+	t1.SetProgress("doing", 1, 2)
+	t1.SetStatus(state.DoneStatus)
+	t2.SetStatus(state.DoneStatus)
+	// no transition
+	t2.SetStatus(state.DoneStatus)
+	st.Warnf("hello")
+	// already known warning
+	st.Warnf("hello")
+	chg.SetStatus(state.ErrorStatus)
+
+	c.Check(events, DeepEquals, []string{
+		"task foo progress: doing 1/2",
+		"task foo: Do -> Done",
+		"task bar: Do -> Done",
+		"change chg: Do -> Done",
+		"warning: hello",
+		"change chg: Done -> Error",
+	})
+
+	events = nil
+	st.RemoveObserver(obs)
+	t1.SetStatus(state.UndoStatus)
+	st.Warnf("bye")
+	c.Check(events, HasLen, 0)
+}
+
 type fakeStateBackend struct {
 	checkpoints      [][]byte
 	error            func() error
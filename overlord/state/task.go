@@ -200,14 +200,32 @@ func (t *Task) Status() Status {
 func (t *Task) SetStatus(new Status) {
 	t.state.writing()
 	old := t.status
+	chg := t.Change()
+	observed := len(t.state.observers) > 0
+	var oldStatus, oldChgStatus Status
+	if observed {
+		oldStatus = t.Status()
+		if chg != nil {
+			oldChgStatus = chg.Status()
+		}
+	}
 	t.status = new
 	if !old.Ready() && new.Ready() {
 		t.readyTime = timeNow()
 	}
-	chg := t.Change()
 	if chg != nil {
 		chg.taskStatusChanged(t, old, new)
 	}
+	if observed {
+		if newStatus := t.Status(); newStatus != oldStatus {
+			t.state.notifyTaskStatusChanged(t, oldStatus, newStatus)
+		}
+		if chg != nil {
+			if newChgStatus := chg.Status(); newChgStatus != oldChgStatus {
+				t.state.notifyChangeStatusChanged(chg, oldChgStatus, newChgStatus)
+			}
+		}
+	}
 }
 
 // IsClean returns whether the task has been cleaned. See SetClean.
@@ -270,6 +288,10 @@ func (t *Task) SetProgress(label string, done, total int) {
 	} else {
 		t.progress = &progress{Label: label, Done: done, Total: total}
 	}
+	if len(t.state.observers) > 0 {
+		label, done, total = t.Progress()
+		t.state.notifyTaskProgressChanged(t, label, done, total)
+	}
 }
 
 // SpawnTime returns the time when the change was created.
@@ -334,7 +356,20 @@ func (t *Task) addLog(kind, format string, args []interface{}) {
 	tstr := timeNow().Format(time.RFC3339)
 	msg := fmt.Sprintf(tstr+" "+kind+" "+format, args...)
 	t.log = append(t.log, msg)
-	logger.Debugf(msg)
+	t.Logger().Debugf("%s", msg)
+}
+
+// Logger returns a logger attaching the IDs of the task and of its change,
+// if any, to messages.
+func (t *Task) Logger() *logger.ContextLogger {
+	fields := map[string]string{
+		"task-id":   t.id,
+		"task-kind": t.kind,
+	}
+	if t.change != "" {
+		fields["change-id"] = t.change
+	}
+	return logger.WithFields(fields)
 }
 
 // Log returns the most recent messages logged into the task.
@@ -20,11 +20,13 @@
 package state_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/testutil"
 	"time"
@@ -390,6 +392,30 @@ func (ts *taskSuite) TestTaskMarshalsLog(c *C) {
 	c.Assert(string(d), Matches, `.*"log":\["....-..-..T.* INFO foo"\].*`)
 }
 
+func (ts *taskSuite) TestTaskLogger(c *C) {
+	var buf bytes.Buffer
+	l, err := logger.NewJSON(&buf)
+	c.Assert(err, IsNil)
+	logger.SetLogger(l)
+	defer logger.SetLogger(logger.NullLogger)
+
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("download", "1...")
+	chg.AddTask(t)
+	t.Logger().Noticef("foo")
+
+	var entry map[string]string
+	c.Assert(json.Unmarshal(buf.Bytes(), &entry), IsNil)
+	c.Check(entry["msg"], Equals, "foo")
+	c.Check(entry["task-id"], Equals, t.ID())
+	c.Check(entry["task-kind"], Equals, "download")
+	c.Check(entry["change-id"], Equals, chg.ID())
+}
+
 // TODO: Better testing of full task roundtripping via JSON.
 
 func (cs *taskSuite) TestMethodEntrance(c *C) {
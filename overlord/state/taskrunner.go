@@ -24,8 +24,6 @@ import (
 	"time"
 
 	"gopkg.in/tomb.v2"
-
-	"github.com/snapcore/snapd/logger"
 )
 
 // HandlerFunc is the type of function for the handlers
@@ -268,7 +266,7 @@ func (r *TaskRunner) run(t *Task) {
 			t.SetStatus(ErrorStatus)
 			t.Errorf("%s", err)
 			// ensure the error is available in the global log too
-			logger.Noticef("[change %s %q task] failed: %v", t.Change().ID(), t.Summary(), err)
+			t.Logger().Noticef("[change %s %q task] failed: %v", t.Change().ID(), t.Summary(), err)
 			if r.taskErrorCallback != nil {
 				r.taskErrorCallback(err)
 			}
@@ -304,7 +302,7 @@ func (r *TaskRunner) clean(t *Task) {
 		delete(r.tombs, t.ID())
 
 		if tomb.Err() != nil {
-			logger.Debugf("Cleaning task %s: %s", t.ID(), tomb.Err())
+			t.Logger().Debugf("Cleaning task %s: %s", t.ID(), tomb.Err())
 		} else {
 			t.SetClean()
 		}
@@ -436,7 +434,7 @@ ConsiderTasks:
 			}
 		}
 
-		logger.Debugf("Running task %s on %s: %s", t.ID(), t.Status(), t.Summary())
+		t.Logger().Debugf("Running task %s on %s: %s", t.ID(), t.Status(), t.Summary())
 		r.run(t)
 
 		running = append(running, t)
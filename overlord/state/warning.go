@@ -202,6 +202,9 @@ func (s *State) addWarning(w Warning, t time.Time) {
 			return
 		}
 		s.warnings[w.message] = &w
+		w.lastAdded = t
+		s.notifyWarningAdded(&w)
+		return
 	}
 	s.warnings[w.message].lastAdded = t
 }
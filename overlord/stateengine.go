@@ -21,9 +21,12 @@ package overlord
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 
 	"github.com/snapcore/snapd/overlord/state"
 )
@@ -118,6 +121,14 @@ func (se *StateEngine) StartUp() error {
 	return nil
 }
 
+var ensureDurations = metrics.NewHistogram("snapd_ensure_duration_seconds", "Duration of the ensure calls, by manager.", nil, "manager")
+
+// managerName returns the name of the type of the manager, as in
+// "snapstate.SnapManager".
+func managerName(m StateManager) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", m), "*")
+}
+
 type ensureError struct {
 	errs []error
 }
@@ -145,7 +156,9 @@ func (se *StateEngine) Ensure() error {
 	}
 	var errs []error
 	for _, m := range se.managers {
+		start := time.Now()
 		err := m.Ensure()
+		ensureDurations.ObserveDuration(time.Since(start), managerName(m))
 		if err != nil {
 			logger.Noticef("state ensure error: %v", err)
 			errs = append(errs, err)
@@ -20,12 +20,15 @@
 package overlord_test
 
 import (
+	"bytes"
 	"errors"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/overlord"
 	"github.com/snapcore/snapd/overlord/state"
+	"github.com/snapcore/snapd/testutil"
 )
 
 type stateEngineSuite struct{}
@@ -107,6 +110,24 @@ func (ses *stateEngineSuite) TestStartUpError(c *C) {
 	c.Check(calls, DeepEquals, []string{"startup:mgr1", "startup:mgr2"})
 }
 
+func (ses *stateEngineSuite) TestEnsureMetrics(c *C) {
+	s := state.New(nil)
+	se := overlord.NewStateEngine(s)
+
+	calls := []string{}
+	se.AddManager(&fakeManager{name: "mgr1", calls: &calls})
+	c.Assert(se.StartUp(), IsNil)
+
+	var before bytes.Buffer
+	c.Assert(metrics.WriteTo(&before), IsNil)
+	c.Assert(se.Ensure(), IsNil)
+
+	var after bytes.Buffer
+	c.Assert(metrics.WriteTo(&after), IsNil)
+	c.Check(after.String(), testutil.Contains, `snapd_ensure_duration_seconds_count{manager="overlord_test.fakeManager"}`)
+	c.Check(after.String(), Not(Equals), before.String())
+}
+
 func (ses *stateEngineSuite) TestEnsure(c *C) {
 	s := state.New(nil)
 	se := overlord.NewStateEngine(s)
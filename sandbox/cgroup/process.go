@@ -22,6 +22,7 @@ package cgroup
 import (
 	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -66,3 +67,24 @@ func SnapNameFromPid(pid int) (string, error) {
 	}
 	return snapNameFromPidUsingFreezerCgroup(pid)
 }
+
+// UserOfPid returns the user ID of the session the given process was
+// started in, as recorded by its tracking cgroup.
+func UserOfPid(pid int) (int, error) {
+	path, err := ProcessPathInTrackingCgroup(pid)
+	if err != nil {
+		return -1, err
+	}
+	// user processes are tracked below their slice, as in
+	// /user.slice/user-1000.slice/user@1000.service/...
+	for _, component := range strings.Split(path, "/") {
+		if !strings.HasPrefix(component, "user-") || !strings.HasSuffix(component, ".slice") {
+			continue
+		}
+		uidStr := strings.TrimSuffix(strings.TrimPrefix(component, "user-"), ".slice")
+		if uid, err := strconv.Atoi(uidStr); err == nil {
+			return uid, nil
+		}
+	}
+	return -1, fmt.Errorf("cannot find the user of pid %v", pid)
+}
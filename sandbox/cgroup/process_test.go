@@ -73,3 +73,24 @@ func (s *cgroupSuite) TestSnapNameFromPidWithoutSources(c *C) {
 	c.Assert(err, ErrorMatches, "not supported")
 	c.Check(name, Equals, "")
 }
+
+func (s *cgroupSuite) TestUserOfPidTracking(c *C) {
+	pid := s.mockPidCgroup(c, "1:name=systemd:/user.slice/user-1000.slice/user@1000.service/apps.slice/snap.foo.bar.00000-1111-3333.scope\n")
+	uid, err := cgroup.UserOfPid(pid)
+	c.Assert(err, IsNil)
+	c.Check(uid, Equals, 1000)
+}
+
+func (s *cgroupSuite) TestUserOfPidSystem(c *C) {
+	pid := s.mockPidCgroup(c, "1:name=systemd:/system.slice/snap.foo.bar.service\n")
+	uid, err := cgroup.UserOfPid(pid)
+	c.Assert(err, ErrorMatches, "cannot find the user of pid 333")
+	c.Check(uid, Equals, -1)
+}
+
+func (s *cgroupSuite) TestUserOfPidNoTracking(c *C) {
+	pid := s.mockPidCgroup(c, "1:freezer:/snap.foo\n")
+	uid, err := cgroup.UserOfPid(pid)
+	c.Assert(err, ErrorMatches, "cannot find tracking cgroup")
+	c.Check(uid, Equals, -1)
+}
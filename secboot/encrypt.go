@@ -20,10 +20,12 @@
 package secboot
 
 import (
+	"bytes"
 	"crypto/rand"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 
 	"github.com/snapcore/snapd/osutil"
@@ -99,3 +101,42 @@ func RecoveryKeyFromFile(recoveryKeyFile string) (*RecoveryKey, error) {
 	}
 	return &rkey, nil
 }
+
+// RemoveRecoveryKey removes the keyslot holding the recovery key rkey from
+// the encrypted volume on the block device given by node.
+func RemoveRecoveryKey(rkey RecoveryKey, node string) error {
+	cmd := exec.Command("cryptsetup", "luksRemoveKey", "--batch-mode", "--key-file", "-", node)
+	cmd.Stdin = bytes.NewReader(rkey[:])
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot remove recovery key: %v", osutil.OutputErr(output, err))
+	}
+	return nil
+}
+
+// AddPassphrase adds a keyslot unlocked with the given passphrase to the
+// existing encrypted volume on the block device given by node. The
+// existing key to the encrypted volume is provided in the key argument.
+func AddPassphrase(key EncryptionKey, passphrase, node string) error {
+	if passphrase == "" {
+		return fmt.Errorf("cannot add an empty passphrase")
+	}
+	// pass the new passphrase using a pipe so that it never hits the disk
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := w.Write([]byte(passphrase)); err != nil {
+		w.Close()
+		return err
+	}
+	w.Close()
+
+	cmd := exec.Command("cryptsetup", "luksAddKey", "--batch-mode", "--key-file", "-", node, "/dev/fd/3")
+	cmd.Stdin = bytes.NewReader(key[:])
+	cmd.ExtraFiles = []*os.File{r}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cannot add passphrase: %v", osutil.OutputErr(output, err))
+	}
+	return nil
+}
@@ -21,6 +21,7 @@
 package secboot_test
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -81,3 +82,53 @@ func (s *encryptSuite) TestEncryptionKeySave(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(di.Mode().Perm(), Equals, os.FileMode(0755))
 }
+
+func (s *encryptSuite) TestRemoveRecoveryKey(c *C) {
+	stdin := filepath.Join(s.dir, "stdin")
+	cmd := testutil.MockCommand(c, "cryptsetup", fmt.Sprintf("cat > %s", stdin))
+	defer cmd.Restore()
+
+	rkey := secboot.RecoveryKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}
+	err := secboot.RemoveRecoveryKey(rkey, "/dev/node")
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"cryptsetup", "luksRemoveKey", "--batch-mode", "--key-file", "-", "/dev/node"},
+	})
+	c.Check(stdin, testutil.FileEquals, rkey[:])
+}
+
+func (s *encryptSuite) TestRemoveRecoveryKeyError(c *C) {
+	cmd := testutil.MockCommand(c, "cryptsetup", "echo 'No key available with this passphrase.'; exit 2")
+	defer cmd.Restore()
+
+	err := secboot.RemoveRecoveryKey(secboot.RecoveryKey{}, "/dev/node")
+	c.Assert(err, ErrorMatches, "cannot remove recovery key: No key available with this passphrase.")
+}
+
+func (s *encryptSuite) TestAddPassphrase(c *C) {
+	stdin := filepath.Join(s.dir, "stdin")
+	newKey := filepath.Join(s.dir, "new-key")
+	cmd := testutil.MockCommand(c, "cryptsetup", fmt.Sprintf("cat > %s; cat \"$6\" > %s", stdin, newKey))
+	defer cmd.Restore()
+
+	key := secboot.EncryptionKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 255}
+	err := secboot.AddPassphrase(key, "my passphrase", "/dev/node")
+	c.Assert(err, IsNil)
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"cryptsetup", "luksAddKey", "--batch-mode", "--key-file", "-", "/dev/node", "/dev/fd/3"},
+	})
+	c.Check(stdin, testutil.FileEquals, key[:])
+	c.Check(newKey, testutil.FileEquals, "my passphrase")
+}
+
+func (s *encryptSuite) TestAddPassphraseError(c *C) {
+	cmd := testutil.MockCommand(c, "cryptsetup", "echo 'No key available with this passphrase.'; exit 2")
+	defer cmd.Restore()
+
+	err := secboot.AddPassphrase(secboot.EncryptionKey{}, "my passphrase", "/dev/node")
+	c.Assert(err, ErrorMatches, "cannot add passphrase: No key available with this passphrase.")
+
+	err = secboot.AddPassphrase(secboot.EncryptionKey{}, "", "/dev/node")
+	c.Assert(err, ErrorMatches, "cannot add an empty passphrase")
+	c.Check(cmd.Calls(), HasLen, 1)
+}
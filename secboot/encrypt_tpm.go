@@ -52,6 +52,14 @@ func AddRecoveryKey(key EncryptionKey, rkey RecoveryKey, node string) error {
 	return sbAddRecoveryKeyToLUKS2Container(node, key[:], sb.RecoveryKey(rkey))
 }
 
+// AddRecoveryKeyUsingRecoveryKey adds the recovery key rkey to the existing
+// encrypted volume on the block device given by node. The change is
+// authorized with the recovery key already present in the volume, provided
+// in the existing argument.
+func AddRecoveryKeyUsingRecoveryKey(existing, rkey RecoveryKey, node string) error {
+	return sbAddRecoveryKeyToLUKS2Container(node, existing[:], sb.RecoveryKey(rkey))
+}
+
 func (k RecoveryKey) String() string {
 	return sb.RecoveryKey(k).String()
 }
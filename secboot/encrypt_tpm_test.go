@@ -103,3 +103,22 @@ func (s *encryptSuite) TestAddRecoveryKey(c *C) {
 		}
 	}
 }
+
+func (s *encryptSuite) TestAddRecoveryKeyUsingRecoveryKey(c *C) {
+	myExistingKey := secboot.RecoveryKey{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	myRecoveryKey := secboot.RecoveryKey{15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0}
+
+	calls := 0
+	restore := secboot.MockSbAddRecoveryKeyToLUKS2Container(func(devicePath string, key []byte, recoveryKey sb.RecoveryKey) error {
+		calls++
+		c.Assert(devicePath, Equals, "/dev/node")
+		c.Assert(recoveryKey[:], DeepEquals, myRecoveryKey[:])
+		c.Assert(key, DeepEquals, myExistingKey[:])
+		return nil
+	})
+	defer restore()
+
+	err := secboot.AddRecoveryKeyUsingRecoveryKey(myExistingKey, myRecoveryKey, "/dev/node")
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 1)
+}
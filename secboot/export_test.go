@@ -30,6 +30,7 @@ import (
 var (
 	EFIImageFromBootFile = efiImageFromBootFile
 	LockTPMSealedKeys    = lockTPMSealedKeys
+	AskPassword          = askPassword
 )
 
 func MockSbConnectToDefaultTPM(f func() (*sb.TPMConnection, error)) (restore func()) {
@@ -96,6 +97,38 @@ func MockSbUpdateKeyPCRProtectionPolicyMultiple(f func(tpm *sb.TPMConnection, ke
 	}
 }
 
+func MockSbChangePIN(f func(tpm *sb.TPMConnection, path string, oldPIN, newPIN string) error) (restore func()) {
+	old := sbChangePIN
+	sbChangePIN = f
+	return func() {
+		sbChangePIN = old
+	}
+}
+
+func MockSbGetDiskUnlockKeyFromKernel(f func(prefix, devicePath string, remove bool) (sb.DiskUnlockKey, error)) (restore func()) {
+	old := sbGetDiskUnlockKeyFromKernel
+	sbGetDiskUnlockKeyFromKernel = f
+	return func() {
+		sbGetDiskUnlockKeyFromKernel = old
+	}
+}
+
+func MockReleaseNVIndex(f func(tpm *sb.TPMConnection, handle uint32) error) (restore func()) {
+	old := releaseNVIndex
+	releaseNVIndex = f
+	return func() {
+		releaseNVIndex = old
+	}
+}
+
+func MockAskPassword(f func(device, msg string) (string, error)) (restore func()) {
+	old := askPassword
+	askPassword = f
+	return func() {
+		askPassword = old
+	}
+}
+
 func MockSbBlockPCRProtectionPolicies(f func(tpm *sb.TPMConnection, pcrs []int) error) (restore func()) {
 	old := sbBlockPCRProtectionPolicies
 	sbBlockPCRProtectionPolicies = f
@@ -35,6 +35,11 @@ const (
 	// Handles are in the block reserved for TPM owner objects (0x01800000 - 0x01bfffff)
 	RunObjectPCRPolicyCounterHandle      = 0x01880001
 	FallbackObjectPCRPolicyCounterHandle = 0x01880002
+	// Alternative handles used for the keys sealed during factory reset,
+	// while the keys of the previous installation still hold the ones
+	// above (or the other way around)
+	AltRunObjectPCRPolicyCounterHandle      = 0x01880003
+	AltFallbackObjectPCRPolicyCounterHandle = 0x01880004
 )
 
 type LoadChain struct {
@@ -85,6 +90,9 @@ type SealKeysParams struct {
 	TPMProvision bool
 	// The handle at which to create a NV index for dynamic authorization policy revocation support
 	PCRPolicyCounterHandle uint32
+	// The PIN required in addition to the TPM policy to unseal the keys,
+	// if empty no PIN is set (only relevant for TPM)
+	PIN string
 }
 
 type ResealKeysParams struct {
@@ -102,6 +110,20 @@ type UnlockVolumeUsingSealedKeyOptions struct {
 	// AllowRecoveryKey when true indicates activation with the recovery key
 	// will be attempted if activation with the sealed key failed.
 	AllowRecoveryKey bool
+	// PINTries is the number of times the user is prompted for the PIN
+	// when the key was sealed with a PIN. Defaults to 1.
+	PINTries int
+}
+
+// UnlockVolumeUsingPassphraseOptions contains options for unlocking
+// encrypted volumes using a passphrase provided by the user.
+type UnlockVolumeUsingPassphraseOptions struct {
+	// Tries is the number of times the user is prompted for the
+	// passphrase. Defaults to 1.
+	Tries int
+	// AllowRecoveryKey when true indicates activation with the recovery key
+	// will be attempted if activation with the passphrase failed.
+	AllowRecoveryKey bool
 }
 
 // UnlockMethod is the method that was used to unlock a volume.
@@ -122,6 +144,9 @@ const (
 	UnlockedWithKey
 	// UnlockStatusUnknown indicates that the unlock status of the device is not clear.
 	UnlockStatusUnknown
+	// UnlockedWithPassphrase indicates that the device was unlocked by the
+	// user providing the passphrase at the prompt.
+	UnlockedWithPassphrase
 )
 
 // UnlockResult is the result of trying to unlock a volume.
@@ -141,6 +166,7 @@ type UnlockResult struct {
 	// - UnlockedWithRecoveryKey
 	// - UnlockedWithSealedKey
 	// - UnlockedWithKey
+	// - UnlockedWithPassphrase
 	UnlockMethod UnlockMethod
 }
 
@@ -35,3 +35,23 @@ func SealKeys(keys []SealKeyRequest, params *SealKeysParams) error {
 func ResealKeys(params *ResealKeysParams) error {
 	return fmt.Errorf("build without secboot support")
 }
+
+func AddRecoveryKey(key EncryptionKey, rkey RecoveryKey, node string) error {
+	return fmt.Errorf("build without secboot support")
+}
+
+func AddRecoveryKeyUsingRecoveryKey(existing, rkey RecoveryKey, node string) error {
+	return fmt.Errorf("build without secboot support")
+}
+
+func PCRHandleOfSealedKey(p string) (uint32, error) {
+	return 0, fmt.Errorf("build without secboot support")
+}
+
+func ReleasePCRResourceHandles(handles ...uint32) error {
+	return fmt.Errorf("build without secboot support")
+}
+
+func DiskUnlockKeyFromKernel(devicePath string) (EncryptionKey, error) {
+	return EncryptionKey{}, fmt.Errorf("build without secboot support")
+}
@@ -30,6 +30,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/canonical/go-tpm2"
@@ -65,6 +66,9 @@ var (
 	sbAddSnapModelProfile                  = sb.AddSnapModelProfile
 	sbSealKeyToTPMMultiple                 = sb.SealKeyToTPMMultiple
 	sbUpdateKeyPCRProtectionPolicyMultiple = sb.UpdateKeyPCRProtectionPolicyMultiple
+	sbChangePIN                            = sb.ChangePIN
+	sbReadSealedKeyObject                  = sb.ReadSealedKeyObject
+	sbGetDiskUnlockKeyFromKernel           = sb.GetDiskUnlockKeyFromKernel
 
 	randutilRandomKernelUUID = randutil.RandomKernelUUID
 
@@ -502,7 +506,7 @@ func unlockVolumeUsingSealedKeySecboot(name, sealedEncryptionKeyFile, sourceDevi
 
 	// otherwise we have a tpm and we should use the sealed key first, but
 	// this method will fallback to using the recovery key if enabled
-	method, err := unlockEncryptedPartitionWithSealedKey(tpm, mapperName, sourceDevice, sealedEncryptionKeyFile, "", opts.AllowRecoveryKey)
+	method, err := unlockEncryptedPartitionWithSealedKey(tpm, mapperName, sourceDevice, sealedEncryptionKeyFile, opts)
 	res.UnlockMethod = method
 	if err == nil {
 		res.FsDevice = targetDevice
@@ -539,6 +543,66 @@ func UnlockEncryptedVolumeUsingKey(disk disks.Disk, name string, key []byte) (Un
 	return unlockRes, nil
 }
 
+// askPassword prompts the user for a password for the given device
+// using systemd-ask-password.
+var askPassword = func(device, msg string) (string, error) {
+	cmd := exec.Command("systemd-ask-password", "--icon", "drive-harddisk", "--id", "snapd:"+device, msg)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot execute systemd-ask-password: %v", osutil.OutputErr(output, err))
+	}
+	return strings.TrimSuffix(string(output), "\n"), nil
+}
+
+// UnlockEncryptedVolumeUsingPassphrase prompts for the passphrase of the
+// encrypted volume with the given name on the disk and uses it to unlock
+// the volume. The options control how many times the user is prompted and
+// whether the recovery key is asked for once all the attempts failed.
+func UnlockEncryptedVolumeUsingPassphrase(disk disks.Disk, name string, opts *UnlockVolumeUsingPassphraseOptions) (UnlockResult, error) {
+	unlockRes := UnlockResult{
+		UnlockMethod: NotUnlocked,
+	}
+	partUUID, err := disk.FindMatchingPartitionUUIDWithFsLabel(name + "-enc")
+	if err != nil {
+		return unlockRes, err
+	}
+	unlockRes.IsEncrypted = true
+	encdev := filepath.Join("/dev/disk/by-partuuid", partUUID)
+	unlockRes.PartDevice = encdev
+	mapperName := name + "-" + randutilRandomKernelUUID()
+	targetDevice := filepath.Join("/dev/mapper", mapperName)
+
+	tries := opts.Tries
+	if tries < 1 {
+		tries = 1
+	}
+	var lastErr error
+	for i := 0; i < tries; i++ {
+		passphrase, err := askPassword(encdev, fmt.Sprintf("Please enter the passphrase for volume %s for device %s:", name, encdev))
+		if err != nil {
+			lastErr = err
+			break
+		}
+		lastErr = unlockEncryptedPartitionWithKey(mapperName, encdev, []byte(passphrase))
+		if lastErr == nil {
+			unlockRes.FsDevice = targetDevice
+			unlockRes.UnlockMethod = UnlockedWithPassphrase
+			return unlockRes, nil
+		}
+		logger.Noticef("cannot activate encrypted device %q with the passphrase: %v", encdev, lastErr)
+	}
+
+	if !opts.AllowRecoveryKey {
+		return unlockRes, fmt.Errorf("cannot unlock encrypted device %q with the passphrase: %v", encdev, lastErr)
+	}
+	if err := UnlockEncryptedVolumeWithRecoveryKey(mapperName, encdev); err != nil {
+		return unlockRes, err
+	}
+	unlockRes.FsDevice = targetDevice
+	unlockRes.UnlockMethod = UnlockedWithRecoveryKey
+	return unlockRes, nil
+}
+
 // UnlockEncryptedVolumeWithRecoveryKey prompts for the recovery key and uses it
 // to open an encrypted device.
 func UnlockEncryptedVolumeWithRecoveryKey(name, device string) error {
@@ -571,19 +635,23 @@ func isActivatedWithRecoveryKey(err error) bool {
 // unlockEncryptedPartitionWithSealedKey unseals the keyfile and opens an encrypted
 // device. If activation with the sealed key fails, this function will attempt to
 // activate it with the fallback recovery key instead.
-func unlockEncryptedPartitionWithSealedKey(tpm *sb.TPMConnection, name, device, keyfile, pinfile string, allowRecovery bool) (UnlockMethod, error) {
+func unlockEncryptedPartitionWithSealedKey(tpm *sb.TPMConnection, name, device, keyfile string, opts *UnlockVolumeUsingSealedKeyOptions) (UnlockMethod, error) {
 	options := sb.ActivateVolumeOptions{
 		PassphraseTries: 1,
 		// disable recovery key by default
 		RecoveryKeyTries: 0,
 		KeyringPrefix:    keyringPrefix,
 	}
-	if allowRecovery {
+	if opts.PINTries > 0 {
+		// the PIN, if the key was sealed with one, is asked for by
+		// secboot using systemd-ask-password
+		options.PassphraseTries = opts.PINTries
+	}
+	if opts.AllowRecoveryKey {
 		// enable recovery key only when explicitly allowed
 		options.RecoveryKeyTries = 3
 	}
 
-	// XXX: pinfile is currently not used
 	activated, err := sbActivateVolumeWithTPMSealedKey(tpm, name, device, keyfile, nil, &options)
 
 	if activated {
@@ -664,6 +732,13 @@ func SealKeys(keys []SealKeyRequest, params *SealKeysParams) error {
 	if err != nil {
 		return err
 	}
+	if params.PIN != "" {
+		for _, k := range sbKeys {
+			if err := sbChangePIN(tpm, k.Path, "", params.PIN); err != nil {
+				return fmt.Errorf("cannot set the PIN of the sealed key file: %v", err)
+			}
+		}
+	}
 	if params.TPMPolicyAuthKeyFile != "" {
 		if err := osutil.AtomicWriteFile(params.TPMPolicyAuthKeyFile, authKey, 0600, 0); err != nil {
 			return fmt.Errorf("cannot write the policy auth key file: %v", err)
@@ -673,6 +748,67 @@ func SealKeys(keys []SealKeyRequest, params *SealKeysParams) error {
 	return nil
 }
 
+// PCRHandleOfSealedKey returns the handle of the PCR policy counter used by
+// the given sealed key file.
+func PCRHandleOfSealedKey(p string) (uint32, error) {
+	sko, err := sbReadSealedKeyObject(p)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read sealed key file: %v", err)
+	}
+	return uint32(sko.PCRPolicyCounterHandle()), nil
+}
+
+var releaseNVIndex = func(tpm *sb.TPMConnection, handle uint32) error {
+	rc, err := tpm.CreateResourceContextFromTPM(tpm2.Handle(handle))
+	if err != nil {
+		if tpm2.IsResourceUnavailableError(err, tpm2.Handle(handle)) {
+			// the handle is not defined, nothing to release
+			return nil
+		}
+		return err
+	}
+	return tpm.NVUndefineSpace(tpm.OwnerHandleContext(), rc, tpm.HmacSession())
+}
+
+// ReleasePCRResourceHandles releases the PCR policy counters at the given
+// handles, skipping the ones which are not defined.
+func ReleasePCRResourceHandles(handles ...uint32) error {
+	tpm, err := sbConnectToDefaultTPM()
+	if err != nil {
+		return fmt.Errorf("cannot connect to TPM: %v", err)
+	}
+	defer tpm.Close()
+
+	var errs []string
+	for _, handle := range handles {
+		logger.Debugf("releasing PCR policy counter handle %#x", handle)
+		if err := releaseNVIndex(tpm, handle); err != nil {
+			errs = append(errs, fmt.Sprintf("handle %#x: %v", handle, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot release PCR policy counter handles: %v", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// DiskUnlockKeyFromKernel returns the key used to unlock the given encrypted
+// device during boot, as left in the kernel keyring when activating the
+// device with a sealed key.
+func DiskUnlockKeyFromKernel(devicePath string) (EncryptionKey, error) {
+	var key EncryptionKey
+	unlockKey, err := sbGetDiskUnlockKeyFromKernel(keyringPrefix, devicePath, false)
+	if err != nil {
+		return key, fmt.Errorf("cannot get the unlock key of %v from the kernel keyring: %v", devicePath, err)
+	}
+	if len(unlockKey) != len(key) {
+		// most likely the device was unlocked with the recovery key
+		return key, fmt.Errorf("cannot use the unlock key of %v: unexpected key size %v", devicePath, len(unlockKey))
+	}
+	copy(key[:], unlockKey)
+	return key, nil
+}
+
 // ResealKeys updates the PCR protection policy for the sealed encryption keys
 // according to the specified parameters.
 func ResealKeys(params *ResealKeysParams) error {
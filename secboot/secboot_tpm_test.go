@@ -623,8 +623,11 @@ func (s *secbootSuite) TestSealKey(c *C) {
 		addSnapModelErr      error
 		provisioningErr      error
 		sealErr              error
+		pin                  string
+		changePINErr         error
 		provisioningCalls    int
 		sealCalls            int
+		changePINCalls       int
 		expectedErr          string
 	}{
 		{tpmErr: mockErr, expectedErr: "cannot connect to TPM: some error"},
@@ -639,6 +642,8 @@ func (s *secbootSuite) TestSealKey(c *C) {
 		{tpmEnabled: true, sealErr: mockErr, provisioningCalls: 1, sealCalls: 1, expectedErr: "some error"},
 		{tpmEnabled: true, skipProvision: true, provisioningCalls: 0, sealCalls: 1, expectedErr: ""},
 		{tpmEnabled: true, provisioningCalls: 1, sealCalls: 1, expectedErr: ""},
+		{tpmEnabled: true, pin: "1234", provisioningCalls: 1, sealCalls: 1, changePINCalls: 2, expectedErr: ""},
+		{tpmEnabled: true, pin: "1234", changePINErr: mockErr, provisioningCalls: 1, sealCalls: 1, changePINCalls: 1, expectedErr: "cannot set the PIN of the sealed key file: some error"},
 	} {
 		tmpDir := c.MkDir()
 		var mockBF []bootloader.BootFile
@@ -700,6 +705,7 @@ func (s *secbootSuite) TestSealKey(c *C) {
 			TPMLockoutAuthFile:     filepath.Join(tmpDir, "lockout-auth-file"),
 			TPMProvision:           !tc.skipProvision,
 			PCRPolicyCounterHandle: 42,
+			PIN:                    tc.pin,
 		}
 
 		myKey := secboot.EncryptionKey{}
@@ -890,6 +896,18 @@ func (s *secbootSuite) TestSealKey(c *C) {
 		})
 		defer restore()
 
+		// mock setting the PIN
+		changePINCalls := 0
+		restore = secboot.MockSbChangePIN(func(t *sb.TPMConnection, path string, oldPIN, newPIN string) error {
+			changePINCalls++
+			c.Assert(t, Equals, tpm)
+			c.Assert(path, Equals, []string{"keyfile", "keyfile2"}[changePINCalls-1])
+			c.Assert(oldPIN, Equals, "")
+			c.Assert(newPIN, Equals, tc.pin)
+			return tc.changePINErr
+		})
+		defer restore()
+
 		// mock TPM enabled check
 		restore = secboot.MockIsTPMEnabled(func(t *sb.TPMConnection) bool {
 			return tc.tpmEnabled
@@ -908,7 +926,7 @@ func (s *secbootSuite) TestSealKey(c *C) {
 		}
 		c.Assert(provisioningCalls, Equals, tc.provisioningCalls)
 		c.Assert(sealCalls, Equals, tc.sealCalls)
-
+		c.Assert(changePINCalls, Equals, tc.changePINCalls)
 	}
 }
 
@@ -1159,6 +1177,170 @@ func (s *secbootSuite) TestUnlockEncryptedVolumeUsingKeyErr(c *C) {
 	})
 }
 
+func (s *secbootSuite) TestUnlockVolumeUsingSealedKeyIfEncryptedPINTries(c *C) {
+	disk := &disks.MockDiskMapping{
+		FilesystemLabelToPartUUID: map[string]string{
+			"name-enc": "enc-dev-partuuid",
+		},
+	}
+	restore := secboot.MockRandomKernelUUID(func() string {
+		return "random-uuid-123-123"
+	})
+	defer restore()
+	_, restore = mockSbTPMConnection(c, nil)
+	defer restore()
+	restore = secboot.MockIsTPMEnabled(func(tpm *sb.TPMConnection) bool {
+		return true
+	})
+	defer restore()
+	restore = secboot.MockSbActivateVolumeWithTPMSealedKey(func(tpm *sb.TPMConnection, volumeName, sourceDevicePath,
+		keyPath string, pinReader io.Reader, options *sb.ActivateVolumeOptions) (bool, error) {
+		c.Check(pinReader, IsNil)
+		c.Check(*options, DeepEquals, sb.ActivateVolumeOptions{
+			PassphraseTries:  3,
+			RecoveryKeyTries: 3,
+			KeyringPrefix:    "ubuntu-fde",
+		})
+		return true, nil
+	})
+	defer restore()
+
+	opts := &secboot.UnlockVolumeUsingSealedKeyOptions{
+		AllowRecoveryKey: true,
+		PINTries:         3,
+	}
+	unlockRes, err := secboot.UnlockVolumeUsingSealedKeyIfEncrypted(disk, "name", "keyfile", opts)
+	c.Assert(err, IsNil)
+	c.Check(unlockRes.UnlockMethod, Equals, secboot.UnlockedWithSealedKey)
+}
+
+func (s *secbootSuite) TestUnlockEncryptedVolumeUsingPassphrase(c *C) {
+	disk := &disks.MockDiskMapping{
+		FilesystemLabelToPartUUID: map[string]string{
+			"ubuntu-data-enc": "123-123-123",
+		},
+	}
+	restore := secboot.MockRandomKernelUUID(func() string {
+		return "random-uuid-123-123"
+	})
+	defer restore()
+
+	for _, tc := range []struct {
+		tries       int
+		rkAllow     bool
+		passphrases []string
+		askErr      error
+		rkErr       error
+
+		expAsked        int
+		expUnlockMethod secboot.UnlockMethod
+		expErr          string
+	}{
+		{
+			// good passphrase at first try
+			tries: 3, passphrases: []string{"good"},
+			expAsked: 1, expUnlockMethod: secboot.UnlockedWithPassphrase,
+		}, {
+			// good passphrase at last try
+			tries: 3, passphrases: []string{"bad", "bad", "good"},
+			expAsked: 3, expUnlockMethod: secboot.UnlockedWithPassphrase,
+		}, {
+			// tries default to 1
+			passphrases: []string{"bad", "good"},
+			expAsked:    1, expUnlockMethod: secboot.NotUnlocked,
+			expErr: `cannot unlock encrypted device "/dev/disk/by-partuuid/123-123-123" with the passphrase: bad passphrase`,
+		}, {
+			// all tries fail, fallback to the recovery key
+			tries: 2, rkAllow: true, passphrases: []string{"bad", "bad", "good"},
+			expAsked: 2, expUnlockMethod: secboot.UnlockedWithRecoveryKey,
+		}, {
+			// all tries fail, recovery key fails too
+			tries: 2, rkAllow: true, passphrases: []string{"bad", "bad"}, rkErr: errors.New("bad recovery key"),
+			expAsked: 2, expUnlockMethod: secboot.NotUnlocked,
+			expErr: `cannot unlock encrypted device "/dev/disk/by-partuuid/123-123-123": bad recovery key`,
+		}, {
+			// prompting fails
+			tries: 3, askErr: errors.New("cannot ask"),
+			expAsked: 1, expUnlockMethod: secboot.NotUnlocked,
+			expErr: `cannot unlock encrypted device "/dev/disk/by-partuuid/123-123-123" with the passphrase: cannot ask`,
+		},
+	} {
+		asked := 0
+		restore := secboot.MockAskPassword(func(device, msg string) (string, error) {
+			asked++
+			c.Check(device, Equals, "/dev/disk/by-partuuid/123-123-123")
+			c.Check(msg, Equals, "Please enter the passphrase for volume ubuntu-data for device /dev/disk/by-partuuid/123-123-123:")
+			if tc.askErr != nil {
+				return "", tc.askErr
+			}
+			return tc.passphrases[asked-1], nil
+		})
+		defer restore()
+		restore = secboot.MockSbActivateVolumeWithKey(func(volumeName, sourceDevicePath string, key []byte,
+			options *sb.ActivateVolumeOptions) error {
+			c.Check(volumeName, Equals, "ubuntu-data-random-uuid-123-123")
+			c.Check(sourceDevicePath, Equals, "/dev/disk/by-partuuid/123-123-123")
+			if string(key) != "good" {
+				return errors.New("bad passphrase")
+			}
+			return nil
+		})
+		defer restore()
+		rkCalls := 0
+		restore = secboot.MockSbActivateVolumeWithRecoveryKey(func(name, device string, keyReader io.Reader,
+			options *sb.ActivateVolumeOptions) error {
+			rkCalls++
+			c.Check(name, Equals, "ubuntu-data-random-uuid-123-123")
+			c.Check(options.RecoveryKeyTries, Equals, 3)
+			return tc.rkErr
+		})
+		defer restore()
+
+		opts := &secboot.UnlockVolumeUsingPassphraseOptions{
+			Tries:            tc.tries,
+			AllowRecoveryKey: tc.rkAllow,
+		}
+		unlockRes, err := secboot.UnlockEncryptedVolumeUsingPassphrase(disk, "ubuntu-data", opts)
+		if tc.expErr == "" {
+			c.Assert(err, IsNil)
+			c.Check(unlockRes.FsDevice, Equals, "/dev/mapper/ubuntu-data-random-uuid-123-123")
+		} else {
+			c.Assert(err, ErrorMatches, tc.expErr)
+			c.Check(unlockRes.FsDevice, Equals, "")
+		}
+		c.Check(unlockRes.IsEncrypted, Equals, true)
+		c.Check(unlockRes.PartDevice, Equals, "/dev/disk/by-partuuid/123-123-123")
+		c.Check(unlockRes.UnlockMethod, Equals, tc.expUnlockMethod)
+		c.Check(asked, Equals, tc.expAsked)
+		if tc.rkAllow {
+			c.Check(rkCalls, Equals, 1)
+		} else {
+			c.Check(rkCalls, Equals, 0)
+		}
+	}
+}
+
+func (s *secbootSuite) TestUnlockEncryptedVolumeUsingPassphraseBadDisk(c *C) {
+	disk := &disks.MockDiskMapping{
+		FilesystemLabelToPartUUID: map[string]string{},
+	}
+	unlockRes, err := secboot.UnlockEncryptedVolumeUsingPassphrase(disk, "ubuntu-data", &secboot.UnlockVolumeUsingPassphraseOptions{})
+	c.Assert(err, ErrorMatches, `filesystem label "ubuntu-data-enc" not found`)
+	c.Check(unlockRes, DeepEquals, secboot.UnlockResult{})
+}
+
+func (s *secbootSuite) TestAskPassword(c *C) {
+	cmd := testutil.MockCommand(c, "systemd-ask-password", "echo 'my passphrase'")
+	defer cmd.Restore()
+
+	passphrase, err := secboot.AskPassword("/dev/node", "Please enter:")
+	c.Assert(err, IsNil)
+	c.Check(passphrase, Equals, "my passphrase")
+	c.Check(cmd.Calls(), DeepEquals, [][]string{
+		{"systemd-ask-password", "--icon", "drive-harddisk", "--id", "snapd:/dev/node", "Please enter:"},
+	})
+}
+
 func (s *secbootSuite) TestUnlockVolumeUsingSealedKeyIfEncryptedFdeRevealKeyTruncatesStreamFiles(c *C) {
 	// this test uses a real systemd-run --user so check here if that
 	// actually works
@@ -1445,3 +1627,73 @@ func (s *secbootSuite) TestLockSealedKeysHonorsParanoia(c *C) {
 	err := secboot.LockSealedKeys()
 	c.Assert(err, ErrorMatches, `cannot run fde-reveal-key "lock": internal error: systemd-run did not honor RuntimeMax=1ms setting`)
 }
+
+func (s *secbootSuite) TestPCRHandleOfSealedKeyError(c *C) {
+	_, err := secboot.PCRHandleOfSealedKey(filepath.Join(c.MkDir(), "missing.sealed-key"))
+	c.Assert(err, ErrorMatches, "cannot read sealed key file: .*")
+}
+
+func (s *secbootSuite) TestReleasePCRResourceHandles(c *C) {
+	mockTpm, restore := mockSbTPMConnection(c, nil)
+	defer restore()
+
+	var released []uint32
+	restore = secboot.MockReleaseNVIndex(func(tpm *sb.TPMConnection, handle uint32) error {
+		c.Check(tpm, Equals, mockTpm)
+		released = append(released, handle)
+		if handle == secboot.AltFallbackObjectPCRPolicyCounterHandle {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	defer restore()
+
+	err := secboot.ReleasePCRResourceHandles(secboot.AltRunObjectPCRPolicyCounterHandle)
+	c.Assert(err, IsNil)
+	c.Check(released, DeepEquals, []uint32{secboot.AltRunObjectPCRPolicyCounterHandle})
+
+	released = nil
+	err = secboot.ReleasePCRResourceHandles(secboot.AltRunObjectPCRPolicyCounterHandle, secboot.AltFallbackObjectPCRPolicyCounterHandle)
+	c.Assert(err, ErrorMatches, "cannot release PCR policy counter handles: handle 0x1880004: boom")
+	// all handles are attempted
+	c.Check(released, DeepEquals, []uint32{secboot.AltRunObjectPCRPolicyCounterHandle, secboot.AltFallbackObjectPCRPolicyCounterHandle})
+}
+
+func (s *secbootSuite) TestReleasePCRResourceHandlesNoTPM(c *C) {
+	_, restore := mockSbTPMConnection(c, errors.New("no tpm"))
+	defer restore()
+
+	err := secboot.ReleasePCRResourceHandles(secboot.RunObjectPCRPolicyCounterHandle)
+	c.Assert(err, ErrorMatches, "cannot connect to TPM: no tpm")
+}
+
+func (s *secbootSuite) TestDiskUnlockKeyFromKernel(c *C) {
+	var unlockKey sb.DiskUnlockKey
+	var unlockErr error
+	restore := secboot.MockSbGetDiskUnlockKeyFromKernel(func(prefix, devicePath string, remove bool) (sb.DiskUnlockKey, error) {
+		c.Check(prefix, Equals, "ubuntu-fde")
+		c.Check(devicePath, Equals, "/dev/disk/by-partuuid/save-partuuid")
+		c.Check(remove, Equals, false)
+		return unlockKey, unlockErr
+	})
+	defer restore()
+
+	var expectedKey secboot.EncryptionKey
+	for i := range expectedKey {
+		expectedKey[i] = byte(i)
+	}
+	unlockKey = sb.DiskUnlockKey(expectedKey[:])
+	key, err := secboot.DiskUnlockKeyFromKernel("/dev/disk/by-partuuid/save-partuuid")
+	c.Assert(err, IsNil)
+	c.Check(key, DeepEquals, expectedKey)
+
+	// the recovery key was used to unlock the device
+	unlockKey = sb.DiskUnlockKey(make([]byte, 16))
+	_, err = secboot.DiskUnlockKeyFromKernel("/dev/disk/by-partuuid/save-partuuid")
+	c.Assert(err, ErrorMatches, "cannot use the unlock key of /dev/disk/by-partuuid/save-partuuid: unexpected key size 16")
+
+	unlockKey = nil
+	unlockErr = errors.New("not found")
+	_, err = secboot.DiskUnlockKeyFromKernel("/dev/disk/by-partuuid/save-partuuid")
+	c.Assert(err, ErrorMatches, "cannot get the unlock key of /dev/disk/by-partuuid/save-partuuid from the kernel keyring: not found")
+}
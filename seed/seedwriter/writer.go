@@ -44,6 +44,12 @@ type Options struct {
 	// The label for the recovery system for Core20 models
 	Label string
 
+	// ValidationSets are references to validation-set assertions,
+	// with explicit sequences, that the seed snaps must satisfy. They
+	// are fetched together with the model assertion and fix the
+	// revisions of the snaps to download.
+	ValidationSets []*asserts.Ref
+
 	// TestSkipCopyUnverifiedModel is set to support naive tests
 	// using an unverified model, the resulting image is broken
 	TestSkipCopyUnverifiedModel bool
@@ -75,6 +81,9 @@ type SeedSnap struct {
 	naming.SnapRef
 	Channel string
 	Path    string
+	// Revision is the revision the snap must be fetched at if
+	// required by the validation sets, it is unset otherwise.
+	Revision snap.Revision
 
 	// Info is the *snap.Info for the seed snap, filling this is
 	// delegated to the Writer using code, via Writer.SetInfo.
@@ -168,6 +177,8 @@ type Writer struct {
 
 	modelRefs []*asserts.Ref
 
+	vsets *snapasserts.ValidationSets
+
 	optionsSnaps []*OptionsSnap
 	// consumedOptSnapNum counts which options snaps have been consumed
 	// by either cross matching or matching with a model snap
@@ -456,6 +467,10 @@ func (w *Writer) Start(db asserts.RODatabase, newFetcher NewFetcherFunc) (RefAss
 		}
 	}
 
+	if err := w.fetchValidationSets(f); err != nil {
+		return nil, err
+	}
+
 	w.modelRefs = f.Refs()
 
 	if err := w.tree.mkFixedDirs(); err != nil {
@@ -465,6 +480,33 @@ func (w *Writer) Start(db asserts.RODatabase, newFetcher NewFetcherFunc) (RefAss
 	return f, nil
 }
 
+func (w *Writer) fetchValidationSets(f asserts.Fetcher) error {
+	if len(w.opts.ValidationSets) == 0 {
+		return nil
+	}
+	vsets := snapasserts.NewValidationSets()
+	for _, ref := range w.opts.ValidationSets {
+		if ref.Type != asserts.ValidationSetType {
+			return fmt.Errorf("internal error: expected validation-set reference, got %v", ref)
+		}
+		if err := f.Fetch(ref); err != nil {
+			return fmt.Errorf("cannot fetch validation set %s: %v", strings.Join(ref.PrimaryKey[1:], "/"), err)
+		}
+		a, err := ref.Resolve(w.db.Find)
+		if err != nil {
+			return fmt.Errorf("internal error: lost saved assertion")
+		}
+		if err := vsets.Add(a.(*asserts.ValidationSet)); err != nil {
+			return err
+		}
+	}
+	if err := vsets.Conflict(); err != nil {
+		return fmt.Errorf("cannot use validation sets: %v", err)
+	}
+	w.vsets = vsets
+	return nil
+}
+
 // LocalSnaps returns a list of seed snaps that are local.  The writer
 // delegates to produce *snap.Info for them to then be set via
 // SetInfo. If matching snap assertions can be found as well they can
@@ -649,6 +691,9 @@ func (w *Writer) modelSnapsToDownload(modSnaps []*asserts.ModelSnap) (toDownload
 			return nil, err
 		}
 		if !sn.local {
+			if err := w.setRequiredRevision(sn); err != nil {
+				return nil, err
+			}
 			toDownload = append(toDownload, sn)
 		}
 		if sn.optionSnap != nil {
@@ -745,6 +790,9 @@ func (w *Writer) extraSnapsToDownload(extraSnaps []*OptionsSnap) (toDownload []*
 			return nil, err
 		}
 		if !sn.local {
+			if err := w.setRequiredRevision(sn); err != nil {
+				return nil, err
+			}
 			toDownload = append(toDownload, sn)
 		}
 		w.extraSnaps = append(w.extraSnaps, sn)
@@ -754,9 +802,50 @@ func (w *Writer) extraSnapsToDownload(extraSnaps []*OptionsSnap) (toDownload []*
 	return toDownload, nil
 }
 
+// setRequiredRevision sets the revision of the snap as required by
+// the validation sets, if any.
+func (w *Writer) setRequiredRevision(sn *SeedSnap) error {
+	if w.vsets == nil {
+		return nil
+	}
+	invalidFor, err := w.vsets.CheckPresenceInvalid(sn)
+	if err != nil {
+		return err
+	}
+	if len(invalidFor) != 0 {
+		return fmt.Errorf("cannot use snap %q, it is invalid for validation sets %s", sn.SnapName(), strings.Join(invalidFor, ","))
+	}
+	_, rev, err := w.vsets.CheckPresenceRequired(sn)
+	if err != nil {
+		return err
+	}
+	sn.Revision = rev
+	return nil
+}
+
+// checkValidationSets checks that the complete set of seed snaps
+// satisfies the validation sets, if any.
+func (w *Writer) checkValidationSets() error {
+	if w.vsets == nil {
+		return nil
+	}
+	snaps := make([]*snapasserts.InstalledSnap, 0, len(w.snapsFromModel)+len(w.extraSnaps))
+	for _, sns := range [][]*SeedSnap{w.snapsFromModel, w.extraSnaps} {
+		for _, sn := range sns {
+			snaps = append(snaps, snapasserts.NewInstalledSnap(sn.Info.SnapName(), sn.Info.SnapID, sn.Info.Revision))
+		}
+	}
+	if err := w.vsets.CheckInstalledSnaps(snaps); err != nil {
+		return fmt.Errorf("cannot seed snaps: %v", err)
+	}
+	return nil
+}
+
 // SnapsToDownload returns a list of seed snaps to download. Once that
 // is done and their SeedSnaps Info with SetInfo and ARefs fields are
-// set, Downloaded should be called next.
+// set, Downloaded should be called next. If validation sets were
+// given via Options their Revision field is set to the revision
+// required by them, if any.
 func (w *Writer) SnapsToDownload() (snaps []*SeedSnap, err error) {
 	if err := w.checkStep(snapsToDownloadStep); err != nil {
 		return nil, err
@@ -919,7 +1008,8 @@ func (w *Writer) downloaded(seedSnaps []*SeedSnap) error {
 // Downloaded checks the downloaded snaps metadata provided via
 // setting it into the SeedSnaps returned by the previous
 // SnapsToDownload. It also returns whether the seed snap set is
-// complete or SnapsToDownload should be called again.
+// complete or SnapsToDownload should be called again. Once complete
+// the seed snaps are checked against the validation sets, if any.
 func (w *Writer) Downloaded() (complete bool, err error) {
 	if err := w.checkStep(downloadedStep); err != nil {
 		return false, err
@@ -981,6 +1071,10 @@ func (w *Writer) Downloaded() (complete bool, err error) {
 		panic(fmt.Sprintf("unknown to-download set: %d", w.toDownload))
 	}
 
+	if err := w.checkValidationSets(); err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -403,6 +403,173 @@ func (s *writerSuite) TestDownloadedCore18(c *C) {
 	c.Check(w.Warnings(), HasLen, 0)
 }
 
+func (s *writerSuite) makeValidationSet(c *C, name, sequence string, snaps ...interface{}) *asserts.Ref {
+	vset, err := s.Brands.Signing("my-brand").Sign(asserts.ValidationSetType, map[string]interface{}{
+		"authority-id": "my-brand",
+		"series":       "16",
+		"account-id":   "my-brand",
+		"name":         name,
+		"sequence":     sequence,
+		"snaps":        snaps,
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	err = s.StoreSigning.Add(vset)
+	c.Assert(err, IsNil)
+	return vset.Ref()
+}
+
+func (s *writerSuite) makeCore18ModelWithValidationSets(c *C, vsets ...*asserts.Ref) *asserts.Model {
+	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
+		"display-name":   "my model",
+		"architecture":   "amd64",
+		"base":           "core18",
+		"gadget":         "pc=18",
+		"kernel":         "pc-kernel=18",
+		"required-snaps": []interface{}{"cont-consumer", "cont-producer"},
+	})
+
+	s.makeSnap(c, "snapd", "")
+	s.makeSnap(c, "core18", "")
+	s.makeSnap(c, "pc-kernel=18", "")
+	s.makeSnap(c, "pc=18", "")
+	s.makeSnap(c, "cont-producer", "developerid")
+	s.makeSnap(c, "cont-consumer", "developerid")
+
+	s.opts.ValidationSets = vsets
+	return model
+}
+
+func (s *writerSuite) TestDownloadedCore18ValidationSets(c *C) {
+	vset := s.makeValidationSet(c, "my-set", "3",
+		map[string]interface{}{
+			"name":     "pc-kernel",
+			"id":       s.AssertedSnapID("pc-kernel"),
+			"presence": "required",
+			"revision": "1",
+		},
+		map[string]interface{}{
+			"name":     "cont-producer",
+			"id":       s.AssertedSnapID("cont-producer"),
+			"presence": "optional",
+		},
+	)
+	model := s.makeCore18ModelWithValidationSets(c, vset)
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	_, err = w.Start(s.db, s.newFetcher)
+	c.Assert(err, IsNil)
+
+	snaps, err := w.SnapsToDownload()
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 6)
+	for _, sn := range snaps {
+		if sn.SnapName() == "pc-kernel" {
+			c.Check(sn.Revision, Equals, snap.R(1))
+		} else {
+			c.Check(sn.Revision.Unset(), Equals, true, Commentf("%s", sn.SnapName()))
+		}
+		s.fillDownloadedSnap(c, w, sn)
+	}
+
+	complete, err := w.Downloaded()
+	c.Assert(err, IsNil)
+	c.Check(complete, Equals, true)
+
+	err = w.SeedSnaps(nil)
+	c.Assert(err, IsNil)
+	err = w.WriteMeta()
+	c.Assert(err, IsNil)
+
+	// the validation set is part of the seed
+	c.Check(filepath.Join(s.opts.SeedDir, "assertions", "16,my-brand,my-set,3.validation-set"), testutil.FileContains, "name: my-set\n")
+}
+
+func (s *writerSuite) TestDownloadedCore18ValidationSetsNotMet(c *C) {
+	vset := s.makeValidationSet(c, "my-set", "1",
+		map[string]interface{}{
+			"name":     "cont-producer",
+			"id":       s.AssertedSnapID("cont-producer"),
+			"presence": "required",
+			"revision": "2",
+		},
+		map[string]interface{}{
+			"name":     "my-devmode",
+			"id":       s.AssertedSnapID("my-devmode"),
+			"presence": "required",
+		},
+	)
+	model := s.makeCore18ModelWithValidationSets(c, vset)
+
+	_, _, err := s.upToDownloaded(c, model, s.fillDownloadedSnap)
+	c.Check(err, ErrorMatches, `(?s)cannot seed snaps: validation sets assertions are not met:
+- missing required snaps:
+  - my-devmode \(required by sets my-brand/my-set\)
+- snaps at wrong revisions:
+  - cont-producer \(required at revision 2 by sets my-brand/my-set\)`)
+}
+
+func (s *writerSuite) TestSnapsToDownloadCore18ValidationSetsInvalidSnap(c *C) {
+	vset := s.makeValidationSet(c, "my-set", "1",
+		map[string]interface{}{
+			"name":     "cont-consumer",
+			"id":       s.AssertedSnapID("cont-consumer"),
+			"presence": "invalid",
+		},
+	)
+	model := s.makeCore18ModelWithValidationSets(c, vset)
+
+	w, err := seedwriter.New(model, s.opts)
+	c.Assert(err, IsNil)
+
+	_, err = w.Start(s.db, s.newFetcher)
+	c.Assert(err, IsNil)
+
+	_, err = w.SnapsToDownload()
+	c.Check(err, ErrorMatches, `cannot use snap "cont-consumer", it is invalid for validation sets my-brand/my-set`)
+}
+
+func (s *writerSuite) TestStartValidationSetsErrors(c *C) {
+	vset1 := s.makeValidationSet(c, "my-set", "1",
+		map[string]interface{}{
+			"name":     "pc-kernel",
+			"id":       s.AssertedSnapID("pc-kernel"),
+			"presence": "required",
+			"revision": "1",
+		},
+	)
+	vset2 := s.makeValidationSet(c, "other-set", "1",
+		map[string]interface{}{
+			"name":     "pc-kernel",
+			"id":       s.AssertedSnapID("pc-kernel"),
+			"presence": "required",
+			"revision": "2",
+		},
+	)
+	missing := &asserts.Ref{
+		Type:       asserts.ValidationSetType,
+		PrimaryKey: []string{"16", "my-brand", "missing-set", "1"},
+	}
+
+	model := s.makeCore18ModelWithValidationSets(c)
+	for _, t := range []struct {
+		vsets []*asserts.Ref
+		err   string
+	}{
+		{[]*asserts.Ref{missing}, `cannot fetch validation set my-brand/missing-set/1: validation-set .* not found`},
+		{[]*asserts.Ref{vset1, vset2}, `(?s)cannot use validation sets: validation sets are in conflict:.*pc-kernel.*`},
+	} {
+		s.opts.ValidationSets = t.vsets
+		w, err := seedwriter.New(model, s.opts)
+		c.Assert(err, IsNil)
+
+		_, err = w.Start(s.db, s.newFetcher)
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
 func (s *writerSuite) TestSnapsToDownloadCore18IncompatibleTrack(c *C) {
 	model := s.Brands.Model("my-brand", "my-model", map[string]interface{}{
 		"display-name":   "my model",
@@ -85,6 +85,18 @@ func ValidateSnap(name string) error {
 	return nil
 }
 
+// ValidateQuotaGroup checks if a string can be used as a name for a quota
+// group. Currently the rules are exactly the same as for snap names.
+func ValidateQuotaGroup(grp string) error {
+	if grp == "" {
+		return fmt.Errorf("invalid quota group name: must not be empty")
+	}
+	if len(grp) < 2 || len(grp) > 40 || !isValidName(grp) {
+		return fmt.Errorf("invalid quota group name: %q", grp)
+	}
+	return nil
+}
+
 // Regular expression describing correct plug, slot and interface names.
 var validPlugSlotIface = regexp.MustCompile("^[a-z](?:-?[a-z0-9])*$")
 
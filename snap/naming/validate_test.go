@@ -87,6 +87,40 @@ func (s *ValidateSuite) TestValidateName(c *C) {
 	}
 }
 
+func (s *ValidateSuite) TestValidateQuotaGroup(c *C) {
+	validNames := []string{
+		"aa", "aaa", "aaaa",
+		"a-a", "aa-a", "a-aa", "a-b-c",
+		"a0", "a-0", "a-0a",
+		"01game", "1-or-2",
+	}
+	for _, name := range validNames {
+		err := naming.ValidateQuotaGroup(name)
+		c.Assert(err, IsNil)
+	}
+	invalidNames := []string{
+		// too short
+		"a",
+		// names cannot be too long
+		"xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
+		// dashes alone are not a name
+		"-", "--",
+		// double dashes in a name are not allowed
+		"a--a",
+		// name should not end with a dash
+		"a-",
+		// name cannot have any spaces in it
+		"a ", " a", "a a",
+		// no upper case letters or underscores
+		"aA", "a_a",
+	}
+	for _, name := range invalidNames {
+		err := naming.ValidateQuotaGroup(name)
+		c.Assert(err, ErrorMatches, `invalid quota group name: .*`)
+	}
+	c.Assert(naming.ValidateQuotaGroup(""), ErrorMatches, `invalid quota group name: must not be empty`)
+}
+
 func (s *ValidateSuite) TestValidateInstanceName(c *C) {
 	validNames := []string{
 		// plain names are also valid instance names
@@ -121,7 +121,12 @@ func loadAndValidate(sourceDir string) (*snap.Info, error) {
 		return nil, fmt.Errorf("cannot validate snap %q: %v", info.InstanceName(), err)
 	}
 
-	if err := snap.ValidateContainer(snapdir.New(sourceDir), info, logger.Noticef); err != nil {
+	container := snapdir.New(sourceDir)
+	if err := snap.ValidateContainer(container, info, logger.Noticef); err != nil {
+		return nil, err
+	}
+
+	if _, err := snap.ReadSnapshotYamlFromSnapFile(container); err != nil {
 		return nil, err
 	}
 
@@ -203,6 +208,9 @@ type Options struct {
 	SnapName string
 	// Compression method to use
 	Compression string
+	// CompressionLevel is the level of compression to use, zero for
+	// the default of the compression method
+	CompressionLevel int
 }
 
 var Defaults *Options = nil
@@ -214,11 +222,14 @@ func Snap(sourceDir string, opts *Options) (string, error) {
 		opts = &Options{}
 	}
 	switch opts.Compression {
-	case "xz", "lzo", "":
+	case "xz", "lzo", "zstd", "lz4", "":
 		// fine
 	default:
 		return "", fmt.Errorf("cannot use compression %q", opts.Compression)
 	}
+	if err := squashfs.ValidateCompressionLevel(opts.Compression, opts.CompressionLevel); err != nil {
+		return "", err
+	}
 
 	info, err := prepare(sourceDir, opts.TargetDir)
 	if err != nil {
@@ -234,9 +245,10 @@ func Snap(sourceDir string, opts *Options) (string, error) {
 	snapName := snapPath(info, opts.TargetDir, opts.SnapName)
 	d := squashfs.New(snapName)
 	if err = d.Build(sourceDir, &squashfs.BuildOpts{
-		SnapType:     string(info.Type()),
-		Compression:  opts.Compression,
-		ExcludeFiles: []string{excludes},
+		SnapType:         string(info.Type()),
+		Compression:      opts.Compression,
+		CompressionLevel: opts.CompressionLevel,
+		ExcludeFiles:     []string{excludes},
 	}); err != nil {
 		return "", err
 	}
@@ -331,7 +331,7 @@ volumes:
 func (s *packSuite) TestPackWithCompressionHappy(c *C) {
 	sourceDir := makeExampleSnapSourceDir(c, "{name: hello, version: 0}")
 
-	for _, comp := range []string{"", "xz", "lzo"} {
+	for _, comp := range []string{"", "xz", "lzo", "zstd", "lz4"} {
 		snapfile, err := pack.Snap(sourceDir, &pack.Options{
 			TargetDir:   c.MkDir(),
 			Compression: comp,
@@ -344,7 +344,7 @@ func (s *packSuite) TestPackWithCompressionHappy(c *C) {
 func (s *packSuite) TestPackWithCompressionUnhappy(c *C) {
 	sourceDir := makeExampleSnapSourceDir(c, "{name: hello, version: 0}")
 
-	for _, comp := range []string{"gzip", "zstd", "silly"} {
+	for _, comp := range []string{"gzip", "lzma", "silly"} {
 		snapfile, err := pack.Snap(sourceDir, &pack.Options{
 			TargetDir:   c.MkDir(),
 			Compression: comp,
@@ -353,3 +353,23 @@ func (s *packSuite) TestPackWithCompressionUnhappy(c *C) {
 		c.Assert(snapfile, Equals, "")
 	}
 }
+
+func (s *packSuite) TestPackWithCompressionLevel(c *C) {
+	sourceDir := makeExampleSnapSourceDir(c, "{name: hello, version: 0}")
+
+	snapfile, err := pack.Snap(sourceDir, &pack.Options{
+		TargetDir:        c.MkDir(),
+		Compression:      "zstd",
+		CompressionLevel: 19,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(snapfile, testutil.FilePresent)
+
+	snapfile, err = pack.Snap(sourceDir, &pack.Options{
+		TargetDir:        c.MkDir(),
+		Compression:      "lz4",
+		CompressionLevel: 3,
+	})
+	c.Assert(err, ErrorMatches, `cannot use a compression level with compression "lz4"`)
+	c.Assert(snapfile, Equals, "")
+}
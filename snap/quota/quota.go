@@ -0,0 +1,394 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package quota defines state structures for resource quota groups
+// for snaps.
+package quota
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/snap/naming"
+	"github.com/snapcore/snapd/strutil"
+	"github.com/snapcore/snapd/systemd"
+)
+
+// MinMemoryLimit is the smallest memory limit that can be set on a quota
+// group, systemd cannot enforce anything smaller than a single page.
+const MinMemoryLimit = 4 * quantity.SizeKiB
+
+// Resources are the resource limits of a quota group. A zero value for any of
+// the limits means that the given resource is not limited.
+type Resources struct {
+	// Memory is the maximum amount of memory usable by all processes in the
+	// group.
+	Memory quantity.Size `json:"memory,omitempty"`
+	// CPU is the maximum CPU time available to all processes in the group,
+	// expressed as a percentage of a single CPU, i.e. a value of 200 allows
+	// using two full CPUs.
+	CPU int `json:"cpu,omitempty"`
+	// Tasks is the maximum number of tasks (processes and threads) in the
+	// group.
+	Tasks int `json:"tasks,omitempty"`
+}
+
+// IsZero returns true if no resource is limited.
+func (r Resources) IsZero() bool {
+	return r == Resources{}
+}
+
+// Validate checks the limits for sanity.
+func (r Resources) Validate() error {
+	if r.IsZero() {
+		return fmt.Errorf("quota group must have at least one resource limit set")
+	}
+	if r.Memory != 0 && r.Memory < MinMemoryLimit {
+		return fmt.Errorf("memory limit %d is too small: size must be larger than %d", r.Memory, MinMemoryLimit)
+	}
+	if r.CPU < 0 {
+		return fmt.Errorf("cpu limit %d cannot be negative", r.CPU)
+	}
+	if r.Tasks < 0 {
+		return fmt.Errorf("task limit %d cannot be negative", r.Tasks)
+	}
+	return nil
+}
+
+// Group is a quota group of snaps, services or sub-groups that are all subject
+// to the same resource limits. Groups are organized in a tree, where every
+// group is confined to a systemd slice nested in the slice of its parent.
+type Group struct {
+	// Name is the name of the quota group. This name is used as the
+	// name of the systemd slice underlying the quota group.
+	// Certain names are reserved for future use: system, snapd, root, user,
+	// snap.
+	// Otherwise names following the same rules as snap names can be used.
+	Name string `json:"name,omitempty"`
+
+	// SubGroups is the set of sub-groups that are subject to this quota.
+	// Sub-groups have their own limits, subject to the requirement that
+	// the sum of their limits does not exceed the limits of this group.
+	SubGroups []string `json:"sub-groups,omitempty"`
+
+	// subGroups is the set of actual sub-group objects, it is not serialized
+	// and is instead re-constructed from SubGroups after loading.
+	subGroups []*Group
+
+	// ParentGroup is the the parent group that this group is a child of. If
+	// it is empty, then this is a "root" quota group.
+	ParentGroup string `json:"parent-group,omitempty"`
+
+	// parentGroup is the actual parent group object, it is not serialized
+	// and is instead re-constructed from ParentGroup after loading.
+	parentGroup *Group
+
+	// Snaps is the set of snaps that is part of this quota group. If this is
+	// empty then the underlying slice may only have other sub-groups.
+	Snaps []string `json:"snaps,omitempty"`
+
+	// Limits are the resource limits enforced on the group.
+	Limits Resources `json:"limits"`
+}
+
+var reservedGroupNames = []string{"system", "snapd", "root", "user", "snap"}
+
+// NewGroup creates a new top quota group with the given name and resource
+// limits.
+func NewGroup(name string, limits Resources) (*Group, error) {
+	grp := &Group{
+		Name:   name,
+		Limits: limits,
+	}
+
+	if err := grp.validate(); err != nil {
+		return nil, err
+	}
+
+	return grp, nil
+}
+
+// SliceFileName returns the name of the slice file that should be used for
+// this quota group. This name will include all of the group's parents in the
+// name. For example, a group named "bar" that is a child of the "foo" group
+// will have a systemd slice name as "snap.foo-bar.slice". Note that the
+// escaping of the name is also taken care of, such that a group named
+// "my-group" will have a slice named "snap.my\x2dgroup.slice".
+func (grp *Group) SliceFileName() string {
+	escapedGrpName := systemd.EscapeUnitNamePath(grp.Name)
+	if grp.parentGroup == nil {
+		// root group name, then no parent to include in the name
+		return fmt.Sprintf("snap.%s.slice", escapedGrpName)
+	}
+	// otherwise we have a parent group and we need to include that in our
+	// slice name
+	parentSliceName := grp.parentGroup.SliceFileName()
+	return fmt.Sprintf("%s-%s.slice", parentSliceName[:len(parentSliceName)-len(".slice")], escapedGrpName)
+}
+
+// SliceFile returns the full path of the systemd slice unit for this group.
+func (grp *Group) SliceFile() string {
+	return filepath.Join(dirs.SnapServicesDir, grp.SliceFileName())
+}
+
+// Parent returns the parent group of the group, or nil if the group is a root
+// group.
+func (grp *Group) Parent() *Group {
+	return grp.parentGroup
+}
+
+// Children returns the sub-groups of the group.
+func (grp *Group) Children() []*Group {
+	return grp.subGroups
+}
+
+func (grp *Group) validate() error {
+	if err := naming.ValidateQuotaGroup(grp.Name); err != nil {
+		return err
+	}
+
+	// check if the name is reserved for future usage
+	if strutil.ListContains(reservedGroupNames, grp.Name) {
+		return fmt.Errorf("group name %q reserved", grp.Name)
+	}
+
+	if err := grp.Limits.Validate(); err != nil {
+		return err
+	}
+
+	// check that if this is a sub-group, then the parent group has enough
+	// space to accommodate this sub-group (we implicitly assume that the
+	// parent group has already been validated)
+	if grp.ParentGroup != "" {
+		if grp.parentGroup == nil {
+			return fmt.Errorf("group has parent group %q but it is unknown", grp.ParentGroup)
+		}
+		if grp.ParentGroup != grp.parentGroup.Name {
+			return fmt.Errorf("group has parent group %q but the parent object has name %q", grp.ParentGroup, grp.parentGroup.Name)
+		}
+		if err := grp.parentGroup.checkSubGroupLimits(grp); err != nil {
+			return err
+		}
+	}
+
+	// check that if there are sub-groups, their names are all
+	// accounted for in the sub-group objects
+	if len(grp.SubGroups) != len(grp.subGroups) {
+		return fmt.Errorf("group has %d sub-groups but only %d were resolved", len(grp.SubGroups), len(grp.subGroups))
+	}
+	for _, sub := range grp.subGroups {
+		if !strutil.ListContains(grp.SubGroups, sub.Name) {
+			return fmt.Errorf("group has sub-group %q that is not listed by name", sub.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkSubGroupLimits checks that the limits of the given (new or changed)
+// sub-group fit together with the limits of the other sub-groups inside the
+// limits of the group.
+func (grp *Group) checkSubGroupLimits(sub *Group) error {
+	var used Resources
+	for _, other := range grp.subGroups {
+		if other.Name == sub.Name {
+			continue
+		}
+		used.Memory += other.Limits.Memory
+		used.CPU += other.Limits.CPU
+		used.Tasks += other.Limits.Tasks
+	}
+
+	if grp.Limits.Memory != 0 {
+		if sub.Limits.Memory == 0 {
+			return fmt.Errorf("sub-group %q must set a memory limit as its parent group %q has one", sub.Name, grp.Name)
+		}
+		if used.Memory+sub.Limits.Memory > grp.Limits.Memory {
+			remaining := grp.Limits.Memory - used.Memory
+			return fmt.Errorf("sub-group memory limit of %s is too large to fit inside remaining quota space %s for parent group %s", sub.Limits.Memory.IECString(), remaining.IECString(), grp.Name)
+		}
+	}
+	if grp.Limits.CPU != 0 {
+		if sub.Limits.CPU == 0 {
+			return fmt.Errorf("sub-group %q must set a cpu limit as its parent group %q has one", sub.Name, grp.Name)
+		}
+		if used.CPU+sub.Limits.CPU > grp.Limits.CPU {
+			return fmt.Errorf("sub-group cpu limit of %d%% is too large to fit inside remaining quota space %d%% for parent group %s", sub.Limits.CPU, grp.Limits.CPU-used.CPU, grp.Name)
+		}
+	}
+	if grp.Limits.Tasks != 0 {
+		if sub.Limits.Tasks == 0 {
+			return fmt.Errorf("sub-group %q must set a task limit as its parent group %q has one", sub.Name, grp.Name)
+		}
+		if used.Tasks+sub.Limits.Tasks > grp.Limits.Tasks {
+			return fmt.Errorf("sub-group task limit of %d is too large to fit inside remaining quota space %d for parent group %s", sub.Limits.Tasks, grp.Limits.Tasks-used.Tasks, grp.Name)
+		}
+	}
+	return nil
+}
+
+// NewSubGroup creates a new sub group under the current group with the given
+// name and resource limits. The limits must fit inside the limits of the
+// group, together with the limits of all of its other sub-groups.
+func (grp *Group) NewSubGroup(name string, limits Resources) (*Group, error) {
+	// check for an existing sub-group with this name
+	if strutil.ListContains(grp.SubGroups, name) {
+		return nil, fmt.Errorf("cannot use same name %q for sub group as existing sub group", name)
+	}
+
+	subGrp := &Group{
+		Name:        name,
+		Limits:      limits,
+		ParentGroup: grp.Name,
+		parentGroup: grp,
+	}
+
+	// check early that the sub group name is not the same as that of the
+	// parent, this is fine in systemd world, but in snapd we want unique
+	// quota groups
+	if name == grp.Name {
+		return nil, fmt.Errorf("cannot use same name %q for sub group as parent group", name)
+	}
+
+	if err := subGrp.validate(); err != nil {
+		return nil, err
+	}
+
+	// save the details of this new sub-group in the parent group
+	grp.subGroups = append(grp.subGroups, subGrp)
+	grp.SubGroups = append(grp.SubGroups, name)
+
+	return subGrp, nil
+}
+
+// UpdateLimits changes the resource limits of the group, validating that the
+// new limits still fit in the parent group and accommodate all of the
+// sub-groups.
+func (grp *Group) UpdateLimits(limits Resources) error {
+	old := grp.Limits
+	grp.Limits = limits
+	err := grp.validate()
+	if err == nil {
+		for _, sub := range grp.subGroups {
+			if err = grp.checkSubGroupLimits(sub); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		grp.Limits = old
+		return err
+	}
+	return nil
+}
+
+// RemoveSubGroup drops the given sub-group from the group.
+func (grp *Group) RemoveSubGroup(name string) {
+	for i, sub := range grp.subGroups {
+		if sub.Name == name {
+			grp.subGroups = append(grp.subGroups[:i], grp.subGroups[i+1:]...)
+			break
+		}
+	}
+	for i, subName := range grp.SubGroups {
+		if subName == name {
+			grp.SubGroups = append(grp.SubGroups[:i], grp.SubGroups[i+1:]...)
+			break
+		}
+	}
+}
+
+// ResolveCrossReferences takes a set of deserialized groups and sets all
+// cross references amongst them using the unexported fields which are not
+// serialized. All groups are validated in the process.
+func ResolveCrossReferences(grps map[string]*Group) error {
+	// iterate over the groups in a deterministic order, so that the errors
+	// are stable
+	names := make([]string, 0, len(grps))
+	for name := range grps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// first reset the pointers, then resolve them
+	for _, name := range names {
+		grp := grps[name]
+		if grp.Name != name {
+			return fmt.Errorf("group has name %q, but is referenced as %q", grp.Name, name)
+		}
+		grp.parentGroup = nil
+		grp.subGroups = nil
+	}
+
+	for _, name := range names {
+		grp := grps[name]
+		if grp.ParentGroup != "" {
+			parent, ok := grps[grp.ParentGroup]
+			if !ok {
+				return fmt.Errorf("missing group %q referenced as the parent of group %q", grp.ParentGroup, grp.Name)
+			}
+			grp.parentGroup = parent
+		}
+		for _, subName := range grp.SubGroups {
+			sub, ok := grps[subName]
+			if !ok {
+				return fmt.Errorf("missing group %q referenced as the sub-group of group %q", subName, grp.Name)
+			}
+			if sub.ParentGroup != grp.Name {
+				return fmt.Errorf("group %q does not reference necessary parent group %q", subName, grp.Name)
+			}
+			grp.subGroups = append(grp.subGroups, sub)
+		}
+	}
+
+	// make sure that the groups form a tree
+	for _, name := range names {
+		depth := 0
+		for p := grps[name].parentGroup; p != nil; p = p.parentGroup {
+			depth++
+			if depth > len(grps) {
+				return fmt.Errorf("group %q is part of a reference cycle", name)
+			}
+		}
+	}
+
+	// now validate every group, note that validation checks the group
+	// against its parent
+	for _, name := range names {
+		if err := grps[name].validate(); err != nil {
+			return fmt.Errorf("group %q is invalid: %v", name, err)
+		}
+	}
+
+	// finally check that no snap is in more than one group
+	snapGroups := make(map[string]string)
+	for _, name := range names {
+		for _, snapName := range grps[name].Snaps {
+			if other, ok := snapGroups[snapName]; ok {
+				return fmt.Errorf("snap %q is in both group %q and group %q", snapName, other, name)
+			}
+			snapGroups[snapName] = name
+		}
+	}
+
+	return nil
+}
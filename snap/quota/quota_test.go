@@ -0,0 +1,386 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package quota_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/gadget/quantity"
+	"github.com/snapcore/snapd/snap/quota"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type quotaTestSuite struct{}
+
+var _ = Suite(&quotaTestSuite{})
+
+func (ts *quotaTestSuite) TestNewGroup(c *C) {
+	tt := []struct {
+		name    string
+		limits  quota.Resources
+		err     string
+		comment string
+	}{
+		{
+			name:    "group1",
+			comment: "no limits",
+			err:     `quota group must have at least one resource limit set`,
+		},
+		{
+			name:    "group1",
+			limits:  quota.Resources{Memory: quantity.SizeMiB},
+			comment: "basic happy",
+		},
+		{
+			name:    "group1",
+			limits:  quota.Resources{CPU: 50, Tasks: 32},
+			comment: "cpu and tasks limits only",
+		},
+		{
+			name:    "biglimit",
+			limits:  quota.Resources{Memory: quantity.Size(18446744073709551615)},
+			comment: "huge limit",
+		},
+		{
+			name:    "zero",
+			limits:  quota.Resources{Memory: 1},
+			err:     `memory limit 1 is too small: size must be larger than 4096`,
+			comment: "tiny memory limit",
+		},
+		{
+			name:    "neg",
+			limits:  quota.Resources{CPU: -1},
+			err:     `cpu limit -1 cannot be negative`,
+			comment: "negative cpu limit",
+		},
+		{
+			name:    "neg",
+			limits:  quota.Resources{Tasks: -1},
+			err:     `task limit -1 cannot be negative`,
+			comment: "negative task limit",
+		},
+		{
+			name:    "_group-1",
+			limits:  quota.Resources{Memory: quantity.SizeMiB},
+			err:     `invalid quota group name: .*`,
+			comment: "invalid group name",
+		},
+		{
+			name:    "system",
+			limits:  quota.Resources{Memory: quantity.SizeMiB},
+			err:     `group name "system" reserved`,
+			comment: "reserved system name",
+		},
+		{
+			name:    "snapd",
+			limits:  quota.Resources{Memory: quantity.SizeMiB},
+			err:     `group name "snapd" reserved`,
+			comment: "reserved snapd name",
+		},
+	}
+
+	for _, t := range tt {
+		comment := Commentf(t.comment)
+		grp, err := quota.NewGroup(t.name, t.limits)
+		if t.err != "" {
+			c.Assert(err, ErrorMatches, t.err, comment)
+			continue
+		}
+		c.Assert(err, IsNil, comment)
+		c.Check(grp.Name, Equals, t.name, comment)
+		c.Check(grp.Limits, Equals, t.limits, comment)
+		c.Check(grp.Parent(), IsNil, comment)
+	}
+}
+
+func (ts *quotaTestSuite) TestSimpleSubGroupVerification(c *C) {
+	tt := []struct {
+		rootlimits quota.Resources
+		subname    string
+		sublimits  quota.Resources
+		err        string
+		comment    string
+	}{
+		{
+			rootlimits: quota.Resources{Memory: quantity.SizeMiB},
+			subname:    "sub",
+			sublimits:  quota.Resources{Memory: quantity.SizeMiB},
+			comment:    "basic sub group with same quota as parent happy",
+		},
+		{
+			rootlimits: quota.Resources{Memory: quantity.SizeMiB},
+			subname:    "sub",
+			sublimits:  quota.Resources{Memory: quantity.SizeMiB / 2},
+			comment:    "basic sub group with smaller quota than parent happy",
+		},
+		{
+			rootlimits: quota.Resources{Memory: quantity.SizeMiB},
+			subname:    "sub",
+			sublimits:  quota.Resources{Memory: quantity.SizeMiB * 2},
+			err:        "sub-group memory limit of 2 MiB is too large to fit inside remaining quota space 1 MiB for parent group myroot",
+			comment:    "sub group with larger quota than parent unhappy",
+		},
+		{
+			rootlimits: quota.Resources{CPU: 100},
+			subname:    "sub",
+			sublimits:  quota.Resources{CPU: 150},
+			err:        "sub-group cpu limit of 150% is too large to fit inside remaining quota space 100% for parent group myroot",
+			comment:    "sub group with larger cpu quota than parent unhappy",
+		},
+		{
+			rootlimits: quota.Resources{Tasks: 10},
+			subname:    "sub",
+			sublimits:  quota.Resources{Tasks: 11},
+			err:        "sub-group task limit of 11 is too large to fit inside remaining quota space 10 for parent group myroot",
+			comment:    "sub group with larger task quota than parent unhappy",
+		},
+		{
+			rootlimits: quota.Resources{Memory: quantity.SizeMiB},
+			subname:    "sub",
+			sublimits:  quota.Resources{CPU: 50},
+			err:        `sub-group "sub" must set a memory limit as its parent group "myroot" has one`,
+			comment:    "sub group without the limit of the parent unhappy",
+		},
+		{
+			rootlimits: quota.Resources{Memory: quantity.SizeMiB},
+			subname:    "myroot",
+			sublimits:  quota.Resources{Memory: quantity.SizeMiB},
+			err:        `cannot use same name "myroot" for sub group as parent group`,
+			comment:    "sub group with same name as parent unhappy",
+		},
+	}
+
+	for _, t := range tt {
+		comment := Commentf(t.comment)
+		rootGrp, err := quota.NewGroup("myroot", t.rootlimits)
+		c.Assert(err, IsNil, comment)
+
+		subGrp, err := rootGrp.NewSubGroup(t.subname, t.sublimits)
+		if t.err != "" {
+			c.Assert(err, ErrorMatches, t.err, comment)
+			c.Check(rootGrp.SubGroups, HasLen, 0, comment)
+			continue
+		}
+		c.Assert(err, IsNil, comment)
+		c.Check(subGrp.Parent(), Equals, rootGrp, comment)
+		c.Check(subGrp.ParentGroup, Equals, "myroot", comment)
+		c.Check(rootGrp.SubGroups, DeepEquals, []string{t.subname}, comment)
+		c.Check(rootGrp.Children(), DeepEquals, []*quota.Group{subGrp}, comment)
+	}
+}
+
+func (ts *quotaTestSuite) TestSubGroupsShareParentLimits(c *C) {
+	rootGrp, err := quota.NewGroup("myroot", quota.Resources{Memory: 4 * quantity.SizeMiB})
+	c.Assert(err, IsNil)
+
+	_, err = rootGrp.NewSubGroup("sub1", quota.Resources{Memory: 3 * quantity.SizeMiB})
+	c.Assert(err, IsNil)
+
+	_, err = rootGrp.NewSubGroup("sub2", quota.Resources{Memory: 2 * quantity.SizeMiB})
+	c.Assert(err, ErrorMatches, "sub-group memory limit of 2 MiB is too large to fit inside remaining quota space 1 MiB for parent group myroot")
+
+	_, err = rootGrp.NewSubGroup("sub2", quota.Resources{Memory: quantity.SizeMiB})
+	c.Assert(err, IsNil)
+
+	_, err = rootGrp.NewSubGroup("sub2", quota.Resources{Memory: quantity.SizeMiB})
+	c.Assert(err, ErrorMatches, `cannot use same name "sub2" for sub group as existing sub group`)
+
+	c.Check(rootGrp.SubGroups, DeepEquals, []string{"sub1", "sub2"})
+
+	// the parent cannot be shrunk below what the sub-groups use
+	err = rootGrp.UpdateLimits(quota.Resources{Memory: 2 * quantity.SizeMiB})
+	c.Assert(err, ErrorMatches, "sub-group memory limit of 3 MiB is too large to fit inside remaining quota space 1 MiB for parent group myroot")
+	c.Check(rootGrp.Limits.Memory, Equals, 4*quantity.SizeMiB)
+
+	rootGrp.RemoveSubGroup("sub1")
+	c.Check(rootGrp.SubGroups, DeepEquals, []string{"sub2"})
+	c.Check(rootGrp.Children(), HasLen, 1)
+
+	err = rootGrp.UpdateLimits(quota.Resources{Memory: 2 * quantity.SizeMiB})
+	c.Assert(err, IsNil)
+	c.Check(rootGrp.Limits.Memory, Equals, 2*quantity.SizeMiB)
+}
+
+func (ts *quotaTestSuite) TestSliceFileName(c *C) {
+	rootGrp, err := quota.NewGroup("foo", quota.Resources{Memory: quantity.SizeMiB})
+	c.Assert(err, IsNil)
+	c.Check(rootGrp.SliceFileName(), Equals, "snap.foo.slice")
+
+	subGrp, err := rootGrp.NewSubGroup("bar", quota.Resources{Memory: quantity.SizeMiB / 2})
+	c.Assert(err, IsNil)
+	c.Check(subGrp.SliceFileName(), Equals, "snap.foo-bar.slice")
+
+	subSubGrp, err := subGrp.NewSubGroup("my-group", quota.Resources{Memory: quantity.SizeMiB / 4})
+	c.Assert(err, IsNil)
+	c.Check(subSubGrp.SliceFileName(), Equals, `snap.foo-bar-my\x2dgroup.slice`)
+}
+
+func (ts *quotaTestSuite) TestResolveCrossReferences(c *C) {
+	tt := []struct {
+		grps    map[string]*quota.Group
+		err     string
+		comment string
+	}{
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:   "foogroup",
+					Limits: quota.Resources{Memory: quantity.SizeMiB},
+				},
+			},
+			comment: "single group",
+		},
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:   "foogroup",
+					Limits: quota.Resources{Memory: quantity.SizeMiB},
+				},
+				"other": {
+					Name:   "foogroup",
+					Limits: quota.Resources{Memory: quantity.SizeMiB},
+				},
+			},
+			err:     `group has name "foogroup", but is referenced as "other"`,
+			comment: "group with different name than map key",
+		},
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:        "foogroup",
+					Limits:      quota.Resources{Memory: quantity.SizeMiB},
+					ParentGroup: "missing",
+				},
+			},
+			err:     `missing group "missing" referenced as the parent of group "foogroup"`,
+			comment: "missing parent",
+		},
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:      "foogroup",
+					Limits:    quota.Resources{Memory: quantity.SizeMiB},
+					SubGroups: []string{"missing"},
+				},
+			},
+			err:     `missing group "missing" referenced as the sub-group of group "foogroup"`,
+			comment: "missing sub-group",
+		},
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:      "foogroup",
+					Limits:    quota.Resources{Memory: quantity.SizeMiB},
+					SubGroups: []string{"subgroup"},
+				},
+				"subgroup": {
+					Name:   "subgroup",
+					Limits: quota.Resources{Memory: quantity.SizeMiB},
+				},
+			},
+			err:     `group "subgroup" does not reference necessary parent group "foogroup"`,
+			comment: "sub-group without parent reference",
+		},
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:      "foogroup",
+					Limits:    quota.Resources{Memory: quantity.SizeMiB},
+					SubGroups: []string{"subgroup"},
+				},
+				"subgroup": {
+					Name:        "subgroup",
+					Limits:      quota.Resources{Memory: quantity.SizeMiB},
+					ParentGroup: "foogroup",
+				},
+			},
+			comment: "happy sub-group",
+		},
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:        "foogroup",
+					Limits:      quota.Resources{Memory: quantity.SizeMiB},
+					SubGroups:   []string{"subgroup"},
+					ParentGroup: "subgroup",
+				},
+				"subgroup": {
+					Name:        "subgroup",
+					Limits:      quota.Resources{Memory: quantity.SizeMiB},
+					SubGroups:   []string{"foogroup"},
+					ParentGroup: "foogroup",
+				},
+			},
+			err:     `group "foogroup" is part of a reference cycle`,
+			comment: "cyclic groups",
+		},
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:      "foogroup",
+					Limits:    quota.Resources{Memory: quantity.SizeMiB},
+					SubGroups: []string{"subgroup"},
+				},
+				"subgroup": {
+					Name:        "subgroup",
+					Limits:      quota.Resources{Memory: 2 * quantity.SizeMiB},
+					ParentGroup: "foogroup",
+				},
+			},
+			err:     `group "subgroup" is invalid: sub-group memory limit of 2 MiB is too large to fit inside remaining quota space 1 MiB for parent group foogroup`,
+			comment: "sub-group too large",
+		},
+		{
+			grps: map[string]*quota.Group{
+				"foogroup": {
+					Name:   "foogroup",
+					Limits: quota.Resources{Memory: quantity.SizeMiB},
+					Snaps:  []string{"snap1"},
+				},
+				"other": {
+					Name:   "other",
+					Limits: quota.Resources{Memory: quantity.SizeMiB},
+					Snaps:  []string{"snap1"},
+				},
+			},
+			err:     `snap "snap1" is in both group "foogroup" and group "other"`,
+			comment: "snap in two groups",
+		},
+	}
+
+	for _, t := range tt {
+		comment := Commentf(t.comment)
+		err := quota.ResolveCrossReferences(t.grps)
+		if t.err != "" {
+			c.Assert(err, ErrorMatches, t.err, comment)
+			continue
+		}
+		c.Assert(err, IsNil, comment)
+		for _, grp := range t.grps {
+			if grp.ParentGroup != "" {
+				c.Check(grp.Parent(), Equals, t.grps[grp.ParentGroup], comment)
+			}
+			c.Check(grp.Children(), HasLen, len(grp.SubGroups), comment)
+		}
+	}
+}
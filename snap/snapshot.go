@@ -0,0 +1,78 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+const snapshotManifestPath = "meta/snapshots.yaml"
+
+// SnapshotOptions describes the options a snap can set, in
+// meta/snapshots.yaml, to tweak the snapshots of its data.
+type SnapshotOptions struct {
+	// Exclude is the list of file and directory patterns that are left
+	// out of snapshots. Each pattern starts with one of $SNAP_DATA,
+	// $SNAP_COMMON, $SNAP_USER_DATA or $SNAP_USER_COMMON, and can use
+	// the "*" and "?" wildcards, which do not match "/".
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+}
+
+// ReadSnapshotYaml reads the snapshot options of the given installed
+// snap, if any.
+func ReadSnapshotYaml(si *Info) (*SnapshotOptions, error) {
+	data, err := ioutil.ReadFile(filepath.Join(si.MountDir(), snapshotManifestPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readSnapshotYaml(data)
+}
+
+// ReadSnapshotYamlFromSnapFile reads the snapshot options from the given
+// container, if any.
+func ReadSnapshotYamlFromSnapFile(snapf Container) (*SnapshotOptions, error) {
+	data, err := snapf.ReadFile(snapshotManifestPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readSnapshotYaml(data)
+}
+
+func readSnapshotYaml(data []byte) (*SnapshotOptions, error) {
+	var opts SnapshotOptions
+	if err := yaml.UnmarshalStrict(data, &opts); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", snapshotManifestPath, err)
+	}
+	if err := ValidateSnapshotOptions(&opts); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", snapshotManifestPath, err)
+	}
+	return &opts, nil
+}
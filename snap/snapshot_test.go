@@ -0,0 +1,93 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snap_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapdir"
+)
+
+type snapshotSuite struct{}
+
+var _ = Suite(&snapshotSuite{})
+
+func (s *snapshotSuite) TearDownTest(c *C) {
+	dirs.SetRootDir("")
+}
+
+func (s *snapshotSuite) TestReadSnapshotYamlFromSnapFile(c *C) {
+	d := c.MkDir()
+	container := snapdir.New(d)
+
+	// no snapshots.yaml, no options
+	opts, err := snap.ReadSnapshotYamlFromSnapFile(container)
+	c.Assert(err, IsNil)
+	c.Check(opts, IsNil)
+
+	c.Assert(os.MkdirAll(filepath.Join(d, "meta"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(d, "meta", "snapshots.yaml"), []byte(`exclude:
+  - $SNAP_DATA/cache
+  - $SNAP_USER_COMMON/*.tmp
+`), 0644), IsNil)
+	opts, err = snap.ReadSnapshotYamlFromSnapFile(container)
+	c.Assert(err, IsNil)
+	c.Check(opts, DeepEquals, &snap.SnapshotOptions{
+		Exclude: []string{"$SNAP_DATA/cache", "$SNAP_USER_COMMON/*.tmp"},
+	})
+}
+
+func (s *snapshotSuite) TestReadSnapshotYaml(c *C) {
+	dirs.SetRootDir(c.MkDir())
+	info := &snap.Info{SuggestedName: "foo", SideInfo: snap.SideInfo{Revision: snap.R(1)}}
+
+	opts, err := snap.ReadSnapshotYaml(info)
+	c.Assert(err, IsNil)
+	c.Check(opts, IsNil)
+
+	c.Assert(os.MkdirAll(filepath.Join(info.MountDir(), "meta"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(info.MountDir(), "meta", "snapshots.yaml"), []byte("exclude: [$SNAP_COMMON/log]\n"), 0644), IsNil)
+	opts, err = snap.ReadSnapshotYaml(info)
+	c.Assert(err, IsNil)
+	c.Check(opts, DeepEquals, &snap.SnapshotOptions{Exclude: []string{"$SNAP_COMMON/log"}})
+}
+
+func (s *snapshotSuite) TestReadSnapshotYamlErrors(c *C) {
+	d := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(d, "meta"), 0755), IsNil)
+
+	for _, t := range []struct {
+		yaml, err string
+	}{
+		{"exclude: potato", `cannot read meta/snapshots.yaml: yaml: unmarshal errors:\n.*`},
+		{"include: [$SNAP_DATA/foo]", `cannot read meta/snapshots.yaml: yaml: unmarshal errors:\n.*field include not found.*`},
+		{"exclude: [$SNAP/foo]", `invalid meta/snapshots.yaml: snapshot exclude path must start with one of .*: "\$SNAP/foo"`},
+	} {
+		c.Assert(ioutil.WriteFile(filepath.Join(d, "meta", "snapshots.yaml"), []byte(t.yaml), 0644), IsNil)
+		_, err := snap.ReadSnapshotYamlFromSnapFile(snapdir.New(d))
+		c.Check(err, ErrorMatches, t.err, Commentf("%q", t.yaml))
+	}
+}
@@ -22,6 +22,7 @@ package squashfs
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -30,6 +31,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -484,9 +486,40 @@ func (m MksquashfsError) Error() string {
 }
 
 type BuildOpts struct {
-	SnapType     string
-	Compression  string
-	ExcludeFiles []string
+	SnapType    string
+	Compression string
+	// CompressionLevel is the level of the compression, for the
+	// algorithms that support one. Zero means the default level.
+	CompressionLevel int
+	ExcludeFiles     []string
+}
+
+// compressionLevels are the ranges of levels supported by the
+// compression algorithms.
+var compressionLevels = map[string][2]int{
+	"gzip": {1, 9},
+	"lzo":  {1, 9},
+	"zstd": {1, 22},
+}
+
+// ValidateCompressionLevel checks that the given level can be used with
+// the compression algorithm. A zero level, meaning the default one, is
+// always valid.
+func ValidateCompressionLevel(compression string, level int) error {
+	if level == 0 {
+		return nil
+	}
+	if compression == "" {
+		compression = "xz"
+	}
+	levels, ok := compressionLevels[compression]
+	if !ok {
+		return fmt.Errorf("cannot use a compression level with compression %q", compression)
+	}
+	if level < levels[0] || level > levels[1] {
+		return fmt.Errorf("cannot use compression level %d with compression %q, expected a level between %d and %d", level, compression, levels[0], levels[1])
+	}
+	return nil
 }
 
 // Build builds the snap.
@@ -502,12 +535,11 @@ func (s *Snap) Build(sourceDir string, opts *BuildOpts) error {
 	if err != nil {
 		return err
 	}
-	// default to xz
+	// default to xz, other compression options can be faster for
+	// certain apps, see
+	// https://forum.snapcraft.io/t/squashfs-performance-effect-on-snap-startup-time/13920
 	compression := opts.Compression
 	if compression == "" {
-		// TODO: support other compression options, xz is very
-		// slow for certain apps, see
-		// https://forum.snapcraft.io/t/squashfs-performance-effect-on-snap-startup-time/13920
 		compression = "xz"
 	}
 	cmd, err := snapdtoolCommandFromSystemSnap("/usr/bin/mksquashfs")
@@ -521,6 +553,12 @@ func (s *Snap) Build(sourceDir string, opts *BuildOpts) error {
 		"-no-fragments",
 		"-no-progress",
 	)
+	if err := ValidateCompressionLevel(compression, opts.CompressionLevel); err != nil {
+		return err
+	}
+	if opts.CompressionLevel != 0 {
+		cmd.Args = append(cmd.Args, "-Xcompression-level", strconv.Itoa(opts.CompressionLevel))
+	}
 	if len(opts.ExcludeFiles) > 0 {
 		cmd.Args = append(cmd.Args, "-wildcards")
 		for _, excludeFile := range opts.ExcludeFiles {
@@ -542,6 +580,50 @@ func (s *Snap) Build(sourceDir string, opts *BuildOpts) error {
 	})
 }
 
+// compressionIDs maps the compression ids stored in the superblock to
+// their names, see
+// https://github.com/plougher/squashfs-tools/blob/master/squashfs-tools/squashfs_fs.h
+var compressionIDs = map[uint16]string{
+	1: "gzip",
+	2: "lzma",
+	3: "lzo",
+	4: "xz",
+	5: "lz4",
+	6: "zstd",
+}
+
+// Compression returns the compression algorithm of the snap, as
+// recorded in its superblock.
+func (s *Snap) Compression() (string, error) {
+	return Compression(s.path)
+}
+
+// Compression returns the compression algorithm of the squashfs file
+// at the given path, as recorded in its superblock.
+func Compression(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	superblock := make([]byte, superblockSize)
+	if _, err := io.ReadFull(f, superblock); err != nil {
+		return "", fmt.Errorf("cannot read superblock of %q: %v", path, err)
+	}
+	if !bytes.HasPrefix(superblock, magic) {
+		return "", fmt.Errorf("cannot read superblock of %q: not a squashfs file", path)
+	}
+	// the compression id is a little-endian 16bit integer at offset
+	// 20 of the superblock
+	id := binary.LittleEndian.Uint16(superblock[20:22])
+	compression, ok := compressionIDs[id]
+	if !ok {
+		return "", fmt.Errorf("cannot read superblock of %q: unknown compression id %d", path, id)
+	}
+	return compression, nil
+}
+
 // BuildDate returns the "Creation or last append time" as reported by unsquashfs.
 func (s *Snap) BuildDate() time.Time {
 	return BuildDate(s.path)
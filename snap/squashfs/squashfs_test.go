@@ -20,6 +20,7 @@
 package squashfs_test
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -573,6 +574,80 @@ func (s *SquashfsTestSuite) TestBuildSupportsMultipleExcludesWithOnlyOneWildcard
 	})
 }
 
+func (s *SquashfsTestSuite) TestBuildWithCompressionLevel(c *C) {
+	defer squashfs.MockCommandFromSystemSnap(func(cmd string, args ...string) (*exec.Cmd, error) {
+		return nil, errors.New("bzzt")
+	})()
+	mksq := testutil.MockCommand(c, "mksquashfs", "")
+	defer mksq.Restore()
+
+	snapPath := filepath.Join(c.MkDir(), "foo.snap")
+	sn := squashfs.New(snapPath)
+	err := sn.Build(c.MkDir(), &squashfs.BuildOpts{
+		SnapType:         "core",
+		Compression:      "zstd",
+		CompressionLevel: 15,
+	})
+	c.Assert(err, IsNil)
+	c.Check(mksq.Calls(), DeepEquals, [][]string{{
+		"mksquashfs", ".", snapPath, "-noappend", "-comp", "zstd", "-no-fragments", "-no-progress",
+		"-Xcompression-level", "15",
+	}})
+}
+
+func (s *SquashfsTestSuite) TestValidateCompressionLevel(c *C) {
+	for _, tc := range []struct {
+		compression string
+		level       int
+		err         string
+	}{
+		{"xz", 0, ""},
+		{"lz4", 0, ""},
+		{"zstd", 1, ""},
+		{"zstd", 22, ""},
+		{"lzo", 9, ""},
+		{"zstd", 23, `cannot use compression level 23 with compression "zstd", expected a level between 1 and 22`},
+		{"lzo", -1, `cannot use compression level -1 with compression "lzo", expected a level between 1 and 9`},
+		{"lz4", 3, `cannot use a compression level with compression "lz4"`},
+		{"", 3, `cannot use a compression level with compression "xz"`},
+	} {
+		err := squashfs.ValidateCompressionLevel(tc.compression, tc.level)
+		if tc.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, tc.err)
+		}
+	}
+}
+
+func (s *SquashfsTestSuite) TestCompression(c *C) {
+	superblock := func(id uint16) []byte {
+		sb := make([]byte, squashfs.SuperblockSize)
+		copy(sb, "hsqs")
+		binary.LittleEndian.PutUint16(sb[20:], id)
+		return sb
+	}
+	p := filepath.Join(c.MkDir(), "foo.snap")
+	for id, expected := range map[uint16]string{1: "gzip", 3: "lzo", 4: "xz", 5: "lz4", 6: "zstd"} {
+		c.Assert(ioutil.WriteFile(p, superblock(id), 0644), IsNil)
+		compression, err := squashfs.New(p).Compression()
+		c.Assert(err, IsNil)
+		c.Check(compression, Equals, expected)
+	}
+
+	c.Assert(ioutil.WriteFile(p, superblock(42), 0644), IsNil)
+	_, err := squashfs.Compression(p)
+	c.Check(err, ErrorMatches, `cannot read superblock of ".*/foo.snap": unknown compression id 42`)
+
+	c.Assert(ioutil.WriteFile(p, []byte("hsqs"), 0644), IsNil)
+	_, err = squashfs.Compression(p)
+	c.Check(err, ErrorMatches, `cannot read superblock of ".*/foo.snap": unexpected EOF`)
+
+	c.Assert(ioutil.WriteFile(p, make([]byte, squashfs.SuperblockSize), 0644), IsNil)
+	_, err = squashfs.Compression(p)
+	c.Check(err, ErrorMatches, `cannot read superblock of ".*/foo.snap": not a squashfs file`)
+}
+
 func (s *SquashfsTestSuite) TestBuildUsesMksquashfsFromCoreIfAvailable(c *C) {
 	usedFromCore := false
 	defer squashfs.MockCommandFromSystemSnap(func(cmd string, args ...string) (*exec.Cmd, error) {
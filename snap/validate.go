@@ -1078,6 +1078,33 @@ func ValidateSystemUsernames(info *Info) error {
 	return nil
 }
 
+var snapshotExcludeVars = []string{"$SNAP_DATA", "$SNAP_COMMON", "$SNAP_USER_DATA", "$SNAP_USER_COMMON"}
+
+// ValidateSnapshotOptions checks that the snapshot exclusion patterns
+// only refer to the snap's data directories, and only use the wildcards
+// that are supported.
+func ValidateSnapshotOptions(opts *SnapshotOptions) error {
+	for _, pattern := range opts.Exclude {
+		var rel string
+		for _, v := range snapshotExcludeVars {
+			if strings.HasPrefix(pattern, v+"/") {
+				rel = pattern[len(v)+1:]
+				break
+			}
+		}
+		if rel == "" {
+			return fmt.Errorf("snapshot exclude path must start with one of %s: %q", strings.Join(snapshotExcludeVars, ", "), pattern)
+		}
+		if filepath.Clean(rel) != rel || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("snapshot exclude path must be clean: %q", pattern)
+		}
+		if strings.ContainsAny(rel, "$[]{}\\") {
+			return fmt.Errorf("snapshot exclude path contains unsupported characters: %q", pattern)
+		}
+	}
+	return nil
+}
+
 // NeededDefaultProviders returns a map keyed by the names of all
 // default-providers for the content plugs that the given snap.Info
 // needs. The map values are the corresponding content tags.
@@ -2017,3 +2017,35 @@ func (s *ValidateSuite) TestAppInstallMode(c *C) {
 	err := ValidateApp(&AppInfo{Name: "foo", Daemon: "", InstallMode: "disable"})
 	c.Check(err, ErrorMatches, `"install-mode" cannot be used for "foo", only for services`)
 }
+
+func (s *ValidateSuite) TestValidateSnapshotOptions(c *C) {
+	for _, pattern := range []string{
+		"$SNAP_DATA/cache",
+		"$SNAP_COMMON/*.log",
+		"$SNAP_USER_DATA/.cache/thumbnails",
+		"$SNAP_USER_COMMON/tmp-??",
+	} {
+		c.Check(ValidateSnapshotOptions(&SnapshotOptions{Exclude: []string{pattern}}), IsNil, Commentf("%q", pattern))
+	}
+
+	for _, t := range []struct {
+		pattern, err string
+	}{
+		{"", `snapshot exclude path must start with one of \$SNAP_DATA, \$SNAP_COMMON, \$SNAP_USER_DATA, \$SNAP_USER_COMMON: ""`},
+		{"cache", `snapshot exclude path must start with one of .*: "cache"`},
+		{"/var/snap/foo/common/cache", `snapshot exclude path must start with one of .*: "/var/snap/foo/common/cache"`},
+		{"$SNAP/cache", `snapshot exclude path must start with one of .*: "\$SNAP/cache"`},
+		{"$SNAP_DATA", `snapshot exclude path must start with one of .*: "\$SNAP_DATA"`},
+		{"$SNAP_DATA/", `snapshot exclude path must start with one of .*: "\$SNAP_DATA/"`},
+		{"$SNAP_DATA/.", `snapshot exclude path must be clean: "\$SNAP_DATA/."`},
+		{"$SNAP_DATA/../common", `snapshot exclude path must be clean: "\$SNAP_DATA/../common"`},
+		{"$SNAP_DATA/a//b", `snapshot exclude path must be clean: "\$SNAP_DATA/a//b"`},
+		{"$SNAP_DATA/cache/", `snapshot exclude path must be clean: "\$SNAP_DATA/cache/"`},
+		{"$SNAP_DATA/[ab]", `snapshot exclude path contains unsupported characters: "\$SNAP_DATA/\[ab\]"`},
+		{"$SNAP_DATA/{a,b}", `snapshot exclude path contains unsupported characters: .*`},
+		{"$SNAP_DATA/$SNAP_NAME", `snapshot exclude path contains unsupported characters: .*`},
+	} {
+		err := ValidateSnapshotOptions(&SnapshotOptions{Exclude: []string{"$SNAP_DATA/ok", t.pattern}})
+		c.Check(err, ErrorMatches, t.err, Commentf("%q", t.pattern))
+	}
+}
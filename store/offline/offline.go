@@ -0,0 +1,821 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package offline implements a store serving snaps and assertions out
+// of a local directory, for systems without access to the network.
+//
+// The snap files are found in the snaps directory, as *.snap files, and
+// are matched to their snap-revision assertions by their digest. The
+// assertions directory holds *.assert files with the assertions of the
+// snaps and their prerequisites, as exported by "snap download" or
+// "snap known". An optional channels.yaml file maps the snap names to
+// the full names of their channels and the revisions released there;
+// the latest revision of the snaps not listed is released in
+// latest/stable.
+package offline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+	"gopkg.in/yaml.v2"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/overlord/auth"
+	"github.com/snapcore/snapd/progress"
+	"github.com/snapcore/snapd/release"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/channel"
+	"github.com/snapcore/snapd/snap/snapfile"
+	"github.com/snapcore/snapd/store"
+)
+
+// ErrOffline is returned by the operations that need the online store.
+var ErrOffline = errors.New("cannot use the online store in offline mode")
+
+var channelRisks = []string{"stable", "candidate", "beta", "edge"}
+
+// assertionURLScheme is the scheme of the stream URLs used to return the
+// assertions from SnapAction, fetched later by DownloadAssertions.
+const assertionURLScheme = "offline-assertion"
+
+var openSnapFile = snapfile.Open
+
+// snapRevision is a snap file known to the store.
+type snapRevision struct {
+	path string
+	// info holds the metadata of the snap revision, without channel
+	info *snap.Info
+}
+
+// cachedSnapFile avoids reading and hashing again the unchanged snap files.
+type cachedSnapFile struct {
+	size    int64
+	modTime time.Time
+	digest  string
+	info    *snap.Info
+}
+
+// index holds the content of the directory of the store.
+type index struct {
+	assertions map[string]asserts.Assertion
+	// revisions of each snap, by name, from the latest
+	revisions map[string][]*snapRevision
+	bySHA3    map[string]*snapRevision
+	// channels maps the snap names to their full channel names and
+	// the revisions released there
+	channels map[string]map[string]snap.Revision
+}
+
+// Store serves snaps and assertions from a local directory.
+type Store struct {
+	dir string
+
+	mu        sync.Mutex
+	snapFiles map[string]*cachedSnapFile
+}
+
+// New returns a store serving the content of the given directory.
+func New(dir string) *Store {
+	return &Store{
+		dir:       dir,
+		snapFiles: make(map[string]*cachedSnapFile),
+	}
+}
+
+// Dir returns the directory served by the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) loadAssertions(idx *index) error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "assertions", "*.assert"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		dec := asserts.NewDecoder(f)
+		for {
+			a, err := dec.Decode()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return fmt.Errorf("cannot read assertions from %q: %v", p, err)
+			}
+			uniq := a.Ref().Unique()
+			if old := idx.assertions[uniq]; old == nil || old.Revision() < a.Revision() {
+				idx.assertions[uniq] = a
+			}
+		}
+		f.Close()
+	}
+	return nil
+}
+
+func (s *Store) findAssertion(idx *index, assertType *asserts.AssertionType, primaryKey ...string) asserts.Assertion {
+	ref := &asserts.Ref{Type: assertType, PrimaryKey: primaryKey}
+	return idx.assertions[ref.Unique()]
+}
+
+// snapFile returns the digest and metadata of the given snap file, reading
+// it only if it changed.
+func (s *Store) snapFile(path string) (*cachedSnapFile, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if c := s.snapFiles[path]; c != nil && c.size == fi.Size() && c.modTime.Equal(fi.ModTime()) {
+		return c, nil
+	}
+	digest, _, err := asserts.SnapFileSHA3_384(path)
+	if err != nil {
+		return nil, err
+	}
+	container, err := openSnapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := snap.ReadInfoFromSnapFile(container, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &cachedSnapFile{
+		size:    fi.Size(),
+		modTime: fi.ModTime(),
+		digest:  digest,
+		info:    info,
+	}
+	s.snapFiles[path] = c
+	return c, nil
+}
+
+func (s *Store) loadSnaps(idx *index) error {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "snaps", "*.snap"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		c, err := s.snapFile(p)
+		if err != nil {
+			logger.Noticef("Cannot read snap %q of the offline store: %v", p, err)
+			continue
+		}
+		a := s.findAssertion(idx, asserts.SnapRevisionType, c.digest)
+		if a == nil {
+			logger.Noticef("Cannot find the snap-revision assertion of snap %q of the offline store", p)
+			continue
+		}
+		snapRev := a.(*asserts.SnapRevision)
+		a = s.findAssertion(idx, asserts.SnapDeclarationType, release.Series, snapRev.SnapID())
+		if a == nil {
+			logger.Noticef("Cannot find the snap-declaration assertion of snap %q of the offline store", p)
+			continue
+		}
+		snapDecl := a.(*asserts.SnapDeclaration)
+
+		// copy the metadata of the file, completed with the store ones
+		info := *c.info
+		info.SideInfo = snap.SideInfo{
+			RealName: snapDecl.SnapName(),
+			SnapID:   snapDecl.SnapID(),
+			Revision: snap.R(snapRev.SnapRevision()),
+		}
+		info.Publisher = snap.StoreAccount{ID: snapDecl.PublisherID()}
+		if a := s.findAssertion(idx, asserts.AccountType, snapDecl.PublisherID()); a != nil {
+			acct := a.(*asserts.Account)
+			info.Publisher.Username = acct.Username()
+			info.Publisher.DisplayName = acct.DisplayName()
+			info.Publisher.Validation = acct.Validation()
+		}
+		// the store gives hex digests, the assertions base64 ones
+		bdigest, err := base64.RawURLEncoding.DecodeString(c.digest)
+		if err != nil {
+			return err
+		}
+		sha3_384 := hex.EncodeToString(bdigest)
+		info.DownloadInfo = snap.DownloadInfo{
+			DownloadURL: (&url.URL{Scheme: "file", Path: p}).String(),
+			Size:        int64(snapRev.SnapSize()),
+			Sha3_384:    sha3_384,
+		}
+
+		rev := &snapRevision{path: p, info: &info}
+		idx.revisions[info.SnapName()] = append(idx.revisions[info.SnapName()], rev)
+		idx.bySHA3[sha3_384] = rev
+	}
+	for _, revs := range idx.revisions {
+		sort.Slice(revs, func(i, j int) bool {
+			return revs[i].info.Revision.N > revs[j].info.Revision.N
+		})
+	}
+	return nil
+}
+
+func (s *Store) loadChannels(idx *index) error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, "channels.yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var channels map[string]map[string]snap.Revision
+	if err := yaml.Unmarshal(data, &channels); err != nil {
+		return fmt.Errorf("cannot parse channels of the offline store: %v", err)
+	}
+	for name, revs := range idx.revisions {
+		snapChannels := make(map[string]snap.Revision)
+		if chans, ok := channels[name]; ok {
+			for ch, rev := range chans {
+				full, err := channel.Full(ch)
+				if err != nil {
+					return fmt.Errorf("cannot parse channels of the offline store: %v", err)
+				}
+				snapChannels[full] = rev
+			}
+		} else {
+			snapChannels["latest/stable"] = revs[0].info.Revision
+		}
+		idx.channels[name] = snapChannels
+	}
+	return nil
+}
+
+// index reads the content of the directory of the store.
+func (s *Store) index() (*index, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !osutil.IsDirectory(s.dir) {
+		return nil, fmt.Errorf("cannot find the offline store directory %q", s.dir)
+	}
+	idx := &index{
+		assertions: make(map[string]asserts.Assertion),
+		revisions:  make(map[string][]*snapRevision),
+		bySHA3:     make(map[string]*snapRevision),
+		channels:   make(map[string]map[string]snap.Revision),
+	}
+	if err := s.loadAssertions(idx); err != nil {
+		return nil, err
+	}
+	if err := s.loadSnaps(idx); err != nil {
+		return nil, err
+	}
+	if err := s.loadChannels(idx); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+func (idx *index) revision(name string, rev snap.Revision) *snapRevision {
+	for _, r := range idx.revisions[name] {
+		if r.info.Revision == rev {
+			return r
+		}
+	}
+	return nil
+}
+
+// resolveChannel returns the revision of the snap released in the given
+// channel, following the more stable risks of the track like the store
+// does for closed channels, and the full name of the channel it was
+// found in.
+func (idx *index) resolveChannel(name, ch string) (*snapRevision, string) {
+	if ch == "" {
+		ch = "stable"
+	}
+	c, err := channel.Parse(ch, "")
+	if err != nil {
+		return nil, ""
+	}
+	channels := idx.channels[name]
+	try := func(full string) (*snapRevision, string) {
+		if rev, ok := channels[full]; ok {
+			if r := idx.revision(name, rev); r != nil {
+				return r, full
+			}
+		}
+		return nil, ""
+	}
+	if c.Branch != "" {
+		return try(c.Full())
+	}
+	track := c.Track
+	if track == "" {
+		track = "latest"
+	}
+	level := 0
+	for i, risk := range channelRisks {
+		if risk == c.Risk {
+			level = i
+		}
+	}
+	for i := level; i >= 0; i-- {
+		if r, full := try(track + "/" + channelRisks[i]); r != nil {
+			return r, full
+		}
+	}
+	return nil, ""
+}
+
+// infoAt returns the info of the given snap revision in the given channel.
+func (idx *index) infoAt(rev *snapRevision, ch string) *snap.Info {
+	info := *rev.info
+	info.Channel = ch
+	name := info.SnapName()
+	info.Channels = make(map[string]*snap.ChannelSnapInfo, len(idx.channels[name]))
+	seenTracks := make(map[string]bool)
+	var chNames []string
+	for chName := range idx.channels[name] {
+		chNames = append(chNames, chName)
+	}
+	sort.Strings(chNames)
+	for _, chName := range chNames {
+		r := idx.revision(name, idx.channels[name][chName])
+		if r == nil {
+			continue
+		}
+		info.Channels[chName] = &snap.ChannelSnapInfo{
+			Revision:    r.info.Revision,
+			Confinement: r.info.Confinement,
+			Version:     r.info.Version,
+			Channel:     chName,
+			Epoch:       r.info.Epoch,
+			Size:        r.info.Size,
+		}
+		track := strings.SplitN(chName, "/", 2)[0]
+		if !seenTracks[track] {
+			seenTracks[track] = true
+			info.Tracks = append(info.Tracks, track)
+		}
+	}
+	return &info
+}
+
+// resolve returns the info of the snap matching the given channel or
+// revision.
+func (idx *index) resolve(action, name, ch string, rev snap.Revision) (*snap.Info, error) {
+	if len(idx.revisions[name]) == 0 {
+		return nil, store.ErrSnapNotFound
+	}
+	if !rev.Unset() {
+		r := idx.revision(name, rev)
+		if r == nil {
+			return nil, &store.RevisionNotAvailableError{Action: action, Channel: ch}
+		}
+		return idx.infoAt(r, ""), nil
+	}
+	r, full := idx.resolveChannel(name, ch)
+	if r == nil {
+		return nil, &store.RevisionNotAvailableError{Action: action, Channel: ch}
+	}
+	return idx.infoAt(r, full), nil
+}
+
+// EnsureDeviceSession is part of the snapstate.StoreService interface,
+// there are no device sessions in offline mode.
+func (s *Store) EnsureDeviceSession() (*auth.DeviceState, error) {
+	return nil, nil
+}
+
+// SnapInfo returns the info of the snap released in the stable channel.
+func (s *Store) SnapInfo(ctx context.Context, spec store.SnapSpec, user *auth.UserState) (*snap.Info, error) {
+	idx, err := s.index()
+	if err != nil {
+		return nil, err
+	}
+	info, err := idx.resolve("", snap.InstanceSnap(spec.Name), "", snap.Revision{})
+	if _, ok := err.(*store.RevisionNotAvailableError); ok {
+		// like the store, snaps without released revisions are not found
+		return nil, store.ErrSnapNotFound
+	}
+	return info, err
+}
+
+// Find returns the released snaps whose name or summary match the search.
+func (s *Store) Find(ctx context.Context, search *store.Search, user *auth.UserState) ([]*snap.Info, error) {
+	if search.Private || search.Category != "" || search.CommonID != "" {
+		return nil, nil
+	}
+	idx, err := s.index()
+	if err != nil {
+		return nil, err
+	}
+	query := strings.ToLower(search.Query)
+	var names []string
+	for name := range idx.revisions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var infos []*snap.Info
+	for _, name := range names {
+		info, err := idx.resolve("", name, "", snap.Revision{})
+		if err != nil {
+			continue
+		}
+		var match bool
+		switch {
+		case search.Prefix:
+			match = strings.HasPrefix(name, query)
+		default:
+			match = strings.Contains(name, query) || strings.Contains(strings.ToLower(info.Summary()), query)
+		}
+		if match {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// SnapAction resolves the install, download and refresh actions, and the
+// assertions queries, against the content of the directory.
+func (s *Store) SnapAction(ctx context.Context, currentSnaps []*store.CurrentSnap, actions []*store.SnapAction, assertQuery store.AssertionQuery, user *auth.UserState, opts *store.RefreshOptions) ([]store.SnapActionResult, []store.AssertionResult, error) {
+	var toResolve map[asserts.Grouping][]*asserts.AtRevision
+	if assertQuery != nil {
+		var err error
+		toResolve, err = assertQuery.ToResolve()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(currentSnaps) == 0 && len(actions) == 0 && len(toResolve) == 0 {
+		// nothing to do
+		return nil, nil, &store.SnapActionError{NoResults: true}
+	}
+
+	idx, err := s.index()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	curSnaps := make(map[string]*store.CurrentSnap, len(currentSnaps))
+	for _, cur := range currentSnaps {
+		if cur.SnapID == "" || cur.InstanceName == "" || cur.Revision.Unset() {
+			return nil, nil, fmt.Errorf("internal error: invalid current snap information")
+		}
+		curSnaps[cur.InstanceName] = cur
+	}
+
+	installErrors := make(map[string]error)
+	downloadErrors := make(map[string]error)
+	refreshErrors := make(map[string]error)
+	var sars []store.SnapActionResult
+	for _, a := range actions {
+		if a.InstanceName == "" {
+			return nil, nil, fmt.Errorf("internal error: action without instance name")
+		}
+		name, instanceKey := snap.SplitInstanceName(a.InstanceName)
+		switch a.Action {
+		case "install", "download":
+			errs := installErrors
+			if a.Action == "download" {
+				errs = downloadErrors
+			}
+			info, err := idx.resolve(a.Action, name, a.Channel, a.Revision)
+			if err != nil {
+				errs[a.InstanceName] = err
+				continue
+			}
+			if a.Action == "install" {
+				info.InstanceKey = instanceKey
+			}
+			sars = append(sars, store.SnapActionResult{Info: info})
+		case "refresh":
+			cur := curSnaps[a.InstanceName]
+			if cur == nil {
+				return nil, nil, fmt.Errorf("internal error: refresh of snap %q not in the context", a.InstanceName)
+			}
+			ch := a.Channel
+			if ch == "" && a.Revision.Unset() {
+				ch = cur.TrackingChannel
+			}
+			// the snap is known by its snap id, its name could change
+			var snapName string
+			if a := s.findAssertion(idx, asserts.SnapDeclarationType, release.Series, cur.SnapID); a != nil {
+				snapName = a.(*asserts.SnapDeclaration).SnapName()
+			}
+			info, err := idx.resolve("refresh", snapName, ch, a.Revision)
+			if err != nil {
+				refreshErrors[a.InstanceName] = err
+				continue
+			}
+			if info.Revision == cur.Revision || revisionIn(info.Revision, cur.Block) {
+				refreshErrors[a.InstanceName] = store.ErrNoUpdateAvailable
+				continue
+			}
+			// like the store, do not offer revisions that cannot
+			// read the data of the current one
+			if !info.Epoch.CanRead(cur.Epoch) {
+				refreshErrors[a.InstanceName] = store.ErrNoUpdateAvailable
+				continue
+			}
+			info.InstanceKey = instanceKey
+			sars = append(sars, store.SnapActionResult{Info: info})
+		default:
+			return nil, nil, fmt.Errorf("internal error: unsupported action %q", a.Action)
+		}
+	}
+
+	var ars []store.AssertionResult
+	for grp, ats := range toResolve {
+		var urls []string
+		for _, at := range ats {
+			a := idx.assertions[at.Ref.Unique()]
+			if a == nil {
+				if at.Revision == asserts.RevisionNotKnown {
+					headers, _ := asserts.HeadersFromPrimaryKey(at.Type, at.PrimaryKey)
+					assertQuery.AddError(&asserts.NotFoundError{Type: at.Type, Headers: headers}, &at.Ref)
+				}
+				continue
+			}
+			if at.Revision != asserts.RevisionNotKnown && a.Revision() <= at.Revision {
+				// up to date
+				continue
+			}
+			urls = append(urls, assertionURL(&at.Ref))
+		}
+		if len(urls) > 0 {
+			ars = append(ars, store.AssertionResult{Grouping: grp, StreamURLs: urls})
+		}
+	}
+
+	if len(installErrors)+len(downloadErrors)+len(refreshErrors) != 0 || len(sars)+len(ars) == 0 {
+		saErr := &store.SnapActionError{
+			NoResults: len(sars)+len(ars) == 0 && len(installErrors)+len(downloadErrors)+len(refreshErrors) == 0,
+		}
+		if len(installErrors) != 0 {
+			saErr.Install = installErrors
+		}
+		if len(downloadErrors) != 0 {
+			saErr.Download = downloadErrors
+		}
+		if len(refreshErrors) != 0 {
+			saErr.Refresh = refreshErrors
+		}
+		return sars, ars, saErr
+	}
+	return sars, ars, nil
+}
+
+func revisionIn(needle snap.Revision, haystack []snap.Revision) bool {
+	for _, r := range haystack {
+		if needle == r {
+			return true
+		}
+	}
+	return false
+}
+
+func assertionURL(ref *asserts.Ref) string {
+	u := url.URL{
+		Scheme: assertionURLScheme,
+		Opaque: ref.Type.Name,
+	}
+	for _, k := range ref.PrimaryKey {
+		u.Opaque += "/" + url.PathEscape(k)
+	}
+	return u.String()
+}
+
+func refFromAssertionURL(ustr string) (*asserts.Ref, error) {
+	u, err := url.Parse(ustr)
+	if err != nil || u.Scheme != assertionURLScheme {
+		return nil, fmt.Errorf("invalid assertions stream URL %q", ustr)
+	}
+	parts := strings.Split(u.Opaque, "/")
+	assertType := asserts.Type(parts[0])
+	if assertType == nil {
+		return nil, fmt.Errorf("invalid assertions stream URL %q", ustr)
+	}
+	ref := &asserts.Ref{Type: assertType}
+	for _, p := range parts[1:] {
+		k, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid assertions stream URL %q", ustr)
+		}
+		ref.PrimaryKey = append(ref.PrimaryKey, k)
+	}
+	return ref, nil
+}
+
+// Sections is part of the snapstate.StoreService interface, the offline
+// store has no sections.
+func (s *Store) Sections(ctx context.Context, user *auth.UserState) ([]string, error) {
+	return nil, nil
+}
+
+// WriteCatalogs writes the names of the released snaps and their commands.
+func (s *Store) WriteCatalogs(ctx context.Context, names io.Writer, adder store.SnapAdder) error {
+	idx, err := s.index()
+	if err != nil {
+		return err
+	}
+	var snapNames []string
+	for name := range idx.revisions {
+		snapNames = append(snapNames, name)
+	}
+	sort.Strings(snapNames)
+	for _, name := range snapNames {
+		info, err := idx.resolve("", name, "", snap.Revision{})
+		if err != nil {
+			continue
+		}
+		if _, err := fmt.Fprintln(names, name); err != nil {
+			return err
+		}
+		var commands []string
+		for appName := range info.Apps {
+			commands = append(commands, snap.JoinSnapApp(name, appName))
+		}
+		sort.Strings(commands)
+		if err := adder.AddSnap(name, info.Version, info.Summary(), commands); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) snapRevisionFile(downloadInfo *snap.DownloadInfo) (string, error) {
+	idx, err := s.index()
+	if err != nil {
+		return "", err
+	}
+	rev := idx.bySHA3[downloadInfo.Sha3_384]
+	if rev == nil {
+		return "", fmt.Errorf("cannot find snap with digest %s in the offline store", downloadInfo.Sha3_384)
+	}
+	return rev.path, nil
+}
+
+// Download copies the snap file matching the download info to the target
+// path.
+func (s *Store) Download(ctx context.Context, name, targetPath string, downloadInfo *snap.DownloadInfo, pbar progress.Meter, user *auth.UserState, dlOpts *store.DownloadOptions) error {
+	src, err := s.snapRevisionFile(downloadInfo)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := osutil.NewAtomicFile(targetPath, 0600, 0, osutil.NoChown, osutil.NoChown)
+	if err != nil {
+		return err
+	}
+	defer out.Cancel()
+
+	if pbar == nil {
+		pbar = progress.Null
+	}
+	pbar.Start(name, float64(downloadInfo.Size))
+	defer pbar.Finished()
+	// as with the online store, check what was downloaded
+	h := sha3.New384()
+	if _, err := io.Copy(io.MultiWriter(out, h, pbar), in); err != nil {
+		return err
+	}
+	digest := fmt.Sprintf("%x", h.Sum(nil))
+	if digest != downloadInfo.Sha3_384 {
+		return fmt.Errorf("sha3-384 mismatch for %q: got %s but expected %s", name, digest, downloadInfo.Sha3_384)
+	}
+	return out.Commit()
+}
+
+// DownloadStream returns a stream of the snap file matching the download
+// info, starting at the given offset.
+func (s *Store) DownloadStream(ctx context.Context, name string, downloadInfo *snap.DownloadInfo, resume int64, user *auth.UserState) (io.ReadCloser, int, error) {
+	src, err := s.snapRevisionFile(downloadInfo)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	status := 200
+	if resume > 0 {
+		if _, err := f.Seek(resume, io.SeekStart); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		status = 206
+	}
+	return f, status, nil
+}
+
+// Assertion returns the assertion with the given type and primary key.
+func (s *Store) Assertion(assertType *asserts.AssertionType, primaryKey []string, user *auth.UserState) (asserts.Assertion, error) {
+	idx, err := s.index()
+	if err != nil {
+		return nil, err
+	}
+	a := s.findAssertion(idx, assertType, primaryKey...)
+	if a == nil {
+		headers, _ := asserts.HeadersFromPrimaryKey(assertType, primaryKey)
+		return nil, &asserts.NotFoundError{
+			Type:    assertType,
+			Headers: headers,
+		}
+	}
+	return a, nil
+}
+
+// DownloadAssertions adds to the batch the assertions returned by
+// SnapAction.
+func (s *Store) DownloadAssertions(streamURLs []string, b *asserts.Batch, user *auth.UserState) error {
+	idx, err := s.index()
+	if err != nil {
+		return err
+	}
+	for _, ustr := range streamURLs {
+		ref, err := refFromAssertionURL(ustr)
+		if err != nil {
+			return err
+		}
+		a := idx.assertions[ref.Unique()]
+		if a == nil {
+			headers, _ := asserts.HeadersFromPrimaryKey(ref.Type, ref.PrimaryKey)
+			return &asserts.NotFoundError{Type: ref.Type, Headers: headers}
+		}
+		if err := b.Add(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SuggestedCurrency is part of the snapstate.StoreService interface.
+func (s *Store) SuggestedCurrency() string {
+	return ""
+}
+
+// Buy is part of the snapstate.StoreService interface.
+func (s *Store) Buy(options *client.BuyOptions, user *auth.UserState) (*client.BuyResult, error) {
+	return nil, ErrOffline
+}
+
+// ReadyToBuy is part of the snapstate.StoreService interface.
+func (s *Store) ReadyToBuy(*auth.UserState) error {
+	return ErrOffline
+}
+
+// ConnectivityCheck reports whether the directory of the store is
+// available.
+func (s *Store) ConnectivityCheck() (map[string]bool, error) {
+	return map[string]bool{s.dir: osutil.IsDirectory(s.dir)}, nil
+}
+
+// CreateCohorts is part of the snapstate.StoreService interface.
+func (s *Store) CreateCohorts(context.Context, []string) (map[string]string, error) {
+	return nil, ErrOffline
+}
+
+// LoginUser is part of the snapstate.StoreService interface.
+func (s *Store) LoginUser(username, password, otp string) (string, string, error) {
+	return "", "", ErrOffline
+}
+
+// UserInfo is part of the snapstate.StoreService interface.
+func (s *Store) UserInfo(email string) (*store.User, error) {
+	return nil, ErrOffline
+}
@@ -0,0 +1,476 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package offline_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/snapd/asserts"
+	"github.com/snapcore/snapd/asserts/assertstest"
+	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/snapdir"
+	"github.com/snapcore/snapd/store"
+	"github.com/snapcore/snapd/store/offline"
+	"github.com/snapcore/snapd/testutil"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type offlineSuite struct {
+	testutil.BaseTest
+
+	dir          string
+	storeSigning *assertstest.StoreStack
+	devAcct      *asserts.Account
+	// snap.yaml directories of the snap files
+	snapYamls map[string]string
+
+	store *offline.Store
+}
+
+var _ = Suite(&offlineSuite{})
+
+func (s *offlineSuite) SetUpTest(c *C) {
+	s.BaseTest.SetUpTest(c)
+	s.AddCleanup(snap.MockSanitizePlugsSlots(func(snapInfo *snap.Info) {}))
+
+	s.dir = c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(s.dir, "snaps"), 0755), IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(s.dir, "assertions"), 0755), IsNil)
+
+	s.storeSigning = assertstest.NewStoreStack("canonical", nil)
+	s.devAcct = assertstest.NewAccount(s.storeSigning, "developer1", map[string]interface{}{
+		"account-id": "developer1-id",
+	}, "")
+	s.writeAssertions(c, "store.assert", s.storeSigning.StoreAccountKey(""), s.devAcct)
+
+	s.snapYamls = make(map[string]string)
+	s.AddCleanup(offline.MockOpenSnapFile(func(path string) (snap.Container, error) {
+		d, ok := s.snapYamls[path]
+		if !ok {
+			return nil, fmt.Errorf("unexpected snap %q", path)
+		}
+		return snapdir.New(d), nil
+	}))
+
+	s.store = offline.New(s.dir)
+}
+
+func (s *offlineSuite) writeAssertions(c *C, name string, as ...asserts.Assertion) {
+	var buf bytes.Buffer
+	enc := asserts.NewEncoder(&buf)
+	for _, a := range as {
+		c.Assert(enc.Encode(a), IsNil)
+	}
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "assertions", name), buf.Bytes(), 0644), IsNil)
+}
+
+// addSnap adds a revision of a snap and its assertions to the store.
+func (s *offlineSuite) addSnap(c *C, name string, rev int) {
+	content := []byte(fmt.Sprintf("%s-%d", name, rev))
+	p := filepath.Join(s.dir, "snaps", fmt.Sprintf("%s_%d.snap", name, rev))
+	c.Assert(ioutil.WriteFile(p, content, 0644), IsNil)
+
+	yamlDir := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(yamlDir, "meta"), 0755), IsNil)
+	snapYaml := fmt.Sprintf("name: %s\nversion: %d.0\nsummary: The %s snap\napps:\n  %s:\n    command: bin/%s\n", name, rev, name, name, name)
+	c.Assert(ioutil.WriteFile(filepath.Join(yamlDir, "meta", "snap.yaml"), []byte(snapYaml), 0644), IsNil)
+	s.snapYamls[p] = yamlDir
+
+	digest, size, err := asserts.SnapFileSHA3_384(p)
+	c.Assert(err, IsNil)
+	snapDecl, err := s.storeSigning.Sign(asserts.SnapDeclarationType, map[string]interface{}{
+		"series":       "16",
+		"snap-id":      name + "-id",
+		"snap-name":    name,
+		"publisher-id": s.devAcct.AccountID(),
+		"timestamp":    time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	snapRev, err := s.storeSigning.Sign(asserts.SnapRevisionType, map[string]interface{}{
+		"snap-id":       name + "-id",
+		"snap-sha3-384": digest,
+		"snap-size":     fmt.Sprintf("%d", size),
+		"snap-revision": fmt.Sprintf("%d", rev),
+		"developer-id":  s.devAcct.AccountID(),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}, nil, "")
+	c.Assert(err, IsNil)
+	s.writeAssertions(c, fmt.Sprintf("%s_%d.assert", name, rev), snapDecl, snapRev)
+}
+
+func (s *offlineSuite) writeChannels(c *C, channels string) {
+	c.Assert(ioutil.WriteFile(filepath.Join(s.dir, "channels.yaml"), []byte(channels), 0644), IsNil)
+}
+
+func (s *offlineSuite) TestSnapInfo(c *C) {
+	s.addSnap(c, "foo", 1)
+	s.addSnap(c, "foo", 2)
+
+	info, err := s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "foo"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(info.SnapName(), Equals, "foo")
+	c.Check(info.SnapID, Equals, "foo-id")
+	c.Check(info.Revision, Equals, snap.R(2))
+	c.Check(info.Version, Equals, "2.0")
+	c.Check(info.Channel, Equals, "latest/stable")
+	c.Check(info.Publisher, Equals, snap.StoreAccount{
+		ID:          "developer1-id",
+		Username:    "developer1",
+		DisplayName: "Developer1",
+		Validation:  "unproven",
+	})
+	c.Check(info.Sha3_384, HasLen, 96)
+	c.Check(info.Size, Equals, int64(len("foo-2")))
+	c.Check(info.Tracks, DeepEquals, []string{"latest"})
+	c.Check(info.Channels, HasLen, 1)
+	c.Check(info.Channels["latest/stable"].Revision, Equals, snap.R(2))
+
+	_, err = s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "bar"}, nil)
+	c.Check(err, Equals, store.ErrSnapNotFound)
+}
+
+func (s *offlineSuite) TestSnapInfoMissingAssertions(c *C) {
+	s.addSnap(c, "foo", 1)
+	c.Assert(os.Remove(filepath.Join(s.dir, "assertions", "foo_1.assert")), IsNil)
+
+	_, err := s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "foo"}, nil)
+	c.Check(err, Equals, store.ErrSnapNotFound)
+}
+
+func (s *offlineSuite) TestSnapInfoNoDirectory(c *C) {
+	st := offline.New(filepath.Join(s.dir, "missing"))
+	_, err := st.SnapInfo(context.TODO(), store.SnapSpec{Name: "foo"}, nil)
+	c.Check(err, ErrorMatches, `cannot find the offline store directory ".*/missing"`)
+}
+
+func (s *offlineSuite) TestSnapActionInstall(c *C) {
+	s.addSnap(c, "foo", 1)
+	s.addSnap(c, "foo", 2)
+	s.addSnap(c, "foo", 3)
+	s.writeChannels(c, `
+foo:
+  stable: 1
+  latest/edge: 2
+  2.0/candidate: 3
+`)
+
+	for _, t := range []struct {
+		channel  string
+		revision snap.Revision
+		expected snap.Revision
+		err      error
+	}{
+		{channel: "", expected: snap.R(1)},
+		{channel: "edge", expected: snap.R(2)},
+		// closed channels follow the more stable ones
+		{channel: "beta", expected: snap.R(1)},
+		{channel: "2.0/edge", expected: snap.R(3)},
+		{channel: "2.0/stable", err: &store.RevisionNotAvailableError{Action: "install", Channel: "2.0/stable"}},
+		{revision: snap.R(3), expected: snap.R(3)},
+		{revision: snap.R(4), err: &store.RevisionNotAvailableError{Action: "install"}},
+	} {
+		comment := Commentf("%q %s", t.channel, t.revision)
+		sars, _, err := s.store.SnapAction(context.TODO(), nil, []*store.SnapAction{{
+			Action:       "install",
+			InstanceName: "foo_instance",
+			Channel:      t.channel,
+			Revision:     t.revision,
+		}}, nil, nil, nil)
+		if t.err != nil {
+			c.Check(err, DeepEquals, &store.SnapActionError{
+				Install: map[string]error{"foo_instance": t.err},
+			}, comment)
+			continue
+		}
+		c.Assert(err, IsNil, comment)
+		c.Assert(sars, HasLen, 1, comment)
+		c.Check(sars[0].Info.Revision, Equals, t.expected, comment)
+		c.Check(sars[0].Info.InstanceName(), Equals, "foo_instance", comment)
+		c.Check(sars[0].Info.Tracks, DeepEquals, []string{"2.0", "latest"}, comment)
+	}
+
+	_, _, err := s.store.SnapAction(context.TODO(), nil, []*store.SnapAction{{
+		Action:       "download",
+		InstanceName: "bar",
+	}}, nil, nil, nil)
+	c.Check(err, DeepEquals, &store.SnapActionError{
+		Download: map[string]error{"bar": store.ErrSnapNotFound},
+	})
+}
+
+func (s *offlineSuite) TestSnapActionRefresh(c *C) {
+	s.addSnap(c, "foo", 1)
+	s.addSnap(c, "foo", 2)
+	s.addSnap(c, "bar", 5)
+	s.writeChannels(c, `
+foo:
+  stable: 1
+  candidate: 2
+`)
+
+	current := []*store.CurrentSnap{{
+		InstanceName:    "foo",
+		SnapID:          "foo-id",
+		Revision:        snap.R(1),
+		TrackingChannel: "latest/candidate",
+	}, {
+		InstanceName:    "bar",
+		SnapID:          "bar-id",
+		Revision:        snap.R(5),
+		TrackingChannel: "latest/stable",
+	}}
+	sars, _, err := s.store.SnapAction(context.TODO(), current, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}, {
+		Action:       "refresh",
+		InstanceName: "bar",
+		SnapID:       "bar-id",
+	}}, nil, nil, nil)
+	c.Check(err, DeepEquals, &store.SnapActionError{
+		Refresh: map[string]error{"bar": store.ErrNoUpdateAvailable},
+	})
+	c.Assert(sars, HasLen, 1)
+	c.Check(sars[0].Info.InstanceName(), Equals, "foo")
+	c.Check(sars[0].Info.Revision, Equals, snap.R(2))
+	c.Check(sars[0].Info.Channel, Equals, "latest/candidate")
+
+	// the blocked revisions are not refreshed to
+	current[0].Block = []snap.Revision{snap.R(2)}
+	_, _, err = s.store.SnapAction(context.TODO(), current[:1], []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil, nil)
+	c.Check(err, DeepEquals, &store.SnapActionError{
+		Refresh: map[string]error{"foo": store.ErrNoUpdateAvailable},
+	})
+}
+
+func (s *offlineSuite) TestSnapActionRefreshEpochMismatch(c *C) {
+	s.addSnap(c, "foo", 1)
+	s.addSnap(c, "foo", 2)
+	s.writeChannels(c, `
+foo:
+  stable: 2
+`)
+
+	// revision 2 cannot read the data of the current epoch
+	current := []*store.CurrentSnap{{
+		InstanceName:    "foo",
+		SnapID:          "foo-id",
+		Revision:        snap.R(1),
+		TrackingChannel: "latest/stable",
+		Epoch:           snap.E("5"),
+	}}
+	sars, _, err := s.store.SnapAction(context.TODO(), current, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil, nil)
+	c.Check(err, DeepEquals, &store.SnapActionError{
+		Refresh: map[string]error{"foo": store.ErrNoUpdateAvailable},
+	})
+	c.Check(sars, HasLen, 0)
+
+	// but it can read its own
+	current[0].Epoch = snap.Epoch{}
+	sars, _, err = s.store.SnapAction(context.TODO(), current, []*store.SnapAction{{
+		Action:       "refresh",
+		InstanceName: "foo",
+		SnapID:       "foo-id",
+	}}, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(sars, HasLen, 1)
+	c.Check(sars[0].Info.Revision, Equals, snap.R(2))
+}
+
+func (s *offlineSuite) TestSnapActionNothingToDo(c *C) {
+	_, _, err := s.store.SnapAction(context.TODO(), nil, nil, nil, nil, nil)
+	c.Check(err, DeepEquals, &store.SnapActionError{NoResults: true})
+}
+
+type fakeAssertQuery struct {
+	toResolve map[asserts.Grouping][]*asserts.AtRevision
+	errors    map[string]error
+}
+
+func (q *fakeAssertQuery) ToResolve() (map[asserts.Grouping][]*asserts.AtRevision, error) {
+	return q.toResolve, nil
+}
+
+func (q *fakeAssertQuery) AddError(e error, ref *asserts.Ref) error {
+	q.errors[ref.Unique()] = e
+	return nil
+}
+
+func (q *fakeAssertQuery) AddGroupingError(e error, grouping asserts.Grouping) error {
+	q.errors[string(grouping)] = e
+	return nil
+}
+
+func (s *offlineSuite) TestSnapActionAssertions(c *C) {
+	s.addSnap(c, "foo", 1)
+
+	devAcctRef := &asserts.Ref{Type: asserts.AccountType, PrimaryKey: []string{"developer1-id"}}
+	snapDeclRef := &asserts.Ref{Type: asserts.SnapDeclarationType, PrimaryKey: []string{"16", "foo-id"}}
+	missingRef := &asserts.Ref{Type: asserts.SnapDeclarationType, PrimaryKey: []string{"16", "bar-id"}}
+	q := &fakeAssertQuery{
+		toResolve: map[asserts.Grouping][]*asserts.AtRevision{
+			asserts.Grouping("g1"): {
+				{Ref: *devAcctRef, Revision: asserts.RevisionNotKnown},
+				{Ref: *missingRef, Revision: asserts.RevisionNotKnown},
+			},
+			// already up to date
+			asserts.Grouping("g2"): {
+				{Ref: *snapDeclRef, Revision: 0},
+			},
+		},
+		errors: make(map[string]error),
+	}
+	_, ars, err := s.store.SnapAction(context.TODO(), nil, nil, q, nil, nil)
+	c.Assert(err, IsNil)
+	c.Assert(ars, HasLen, 1)
+	c.Check(ars[0].Grouping, Equals, asserts.Grouping("g1"))
+	c.Check(ars[0].StreamURLs, HasLen, 1)
+	c.Check(q.errors, DeepEquals, map[string]error{
+		missingRef.Unique(): &asserts.NotFoundError{
+			Type:    asserts.SnapDeclarationType,
+			Headers: map[string]string{"series": "16", "snap-id": "bar-id"},
+		},
+	})
+
+	db, err := asserts.OpenDatabase(&asserts.DatabaseConfig{
+		Backstore: asserts.NewMemoryBackstore(),
+		Trusted:   s.storeSigning.Trusted,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(db.Add(s.storeSigning.StoreAccountKey("")), IsNil)
+	b := asserts.NewBatch(nil)
+	err = s.store.DownloadAssertions(ars[0].StreamURLs, b, nil)
+	c.Assert(err, IsNil)
+	c.Assert(b.CommitTo(db, nil), IsNil)
+	a, err := devAcctRef.Resolve(db.Find)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.Account).Username(), Equals, "developer1")
+}
+
+func (s *offlineSuite) TestAssertion(c *C) {
+	s.addSnap(c, "foo", 1)
+
+	a, err := s.store.Assertion(asserts.SnapDeclarationType, []string{"16", "foo-id"}, nil)
+	c.Assert(err, IsNil)
+	c.Check(a.(*asserts.SnapDeclaration).SnapName(), Equals, "foo")
+
+	_, err = s.store.Assertion(asserts.SnapDeclarationType, []string{"16", "bar-id"}, nil)
+	c.Check(asserts.IsNotFound(err), Equals, true)
+}
+
+func (s *offlineSuite) TestDownload(c *C) {
+	s.addSnap(c, "foo", 1)
+	info, err := s.store.SnapInfo(context.TODO(), store.SnapSpec{Name: "foo"}, nil)
+	c.Assert(err, IsNil)
+
+	target := filepath.Join(c.MkDir(), "foo_1.snap")
+	err = s.store.Download(context.TODO(), "foo", target, &info.DownloadInfo, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(target, testutil.FileEquals, "foo-1")
+
+	r, status, err := s.store.DownloadStream(context.TODO(), "foo", &info.DownloadInfo, 2, nil)
+	c.Assert(err, IsNil)
+	defer r.Close()
+	c.Check(status, Equals, 206)
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "o-1")
+
+	info.Sha3_384 = "bad"
+	err = s.store.Download(context.TODO(), "foo", target, &info.DownloadInfo, nil, nil, nil)
+	c.Check(err, ErrorMatches, `cannot find snap with digest bad in the offline store`)
+}
+
+func (s *offlineSuite) TestFind(c *C) {
+	s.addSnap(c, "foo", 1)
+	s.addSnap(c, "foobar", 1)
+	s.addSnap(c, "bar", 1)
+
+	infos, err := s.store.Find(context.TODO(), &store.Search{Query: "foo", Prefix: true}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(infos, HasLen, 2)
+	c.Check(infos[0].SnapName(), Equals, "foo")
+	c.Check(infos[1].SnapName(), Equals, "foobar")
+
+	infos, err = s.store.Find(context.TODO(), &store.Search{Query: "bar"}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(infos, HasLen, 2)
+	c.Check(infos[0].SnapName(), Equals, "bar")
+	c.Check(infos[1].SnapName(), Equals, "foobar")
+
+	// the summary is searched too
+	infos, err = s.store.Find(context.TODO(), &store.Search{Query: "foo snap"}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(infos, HasLen, 1)
+	c.Check(infos[0].SnapName(), Equals, "foo")
+}
+
+type fakeSnapAdder struct {
+	added []string
+}
+
+func (a *fakeSnapAdder) AddSnap(snapName, version, summary string, commands []string) error {
+	a.added = append(a.added, fmt.Sprintf("%s %s %q %v", snapName, version, summary, commands))
+	return nil
+}
+
+func (s *offlineSuite) TestWriteCatalogs(c *C) {
+	s.addSnap(c, "foo", 1)
+	s.addSnap(c, "bar", 2)
+
+	var names bytes.Buffer
+	adder := &fakeSnapAdder{}
+	err := s.store.WriteCatalogs(context.TODO(), &names, adder)
+	c.Assert(err, IsNil)
+	c.Check(names.String(), Equals, "bar\nfoo\n")
+	c.Check(adder.added, DeepEquals, []string{
+		`bar 2.0 "The bar snap" [bar]`,
+		`foo 1.0 "The foo snap" [foo]`,
+	})
+}
+
+func (s *offlineSuite) TestOnlineOperations(c *C) {
+	c.Check(s.store.ReadyToBuy(nil), Equals, offline.ErrOffline)
+	_, _, err := s.store.LoginUser("user", "pass", "")
+	c.Check(err, Equals, offline.ErrOffline)
+
+	status, err := s.store.ConnectivityCheck()
+	c.Assert(err, IsNil)
+	c.Check(status, DeepEquals, map[string]bool{s.dir: true})
+}
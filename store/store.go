@@ -44,6 +44,7 @@ import (
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/jsonutil"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/release"
@@ -824,6 +825,11 @@ func (s *Store) retryRequestDecodeJSON(ctx context.Context, reqOptions *requestO
 	}, defaultRetryStrategy)
 }
 
+var (
+	requestDurations = metrics.NewHistogram("snapd_store_request_duration_seconds", "Latency of the requests to the store, by method.", nil, "method")
+	requestErrors    = metrics.NewCounter("snapd_store_request_errors", "Failed requests to the store, by reason.", "reason")
+)
+
 // doRequest does an authenticated request to the store handling a potential macaroon refresh required if needed
 func (s *Store) doRequest(ctx context.Context, client *http.Client, reqOptions *requestOptions, user *auth.UserState) (*http.Response, error) {
 	authRefreshes := 0
@@ -836,10 +842,16 @@ func (s *Store) doRequest(ctx context.Context, client *http.Client, reqOptions *
 			req = req.WithContext(ctx)
 		}
 
+		start := time.Now()
 		resp, err := client.Do(req)
+		requestDurations.ObserveDuration(time.Since(start), req.Method)
 		if err != nil {
+			requestErrors.Inc("network")
 			return nil, err
 		}
+		if resp.StatusCode >= 500 {
+			requestErrors.Inc("server")
+		}
 
 		wwwAuth := resp.Header.Get("WWW-Authenticate")
 		if resp.StatusCode == 401 && authRefreshes < 4 {
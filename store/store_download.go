@@ -43,6 +43,7 @@ import (
 	"github.com/snapcore/snapd/httputil"
 	"github.com/snapcore/snapd/i18n"
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/overlord/auth"
 	"github.com/snapcore/snapd/progress"
@@ -389,6 +390,8 @@ var ratelimitReader = ratelimit.Reader
 
 var download = downloadImpl
 
+var downloadedBytes = metrics.NewCounter("snapd_store_download_bytes", "Bytes downloaded from the store.")
+
 // download writes an http.Request showing a progress.Meter
 func downloadImpl(ctx context.Context, name, sha3_384, downloadURL string, user *auth.UserState, s *Store, w io.ReadWriteSeeker, resume int64, pbar progress.Meter, dlOpts *DownloadOptions) error {
 	if dlOpts == nil {
@@ -485,7 +488,9 @@ func downloadImpl(ctx context.Context, name, sha3_384, downloadURL string, user
 		}
 
 		stopMonitorCh := tc.Monitor()
-		_, finalErr = io.Copy(mw, limiter)
+		var n int64
+		n, finalErr = io.Copy(mw, limiter)
+		downloadedBytes.Add(float64(n))
 		close(stopMonitorCh)
 		pbar.Finished()
 
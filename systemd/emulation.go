@@ -167,6 +167,14 @@ func (s *emulation) RemoveMountUnitFile(mountedDir string) error {
 	return nil
 }
 
+func (s *emulation) AddSwapUnitFile(what string) (string, error) {
+	return "", errNotImplemented
+}
+
+func (s *emulation) RemoveSwapUnitFile(what string) error {
+	return errNotImplemented
+}
+
 func (s *emulation) Mask(service string) error {
 	_, err := systemctlCmd("--root", s.rootDir, "mask", service)
 	return err
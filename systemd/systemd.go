@@ -240,6 +240,10 @@ type Systemd interface {
 	AddMountUnitFile(name, revision, what, where, fstype string) (string, error)
 	// RemoveMountUnitFile unmounts/stops/disables/removes a mount unit.
 	RemoveMountUnitFile(baseDir string) error
+	// AddSwapUnitFile adds/enables/starts a swap unit for a swap file.
+	AddSwapUnitFile(what string) (string, error)
+	// RemoveSwapUnitFile stops/disables/removes the swap unit of a swap file.
+	RemoveSwapUnitFile(what string) error
 	// Mask the given service.
 	Mask(service string) error
 	// Unmask the given service.
@@ -907,6 +911,79 @@ func (s *systemd) RemoveMountUnitFile(mountedDir string) error {
 	return nil
 }
 
+// SwapUnitPath returns the path of the swap unit of a swap file
+func SwapUnitPath(what string) string {
+	escapedPath := EscapeUnitNamePath(what)
+	return filepath.Join(dirs.SnapServicesDir, escapedPath+".swap")
+}
+
+var swapUnitTemplate = `[Unit]
+Description=Swap file %s managed by snapd
+
+[Swap]
+What=%s
+
+[Install]
+WantedBy=swap.target
+`
+
+func (s *systemd) AddSwapUnitFile(what string) (string, error) {
+	daemonReloadLock.Lock()
+	defer daemonReloadLock.Unlock()
+
+	content := fmt.Sprintf(swapUnitTemplate, what, what)
+	su := SwapUnitPath(what)
+	if err := os.MkdirAll(filepath.Dir(su), 0755); err != nil {
+		return "", err
+	}
+	if err := osutil.AtomicWriteFile(su, []byte(content), 0644, 0); err != nil {
+		return "", err
+	}
+	swapUnitName := filepath.Base(su)
+
+	// make sure systemd knows about the new swap unit file
+	if err := s.daemonReloadNoLock(); err != nil {
+		return "", err
+	}
+
+	if err := s.Enable(swapUnitName); err != nil {
+		return "", err
+	}
+	if err := s.Start(swapUnitName); err != nil {
+		return "", err
+	}
+
+	return swapUnitName, nil
+}
+
+func (s *systemd) RemoveSwapUnitFile(what string) error {
+	daemonReloadLock.Lock()
+	defer daemonReloadLock.Unlock()
+
+	unit := SwapUnitPath(what)
+	if !osutil.FileExists(unit) {
+		return nil
+	}
+
+	// stopping the unit deactivates the swap file
+	if err := s.Stop(filepath.Base(unit), 5*time.Minute); err != nil {
+		return err
+	}
+	if err := s.Disable(filepath.Base(unit)); err != nil {
+		return err
+	}
+	if err := os.Remove(unit); err != nil {
+		return err
+	}
+	// daemon-reload to ensure that systemd actually really
+	// forgets about this swap unit
+	if err := s.daemonReloadNoLock(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (s *systemd) ReloadOrRestart(serviceName string) error {
 	if s.mode == GlobalUserMode {
 		panic("cannot call restart with GlobalUserMode")
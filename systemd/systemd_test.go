@@ -863,6 +863,63 @@ func (s *SystemdTestSuite) TestRemoveMountUnit(c *C) {
 	})
 }
 
+func (s *SystemdTestSuite) TestAddSwapUnit(c *C) {
+	rootDir := dirs.GlobalRootDir
+
+	swapUnitName, err := NewUnderRoot(rootDir, SystemMode, nil).AddSwapUnitFile("/var/lib/swapfile")
+	c.Assert(err, IsNil)
+	c.Check(swapUnitName, Equals, "var-lib-swapfile.swap")
+
+	c.Assert(filepath.Join(dirs.SnapServicesDir, swapUnitName), testutil.FileEquals, `[Unit]
+Description=Swap file /var/lib/swapfile managed by snapd
+
+[Swap]
+What=/var/lib/swapfile
+
+[Install]
+WantedBy=swap.target
+`)
+
+	c.Assert(s.argses, DeepEquals, [][]string{
+		{"daemon-reload"},
+		{"--root", rootDir, "enable", "var-lib-swapfile.swap"},
+		{"start", "var-lib-swapfile.swap"},
+	})
+}
+
+func (s *SystemdTestSuite) TestRemoveSwapUnit(c *C) {
+	rootDir := dirs.GlobalRootDir
+
+	restore := MockStopDelays(time.Millisecond, 25*time.Second)
+	defer restore()
+
+	swapUnit := SwapUnitPath("/var/lib/swapfile")
+	c.Assert(os.MkdirAll(filepath.Dir(swapUnit), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(swapUnit, nil, 0644), IsNil)
+
+	s.outs = [][]byte{
+		nil, // for the "stop" itself
+		[]byte("ActiveState=inactive\n"),
+	}
+	err := NewUnderRoot(rootDir, SystemMode, nil).RemoveSwapUnitFile("/var/lib/swapfile")
+	c.Assert(err, IsNil)
+	// the file is gone
+	c.Check(osutil.FileExists(swapUnit), Equals, false)
+	// and the unit is stopped, disabled and the daemon reloaded
+	c.Check(s.argses, DeepEquals, [][]string{
+		{"stop", "var-lib-swapfile.swap"},
+		{"show", "--property=ActiveState", "var-lib-swapfile.swap"},
+		{"--root", rootDir, "disable", "var-lib-swapfile.swap"},
+		{"daemon-reload"},
+	})
+}
+
+func (s *SystemdTestSuite) TestRemoveSwapUnitNoUnit(c *C) {
+	err := NewUnderRoot(dirs.GlobalRootDir, SystemMode, nil).RemoveSwapUnitFile("/var/lib/swapfile")
+	c.Assert(err, IsNil)
+	c.Check(s.argses, HasLen, 0)
+}
+
 func (s *SystemdTestSuite) TestDaemonReloadMutex(c *C) {
 	s.testDaemonReloadMutex(c, Systemd.DaemonReload)
 }
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/snapcore/snapd/logger"
+	"github.com/snapcore/snapd/metrics"
 )
 
 // TimingJSON and rootTimingsJSON aid in marshalling of flattened timings into state.
@@ -131,6 +132,8 @@ type GetSaver interface {
 // responsibility of the caller to lock the state before calling this
 // function.
 func (t *Timings) Save(s GetSaver) {
+	t.observeTaskDuration()
+
 	var stateTimings []*json.RawMessage
 	if err := s.GetMaybeTimings(&stateTimings); err != nil {
 		logger.Noticef("could not get timings data from the state: %v", err)
@@ -155,6 +158,29 @@ func (t *Timings) Save(s GetSaver) {
 	s.SaveTimings(stateTimings)
 }
 
+var taskDurations = metrics.NewHistogram("snapd_task_duration_seconds", "Duration of the measured work of tasks, by task kind.", nil, "kind")
+
+// observeTaskDuration records the overall duration of timings about a
+// task, regardless of DurationThreshold.
+func (t *Timings) observeTaskDuration() {
+	kind := t.tags["task-kind"]
+	if kind == "" || len(t.timings) == 0 {
+		return
+	}
+	start := t.timings[0].start
+	var stop time.Time
+	for _, tm := range t.timings {
+		if tm.stop.After(stop) {
+			stop = tm.stop
+		}
+	}
+	if stop.Before(start) {
+		// not stopped yet
+		return
+	}
+	taskDurations.ObserveDuration(timeDuration(start, stop), kind)
+}
+
 // Get returns timings for which filter predicate is true and filters
 // out nested timings whose level is greater than maxLevel.
 // Negative maxLevel value disables filtering by level.
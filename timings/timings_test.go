@@ -20,12 +20,14 @@
 package timings_test
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 	"time"
 
 	. "gopkg.in/check.v1"
 
+	"github.com/snapcore/snapd/metrics"
 	"github.com/snapcore/snapd/overlord/state"
 	"github.com/snapcore/snapd/testutil"
 	"github.com/snapcore/snapd/timings"
@@ -85,6 +87,22 @@ func (s *timingsSuite) mockTimeNow(c *C) {
 	}))
 }
 
+func (s *timingsSuite) TestSaveObservesTaskDuration(c *C) {
+	s.mockDuration(c)
+
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	timing := timings.New(map[string]string{"task-kind": "timings-test-kind"})
+	timing.StartSpan("doing something", "...").Stop()
+	timing.Save(s.st)
+
+	var buf bytes.Buffer
+	c.Assert(metrics.WriteTo(&buf), IsNil)
+	c.Check(buf.String(), testutil.Contains, `snapd_task_duration_seconds_count{kind="timings-test-kind"} 1`)
+	c.Check(buf.String(), testutil.Contains, `snapd_task_duration_seconds_sum{kind="timings-test-kind"} 0.001`)
+}
+
 func (s *timingsSuite) TestSave(c *C) {
 	s.mockDuration(c)
 
@@ -20,14 +20,18 @@
 package agent
 
 import (
+	"context"
 	"syscall"
 	"time"
+
+	"github.com/snapcore/snapd/desktop/notification"
 )
 
 var (
 	SessionInfoCmd                = sessionInfoCmd
 	ServiceControlCmd             = serviceControlCmd
 	PendingRefreshNotificationCmd = pendingRefreshNotificationCmd
+	FinishRefreshNotificationCmd  = finishRefreshNotificationCmd
 )
 
 func MockStopTimeouts(stop, kill time.Duration) (restore func()) {
@@ -50,3 +54,23 @@ func MockUcred(ucred *syscall.Ucred, err error) (restore func()) {
 		sysGetsockoptUcred = old
 	}
 }
+
+func MockObserveNotifications(fn func(ctx context.Context, srv *notification.Server, observer notification.Observer) error) (restore func()) {
+	old := observeNotifications
+	observeNotifications = fn
+	return func() {
+		observeNotifications = old
+	}
+}
+
+func MockSnapdPendingRefreshAction(fn func(instanceName, action string) error) (restore func()) {
+	old := snapdPendingRefreshAction
+	snapdPendingRefreshAction = fn
+	return func() {
+		snapdPendingRefreshAction = old
+	}
+}
+
+func (s *SessionAgent) RefreshNotificationsPending() bool {
+	return s.refreshNotifications.pending()
+}
@@ -0,0 +1,139 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2021 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/snapcore/snapd/client"
+	"github.com/snapcore/snapd/desktop/notification"
+	"github.com/snapcore/snapd/logger"
+)
+
+// snapdPendingRefreshAction delivers the choice of the user about a pending
+// refresh to snapd.
+var snapdPendingRefreshAction = func(instanceName, action string) error {
+	cli := client.New(nil)
+	switch action {
+	case client.PendingRefreshActionRefreshNow:
+		_, err := cli.RefreshNow(instanceName)
+		return err
+	case client.PendingRefreshActionPostpone:
+		return cli.PostponeRefresh(instanceName)
+	}
+	return nil
+}
+
+// observeNotifications is a mockable version of Server.ObserveNotifications
+var observeNotifications = func(ctx context.Context, srv *notification.Server, observer notification.Observer) error {
+	return srv.ObserveNotifications(ctx, observer)
+}
+
+// refreshNotifications tracks the notifications sent about pending
+// refreshes, so that the actions invoked on them by the user can be
+// delivered to snapd.
+type refreshNotifications struct {
+	mu        sync.Mutex
+	snaps     map[notification.ID]string
+	observing bool
+}
+
+func newRefreshNotifications() *refreshNotifications {
+	return &refreshNotifications{
+		snaps: make(map[notification.ID]string),
+	}
+}
+
+// pending returns whether some notifications with actions are still
+// shown to the user.
+func (rn *refreshNotifications) pending() bool {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	return len(rn.snaps) > 0
+}
+
+// track records the notification about the given snap, and returns
+// whether the notifications need to be observed.
+func (rn *refreshNotifications) track(id notification.ID, instanceName string) (startObserving bool) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	rn.snaps[id] = instanceName
+	startObserving = !rn.observing
+	rn.observing = true
+	return startObserving
+}
+
+func (rn *refreshNotifications) stopObserving() {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	rn.observing = false
+	rn.snaps = make(map[notification.ID]string)
+}
+
+func (rn *refreshNotifications) forget(id notification.ID) (instanceName string, ok bool) {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	instanceName, ok = rn.snaps[id]
+	delete(rn.snaps, id)
+	return instanceName, ok
+}
+
+// NotificationClosed is part of notification.Observer.
+func (rn *refreshNotifications) NotificationClosed(id notification.ID, reason notification.CloseReason) error {
+	rn.forget(id)
+	return nil
+}
+
+// ActionInvoked is part of notification.Observer.
+func (rn *refreshNotifications) ActionInvoked(id notification.ID, actionKey string) error {
+	instanceName, ok := rn.forget(id)
+	if !ok {
+		// not one of ours
+		return nil
+	}
+	switch actionKey {
+	case client.PendingRefreshActionRefreshNow, client.PendingRefreshActionPostpone:
+	default:
+		logger.Noticef("Unknown action %q on the notification about the refresh of snap %q", actionKey, instanceName)
+		return nil
+	}
+	if err := snapdPendingRefreshAction(instanceName, actionKey); err != nil {
+		logger.Noticef("Cannot deliver action %q on the refresh of snap %q to snapd: %v", actionKey, instanceName, err)
+	}
+	return nil
+}
+
+// trackRefreshNotification remembers the notification sent about the
+// pending refresh of the given snap, and starts observing the notifications
+// of the server if needed, until the agent stops.
+func (s *SessionAgent) trackRefreshNotification(srv *notification.Server, id notification.ID, instanceName string) {
+	if !s.refreshNotifications.track(id, instanceName) {
+		return
+	}
+	s.tomb.Go(func() error {
+		ctx := s.tomb.Context(nil)
+		if err := observeNotifications(ctx, srv, s.refreshNotifications); err != nil && ctx.Err() == nil {
+			logger.Noticef("Cannot observe notifications: %v", err)
+		}
+		s.refreshNotifications.stopObserving()
+		return nil
+	})
+}
@@ -31,6 +31,7 @@ import (
 
 	"github.com/mvo5/goconfigparser"
 
+	"github.com/snapcore/snapd/client"
 	"github.com/snapcore/snapd/dbusutil"
 	"github.com/snapcore/snapd/desktop/notification"
 	"github.com/snapcore/snapd/dirs"
@@ -44,6 +45,7 @@ var restApi = []*Command{
 	sessionInfoCmd,
 	serviceControlCmd,
 	pendingRefreshNotificationCmd,
+	finishRefreshNotificationCmd,
 }
 
 var (
@@ -66,6 +68,11 @@ var (
 		Path: "/v1/notifications/pending-refresh",
 		POST: postPendingRefreshNotification,
 	}
+
+	finishRefreshNotificationCmd = &Command{
+		Path: "/v1/notifications/finish-refresh",
+		POST: postFinishRefreshNotification,
+	}
 )
 
 func sessionInfo(c *Command, r *http.Request) Response {
@@ -181,19 +188,8 @@ type dummyReporter struct{}
 func (dummyReporter) Notify(string) {}
 
 func postServiceControl(c *Command, r *http.Request) Response {
-	contentType := r.Header.Get("Content-Type")
-	mediaType, params, err := mime.ParseMediaType(contentType)
-	if err != nil {
-		return BadRequest("cannot parse content type: %v", err)
-	}
-
-	if mediaType != "application/json" {
-		return BadRequest("unknown content type: %s", contentType)
-	}
-
-	charset := strings.ToUpper(params["charset"])
-	if charset != "" && charset != "UTF-8" {
-		return BadRequest("unknown charset in content type: %s", contentType)
+	if rsp := validateJSONRequest(r); rsp != nil {
+		return rsp
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -212,7 +208,9 @@ func postServiceControl(c *Command, r *http.Request) Response {
 	return impl(&inst, sysd)
 }
 
-func postPendingRefreshNotification(c *Command, r *http.Request) Response {
+// validateJSONRequest returns an error response if the body of the request
+// is not UTF-8 encoded JSON.
+func validateJSONRequest(r *http.Request) Response {
 	contentType := r.Header.Get("Content-Type")
 	mediaType, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
@@ -227,6 +225,13 @@ func postPendingRefreshNotification(c *Command, r *http.Request) Response {
 	if charset != "" && charset != "UTF-8" {
 		return BadRequest("unknown charset in content type: %s", contentType)
 	}
+	return nil
+}
+
+func postPendingRefreshNotification(c *Command, r *http.Request) Response {
+	if rsp := validateJSONRequest(r); rsp != nil {
+		return rsp
+	}
 
 	decoder := json.NewDecoder(r.Body)
 
@@ -301,9 +306,69 @@ func postPendingRefreshNotification(c *Command, r *http.Request) Response {
 		Body:    body,
 		Hints:   hints,
 	}
+	// While the refresh can still be held, let the user decide.
+	if refreshInfo.TimeRemaining > 0 {
+		msg.Actions = []notification.Action{
+			{ActionKey: client.PendingRefreshActionRefreshNow, LocalizedText: i18n.G("Refresh now")},
+			{ActionKey: client.PendingRefreshActionPostpone, LocalizedText: i18n.G("Postpone")},
+		}
+	}
 
 	// TODO: silently ignore error returned when the notification server does not exist.
-	// TODO: track returned notification ID and respond to actions, if supported.
+	id, err := notifySrv.SendNotification(msg)
+	if err != nil {
+		return SyncResponse(&resp{
+			Type:   ResponseTypeError,
+			Status: 500,
+			Result: &errorResult{
+				Message: fmt.Sprintf("cannot send notification message: %v", err),
+			},
+		})
+	}
+	if len(msg.Actions) > 0 {
+		c.s.trackRefreshNotification(notifySrv, id, refreshInfo.InstanceName)
+	}
+	return SyncResponse(nil)
+}
+
+func postFinishRefreshNotification(c *Command, r *http.Request) Response {
+	if rsp := validateJSONRequest(r); rsp != nil {
+		return rsp
+	}
+
+	decoder := json.NewDecoder(r.Body)
+
+	// finishedSnapRefreshInfo holds information about a finished snap
+	// refresh provided by snapd.
+	type finishedSnapRefreshInfo struct {
+		InstanceName string `json:"instance-name"`
+	}
+	var refreshInfo finishedSnapRefreshInfo
+	if err := decoder.Decode(&refreshInfo); err != nil {
+		return BadRequest("cannot decode request body into finished snap refresh info: %v", err)
+	}
+
+	conn, err := dbusutil.SessionBus()
+	// Note that since the connection is shared, we are not closing it.
+	if err != nil {
+		return SyncResponse(&resp{
+			Type:   ResponseTypeError,
+			Status: 500,
+			Result: &errorResult{
+				Message: fmt.Sprintf("cannot connect to the session bus: %v", err),
+			},
+		})
+	}
+	notifySrv := notification.New(conn)
+
+	msg := &notification.Message{
+		Summary: fmt.Sprintf(i18n.G("Snap %q has been refreshed"), refreshInfo.InstanceName),
+		Body:    i18n.G("Now available to launch"),
+		Hints: []notification.Hint{
+			notification.WithUrgency(notification.LowUrgency),
+			notification.WithDesktopEntry("io.snapcraft.SessionAgent"),
+		},
+	}
 	if _, err := notifySrv.SendNotification(msg); err != nil {
 		return SyncResponse(&resp{
 			Type:   ResponseTypeError,
@@ -21,6 +21,7 @@ package agent_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -46,8 +47,9 @@ import (
 type restSuite struct {
 	testutil.BaseTest
 	testutil.DBusTest
-	sysdLog [][]string
-	agent   *agent.SessionAgent
+	sysdLog  [][]string
+	agent    *agent.SessionAgent
+	observer chan notification.Observer
 }
 
 var _ = Suite(&restSuite{})
@@ -69,6 +71,13 @@ func (s *restSuite) SetUpTest(c *C) {
 	s.AddCleanup(restore)
 	restore = agent.MockStopTimeouts(20*time.Millisecond, time.Millisecond)
 	s.AddCleanup(restore)
+	s.observer = make(chan notification.Observer, 1)
+	restore = agent.MockObserveNotifications(func(ctx context.Context, srv *notification.Server, observer notification.Observer) error {
+		s.observer <- observer
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s.AddCleanup(restore)
 
 	var err error
 	s.agent, err = agent.New()
@@ -514,6 +523,7 @@ func (s *restSuite) TestPostPendingRefreshNotificationFewDays(c *C) {
 	s.testPostPendingRefreshNotificationBody(c, refreshInfo, func(c *C, msg *dbus.Message) {
 		c.Check(msg.Body[3], Equals, `Pending update of "pkg" snap`)
 		c.Check(msg.Body[4], Equals, "Close the app to avoid disruptions (3 days left)")
+		c.Check(msg.Body[5], DeepEquals, []string{"refresh-now", "Refresh now", "postpone", "Postpone"})
 		c.Check(msg.Body[6], DeepEquals, map[string]dbus.Variant{
 			"urgency":       dbus.MakeVariant(byte(notification.LowUrgency)),
 			"desktop-entry": dbus.MakeVariant("io.snapcraft.SessionAgent"),
@@ -636,3 +646,115 @@ func (s *restSuite) TestPostPendingRefreshNotificationNoNotificationServer(c *C)
 	c.Check(rsp.Type, Equals, agent.ResponseTypeError)
 	c.Check(rsp.Result, DeepEquals, map[string]interface{}{"message": "cannot send notification message: org.freedesktop.DBus.Error.NameHasNoOwner"})
 }
+
+func (s *restSuite) TestPostPendingRefreshNotificationActionInvoked(c *C) {
+	var actions []string
+	restore := agent.MockSnapdPendingRefreshAction(func(instanceName, action string) error {
+		actions = append(actions, instanceName+" "+action)
+		return nil
+	})
+	defer restore()
+
+	refreshInfo := &client.PendingSnapRefreshInfo{
+		InstanceName:  "pkg",
+		TimeRemaining: time.Hour * 72,
+	}
+	s.testPostPendingRefreshNotificationBody(c, refreshInfo, nil)
+	c.Check(s.agent.RefreshNotificationsPending(), Equals, true)
+
+	var observer notification.Observer
+	select {
+	case observer = <-s.observer:
+	case <-time.After(5 * time.Second):
+		c.Fatal("notifications are not observed")
+	}
+
+	// notifications not sent by the agent are ignored
+	c.Assert(observer.ActionInvoked(1, "postpone"), IsNil)
+	c.Check(actions, HasLen, 0)
+
+	c.Assert(observer.ActionInvoked(7, "postpone"), IsNil)
+	c.Check(actions, DeepEquals, []string{"pkg postpone"})
+	c.Check(s.agent.RefreshNotificationsPending(), Equals, false)
+
+	// the notification is gone
+	c.Assert(observer.ActionInvoked(7, "refresh-now"), IsNil)
+	c.Check(actions, DeepEquals, []string{"pkg postpone"})
+}
+
+func (s *restSuite) TestPostPendingRefreshNotificationClosed(c *C) {
+	refreshInfo := &client.PendingSnapRefreshInfo{
+		InstanceName:  "pkg",
+		TimeRemaining: time.Hour * 72,
+	}
+	s.testPostPendingRefreshNotificationBody(c, refreshInfo, nil)
+	c.Check(s.agent.RefreshNotificationsPending(), Equals, true)
+
+	var observer notification.Observer
+	select {
+	case observer = <-s.observer:
+	case <-time.After(5 * time.Second):
+		c.Fatal("notifications are not observed")
+	}
+	c.Assert(observer.NotificationClosed(7, notification.CloseReasonDismissed), IsNil)
+	c.Check(s.agent.RefreshNotificationsPending(), Equals, false)
+}
+
+func (s *restSuite) TestPostPendingRefreshNotificationHappeningNowNotTracked(c *C) {
+	refreshInfo := &client.PendingSnapRefreshInfo{InstanceName: "pkg"}
+	s.testPostPendingRefreshNotificationBody(c, refreshInfo, nil)
+	c.Check(s.agent.RefreshNotificationsPending(), Equals, false)
+}
+
+func (s *restSuite) TestPostFinishRefreshNotification(c *C) {
+	conn, err := dbustest.Connection(func(msg *dbus.Message, n int) ([]*dbus.Message, error) {
+		c.Check(msg.Body[0], Equals, "")
+		c.Check(msg.Body[3], Equals, `Snap "pkg" has been refreshed`)
+		c.Check(msg.Body[4], Equals, "Now available to launch")
+		c.Check(msg.Body[5], HasLen, 0)
+		c.Check(msg.Body[6], DeepEquals, map[string]dbus.Variant{
+			"urgency":       dbus.MakeVariant(byte(notification.LowUrgency)),
+			"desktop-entry": dbus.MakeVariant("io.snapcraft.SessionAgent"),
+		})
+		responseSig := dbus.SignatureOf(uint32(0))
+		response := &dbus.Message{
+			Type: dbus.TypeMethodReply,
+			Headers: map[dbus.HeaderField]dbus.Variant{
+				dbus.FieldReplySerial: dbus.MakeVariant(msg.Serial()),
+				dbus.FieldSender:      dbus.MakeVariant(":1"), // This does not matter.
+				dbus.FieldSignature:   dbus.MakeVariant(responseSig),
+			},
+			Body: []interface{}{uint32(7)},
+		}
+		return []*dbus.Message{response}, nil
+	})
+	c.Assert(err, IsNil)
+	restore := dbusutil.MockOnlySessionBusAvailable(conn)
+	defer restore()
+
+	req, err := http.NewRequest("POST", "/v1/notifications/finish-refresh", bytes.NewBufferString(`{"instance-name":"pkg"}`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Assert(err, IsNil)
+	rec := httptest.NewRecorder()
+	agent.FinishRefreshNotificationCmd.POST(agent.FinishRefreshNotificationCmd, req).ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 200)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeSync)
+	c.Check(rsp.Result, IsNil)
+}
+
+func (s *restSuite) TestPostFinishRefreshNotificationMalformedRequestBody(c *C) {
+	req, err := http.NewRequest("POST", "/v1/notifications/finish-refresh", bytes.NewBufferString(`{"instance-name":`))
+	req.Header.Set("Content-Type", "application/json")
+	c.Assert(err, IsNil)
+	rec := httptest.NewRecorder()
+	agent.FinishRefreshNotificationCmd.POST(agent.FinishRefreshNotificationCmd, req).ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 400)
+
+	var rsp resp
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+	c.Check(rsp.Type, Equals, agent.ResponseTypeError)
+	c.Check(rsp.Result, DeepEquals, map[string]interface{}{"message": "cannot decode request body into finished snap refresh info: unexpected EOF"})
+}
@@ -50,6 +50,8 @@ type SessionAgent struct {
 
 	idle        *idleTracker
 	IdleTimeout time.Duration
+
+	refreshNotifications *refreshNotifications
 }
 
 const sessionAgentBusName = "io.snapcraft.SessionAgent"
@@ -208,6 +210,7 @@ func (s *SessionAgent) Init() error {
 		lastActive: time.Now(),
 	}
 	s.IdleTimeout = defaultIdleTimeout
+	s.refreshNotifications = newRefreshNotifications()
 	s.addRoutes()
 	s.serve = &http.Server{
 		Handler:   s.router,
@@ -297,7 +300,10 @@ Loop:
 		case <-timer.C:
 			// Have we been idle
 			idleDuration := s.idle.idleDuration()
-			if idleDuration >= s.IdleTimeout {
+			if s.refreshNotifications.pending() {
+				// keep around to act on the notifications
+				timer.Reset(s.IdleTimeout)
+			} else if idleDuration >= s.IdleTimeout {
 				s.tomb.Kill(nil)
 				break Loop
 			} else {
@@ -52,6 +52,7 @@ func dialSessionAgent(network, address string) (net.Conn, error) {
 
 type Client struct {
 	doer *http.Client
+	uids map[int]bool
 }
 
 func New() *Client {
@@ -61,6 +62,17 @@ func New() *Client {
 	}
 }
 
+// NewForUids returns a client talking only to the session agents of
+// the given users, instead of to all of them.
+func NewForUids(uids ...int) *Client {
+	client := New()
+	client.uids = make(map[int]bool, len(uids))
+	for _, uid := range uids {
+		client.uids[uid] = true
+	}
+	return client
+}
+
 type Error struct {
 	Kind    string      `json:"kind"`
 	Value   interface{} `json:"value"`
@@ -116,6 +128,9 @@ func (client *Client) doMany(ctx context.Context, method, urlpath string, query
 				// (i.e. /run/user/NNNN).
 				return
 			}
+			if client.uids != nil && !client.uids[uid] {
+				return
+			}
 			response := response{uid: uid}
 			defer func() {
 				mu.Lock()
@@ -287,3 +302,19 @@ func (client *Client) PendingRefreshNotification(ctx context.Context, refreshInf
 	_, err = client.doMany(ctx, "POST", "/v1/notifications/pending-refresh", nil, headers, reqBody)
 	return err
 }
+
+// FinishedSnapRefreshInfo holds information about a finished refresh provided to userd.
+type FinishedSnapRefreshInfo struct {
+	InstanceName string `json:"instance-name"`
+}
+
+// FinishRefreshNotification broadcasts information about a finished refresh.
+func (client *Client) FinishRefreshNotification(ctx context.Context, refreshInfo *FinishedSnapRefreshInfo) error {
+	headers := map[string]string{"Content-Type": "application/json"}
+	reqBody, err := json.Marshal(refreshInfo)
+	if err != nil {
+		return err
+	}
+	_, err = client.doMany(ctx, "POST", "/v1/notifications/finish-refresh", nil, headers, reqBody)
+	return err
+}
@@ -22,6 +22,7 @@ package client_test
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -457,3 +458,36 @@ func (s *clientSuite) TestPendingRefreshNotification(c *C) {
 	err := s.cli.PendingRefreshNotification(context.Background(), &client.PendingSnapRefreshInfo{})
 	c.Assert(err, IsNil)
 }
+
+func (s *clientSuite) TestPendingRefreshNotificationForUids(c *C) {
+	var n int
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Assert(r.URL.Path, Equals, "/v1/notifications/pending-refresh")
+		c.Check(r.Host, Equals, "42")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"type": "sync"}`))
+	})
+	cli := client.NewForUids(42)
+	err := cli.PendingRefreshNotification(context.Background(), &client.PendingSnapRefreshInfo{})
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 1)
+}
+
+func (s *clientSuite) TestFinishRefreshNotification(c *C) {
+	var n int
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		c.Assert(r.URL.Path, Equals, "/v1/notifications/finish-refresh")
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, IsNil)
+		c.Check(string(body), Equals, `{"instance-name":"some-snap"}`)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write([]byte(`{"type": "sync"}`))
+	})
+	err := s.cli.FinishRefreshNotification(context.Background(), &client.FinishedSnapRefreshInfo{InstanceName: "some-snap"})
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 2)
+}
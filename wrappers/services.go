@@ -31,12 +31,14 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/snapcore/snapd/dirs"
 	"github.com/snapcore/snapd/logger"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/osutil/sys"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/randutil"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
 	"github.com/snapcore/snapd/timeout"
@@ -379,6 +381,9 @@ func userDaemonReload() error {
 type AddSnapServicesOptions struct {
 	Preseeding   bool
 	VitalityRank int
+	// QuotaGroup is the quota group the snap is a member of, if any. The
+	// services of the snap are placed in the systemd slice of the group.
+	QuotaGroup *quota.Group
 }
 
 // AddSnapServices adds service units for the applications from the snap which
@@ -727,6 +732,9 @@ KillSignal={{.KillSignal}}
 {{- if .OOMAdjustScore }}
 OOMScoreAdjust={{.OOMAdjustScore}}
 {{- end}}
+{{- if .SliceUnit}}
+Slice={{.SliceUnit}}
+{{- end}}
 {{- if not .App.Sockets}}
 
 [Install]
@@ -795,6 +803,7 @@ WantedBy={{.ServicesTarget}}
 		KillSignal         string
 		OOMAdjustScore     int
 		BusName            string
+		SliceUnit          string
 		Before             []string
 		After              []string
 
@@ -825,6 +834,11 @@ WantedBy={{.ServicesTarget}}
 		wrapperData.MountUnit = filepath.Base(systemd.MountUnitPath(appInfo.Snap.MountDir()))
 		wrapperData.WorkingDir = appInfo.Snap.DataDir()
 		wrapperData.After = append(wrapperData.After, "snapd.apparmor.service")
+		// quota groups are only supported for system services, user
+		// services run in the slices of the user session
+		if opts.QuotaGroup != nil {
+			wrapperData.SliceUnit = opts.QuotaGroup.SliceFileName()
+		}
 	case snap.UserDaemon:
 		wrapperData.ServicesTarget = systemd.UserServicesTarget
 		// FIXME: ideally use UserDataDir("%h"), but then the
@@ -850,6 +864,92 @@ WantedBy={{.ServicesTarget}}
 	return templateOut.Bytes()
 }
 
+func genSliceFile(grp *quota.Group) []byte {
+	buf := bytes.Buffer{}
+
+	template := `[Unit]
+Description=Slice for snap quota group %[1]s
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+`
+	fmt.Fprintf(&buf, template, grp.Name)
+
+	if grp.Limits.CPU != 0 {
+		fmt.Fprintf(&buf, `# Always enable cpu accounting, so the following cpu quota options are used
+CPUAccounting=true
+CPUQuota=%d%%
+`, grp.Limits.CPU)
+	}
+
+	if grp.Limits.Memory != 0 {
+		fmt.Fprintf(&buf, `# Always enable memory accounting otherwise the MemoryMax setting does nothing.
+MemoryAccounting=true
+MemoryMax=%[1]d
+# for compatibility with older versions of systemd
+MemoryLimit=%[1]d
+`, grp.Limits.Memory)
+	}
+
+	if grp.Limits.Tasks != 0 {
+		fmt.Fprintf(&buf, `# Always enable task accounting in order to be able to count the processes/
+# threads, etc for a slice
+TasksAccounting=true
+TasksMax=%d
+`, grp.Limits.Tasks)
+	}
+
+	return buf.Bytes()
+}
+
+// EnsureQuotaGroupSlice writes the systemd slice unit of the given quota
+// group, as well as the units of all of its parent groups, as the slice of the
+// group is nested in the slices of the parents. It returns whether any of the
+// slice units was modified, in which case a daemon-reload is performed.
+func EnsureQuotaGroupSlice(grp *quota.Group, inter interacter) (modified bool, err error) {
+	if err := os.MkdirAll(dirs.SnapServicesDir, 0755); err != nil {
+		return false, err
+	}
+
+	for g := grp; g != nil; g = g.Parent() {
+		content := &osutil.MemoryFileState{
+			Content: genSliceFile(g),
+			Mode:    0644,
+		}
+		err := osutil.EnsureFileState(g.SliceFile(), content)
+		if err == osutil.ErrSameState {
+			continue
+		}
+		if err != nil {
+			return modified, err
+		}
+		modified = true
+	}
+
+	if modified {
+		sysd := systemd.New(systemd.SystemMode, inter)
+		if err := sysd.DaemonReload(); err != nil {
+			return true, err
+		}
+	}
+	return modified, nil
+}
+
+// RemoveQuotaGroupSlice removes the systemd slice unit of the given quota
+// group. The group is expected to be empty, i.e. not contain any snaps or
+// sub-groups anymore.
+func RemoveQuotaGroupSlice(grp *quota.Group, inter interacter) error {
+	if err := os.Remove(grp.SliceFile()); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	sysd := systemd.New(systemd.SystemMode, inter)
+	return sysd.DaemonReload()
+}
+
 func genServiceSocketFile(appInfo *snap.AppInfo, socketName string) []byte {
 	socketTemplate := `[Unit]
 # Auto-generated, DO NOT EDIT
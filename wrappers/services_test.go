@@ -32,9 +32,11 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/snapcore/snapd/dirs"
+	"github.com/snapcore/snapd/gadget/quantity"
 	"github.com/snapcore/snapd/osutil"
 	"github.com/snapcore/snapd/progress"
 	"github.com/snapcore/snapd/snap"
+	"github.com/snapcore/snapd/snap/quota"
 	"github.com/snapcore/snapd/snap/snaptest"
 	"github.com/snapcore/snapd/strutil"
 	"github.com/snapcore/snapd/systemd"
@@ -498,6 +500,105 @@ func (s *servicesTestSuite) TestAddSnapServicesWithPreseed(c *C) {
 	c.Assert(r.Calls(), HasLen, 0)
 }
 
+func (s *servicesTestSuite) TestAddSnapServicesWithQuotaGroup(c *C) {
+	info := snaptest.MockSnap(c, packageHello, &snap.SideInfo{Revision: snap.R(12)})
+	svcFile := filepath.Join(s.tempdir, "/etc/systemd/system/snap.hello-snap.svc1.service")
+
+	grp, err := quota.NewGroup("foogroup", quota.Resources{Memory: quantity.SizeMiB})
+	c.Assert(err, IsNil)
+
+	opts := &wrappers.AddSnapServicesOptions{QuotaGroup: grp}
+	err = wrappers.AddSnapServices(info, opts, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+	})
+
+	c.Check(svcFile, testutil.FileContains, "\nSlice=snap.foogroup.slice\n")
+}
+
+func (s *servicesTestSuite) TestEnsureQuotaGroupSlice(c *C) {
+	grp, err := quota.NewGroup("foogroup", quota.Resources{Memory: quantity.SizeMiB, CPU: 150})
+	c.Assert(err, IsNil)
+	subGrp, err := grp.NewSubGroup("sub-group", quota.Resources{Memory: quantity.SizeMiB / 2, CPU: 50, Tasks: 32})
+	c.Assert(err, IsNil)
+
+	modified, err := wrappers.EnsureQuotaGroupSlice(subGrp, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(modified, Equals, true)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+	})
+
+	c.Check(filepath.Join(dirs.SnapServicesDir, "snap.foogroup.slice"), testutil.FileEquals, `[Unit]
+Description=Slice for snap quota group foogroup
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+# Always enable cpu accounting, so the following cpu quota options are used
+CPUAccounting=true
+CPUQuota=150%
+# Always enable memory accounting otherwise the MemoryMax setting does nothing.
+MemoryAccounting=true
+MemoryMax=1048576
+# for compatibility with older versions of systemd
+MemoryLimit=1048576
+`)
+	c.Check(filepath.Join(dirs.SnapServicesDir, `snap.foogroup-sub\x2dgroup.slice`), testutil.FileEquals, `[Unit]
+Description=Slice for snap quota group sub-group
+Before=slices.target
+X-Snappy=yes
+
+[Slice]
+# Always enable cpu accounting, so the following cpu quota options are used
+CPUAccounting=true
+CPUQuota=50%
+# Always enable memory accounting otherwise the MemoryMax setting does nothing.
+MemoryAccounting=true
+MemoryMax=524288
+# for compatibility with older versions of systemd
+MemoryLimit=524288
+# Always enable task accounting in order to be able to count the processes/
+# threads, etc for a slice
+TasksAccounting=true
+TasksMax=32
+`)
+
+	// doing it again is a no-op
+	s.sysdLog = nil
+	modified, err = wrappers.EnsureQuotaGroupSlice(subGrp, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(modified, Equals, false)
+	c.Check(s.sysdLog, HasLen, 0)
+
+	// but changing the limits rewrites the slice
+	err = subGrp.UpdateLimits(quota.Resources{Memory: quantity.SizeMiB / 4, CPU: 50})
+	c.Assert(err, IsNil)
+	modified, err = wrappers.EnsureQuotaGroupSlice(subGrp, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(modified, Equals, true)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+	})
+	c.Check(filepath.Join(dirs.SnapServicesDir, `snap.foogroup-sub\x2dgroup.slice`), testutil.FileContains, "MemoryMax=262144\n")
+	c.Check(filepath.Join(dirs.SnapServicesDir, `snap.foogroup-sub\x2dgroup.slice`), Not(testutil.FileContains), "TasksMax")
+
+	s.sysdLog = nil
+	err = wrappers.RemoveQuotaGroupSlice(subGrp, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(filepath.Join(dirs.SnapServicesDir, `snap.foogroup-sub\x2dgroup.slice`), testutil.FileAbsent)
+	c.Check(s.sysdLog, DeepEquals, [][]string{
+		{"daemon-reload"},
+	})
+
+	// removing a slice which is not there is fine
+	s.sysdLog = nil
+	err = wrappers.RemoveQuotaGroupSlice(subGrp, progress.Null)
+	c.Assert(err, IsNil)
+	c.Check(s.sysdLog, HasLen, 0)
+}
+
 func (s *servicesTestSuite) TestStopServicesWithSockets(c *C) {
 	var sysServices, userServices []string
 	r := systemd.MockSystemctl(func(cmd ...string) ([]byte, error) {